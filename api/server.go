@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -13,14 +14,19 @@ import (
 	"nofx/crypto"
 	"nofx/decision"
 	"nofx/hook"
+	"nofx/logger"
 	"nofx/manager"
+	"nofx/market"
+	"nofx/mcp"
 	"nofx/trader"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Server HTTP API服务器
@@ -78,6 +84,12 @@ func corsMiddleware() gin.HandlerFunc {
 
 // setupRoutes 设置路由
 func (s *Server) setupRoutes() {
+	// 就绪/存活探针（Kubernetes readinessProbe 使用，不在 /api 前缀下）
+	s.router.GET("/healthz", s.handleHealthz)
+
+	// Prometheus 指标（交易员净值、持仓、开平仓、AI/交易所错误、WebSocket 重连）
+	s.router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
 	// API路由组
 	api := s.router.Group("/api")
 	{
@@ -132,6 +144,16 @@ func (s *Server) setupRoutes() {
 			protected.DELETE("/traders/:id", s.handleDeleteTrader)
 			protected.POST("/traders/:id/start", s.handleStartTrader)
 			protected.POST("/traders/:id/stop", s.handleStopTrader)
+			protected.PUT("/traders/:id/disabled", s.handleSetTraderDisabled)
+			protected.POST("/traders/:id/flatten", s.handleFlattenTrader)
+			protected.POST("/traders/:id/rebaseline", s.handleRebaselineTrader)
+			protected.GET("/traders/:id/decisions", s.handleTraderDecisions)
+			protected.GET("/traders/:id/prompt-preview", s.handleTraderPromptPreview)
+			protected.POST("/traders/:id/ai-probe", s.handleProbeTraderAI)
+			protected.POST("/traders/:id/validate-decision", s.handleValidateDecision)
+			protected.GET("/traders/:id/manual-holds", s.handleGetManualHolds)
+			protected.PUT("/traders/:id/manual-holds/:symbol", s.handleSetManualHold)
+			protected.DELETE("/traders/:id/manual-holds/:symbol", s.handleDeleteManualHold)
 			protected.PUT("/traders/:id/prompt", s.handleUpdateTraderPrompt)
 
 			// AI模型配置
@@ -148,12 +170,17 @@ func (s *Server) setupRoutes() {
 
 			// 指定trader的数据（使用query参数 ?trader_id=xxx）
 			protected.GET("/status", s.handleStatus)
+			protected.GET("/token-usage", s.handleTokenUsage)
+			protected.GET("/user/summary", s.handleUserSummary)
 			protected.GET("/account", s.handleAccount)
 			protected.GET("/positions", s.handlePositions)
 			protected.GET("/decisions", s.handleDecisions)
 			protected.GET("/decisions/latest", s.handleLatestDecisions)
 			protected.GET("/statistics", s.handleStatistics)
 			protected.GET("/performance", s.handlePerformance)
+			protected.GET("/performance/reconcile", s.handleReconcilePnL)
+			protected.GET("/performance/range", s.handlePerformanceRange)
+			protected.GET("/performance/export", s.handleExportTradesCSV)
 		}
 	}
 }
@@ -166,6 +193,125 @@ func (s *Server) handleHealth(c *gin.Context) {
 	})
 }
 
+const (
+	// aiHealthWindow AI最近一次成功调用在此时间内视为正常，否则请求模型列表探测（不消耗 token）
+	aiHealthWindow = 10 * time.Minute
+	// healthzProbeTimeout 单次 /healthz 等待AI探测的最长时间
+	healthzProbeTimeout = 10 * time.Second
+	// traderStopTimeout 停止交易员时等待当前决策周期结束的最长时间
+	traderStopTimeout = 30 * time.Second
+)
+
+// handleHealthz 就绪检查：WebSocket 行情正常时返回 200，否则返回 503
+// AI连通性按交易员单独报告，不影响就绪状态（单个AI端点故障不应让整个实例下线），且不发送消耗 token 的请求
+func (s *Server) handleHealthz(c *gin.Context) {
+	healthy := true
+
+	// 1. WebSocket 行情：至少有一个订阅币种在过期阈值内收到过K线推送
+	wsStatus := gin.H{
+		"ok":                     false,
+		"websocket_last_msg_age": nil,
+		"max_age_seconds":        market.KlineMaxAge.Seconds(),
+	}
+	if market.WSMonitorCli == nil {
+		wsStatus["error"] = "WebSocket 监控器未初始化"
+	} else if age, ok := market.WSMonitorCli.LastKlineAge(); !ok {
+		wsStatus["error"] = "尚未收到任何K线推送"
+	} else {
+		health := market.WSMonitorCli.StreamHealth()
+		wsStatus["active_streams"] = health.ActiveStreams
+		wsStatus["oldest_stream_age"] = health.OldestMessageAge.Seconds()
+		wsStatus["websocket_last_msg_age"] = age.Seconds()
+		wsStatus["ok"] = age <= market.KlineMaxAge
+		if age > market.KlineMaxAge {
+			wsStatus["error"] = fmt.Sprintf("K线数据已过期 (%.1f 分钟)", age.Minutes())
+		}
+	}
+	if ok, _ := wsStatus["ok"].(bool); !ok {
+		healthy = false
+	}
+
+	// 2. AI 连通性：各交易员AI客户端最近是否有成功响应（并发探测模型列表，带超时），仅报告
+	traders := s.traderManager.GetAllTraders()
+	aiClients := make([]gin.H, 0, len(traders))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for id, t := range traders {
+		wg.Add(1)
+		go func(id string, t *trader.AutoTrader) {
+			defer wg.Done()
+			status := gin.H{
+				"trader_id":  id,
+				"ai_model":   t.GetAIModel(),
+				"ok":         true,
+				"ai_last_ok": nil,
+			}
+			lastOK, err := t.GetAIHealth(aiHealthWindow)
+			if !lastOK.IsZero() {
+				status["ai_last_ok"] = lastOK.Format(time.RFC3339)
+			}
+			if err != nil {
+				status["ok"] = false
+				status["error"] = err.Error()
+			}
+			mu.Lock()
+			aiClients = append(aiClients, status)
+			mu.Unlock()
+		}(id, t)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	aiOK := true
+	select {
+	case <-done:
+	case <-time.After(healthzProbeTimeout):
+		aiOK = false
+	}
+
+	mu.Lock()
+	for _, status := range aiClients {
+		if ok, _ := status["ok"].(bool); !ok {
+			aiOK = false
+		}
+	}
+	aiStatus := gin.H{
+		"ok":      aiOK,
+		"clients": append([]gin.H(nil), aiClients...),
+	}
+	mu.Unlock()
+	if !aiOK {
+		aiStatus["error"] = "部分AI客户端无响应或探测超时"
+	}
+
+	// AI端点熔断器：熔断中的端点调用会被直接拒绝
+	breakers := mcp.BreakerStatuses()
+	aiStatus["breakers"] = breakers
+	for _, b := range breakers {
+		if b.State == mcp.BreakerOpen {
+			aiStatus["ok"] = false
+			aiStatus["error"] = fmt.Sprintf("AI端点 %s 熔断中", b.Endpoint)
+		}
+	}
+
+	statusCode := http.StatusOK
+	statusText := "ok"
+	if !healthy {
+		statusCode = http.StatusServiceUnavailable
+		statusText = "degraded"
+	}
+
+	c.JSON(statusCode, gin.H{
+		"status":    statusText,
+		"websocket": wsStatus,
+		"ai":        aiStatus,
+		"time":      time.Now().Format(time.RFC3339),
+	})
+}
+
 // handleGetSystemConfig 获取系统配置（客户端需要知道的配置）
 func (s *Server) handleGetSystemConfig(c *gin.Context) {
 	// 获取默认币种
@@ -382,20 +528,54 @@ func (s *Server) getTraderFromQuery(c *gin.Context) (*manager.TraderManager, str
 
 // AI交易员管理相关结构体
 type CreateTraderRequest struct {
-	Name                 string  `json:"name" binding:"required"`
-	AIModelID            string  `json:"ai_model_id" binding:"required"`
-	ExchangeID           string  `json:"exchange_id" binding:"required"`
-	InitialBalance       float64 `json:"initial_balance"`
-	ScanIntervalMinutes  int     `json:"scan_interval_minutes"`
-	BTCETHLeverage       int     `json:"btc_eth_leverage"`
-	AltcoinLeverage      int     `json:"altcoin_leverage"`
-	TradingSymbols       string  `json:"trading_symbols"`
-	CustomPrompt         string  `json:"custom_prompt"`
-	OverrideBasePrompt   bool    `json:"override_base_prompt"`
-	SystemPromptTemplate string  `json:"system_prompt_template"` // 系统提示词模板名称
-	IsCrossMargin        *bool   `json:"is_cross_margin"`        // 指针类型，nil表示使用默认值true
-	UseCoinPool          bool    `json:"use_coin_pool"`
-	UseOITop             bool    `json:"use_oi_top"`
+	Name                    string            `json:"name" binding:"required"`
+	AIModelID               string            `json:"ai_model_id" binding:"required"`
+	ExchangeID              string            `json:"exchange_id" binding:"required"`
+	InitialBalance          float64           `json:"initial_balance"`
+	ScanIntervalMinutes     int               `json:"scan_interval_minutes"`
+	BTCETHLeverage          int               `json:"btc_eth_leverage"`
+	AltcoinLeverage         int               `json:"altcoin_leverage"`
+	TradingSymbols          string            `json:"trading_symbols"`
+	CustomPrompt            string            `json:"custom_prompt"`
+	OverrideBasePrompt      bool              `json:"override_base_prompt"`
+	SystemPromptTemplate    string            `json:"system_prompt_template"`     // 系统提示词模板名称
+	IsCrossMargin           *bool             `json:"is_cross_margin"`            // 指针类型，nil表示使用默认值true
+	HedgeMode               bool              `json:"hedge_mode"`                 // 是否启用双向持仓
+	AutoBumpMinNotional     bool              `json:"auto_bump_min_notional"`     // 低于最小名义价值时自动上调数量
+	PostStopCooldownMinutes int               `json:"post_stop_cooldown_minutes"` // 止损后同币种冷却时长（分钟）
+	MaxOpenPositions        int               `json:"max_open_positions"`         // 最大同时持仓数（0=不限制）
+	BlacklistSymbols        string            `json:"blacklist_symbols"`          // 禁止开仓的币种（逗号分隔）
+	ScanJitterPercent       *int              `json:"scan_jitter_percent"`        // 扫描间隔随机抖动百分比，nil表示使用默认值10
+	FallbackAIModelID       string            `json:"fallback_ai_model_id"`       // 备用AI模型ID（主模型调用失败时使用）
+	MaxCorrelatedExposure   float64           `json:"max_correlated_exposure"`    // 相关性调整后的总敞口上限（净值倍数，0=不限制）
+	DefaultStopLossPct      float64           `json:"default_stop_loss_pct"`      // 开仓未给出有效止损时的默认止损百分比（0=不设置）
+	CloseReasonTolerancePct float64           `json:"close_reason_tolerance_pct"` // 被动平仓原因推断的价格容差（百分比，0=默认1%）
+	MaxPositionPctOfEquity  float64           `json:"max_position_pct_of_equity"` // 单币种开仓保证金占净值的上限（百分比，0=不限制）
+	ClampPositionSize       bool              `json:"clamp_position_size"`        // 超过单币种上限时缩减到上限（false=拒绝开仓）
+	AllowHighVolOpens       bool              `json:"allow_high_vol_opens"`       // 市场极端波动时仍允许开新仓（默认不允许）
+	RebaselineSchedule      string            `json:"rebaseline_schedule"`        // 初始余额基准定时重置周期（daily/weekly，空=不自动重置）
+	BTCETHMaxSpreadBps      float64           `json:"btc_eth_max_spread_bps"`     // BTC/ETH 开仓点差上限（基点，0=不检查）
+	AltcoinMaxSpreadBps     float64           `json:"altcoin_max_spread_bps"`     // 山寨币开仓点差上限（基点，0=不检查）
+	ShadowAIModelID         string            `json:"shadow_ai_model_id"`         // 影子AI模型ID（只记录决策不执行）
+	SkipAIWithoutTrigger    bool              `json:"skip_ai_without_trigger"`    // 无持仓且无触发条件时跳过AI调用
+	TriggerPriceMovePct     float64           `json:"trigger_price_move_pct"`     // 触发AI调用的1小时涨跌幅阈值（%，0=默认）
+	TriggerVolumeSpike      float64           `json:"trigger_volume_spike"`       // 触发AI调用的成交量放大倍数（0=默认）
+	ConsensusOpens          bool              `json:"consensus_opens"`            // 开仓需两次AI调用方向一致才执行
+	RetryEmptyDecision      bool              `json:"retry_empty_decision"`       // 有持仓且AI返回空决策时重新请求一次
+	Timezone                string            `json:"timezone"`                   // 日界时区（IANA名称，如 Asia/Shanghai；空=UTC）
+	DustThresholdUSD        float64           `json:"dust_threshold_usd"`         // 零头持仓阈值（名义价值USDT，0=使用交易所该币种的最小名义价值）
+	AlwaysContextSymbols    string            `json:"always_context_symbols"`     // 始终提供行情的参考币种（逗号分隔，仅作上下文，不在候选中时不可开仓）
+	MaxHoldMinutes          int               `json:"max_hold_minutes"`           // 最长持仓时间（分钟），超过后自动平仓（0=不限制）
+	OrderTimeoutSeconds     int               `json:"order_timeout_seconds"`      // 单笔下单超时（秒），超时后撤单并跳过（0=默认10秒）
+	RepeatDecisionLimit     int               `json:"repeat_decision_limit"`      // 同一币种连续多少个周期决策相同时暂停该币种（0=不检测）
+	RepeatBackoffMinutes    *int              `json:"repeat_backoff_minutes"`     // 重复决策暂停时长（分钟），不传默认15
+	AITemperature           *float64          `json:"ai_temperature"`             // AI采样温度（0-2），不传使用默认0.5
+	AITopP                  *float64          `json:"ai_top_p"`                   // AI top_p（0-1），不传则不发送
+	StrategyTag             string            `json:"strategy_tag"`               // 策略标签（如prompt版本），为空时按模板和prompt自动生成
+	LeverageTiers           map[string]int    `json:"leverage_tiers"`             // 杠杆分级（币种 -> 杠杆上限，default 为其余币种），为空使用两档杠杆
+	MarginModes             map[string]string `json:"margin_modes"`               // 按币种覆盖仓位模式（币种 -> cross/isolated），未覆盖的币种使用 is_cross_margin
+	UseCoinPool             bool              `json:"use_coin_pool"`
+	UseOITop                bool              `json:"use_oi_top"`
 }
 
 type ModelConfig struct {
@@ -480,6 +660,73 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 		return
 	}
 
+	leverageTiers, err := encodeLeverageTiers(req.LeverageTiers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	marginModes, err := encodeMarginModes(req.MarginModes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DefaultStopLossPct < 0 || req.DefaultStopLossPct >= 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "默认止损百分比必须在0-100之间"})
+		return
+	}
+	if req.CloseReasonTolerancePct < 0 || req.CloseReasonTolerancePct > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "平仓原因价格容差必须在0-10之间"})
+		return
+	}
+	if req.BTCETHMaxSpreadBps < 0 || req.AltcoinMaxSpreadBps < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "点差上限不能为负数"})
+		return
+	}
+	if req.TriggerPriceMovePct < 0 || req.TriggerVolumeSpike < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "触发阈值不能为负数"})
+		return
+	}
+	if req.MaxPositionPctOfEquity < 0 || req.MaxPositionPctOfEquity > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单币种仓位上限必须在0-100之间"})
+		return
+	}
+	if req.MaxHoldMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "最长持仓时间不能为负数"})
+		return
+	}
+	if req.OrderTimeoutSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "下单超时不能为负数"})
+		return
+	}
+	if req.RepeatDecisionLimit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "重复决策次数不能为负数"})
+		return
+	}
+	repeatBackoffMinutes := 15 // 默认15分钟
+	if req.RepeatBackoffMinutes != nil {
+		if *req.RepeatBackoffMinutes < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "重复决策暂停时长不能为负数"})
+			return
+		}
+		repeatBackoffMinutes = *req.RepeatBackoffMinutes
+	}
+	aiTemperature, err := resolveSamplingParam(req.AITemperature, -1, 2, "temperature")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	aiTopP, err := resolveSamplingParam(req.AITopP, -1, 1, "top_p")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	strategyTag := strings.TrimSpace(req.StrategyTag)
+	rebaselineSchedule := strings.TrimSpace(req.RebaselineSchedule)
+	if !trader.ValidRebaselineSchedule(rebaselineSchedule) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "初始余额重置周期只能是 daily、weekly 或留空"})
+		return
+	}
+
 	// 校验交易币种格式
 	if req.TradingSymbols != "" {
 		symbols := strings.Split(req.TradingSymbols, ",")
@@ -501,6 +748,10 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 	if req.IsCrossMargin != nil {
 		isCrossMargin = *req.IsCrossMargin
 	}
+	scanJitterPercent := 10 // 默认±10%
+	if req.ScanJitterPercent != nil {
+		scanJitterPercent = *req.ScanJitterPercent
+	}
 
 	// 设置杠杆默认值（从系统配置获取）
 	btcEthLeverage := 5
@@ -531,6 +782,10 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 	if req.SystemPromptTemplate != "" {
 		systemPromptTemplate = req.SystemPromptTemplate
 	}
+	if err := decision.ValidatePromptTemplate(systemPromptTemplate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 设置扫描间隔默认值
 	scanIntervalMinutes := req.ScanIntervalMinutes
@@ -578,6 +833,8 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 				exchangeCfg.AsterSigner,
 				exchangeCfg.AsterPrivateKey,
 			)
+		case "bybit":
+			tempTrader = trader.NewBybitTrader(exchangeCfg.APIKey, exchangeCfg.SecretKey, exchangeCfg.Testnet)
 		default:
 			log.Printf("⚠️ 不支持的交易所类型: %s，使用用户输入的初始资金", req.ExchangeID)
 		}
@@ -627,23 +884,57 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 
 	// 创建交易员配置（数据库实体）
 	trader := &config.TraderRecord{
-		ID:                   traderID,
-		UserID:               userID,
-		Name:                 req.Name,
-		AIModelID:            req.AIModelID,
-		ExchangeID:           req.ExchangeID,
-		InitialBalance:       actualBalance, // 使用实际查询的余额
-		BTCETHLeverage:       btcEthLeverage,
-		AltcoinLeverage:      altcoinLeverage,
-		TradingSymbols:       req.TradingSymbols,
-		UseCoinPool:          req.UseCoinPool,
-		UseOITop:             req.UseOITop,
-		CustomPrompt:         req.CustomPrompt,
-		OverrideBasePrompt:   req.OverrideBasePrompt,
-		SystemPromptTemplate: systemPromptTemplate,
-		IsCrossMargin:        isCrossMargin,
-		ScanIntervalMinutes:  scanIntervalMinutes,
-		IsRunning:            false,
+		ID:                      traderID,
+		UserID:                  userID,
+		Name:                    req.Name,
+		AIModelID:               req.AIModelID,
+		ExchangeID:              req.ExchangeID,
+		InitialBalance:          actualBalance, // 使用实际查询的余额
+		BTCETHLeverage:          btcEthLeverage,
+		AltcoinLeverage:         altcoinLeverage,
+		TradingSymbols:          req.TradingSymbols,
+		UseCoinPool:             req.UseCoinPool,
+		UseOITop:                req.UseOITop,
+		CustomPrompt:            req.CustomPrompt,
+		OverrideBasePrompt:      req.OverrideBasePrompt,
+		SystemPromptTemplate:    systemPromptTemplate,
+		IsCrossMargin:           isCrossMargin,
+		HedgeMode:               req.HedgeMode,
+		AutoBumpMinNotional:     req.AutoBumpMinNotional,
+		PostStopCooldownMinutes: req.PostStopCooldownMinutes,
+		MaxOpenPositions:        req.MaxOpenPositions,
+		BlacklistSymbols:        req.BlacklistSymbols,
+		ScanJitterPercent:       scanJitterPercent,
+		FallbackAIModelID:       req.FallbackAIModelID,
+		MaxCorrelatedExposure:   req.MaxCorrelatedExposure,
+		DefaultStopLossPct:      req.DefaultStopLossPct,
+		CloseReasonTolerancePct: req.CloseReasonTolerancePct,
+		MaxPositionPctOfEquity:  req.MaxPositionPctOfEquity,
+		ClampPositionSize:       req.ClampPositionSize,
+		AllowHighVolOpens:       req.AllowHighVolOpens,
+		RebaselineSchedule:      rebaselineSchedule,
+		BTCETHMaxSpreadBps:      req.BTCETHMaxSpreadBps,
+		AltcoinMaxSpreadBps:     req.AltcoinMaxSpreadBps,
+		ShadowAIModelID:         req.ShadowAIModelID,
+		SkipAIWithoutTrigger:    req.SkipAIWithoutTrigger,
+		TriggerPriceMovePct:     req.TriggerPriceMovePct,
+		TriggerVolumeSpike:      req.TriggerVolumeSpike,
+		ConsensusOpens:          req.ConsensusOpens,
+		RetryEmptyDecision:      req.RetryEmptyDecision,
+		Timezone:                req.Timezone,
+		DustThresholdUSD:        req.DustThresholdUSD,
+		AlwaysContextSymbols:    req.AlwaysContextSymbols,
+		MaxHoldMinutes:          req.MaxHoldMinutes,
+		OrderTimeoutSeconds:     req.OrderTimeoutSeconds,
+		RepeatDecisionLimit:     req.RepeatDecisionLimit,
+		RepeatBackoffMinutes:    repeatBackoffMinutes,
+		AITemperature:           aiTemperature,
+		AITopP:                  aiTopP,
+		StrategyTag:             strategyTag,
+		LeverageTiers:           leverageTiers,
+		MarginModes:             marginModes,
+		ScanIntervalMinutes:     scanIntervalMinutes,
+		IsRunning:               false,
 	}
 
 	// 保存到数据库
@@ -672,18 +963,141 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 
 // UpdateTraderRequest 更新交易员请求
 type UpdateTraderRequest struct {
-	Name                 string  `json:"name" binding:"required"`
-	AIModelID            string  `json:"ai_model_id" binding:"required"`
-	ExchangeID           string  `json:"exchange_id" binding:"required"`
-	InitialBalance       float64 `json:"initial_balance"`
-	ScanIntervalMinutes  int     `json:"scan_interval_minutes"`
-	BTCETHLeverage       int     `json:"btc_eth_leverage"`
-	AltcoinLeverage      int     `json:"altcoin_leverage"`
-	TradingSymbols       string  `json:"trading_symbols"`
-	CustomPrompt         string  `json:"custom_prompt"`
-	OverrideBasePrompt   bool    `json:"override_base_prompt"`
-	SystemPromptTemplate string  `json:"system_prompt_template"`
-	IsCrossMargin        *bool   `json:"is_cross_margin"`
+	Name                    string            `json:"name" binding:"required"`
+	AIModelID               string            `json:"ai_model_id" binding:"required"`
+	ExchangeID              string            `json:"exchange_id" binding:"required"`
+	InitialBalance          float64           `json:"initial_balance"`
+	ScanIntervalMinutes     int               `json:"scan_interval_minutes"`
+	BTCETHLeverage          int               `json:"btc_eth_leverage"`
+	AltcoinLeverage         int               `json:"altcoin_leverage"`
+	TradingSymbols          string            `json:"trading_symbols"`
+	CustomPrompt            string            `json:"custom_prompt"`
+	OverrideBasePrompt      bool              `json:"override_base_prompt"`
+	SystemPromptTemplate    string            `json:"system_prompt_template"`
+	IsCrossMargin           *bool             `json:"is_cross_margin"`
+	HedgeMode               *bool             `json:"hedge_mode"`
+	AutoBumpMinNotional     *bool             `json:"auto_bump_min_notional"`
+	PostStopCooldownMinutes *int              `json:"post_stop_cooldown_minutes"`
+	MaxOpenPositions        *int              `json:"max_open_positions"`
+	BlacklistSymbols        *string           `json:"blacklist_symbols"`
+	ScanJitterPercent       *int              `json:"scan_jitter_percent"`
+	FallbackAIModelID       *string           `json:"fallback_ai_model_id"`
+	MaxCorrelatedExposure   *float64          `json:"max_correlated_exposure"`
+	DefaultStopLossPct      *float64          `json:"default_stop_loss_pct"`
+	CloseReasonTolerancePct *float64          `json:"close_reason_tolerance_pct"`
+	MaxPositionPctOfEquity  *float64          `json:"max_position_pct_of_equity"`
+	ClampPositionSize       *bool             `json:"clamp_position_size"`
+	AllowHighVolOpens       *bool             `json:"allow_high_vol_opens"`
+	RebaselineSchedule      *string           `json:"rebaseline_schedule"`
+	BTCETHMaxSpreadBps      *float64          `json:"btc_eth_max_spread_bps"`
+	AltcoinMaxSpreadBps     *float64          `json:"altcoin_max_spread_bps"`
+	ShadowAIModelID         *string           `json:"shadow_ai_model_id"`
+	SkipAIWithoutTrigger    *bool             `json:"skip_ai_without_trigger"`
+	TriggerPriceMovePct     *float64          `json:"trigger_price_move_pct"`
+	TriggerVolumeSpike      *float64          `json:"trigger_volume_spike"`
+	ConsensusOpens          *bool             `json:"consensus_opens"`
+	RetryEmptyDecision      *bool             `json:"retry_empty_decision"`
+	Timezone                *string           `json:"timezone"`
+	DustThresholdUSD        *float64          `json:"dust_threshold_usd"`
+	AlwaysContextSymbols    *string           `json:"always_context_symbols"`
+	MaxHoldMinutes          *int              `json:"max_hold_minutes"`
+	OrderTimeoutSeconds     *int              `json:"order_timeout_seconds"`
+	RepeatDecisionLimit     *int              `json:"repeat_decision_limit"`
+	RepeatBackoffMinutes    *int              `json:"repeat_backoff_minutes"`
+	AITemperature           *float64          `json:"ai_temperature"` // 负数表示恢复默认值
+	AITopP                  *float64          `json:"ai_top_p"`       // 负数表示不再发送
+	StrategyTag             *string           `json:"strategy_tag"`   // nil 表示保持原值，"" 表示改为自动生成
+	LeverageTiers           map[string]int    `json:"leverage_tiers"` // nil 表示保持原值，{} 表示清空
+	MarginModes             map[string]string `json:"margin_modes"`   // nil 表示保持原值，{} 表示清空
+}
+
+// encodeLeverageTiers 校验杠杆分级（1-125倍，币种须以USDT结尾或为 default）并编码为 JSON 存储，为空时返回空字符串
+func encodeLeverageTiers(tiers map[string]int) (string, error) {
+	if len(tiers) == 0 {
+		return "", nil
+	}
+	normalized := make(map[string]int, len(tiers))
+	for symbol, leverage := range tiers {
+		key := strings.ToUpper(strings.TrimSpace(symbol))
+		if key == strings.ToUpper(decision.LeverageTierDefault) {
+			key = decision.LeverageTierDefault
+		} else if !strings.HasSuffix(key, "USDT") {
+			return "", fmt.Errorf("杠杆分级中无效的币种: %s，必须以USDT结尾或为 default", symbol)
+		}
+		if leverage < 1 || leverage > 125 {
+			return "", fmt.Errorf("杠杆分级 %s 的杠杆必须在1-125倍之间: %d", symbol, leverage)
+		}
+		normalized[key] = leverage
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeLeverageTiers 解析存储的杠杆分级（未配置或格式错误时返回空）
+func decodeLeverageTiers(value string) map[string]int {
+	tiers := map[string]int{}
+	if value != "" {
+		_ = json.Unmarshal([]byte(value), &tiers)
+	}
+	return tiers
+}
+
+// encodeMarginModes 校验按币种仓位模式（币种须以USDT结尾，取值为 cross/isolated）并编码为 JSON 存储，为空时返回空字符串
+func encodeMarginModes(modes map[string]string) (string, error) {
+	if len(modes) == 0 {
+		return "", nil
+	}
+	normalized := make(map[string]string, len(modes))
+	for symbol, mode := range modes {
+		key := strings.ToUpper(strings.TrimSpace(symbol))
+		if !strings.HasSuffix(key, "USDT") {
+			return "", fmt.Errorf("仓位模式配置中无效的币种: %s，必须以USDT结尾", symbol)
+		}
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		if mode != trader.MarginModeCross && mode != trader.MarginModeIsolated {
+			return "", fmt.Errorf("币种 %s 的仓位模式无效: %s，必须为 %s 或 %s", symbol, mode, trader.MarginModeCross, trader.MarginModeIsolated)
+		}
+		normalized[key] = mode
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// resolveSamplingParam 校验AI采样参数（0-max）：未传时返回 current，负数表示恢复默认（存储为 -1）
+func resolveSamplingParam(value *float64, current, max float64, name string) (float64, error) {
+	if value == nil {
+		return current, nil
+	}
+	if *value < 0 {
+		return -1, nil
+	}
+	if *value > max {
+		return 0, fmt.Errorf("%s 必须在0-%g之间: %g", name, max, *value)
+	}
+	return *value, nil
+}
+
+// samplingParamValue 存储的采样参数转为接口返回值（未设置时为 null）
+func samplingParamValue(value float64) interface{} {
+	if value < 0 {
+		return nil
+	}
+	return value
+}
+
+// decodeMarginModes 解析存储的按币种仓位模式（未配置或格式错误时返回空）
+func decodeMarginModes(value string) map[string]string {
+	modes := map[string]string{}
+	if value != "" {
+		_ = json.Unmarshal([]byte(value), &modes)
+	}
+	return modes
 }
 
 // handleUpdateTrader 更新交易员配置
@@ -722,6 +1136,198 @@ func (s *Server) handleUpdateTrader(c *gin.Context) {
 	if req.IsCrossMargin != nil {
 		isCrossMargin = *req.IsCrossMargin
 	}
+	hedgeMode := existingTrader.HedgeMode // 保持原值
+	if req.HedgeMode != nil {
+		hedgeMode = *req.HedgeMode
+	}
+	autoBumpMinNotional := existingTrader.AutoBumpMinNotional // 保持原值
+	if req.AutoBumpMinNotional != nil {
+		autoBumpMinNotional = *req.AutoBumpMinNotional
+	}
+	postStopCooldownMinutes := existingTrader.PostStopCooldownMinutes // 保持原值
+	if req.PostStopCooldownMinutes != nil {
+		postStopCooldownMinutes = *req.PostStopCooldownMinutes
+	}
+	maxOpenPositions := existingTrader.MaxOpenPositions // 保持原值
+	if req.MaxOpenPositions != nil {
+		maxOpenPositions = *req.MaxOpenPositions
+	}
+	blacklistSymbols := existingTrader.BlacklistSymbols // 保持原值
+	if req.BlacklistSymbols != nil {
+		blacklistSymbols = *req.BlacklistSymbols
+	}
+	scanJitterPercent := existingTrader.ScanJitterPercent // 保持原值
+	if req.ScanJitterPercent != nil {
+		scanJitterPercent = *req.ScanJitterPercent
+	}
+	fallbackAIModelID := existingTrader.FallbackAIModelID // 保持原值
+	if req.FallbackAIModelID != nil {
+		fallbackAIModelID = *req.FallbackAIModelID
+	}
+	maxCorrelatedExposure := existingTrader.MaxCorrelatedExposure // 保持原值
+	if req.MaxCorrelatedExposure != nil {
+		maxCorrelatedExposure = *req.MaxCorrelatedExposure
+	}
+	defaultStopLossPct := existingTrader.DefaultStopLossPct // 保持原值
+	if req.DefaultStopLossPct != nil {
+		if *req.DefaultStopLossPct < 0 || *req.DefaultStopLossPct >= 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "默认止损百分比必须在0-100之间"})
+			return
+		}
+		defaultStopLossPct = *req.DefaultStopLossPct
+	}
+	closeReasonTolerancePct := existingTrader.CloseReasonTolerancePct // 保持原值
+	if req.CloseReasonTolerancePct != nil {
+		if *req.CloseReasonTolerancePct < 0 || *req.CloseReasonTolerancePct > 10 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "平仓原因价格容差必须在0-10之间"})
+			return
+		}
+		closeReasonTolerancePct = *req.CloseReasonTolerancePct
+	}
+	maxPositionPctOfEquity := existingTrader.MaxPositionPctOfEquity // 保持原值
+	if req.MaxPositionPctOfEquity != nil {
+		if *req.MaxPositionPctOfEquity < 0 || *req.MaxPositionPctOfEquity > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "单币种仓位上限必须在0-100之间"})
+			return
+		}
+		maxPositionPctOfEquity = *req.MaxPositionPctOfEquity
+	}
+	clampPositionSize := existingTrader.ClampPositionSize // 保持原值
+	if req.ClampPositionSize != nil {
+		clampPositionSize = *req.ClampPositionSize
+	}
+	allowHighVolOpens := existingTrader.AllowHighVolOpens // 保持原值
+	if req.AllowHighVolOpens != nil {
+		allowHighVolOpens = *req.AllowHighVolOpens
+	}
+	btcEthMaxSpreadBps := existingTrader.BTCETHMaxSpreadBps // 保持原值
+	if req.BTCETHMaxSpreadBps != nil {
+		if *req.BTCETHMaxSpreadBps < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "点差上限不能为负数"})
+			return
+		}
+		btcEthMaxSpreadBps = *req.BTCETHMaxSpreadBps
+	}
+	altcoinMaxSpreadBps := existingTrader.AltcoinMaxSpreadBps // 保持原值
+	if req.AltcoinMaxSpreadBps != nil {
+		if *req.AltcoinMaxSpreadBps < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "点差上限不能为负数"})
+			return
+		}
+		altcoinMaxSpreadBps = *req.AltcoinMaxSpreadBps
+	}
+	shadowAIModelID := existingTrader.ShadowAIModelID // 保持原值
+	if req.ShadowAIModelID != nil {
+		shadowAIModelID = *req.ShadowAIModelID
+	}
+	skipAIWithoutTrigger := existingTrader.SkipAIWithoutTrigger // 保持原值
+	if req.SkipAIWithoutTrigger != nil {
+		skipAIWithoutTrigger = *req.SkipAIWithoutTrigger
+	}
+	triggerPriceMovePct := existingTrader.TriggerPriceMovePct // 保持原值
+	if req.TriggerPriceMovePct != nil {
+		if *req.TriggerPriceMovePct < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "触发阈值不能为负数"})
+			return
+		}
+		triggerPriceMovePct = *req.TriggerPriceMovePct
+	}
+	triggerVolumeSpike := existingTrader.TriggerVolumeSpike // 保持原值
+	if req.TriggerVolumeSpike != nil {
+		if *req.TriggerVolumeSpike < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "触发阈值不能为负数"})
+			return
+		}
+		triggerVolumeSpike = *req.TriggerVolumeSpike
+	}
+	consensusOpens := existingTrader.ConsensusOpens // 保持原值
+	if req.ConsensusOpens != nil {
+		consensusOpens = *req.ConsensusOpens
+	}
+	retryEmptyDecision := existingTrader.RetryEmptyDecision // 保持原值
+	if req.RetryEmptyDecision != nil {
+		retryEmptyDecision = *req.RetryEmptyDecision
+	}
+	timezone := existingTrader.Timezone // 保持原值
+	if req.Timezone != nil {
+		timezone = *req.Timezone
+	}
+	dustThresholdUSD := existingTrader.DustThresholdUSD // 保持原值
+	if req.DustThresholdUSD != nil {
+		dustThresholdUSD = *req.DustThresholdUSD
+	}
+	alwaysContextSymbols := existingTrader.AlwaysContextSymbols // 保持原值
+	if req.AlwaysContextSymbols != nil {
+		alwaysContextSymbols = *req.AlwaysContextSymbols
+	}
+	maxHoldMinutes := existingTrader.MaxHoldMinutes // 保持原值
+	if req.MaxHoldMinutes != nil {
+		if *req.MaxHoldMinutes < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "最长持仓时间不能为负数"})
+			return
+		}
+		maxHoldMinutes = *req.MaxHoldMinutes
+	}
+	orderTimeoutSeconds := existingTrader.OrderTimeoutSeconds // 保持原值
+	if req.OrderTimeoutSeconds != nil {
+		if *req.OrderTimeoutSeconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "下单超时不能为负数"})
+			return
+		}
+		orderTimeoutSeconds = *req.OrderTimeoutSeconds
+	}
+	repeatDecisionLimit := existingTrader.RepeatDecisionLimit // 保持原值
+	if req.RepeatDecisionLimit != nil {
+		if *req.RepeatDecisionLimit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "重复决策次数不能为负数"})
+			return
+		}
+		repeatDecisionLimit = *req.RepeatDecisionLimit
+	}
+	repeatBackoffMinutes := existingTrader.RepeatBackoffMinutes // 保持原值
+	if req.RepeatBackoffMinutes != nil {
+		if *req.RepeatBackoffMinutes < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "重复决策暂停时长不能为负数"})
+			return
+		}
+		repeatBackoffMinutes = *req.RepeatBackoffMinutes
+	}
+	aiTemperature, err := resolveSamplingParam(req.AITemperature, existingTrader.AITemperature, 2, "temperature")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	aiTopP, err := resolveSamplingParam(req.AITopP, existingTrader.AITopP, 1, "top_p")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	strategyTag := existingTrader.StrategyTag // 保持原值
+	if req.StrategyTag != nil {
+		strategyTag = strings.TrimSpace(*req.StrategyTag)
+	}
+	rebaselineSchedule := existingTrader.RebaselineSchedule // 保持原值
+	if req.RebaselineSchedule != nil {
+		rebaselineSchedule = strings.TrimSpace(*req.RebaselineSchedule)
+		if !trader.ValidRebaselineSchedule(rebaselineSchedule) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "初始余额重置周期只能是 daily、weekly 或留空"})
+			return
+		}
+	}
+	leverageTiers := existingTrader.LeverageTiers // 保持原值
+	if req.LeverageTiers != nil {
+		if leverageTiers, err = encodeLeverageTiers(req.LeverageTiers); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	marginModes := existingTrader.MarginModes // 保持原值
+	if req.MarginModes != nil {
+		if marginModes, err = encodeMarginModes(req.MarginModes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	// 设置杠杆默认值
 	btcEthLeverage := req.BTCETHLeverage
@@ -743,25 +1349,62 @@ func (s *Server) handleUpdateTrader(c *gin.Context) {
 	systemPromptTemplate := req.SystemPromptTemplate
 	if systemPromptTemplate == "" {
 		systemPromptTemplate = existingTrader.SystemPromptTemplate // 如果请求中没有提供，保持原值
+	} else if err := decision.ValidatePromptTemplate(systemPromptTemplate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	// 更新交易员配置
 	trader := &config.TraderRecord{
-		ID:                   traderID,
-		UserID:               userID,
-		Name:                 req.Name,
-		AIModelID:            req.AIModelID,
-		ExchangeID:           req.ExchangeID,
-		InitialBalance:       req.InitialBalance,
-		BTCETHLeverage:       btcEthLeverage,
-		AltcoinLeverage:      altcoinLeverage,
-		TradingSymbols:       req.TradingSymbols,
-		CustomPrompt:         req.CustomPrompt,
-		OverrideBasePrompt:   req.OverrideBasePrompt,
-		SystemPromptTemplate: systemPromptTemplate,
-		IsCrossMargin:        isCrossMargin,
-		ScanIntervalMinutes:  scanIntervalMinutes,
-		IsRunning:            existingTrader.IsRunning, // 保持原值
+		ID:                      traderID,
+		UserID:                  userID,
+		Name:                    req.Name,
+		AIModelID:               req.AIModelID,
+		ExchangeID:              req.ExchangeID,
+		InitialBalance:          req.InitialBalance,
+		BTCETHLeverage:          btcEthLeverage,
+		AltcoinLeverage:         altcoinLeverage,
+		TradingSymbols:          req.TradingSymbols,
+		CustomPrompt:            req.CustomPrompt,
+		OverrideBasePrompt:      req.OverrideBasePrompt,
+		SystemPromptTemplate:    systemPromptTemplate,
+		IsCrossMargin:           isCrossMargin,
+		HedgeMode:               hedgeMode,
+		AutoBumpMinNotional:     autoBumpMinNotional,
+		PostStopCooldownMinutes: postStopCooldownMinutes,
+		MaxOpenPositions:        maxOpenPositions,
+		BlacklistSymbols:        blacklistSymbols,
+		ScanJitterPercent:       scanJitterPercent,
+		FallbackAIModelID:       fallbackAIModelID,
+		MaxCorrelatedExposure:   maxCorrelatedExposure,
+		DefaultStopLossPct:      defaultStopLossPct,
+		CloseReasonTolerancePct: closeReasonTolerancePct,
+		MaxPositionPctOfEquity:  maxPositionPctOfEquity,
+		ClampPositionSize:       clampPositionSize,
+		AllowHighVolOpens:       allowHighVolOpens,
+		RebaselineSchedule:      rebaselineSchedule,
+		BTCETHMaxSpreadBps:      btcEthMaxSpreadBps,
+		AltcoinMaxSpreadBps:     altcoinMaxSpreadBps,
+		ShadowAIModelID:         shadowAIModelID,
+		SkipAIWithoutTrigger:    skipAIWithoutTrigger,
+		TriggerPriceMovePct:     triggerPriceMovePct,
+		TriggerVolumeSpike:      triggerVolumeSpike,
+		ConsensusOpens:          consensusOpens,
+		RetryEmptyDecision:      retryEmptyDecision,
+		Timezone:                timezone,
+		DustThresholdUSD:        dustThresholdUSD,
+		AlwaysContextSymbols:    alwaysContextSymbols,
+		MaxHoldMinutes:          maxHoldMinutes,
+		OrderTimeoutSeconds:     orderTimeoutSeconds,
+		RepeatDecisionLimit:     repeatDecisionLimit,
+		RepeatBackoffMinutes:    repeatBackoffMinutes,
+		AITemperature:           aiTemperature,
+		AITopP:                  aiTopP,
+		StrategyTag:             strategyTag,
+		LeverageTiers:           leverageTiers,
+		MarginModes:             marginModes,
+		ScanIntervalMinutes:     scanIntervalMinutes,
+		IsRunning:               existingTrader.IsRunning, // 保持原值
 	}
 
 	// 更新数据库
@@ -783,135 +1426,548 @@ func (s *Server) handleUpdateTrader(c *gin.Context) {
 		}
 	}
 
-	// 🔄 从内存中移除旧的trader实例，以便重新加载最新配置
-	s.traderManager.RemoveTrader(traderID)
+	// 🔄 热重载交易员：等待当前周期结束后按最新配置重建，运行中的交易员下个周期即按新配置执行
+	err = s.traderManager.ReloadTrader(s.database, userID, traderID)
+	reloadPending := errors.Is(err, manager.ErrReloadPending)
+	if err != nil && !reloadPending {
+		log.Printf("⚠️ 热重载交易员失败: %v", err)
+	}
 
-	// 重新加载交易员到内存
-	err = s.traderManager.LoadTraderByID(s.database, userID, traderID)
+	log.Printf("✓ 更新交易员成功: %s (模型: %s, 交易所: %s)", req.Name, req.AIModelID, req.ExchangeID)
+
+	if reloadPending {
+		// 配置已保存，但运行中的周期尚未结束，新配置在周期结束后生效
+		c.JSON(http.StatusAccepted, gin.H{
+			"trader_id":      traderID,
+			"trader_name":    req.Name,
+			"ai_model":       req.AIModelID,
+			"reload_pending": true,
+			"message":        "交易员更新成功，当前决策周期结束后生效",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trader_id":   traderID,
+		"trader_name": req.Name,
+		"ai_model":    req.AIModelID,
+		"message":     "交易员更新成功",
+	})
+}
+
+// handleDeleteTrader 删除交易员
+func (s *Server) handleDeleteTrader(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Param("id")
+
+	// 从数据库删除
+	err := s.database.DeleteTrader(userID, traderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("删除交易员失败: %v", err)})
+		return
+	}
+
+	// 如果交易员正在运行，先停止它
+	if trader, err := s.traderManager.GetTrader(traderID); err == nil {
+		status := trader.GetStatus()
+		if isRunning, ok := status["is_running"].(bool); ok && isRunning {
+			ctx, cancel := context.WithTimeout(context.Background(), traderStopTimeout)
+			if err := trader.Stop(ctx); err != nil {
+				log.Printf("⚠️  等待交易员 %s 当前周期结束超时: %v", traderID, err)
+			}
+			cancel()
+			log.Printf("⏹  已停止运行中的交易员: %s", traderID)
+		}
+	}
+
+	log.Printf("✓ 交易员已删除: %s", traderID)
+	c.JSON(http.StatusOK, gin.H{"message": "交易员已删除"})
+}
+
+// handleStartTrader 启动交易员
+func (s *Server) handleStartTrader(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Param("id")
+
+	// 校验交易员是否属于当前用户
+	traderRecord, _, _, err := s.database.GetTraderConfig(userID, traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
+		return
+	}
+
+	if traderRecord.Disabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "交易员已紧急停用，请先解除停用"})
+		return
+	}
+
+	// 获取模板名称
+	templateName := traderRecord.SystemPromptTemplate
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在"})
+		return
+	}
+
+	// 检查交易员是否已经在运行
+	status := trader.GetStatus()
+	if isRunning, ok := status["is_running"].(bool); ok && isRunning {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "交易员已在运行中"})
+		return
+	}
+	if isStopping, ok := status["is_stopping"].(bool); ok && isStopping {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "交易员正在停止，当前决策周期结束后才能重新启动"})
+		return
+	}
+
+	// 重新加载系统提示词模板（确保使用最新的硬盘文件）
+	s.reloadPromptTemplatesWithLog(templateName)
+
+	// 启动交易员
+	go func() {
+		log.Printf("▶️  启动交易员 %s (%s)", traderID, trader.GetName())
+		if err := trader.Run(); err != nil {
+			log.Printf("❌ 交易员 %s 运行错误: %v", trader.GetName(), err)
+		}
+	}()
+
+	// 更新数据库中的运行状态
+	err = s.database.UpdateTraderStatus(userID, traderID, true)
+	if err != nil {
+		log.Printf("⚠️  更新交易员状态失败: %v", err)
+	}
+
+	log.Printf("✓ 交易员 %s 已启动", trader.GetName())
+	c.JSON(http.StatusOK, gin.H{"message": "交易员已启动"})
+}
+
+// handleStopTrader 停止交易员
+func (s *Server) handleStopTrader(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Param("id")
+
+	// 校验交易员是否属于当前用户
+	_, _, _, err := s.database.GetTraderConfig(userID, traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在"})
+		return
+	}
+
+	// 检查交易员是否正在运行
+	status := trader.GetStatus()
+	if isRunning, ok := status["is_running"].(bool); ok && !isRunning {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "交易员已停止"})
+		return
+	}
+
+	// 停止交易员（等待当前周期执行完毕，最多 traderStopTimeout）
+	ctx, cancel := context.WithTimeout(context.Background(), traderStopTimeout)
+	defer cancel()
+	if err := trader.Stop(ctx); err != nil {
+		log.Printf("⚠️  等待交易员 %s 当前周期结束超时: %v", traderID, err)
+	}
+
+	// 更新数据库中的运行状态
+	err = s.database.UpdateTraderStatus(userID, traderID, false)
+	if err != nil {
+		log.Printf("⚠️  更新交易员状态失败: %v", err)
+	}
+
+	log.Printf("⏹  交易员 %s 已停止", trader.GetName())
+	c.JSON(http.StatusOK, gin.H{"message": "交易员已停止"})
+}
+
+// handleSetTraderDisabled 紧急停用/解除停用交易员
+// 停用标记写入数据库：停用的交易员立即停止、拒绝启动和执行交易，服务重启和热重载后不会加载；
+// 与停止不同，只能通过本接口显式解除，解除后不自动启动
+func (s *Server) handleSetTraderDisabled(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Param("id")
+
+	var req struct {
+		Disabled *bool `json:"disabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Disabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求体需要包含 disabled 字段"})
+		return
+	}
+
+	// 校验交易员是否属于当前用户
+	if _, _, _, err := s.database.GetTraderConfig(userID, traderID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
+		return
+	}
+
+	if err := s.database.UpdateTraderDisabled(userID, traderID, *req.Disabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("更新停用标记失败: %v", err)})
+		return
+	}
+	if *req.Disabled {
+		if err := s.database.UpdateTraderStatus(userID, traderID, false); err != nil {
+			log.Printf("⚠️  更新交易员状态失败: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), traderStopTimeout)
+	defer cancel()
+	if err := s.traderManager.SetTraderDisabled(ctx, s.database, userID, traderID, *req.Disabled); err != nil {
+		// 停用标记已持久化：停止超时的交易员不会再执行新的决策，解除停用时加载失败可稍后手动启动
+		log.Printf("⚠️  交易员 %s 停用状态已更新，但内存中的交易员未能同步: %v", traderID, err)
+	}
+
+	if *req.Disabled {
+		log.Printf("⛔ 交易员 %s 已紧急停用", traderID)
+		c.JSON(http.StatusOK, gin.H{"message": "交易员已紧急停用", "disabled": true})
+		return
+	}
+	log.Printf("✅ 交易员 %s 已解除紧急停用", traderID)
+	c.JSON(http.StatusOK, gin.H{"message": "交易员已解除停用", "disabled": false})
+}
+
+// handleFlattenTrader 一键平掉交易员的所有持仓并撤销挂单（不停止交易员）
+func (s *Server) handleFlattenTrader(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Param("id")
+
+	// 校验交易员是否属于当前用户
+	_, _, _, err := s.database.GetTraderConfig(userID, traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在"})
+		return
+	}
+
+	result, err := trader.FlattenAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("一键平仓失败: %v", err)})
+		return
+	}
+
+	log.Printf("🚨 交易员 %s 一键平仓完成: 平仓 %d 个, 失败 %d 项", trader.GetName(), len(result.Closed), len(result.Errors))
+	c.JSON(http.StatusOK, result)
+}
+
+// handleRebaselineTrader 以当前净值重置交易员的初始余额基准（竞赛重新计算收益）
+func (s *Server) handleRebaselineTrader(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Param("id")
+
+	// 校验交易员是否属于当前用户
+	_, _, _, err := s.database.GetTraderConfig(userID, traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在"})
+		return
+	}
+
+	baseline, err := trader.ReBaseline()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("重置初始余额基准失败: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "初始余额基准已重置", "initial_balance": baseline})
+}
+
+// handleTraderPromptPreview 预览交易员下一个周期发送给AI的 system/user prompt（拉取实时行情，不调用AI、不执行交易）
+func (s *Server) handleTraderPromptPreview(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Param("id")
+
+	// 校验交易员是否属于当前用户
+	_, _, _, err := s.database.GetTraderConfig(userID, traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在"})
+		return
+	}
+
+	systemPrompt, userPrompt, err := trader.PreviewPrompt()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("生成提示词预览失败: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trader_id":     traderID,
+		"system_prompt": systemPrompt,
+		"user_prompt":   userPrompt,
+	})
+}
+
+// handleProbeTraderAI 向交易员的AI模型发送一次真实的对话请求，检查模型能否正常响应（消耗 token，/healthz 只做免费探测）
+func (s *Server) handleProbeTraderAI(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Param("id")
+
+	// 校验交易员是否属于当前用户
+	_, _, _, err := s.database.GetTraderConfig(userID, traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在"})
+		return
+	}
+
+	status := gin.H{
+		"trader_id":  traderID,
+		"ai_model":   trader.GetAIModel(),
+		"ok":         true,
+		"ai_last_ok": nil,
+	}
+	lastOK, err := trader.ProbeAI()
+	if !lastOK.IsZero() {
+		status["ai_last_ok"] = lastOK.Format(time.RFC3339)
+	}
 	if err != nil {
-		log.Printf("⚠️ 重新加载交易员到内存失败: %v", err)
+		status["ok"] = false
+		status["error"] = err.Error()
 	}
-
-	log.Printf("✓ 更新交易员成功: %s (模型: %s, 交易所: %s)", req.Name, req.AIModelID, req.ExchangeID)
-
-	c.JSON(http.StatusOK, gin.H{
-		"trader_id":   traderID,
-		"trader_name": req.Name,
-		"ai_model":    req.AIModelID,
-		"message":     "交易员更新成功",
-	})
+	c.JSON(http.StatusOK, status)
 }
 
-// handleDeleteTrader 删除交易员
-func (s *Server) handleDeleteTrader(c *gin.Context) {
+// handleValidateDecision 用交易员配置解析并校验一段AI原始响应（请求体为原始文本），返回解析出的决策和校验结果，
+// 与实盘周期走同一套解析和校验代码，不调用AI、不拉取行情、不执行交易
+// 参数：account_equity 按该账户净值校验仓位上限（默认使用初始余额）
+func (s *Server) handleValidateDecision(c *gin.Context) {
 	userID := c.GetString("user_id")
 	traderID := c.Param("id")
 
-	// 从数据库删除
-	err := s.database.DeleteTrader(userID, traderID)
+	// 校验交易员是否属于当前用户
+	_, _, _, err := s.database.GetTraderConfig(userID, traderID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("删除交易员失败: %v", err)})
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
 		return
 	}
 
-	// 如果交易员正在运行，先停止它
-	if trader, err := s.traderManager.GetTrader(traderID); err == nil {
-		status := trader.GetStatus()
-		if isRunning, ok := status["is_running"].(bool); ok && isRunning {
-			trader.Stop()
-			log.Printf("⏹  已停止运行中的交易员: %s", traderID)
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在"})
+		return
+	}
+
+	bodyBytes, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
+		return
+	}
+	if strings.TrimSpace(string(bodyBytes)) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求体为空，请粘贴AI的原始响应"})
+		return
+	}
+
+	var accountEquity float64
+	if equityStr := c.Query("account_equity"); equityStr != "" {
+		accountEquity, err = strconv.ParseFloat(equityStr, 64)
+		if err != nil || accountEquity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "account_equity 必须为正数"})
+			return
 		}
 	}
 
-	log.Printf("✓ 交易员已删除: %s", traderID)
-	c.JSON(http.StatusOK, gin.H{"message": "交易员已删除"})
+	c.JSON(http.StatusOK, trader.ValidateDecisionResponse(string(bodyBytes), accountEquity))
 }
 
-// handleStartTrader 启动交易员
-func (s *Server) handleStartTrader(c *gin.Context) {
+// handleTraderDecisions 查询交易员的决策记录（从新到旧）
+// 参数：limit 条数（默认50，最大500）、since 起始时间（RFC3339 或毫秒时间戳）、symbol 只返回包含该币种动作的记录
+func (s *Server) handleTraderDecisions(c *gin.Context) {
 	userID := c.GetString("user_id")
 	traderID := c.Param("id")
 
 	// 校验交易员是否属于当前用户
-	traderRecord, _, _, err := s.database.GetTraderConfig(userID, traderID)
+	_, _, _, err := s.database.GetTraderConfig(userID, traderID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
 		return
 	}
 
-	// 获取模板名称
-	templateName := traderRecord.SystemPromptTemplate
-
 	trader, err := s.traderManager.GetTrader(traderID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在"})
 		return
 	}
 
-	// 检查交易员是否已经在运行
-	status := trader.GetStatus()
-	if isRunning, ok := status["is_running"].(bool); ok && isRunning {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "交易员已在运行中"})
-		return
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 || l > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 必须在 1-500 之间"})
+			return
+		}
+		limit = l
 	}
 
-	// 重新加载系统提示词模板（确保使用最新的硬盘文件）
-	s.reloadPromptTemplatesWithLog(templateName)
+	var since time.Time
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		since, err = parseTimeParam("since", sinceStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	// 启动交易员
-	go func() {
-		log.Printf("▶️  启动交易员 %s (%s)", traderID, trader.GetName())
-		if err := trader.Run(); err != nil {
-			log.Printf("❌ 交易员 %s 运行错误: %v", trader.GetName(), err)
+	symbol := strings.ToUpper(strings.TrimSpace(c.Query("symbol")))
+	readLimit := limit
+	if symbol != "" {
+		readLimit = 0 // 按币种过滤时需要读取 since 之后的全部记录再截取
+	}
+
+	records, err := trader.GetDecisionLogger().ReadRecords(readLimit, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取决策日志失败: %v", err)})
+		return
+	}
+
+	if symbol != "" {
+		filtered := make([]*logger.DecisionRecord, 0, limit)
+		for _, record := range records {
+			if len(filtered) >= limit {
+				break
+			}
+			if recordHasSymbol(record, symbol) {
+				filtered = append(filtered, record)
+			}
 		}
-	}()
+		records = filtered
+	}
 
-	// 更新数据库中的运行状态
-	err = s.database.UpdateTraderStatus(userID, traderID, true)
+	c.JSON(http.StatusOK, records)
+}
+
+// parseTimeParam 解析时间类 query 参数（name 用于错误提示）：RFC3339 时间、YYYY-MM-DD 日期（UTC 0点）或 Unix 毫秒时间戳
+func parseTimeParam(name, value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
-		log.Printf("⚠️  更新交易员状态失败: %v", err)
+		return time.Time{}, fmt.Errorf("%s 格式无效（需要 RFC3339、YYYY-MM-DD 或毫秒时间戳）: %s", name, value)
 	}
+	return time.UnixMilli(ms), nil
+}
 
-	log.Printf("✓ 交易员 %s 已启动", trader.GetName())
-	c.JSON(http.StatusOK, gin.H{"message": "交易员已启动"})
+// recordHasSymbol 决策记录中是否有该币种的动作（symbol 支持省略 USDT 后缀）
+func recordHasSymbol(record *logger.DecisionRecord, symbol string) bool {
+	for _, action := range record.Decisions {
+		if action.Symbol == symbol || action.Symbol == symbol+"USDT" {
+			return true
+		}
+	}
+	return false
 }
 
-// handleStopTrader 停止交易员
-func (s *Server) handleStopTrader(c *gin.Context) {
+// handleGetManualHolds 查询交易员的手动持仓标记
+func (s *Server) handleGetManualHolds(c *gin.Context) {
 	userID := c.GetString("user_id")
 	traderID := c.Param("id")
 
 	// 校验交易员是否属于当前用户
-	_, _, _, err := s.database.GetTraderConfig(userID, traderID)
-	if err != nil {
+	if _, _, _, err := s.database.GetTraderConfig(userID, traderID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
 		return
 	}
 
-	trader, err := s.traderManager.GetTrader(traderID)
+	holds, err := s.database.GetManualHolds(traderID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取手动持仓标记失败: %v", err)})
 		return
 	}
+	if holds == nil {
+		holds = []*config.ManualHold{}
+	}
+	c.JSON(http.StatusOK, gin.H{"trader_id": traderID, "manual_holds": holds})
+}
 
-	// 检查交易员是否正在运行
-	status := trader.GetStatus()
-	if isRunning, ok := status["is_running"].(bool); ok && !isRunning {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "交易员已停止"})
+// handleSetManualHold 标记币种为手动持仓：回撤监控、最长持仓平仓和自动开仓/加仓跳过该币种，
+// AI仍能在上下文中看到该持仓。持仓平仓后对账自动清除标记（标记时没有持仓的币种会在下一个周期被清除）
+func (s *Server) handleSetManualHold(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Param("id")
+	symbol := strings.ToUpper(strings.TrimSpace(c.Param("symbol")))
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !strings.HasSuffix(symbol, "USDT") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的币种格式: %s，必须以USDT结尾", symbol)})
 		return
 	}
 
-	// 停止交易员
-	trader.Stop()
+	if _, _, _, err := s.database.GetTraderConfig(userID, traderID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
+		return
+	}
 
-	// 更新数据库中的运行状态
-	err = s.database.UpdateTraderStatus(userID, traderID, false)
-	if err != nil {
-		log.Printf("⚠️  更新交易员状态失败: %v", err)
+	if err := s.database.SetManualHold(traderID, symbol, req.Note); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("保存手动持仓标记失败: %v", err)})
+		return
 	}
 
-	log.Printf("⏹  交易员 %s 已停止", trader.GetName())
-	c.JSON(http.StatusOK, gin.H{"message": "交易员已停止"})
+	// 如果trader在内存中，立即生效
+	if trader, err := s.traderManager.GetTrader(traderID); err == nil {
+		trader.SetManualHold(symbol, req.Note)
+	}
+	log.Printf("✋ 交易员 %s 的 %s 已标记为手动持仓: %s", traderID, symbol, req.Note)
+
+	c.JSON(http.StatusOK, gin.H{"message": "已标记为手动持仓", "symbol": symbol, "note": req.Note})
+}
+
+// handleDeleteManualHold 取消币种的手动持仓标记，恢复自动风控
+func (s *Server) handleDeleteManualHold(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Param("id")
+	symbol := strings.ToUpper(strings.TrimSpace(c.Param("symbol")))
+
+	if _, _, _, err := s.database.GetTraderConfig(userID, traderID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在或无访问权限"})
+		return
+	}
+
+	if err := s.database.DeleteManualHold(traderID, symbol); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("删除手动持仓标记失败: %v", err)})
+		return
+	}
+	if trader, err := s.traderManager.GetTrader(traderID); err == nil {
+		trader.ClearManualHold(symbol)
+	}
+	log.Printf("✓ 交易员 %s 的 %s 已取消手动持仓标记", traderID, symbol)
+
+	c.JSON(http.StatusOK, gin.H{"message": "已取消手动持仓标记", "symbol": symbol})
 }
 
 // handleUpdateTraderPrompt 更新交易员自定义Prompt
@@ -1246,22 +2302,56 @@ func (s *Server) handleGetTraderConfig(c *gin.Context) {
 	aiModelID := traderConfig.AIModelID
 
 	result := map[string]interface{}{
-		"trader_id":              traderConfig.ID,
-		"trader_name":            traderConfig.Name,
-		"ai_model":               aiModelID,
-		"exchange_id":            traderConfig.ExchangeID,
-		"initial_balance":        traderConfig.InitialBalance,
-		"scan_interval_minutes":  traderConfig.ScanIntervalMinutes,
-		"btc_eth_leverage":       traderConfig.BTCETHLeverage,
-		"altcoin_leverage":       traderConfig.AltcoinLeverage,
-		"trading_symbols":        traderConfig.TradingSymbols,
-		"custom_prompt":          traderConfig.CustomPrompt,
-		"override_base_prompt":   traderConfig.OverrideBasePrompt,
-		"system_prompt_template": traderConfig.SystemPromptTemplate,
-		"is_cross_margin":        traderConfig.IsCrossMargin,
-		"use_coin_pool":          traderConfig.UseCoinPool,
-		"use_oi_top":             traderConfig.UseOITop,
-		"is_running":             isRunning,
+		"trader_id":                  traderConfig.ID,
+		"trader_name":                traderConfig.Name,
+		"ai_model":                   aiModelID,
+		"exchange_id":                traderConfig.ExchangeID,
+		"initial_balance":            traderConfig.InitialBalance,
+		"scan_interval_minutes":      traderConfig.ScanIntervalMinutes,
+		"btc_eth_leverage":           traderConfig.BTCETHLeverage,
+		"altcoin_leverage":           traderConfig.AltcoinLeverage,
+		"trading_symbols":            traderConfig.TradingSymbols,
+		"custom_prompt":              traderConfig.CustomPrompt,
+		"override_base_prompt":       traderConfig.OverrideBasePrompt,
+		"system_prompt_template":     traderConfig.SystemPromptTemplate,
+		"is_cross_margin":            traderConfig.IsCrossMargin,
+		"hedge_mode":                 traderConfig.HedgeMode,
+		"auto_bump_min_notional":     traderConfig.AutoBumpMinNotional,
+		"post_stop_cooldown_minutes": traderConfig.PostStopCooldownMinutes,
+		"max_open_positions":         traderConfig.MaxOpenPositions,
+		"blacklist_symbols":          traderConfig.BlacklistSymbols,
+		"scan_jitter_percent":        traderConfig.ScanJitterPercent,
+		"fallback_ai_model_id":       traderConfig.FallbackAIModelID,
+		"max_correlated_exposure":    traderConfig.MaxCorrelatedExposure,
+		"default_stop_loss_pct":      traderConfig.DefaultStopLossPct,
+		"close_reason_tolerance_pct": traderConfig.CloseReasonTolerancePct,
+		"max_position_pct_of_equity": traderConfig.MaxPositionPctOfEquity,
+		"clamp_position_size":        traderConfig.ClampPositionSize,
+		"allow_high_vol_opens":       traderConfig.AllowHighVolOpens,
+		"rebaseline_schedule":        traderConfig.RebaselineSchedule,
+		"btc_eth_max_spread_bps":     traderConfig.BTCETHMaxSpreadBps,
+		"altcoin_max_spread_bps":     traderConfig.AltcoinMaxSpreadBps,
+		"shadow_ai_model_id":         traderConfig.ShadowAIModelID,
+		"skip_ai_without_trigger":    traderConfig.SkipAIWithoutTrigger,
+		"trigger_price_move_pct":     traderConfig.TriggerPriceMovePct,
+		"trigger_volume_spike":       traderConfig.TriggerVolumeSpike,
+		"consensus_opens":            traderConfig.ConsensusOpens,
+		"retry_empty_decision":       traderConfig.RetryEmptyDecision,
+		"timezone":                   traderConfig.Timezone,
+		"dust_threshold_usd":         traderConfig.DustThresholdUSD,
+		"always_context_symbols":     traderConfig.AlwaysContextSymbols,
+		"max_hold_minutes":           traderConfig.MaxHoldMinutes,
+		"order_timeout_seconds":      traderConfig.OrderTimeoutSeconds,
+		"repeat_decision_limit":      traderConfig.RepeatDecisionLimit,
+		"repeat_backoff_minutes":     traderConfig.RepeatBackoffMinutes,
+		"ai_temperature":             samplingParamValue(traderConfig.AITemperature),
+		"ai_top_p":                   samplingParamValue(traderConfig.AITopP),
+		"strategy_tag":               traderConfig.StrategyTag,
+		"leverage_tiers":             decodeLeverageTiers(traderConfig.LeverageTiers),
+		"margin_modes":               decodeMarginModes(traderConfig.MarginModes),
+		"use_coin_pool":              traderConfig.UseCoinPool,
+		"use_oi_top":                 traderConfig.UseOITop,
+		"is_running":                 isRunning,
 	}
 
 	c.JSON(http.StatusOK, result)
@@ -1285,6 +2375,37 @@ func (s *Server) handleStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, status)
 }
 
+// handleTokenUsage 当前用户所有交易员的AI token用量（含汇总）
+func (s *Server) handleTokenUsage(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traders, err := s.database.GetTraders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取交易员列表失败: %v", err)})
+		return
+	}
+
+	if len(traders) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"traders": []interface{}{},
+			"total":   mcp.Usage{},
+		})
+		return
+	}
+
+	traderIDs := make([]string, 0, len(traders))
+	for _, trader := range traders {
+		traderIDs = append(traderIDs, trader.ID)
+	}
+
+	c.JSON(http.StatusOK, s.traderManager.GetTokenUsage(traderIDs...))
+}
+
+// handleUserSummary 当前用户所有交易员的汇总（总净值、合计盈亏、按币种汇总的持仓）
+func (s *Server) handleUserSummary(c *gin.Context) {
+	userID := c.GetString("user_id")
+	c.JSON(http.StatusOK, s.traderManager.GetUserSummary(userID))
+}
+
 // handleAccount 账户信息
 func (s *Server) handleAccount(c *gin.Context) {
 	_, traderID, err := s.getTraderFromQuery(c)
@@ -1443,15 +2564,7 @@ func (s *Server) handleCompetition(c *gin.Context) {
 		log.Printf("⚠️ 加载用户 %s 的交易员失败: %v", userID, err)
 	}
 
-	competition, err := s.traderManager.GetCompetitionData()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("获取竞赛数据失败: %v", err),
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, competition)
+	s.respondCompetitionPage(c)
 }
 
 // handleEquityHistory 收益率历史数据
@@ -1568,7 +2681,9 @@ func (s *Server) handlePerformance(c *gin.Context) {
 
 	// 分析最近100个周期的交易表现（避免长期持仓的交易记录丢失）
 	// 假设每3分钟一个周期，100个周期 = 5小时，足够覆盖大部分交易
-	performance, err := trader.GetDecisionLogger().AnalyzePerformance(100)
+	// strategy_tag 只统计开仓时使用该策略标签（prompt版本）的交易
+	filter := logger.PerformanceFilter{StrategyTag: c.Query("strategy_tag")}
+	performance, err := trader.GetDecisionLogger().AnalyzePerformance(100, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("分析历史表现失败: %v", err),
@@ -1584,6 +2699,139 @@ func (s *Server) handlePerformance(c *gin.Context) {
 	c.JSON(http.StatusOK, performance)
 }
 
+// handlePerformanceRange 指定时间范围内平仓的交易表现：from 必填，to 可选（默认到现在），
+// 支持 RFC3339、YYYY-MM-DD（UTC）或毫秒时间戳；strategy_tag 只统计开仓时使用该策略标签的交易
+func (s *Server) handlePerformanceRange(c *gin.Context) {
+	_, traderID, err := s.getTraderFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	fromStr := c.Query("from")
+	if fromStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 from 参数"})
+		return
+	}
+	from, err := parseTimeParam("from", fromStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var to time.Time
+	if toStr := c.Query("to"); toStr != "" {
+		if to, err = parseTimeParam("to", toStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if to.Before(from) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 不能早于 from"})
+			return
+		}
+	}
+
+	filter := logger.PerformanceFilter{StrategyTag: c.Query("strategy_tag")}
+	performance, err := trader.GetDecisionLogger().AnalyzePerformanceRange(from, to, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("分析历史表现失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, performance)
+}
+
+// handleExportTradesCSV 以CSV文件下载指定时间范围内平仓的交易（每笔交易一行），from/to 格式同 handlePerformanceRange，
+// from 省略时为最近7天，to 省略时到现在
+func (s *Server) handleExportTradesCSV(c *gin.Context) {
+	_, traderID, err := s.getTraderFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	from := time.Now().Add(-7 * 24 * time.Hour)
+	if fromStr := c.Query("from"); fromStr != "" {
+		if from, err = parseTimeParam("from", fromStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var to time.Time
+	if toStr := c.Query("to"); toStr != "" {
+		if to, err = parseTimeParam("to", toStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if to.Before(from) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 不能早于 from"})
+			return
+		}
+	}
+
+	filename := fmt.Sprintf("trades_%s_%s.csv", traderID, from.UTC().Format("20060102"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if err := trader.GetDecisionLogger().ExportCSV(c.Writer, from, to); err != nil {
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("导出交易记录失败: %v", err)})
+			return
+		}
+		log.Printf("⚠️ 导出交易记录中断 (trader=%s): %v", traderID, err)
+	}
+}
+
+// handleReconcilePnL 将日志推算的已平仓盈亏与交易所资金流水（已实现盈亏、手续费、资金费）核对，
+// 交易所流水为真实盈亏，差值超过容差（tolerance，USDT）的币种会被标记
+func (s *Server) handleReconcilePnL(c *gin.Context) {
+	_, traderID, err := s.getTraderFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 核对区间：最近 hours 小时（默认24，最多90天）
+	hours := 24
+	if hoursStr := c.Query("hours"); hoursStr != "" {
+		if h, err := strconv.Atoi(hoursStr); err == nil && h > 0 && h <= 90*24 {
+			hours = h
+		}
+	}
+	tolerance := logger.DefaultReconcileTolerance
+	if tolStr := c.Query("tolerance"); tolStr != "" {
+		if t, err := strconv.ParseFloat(tolStr, 64); err == nil && t > 0 {
+			tolerance = t
+		}
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	result, err := trader.ReconcilePnL(since, tolerance)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("核对盈亏失败: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 // authMiddleware JWT认证中间件
 func (s *Server) authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -2006,8 +3254,10 @@ func (s *Server) Start() error {
 	log.Printf("🌐 API服务器启动在 http://localhost%s", addr)
 	log.Printf("📊 API文档:")
 	log.Printf("  • GET  /api/health           - 健康检查")
+	log.Printf("  • GET  /healthz              - 就绪检查（WebSocket行情，附带各交易员AI连通性）")
+	log.Printf("  • GET  /metrics              - Prometheus 指标")
 	log.Printf("  • GET  /api/traders          - 公开的AI交易员排行榜前50名（无需认证）")
-	log.Printf("  • GET  /api/competition      - 公开的竞赛数据（无需认证）")
+	log.Printf("  • GET  /api/competition      - 公开的竞赛数据（无需认证，支持 sort_by/offset/limit 分页）")
 	log.Printf("  • GET  /api/top-traders      - 前5名交易员数据（无需认证，表现对比用）")
 	log.Printf("  • GET  /api/equity-history?trader_id=xxx - 公开的收益率历史数据（无需认证，竞赛用）")
 	log.Printf("  • GET  /api/equity-history-batch?trader_ids=a,b,c - 批量获取历史数据（无需认证，表现对比优化）")
@@ -2016,6 +3266,14 @@ func (s *Server) Start() error {
 	log.Printf("  • DELETE /api/traders/:id    - 删除AI交易员")
 	log.Printf("  • POST /api/traders/:id/start - 启动AI交易员")
 	log.Printf("  • POST /api/traders/:id/stop  - 停止AI交易员")
+	log.Printf("  • PUT  /api/traders/:id/disabled - 紧急停用/解除停用交易员（持久化，重启和重载后仍然有效）")
+	log.Printf("  • POST /api/traders/:id/flatten - 一键平掉所有持仓并撤销挂单")
+	log.Printf("  • POST /api/traders/:id/rebaseline - 以当前净值重置初始余额基准（总盈亏从0开始）")
+	log.Printf("  • GET  /api/traders/:id/decisions?limit=N&since=ts&symbol=X - 查询交易员决策记录（从新到旧）")
+	log.Printf("  • GET  /api/traders/:id/prompt-preview - 预览按当前行情发送给AI的完整提示词（不调用AI）")
+	log.Printf("  • POST /api/traders/:id/ai-probe - 发送一次真实的AI请求检查模型能否响应（消耗 token）")
+	log.Printf("  • POST /api/traders/:id/validate-decision - 解析并校验一段AI原始响应（不执行）")
+	log.Printf("  • GET/PUT/DELETE /api/traders/:id/manual-holds[/:symbol] - 手动持仓标记（自动风控跳过该币种）")
 	log.Printf("  • GET  /api/models           - 获取AI模型配置")
 	log.Printf("  • PUT  /api/models           - 更新AI模型配置")
 	log.Printf("  • GET  /api/exchanges        - 获取交易所配置")
@@ -2026,7 +3284,10 @@ func (s *Server) Start() error {
 	log.Printf("  • GET  /api/decisions?trader_id=xxx  - 指定trader的决策日志")
 	log.Printf("  • GET  /api/decisions/latest?trader_id=xxx - 指定trader的最新决策")
 	log.Printf("  • GET  /api/statistics?trader_id=xxx - 指定trader的统计信息")
-	log.Printf("  • GET  /api/performance?trader_id=xxx - 指定trader的AI学习表现分析")
+	log.Printf("  • GET  /api/performance?trader_id=xxx&strategy_tag=v2 - 指定trader的AI学习表现分析（可按策略标签筛选）")
+	log.Printf("  • GET  /api/performance/reconcile?trader_id=xxx&hours=24 - 推算盈亏与交易所流水核对")
+	log.Printf("  • GET  /api/performance/range?trader_id=xxx&from=2025-01-01&to=2025-01-08 - 指定时间范围内平仓的交易表现")
+	log.Printf("  • GET  /api/performance/export?trader_id=xxx&from=2025-01-01&to=2025-01-08 - 导出指定时间范围内平仓的交易（CSV）")
 	log.Println()
 
 	// 创建 http.Server 以支持 graceful shutdown
@@ -2134,9 +3395,16 @@ func (s *Server) handlePublicTraderList(c *gin.Context) {
 
 // handlePublicCompetition 获取公开的竞赛数据（无需认证）
 func (s *Server) handlePublicCompetition(c *gin.Context) {
-	competition, err := s.traderManager.GetCompetitionData()
+	s.respondCompetitionPage(c)
+}
+
+// respondCompetitionPage 按查询参数 sort_by / offset / limit 返回排行榜的一页（默认按收益率前50名）
+func (s *Server) respondCompetitionPage(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	competition, err := s.traderManager.GetCompetitionPage(c.Query("sort_by"), offset, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": fmt.Sprintf("获取竞赛数据失败: %v", err),
 		})
 		return
@@ -438,3 +438,49 @@ func parseLimit(limitStr string) int {
 	}
 	return 0
 }
+
+// TestEncodeLeverageTiers 测试杠杆分级校验与编码：币种统一大写，default 保留，非法币种/杠杆拒绝
+func TestEncodeLeverageTiers(t *testing.T) {
+	encoded, err := encodeLeverageTiers(map[string]int{"btcusdt": 10, "SOLUSDT": 5, "Default": 3})
+	if err != nil {
+		t.Fatalf("encodeLeverageTiers 失败: %v", err)
+	}
+	tiers := decodeLeverageTiers(encoded)
+	if tiers["BTCUSDT"] != 10 || tiers["SOLUSDT"] != 5 || tiers["default"] != 3 || len(tiers) != 3 {
+		t.Errorf("编码结果错误: %s", encoded)
+	}
+
+	if encoded, err := encodeLeverageTiers(map[string]int{}); err != nil || encoded != "" {
+		t.Errorf("空分级应编码为空字符串: %q, %v", encoded, err)
+	}
+	if _, err := encodeLeverageTiers(map[string]int{"BTC": 10}); err == nil {
+		t.Error("不以USDT结尾的币种应返回错误")
+	}
+	if _, err := encodeLeverageTiers(map[string]int{"BTCUSDT": 0}); err == nil {
+		t.Error("杠杆为0应返回错误")
+	}
+	if tiers := decodeLeverageTiers(""); len(tiers) != 0 {
+		t.Errorf("未配置时应返回空分级: %v", tiers)
+	}
+}
+
+func TestEncodeMarginModes(t *testing.T) {
+	encoded, err := encodeMarginModes(map[string]string{"btcusdt": "Cross", " PEPEUSDT ": "isolated"})
+	if err != nil {
+		t.Fatalf("encodeMarginModes 失败: %v", err)
+	}
+	modes := decodeMarginModes(encoded)
+	if modes["BTCUSDT"] != "cross" || modes["PEPEUSDT"] != "isolated" || len(modes) != 2 {
+		t.Errorf("编码结果错误: %s", encoded)
+	}
+
+	if encoded, err := encodeMarginModes(nil); err != nil || encoded != "" {
+		t.Errorf("空配置应编码为空字符串: %q, %v", encoded, err)
+	}
+	if _, err := encodeMarginModes(map[string]string{"BTC": "cross"}); err == nil {
+		t.Error("不以USDT结尾的币种应返回错误")
+	}
+	if _, err := encodeMarginModes(map[string]string{"BTCUSDT": "portfolio"}); err == nil {
+		t.Error("无效的仓位模式应返回错误")
+	}
+}
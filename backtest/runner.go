@@ -0,0 +1,585 @@
+package backtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"nofx/decision"
+	"nofx/logger"
+	"nofx/market"
+	"nofx/mcp"
+	"nofx/trader"
+	"sort"
+	"time"
+)
+
+const (
+	// klineLookback 每个周期传给指标计算的K线数量（与实时 WSMonitor 缓存长度一致）
+	klineLookback = 100
+
+	interval3m = 3 * time.Minute
+	interval4h = 4 * time.Hour
+)
+
+// Config 回测配置
+type Config struct {
+	Symbol               string
+	StartTime            time.Time
+	EndTime              time.Time
+	AIClient             mcp.AIClient
+	SystemPromptTemplate string // 系统提示词模板名称
+	CustomPrompt         string
+	OverrideBasePrompt   bool
+
+	InitialBalance   float64 // 初始资金（默认1000 USDT）
+	DecisionInterval int     // 每隔多少根3分钟K线决策一次（默认1，即每根K线）
+	BTCETHLeverage   int     // 默认5
+	AltcoinLeverage  int     // 默认5
+	SlippageBps      float64 // 模拟市价成交滑点（基点，向不利方向，默认0）
+}
+
+// KlineFetcher 按时间范围拉取K线（毫秒时间戳）
+type KlineFetcher func(symbol, interval string, startTime, endTime int64) ([]market.Kline, error)
+
+// Runner 回测执行器：逐根K线回放历史行情，用与实盘相同的决策逻辑在模拟账户上执行
+type Runner struct {
+	config Config
+	fetch  KlineFetcher
+
+	klines3m []market.Kline
+	klines4h []market.Kline
+
+	trader         *trader.PaperTrader
+	price          float64          // 当前K线收盘价（模拟成交价）
+	openTimes      map[string]int64 // symbol_side -> 开仓时间（毫秒）
+	records        []*logger.DecisionRecord
+	pendingActions []logger.DecisionAction // 止盈止损成交，写入下一条决策记录
+}
+
+// NewRunner 创建回测执行器（默认通过币安接口拉取历史K线）
+func NewRunner(config Config) *Runner {
+	if config.InitialBalance <= 0 {
+		config.InitialBalance = 1000
+	}
+	if config.DecisionInterval <= 0 {
+		config.DecisionInterval = 1
+	}
+	if config.BTCETHLeverage <= 0 {
+		config.BTCETHLeverage = 5
+	}
+	if config.AltcoinLeverage <= 0 {
+		config.AltcoinLeverage = 5
+	}
+	config.Symbol = market.Normalize(config.Symbol)
+
+	return &Runner{
+		config: config,
+		fetch:  market.NewAPIClient().GetKlinesRange,
+	}
+}
+
+// SetKlineFetcher 替换K线来源（测试或本地数据使用）
+func (r *Runner) SetKlineFetcher(fetch KlineFetcher) {
+	r.fetch = fetch
+}
+
+// Records 回测过程中生成的决策记录（按时间正序）
+func (r *Runner) Records() []*logger.DecisionRecord {
+	return r.records
+}
+
+// Run 执行回测，返回与决策日志相同结构的表现分析
+func (r *Runner) Run() (*logger.PerformanceAnalysis, error) {
+	symbol := r.config.Symbol
+	start := r.config.StartTime.UnixMilli()
+	end := r.config.EndTime.UnixMilli()
+	if end <= start {
+		return nil, fmt.Errorf("回测结束时间必须晚于开始时间")
+	}
+	if r.config.AIClient == nil {
+		return nil, fmt.Errorf("未配置AI客户端")
+	}
+
+	// 向前多取一段K线用于指标预热
+	var err error
+	r.klines3m, err = r.fetch(symbol, "3m", start-int64(klineLookback*interval3m/time.Millisecond), end)
+	if err != nil {
+		return nil, fmt.Errorf("获取3分钟K线失败: %w", err)
+	}
+	r.klines4h, err = r.fetch(symbol, "4h", start-int64(klineLookback*interval4h/time.Millisecond), end)
+	if err != nil {
+		return nil, fmt.Errorf("获取4小时K线失败: %w", err)
+	}
+
+	first := sort.Search(len(r.klines3m), func(i int) bool { return r.klines3m[i].OpenTime >= start })
+	if first == len(r.klines3m) {
+		return nil, fmt.Errorf("%s 在回测区间内没有K线数据", symbol)
+	}
+
+	r.trader = trader.NewPaperTrader(r.config.InitialBalance, func(string) (float64, error) {
+		return r.price, nil
+	})
+	r.trader.SetSlippageModel(trader.BpsSlippage(r.config.SlippageBps))
+	r.openTimes = make(map[string]int64)
+	r.records = nil
+	r.pendingActions = nil
+
+	log.Printf("📼 开始回测 %s: %s ~ %s", symbol,
+		r.config.StartTime.Format("2006-01-02 15:04"), r.config.EndTime.Format("2006-01-02 15:04"))
+
+	last := first
+	for i := first; i < len(r.klines3m) && r.klines3m[i].CloseTime <= end; i++ {
+		bar := r.klines3m[i]
+		last = i
+
+		// 先用本根K线的高低点撮合之前挂出的止盈止损单，再以收盘价做决策
+		r.collectFills(symbol, bar)
+		r.price = bar.Close
+
+		if (i-first)%r.config.DecisionInterval != 0 {
+			continue
+		}
+		if err := r.runCycle(i); err != nil {
+			log.Printf("⚠️  回测周期失败 (%s): %v", time.UnixMilli(bar.CloseTime).Format("2006-01-02 15:04"), err)
+		}
+	}
+
+	// 回测结束时按最后收盘价平掉剩余持仓，保证所有交易都计入统计
+	r.closeAll(symbol, r.klines3m[last])
+
+	log.Printf("📼 回测结束 %s: 共 %d 个决策周期", symbol, len(r.records))
+	return logger.AnalyzeRecords(r.records, nil), nil
+}
+
+// window3m 第 i 根K线（含）之前的3分钟K线
+func (r *Runner) window3m(i int) []market.Kline {
+	from := i + 1 - klineLookback
+	if from < 0 {
+		from = 0
+	}
+	return r.klines3m[from : i+1]
+}
+
+// window4h 在 now 时刻已经收盘的4小时K线（未收盘的K线包含未来价格，不能使用）
+func (r *Runner) window4h(now int64) []market.Kline {
+	n := sort.Search(len(r.klines4h), func(i int) bool { return r.klines4h[i].CloseTime > now })
+	from := n - klineLookback
+	if from < 0 {
+		from = 0
+	}
+	return r.klines4h[from:n]
+}
+
+// runCycle 在第 i 根K线收盘时执行一次决策
+func (r *Runner) runCycle(i int) error {
+	symbol := r.config.Symbol
+	bar := r.klines3m[i]
+	now := time.UnixMilli(bar.CloseTime)
+
+	record := &logger.DecisionRecord{
+		Timestamp:      now,
+		CycleNumber:    len(r.records) + 1,
+		Exchange:       "backtest",
+		CandidateCoins: []string{symbol},
+		Decisions:      r.takePendingActions(),
+	}
+	defer func() { r.records = append(r.records, record) }()
+
+	data, err := market.BuildData(symbol, r.window3m(i), r.window4h(bar.CloseTime))
+	if err != nil {
+		record.ErrorMessage = err.Error()
+		return err
+	}
+
+	ctx, err := r.buildContext(now, len(r.records)+1, data)
+	if err != nil {
+		record.ErrorMessage = err.Error()
+		return err
+	}
+
+	record.AccountState = logger.AccountSnapshot{
+		TotalBalance:          ctx.Account.TotalEquity - ctx.Account.UnrealizedPnL,
+		AvailableBalance:      ctx.Account.AvailableBalance,
+		TotalUnrealizedProfit: ctx.Account.UnrealizedPnL,
+		PositionCount:         ctx.Account.PositionCount,
+		MarginUsedPct:         ctx.Account.MarginUsedPct,
+		InitialBalance:        r.config.InitialBalance,
+	}
+	for _, pos := range ctx.Positions {
+		record.Positions = append(record.Positions, logger.PositionSnapshot{
+			Symbol:           pos.Symbol,
+			Side:             pos.Side,
+			PositionAmt:      pos.Quantity,
+			EntryPrice:       pos.EntryPrice,
+			MarkPrice:        pos.MarkPrice,
+			UnrealizedProfit: pos.UnrealizedPnL,
+			Leverage:         float64(pos.Leverage),
+			LiquidationPrice: pos.LiquidationPrice,
+		})
+	}
+
+	fullDecision, err := decision.GetFullDecisionFromMarketData(ctx, r.config.AIClient,
+		r.config.CustomPrompt, r.config.OverrideBasePrompt, r.config.SystemPromptTemplate)
+	if fullDecision != nil {
+		record.SystemPrompt = fullDecision.SystemPrompt
+		record.InputPrompt = fullDecision.UserPrompt
+		record.CoTTrace = fullDecision.CoTTrace
+		record.PromptTokens = fullDecision.TokenUsage.PromptTokens
+		record.CompletionTokens = fullDecision.TokenUsage.CompletionTokens
+		record.TotalTokens = fullDecision.TokenUsage.TotalTokens
+		if len(fullDecision.Decisions) > 0 {
+			decisionJSON, _ := json.MarshalIndent(fullDecision.Decisions, "", "  ")
+			record.DecisionJSON = string(decisionJSON)
+		}
+	}
+	if err != nil {
+		record.ErrorMessage = fmt.Sprintf("获取AI决策失败: %v", err)
+		return err
+	}
+
+	// 先平仓后开仓（与实盘执行顺序一致）
+	decisions := append([]decision.Decision(nil), fullDecision.Decisions...)
+	sort.SliceStable(decisions, func(a, b int) bool {
+		return !isOpenAction(decisions[a].Action) && isOpenAction(decisions[b].Action)
+	})
+
+	for _, d := range decisions {
+		actionRecord := logger.DecisionAction{
+			Action:    d.Action,
+			Symbol:    d.Symbol,
+			Leverage:  d.Leverage,
+			Timestamp: now,
+		}
+
+		if err := r.execute(&d, &actionRecord, now); err != nil {
+			actionRecord.Error = err.Error()
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 失败: %v", d.Symbol, d.Action, err))
+		} else {
+			actionRecord.Success = true
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 成功", d.Symbol, d.Action))
+		}
+		record.Decisions = append(record.Decisions, actionRecord)
+	}
+
+	record.Success = true
+	return nil
+}
+
+// buildContext 根据模拟账户和历史行情构建决策上下文
+func (r *Runner) buildContext(now time.Time, callCount int, data *market.Data) (*decision.Context, error) {
+	balance, err := r.trader.GetBalance()
+	if err != nil {
+		return nil, err
+	}
+	positions, err := r.trader.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, _ := balance["totalWalletBalance"].(float64)
+	available, _ := balance["availableBalance"].(float64)
+	unrealized, _ := balance["totalUnrealizedProfit"].(float64)
+	totalEquity := wallet + unrealized
+
+	var positionInfos []decision.PositionInfo
+	totalMarginUsed := 0.0
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		entryPrice, _ := pos["entryPrice"].(float64)
+		markPrice, _ := pos["markPrice"].(float64)
+		quantity := math.Abs(pos["positionAmt"].(float64))
+		pnl, _ := pos["unRealizedProfit"].(float64)
+		liquidationPrice, _ := pos["liquidationPrice"].(float64)
+		leverage := int(pos["leverage"].(float64))
+
+		marginUsed := quantity * entryPrice / float64(leverage)
+		totalMarginUsed += marginUsed
+		pnlPct := 0.0
+		if marginUsed > 0 {
+			pnlPct = pnl / marginUsed * 100
+		}
+
+		// 提示词按 time.Now() 计算持仓时长，这里换算成等效的时间戳
+		updateTime := int64(0)
+		if openTime, ok := r.openTimes[symbol+"_"+side]; ok {
+			updateTime = time.Now().UnixMilli() - (now.UnixMilli() - openTime)
+		}
+
+		positionInfos = append(positionInfos, decision.PositionInfo{
+			Symbol:           symbol,
+			Side:             side,
+			EntryPrice:       entryPrice,
+			MarkPrice:        markPrice,
+			Quantity:         quantity,
+			Leverage:         leverage,
+			UnrealizedPnL:    pnl,
+			UnrealizedPnLPct: pnlPct,
+			LiquidationPrice: liquidationPrice,
+			MarginUsed:       marginUsed,
+			UpdateTime:       updateTime,
+		})
+	}
+
+	totalPnL := totalEquity - r.config.InitialBalance
+	marginUsedPct := 0.0
+	if totalEquity > 0 {
+		marginUsedPct = totalMarginUsed / totalEquity * 100
+	}
+
+	return &decision.Context{
+		CurrentTime:     now.Format("2006-01-02 15:04:05"),
+		RuntimeMinutes:  int(now.Sub(r.config.StartTime).Minutes()),
+		CallCount:       callCount,
+		BTCETHLeverage:  r.config.BTCETHLeverage,
+		AltcoinLeverage: r.config.AltcoinLeverage,
+		Account: decision.AccountInfo{
+			TotalEquity:      totalEquity,
+			AvailableBalance: available,
+			UnrealizedPnL:    unrealized,
+			TotalPnL:         totalPnL,
+			TotalPnLPct:      totalPnL / r.config.InitialBalance * 100,
+			MarginUsed:       totalMarginUsed,
+			MarginUsedPct:    marginUsedPct,
+			PositionCount:    len(positionInfos),
+		},
+		Positions:      positionInfos,
+		CandidateCoins: []decision.CandidateCoin{{Symbol: data.Symbol, Sources: []string{"backtest"}}},
+		MarketDataMap:  map[string]*market.Data{data.Symbol: data},
+		OITopDataMap:   map[string]*decision.OITopData{},
+		Performance:    logger.AnalyzeRecords(r.lastRecords(100), r.records),
+	}, nil
+}
+
+// execute 在模拟账户上执行单个决策
+func (r *Runner) execute(d *decision.Decision, actionRecord *logger.DecisionAction, now time.Time) error {
+	if d.Action == "hold" || d.Action == "wait" {
+		return nil
+	}
+	if d.Symbol != r.config.Symbol {
+		return fmt.Errorf("回测仅包含 %s 的行情数据", r.config.Symbol)
+	}
+
+	actionRecord.Price = r.price
+	switch d.Action {
+	case "open_long", "open_short":
+		return r.executeOpen(d, actionRecord, now)
+	case "close_long":
+		return r.executeClose(d.Symbol, "long", 0, actionRecord)
+	case "close_short":
+		return r.executeClose(d.Symbol, "short", 0, actionRecord)
+	case "partial_close":
+		return r.executePartialClose(d, actionRecord)
+	case "update_stop_loss":
+		return r.updateStopOrder(d.Symbol, d.NewStopLoss, true)
+	case "update_take_profit":
+		return r.updateStopOrder(d.Symbol, d.NewTakeProfit, false)
+	default:
+		return fmt.Errorf("未知的action: %s", d.Action)
+	}
+}
+
+func (r *Runner) executeOpen(d *decision.Decision, actionRecord *logger.DecisionAction, now time.Time) error {
+	side, positionSide := "long", trader.PositionSideLong
+	if d.Action == "open_short" {
+		side, positionSide = "short", trader.PositionSideShort
+	}
+	if _, ok := r.findPosition(d.Symbol, side); ok {
+		return fmt.Errorf("%s 已有%s仓，拒绝重复开仓", d.Symbol, side)
+	}
+
+	quantity := d.PositionSizeUSD / r.price
+	actionRecord.Quantity = quantity
+
+	var order map[string]interface{}
+	var err error
+	if side == "long" {
+		order, err = r.trader.OpenLong(d.Symbol, positionSide, quantity, d.Leverage)
+	} else {
+		order, err = r.trader.OpenShort(d.Symbol, positionSide, quantity, d.Leverage)
+	}
+	if err != nil {
+		return err
+	}
+	recordFillPrice(order, actionRecord)
+	r.openTimes[d.Symbol+"_"+side] = now.UnixMilli()
+
+	if err := r.trader.SetStopLoss(d.Symbol, positionSide, quantity, d.StopLoss); err != nil {
+		return err
+	}
+
+	// 分批止盈：按当前价格校验阶梯，无效时退回单一止盈
+	if len(d.TakeProfitLadder) > 0 &&
+		decision.ValidateTakeProfitLadder(d.TakeProfitLadder, side == "long", r.price) == nil {
+		for _, level := range d.TakeProfitLadder {
+			if err := r.trader.SetTakeProfit(d.Symbol, positionSide, quantity*level.Percent/100, level.Price); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return r.trader.SetTakeProfit(d.Symbol, positionSide, quantity, d.TakeProfit)
+}
+
+func (r *Runner) executeClose(symbol, side string, quantity float64, actionRecord *logger.DecisionAction) error {
+	pos, ok := r.findPosition(symbol, side)
+	if !ok {
+		return fmt.Errorf("没有 %s 的%s仓", symbol, side)
+	}
+	if quantity <= 0 {
+		quantity = pos
+	}
+	actionRecord.Quantity = quantity
+
+	var order map[string]interface{}
+	var err error
+	if side == "long" {
+		order, err = r.trader.CloseLong(symbol, trader.PositionSideLong, quantity)
+	} else {
+		order, err = r.trader.CloseShort(symbol, trader.PositionSideShort, quantity)
+	}
+	if err != nil {
+		return err
+	}
+	recordFillPrice(order, actionRecord)
+	if quantity >= pos {
+		delete(r.openTimes, symbol+"_"+side)
+	}
+	return nil
+}
+
+// recordFillPrice 用模拟成交价（含滑点）替换记录中的K线收盘价
+func recordFillPrice(order map[string]interface{}, actionRecord *logger.DecisionAction) {
+	if price, ok := order["avgPrice"].(float64); ok && price > 0 {
+		actionRecord.Price = price
+	}
+}
+
+func (r *Runner) executePartialClose(d *decision.Decision, actionRecord *logger.DecisionAction) error {
+	if d.CloseQuantity < 0 {
+		return fmt.Errorf("平仓数量必须大于0: %.8f", d.CloseQuantity)
+	}
+	if d.CloseQuantity == 0 && (d.ClosePercentage <= 0 || d.ClosePercentage > 100) {
+		return fmt.Errorf("平仓百分比必须在0-100之间: %.1f", d.ClosePercentage)
+	}
+	for _, side := range []string{"long", "short"} {
+		if pos, ok := r.findPosition(d.Symbol, side); ok {
+			quantity := pos * d.ClosePercentage / 100
+			if d.CloseQuantity > 0 {
+				quantity = math.Min(d.CloseQuantity, pos)
+			}
+			return r.executeClose(d.Symbol, side, quantity, actionRecord)
+		}
+	}
+	return fmt.Errorf("没有 %s 的持仓", d.Symbol)
+}
+
+func (r *Runner) updateStopOrder(symbol string, price float64, isStopLoss bool) error {
+	for _, side := range []string{"long", "short"} {
+		quantity, ok := r.findPosition(symbol, side)
+		if !ok {
+			continue
+		}
+		positionSide := trader.PositionSideLong
+		if side == "short" {
+			positionSide = trader.PositionSideShort
+		}
+		if isStopLoss {
+			r.trader.CancelStopLossOrders(symbol)
+			return r.trader.SetStopLoss(symbol, positionSide, quantity, price)
+		}
+		r.trader.CancelTakeProfitOrders(symbol)
+		return r.trader.SetTakeProfit(symbol, positionSide, quantity, price)
+	}
+	return fmt.Errorf("没有 %s 的持仓", symbol)
+}
+
+// findPosition 返回指定方向的持仓数量
+func (r *Runner) findPosition(symbol, side string) (float64, bool) {
+	positions, err := r.trader.GetPositions()
+	if err != nil {
+		return 0, false
+	}
+	for _, pos := range positions {
+		if pos["symbol"] == symbol && pos["side"] == side {
+			return math.Abs(pos["positionAmt"].(float64)), true
+		}
+	}
+	return 0, false
+}
+
+// collectFills 撮合止盈止损单，成交记为被动平仓动作
+func (r *Runner) collectFills(symbol string, bar market.Kline) {
+	for _, fill := range r.trader.CheckTriggers(symbol, bar.High, bar.Low) {
+		action := "partial_close"
+		if fill.Closed {
+			action = "auto_close_" + fill.Side
+			delete(r.openTimes, fill.Symbol+"_"+fill.Side)
+		}
+		r.pendingActions = append(r.pendingActions, logger.DecisionAction{
+			Action:    action,
+			Symbol:    fill.Symbol,
+			Quantity:  fill.Quantity,
+			Price:     fill.Price,
+			Timestamp: time.UnixMilli(bar.CloseTime),
+			Success:   true,
+		})
+	}
+}
+
+// closeAll 回测结束时平掉剩余持仓
+func (r *Runner) closeAll(symbol string, bar market.Kline) {
+	r.price = bar.Close
+	now := time.UnixMilli(bar.CloseTime)
+	actions := r.takePendingActions()
+	for _, side := range []string{"long", "short"} {
+		action := logger.DecisionAction{Action: "close_" + side, Symbol: symbol, Price: r.price, Timestamp: now}
+		if err := r.executeClose(symbol, side, 0, &action); err != nil {
+			continue
+		}
+		action.Success = true
+		actions = append(actions, action)
+	}
+	if len(actions) == 0 {
+		return
+	}
+
+	record := &logger.DecisionRecord{
+		Timestamp:      now,
+		CycleNumber:    len(r.records) + 1,
+		Exchange:       "backtest",
+		CandidateCoins: []string{symbol},
+		Decisions:      actions,
+		ExecutionLog:   []string{"📼 回测结束，按收盘价平掉剩余持仓"},
+		Success:        true,
+	}
+	if balance, err := r.trader.GetBalance(); err == nil {
+		wallet, _ := balance["totalWalletBalance"].(float64)
+		available, _ := balance["availableBalance"].(float64)
+		record.AccountState = logger.AccountSnapshot{
+			TotalBalance:     wallet,
+			AvailableBalance: available,
+			InitialBalance:   r.config.InitialBalance,
+		}
+	}
+	r.records = append(r.records, record)
+}
+
+func (r *Runner) takePendingActions() []logger.DecisionAction {
+	actions := r.pendingActions
+	r.pendingActions = nil
+	return actions
+}
+
+// lastRecords 最近 n 条决策记录
+func (r *Runner) lastRecords(n int) []*logger.DecisionRecord {
+	if len(r.records) <= n {
+		return r.records
+	}
+	return r.records[len(r.records)-n:]
+}
+
+func isOpenAction(action string) bool {
+	return action == "open_long" || action == "open_short"
+}
@@ -0,0 +1,139 @@
+package backtest
+
+import (
+	"fmt"
+	"nofx/market"
+	"nofx/mcp"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeAIClient 按调用次数返回预设响应
+type fakeAIClient struct {
+	mcp.AIClient
+	respond func(call int) string
+	calls   int
+}
+
+func (c *fakeAIClient) CallWithMessagesUsage(systemPrompt, userPrompt string) (string, mcp.Usage, error) {
+	c.calls++
+	return c.respond(c.calls), mcp.Usage{}, nil
+}
+
+// testStart 回测开始时间，该时刻开盘的3分钟K线收盘价为 1000
+var testStart = time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)
+
+// syntheticFetcher 生成逐根上涨1的K线，成交量设为收盘时间（秒），用于在 prompt 中识别数据所属时间
+func syntheticFetcher(symbol, interval string, startTime, endTime int64) ([]market.Kline, error) {
+	step := interval3m
+	if interval == "4h" {
+		step = interval4h
+	}
+	stepMs := step.Milliseconds()
+
+	var klines []market.Kline
+	for openTime := startTime - startTime%stepMs; openTime <= endTime; openTime += stepMs {
+		closeTime := openTime + stepMs - 1
+		price := 1000 + float64(openTime-testStart.UnixMilli())/float64(interval3m.Milliseconds())
+		klines = append(klines, market.Kline{
+			OpenTime:  openTime,
+			Open:      price - 1,
+			High:      price + 0.5,
+			Low:       price - 1.5,
+			Close:     price,
+			Volume:    float64(closeTime / 1000),
+			CloseTime: closeTime,
+		})
+	}
+	return klines, nil
+}
+
+func waitResponse(int) string {
+	return "观望\n<decision>\n```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"test\"}]\n```\n</decision>"
+}
+
+var (
+	reCurrentPrice = regexp.MustCompile(`current_price = ([0-9.]+)`)
+	reVolumes      = regexp.MustCompile(`(?:Volume: \[|Current Volume: )([0-9., ]+)`)
+)
+
+func TestRunner_NoLookAhead(t *testing.T) {
+	start := testStart
+	runner := NewRunner(Config{
+		Symbol:           "BTCUSDT",
+		StartTime:        start,
+		EndTime:          start.Add(2 * time.Hour),
+		AIClient:         &fakeAIClient{respond: waitResponse},
+		DecisionInterval: 5,
+	})
+	runner.SetKlineFetcher(syntheticFetcher)
+
+	if _, err := runner.Run(); err != nil {
+		t.Fatalf("Run 失败: %v", err)
+	}
+
+	records := runner.Records()
+	if len(records) == 0 {
+		t.Fatal("应生成决策记录")
+	}
+
+	for _, record := range records {
+		if record.InputPrompt == "" {
+			t.Fatalf("周期 #%d 缺少 prompt: %s", record.CycleNumber, record.ErrorMessage)
+		}
+		nowSec := record.Timestamp.Unix()
+
+		// 当前价格必须是决策时刻这根K线的收盘价
+		m := reCurrentPrice.FindStringSubmatch(record.InputPrompt)
+		if m == nil {
+			t.Fatalf("周期 #%d prompt 缺少 current_price", record.CycleNumber)
+		}
+		bars := float64(record.Timestamp.UnixMilli()+1-start.UnixMilli())/float64(interval3m.Milliseconds()) - 1
+		if price, _ := strconv.ParseFloat(m[1], 64); price != 1000+bars {
+			t.Errorf("周期 #%d current_price = %v, want %v", record.CycleNumber, price, 1000+bars)
+		}
+
+		// 3分钟和4小时数据中的成交量即K线收盘时间，不能晚于决策时刻
+		for _, match := range reVolumes.FindAllStringSubmatch(record.InputPrompt, -1) {
+			for _, field := range regexp.MustCompile(`[0-9.]+`).FindAllString(match[1], -1) {
+				closeSec, _ := strconv.ParseFloat(field, 64)
+				if int64(closeSec) > nowSec {
+					t.Errorf("周期 #%d 使用了未来K线: close=%d now=%d", record.CycleNumber, int64(closeSec), nowSec)
+				}
+			}
+		}
+	}
+}
+
+func TestRunner_TakeProfitFilledOnBarHigh(t *testing.T) {
+	start := testStart
+	ai := &fakeAIClient{respond: func(call int) string {
+		if call > 1 {
+			return waitResponse(call)
+		}
+		// 第一根K线收盘价为 1000，止盈 1005 在之后的K线最高价触及
+		return fmt.Sprintf("开多\n<decision>\n```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"open_long\", \"leverage\": 5, \"position_size_usd\": 500, \"stop_loss\": %v, \"take_profit\": %v, \"reasoning\": \"test\"}]\n```\n</decision>", 950.0, 1005.0)
+	}}
+	runner := NewRunner(Config{
+		Symbol:    "BTCUSDT",
+		StartTime: start,
+		EndTime:   start.Add(time.Hour),
+		AIClient:  ai,
+	})
+	runner.SetKlineFetcher(syntheticFetcher)
+
+	analysis, err := runner.Run()
+	if err != nil {
+		t.Fatalf("Run 失败: %v", err)
+	}
+
+	if analysis.TotalTrades != 1 || analysis.WinningTrades != 1 {
+		t.Fatalf("TotalTrades=%d WinningTrades=%d, want 1/1", analysis.TotalTrades, analysis.WinningTrades)
+	}
+	trade := analysis.RecentTrades[0]
+	if trade.OpenPrice != 1000 || trade.ClosePrice != 1005 {
+		t.Errorf("open=%v close=%v, want 1000/1005", trade.OpenPrice, trade.ClosePrice)
+	}
+}
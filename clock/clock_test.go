@@ -0,0 +1,79 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFakeAdvance 测试模拟时钟推进时间和 Since
+func TestFakeAdvance(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+
+	c.Advance(90 * time.Second)
+	if got := c.Now(); !got.Equal(start.Add(90 * time.Second)) {
+		t.Errorf("Now = %v, want %v", got, start.Add(90*time.Second))
+	}
+	if got := c.Since(start); got != 90*time.Second {
+		t.Errorf("Since = %v, want 90s", got)
+	}
+
+	// 不能回拨
+	c.Set(start)
+	if got := c.Since(start); got != 90*time.Second {
+		t.Errorf("Set 回拨后 Since = %v, want 90s", got)
+	}
+	c.Set(start.Add(time.Hour))
+	if got := c.Since(start); got != time.Hour {
+		t.Errorf("Set 后 Since = %v, want 1h", got)
+	}
+}
+
+// TestFakeTicker 测试模拟定时器在推进到期时触发、未消费的触发被丢弃、停止后不再触发
+func TestFakeTicker(t *testing.T) {
+	c := NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	ticker := c.NewTicker(time.Minute)
+
+	c.Advance(30 * time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("未到期不应触发")
+	default:
+	}
+
+	c.Advance(30 * time.Second)
+	select {
+	case <-ticker.C():
+	default:
+		t.Fatal("到期应触发")
+	}
+
+	// 一次跨越多个周期只触发一次
+	c.Advance(5 * time.Minute)
+	c.Advance(time.Minute)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Fatal("未消费的触发应被丢弃")
+	default:
+	}
+
+	ticker.Stop()
+	c.Advance(time.Hour)
+	select {
+	case <-ticker.C():
+		t.Fatal("停止后不应触发")
+	default:
+	}
+}
+
+// TestOr 测试零值回退到系统时钟
+func TestOr(t *testing.T) {
+	if Or(nil) != Real {
+		t.Error("nil 应回退到 Real")
+	}
+	fake := NewFake(time.Now())
+	if Or(fake) != Clock(fake) {
+		t.Error("非 nil 应原样返回")
+	}
+}
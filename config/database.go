@@ -39,6 +39,9 @@ type DatabaseInterface interface {
 	UpdateTraderCustomPrompt(userID, id string, customPrompt string, overrideBase bool) error
 	DeleteTrader(userID, id string) error
 	GetTraderConfig(userID, traderID string) (*TraderRecord, *AIModelConfig, *ExchangeConfig, error)
+	SetManualHold(traderID, symbol, note string) error
+	DeleteManualHold(traderID, symbol string) error
+	GetManualHolds(traderID string) ([]*ManualHold, error)
 	GetSystemConfig(key string) (string, error)
 	SetSystemConfig(key, value string) error
 	CreateUserSignalSource(userID, coinPoolURL, oiTopURL string) error
@@ -194,6 +197,46 @@ func (d *Database) createTables() error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		// 手动持仓标记表（标记后回撤监控、最长持仓等自动风控动作跳过该币种）
+		`CREATE TABLE IF NOT EXISTS trader_manual_holds (
+			trader_id TEXT NOT NULL,
+			symbol TEXT NOT NULL,
+			note TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (trader_id, symbol),
+			FOREIGN KEY (trader_id) REFERENCES traders(id) ON DELETE CASCADE
+		)`,
+
+		// 决策记录表（决策日志写入数据库时使用，整条记录以JSON保存）
+		`CREATE TABLE IF NOT EXISTS decision_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			trader_id TEXT NOT NULL,
+			cycle_number INTEGER NOT NULL,
+			timestamp_ms INTEGER NOT NULL,
+			success BOOLEAN NOT NULL,
+			record_json TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_decision_records_trader ON decision_records (user_id, trader_id, timestamp_ms)`,
+
+		// 决策动作表（每条决策记录中执行的动作，便于跨交易员按币种/动作查询）
+		`CREATE TABLE IF NOT EXISTS decision_actions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			record_id INTEGER NOT NULL,
+			user_id TEXT NOT NULL,
+			trader_id TEXT NOT NULL,
+			timestamp_ms INTEGER NOT NULL,
+			symbol TEXT NOT NULL,
+			action TEXT NOT NULL,
+			quantity REAL DEFAULT 0,
+			price REAL DEFAULT 0,
+			order_id INTEGER DEFAULT 0,
+			success BOOLEAN NOT NULL,
+			error TEXT DEFAULT '',
+			FOREIGN KEY (record_id) REFERENCES decision_records(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_decision_actions_trader ON decision_actions (user_id, trader_id, symbol)`,
+
 		// 触发器：自动更新 updated_at
 		`CREATE TRIGGER IF NOT EXISTS update_users_updated_at
 			AFTER UPDATE ON users
@@ -255,6 +298,40 @@ func (d *Database) createTables() error {
 		`ALTER TABLE traders ADD COLUMN use_coin_pool BOOLEAN DEFAULT 0`,               // 是否使用COIN POOL信号源
 		`ALTER TABLE traders ADD COLUMN use_oi_top BOOLEAN DEFAULT 0`,                  // 是否使用OI TOP信号源
 		`ALTER TABLE traders ADD COLUMN system_prompt_template TEXT DEFAULT 'default'`, // 系统提示词模板名称
+		`ALTER TABLE traders ADD COLUMN auto_bump_min_notional BOOLEAN DEFAULT 0`,      // 下单金额低于交易所最小名义价值时是否自动上调数量
+		`ALTER TABLE traders ADD COLUMN post_stop_cooldown_minutes INTEGER DEFAULT 0`,  // 止损平仓后同币种禁止开仓的冷却时长（分钟，0=不限制）
+		`ALTER TABLE traders ADD COLUMN max_open_positions INTEGER DEFAULT 0`,          // 最大同时持仓数（0=不限制）
+		`ALTER TABLE traders ADD COLUMN blacklist_symbols TEXT DEFAULT ''`,             // 禁止开仓的币种（逗号分隔，平仓不受影响）
+		`ALTER TABLE traders ADD COLUMN scan_jitter_percent INTEGER DEFAULT 10`,        // 扫描间隔随机抖动百分比（±N%，0表示关闭）
+		`ALTER TABLE traders ADD COLUMN fallback_ai_model_id TEXT DEFAULT ''`,          // 备用AI模型ID（主模型调用失败时使用，为空表示不启用）
+		`ALTER TABLE traders ADD COLUMN max_correlated_exposure REAL DEFAULT 0`,        // 相关性调整后的总敞口上限（净值倍数，0表示不限制）
+		`ALTER TABLE traders ADD COLUMN leverage_tiers TEXT DEFAULT ''`,                // 杠杆分级（JSON: 币种->杠杆倍数，default 为其余币种），为空时使用BTC/ETH与山寨币两档
+		`ALTER TABLE traders ADD COLUMN default_stop_loss_pct REAL DEFAULT 0`,          // 开仓未给出有效止损时按入场价该百分比设置保护性止损（0=不设置）
+		`ALTER TABLE traders ADD COLUMN max_hold_minutes INTEGER DEFAULT 0`,            // 最长持仓时间（分钟），超过后自动平仓，0表示不限制
+		`ALTER TABLE traders ADD COLUMN margin_modes TEXT DEFAULT ''`,                  // 按币种覆盖仓位模式（JSON: 币种->cross/isolated），未覆盖的币种使用 is_cross_margin
+		`ALTER TABLE traders ADD COLUMN order_timeout_seconds INTEGER DEFAULT 10`,      // 单笔下单超时（秒），超时后按客户端订单ID撤单（0=默认10秒）
+		`ALTER TABLE traders ADD COLUMN repeat_decision_limit INTEGER DEFAULT 0`,       // 同一币种连续多少个周期决策完全相同时暂停该币种（0=不检测）
+		`ALTER TABLE traders ADD COLUMN repeat_backoff_minutes INTEGER DEFAULT 15`,     // 连续重复决策后暂停该币种的时长（分钟）
+		`ALTER TABLE traders ADD COLUMN ai_temperature REAL DEFAULT -1`,                // AI采样温度（负数表示使用默认值 0.5）
+		`ALTER TABLE traders ADD COLUMN ai_top_p REAL DEFAULT -1`,                      // AI top_p（负数表示不发送）
+		`ALTER TABLE traders ADD COLUMN strategy_tag TEXT DEFAULT ''`,                  // 策略标签（如prompt版本），为空时按模板和prompt自动生成
+		`ALTER TABLE traders ADD COLUMN close_reason_tolerance_pct REAL DEFAULT 0`,     // 被动平仓原因推断的价格容差（百分比，0=默认1%）
+		`ALTER TABLE traders ADD COLUMN max_position_pct_of_equity REAL DEFAULT 0`,     // 单币种开仓保证金占净值的上限（百分比，0=不限制）
+		`ALTER TABLE traders ADD COLUMN clamp_position_size BOOLEAN DEFAULT 0`,         // 超过单币种仓位上限时：true=缩减到上限, false=拒绝开仓
+		`ALTER TABLE traders ADD COLUMN allow_high_vol_opens BOOLEAN DEFAULT 0`,        // BTC 4小时处于极端波动时是否仍允许开新仓（默认不允许）
+		`ALTER TABLE traders ADD COLUMN rebaseline_schedule TEXT DEFAULT ''`,           // 初始余额基准定时重置周期（daily/weekly，空=不自动重置）
+		`ALTER TABLE traders ADD COLUMN btc_eth_max_spread_bps REAL DEFAULT 0`,         // BTC/ETH 开仓点差上限（基点，0=不检查）
+		`ALTER TABLE traders ADD COLUMN altcoin_max_spread_bps REAL DEFAULT 0`,         // 山寨币开仓点差上限（基点，0=不检查）
+		`ALTER TABLE traders ADD COLUMN shadow_ai_model_id TEXT DEFAULT ''`,            // 影子AI模型ID（只记录决策不执行，用于对比模型表现，为空表示不启用）
+		`ALTER TABLE traders ADD COLUMN skip_ai_without_trigger BOOLEAN DEFAULT 0`,     // 无持仓且候选币种无触发条件时跳过AI调用（默认不跳过）
+		`ALTER TABLE traders ADD COLUMN trigger_price_move_pct REAL DEFAULT 0`,         // 触发AI调用的1小时涨跌幅阈值（%，0=默认1%）
+		`ALTER TABLE traders ADD COLUMN trigger_volume_spike REAL DEFAULT 0`,           // 触发AI调用的成交量放大倍数（最新3分钟量/此前均量，0=默认3倍）
+		`ALTER TABLE traders ADD COLUMN consensus_opens BOOLEAN DEFAULT 0`,             // 开仓需两次AI调用方向一致才执行（默认不启用）
+		`ALTER TABLE traders ADD COLUMN disabled BOOLEAN DEFAULT 0`,                    // 紧急停用（合规锁定）：停用的交易员不加载、不启动、不执行，重启和热重载后仍然有效
+		`ALTER TABLE traders ADD COLUMN retry_empty_decision BOOLEAN DEFAULT 0`,        // 有持仓且AI返回空决策时重新请求一次（默认不启用）
+		`ALTER TABLE traders ADD COLUMN timezone TEXT DEFAULT ''`,                      // 日界时区（IANA名称，如 Asia/Shanghai；空=UTC）
+		`ALTER TABLE traders ADD COLUMN dust_threshold_usd REAL DEFAULT 0`,             // 零头持仓阈值（名义价值USDT，0=使用交易所该币种的最小名义价值）
+		`ALTER TABLE traders ADD COLUMN always_context_symbols TEXT DEFAULT ''`,        // 始终提供行情的参考币种（逗号分隔，仅作上下文，不在候选中时不可开仓）
 		`ALTER TABLE ai_models ADD COLUMN custom_api_url TEXT DEFAULT ''`,              // 自定义API地址
 		`ALTER TABLE ai_models ADD COLUMN custom_model_name TEXT DEFAULT ''`,           // 自定义模型名称
 	}
@@ -264,6 +341,13 @@ func (d *Database) createTables() error {
 		d.db.Exec(query)
 	}
 
+	// 升级前币安适配器固定把账户切换为双向持仓：首次新增 hedge_mode 字段时，已有的币安交易员保留双向持仓
+	if _, err := d.db.Exec(`ALTER TABLE traders ADD COLUMN hedge_mode BOOLEAN DEFAULT 0`); err == nil {
+		if _, err := d.db.Exec(`UPDATE traders SET hedge_mode = 1 WHERE exchange_id = 'binance'`); err != nil {
+			log.Printf("⚠️ 迁移币安交易员持仓模式失败: %v", err)
+		}
+	}
+
 	// 检查是否需要迁移exchanges表的主键结构
 	err := d.migrateExchangesTable()
 	if err != nil {
@@ -300,6 +384,7 @@ func (d *Database) initDefaultData() error {
 		{"binance", "Binance Futures", "binance"},
 		{"hyperliquid", "Hyperliquid", "hyperliquid"},
 		{"aster", "Aster DEX", "aster"},
+		{"bybit", "Bybit Futures", "bybit"},
 	}
 
 	for _, exchange := range exchanges {
@@ -470,25 +555,60 @@ type ExchangeConfig struct {
 
 // TraderRecord 交易员配置（数据库实体）
 type TraderRecord struct {
-	ID                   string    `json:"id"`
-	UserID               string    `json:"user_id"`
-	Name                 string    `json:"name"`
-	AIModelID            string    `json:"ai_model_id"`
-	ExchangeID           string    `json:"exchange_id"`
-	InitialBalance       float64   `json:"initial_balance"`
-	ScanIntervalMinutes  int       `json:"scan_interval_minutes"`
-	IsRunning            bool      `json:"is_running"`
-	BTCETHLeverage       int       `json:"btc_eth_leverage"`       // BTC/ETH杠杆倍数
-	AltcoinLeverage      int       `json:"altcoin_leverage"`       // 山寨币杠杆倍数
-	TradingSymbols       string    `json:"trading_symbols"`        // 交易币种，逗号分隔
-	UseCoinPool          bool      `json:"use_coin_pool"`          // 是否使用COIN POOL信号源
-	UseOITop             bool      `json:"use_oi_top"`             // 是否使用OI TOP信号源
-	CustomPrompt         string    `json:"custom_prompt"`          // 自定义交易策略prompt
-	OverrideBasePrompt   bool      `json:"override_base_prompt"`   // 是否覆盖基础prompt
-	SystemPromptTemplate string    `json:"system_prompt_template"` // 系统提示词模板名称
-	IsCrossMargin        bool      `json:"is_cross_margin"`        // 是否为全仓模式（true=全仓，false=逐仓）
-	CreatedAt            time.Time `json:"created_at"`
-	UpdatedAt            time.Time `json:"updated_at"`
+	ID                      string    `json:"id"`
+	UserID                  string    `json:"user_id"`
+	Name                    string    `json:"name"`
+	AIModelID               string    `json:"ai_model_id"`
+	ExchangeID              string    `json:"exchange_id"`
+	InitialBalance          float64   `json:"initial_balance"`
+	ScanIntervalMinutes     int       `json:"scan_interval_minutes"`
+	IsRunning               bool      `json:"is_running"`
+	BTCETHLeverage          int       `json:"btc_eth_leverage"`           // BTC/ETH杠杆倍数
+	AltcoinLeverage         int       `json:"altcoin_leverage"`           // 山寨币杠杆倍数
+	TradingSymbols          string    `json:"trading_symbols"`            // 交易币种，逗号分隔
+	UseCoinPool             bool      `json:"use_coin_pool"`              // 是否使用COIN POOL信号源
+	UseOITop                bool      `json:"use_oi_top"`                 // 是否使用OI TOP信号源
+	CustomPrompt            string    `json:"custom_prompt"`              // 自定义交易策略prompt
+	OverrideBasePrompt      bool      `json:"override_base_prompt"`       // 是否覆盖基础prompt
+	SystemPromptTemplate    string    `json:"system_prompt_template"`     // 系统提示词模板名称
+	IsCrossMargin           bool      `json:"is_cross_margin"`            // 是否为全仓模式（true=全仓，false=逐仓）
+	HedgeMode               bool      `json:"hedge_mode"`                 // 是否启用双向持仓（允许同币种多空并存）
+	AutoBumpMinNotional     bool      `json:"auto_bump_min_notional"`     // 下单金额低于交易所最小名义价值时是否自动上调数量
+	PostStopCooldownMinutes int       `json:"post_stop_cooldown_minutes"` // 止损平仓后同币种禁止开仓的冷却时长（分钟，0=不限制）
+	MaxOpenPositions        int       `json:"max_open_positions"`         // 最大同时持仓数（0=不限制）
+	BlacklistSymbols        string    `json:"blacklist_symbols"`          // 禁止开仓的币种（逗号分隔，平仓不受影响）
+	ScanJitterPercent       int       `json:"scan_jitter_percent"`        // 扫描间隔随机抖动百分比（±N%，0表示关闭）
+	FallbackAIModelID       string    `json:"fallback_ai_model_id"`       // 备用AI模型ID（主模型调用失败时使用，为空表示不启用）
+	MaxCorrelatedExposure   float64   `json:"max_correlated_exposure"`    // 相关性调整后的总敞口上限（净值倍数，0表示不限制）
+	LeverageTiers           string    `json:"leverage_tiers"`             // 杠杆分级（JSON: 币种->杠杆倍数，default 为其余币种），为空时使用BTC/ETH与山寨币两档
+	DefaultStopLossPct      float64   `json:"default_stop_loss_pct"`      // 开仓未给出有效止损时按入场价该百分比设置保护性止损（0=不设置）
+	MaxHoldMinutes          int       `json:"max_hold_minutes"`           // 最长持仓时间（分钟），超过后自动平仓，0表示不限制
+	MarginModes             string    `json:"margin_modes"`               // 按币种覆盖仓位模式（JSON: 币种->cross/isolated），未覆盖的币种使用 is_cross_margin
+	OrderTimeoutSeconds     int       `json:"order_timeout_seconds"`      // 单笔下单超时（秒），超时后按客户端订单ID撤单（0=默认10秒）
+	RepeatDecisionLimit     int       `json:"repeat_decision_limit"`      // 同一币种连续多少个周期决策完全相同时暂停该币种（0=不检测）
+	RepeatBackoffMinutes    int       `json:"repeat_backoff_minutes"`     // 连续重复决策后暂停该币种的时长（分钟）
+	AITemperature           float64   `json:"ai_temperature"`             // AI采样温度（负数表示使用默认值 0.5）
+	AITopP                  float64   `json:"ai_top_p"`                   // AI top_p（负数表示不发送）
+	StrategyTag             string    `json:"strategy_tag"`               // 策略标签（如prompt版本），为空时按模板和prompt自动生成
+	CloseReasonTolerancePct float64   `json:"close_reason_tolerance_pct"` // 被动平仓原因推断的价格容差（百分比，0=默认1%）
+	MaxPositionPctOfEquity  float64   `json:"max_position_pct_of_equity"` // 单币种开仓保证金占净值的上限（百分比，0=不限制）
+	ClampPositionSize       bool      `json:"clamp_position_size"`        // 超过单币种仓位上限时：true=缩减到上限, false=拒绝开仓
+	AllowHighVolOpens       bool      `json:"allow_high_vol_opens"`       // BTC 4小时处于极端波动时是否仍允许开新仓（默认不允许）
+	RebaselineSchedule      string    `json:"rebaseline_schedule"`        // 初始余额基准定时重置周期（daily/weekly，空=不自动重置）
+	BTCETHMaxSpreadBps      float64   `json:"btc_eth_max_spread_bps"`     // BTC/ETH 开仓点差上限（基点，0=不检查）
+	AltcoinMaxSpreadBps     float64   `json:"altcoin_max_spread_bps"`     // 山寨币开仓点差上限（基点，0=不检查）
+	ShadowAIModelID         string    `json:"shadow_ai_model_id"`         // 影子AI模型ID（只记录决策不执行，用于对比模型表现，为空表示不启用）
+	SkipAIWithoutTrigger    bool      `json:"skip_ai_without_trigger"`    // 无持仓且候选币种无触发条件时跳过AI调用（默认不跳过）
+	TriggerPriceMovePct     float64   `json:"trigger_price_move_pct"`     // 触发AI调用的1小时涨跌幅阈值（%，0=默认1%）
+	TriggerVolumeSpike      float64   `json:"trigger_volume_spike"`       // 触发AI调用的成交量放大倍数（最新3分钟量/此前均量，0=默认3倍）
+	ConsensusOpens          bool      `json:"consensus_opens"`            // 开仓需两次AI调用方向一致才执行（默认不启用）
+	Disabled                bool      `json:"disabled"`                   // 紧急停用（合规锁定）：停用的交易员不加载、不启动、不执行，重启和热重载后仍然有效
+	RetryEmptyDecision      bool      `json:"retry_empty_decision"`       // 有持仓且AI返回空决策时重新请求一次（默认不启用）
+	Timezone                string    `json:"timezone"`                   // 日界时区（IANA名称，如 Asia/Shanghai；空=UTC）
+	DustThresholdUSD        float64   `json:"dust_threshold_usd"`         // 零头持仓阈值（名义价值USDT，0=使用交易所该币种的最小名义价值）
+	AlwaysContextSymbols    string    `json:"always_context_symbols"`     // 始终提供行情的参考币种（逗号分隔，仅作上下文，不在候选中时不可开仓）
+	CreatedAt               time.Time `json:"created_at"`
+	UpdatedAt               time.Time `json:"updated_at"`
 }
 
 // UserSignalSource 用户信号源配置
@@ -849,6 +969,9 @@ func (d *Database) UpdateExchange(userID, id string, enabled bool, apiKey, secre
 		} else if id == "aster" {
 			name = "Aster DEX"
 			typ = "dex"
+		} else if id == "bybit" {
+			name = "Bybit Futures"
+			typ = "cex"
 		} else {
 			name = id + " Exchange"
 			typ = "cex"
@@ -901,9 +1024,9 @@ func (d *Database) CreateExchange(userID, id, name, typ string, enabled bool, ap
 // CreateTrader 创建交易员
 func (d *Database) CreateTrader(trader *TraderRecord) error {
 	_, err := d.db.Exec(`
-		INSERT INTO traders (id, user_id, name, ai_model_id, exchange_id, initial_balance, scan_interval_minutes, is_running, btc_eth_leverage, altcoin_leverage, trading_symbols, use_coin_pool, use_oi_top, custom_prompt, override_base_prompt, system_prompt_template, is_cross_margin)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, trader.ID, trader.UserID, trader.Name, trader.AIModelID, trader.ExchangeID, trader.InitialBalance, trader.ScanIntervalMinutes, trader.IsRunning, trader.BTCETHLeverage, trader.AltcoinLeverage, trader.TradingSymbols, trader.UseCoinPool, trader.UseOITop, trader.CustomPrompt, trader.OverrideBasePrompt, trader.SystemPromptTemplate, trader.IsCrossMargin)
+		INSERT INTO traders (id, user_id, name, ai_model_id, exchange_id, initial_balance, scan_interval_minutes, is_running, btc_eth_leverage, altcoin_leverage, trading_symbols, use_coin_pool, use_oi_top, custom_prompt, override_base_prompt, system_prompt_template, is_cross_margin, hedge_mode, auto_bump_min_notional, post_stop_cooldown_minutes, max_open_positions, blacklist_symbols, scan_jitter_percent, fallback_ai_model_id, max_correlated_exposure, leverage_tiers, default_stop_loss_pct, max_hold_minutes, margin_modes, order_timeout_seconds, repeat_decision_limit, repeat_backoff_minutes, ai_temperature, ai_top_p, strategy_tag, close_reason_tolerance_pct, max_position_pct_of_equity, clamp_position_size, allow_high_vol_opens, rebaseline_schedule, btc_eth_max_spread_bps, altcoin_max_spread_bps, shadow_ai_model_id, skip_ai_without_trigger, trigger_price_move_pct, trigger_volume_spike, consensus_opens, disabled, retry_empty_decision, timezone, dust_threshold_usd, always_context_symbols)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, trader.ID, trader.UserID, trader.Name, trader.AIModelID, trader.ExchangeID, trader.InitialBalance, trader.ScanIntervalMinutes, trader.IsRunning, trader.BTCETHLeverage, trader.AltcoinLeverage, trader.TradingSymbols, trader.UseCoinPool, trader.UseOITop, trader.CustomPrompt, trader.OverrideBasePrompt, trader.SystemPromptTemplate, trader.IsCrossMargin, trader.HedgeMode, trader.AutoBumpMinNotional, trader.PostStopCooldownMinutes, trader.MaxOpenPositions, trader.BlacklistSymbols, trader.ScanJitterPercent, trader.FallbackAIModelID, trader.MaxCorrelatedExposure, trader.LeverageTiers, trader.DefaultStopLossPct, trader.MaxHoldMinutes, trader.MarginModes, trader.OrderTimeoutSeconds, trader.RepeatDecisionLimit, trader.RepeatBackoffMinutes, trader.AITemperature, trader.AITopP, trader.StrategyTag, trader.CloseReasonTolerancePct, trader.MaxPositionPctOfEquity, trader.ClampPositionSize, trader.AllowHighVolOpens, trader.RebaselineSchedule, trader.BTCETHMaxSpreadBps, trader.AltcoinMaxSpreadBps, trader.ShadowAIModelID, trader.SkipAIWithoutTrigger, trader.TriggerPriceMovePct, trader.TriggerVolumeSpike, trader.ConsensusOpens, trader.Disabled, trader.RetryEmptyDecision, trader.Timezone, trader.DustThresholdUSD, trader.AlwaysContextSymbols)
 	return err
 }
 
@@ -916,7 +1039,42 @@ func (d *Database) GetTraders(userID string) ([]*TraderRecord, error) {
 		       COALESCE(use_coin_pool, 0) as use_coin_pool, COALESCE(use_oi_top, 0) as use_oi_top,
 		       COALESCE(custom_prompt, '') as custom_prompt, COALESCE(override_base_prompt, 0) as override_base_prompt,
 		       COALESCE(system_prompt_template, 'default') as system_prompt_template,
-		       COALESCE(is_cross_margin, 1) as is_cross_margin, created_at, updated_at
+		       COALESCE(is_cross_margin, 1) as is_cross_margin,
+		       COALESCE(hedge_mode, 0) as hedge_mode,
+		       COALESCE(auto_bump_min_notional, 0) as auto_bump_min_notional,
+		       COALESCE(post_stop_cooldown_minutes, 0) as post_stop_cooldown_minutes,
+		       COALESCE(max_open_positions, 0) as max_open_positions,
+		       COALESCE(blacklist_symbols, '') as blacklist_symbols,
+		       COALESCE(scan_jitter_percent, 10) as scan_jitter_percent,
+		       COALESCE(fallback_ai_model_id, '') as fallback_ai_model_id,
+		       COALESCE(max_correlated_exposure, 0) as max_correlated_exposure,
+		       COALESCE(leverage_tiers, '') as leverage_tiers,
+		       COALESCE(default_stop_loss_pct, 0) as default_stop_loss_pct,
+		       COALESCE(max_hold_minutes, 0) as max_hold_minutes,
+		       COALESCE(margin_modes, '') as margin_modes,
+		       COALESCE(order_timeout_seconds, 10) as order_timeout_seconds,
+		       COALESCE(repeat_decision_limit, 0) as repeat_decision_limit,
+		       COALESCE(repeat_backoff_minutes, 15) as repeat_backoff_minutes,
+		       COALESCE(ai_temperature, -1) as ai_temperature,
+		       COALESCE(ai_top_p, -1) as ai_top_p,
+		       COALESCE(strategy_tag, '') as strategy_tag,
+		       COALESCE(close_reason_tolerance_pct, 0) as close_reason_tolerance_pct,
+		       COALESCE(max_position_pct_of_equity, 0) as max_position_pct_of_equity,
+		       COALESCE(clamp_position_size, 0) as clamp_position_size,
+		       COALESCE(allow_high_vol_opens, 0) as allow_high_vol_opens,
+		       COALESCE(rebaseline_schedule, '') as rebaseline_schedule,
+		       COALESCE(btc_eth_max_spread_bps, 0) as btc_eth_max_spread_bps,
+		       COALESCE(altcoin_max_spread_bps, 0) as altcoin_max_spread_bps,
+		       COALESCE(shadow_ai_model_id, '') as shadow_ai_model_id,
+		       COALESCE(skip_ai_without_trigger, 0) as skip_ai_without_trigger,
+		       COALESCE(trigger_price_move_pct, 0) as trigger_price_move_pct,
+		       COALESCE(trigger_volume_spike, 0) as trigger_volume_spike,
+		       COALESCE(consensus_opens, 0) as consensus_opens,
+		       COALESCE(disabled, 0) as disabled,
+		       COALESCE(retry_empty_decision, 0) as retry_empty_decision,
+		       COALESCE(timezone, '') as timezone,
+		       COALESCE(dust_threshold_usd, 0) as dust_threshold_usd,
+		       COALESCE(always_context_symbols, '') as always_context_symbols, created_at, updated_at
 		FROM traders WHERE user_id = ? ORDER BY created_at DESC
 	`, userID)
 	if err != nil {
@@ -934,6 +1092,41 @@ func (d *Database) GetTraders(userID string) ([]*TraderRecord, error) {
 			&trader.UseCoinPool, &trader.UseOITop,
 			&trader.CustomPrompt, &trader.OverrideBasePrompt, &trader.SystemPromptTemplate,
 			&trader.IsCrossMargin,
+			&trader.HedgeMode,
+			&trader.AutoBumpMinNotional,
+			&trader.PostStopCooldownMinutes,
+			&trader.MaxOpenPositions,
+			&trader.BlacklistSymbols,
+			&trader.ScanJitterPercent,
+			&trader.FallbackAIModelID,
+			&trader.MaxCorrelatedExposure,
+			&trader.LeverageTiers,
+			&trader.DefaultStopLossPct,
+			&trader.MaxHoldMinutes,
+			&trader.MarginModes,
+			&trader.OrderTimeoutSeconds,
+			&trader.RepeatDecisionLimit,
+			&trader.RepeatBackoffMinutes,
+			&trader.AITemperature,
+			&trader.AITopP,
+			&trader.StrategyTag,
+			&trader.CloseReasonTolerancePct,
+			&trader.MaxPositionPctOfEquity,
+			&trader.ClampPositionSize,
+			&trader.AllowHighVolOpens,
+			&trader.RebaselineSchedule,
+			&trader.BTCETHMaxSpreadBps,
+			&trader.AltcoinMaxSpreadBps,
+			&trader.ShadowAIModelID,
+			&trader.SkipAIWithoutTrigger,
+			&trader.TriggerPriceMovePct,
+			&trader.TriggerVolumeSpike,
+			&trader.ConsensusOpens,
+			&trader.Disabled,
+			&trader.RetryEmptyDecision,
+			&trader.Timezone,
+			&trader.DustThresholdUSD,
+			&trader.AlwaysContextSymbols,
 			&trader.CreatedAt, &trader.UpdatedAt,
 		)
 		if err != nil {
@@ -951,6 +1144,18 @@ func (d *Database) UpdateTraderStatus(userID, id string, isRunning bool) error {
 	return err
 }
 
+// UpdateTraderDisabled 设置交易员紧急停用标记（单独更新，UpdateTrader 不会修改该标记，避免编辑配置时误解除停用）
+func (d *Database) UpdateTraderDisabled(userID, id string, disabled bool) error {
+	result, err := d.db.Exec(`UPDATE traders SET disabled = ? WHERE id = ? AND user_id = ?`, disabled, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("交易员 %s 不存在", id)
+	}
+	return nil
+}
+
 // UpdateTrader 更新交易员配置
 func (d *Database) UpdateTrader(trader *TraderRecord) error {
 	_, err := d.db.Exec(`
@@ -958,12 +1163,12 @@ func (d *Database) UpdateTrader(trader *TraderRecord) error {
 			name = ?, ai_model_id = ?, exchange_id = ?,
 			scan_interval_minutes = ?, btc_eth_leverage = ?, altcoin_leverage = ?,
 			trading_symbols = ?, custom_prompt = ?, override_base_prompt = ?,
-			system_prompt_template = ?, is_cross_margin = ?, updated_at = CURRENT_TIMESTAMP
+			system_prompt_template = ?, is_cross_margin = ?, hedge_mode = ?, auto_bump_min_notional = ?, post_stop_cooldown_minutes = ?, max_open_positions = ?, blacklist_symbols = ?, scan_jitter_percent = ?, fallback_ai_model_id = ?, max_correlated_exposure = ?, leverage_tiers = ?, default_stop_loss_pct = ?, max_hold_minutes = ?, margin_modes = ?, order_timeout_seconds = ?, repeat_decision_limit = ?, repeat_backoff_minutes = ?, ai_temperature = ?, ai_top_p = ?, strategy_tag = ?, close_reason_tolerance_pct = ?, max_position_pct_of_equity = ?, clamp_position_size = ?, allow_high_vol_opens = ?, rebaseline_schedule = ?, btc_eth_max_spread_bps = ?, altcoin_max_spread_bps = ?, shadow_ai_model_id = ?, skip_ai_without_trigger = ?, trigger_price_move_pct = ?, trigger_volume_spike = ?, consensus_opens = ?, retry_empty_decision = ?, timezone = ?, dust_threshold_usd = ?, always_context_symbols = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ? AND user_id = ?
 	`, trader.Name, trader.AIModelID, trader.ExchangeID,
 		trader.ScanIntervalMinutes, trader.BTCETHLeverage, trader.AltcoinLeverage,
 		trader.TradingSymbols, trader.CustomPrompt, trader.OverrideBasePrompt,
-		trader.SystemPromptTemplate, trader.IsCrossMargin, trader.ID, trader.UserID)
+		trader.SystemPromptTemplate, trader.IsCrossMargin, trader.HedgeMode, trader.AutoBumpMinNotional, trader.PostStopCooldownMinutes, trader.MaxOpenPositions, trader.BlacklistSymbols, trader.ScanJitterPercent, trader.FallbackAIModelID, trader.MaxCorrelatedExposure, trader.LeverageTiers, trader.DefaultStopLossPct, trader.MaxHoldMinutes, trader.MarginModes, trader.OrderTimeoutSeconds, trader.RepeatDecisionLimit, trader.RepeatBackoffMinutes, trader.AITemperature, trader.AITopP, trader.StrategyTag, trader.CloseReasonTolerancePct, trader.MaxPositionPctOfEquity, trader.ClampPositionSize, trader.AllowHighVolOpens, trader.RebaselineSchedule, trader.BTCETHMaxSpreadBps, trader.AltcoinMaxSpreadBps, trader.ShadowAIModelID, trader.SkipAIWithoutTrigger, trader.TriggerPriceMovePct, trader.TriggerVolumeSpike, trader.ConsensusOpens, trader.RetryEmptyDecision, trader.Timezone, trader.DustThresholdUSD, trader.AlwaysContextSymbols, trader.ID, trader.UserID)
 	return err
 }
 
@@ -986,6 +1191,163 @@ func (d *Database) DeleteTrader(userID, id string) error {
 	return err
 }
 
+// ManualHold 手动持仓标记：用户在机器人之外手动调整过的持仓，自动风控动作不再处理
+type ManualHold struct {
+	TraderID  string    `json:"trader_id"`
+	Symbol    string    `json:"symbol"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SetManualHold 标记交易员某币种为手动持仓（已存在时更新备注）
+func (d *Database) SetManualHold(traderID, symbol, note string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO trader_manual_holds (trader_id, symbol, note) VALUES (?, ?, ?)
+		ON CONFLICT(trader_id, symbol) DO UPDATE SET note = excluded.note
+	`, traderID, symbol, note)
+	return err
+}
+
+// DeleteManualHold 清除交易员某币种的手动持仓标记
+func (d *Database) DeleteManualHold(traderID, symbol string) error {
+	_, err := d.db.Exec(`DELETE FROM trader_manual_holds WHERE trader_id = ? AND symbol = ?`, traderID, symbol)
+	return err
+}
+
+// GetManualHolds 获取交易员的所有手动持仓标记
+func (d *Database) GetManualHolds(traderID string) ([]*ManualHold, error) {
+	rows, err := d.db.Query(`
+		SELECT trader_id, symbol, note, created_at FROM trader_manual_holds
+		WHERE trader_id = ? ORDER BY symbol
+	`, traderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []*ManualHold
+	for rows.Next() {
+		var hold ManualHold
+		if err := rows.Scan(&hold.TraderID, &hold.Symbol, &hold.Note, &hold.CreatedAt); err != nil {
+			return nil, err
+		}
+		holds = append(holds, &hold)
+	}
+	return holds, rows.Err()
+}
+
+// DecisionLogEntry 写入数据库的一条决策记录（RecordJSON 为完整记录，动作另存一份便于查询）
+type DecisionLogEntry struct {
+	Timestamp   time.Time
+	CycleNumber int
+	Success     bool
+	RecordJSON  string
+	Actions     []DecisionLogAction
+}
+
+// DecisionLogAction 决策记录中执行的一个动作
+type DecisionLogAction struct {
+	Timestamp time.Time
+	Symbol    string
+	Action    string
+	Quantity  float64
+	Price     float64
+	OrderID   int64
+	Success   bool
+	Error     string
+}
+
+// SaveDecisionLogs 在一个事务中批量写入交易员的决策记录及其动作
+func (d *Database) SaveDecisionLogs(userID, traderID string, entries []DecisionLogEntry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, entry := range entries {
+		result, err := tx.Exec(`
+			INSERT INTO decision_records (user_id, trader_id, cycle_number, timestamp_ms, success, record_json)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, userID, traderID, entry.CycleNumber, entry.Timestamp.UnixMilli(), entry.Success, entry.RecordJSON)
+		if err != nil {
+			return fmt.Errorf("写入决策记录失败: %w", err)
+		}
+		recordID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, action := range entry.Actions {
+			if _, err := tx.Exec(`
+				INSERT INTO decision_actions (record_id, user_id, trader_id, timestamp_ms, symbol, action, quantity, price, order_id, success, error)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, recordID, userID, traderID, action.Timestamp.UnixMilli(), action.Symbol, action.Action,
+				action.Quantity, action.Price, action.OrderID, action.Success, action.Error); err != nil {
+				return fmt.Errorf("写入决策动作失败: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadDecisionLogs 读取交易员 since 之后（含）的最近 limit 条决策记录JSON（从新到旧，limit<=0 表示不限制）
+func (d *Database) LoadDecisionLogs(userID, traderID string, limit int, since time.Time) ([]string, error) {
+	if limit <= 0 {
+		limit = -1 // SQLite 中 LIMIT -1 表示不限制
+	}
+	sinceMs := int64(0)
+	if !since.IsZero() {
+		sinceMs = since.UnixMilli()
+	}
+	rows, err := d.db.Query(`
+		SELECT record_json FROM decision_records
+		WHERE user_id = ? AND trader_id = ? AND timestamp_ms >= ?
+		ORDER BY timestamp_ms DESC, id DESC LIMIT ?
+	`, userID, traderID, sinceMs, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []string
+	for rows.Next() {
+		var record string
+		if err := rows.Scan(&record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// DeleteDecisionLogsBefore 删除交易员 cutoff 之前的决策记录及其动作，返回删除的记录数
+func (d *Database) DeleteDecisionLogsBefore(userID, traderID string, cutoff time.Time) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		DELETE FROM decision_actions WHERE record_id IN (
+			SELECT id FROM decision_records WHERE user_id = ? AND trader_id = ? AND timestamp_ms < ?
+		)
+	`, userID, traderID, cutoff.UnixMilli()); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`
+		DELETE FROM decision_records WHERE user_id = ? AND trader_id = ? AND timestamp_ms < ?
+	`, userID, traderID, cutoff.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return removed, tx.Commit()
+}
+
 // GetTraderConfig 获取交易员完整配置（包含AI模型和交易所信息）
 func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIModelConfig, *ExchangeConfig, error) {
 	var trader TraderRecord
@@ -1004,6 +1366,41 @@ func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIM
 			COALESCE(t.override_base_prompt, 0) as override_base_prompt,
 			COALESCE(t.system_prompt_template, 'default') as system_prompt_template,
 			COALESCE(t.is_cross_margin, 1) as is_cross_margin,
+			COALESCE(t.hedge_mode, 0) as hedge_mode,
+			COALESCE(t.auto_bump_min_notional, 0) as auto_bump_min_notional,
+			COALESCE(t.post_stop_cooldown_minutes, 0) as post_stop_cooldown_minutes,
+			COALESCE(t.max_open_positions, 0) as max_open_positions,
+			COALESCE(t.blacklist_symbols, '') as blacklist_symbols,
+			COALESCE(t.scan_jitter_percent, 10) as scan_jitter_percent,
+			COALESCE(t.fallback_ai_model_id, '') as fallback_ai_model_id,
+			COALESCE(t.max_correlated_exposure, 0) as max_correlated_exposure,
+			COALESCE(t.leverage_tiers, '') as leverage_tiers,
+			COALESCE(t.default_stop_loss_pct, 0) as default_stop_loss_pct,
+			COALESCE(t.max_hold_minutes, 0) as max_hold_minutes,
+			COALESCE(t.margin_modes, '') as margin_modes,
+			COALESCE(t.order_timeout_seconds, 10) as order_timeout_seconds,
+			COALESCE(t.repeat_decision_limit, 0) as repeat_decision_limit,
+			COALESCE(t.repeat_backoff_minutes, 15) as repeat_backoff_minutes,
+			COALESCE(t.ai_temperature, -1) as ai_temperature,
+			COALESCE(t.ai_top_p, -1) as ai_top_p,
+			COALESCE(t.strategy_tag, '') as strategy_tag,
+			COALESCE(t.close_reason_tolerance_pct, 0) as close_reason_tolerance_pct,
+			COALESCE(t.max_position_pct_of_equity, 0) as max_position_pct_of_equity,
+			COALESCE(t.clamp_position_size, 0) as clamp_position_size,
+			COALESCE(t.allow_high_vol_opens, 0) as allow_high_vol_opens,
+			COALESCE(t.rebaseline_schedule, '') as rebaseline_schedule,
+			COALESCE(t.btc_eth_max_spread_bps, 0) as btc_eth_max_spread_bps,
+			COALESCE(t.altcoin_max_spread_bps, 0) as altcoin_max_spread_bps,
+			COALESCE(t.shadow_ai_model_id, '') as shadow_ai_model_id,
+			COALESCE(t.skip_ai_without_trigger, 0) as skip_ai_without_trigger,
+			COALESCE(t.trigger_price_move_pct, 0) as trigger_price_move_pct,
+			COALESCE(t.trigger_volume_spike, 0) as trigger_volume_spike,
+			COALESCE(t.consensus_opens, 0) as consensus_opens,
+			COALESCE(t.disabled, 0) as disabled,
+			COALESCE(t.retry_empty_decision, 0) as retry_empty_decision,
+			COALESCE(t.timezone, '') as timezone,
+			COALESCE(t.dust_threshold_usd, 0) as dust_threshold_usd,
+			COALESCE(t.always_context_symbols, '') as always_context_symbols,
 			t.created_at, t.updated_at,
 			a.id, a.user_id, a.name, a.provider, a.enabled, a.api_key,
 			COALESCE(a.custom_api_url, '') as custom_api_url,
@@ -1026,6 +1423,41 @@ func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIM
 		&trader.UseCoinPool, &trader.UseOITop,
 		&trader.CustomPrompt, &trader.OverrideBasePrompt, &trader.SystemPromptTemplate,
 		&trader.IsCrossMargin,
+		&trader.HedgeMode,
+		&trader.AutoBumpMinNotional,
+		&trader.PostStopCooldownMinutes,
+		&trader.MaxOpenPositions,
+		&trader.BlacklistSymbols,
+		&trader.ScanJitterPercent,
+		&trader.FallbackAIModelID,
+		&trader.MaxCorrelatedExposure,
+		&trader.LeverageTiers,
+		&trader.DefaultStopLossPct,
+		&trader.MaxHoldMinutes,
+		&trader.MarginModes,
+		&trader.OrderTimeoutSeconds,
+		&trader.RepeatDecisionLimit,
+		&trader.RepeatBackoffMinutes,
+		&trader.AITemperature,
+		&trader.AITopP,
+		&trader.StrategyTag,
+		&trader.CloseReasonTolerancePct,
+		&trader.MaxPositionPctOfEquity,
+		&trader.ClampPositionSize,
+		&trader.AllowHighVolOpens,
+		&trader.RebaselineSchedule,
+		&trader.BTCETHMaxSpreadBps,
+		&trader.AltcoinMaxSpreadBps,
+		&trader.ShadowAIModelID,
+		&trader.SkipAIWithoutTrigger,
+		&trader.TriggerPriceMovePct,
+		&trader.TriggerVolumeSpike,
+		&trader.ConsensusOpens,
+		&trader.Disabled,
+		&trader.RetryEmptyDecision,
+		&trader.Timezone,
+		&trader.DustThresholdUSD,
+		&trader.AlwaysContextSymbols,
 		&trader.CreatedAt, &trader.UpdatedAt,
 		&aiModel.ID, &aiModel.UserID, &aiModel.Name, &aiModel.Provider, &aiModel.Enabled, &aiModel.APIKey,
 		&aiModel.CustomAPIURL, &aiModel.CustomModelName,
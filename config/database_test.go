@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"nofx/crypto"
 	"os"
 	"testing"
@@ -288,6 +289,7 @@ func TestUpdateExchange_MultipleExchangeTypes(t *testing.T) {
 		{"binance", "Binance Futures", "cex"},
 		{"hyperliquid", "Hyperliquid", "dex"},
 		{"aster", "Aster DEX", "dex"},
+		{"bybit", "Bybit Futures", "cex"},
 		{"unknown-exchange", "unknown-exchange Exchange", "cex"},
 	}
 
@@ -797,3 +799,122 @@ func TestConcurrentWritesWithWAL(t *testing.T) {
 		t.Errorf("并发写入失败次数过多: %d", errorCount)
 	}
 }
+
+// TestDecisionLogs 测试决策记录批量写入、按交易员和时间读取（从新到旧）以及清理旧记录
+func TestDecisionLogs(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	base := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	entry := func(cycle int, offset time.Duration) DecisionLogEntry {
+		return DecisionLogEntry{
+			Timestamp:   base.Add(offset),
+			CycleNumber: cycle,
+			Success:     true,
+			RecordJSON:  fmt.Sprintf(`{"cycle_number":%d}`, cycle),
+			Actions: []DecisionLogAction{
+				{Timestamp: base.Add(offset), Symbol: "BTCUSDT", Action: "open_long", Quantity: 0.01, Price: 90000, OrderID: int64(cycle), Success: true},
+			},
+		}
+	}
+
+	if err := db.SaveDecisionLogs("user-1", "trader-1", []DecisionLogEntry{entry(1, 0), entry(2, time.Hour), entry(3, 2*time.Hour)}); err != nil {
+		t.Fatalf("SaveDecisionLogs failed: %v", err)
+	}
+	if err := db.SaveDecisionLogs("user-1", "trader-2", []DecisionLogEntry{entry(9, 3*time.Hour)}); err != nil {
+		t.Fatalf("SaveDecisionLogs failed: %v", err)
+	}
+
+	rows, err := db.LoadDecisionLogs("user-1", "trader-1", 0, time.Time{})
+	if err != nil {
+		t.Fatalf("LoadDecisionLogs failed: %v", err)
+	}
+	want := []string{`{"cycle_number":3}`, `{"cycle_number":2}`, `{"cycle_number":1}`}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("LoadDecisionLogs = %v, want %v", rows, want)
+	}
+
+	rows, _ = db.LoadDecisionLogs("user-1", "trader-1", 1, base.Add(30*time.Minute))
+	if len(rows) != 1 || rows[0] != `{"cycle_number":3}` {
+		t.Errorf("limit/since 过滤结果错误: %v", rows)
+	}
+
+	var actions int
+	db.db.QueryRow(`SELECT COUNT(*) FROM decision_actions WHERE trader_id = ?`, "trader-1").Scan(&actions)
+	if actions != 3 {
+		t.Errorf("应写入3条决策动作，实际 %d", actions)
+	}
+
+	removed, err := db.DeleteDecisionLogsBefore("user-1", "trader-1", base.Add(90*time.Minute))
+	if err != nil || removed != 2 {
+		t.Fatalf("DeleteDecisionLogsBefore = %d, %v, want 2", removed, err)
+	}
+	db.db.QueryRow(`SELECT COUNT(*) FROM decision_actions WHERE trader_id = ?`, "trader-1").Scan(&actions)
+	if actions != 1 {
+		t.Errorf("清理后应剩1条决策动作，实际 %d", actions)
+	}
+	if rows, _ := db.LoadDecisionLogs("user-1", "trader-2", 0, time.Time{}); len(rows) != 1 {
+		t.Errorf("其他交易员的记录不应被清理")
+	}
+}
+
+// TestMigrateHedgeMode 测试升级时新增 hedge_mode 字段：已有的币安交易员保留升级前的双向持仓，其他交易所和新建交易员默认单向持仓
+func TestMigrateHedgeMode(t *testing.T) {
+	dbPath := t.TempDir() + "/test.db"
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	for _, tr := range []*TraderRecord{
+		{ID: "t-binance", UserID: "default", Name: "binance", AIModelID: "deepseek", ExchangeID: "binance", InitialBalance: 1000},
+		{ID: "t-aster", UserID: "default", Name: "aster", AIModelID: "deepseek", ExchangeID: "aster", InitialBalance: 1000},
+	} {
+		if err := db.CreateTrader(tr); err != nil {
+			t.Fatalf("创建交易员失败: %v", err)
+		}
+	}
+	// 模拟升级前的表结构
+	if _, err := db.db.Exec(`ALTER TABLE traders DROP COLUMN hedge_mode`); err != nil {
+		t.Fatalf("删除 hedge_mode 字段失败: %v", err)
+	}
+	db.Close()
+
+	db, err = NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	if err := db.CreateTrader(&TraderRecord{ID: "t-new", UserID: "default", Name: "new", AIModelID: "deepseek", ExchangeID: "binance", InitialBalance: 1000}); err != nil {
+		t.Fatalf("创建交易员失败: %v", err)
+	}
+
+	traders, err := db.GetTraders("default")
+	if err != nil {
+		t.Fatalf("读取交易员失败: %v", err)
+	}
+	want := map[string]bool{"t-binance": true, "t-aster": false, "t-new": false}
+	for _, tr := range traders {
+		if tr.HedgeMode != want[tr.ID] {
+			t.Errorf("%s HedgeMode = %v, want %v", tr.ID, tr.HedgeMode, want[tr.ID])
+		}
+	}
+	if len(traders) != len(want) {
+		t.Errorf("交易员数量 = %d, want %d", len(traders), len(want))
+	}
+
+	// 再次打开不会重复迁移
+	if _, err := db.db.Exec(`UPDATE traders SET hedge_mode = 0 WHERE id = 't-binance'`); err != nil {
+		t.Fatalf("更新失败: %v", err)
+	}
+	db.Close()
+	db, err = NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	traders, _ = db.GetTraders("default")
+	for _, tr := range traders {
+		if tr.ID == "t-binance" && tr.HedgeMode {
+			t.Error("用户关闭双向持仓后再次启动不应被迁移覆盖")
+		}
+	}
+}
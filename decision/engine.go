@@ -2,6 +2,7 @@ package decision
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -9,6 +10,7 @@ import (
 	"nofx/mcp"
 	"nofx/pool"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
@@ -21,6 +23,7 @@ var (
 	reJSONArray      = regexp.MustCompile(`(?is)\[\s*\{.*?\}\s*\]`)
 	reArrayHead      = regexp.MustCompile(`^\[\s*\{`)
 	reArrayOpenSpace = regexp.MustCompile(`^\[\s+\{`)
+	reEmptyArray     = regexp.MustCompile(`^\[\s*\]$`)
 	reInvisibleRunes = regexp.MustCompile("[\u200B\u200C\u200D\uFEFF]")
 
 	// 新增：XML标签提取（支持思维链中包含任何字符）
@@ -28,6 +31,12 @@ var (
 	reDecisionTag  = regexp.MustCompile(`(?s)<decision>(.*?)</decision>`)
 )
 
+// ErrAICallFailed AI API 调用失败（客户端重试耗尽），可用 errors.Is 判断以切换备用模型
+var ErrAICallFailed = errors.New("调用AI API失败")
+
+// MaxRiskPercent risk_percent 的上限（单笔止损最多亏损账户净值的百分比）
+const MaxRiskPercent = 10.0
+
 // PositionInfo 持仓信息
 type PositionInfo struct {
 	Symbol           string  `json:"symbol"`
@@ -44,6 +53,11 @@ type PositionInfo struct {
 	UpdateTime       int64   `json:"update_time"` // 持仓更新时间戳（毫秒）
 	StopLoss         float64 `json:"stop_loss,omitempty"`         // 止损价格（用于推断平仓原因）
 	TakeProfit       float64 `json:"take_profit,omitempty"`       // 止盈价格（用于推断平仓原因）
+	// 盈亏拆分：净盈亏 = 价格盈亏 - 累计资金费 - 预估平仓手续费（此刻市价平仓实际到手的盈亏）
+	GrossPnL    float64 `json:"gross_pnl,omitempty"`
+	FundingCost float64 `json:"funding_cost,omitempty"` // 持仓以来累计支付的资金费（负数为收到）
+	CloseFee    float64 `json:"close_fee,omitempty"`
+	NetPnL      float64 `json:"net_pnl,omitempty"`
 }
 
 // AccountInfo 账户信息
@@ -82,28 +96,46 @@ type Context struct {
 	Account         AccountInfo             `json:"account"`
 	Positions       []PositionInfo          `json:"positions"`
 	CandidateCoins  []CandidateCoin         `json:"candidate_coins"`
+	ContextSymbols  []string                `json:"context_symbols,omitempty"` // 仅供参考的币种（始终获取行情，不在候选中，不可开仓）
 	MarketDataMap   map[string]*market.Data `json:"-"` // 不序列化，但内部使用
 	OITopDataMap    map[string]*OITopData   `json:"-"` // OI Top数据映射
 	Performance     interface{}             `json:"-"` // 历史表现分析（logger.PerformanceAnalysis）
 	BTCETHLeverage  int                     `json:"-"` // BTC/ETH杠杆倍数（从配置读取）
 	AltcoinLeverage int                     `json:"-"` // 山寨币杠杆倍数（从配置读取）
+	LeverageTiers   map[string]int          `json:"-"` // 杠杆分级（币种 -> 杠杆上限，default 为其余币种），配置后优先于两档杠杆
+	// 持仓相关性（基于4小时K线收益率，少于2个持仓时为 nil）
+	Correlations       map[string]map[string]float64 `json:"-"`
+	CorrelationSummary *market.CorrelationSummary    `json:"-"`
+	// 盘口买卖比（symbol -> 失衡数据），交易所不提供盘口时为 nil
+	DepthImbalances map[string]*market.DepthImbalance `json:"-"`
+	// 市场状态（BTC 4小时K线），获取失败时为 nil
+	MarketRegime *market.MarketRegime `json:"-"`
+	// 本周期行情获取失败（请求出错或数据停滞）而缺失的币种
+	SkippedSymbols []string `json:"skipped_symbols,omitempty"`
 }
 
-// Decision AI的交易决策
+// Decision AI的交易决策（字段或动作变化时递增 DecisionSchemaVersion，见 schema.go）
 type Decision struct {
+	SchemaVersion int `json:"schema_version,omitempty"` // AI输出时所依据的决策格式版本
+
 	Symbol string `json:"symbol"`
-	Action string `json:"action"` // "open_long", "open_short", "close_long", "close_short", "update_stop_loss", "update_take_profit", "partial_close", "hold", "wait"
+	Action string `json:"action"` // "open_long", "open_short", "add_position", "add_short", "close_long", "close_short", "update_stop_loss", "update_take_profit", "partial_close", "hold", "wait"
 
 	// 开仓参数
 	Leverage        int     `json:"leverage,omitempty"`
 	PositionSizeUSD float64 `json:"position_size_usd,omitempty"`
+	RiskPercent     float64 `json:"risk_percent,omitempty"` // 按账户风险百分比定仓：触及止损时亏损净值的该比例（优先于 position_size_usd）
 	StopLoss        float64 `json:"stop_loss,omitempty"`
 	TakeProfit      float64 `json:"take_profit,omitempty"`
 
+	// 分批止盈（可选）：提供时替代单一止盈单，按档位分批挂出只减仓止盈单
+	TakeProfitLadder []TakeProfitLevel `json:"take_profit_ladder,omitempty"`
+
 	// 调整参数（新增）
 	NewStopLoss     float64 `json:"new_stop_loss,omitempty"`    // 用于 update_stop_loss
 	NewTakeProfit   float64 `json:"new_take_profit,omitempty"`  // 用于 update_take_profit
 	ClosePercentage float64 `json:"close_percentage,omitempty"` // 用于 partial_close (0-100)
+	CloseQuantity   float64 `json:"close_quantity,omitempty"`   // 用于 partial_close：平仓的币数量（设置时优先于 close_percentage，超过持仓按持仓截断）
 
 	// 通用参数
 	Confidence int     `json:"confidence,omitempty"` // 信心度 (0-100)
@@ -111,6 +143,38 @@ type Decision struct {
 	Reasoning  string  `json:"reasoning"`
 }
 
+// TakeProfitLevel 分批止盈的一个档位
+type TakeProfitLevel struct {
+	Price   float64 `json:"price"`   // 止盈价格
+	Percent float64 `json:"percent"` // 该档平仓比例（占开仓数量的百分比，0-100）
+}
+
+// ValidateTakeProfitLadder 校验分批止盈：各档比例之和≤100，且价格都在参考价的盈利一侧
+// （多仓需高于 refPrice，空仓需低于 refPrice）
+func ValidateTakeProfitLadder(ladder []TakeProfitLevel, isLong bool, refPrice float64) error {
+	totalPercent := 0.0
+	for i, level := range ladder {
+		if level.Percent <= 0 || level.Percent > 100 {
+			return fmt.Errorf("分批止盈第%d档比例必须在0-100之间: %.1f", i+1, level.Percent)
+		}
+		if level.Price <= 0 {
+			return fmt.Errorf("分批止盈第%d档价格必须大于0: %.4f", i+1, level.Price)
+		}
+		if isLong && level.Price <= refPrice {
+			return fmt.Errorf("做多时分批止盈第%d档价格(%.4f)必须高于 %.4f", i+1, level.Price, refPrice)
+		}
+		if !isLong && level.Price >= refPrice {
+			return fmt.Errorf("做空时分批止盈第%d档价格(%.4f)必须低于 %.4f", i+1, level.Price, refPrice)
+		}
+		totalPercent += level.Percent
+	}
+	// 加 0.01% 容差以避免浮点数精度问题
+	if totalPercent > 100.01 {
+		return fmt.Errorf("分批止盈比例之和不能超过100%%，实际: %.1f%%", totalPercent)
+	}
+	return nil
+}
+
 // FullDecision AI的完整决策（包含思维链）
 type FullDecision struct {
 	SystemPrompt string     `json:"system_prompt"` // 系统提示词（发送给AI的系统prompt）
@@ -118,8 +182,13 @@ type FullDecision struct {
 	CoTTrace     string     `json:"cot_trace"`     // 思维链分析（AI输出）
 	Decisions    []Decision `json:"decisions"`     // 具体决策列表
 	Timestamp    time.Time  `json:"timestamp"`
+	// SchemaVersion AI输出的决策格式版本，SchemaWarning 版本缺失或不匹配时的告警（按当前版本尽力解析）
+	SchemaVersion int    `json:"schema_version,omitempty"`
+	SchemaWarning string `json:"schema_warning,omitempty"`
 	// AIRequestDurationMs 记录 AI API 调用耗时（毫秒）方便排查延迟问题
 	AIRequestDurationMs int64 `json:"ai_request_duration_ms,omitempty"`
+	// TokenUsage 本次AI调用的token用量（provider未返回时为零）
+	TokenUsage mcp.Usage `json:"token_usage"`
 }
 
 // GetFullDecision 获取AI的完整交易决策（批量分析所有币种和持仓）
@@ -134,20 +203,24 @@ func GetFullDecisionWithCustomPrompt(ctx *Context, mcpClient mcp.AIClient, custo
 		return nil, fmt.Errorf("获取市场数据失败: %w", err)
 	}
 
+	return GetFullDecisionFromMarketData(ctx, mcpClient, customPrompt, overrideBase, templateName)
+}
+
+// GetFullDecisionFromMarketData 使用上下文中已填充的 MarketDataMap 获取AI决策，不拉取实时行情（回测使用）
+func GetFullDecisionFromMarketData(ctx *Context, mcpClient mcp.AIClient, customPrompt string, overrideBase bool, templateName string) (*FullDecision, error) {
 	// 2. 构建 System Prompt（固定规则）和 User Prompt（动态数据）
-	systemPrompt := buildSystemPromptWithCustom(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, customPrompt, overrideBase, templateName)
-	userPrompt := buildUserPrompt(ctx)
+	systemPrompt, userPrompt := buildPrompts(ctx, customPrompt, overrideBase, templateName)
 
 	// 3. 调用AI API（使用 system + user prompt）
 	aiCallStart := time.Now()
-	aiResponse, err := mcpClient.CallWithMessages(systemPrompt, userPrompt)
+	aiResponse, usage, err := mcpClient.CallWithMessagesUsage(systemPrompt, userPrompt)
 	aiCallDuration := time.Since(aiCallStart)
 	if err != nil {
-		return nil, fmt.Errorf("调用AI API失败: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrAICallFailed, err)
 	}
 
 	// 4. 解析AI响应
-	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, ctx.LeverageTiers)
 
 	// 无论是否有错误，都要保存 SystemPrompt 和 UserPrompt（用于调试和决策未执行后的问题定位）
 	if decision != nil {
@@ -155,6 +228,7 @@ func GetFullDecisionWithCustomPrompt(ctx *Context, mcpClient mcp.AIClient, custo
 		decision.SystemPrompt = systemPrompt // 保存系统prompt
 		decision.UserPrompt = userPrompt     // 保存输入prompt
 		decision.AIRequestDurationMs = aiCallDuration.Milliseconds()
+		decision.TokenUsage = usage
 	}
 
 	if err != nil {
@@ -167,10 +241,34 @@ func GetFullDecisionWithCustomPrompt(ctx *Context, mcpClient mcp.AIClient, custo
 	return decision, nil
 }
 
+// BuildPrompts 拉取行情并渲染发送给AI的 System Prompt 和 User Prompt，与 GetFullDecisionWithCustomPrompt 完全一致，
+// 但不调用AI（用于预览自定义prompt的实际效果）
+func BuildPrompts(ctx *Context, customPrompt string, overrideBase bool, templateName string) (systemPrompt, userPrompt string, err error) {
+	if err := fetchMarketDataForContext(ctx); err != nil {
+		return "", "", fmt.Errorf("获取市场数据失败: %w", err)
+	}
+	systemPrompt, userPrompt = buildPrompts(ctx, customPrompt, overrideBase, templateName)
+	return systemPrompt, userPrompt, nil
+}
+
+// ParseResponse 按实盘流程解析一段AI原始响应（提取思维链、清洗并解析JSON决策、按账户净值和杠杆配置校验），
+// 与 GetFullDecisionFromMarketData 的解析步骤完全一致，但不调用AI（用于调试prompt的输出格式）
+func ParseResponse(aiResponse string, accountEquity float64, cfg ValidationConfig) (*FullDecision, error) {
+	return parseFullDecisionResponse(aiResponse, accountEquity, cfg.BTCETHLeverage, cfg.AltcoinLeverage, cfg.LeverageTiers)
+}
+
+// buildPrompts 使用上下文中已填充的行情构建 System Prompt（固定规则）和 User Prompt（动态数据）
+func buildPrompts(ctx *Context, customPrompt string, overrideBase bool, templateName string) (string, string) {
+	systemPrompt := buildSystemPromptWithCustom(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, customPrompt, overrideBase, templateName)
+	return systemPrompt, buildUserPrompt(ctx)
+}
+
 // fetchMarketDataForContext 为上下文中的所有币种获取市场数据和OI数据
+// 单个币种获取失败（请求出错或数据停滞）时跳过并记录到 SkippedSymbols，只有所有币种都失败时才返回错误
 func fetchMarketDataForContext(ctx *Context) error {
 	ctx.MarketDataMap = make(map[string]*market.Data)
 	ctx.OITopDataMap = make(map[string]*OITopData)
+	ctx.SkippedSymbols = nil
 
 	// 收集所有需要获取数据的币种
 	symbolSet := make(map[string]bool)
@@ -189,17 +287,27 @@ func fetchMarketDataForContext(ctx *Context) error {
 		symbolSet[coin.Symbol] = true
 	}
 
+	// 3. 参考币种（如BTC/ETH）始终获取，用于判断大盘方向
+	for _, symbol := range ctx.ContextSymbols {
+		symbolSet[symbol] = true
+	}
+
 	// 并发获取市场数据
-	// 持仓币种集合（用于判断是否跳过OI检查）
+	// 持仓币种和参考币种集合（用于判断是否跳过OI检查）
 	positionSymbols := make(map[string]bool)
 	for _, pos := range ctx.Positions {
 		positionSymbols[pos.Symbol] = true
 	}
+	for _, symbol := range ctx.ContextSymbols {
+		positionSymbols[symbol] = true
+	}
 
 	for symbol := range symbolSet {
 		data, err := market.Get(symbol)
 		if err != nil {
-			// 单个币种失败不影响整体，只记录错误
+			// 单个币种失败不影响整体，跳过并告知AI该币种本周期无数据
+			log.Printf("⚠️  %s 行情获取失败，本周期跳过: %v", symbol, err)
+			ctx.SkippedSymbols = append(ctx.SkippedSymbols, symbol)
 			continue
 		}
 
@@ -224,6 +332,11 @@ func fetchMarketDataForContext(ctx *Context) error {
 		ctx.MarketDataMap[symbol] = data
 	}
 
+	if len(symbolSet) > 0 && len(ctx.SkippedSymbols) == len(symbolSet) {
+		return fmt.Errorf("全部 %d 个币种行情获取失败", len(symbolSet))
+	}
+	sort.Strings(ctx.SkippedSymbols)
+
 	// 加载OI Top数据（不影响主流程）
 	oiPositions, err := pool.GetOITopPositions()
 	if err == nil {
@@ -309,23 +422,16 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 		templateName = "default" // 默认使用 default 模板
 	}
 
-	template, err := GetPromptTemplate(templateName)
+	// 系统提示词只依赖账户净值和杠杆上限，行情数据在 User Prompt 中
+	promptCtx := &Context{Account: AccountInfo{TotalEquity: accountEquity}, BTCETHLeverage: btcEthLeverage, AltcoinLeverage: altcoinLeverage}
+	builder, err := globalPromptManager.Get(templateName)
 	if err != nil {
-		// 如果模板不存在，记录错误并使用 default
+		// 配置时已校验模板名称，运行期模板文件被删除时记录错误并使用 default（始终有内置版本兜底）
 		log.Printf("⚠️  提示词模板 '%s' 不存在，使用 default: %v", templateName, err)
-		template, err = GetPromptTemplate("default")
-		if err != nil {
-			// 如果连 default 都不存在，使用内置的简化版本
-			log.Printf("❌ 无法加载任何提示词模板，使用内置简化版本")
-			sb.WriteString("你是专业的加密货币交易AI。请根据市场数据做出交易决策。\n\n")
-		} else {
-			sb.WriteString(template.Content)
-			sb.WriteString("\n\n")
-		}
-	} else {
-		sb.WriteString(template.Content)
-		sb.WriteString("\n\n")
+		builder, _ = globalPromptManager.Get("default")
 	}
+	sb.WriteString(builder(promptCtx))
+	sb.WriteString("\n\n")
 
 	// 2. 硬约束（风险控制）- 动态生成
 	sb.WriteString("# 硬约束（风险控制）\n\n")
@@ -348,18 +454,22 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 	sb.WriteString("</reasoning>\n\n")
 	sb.WriteString("<decision>\n")
 	sb.WriteString("```json\n[\n")
-	sb.WriteString(fmt.Sprintf("  {\"symbol\": \"BTCUSDT\", \"action\": \"open_short\", \"leverage\": %d, \"position_size_usd\": %.0f, \"stop_loss\": 97000, \"take_profit\": 91000, \"confidence\": 85, \"risk_usd\": 300, \"reasoning\": \"下跌趋势+MACD死叉\"},\n", btcEthLeverage, accountEquity*5))
-	sb.WriteString("  {\"symbol\": \"SOLUSDT\", \"action\": \"update_stop_loss\", \"new_stop_loss\": 155, \"reasoning\": \"移动止损至保本位\"},\n")
-	sb.WriteString("  {\"symbol\": \"ETHUSDT\", \"action\": \"close_long\", \"reasoning\": \"止盈离场\"}\n")
+	sb.WriteString(fmt.Sprintf("  {\"schema_version\": %d, \"symbol\": \"BTCUSDT\", \"action\": \"open_short\", \"leverage\": %d, \"position_size_usd\": %.0f, \"stop_loss\": 97000, \"take_profit\": 91000, \"confidence\": 85, \"risk_usd\": 300, \"reasoning\": \"下跌趋势+MACD死叉\"},\n", DecisionSchemaVersion, btcEthLeverage, accountEquity*5))
+	sb.WriteString(fmt.Sprintf("  {\"schema_version\": %d, \"symbol\": \"SOLUSDT\", \"action\": \"update_stop_loss\", \"new_stop_loss\": 155, \"reasoning\": \"移动止损至保本位\"},\n", DecisionSchemaVersion))
+	sb.WriteString(fmt.Sprintf("  {\"schema_version\": %d, \"symbol\": \"ETHUSDT\", \"action\": \"close_long\", \"reasoning\": \"止盈离场\"}\n", DecisionSchemaVersion))
 	sb.WriteString("]\n```\n")
 	sb.WriteString("</decision>\n\n")
 	sb.WriteString("## 字段说明\n\n")
-	sb.WriteString("- `action`: open_long | open_short | close_long | close_short | update_stop_loss | update_take_profit | partial_close | hold | wait\n")
+	sb.WriteString(fmt.Sprintf("- `schema_version`: 每个决策对象都必须填写 %d（决策格式版本）\n", DecisionSchemaVersion))
+	sb.WriteString("- `action`: open_long | open_short | add_position | add_short | close_long | close_short | update_stop_loss | update_take_profit | partial_close | hold | wait\n")
 	sb.WriteString("- `confidence`: 0-100（开仓建议≥75）\n")
 	sb.WriteString("- 开仓时必填: leverage, position_size_usd, stop_loss, take_profit, confidence, risk_usd, reasoning\n")
+	sb.WriteString(fmt.Sprintf("- 开仓时可选: risk_percent（0-%.0f），按止损距离自动计算仓位，使触及止损时亏损账户净值的该百分比，填写后优先于 position_size_usd\n", MaxRiskPercent))
 	sb.WriteString("- update_stop_loss 时必填: new_stop_loss (注意是 new_stop_loss，不是 stop_loss)\n")
 	sb.WriteString("- update_take_profit 时必填: new_take_profit (注意是 new_take_profit，不是 take_profit)\n")
-	sb.WriteString("- partial_close 时必填: close_percentage (0-100)\n\n")
+	sb.WriteString("- partial_close 时必填: close_percentage (0-100)，或 close_quantity（平仓的币数量，如凑整到整手时使用，优先于百分比）\n")
+	sb.WriteString("- add_position（加多仓）/ add_short（加空仓）时必填: position_size_usd（本次加仓金额），只能在已有同方向持仓上分批加仓，止损止盈数量随仓位自动调整\n")
+	sb.WriteString("- 开仓时可选: take_profit_ladder 分批止盈，如 [{\"price\": 105000, \"percent\": 50}, {\"price\": 110000, \"percent\": 50}]，各档 percent 之和≤100\n\n")
 
 	return sb.String()
 }
@@ -378,6 +488,7 @@ func buildUserPrompt(ctx *Context) string {
 			btcData.CurrentPrice, btcData.PriceChange1h, btcData.PriceChange4h,
 			btcData.CurrentMACD, btcData.CurrentRSI7))
 	}
+	sb.WriteString(formatMarketRegime(ctx.MarketRegime))
 
 	// 账户
 	sb.WriteString(fmt.Sprintf("账户: 净值%.2f | **可用余额%.2f USDT** (%.1f%%) | 已用保证金%.2f | 盈亏%+.2f%% | 保证金使用率%.1f%% | 持仓%d个\n\n",
@@ -388,6 +499,7 @@ func buildUserPrompt(ctx *Context) string {
 		ctx.Account.TotalPnLPct,
 		ctx.Account.MarginUsedPct,
 		ctx.Account.PositionCount))
+	sb.WriteString(formatLeverageTiers(ctx.LeverageTiers))
 
 	// 持仓（完整市场数据）
 	if len(ctx.Positions) > 0 {
@@ -415,18 +527,30 @@ func buildUserPrompt(ctx *Context) string {
 				pos.EntryPrice, pos.MarkPrice, pos.Quantity, positionValue, pos.UnrealizedPnLPct, pos.UnrealizedPnL, pos.PeakPnLPct,
 				pos.Leverage, pos.MarginUsed, pos.LiquidationPrice, holdingDuration))
 
+			sb.WriteString(formatPnLBreakdown(pos))
+
 			// 使用FormatMarketData输出完整市场数据
 			if marketData, ok := ctx.MarketDataMap[pos.Symbol]; ok {
+				sb.WriteString(formatPositionFunding(pos.Side, marketData))
+				sb.WriteString(formatDepthImbalance(ctx.DepthImbalances[pos.Symbol]))
 				sb.WriteString(market.Format(marketData))
 				sb.WriteString("\n")
 			}
 		}
+		sb.WriteString(formatPositionCorrelation(ctx))
 	} else {
 		sb.WriteString("当前持仓: 无\n\n")
 	}
 
+	if len(ctx.SkippedSymbols) > 0 {
+		sb.WriteString(fmt.Sprintf("⚠️ 以下币种本周期行情获取失败，缺少数据（持仓币种请勿凭空推测价格，可保持观望）: %s\n\n",
+			strings.Join(ctx.SkippedSymbols, ", ")))
+	}
+
 	// 候选币种（完整市场数据）
+	// 注：OI / 资金费率来自 Binance 合约接口，数据源不提供时 market.Format 会输出 N/A，而不是让整个上下文构建失败
 	sb.WriteString(fmt.Sprintf("## 候选币种 (%d个)\n\n", len(ctx.MarketDataMap)))
+	sb.WriteString("(Open Interest / Funding Rate 显示为 N/A 表示该数据源未提供，请勿当作 0 解读)\n\n")
 	displayedCount := 0
 	for _, coin := range ctx.CandidateCoins {
 		marketData, hasData := ctx.MarketDataMap[coin.Symbol]
@@ -444,10 +568,12 @@ func buildUserPrompt(ctx *Context) string {
 
 		// 使用FormatMarketData输出完整市场数据
 		sb.WriteString(fmt.Sprintf("### %d. %s%s\n\n", displayedCount, coin.Symbol, sourceTags))
+		sb.WriteString(formatDepthImbalance(ctx.DepthImbalances[coin.Symbol]))
 		sb.WriteString(market.Format(marketData))
 		sb.WriteString("\n")
 	}
 	sb.WriteString("\n")
+	sb.WriteString(formatContextSymbols(ctx))
 
 	// 夏普比率（直接传值，不要复杂格式化）
 	if ctx.Performance != nil {
@@ -469,8 +595,141 @@ func buildUserPrompt(ctx *Context) string {
 	return sb.String()
 }
 
+// formatContextSymbols 生成参考币种的行情（仅用于判断市场方向，不可开仓），没有参考币种或均无数据时为空
+func formatContextSymbols(ctx *Context) string {
+	var sb strings.Builder
+	for _, symbol := range ctx.ContextSymbols {
+		marketData, ok := ctx.MarketDataMap[symbol]
+		if !ok {
+			continue
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("## 参考币种（仅供判断大盘方向，不在候选列表中，禁止对其开仓）\n\n")
+		}
+		sb.WriteString(fmt.Sprintf("### %s（仅参考）\n\n", symbol))
+		sb.WriteString(market.Format(marketData))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// formatPositionCorrelation 生成持仓相关性提示（多空相反的持仓互为对冲，相关系数按方向调整）
+func formatPositionCorrelation(ctx *Context) string {
+	if ctx.CorrelationSummary == nil || len(ctx.Positions) < 2 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## 持仓相关性（4h收益率）\n")
+	for i, a := range ctx.Positions {
+		for _, b := range ctx.Positions[i+1:] {
+			if corr, ok := ctx.Correlations[a.Symbol][b.Symbol]; ok {
+				sb.WriteString(fmt.Sprintf("- %s(%s) / %s(%s): %.2f\n", a.Symbol, strings.ToUpper(a.Side), b.Symbol, strings.ToUpper(b.Side), corr))
+			}
+		}
+	}
+	summary := ctx.CorrelationSummary
+	sb.WriteString(fmt.Sprintf("等效独立持仓 %.1f 个（共 %d 个）| 按方向调整后最大相关: %s / %s %.2f\n",
+		summary.EffectivePositions, len(ctx.Positions), summary.MaxPair[0], summary.MaxPair[1], summary.MaxCorrelation))
+	sb.WriteString("⚠️ 同方向持有高相关币种相当于放大同一笔押注，新开仓请优先考虑低相关或对冲方向\n\n")
+	return sb.String()
+}
+
+// formatPnLBreakdown 格式化持仓的盈亏拆分（扣除资金费和平仓手续费后的实际盈亏），未计算拆分时返回空
+func formatPnLBreakdown(pos PositionInfo) string {
+	if pos.GrossPnL == 0 && pos.FundingCost == 0 && pos.CloseFee == 0 {
+		return ""
+	}
+	return fmt.Sprintf("平仓净盈亏: %+.2f USDT = 价格盈亏%+.2f - 累计资金费%.2f - 预估平仓手续费%.2f\n\n",
+		pos.NetPnL, pos.GrossPnL, pos.FundingCost, pos.CloseFee)
+}
+
+// formatPositionFunding 生成持仓的资金费提示（费率为正时多头支付空头，为负时空头支付多头）
+func formatPositionFunding(side string, data *market.Data) string {
+	if data == nil || (data.FundingRate == 0 && data.NextFundingTime == 0) {
+		return ""
+	}
+
+	pays := (data.FundingRate > 0 && side == "long") || (data.FundingRate < 0 && side == "short")
+	direction := "收取"
+	if pays {
+		direction = "支付"
+	}
+
+	nextFunding := ""
+	if data.NextFundingTime > 0 {
+		minutesLeft := int(time.Until(time.UnixMilli(data.NextFundingTime)).Minutes())
+		if minutesLeft < 0 {
+			minutesLeft = 0
+		}
+		nextFunding = fmt.Sprintf(" | 距下次结算%d分钟", minutesLeft)
+	}
+
+	return fmt.Sprintf("资金费: 当前费率%.4f%%，该%s仓结算时%s资金费%s\n\n",
+		data.FundingRate*100, strings.ToUpper(side), direction, nextFunding)
+}
+
+// formatLeverageTiers 生成杠杆分级提示（未配置时为空），分级优先于系统提示中的两档杠杆限制
+func formatLeverageTiers(tiers map[string]int) string {
+	if len(tiers) == 0 {
+		return ""
+	}
+
+	symbols := make([]string, 0, len(tiers))
+	for symbol := range tiers {
+		if symbol != LeverageTierDefault {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+
+	parts := make([]string, 0, len(tiers))
+	for _, symbol := range symbols {
+		parts = append(parts, fmt.Sprintf("%s %dx", symbol, tiers[symbol]))
+	}
+	if leverage, ok := tiers[LeverageTierDefault]; ok {
+		parts = append(parts, fmt.Sprintf("其他币种 %dx", leverage))
+	}
+	return fmt.Sprintf("杠杆上限（分级，优先于系统提示的两档限制）: %s\n\n", strings.Join(parts, " | "))
+}
+
+// formatMarketRegime 生成市场状态提示（无数据时为空）
+func formatMarketRegime(regime *market.MarketRegime) string {
+	if regime == nil {
+		return ""
+	}
+	var label, hint string
+	switch regime.Regime {
+	case market.RegimeTrend:
+		label, hint = "趋势", "顺势交易为主，避免逆势抄底摸顶"
+	case market.RegimeRange:
+		label, hint = "震荡", "趋势信号可靠性低，谨慎追涨杀跌"
+	case market.RegimeHighVol:
+		label, hint = "极端波动", "止损容易被扫，降低仓位和杠杆"
+	default:
+		return ""
+	}
+	return fmt.Sprintf("市场状态(BTC 4h): %s | ADX %.1f | ATR %.2f%% → %s\n\n", label, regime.ADX, regime.ATRPct, hint)
+}
+
+// formatDepthImbalance 生成盘口买卖比提示（无数据时为空）
+func formatDepthImbalance(imbalance *market.DepthImbalance) string {
+	if imbalance == nil {
+		return ""
+	}
+
+	pressure := "买卖均衡"
+	if imbalance.Ratio >= 1.5 {
+		pressure = "买盘占优"
+	} else if imbalance.Ratio <= 1/1.5 {
+		pressure = "卖盘占优"
+	}
+	return fmt.Sprintf("盘口(±%.2g%%): 买单%.0f / 卖单%.0f USDT | 买卖比%.2f（%s，仅反映短期挂单压力）\n\n",
+		imbalance.BandPct, imbalance.BidNotional, imbalance.AskNotional, imbalance.Ratio, pressure)
+}
+
 // parseFullDecisionResponse 解析AI的完整决策响应
-func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthLeverage, altcoinLeverage int) (*FullDecision, error) {
+func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthLeverage, altcoinLeverage int, leverageTiers map[string]int) (*FullDecision, error) {
 	// 1. 提取思维链
 	cotTrace := extractCoTTrace(aiResponse)
 
@@ -483,17 +742,24 @@ func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthL
 		}, fmt.Errorf("提取决策失败: %w", err)
 	}
 
-	// 3. 验证决策
-	if err := validateDecisions(decisions, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
+	// 3. 检查决策格式版本（缺失或未知版本只告警，按当前版本尽力解析）
+	schemaVersion, schemaWarning := checkSchemaVersion(decisions)
+
+	// 4. 验证决策
+	if err := validateDecisions(decisions, accountEquity, btcEthLeverage, altcoinLeverage, leverageTiers); err != nil {
 		return &FullDecision{
-			CoTTrace:  cotTrace,
-			Decisions: decisions,
+			CoTTrace:      cotTrace,
+			Decisions:     decisions,
+			SchemaVersion: schemaVersion,
+			SchemaWarning: schemaWarning,
 		}, fmt.Errorf("决策验证失败: %w", err)
 	}
 
 	return &FullDecision{
-		CoTTrace:  cotTrace,
-		Decisions: decisions,
+		CoTTrace:      cotTrace,
+		Decisions:     decisions,
+		SchemaVersion: schemaVersion,
+		SchemaWarning: schemaWarning,
 	}, nil
 }
 
@@ -546,6 +812,24 @@ func extractDecisions(response string) ([]Decision, error) {
 	// 修复 jsonPart 中的全角字符
 	jsonPart = fixMissingQuotes(jsonPart)
 
+	// 0) 清洗常见格式问题（代码块、前后缀说明、尾随逗号），能直接得到合法的JSON数组时优先使用
+	if sanitized := sanitizeAIResponse(jsonPart); strings.HasPrefix(sanitized, "[") && json.Valid([]byte(sanitized)) {
+		// 明确输出空数组：解析成功但没有任何决策（由调用方按 hold 处理），不同于解析失败
+		if reEmptyArray.MatchString(sanitized) {
+			log.Printf("✓ AI返回空决策数组")
+			return []Decision{}, nil
+		}
+		jsonContent := compactArrayOpen(sanitized)
+		if err := validateJSONFormat(jsonContent); err != nil {
+			return nil, fmt.Errorf("JSON格式验证失败: %w\nJSON内容: %s\n完整响应:\n%s", err, jsonContent, response)
+		}
+		var decisions []Decision
+		if err := json.Unmarshal([]byte(jsonContent), &decisions); err != nil {
+			return nil, fmt.Errorf("JSON解析失败: %w\nJSON内容: %s", err, jsonContent)
+		}
+		return decisions, nil
+	}
+
 	// 1) 优先从 ```json 代码块中提取
 	if m := reJSONFence.FindStringSubmatch(jsonPart); m != nil && len(m) > 1 {
 		jsonContent := strings.TrimSpace(m[1])
@@ -576,9 +860,10 @@ func extractDecisions(response string) ([]Decision, error) {
 
 		// 生成保底决策：所有币种进入 wait 状态
 		fallbackDecision := Decision{
-			Symbol:    "ALL",
-			Action:    "wait",
-			Reasoning: fmt.Sprintf("模型未输出结构化JSON决策，进入安全等待；摘要：%s", cotSummary),
+			SchemaVersion: DecisionSchemaVersion,
+			Symbol:        "ALL",
+			Action:        "wait",
+			Reasoning:     fmt.Sprintf("模型未输出结构化JSON决策，进入安全等待；摘要：%s", cotSummary),
 		}
 
 		return []Decision{fallbackDecision}, nil
@@ -683,9 +968,9 @@ func compactArrayOpen(s string) string {
 }
 
 // validateDecisions 验证所有决策（需要账户信息和杠杆配置）
-func validateDecisions(decisions []Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
+func validateDecisions(decisions []Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int, leverageTiers map[string]int) error {
 	for i, decision := range decisions {
-		if err := validateDecision(&decision, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
+		if err := validateDecision(&decision, accountEquity, btcEthLeverage, altcoinLeverage, leverageTiers); err != nil {
 			return fmt.Errorf("决策 #%d 验证失败: %w", i+1, err)
 		}
 	}
@@ -715,31 +1000,18 @@ func findMatchingBracket(s string, start int) int {
 }
 
 // validateDecision 验证单个决策的有效性
-func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
+func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int, leverageTiers map[string]int) error {
 	// 验证action
-	validActions := map[string]bool{
-		"open_long":          true,
-		"open_short":         true,
-		"close_long":         true,
-		"close_short":        true,
-		"update_stop_loss":   true,
-		"update_take_profit": true,
-		"partial_close":      true,
-		"hold":               true,
-		"wait":               true,
-	}
-
 	if !validActions[d.Action] {
 		return fmt.Errorf("无效的action: %s", d.Action)
 	}
 
 	// 开仓操作必须提供完整参数
 	if d.Action == "open_long" || d.Action == "open_short" {
-		// 根据币种使用配置的杠杆上限
-		maxLeverage := altcoinLeverage          // 山寨币使用配置的杠杆
+		// 根据币种使用配置的杠杆上限（配置了杠杆分级时按分级）
+		maxLeverage := ResolveLeverage(d.Symbol, leverageTiers, btcEthLeverage, altcoinLeverage)
 		maxPositionValue := accountEquity * 1.5 // 山寨币最多1.5倍账户净值
 		if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-			maxLeverage = btcEthLeverage          // BTC和ETH使用配置的杠杆
 			maxPositionValue = accountEquity * 10 // BTC/ETH最多10倍账户净值
 		}
 
@@ -752,32 +1024,39 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 				d.Symbol, d.Leverage, maxLeverage, maxLeverage)
 			d.Leverage = maxLeverage // 自动修正为上限值
 		}
-		if d.PositionSizeUSD <= 0 {
-			return fmt.Errorf("仓位大小必须大于0: %.2f", d.PositionSizeUSD)
+		if d.RiskPercent < 0 || d.RiskPercent > MaxRiskPercent {
+			return fmt.Errorf("risk_percent 必须在 0-%.0f 之间: %.2f", MaxRiskPercent, d.RiskPercent)
 		}
 
-		// ✅ 验证最小开仓金额（防止数量格式化为 0 的错误）
-		// Binance 最小名义价值 10 USDT + 安全边际
-		const minPositionSizeGeneral = 12.0 // 10 + 20% 安全边际
-		const minPositionSizeBTCETH = 60.0  // BTC/ETH 因价格高和精度限制需要更大金额（更灵活）
-
-		if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-			if d.PositionSizeUSD < minPositionSizeBTCETH {
-				return fmt.Errorf("%s 开仓金额过小(%.2f USDT)，必须≥%.2f USDT（因价格高且精度限制，避免数量四舍五入为0）", d.Symbol, d.PositionSizeUSD, minPositionSizeBTCETH)
-			}
-		} else {
-			if d.PositionSizeUSD < minPositionSizeGeneral {
-				return fmt.Errorf("开仓金额过小(%.2f USDT)，必须≥%.2f USDT（Binance 最小名义价值要求）", d.PositionSizeUSD, minPositionSizeGeneral)
+		// 提供 risk_percent 时仓位由执行器按止损距离计算，忽略 position_size_usd
+		if d.RiskPercent == 0 {
+			if d.PositionSizeUSD <= 0 {
+				return fmt.Errorf("仓位大小必须大于0: %.2f", d.PositionSizeUSD)
 			}
-		}
 
-		// 验证仓位价值上限（加1%容差以避免浮点数精度问题）
-		tolerance := maxPositionValue * 0.01 // 1%容差
-		if d.PositionSizeUSD > maxPositionValue+tolerance {
+			// ✅ 验证最小开仓金额（防止数量格式化为 0 的错误）
+			// Binance 最小名义价值 10 USDT + 安全边际
+			const minPositionSizeGeneral = 12.0 // 10 + 20% 安全边际
+			const minPositionSizeBTCETH = 60.0  // BTC/ETH 因价格高和精度限制需要更大金额（更灵活）
+
 			if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-				return fmt.Errorf("BTC/ETH单币种仓位价值不能超过%.0f USDT（10倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
+				if d.PositionSizeUSD < minPositionSizeBTCETH {
+					return fmt.Errorf("%s 开仓金额过小(%.2f USDT)，必须≥%.2f USDT（因价格高且精度限制，避免数量四舍五入为0）", d.Symbol, d.PositionSizeUSD, minPositionSizeBTCETH)
+				}
 			} else {
-				return fmt.Errorf("山寨币单币种仓位价值不能超过%.0f USDT（1.5倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
+				if d.PositionSizeUSD < minPositionSizeGeneral {
+					return fmt.Errorf("开仓金额过小(%.2f USDT)，必须≥%.2f USDT（Binance 最小名义价值要求）", d.PositionSizeUSD, minPositionSizeGeneral)
+				}
+			}
+
+			// 验证仓位价值上限（加1%容差以避免浮点数精度问题）
+			tolerance := maxPositionValue * 0.01 // 1%容差
+			if d.PositionSizeUSD > maxPositionValue+tolerance {
+				if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
+					return fmt.Errorf("BTC/ETH单币种仓位价值不能超过%.0f USDT（10倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
+				} else {
+					return fmt.Errorf("山寨币单币种仓位价值不能超过%.0f USDT（1.5倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
+				}
 			}
 		}
 		if d.StopLoss <= 0 || d.TakeProfit <= 0 {
@@ -795,6 +1074,13 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 			}
 		}
 
+		// 分批止盈：价格必须位于止损的盈利一侧（下单时还会对照当前标记价格再校验一次）
+		if len(d.TakeProfitLadder) > 0 {
+			if err := ValidateTakeProfitLadder(d.TakeProfitLadder, d.Action == "open_long", d.StopLoss); err != nil {
+				return err
+			}
+		}
+
 		// 验证风险回报比（必须≥1:3）
 		// 计算入场价（假设当前市价）
 		var entryPrice float64
@@ -828,6 +1114,13 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		}
 	}
 
+	// 加仓验证（持仓是否存在由执行器检查）
+	if d.Action == "add_position" || d.Action == "add_short" {
+		if d.PositionSizeUSD <= 0 {
+			return fmt.Errorf("加仓金额必须大于0: %.2f", d.PositionSizeUSD)
+		}
+	}
+
 	// 动态调整止损验证
 	if d.Action == "update_stop_loss" {
 		if d.NewStopLoss <= 0 {
@@ -844,8 +1137,8 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 
 	// 部分平仓验证
 	if d.Action == "partial_close" {
-		if d.ClosePercentage <= 0 || d.ClosePercentage > 100 {
-			return fmt.Errorf("平仓百分比必须在0-100之间: %.1f", d.ClosePercentage)
+		if err := validateCloseAmount(d); err != nil {
+			return err
 		}
 	}
 
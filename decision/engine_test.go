@@ -0,0 +1,56 @@
+package decision
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"nofx/market"
+	"nofx/pool"
+
+	"github.com/agiledragon/gomonkey/v2"
+)
+
+// TestFetchMarketDataForContext_SkipsFailedSymbol 测试单个币种行情获取失败时跳过该币种，其余币种照常填充
+func TestFetchMarketDataForContext_SkipsFailedSymbol(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	failing := map[string]bool{"ETHUSDT": true}
+	patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		if failing[symbol] {
+			return nil, errors.New(symbol + " data is stale")
+		}
+		return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+	})
+	patches.ApplyFunc(pool.GetOITopPositions, func() ([]pool.OIPosition, error) {
+		return nil, errors.New("unavailable")
+	})
+
+	ctx := &Context{
+		Positions:      []PositionInfo{{Symbol: "BTCUSDT", Side: "long"}},
+		CandidateCoins: []CandidateCoin{{Symbol: "ETHUSDT"}, {Symbol: "SOLUSDT"}},
+	}
+	if err := fetchMarketDataForContext(ctx); err != nil {
+		t.Fatalf("单个币种失败不应中止: %v", err)
+	}
+	for _, symbol := range []string{"BTCUSDT", "SOLUSDT"} {
+		if ctx.MarketDataMap[symbol] == nil {
+			t.Errorf("%s 应有行情数据", symbol)
+		}
+	}
+	if _, ok := ctx.MarketDataMap["ETHUSDT"]; ok {
+		t.Error("获取失败的币种不应出现在 MarketDataMap 中")
+	}
+	if len(ctx.SkippedSymbols) != 1 || ctx.SkippedSymbols[0] != "ETHUSDT" {
+		t.Errorf("SkippedSymbols = %v, want [ETHUSDT]", ctx.SkippedSymbols)
+	}
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "行情获取失败，缺少数据") || !strings.Contains(prompt, "ETHUSDT") {
+		t.Error("user prompt 应列出缺少数据的币种")
+	}
+
+	// 全部失败时返回错误
+	failing["BTCUSDT"], failing["SOLUSDT"] = true, true
+	if err := fetchMarketDataForContext(ctx); err == nil {
+		t.Error("全部币种失败时应返回错误")
+	}
+}
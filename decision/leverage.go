@@ -0,0 +1,22 @@
+package decision
+
+import "strings"
+
+// LeverageTierDefault 杠杆分级中匹配其余币种的键
+const LeverageTierDefault = "default"
+
+// ResolveLeverage 返回币种的杠杆上限：杠杆分级中精确匹配的币种优先，其次是分级的 default，
+// 都没有（或未配置分级）时回退到 BTC/ETH 与山寨币两档
+func ResolveLeverage(symbol string, tiers map[string]int, btcEthLeverage, altcoinLeverage int) int {
+	symbol = strings.ToUpper(symbol)
+	if leverage, ok := tiers[symbol]; ok && leverage > 0 {
+		return leverage
+	}
+	if leverage, ok := tiers[LeverageTierDefault]; ok && leverage > 0 {
+		return leverage
+	}
+	if symbol == "BTCUSDT" || symbol == "ETHUSDT" {
+		return btcEthLeverage
+	}
+	return altcoinLeverage
+}
@@ -0,0 +1,32 @@
+package decision
+
+import "testing"
+
+// TestResolveLeverage 测试杠杆分级优先、default 兜底、未匹配时回退到两档杠杆
+func TestResolveLeverage(t *testing.T) {
+	tiers := map[string]int{"BTCUSDT": 10, "SOLUSDT": 5, "default": 3}
+
+	tests := []struct {
+		name   string
+		symbol string
+		tiers  map[string]int
+		want   int
+	}{
+		{name: "精确匹配", symbol: "SOLUSDT", tiers: tiers, want: 5},
+		{name: "大小写不敏感", symbol: "btcusdt", tiers: tiers, want: 10},
+		{name: "default兜底_覆盖BTC/ETH档", symbol: "ETHUSDT", tiers: tiers, want: 3},
+		{name: "default兜底_长尾币", symbol: "PEPEUSDT", tiers: tiers, want: 3},
+		{name: "未配置default_BTC/ETH回退", symbol: "ETHUSDT", tiers: map[string]int{"SOLUSDT": 5}, want: 20},
+		{name: "未配置default_山寨币回退", symbol: "PEPEUSDT", tiers: map[string]int{"SOLUSDT": 5}, want: 8},
+		{name: "非正数分级忽略", symbol: "SOLUSDT", tiers: map[string]int{"SOLUSDT": 0}, want: 8},
+		{name: "未配置分级", symbol: "BTCUSDT", tiers: nil, want: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveLeverage(tt.symbol, tt.tiers, 20, 8); got != tt.want {
+				t.Errorf("ResolveLeverage(%s) = %d, want %d", tt.symbol, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -15,9 +16,13 @@ type PromptTemplate struct {
 	Content string // 模板内容
 }
 
-// PromptManager 提示词管理器
+// PromptBuilder 根据交易上下文生成模板内容（代码内注册的模板使用）
+type PromptBuilder func(ctx *Context) string
+
+// PromptManager 提示词管理器（模板注册表：prompts 目录下的文件模板 + 代码内注册的模板）
 type PromptManager struct {
 	templates map[string]*PromptTemplate
+	builders  map[string]PromptBuilder
 	mu        sync.RWMutex
 }
 
@@ -31,6 +36,10 @@ var (
 // init 包初始化时加载所有提示词模板
 func init() {
 	globalPromptManager = NewPromptManager()
+	// 内置简化版 default 模板：prompts 目录缺失或没有 default.txt 时兜底
+	globalPromptManager.Register("default", func(*Context) string {
+		return "你是专业的加密货币交易AI。请根据市场数据做出交易决策。"
+	})
 	if err := globalPromptManager.LoadTemplates(promptsDir); err != nil {
 		log.Printf("⚠️  加载提示词模板失败: %v", err)
 	} else {
@@ -42,7 +51,32 @@ func init() {
 func NewPromptManager() *PromptManager {
 	return &PromptManager{
 		templates: make(map[string]*PromptTemplate),
+		builders:  make(map[string]PromptBuilder),
+	}
+}
+
+// Register 注册代码内置的提示词模板（与文件模板同名时优先使用文件模板，重新加载文件模板不影响已注册的模板）
+func (pm *PromptManager) Register(name string, builder PromptBuilder) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.builders[name] = builder
+}
+
+// Get 获取指定名称模板的生成函数（文件模板返回固定内容），名称未注册时返回错误
+func (pm *PromptManager) Get(name string) (PromptBuilder, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	if template, exists := pm.templates[name]; exists {
+		content := template.Content
+		return func(*Context) string { return content }, nil
+	}
+	if builder, exists := pm.builders[name]; exists {
+		return builder, nil
 	}
+
+	return nil, fmt.Errorf("未知的提示词模板: %q（可用模板: %s）", name, strings.Join(pm.names(), ", "))
 }
 
 // LoadTemplates 从指定目录加载所有提示词模板
@@ -104,15 +138,26 @@ func (pm *PromptManager) GetTemplate(name string) (*PromptTemplate, error) {
 	return template, nil
 }
 
-// GetAllTemplateNames 获取所有模板名称列表
+// GetAllTemplateNames 获取所有模板名称列表（文件模板 + 内置模板，按名称排序）
 func (pm *PromptManager) GetAllTemplateNames() []string {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
 
-	names := make([]string, 0, len(pm.templates))
+	return pm.names()
+}
+
+// names 所有模板名称（调用方需持有锁）
+func (pm *PromptManager) names() []string {
+	names := make([]string, 0, len(pm.templates)+len(pm.builders))
 	for name := range pm.templates {
 		names = append(names, name)
 	}
+	for name := range pm.builders {
+		if _, exists := pm.templates[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
 
 	return names
 }
@@ -146,6 +191,17 @@ func GetPromptTemplate(name string) (*PromptTemplate, error) {
 	return globalPromptManager.GetTemplate(name)
 }
 
+// RegisterPromptTemplate 注册代码内置的提示词模板（全局函数）
+func RegisterPromptTemplate(name string, builder PromptBuilder) {
+	globalPromptManager.Register(name, builder)
+}
+
+// ValidatePromptTemplate 校验模板名称是否已注册，未知名称（如拼写错误）返回错误（全局函数）
+func ValidatePromptTemplate(name string) error {
+	_, err := globalPromptManager.Get(name)
+	return err
+}
+
 // GetAllPromptTemplateNames 获取所有模板名称（全局函数）
 func GetAllPromptTemplateNames() []string {
 	return globalPromptManager.GetAllTemplateNames()
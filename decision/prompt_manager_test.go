@@ -1,8 +1,11 @@
 package decision
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -250,6 +253,47 @@ func TestPromptManager_GetAllTemplateNames(t *testing.T) {
 	}
 }
 
+func TestPromptManager_Registry(t *testing.T) {
+	pm := NewPromptManager()
+	pm.templates = map[string]*PromptTemplate{
+		"default": {Name: "default", Content: "默认策略"},
+		"nof1":    {Name: "nof1", Content: "nof1策略"},
+	}
+	pm.Register("dynamic", func(ctx *Context) string {
+		return fmt.Sprintf("净值 %.0f", ctx.Account.TotalEquity)
+	})
+	pm.Register("default", func(*Context) string { return "内置策略" }) // 同名时文件模板优先
+
+	// 已知模板列表：文件模板 + 内置模板，按名称排序
+	if names := pm.GetAllTemplateNames(); !reflect.DeepEqual(names, []string{"default", "dynamic", "nof1"}) {
+		t.Errorf("GetAllTemplateNames() = %v", names)
+	}
+
+	ctx := &Context{Account: AccountInfo{TotalEquity: 1000}}
+	for name, want := range map[string]string{"default": "默认策略", "nof1": "nof1策略", "dynamic": "净值 1000"} {
+		builder, err := pm.Get(name)
+		if err != nil {
+			t.Errorf("Get(%q) error: %v", name, err)
+			continue
+		}
+		if got := builder(ctx); got != want {
+			t.Errorf("Get(%q) 生成内容 = %q, 期望 %q", name, got, want)
+		}
+	}
+
+	// 未知名称（拼写错误）被拒绝，错误信息列出可用模板
+	for _, name := range []string{"defualt", "adaptive", ""} {
+		_, err := pm.Get(name)
+		if err == nil {
+			t.Errorf("Get(%q) 应返回错误", name)
+			continue
+		}
+		if !strings.Contains(err.Error(), "default, dynamic, nof1") {
+			t.Errorf("错误信息应列出可用模板: %v", err)
+		}
+	}
+}
+
 func TestReloadPromptTemplates_GlobalFunction(t *testing.T) {
 	// 保存原始的 promptsDir
 	originalDir := promptsDir
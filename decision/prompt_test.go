@@ -1,6 +1,7 @@
 package decision
 
 import (
+	"nofx/market"
 	"strings"
 	"testing"
 )
@@ -48,3 +49,51 @@ func TestBuildSystemPrompt_ActionListCompleteness(t *testing.T) {
 		}
 	}
 }
+
+// TestBuildUserPrompt_PnLBreakdown 测试持仓的盈亏拆分写入 User Prompt，未计算拆分时不输出
+func TestBuildUserPrompt_PnLBreakdown(t *testing.T) {
+	ctx := &Context{
+		Account: AccountInfo{TotalEquity: 1000, AvailableBalance: 500},
+		Positions: []PositionInfo{
+			{Symbol: "BTCUSDT", Side: "long", EntryPrice: 50000, MarkPrice: 51000, Quantity: 0.1, Leverage: 10,
+				GrossPnL: 100, FundingCost: 2, CloseFee: 2.04, NetPnL: 95.96},
+			{Symbol: "ETHUSDT", Side: "short", EntryPrice: 3000, MarkPrice: 3000, Quantity: 1, Leverage: 5},
+		},
+	}
+	prompt := buildUserPrompt(ctx)
+	want := "平仓净盈亏: +95.96 USDT = 价格盈亏+100.00 - 累计资金费2.00 - 预估平仓手续费2.04"
+	if !strings.Contains(prompt, want) {
+		t.Errorf("User Prompt 缺少盈亏拆分 %q", want)
+	}
+	if strings.Count(prompt, "平仓净盈亏") != 1 {
+		t.Errorf("未计算拆分的持仓不应输出盈亏拆分")
+	}
+}
+
+// TestBuildUserPrompt_ContextSymbols 参考币种单独列出并标注禁止开仓，无行情的参考币种不输出
+func TestBuildUserPrompt_ContextSymbols(t *testing.T) {
+	ctx := &Context{
+		Account:        AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		CandidateCoins: []CandidateCoin{{Symbol: "SOLUSDT", Sources: []string{"custom"}}},
+		ContextSymbols: []string{"BTCUSDT", "ETHUSDT"},
+		MarketDataMap: map[string]*market.Data{
+			"SOLUSDT": {Symbol: "SOLUSDT", CurrentPrice: 150},
+			"BTCUSDT": {Symbol: "BTCUSDT", CurrentPrice: 60000},
+		},
+	}
+	prompt := buildUserPrompt(ctx)
+	if !strings.Contains(prompt, "禁止对其开仓") || !strings.Contains(prompt, "### BTCUSDT（仅参考）") {
+		t.Errorf("User Prompt 应单独列出参考币种 BTCUSDT")
+	}
+	if strings.Contains(prompt, "ETHUSDT（仅参考）") {
+		t.Errorf("无行情的参考币种不应输出")
+	}
+	if strings.Index(prompt, "### 1. SOLUSDT") > strings.Index(prompt, "参考币种") {
+		t.Errorf("参考币种应列在候选币种之后")
+	}
+
+	ctx.ContextSymbols = nil
+	if strings.Contains(buildUserPrompt(ctx), "参考币种") {
+		t.Errorf("未配置参考币种时不应输出参考币种段落")
+	}
+}
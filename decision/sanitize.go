@@ -0,0 +1,140 @@
+package decision
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// reCodeFence markdown 代码块标记（```json / ``` 等）
+var reCodeFence = regexp.MustCompile("```[a-zA-Z]*")
+
+// sanitizeAIResponse 修复AI响应中常见的JSON格式问题，返回可直接解析的JSON：
+//  1. 去掉 ```json 代码块标记（包括嵌套/重复包裹）
+//  2. 提取最外层平衡的 {...} 或 [...]，丢弃 "Here is..." 之类的前缀和尾部说明
+//  3. 去掉对象/数组末尾多余的逗号
+//
+// 优先返回包含对象的JSON（决策数组/对象），避免把思维链里的 "[30]" 之类误当作决策；
+// 找不到可解析的JSON时原样返回，让调用方的错误信息保持有意义
+func sanitizeAIResponse(raw string) string {
+	s := reCodeFence.ReplaceAllString(raw, "")
+
+	var fallback string
+	for start := 0; start < len(s); start++ {
+		if s[start] != '[' && s[start] != '{' {
+			continue
+		}
+
+		end := findBalancedEnd(s, start)
+		if end < 0 {
+			continue
+		}
+
+		candidate := removeTrailingCommas(s[start : end+1])
+		if !json.Valid([]byte(candidate)) {
+			continue
+		}
+		if containsObject(candidate) {
+			return candidate
+		}
+		if fallback == "" {
+			fallback = candidate
+		}
+		start = end // 跳过已识别的非对象JSON（如 [30]），继续向后查找
+	}
+
+	if fallback != "" {
+		return fallback
+	}
+	return raw
+}
+
+// findBalancedEnd 从 start 处的 [ 或 { 开始查找与之平衡的结束括号位置（忽略字符串内的括号），找不到返回 -1
+func findBalancedEnd(s string, start int) int {
+	var stack []byte
+	inString := false
+	escaped := false
+
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '[', '{':
+			stack = append(stack, c)
+		case ']', '}':
+			if len(stack) == 0 {
+				return -1
+			}
+			open := stack[len(stack)-1]
+			if (c == ']' && open != '[') || (c == '}' && open != '{') {
+				return -1
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// removeTrailingCommas 去掉 ] 或 } 前多余的逗号（忽略字符串内的内容）
+func removeTrailingCommas(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+	inString := false
+	escaped := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			sb.WriteByte(c)
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+		}
+		if c == ',' {
+			j := i + 1
+			for j < len(s) && strings.ContainsRune(" \t\r\n", rune(s[j])) {
+				j++
+			}
+			if j < len(s) && (s[j] == ']' || s[j] == '}') {
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// containsObject JSON 本身是对象，或是以对象开头的数组
+func containsObject(s string) bool {
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "{") {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(trimmed, "[")), "{")
+}
@@ -0,0 +1,144 @@
+package decision
+
+import (
+	"testing"
+)
+
+func TestSanitizeAIResponse(t *testing.T) {
+	const clean = `[{"symbol": "BTCUSDT", "action": "wait"}]`
+
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			name: "已是合法JSON",
+			raw:  clean,
+			want: clean,
+		},
+		{
+			name: "json代码块包裹",
+			raw:  "```json\n" + clean + "\n```",
+			want: clean,
+		},
+		{
+			name: "无语言标记的代码块",
+			raw:  "```\n" + clean + "\n```",
+			want: clean,
+		},
+		{
+			name: "代码块重复包裹",
+			raw:  "```json\n```json\n" + clean + "\n```\n```",
+			want: clean,
+		},
+		{
+			name: "Here is 前缀和尾部说明",
+			raw:  "Here is my decision:\n" + clean + "\nLet me know if you need anything else.",
+			want: clean,
+		},
+		{
+			name: "中文前缀且说明里带方括号",
+			raw:  "根据分析 [4h趋势向上]，RSI [30] 偏低，决策如下：\n```json\n" + clean + "\n```\n以上。",
+			want: clean,
+		},
+		{
+			name: "尾随逗号",
+			raw:  "[\n  {\"symbol\": \"BTCUSDT\", \"action\": \"wait\",},\n]",
+			want: "[\n  {\"symbol\": \"BTCUSDT\", \"action\": \"wait\"}\n]",
+		},
+		{
+			name: "字符串中的逗号和括号不受影响",
+			raw:  "Sure! [{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"区间 [a, ] 震荡, }\"},]",
+			want: "[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"区间 [a, ] 震荡, }\"}]",
+		},
+		{
+			name: "字符串中的转义引号",
+			raw:  "```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"say \\\"hi\\\" ]\"}]\n```",
+			want: "[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"say \\\"hi\\\" ]\"}]",
+		},
+		{
+			name: "嵌套数组（分批止盈）",
+			raw:  "ok\n[{\"symbol\": \"ETHUSDT\", \"action\": \"open_long\", \"take_profit_levels\": [{\"price\": 3100, \"ratio\": 0.5}, {\"price\": 3200, \"ratio\": 0.5},]}]\ndone",
+			want: "[{\"symbol\": \"ETHUSDT\", \"action\": \"open_long\", \"take_profit_levels\": [{\"price\": 3100, \"ratio\": 0.5}, {\"price\": 3200, \"ratio\": 0.5}]}]",
+		},
+		{
+			name: "单个对象",
+			raw:  "Here is the JSON: {\"symbol\": \"BTCUSDT\", \"action\": \"wait\"} thanks",
+			want: `{"symbol": "BTCUSDT", "action": "wait"}`,
+		},
+		{
+			name: "只有非对象JSON时返回它",
+			raw:  "levels: [1, 2, 3]",
+			want: "[1, 2, 3]",
+		},
+		{
+			name: "没有JSON时返回原文",
+			raw:  "市场震荡，继续观望。",
+			want: "市场震荡，继续观望。",
+		},
+		{
+			name: "括号不平衡时返回原文",
+			raw:  "```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\"\n```",
+			want: "```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\"\n```",
+		},
+		{
+			name: "数值范围等非法内容时返回原文",
+			raw:  "[{\"symbol\": \"BTCUSDT\", \"stop_loss\": 95000~96000}]",
+			want: "[{\"symbol\": \"BTCUSDT\", \"stop_loss\": 95000~96000}]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeAIResponse(tt.raw); got != tt.want {
+				t.Errorf("sanitizeAIResponse() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtractDecisions_SanitizedResponses 测试清洗后的响应能被决策解析器正确解析
+func TestExtractDecisions_SanitizedResponses(t *testing.T) {
+	responses := map[string]string{
+		"尾随逗号":  "<decision>\n```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"r\"},]\n```\n</decision>",
+		"尾部说明":  "<decision>\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"r\"}]\n以上为最终决策。\n</decision>",
+		"嵌套数组":  "<decision>\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"r\", \"take_profit_levels\": [{\"price\": 1}]}, {\"symbol\": \"ETHUSDT\", \"action\": \"wait\", \"reasoning\": \"r\"}]\n</decision>",
+		"无标签前缀": "Here is my decision:\n```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"r\"}, {\"symbol\": \"ETHUSDT\", \"action\": \"wait\", \"reasoning\": \"r\"},]\n```",
+	}
+
+	for name, response := range responses {
+		t.Run(name, func(t *testing.T) {
+			decisions, err := extractDecisions(response)
+			if err != nil {
+				t.Fatalf("extractDecisions 失败: %v", err)
+			}
+			if len(decisions) == 0 || decisions[0].Symbol != "BTCUSDT" {
+				t.Errorf("decisions = %+v", decisions)
+			}
+			if name == "嵌套数组" || name == "无标签前缀" {
+				if len(decisions) != 2 {
+					t.Errorf("应解析出 2 个决策, got %d", len(decisions))
+				}
+			}
+		})
+	}
+}
+
+// TestExtractDecisions_EmptyArray 测试明确输出空数组时解析成功、没有决策（由交易员按 hold 处理）
+func TestExtractDecisions_EmptyArray(t *testing.T) {
+	for name, response := range map[string]string{
+		"代码块": "<reasoning>观望</reasoning>\n<decision>\n```json\n[]\n```\n</decision>",
+		"含空白": "<decision>[ \n ]</decision>",
+	} {
+		t.Run(name, func(t *testing.T) {
+			decisions, err := extractDecisions(response)
+			if err != nil {
+				t.Fatalf("空数组不应解析失败: %v", err)
+			}
+			if decisions == nil || len(decisions) != 0 {
+				t.Errorf("应返回空决策列表, got %+v", decisions)
+			}
+		})
+	}
+}
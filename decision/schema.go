@@ -0,0 +1,61 @@
+package decision
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// DecisionSchemaVersion 当前的决策格式版本，prompt 要求AI在每个决策中输出，解析时校验
+// ⚠️ Decision 的字段或动作（含语义）变化时必须递增，旧prompt的输出才不会被新解析器悄悄误读
+const DecisionSchemaVersion = 1
+
+// checkSchemaVersion 检查AI输出的决策格式版本，返回输出的版本和告警（版本一致时告警为空）
+// 缺失版本（旧prompt/自定义prompt未要求）或未知版本时只记录告警，仍按当前版本尽力解析：
+// 未识别的字段被忽略，未知动作在随后的决策验证中拒绝，不会被当作其他动作执行
+func checkSchemaVersion(decisions []Decision) (int, string) {
+	if len(decisions) == 0 {
+		return 0, ""
+	}
+
+	missing := 0
+	seen := make(map[int]bool)
+	for _, d := range decisions {
+		if d.SchemaVersion == 0 {
+			missing++
+			continue
+		}
+		seen[d.SchemaVersion] = true
+	}
+
+	versions := make([]int, 0, len(seen))
+	for v := range seen {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	version := 0
+	if len(versions) > 0 {
+		version = versions[len(versions)-1]
+	}
+
+	var problems []string
+	if missing > 0 {
+		problems = append(problems, fmt.Sprintf("%d/%d 个决策缺少 schema_version", missing, len(decisions)))
+	}
+	for _, v := range versions {
+		switch {
+		case v > DecisionSchemaVersion:
+			problems = append(problems, fmt.Sprintf("schema_version %d 高于当前支持的版本，新版本新增的字段将被忽略", v))
+		case v != DecisionSchemaVersion:
+			problems = append(problems, fmt.Sprintf("schema_version %d 已过期", v))
+		}
+	}
+	if len(problems) == 0 {
+		return version, ""
+	}
+
+	warning := fmt.Sprintf("决策格式版本不匹配（当前 v%d）: %s，按当前版本尽力解析", DecisionSchemaVersion, strings.Join(problems, "；"))
+	log.Printf("⚠️  %s", warning)
+	return version, warning
+}
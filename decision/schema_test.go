@@ -0,0 +1,110 @@
+package decision
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestParseResponse_SchemaVersion 测试决策格式版本：缺失或未知版本时告警并尽力解析，不静默误读
+func TestParseResponse_SchemaVersion(t *testing.T) {
+	cfg := ValidationConfig{BTCETHLeverage: 10, AltcoinLeverage: 5}
+	wrap := func(decisionJSON string) string {
+		return "<reasoning>分析</reasoning>\n<decision>\n```json\n" + decisionJSON + "\n```\n</decision>"
+	}
+
+	tests := []struct {
+		name        string
+		response    string
+		wantVersion int
+		wantWarning []string // 告警应包含的片段（为空表示不应告警）
+		wantErr     string
+		wantActions []string
+	}{
+		{
+			name:        "当前版本",
+			response:    wrap(`[{"schema_version": 1, "symbol": "ETHUSDT", "action": "close_long", "reasoning": "止盈"}]`),
+			wantVersion: 1,
+			wantActions: []string{"close_long"},
+		},
+		{
+			name:        "缺少版本_按当前版本解析",
+			response:    wrap(`[{"symbol": "ETHUSDT", "action": "close_long", "reasoning": "止盈"}, {"symbol": "BTCUSDT", "action": "hold", "reasoning": "持有"}]`),
+			wantWarning: []string{"2/2 个决策缺少 schema_version"},
+			wantActions: []string{"close_long", "hold"},
+		},
+		{
+			name:        "未来版本_忽略新增字段",
+			response:    wrap(`[{"schema_version": 2, "symbol": "ETHUSDT", "action": "partial_close", "close_percentage": 30, "close_basis": "notional", "reasoning": "减仓"}]`),
+			wantVersion: 2,
+			wantWarning: []string{"schema_version 2 高于当前支持的版本"},
+			wantActions: []string{"partial_close"},
+		},
+		{
+			name:        "未来版本_未知动作被拒绝",
+			response:    wrap(`[{"schema_version": 2, "symbol": "ETHUSDT", "action": "open_long_twap", "reasoning": "分批开仓"}]`),
+			wantVersion: 2,
+			wantWarning: []string{"schema_version 2 高于当前支持的版本"},
+			wantErr:     "无效的action",
+		},
+		{
+			name:        "部分决策缺少版本",
+			response:    wrap(`[{"schema_version": 1, "symbol": "ETHUSDT", "action": "close_long", "reasoning": "止盈"}, {"symbol": "BTCUSDT", "action": "wait", "reasoning": "观望"}]`),
+			wantVersion: 1,
+			wantWarning: []string{"1/2 个决策缺少 schema_version"},
+			wantActions: []string{"close_long", "wait"},
+		},
+		{
+			name:        "未输出JSON_保底决策不告警",
+			response:    "<reasoning>行情不明朗</reasoning>",
+			wantVersion: DecisionSchemaVersion,
+			wantActions: []string{"wait"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd, err := ParseResponse(tt.response, 1000, cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("期望错误包含 %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("不应返回错误: %v", err)
+			}
+			if fd == nil {
+				t.Fatal("FullDecision 不应为 nil")
+			}
+			if fd.SchemaVersion != tt.wantVersion {
+				t.Errorf("SchemaVersion = %d, want %d", fd.SchemaVersion, tt.wantVersion)
+			}
+			if len(tt.wantWarning) == 0 && fd.SchemaWarning != "" {
+				t.Errorf("不应告警: %s", fd.SchemaWarning)
+			}
+			for _, want := range tt.wantWarning {
+				if !strings.Contains(fd.SchemaWarning, want) {
+					t.Errorf("告警缺少 %q: %q", want, fd.SchemaWarning)
+				}
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			if len(fd.Decisions) != len(tt.wantActions) {
+				t.Fatalf("决策数量 = %d, want %d", len(fd.Decisions), len(tt.wantActions))
+			}
+			for i, action := range tt.wantActions {
+				if fd.Decisions[i].Action != action {
+					t.Errorf("决策[%d].Action = %s, want %s", i, fd.Decisions[i].Action, action)
+				}
+			}
+		})
+	}
+}
+
+// TestBuildSystemPrompt_RequestsSchemaVersion 测试系统提示词要求输出当前的决策格式版本
+func TestBuildSystemPrompt_RequestsSchemaVersion(t *testing.T) {
+	prompt := buildSystemPrompt(1000, 10, 5, "default")
+	if !strings.Contains(prompt, fmt.Sprintf(`"schema_version": %d`, DecisionSchemaVersion)) || !strings.Contains(prompt, "`schema_version`") {
+		t.Errorf("系统提示词应要求输出 schema_version")
+	}
+}
@@ -0,0 +1,100 @@
+package decision
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// validActions AI可输出的全部决策动作
+var validActions = map[string]bool{
+	"open_long":          true,
+	"open_short":         true,
+	"add_position":       true,
+	"add_short":          true,
+	"close_long":         true,
+	"close_short":        true,
+	"update_stop_loss":   true,
+	"update_take_profit": true,
+	"partial_close":      true,
+	"hold":               true,
+	"wait":               true,
+}
+
+// ValidationConfig 执行前校验决策所需的交易员配置
+type ValidationConfig struct {
+	BTCETHLeverage  int            // BTC/ETH 杠杆上限
+	AltcoinLeverage int            // 山寨币杠杆上限
+	LeverageTiers   map[string]int // 杠杆分级（币种 -> 杠杆上限），配置后优先于两档
+}
+
+// Validate 执行前检查决策字段是否完整、取值是否合法（不修改决策）：
+// 动作在已知集合内、币种非空、开仓/加仓金额为正、杠杆不超过配置上限、止损止盈位于正确一侧、
+// 部分平仓百分比在 (0,100] 内。与解析时的校验不同，这里只做结构性检查，不涉及风险回报比和账户净值
+func (d *Decision) Validate(cfg ValidationConfig) error {
+	if !validActions[d.Action] {
+		return fmt.Errorf("无效的action: %q", d.Action)
+	}
+	if d.Action == "hold" || d.Action == "wait" {
+		return nil
+	}
+	if strings.TrimSpace(d.Symbol) == "" {
+		return errors.New("缺少币种")
+	}
+
+	switch d.Action {
+	case "open_long", "open_short":
+		if d.RiskPercent < 0 || d.RiskPercent > MaxRiskPercent {
+			return fmt.Errorf("risk_percent 必须在 0-%.0f 之间: %.2f", MaxRiskPercent, d.RiskPercent)
+		}
+		if d.RiskPercent == 0 && d.PositionSizeUSD <= 0 {
+			return fmt.Errorf("仓位大小必须大于0: %.2f", d.PositionSizeUSD)
+		}
+		if d.Leverage < 0 {
+			return fmt.Errorf("杠杆不能为负数: %d", d.Leverage)
+		}
+		if maxLeverage := ResolveLeverage(d.Symbol, cfg.LeverageTiers, cfg.BTCETHLeverage, cfg.AltcoinLeverage); maxLeverage > 0 && d.Leverage > maxLeverage {
+			return fmt.Errorf("杠杆 %dx 超过 %s 的上限 %dx", d.Leverage, d.Symbol, maxLeverage)
+		}
+		if d.StopLoss < 0 || d.TakeProfit < 0 {
+			return fmt.Errorf("止损止盈不能为负数: 止损 %.4f 止盈 %.4f", d.StopLoss, d.TakeProfit)
+		}
+		if d.StopLoss > 0 && d.TakeProfit > 0 {
+			if d.Action == "open_long" && d.StopLoss >= d.TakeProfit {
+				return fmt.Errorf("做多时止损价(%.4f)必须小于止盈价(%.4f)", d.StopLoss, d.TakeProfit)
+			}
+			if d.Action == "open_short" && d.StopLoss <= d.TakeProfit {
+				return fmt.Errorf("做空时止损价(%.4f)必须大于止盈价(%.4f)", d.StopLoss, d.TakeProfit)
+			}
+		}
+	case "add_position", "add_short":
+		if d.PositionSizeUSD <= 0 {
+			return fmt.Errorf("加仓金额必须大于0: %.2f", d.PositionSizeUSD)
+		}
+	case "update_stop_loss":
+		if d.NewStopLoss <= 0 {
+			return fmt.Errorf("新止损价格必须大于0: %.4f", d.NewStopLoss)
+		}
+	case "update_take_profit":
+		if d.NewTakeProfit <= 0 {
+			return fmt.Errorf("新止盈价格必须大于0: %.4f", d.NewTakeProfit)
+		}
+	case "partial_close":
+		return validateCloseAmount(d)
+	}
+	return nil
+}
+
+// validateCloseAmount 校验部分平仓数量：设置了 close_quantity 时必须为正（超过持仓的部分执行时截断），否则校验 close_percentage
+func validateCloseAmount(d *Decision) error {
+	if d.CloseQuantity != 0 {
+		if d.CloseQuantity < 0 {
+			return fmt.Errorf("平仓数量必须大于0: %.8f", d.CloseQuantity)
+		}
+		return nil
+	}
+	if d.ClosePercentage <= 0 || d.ClosePercentage > 100 {
+		return fmt.Errorf("平仓百分比必须在0-100之间: %.1f", d.ClosePercentage)
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ func TestLeverageFallback(t *testing.T) {
 		accountEquity   float64
 		btcEthLeverage  int
 		altcoinLeverage int
+		leverageTiers   map[string]int
 		wantLeverage    int // 期望修正后的杠杆值
 		wantError       bool
 	}{
@@ -63,6 +64,23 @@ func TestLeverageFallback(t *testing.T) {
 			wantLeverage:    5, // 保持不变
 			wantError:       false,
 		},
+		{
+			name: "杠杆分级_按分级上限修正",
+			decision: Decision{
+				Symbol:          "SOLUSDT",
+				Action:          "open_long",
+				Leverage:        20,
+				PositionSizeUSD: 100,
+				StopLoss:        50,
+				TakeProfit:      200,
+			},
+			accountEquity:   100,
+			btcEthLeverage:  10,
+			altcoinLeverage: 5,
+			leverageTiers:   map[string]int{"SOLUSDT": 8, "default": 3},
+			wantLeverage:    8, // 分级优先于山寨币两档上限
+			wantError:       false,
+		},
 		{
 			name: "杠杆为0_应该报错",
 			decision: Decision{
@@ -83,7 +101,7 @@ func TestLeverageFallback(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateDecision(&tt.decision, tt.accountEquity, tt.btcEthLeverage, tt.altcoinLeverage)
+			err := validateDecision(&tt.decision, tt.accountEquity, tt.btcEthLeverage, tt.altcoinLeverage, tt.leverageTiers)
 
 			// 检查错误状态
 			if (err != nil) != tt.wantError {
@@ -143,7 +161,7 @@ func TestUpdateStopLossValidation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateDecision(&tt.decision, 1000.0, 10, 5)
+			err := validateDecision(&tt.decision, 1000.0, 10, 5, nil)
 
 			if (err != nil) != tt.wantError {
 				t.Errorf("validateDecision() error = %v, wantError %v", err, tt.wantError)
@@ -203,7 +221,7 @@ func TestUpdateTakeProfitValidation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateDecision(&tt.decision, 1000.0, 10, 5)
+			err := validateDecision(&tt.decision, 1000.0, 10, 5, nil)
 
 			if (err != nil) != tt.wantError {
 				t.Errorf("validateDecision() error = %v, wantError %v", err, tt.wantError)
@@ -259,11 +277,33 @@ func TestPartialCloseValidation(t *testing.T) {
 			wantError: true,
 			errorMsg:  "平仓百分比必须在0-100之间",
 		},
+		{
+			name: "close_quantity优先于close_percentage",
+			decision: Decision{
+				Symbol:          "ETHUSDT",
+				Action:          "partial_close",
+				ClosePercentage: 150,
+				CloseQuantity:   0.5,
+				Reasoning:       "减到整手",
+			},
+			wantError: false,
+		},
+		{
+			name: "close_quantity为负数应该报错",
+			decision: Decision{
+				Symbol:        "ETHUSDT",
+				Action:        "partial_close",
+				CloseQuantity: -1,
+				Reasoning:     "测试错误情况",
+			},
+			wantError: true,
+			errorMsg:  "平仓数量必须大于0",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateDecision(&tt.decision, 1000.0, 10, 5)
+			err := validateDecision(&tt.decision, 1000.0, 10, 5, nil)
 
 			if (err != nil) != tt.wantError {
 				t.Errorf("validateDecision() error = %v, wantError %v", err, tt.wantError)
@@ -279,6 +319,136 @@ func TestPartialCloseValidation(t *testing.T) {
 	}
 }
 
+// TestTakeProfitLadderValidation 测试开仓时分批止盈的验证
+func TestTakeProfitLadderValidation(t *testing.T) {
+	longDecision := func(ladder []TakeProfitLevel) Decision {
+		return Decision{
+			Symbol:           "BTCUSDT",
+			Action:           "open_long",
+			Leverage:         5,
+			PositionSizeUSD:  1000,
+			StopLoss:         95000,
+			TakeProfit:       120000,
+			TakeProfitLadder: ladder,
+		}
+	}
+	shortDecision := func(ladder []TakeProfitLevel) Decision {
+		return Decision{
+			Symbol:           "BTCUSDT",
+			Action:           "open_short",
+			Leverage:         5,
+			PositionSizeUSD:  1000,
+			StopLoss:         105000,
+			TakeProfit:       80000,
+			TakeProfitLadder: ladder,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		decision  Decision
+		wantError bool
+		errorMsg  string
+	}{
+		{
+			name:     "做多_分批止盈合法",
+			decision: longDecision([]TakeProfitLevel{{Price: 105000, Percent: 50}, {Price: 110000, Percent: 50}}),
+		},
+		{
+			name:     "做空_分批止盈合法且未满100%",
+			decision: shortDecision([]TakeProfitLevel{{Price: 95000, Percent: 30}, {Price: 90000, Percent: 30}}),
+		},
+		{
+			name:      "比例之和超过100",
+			decision:  longDecision([]TakeProfitLevel{{Price: 105000, Percent: 60}, {Price: 110000, Percent: 50}}),
+			wantError: true,
+			errorMsg:  "比例之和不能超过100%",
+		},
+		{
+			name:      "单档比例为0",
+			decision:  longDecision([]TakeProfitLevel{{Price: 105000, Percent: 0}}),
+			wantError: true,
+			errorMsg:  "比例必须在0-100之间",
+		},
+		{
+			name:      "做多_止盈价低于止损",
+			decision:  longDecision([]TakeProfitLevel{{Price: 94000, Percent: 50}}),
+			wantError: true,
+			errorMsg:  "必须高于",
+		},
+		{
+			name:      "做空_止盈价高于止损",
+			decision:  shortDecision([]TakeProfitLevel{{Price: 106000, Percent: 50}}),
+			wantError: true,
+			errorMsg:  "必须低于",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDecision(&tt.decision, 1000.0, 10, 5, nil)
+
+			if (err != nil) != tt.wantError {
+				t.Errorf("validateDecision() error = %v, wantError %v", err, tt.wantError)
+				return
+			}
+
+			if tt.wantError && err != nil {
+				if tt.errorMsg != "" && !contains(err.Error(), tt.errorMsg) {
+					t.Errorf("错误信息不匹配: got %q, want to contain %q", err.Error(), tt.errorMsg)
+				}
+			}
+		})
+	}
+}
+
+// TestRiskPercentValidation 测试 risk_percent 定仓时的校验（不再要求 position_size_usd）
+func TestRiskPercentValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		decision  Decision
+		wantError bool
+		errorMsg  string
+	}{
+		{
+			name:      "仅提供risk_percent",
+			decision:  Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 5, RiskPercent: 1, StopLoss: 95, TakeProfit: 130},
+			wantError: false,
+		},
+		{
+			name:      "risk_percent优先_忽略过小的position_size_usd",
+			decision:  Decision{Symbol: "BTCUSDT", Action: "open_short", Leverage: 5, RiskPercent: 2, PositionSizeUSD: 1, StopLoss: 105000, TakeProfit: 70000},
+			wantError: false,
+		},
+		{
+			name:      "risk_percent超过上限",
+			decision:  Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 5, RiskPercent: 15, StopLoss: 95, TakeProfit: 130},
+			wantError: true,
+			errorMsg:  "risk_percent 必须在",
+		},
+		{
+			name:      "两者都未提供",
+			decision:  Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 5, StopLoss: 95, TakeProfit: 130},
+			wantError: true,
+			errorMsg:  "仓位大小必须大于0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDecision(&tt.decision, 1000.0, 10, 5, nil)
+
+			if (err != nil) != tt.wantError {
+				t.Errorf("validateDecision() error = %v, wantError %v", err, tt.wantError)
+				return
+			}
+			if tt.wantError && !contains(err.Error(), tt.errorMsg) {
+				t.Errorf("错误信息不匹配: got %q, want to contain %q", err.Error(), tt.errorMsg)
+			}
+		})
+	}
+}
+
 // contains 检查字符串是否包含子串（辅助函数）
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
@@ -293,3 +463,67 @@ func stringContains(s, substr string) bool {
 	}
 	return false
 }
+
+// TestDecisionValidate 测试执行前的决策结构校验
+func TestDecisionValidate(t *testing.T) {
+	cfg := ValidationConfig{BTCETHLeverage: 10, AltcoinLeverage: 5, LeverageTiers: map[string]int{"DOGEUSDT": 3}}
+	openLong := func(modify func(d *Decision)) Decision {
+		d := Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 100, StopLoss: 90, TakeProfit: 130}
+		if modify != nil {
+			modify(&d)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name      string
+		decision  Decision
+		wantError bool
+	}{
+		{name: "合法开多", decision: openLong(nil)},
+		{name: "合法开空", decision: Decision{Symbol: "BTCUSDT", Action: "open_short", Leverage: 10, PositionSizeUSD: 500, StopLoss: 52000, TakeProfit: 45000}},
+		{name: "按风险百分比定仓_无需仓位金额", decision: openLong(func(d *Decision) { d.PositionSizeUSD = 0; d.RiskPercent = 2 })},
+		{name: "未给杠杆_由执行器取上限", decision: openLong(func(d *Decision) { d.Leverage = 0 })},
+		{name: "未给止盈_不校验方向", decision: openLong(func(d *Decision) { d.TakeProfit = 0 })},
+		{name: "hold无需币种", decision: Decision{Action: "hold"}},
+		{name: "wait无需币种", decision: Decision{Action: "wait"}},
+		{name: "平多", decision: Decision{Symbol: "ETHUSDT", Action: "close_long"}},
+		{name: "部分平仓100%", decision: Decision{Symbol: "ETHUSDT", Action: "partial_close", ClosePercentage: 100}},
+		{name: "按数量部分平仓", decision: Decision{Symbol: "ETHUSDT", Action: "partial_close", CloseQuantity: 0.25}},
+		{name: "加多仓", decision: Decision{Symbol: "ETHUSDT", Action: "add_position", PositionSizeUSD: 200}},
+		{name: "调整止损", decision: Decision{Symbol: "ETHUSDT", Action: "update_stop_loss", NewStopLoss: 3000}},
+		{name: "调整止盈", decision: Decision{Symbol: "ETHUSDT", Action: "update_take_profit", NewTakeProfit: 4000}},
+
+		{name: "未知动作", decision: Decision{Symbol: "BTCUSDT", Action: "buy"}, wantError: true},
+		{name: "空动作", decision: Decision{Symbol: "BTCUSDT"}, wantError: true},
+		{name: "缺少币种", decision: openLong(func(d *Decision) { d.Symbol = "" }), wantError: true},
+		{name: "币种为空白", decision: Decision{Symbol: "  ", Action: "close_short"}, wantError: true},
+		{name: "仓位金额为负", decision: openLong(func(d *Decision) { d.PositionSizeUSD = -100 }), wantError: true},
+		{name: "仓位金额为0", decision: openLong(func(d *Decision) { d.PositionSizeUSD = 0 }), wantError: true},
+		{name: "风险百分比超限", decision: openLong(func(d *Decision) { d.RiskPercent = MaxRiskPercent + 1 }), wantError: true},
+		{name: "杠杆为负", decision: openLong(func(d *Decision) { d.Leverage = -1 }), wantError: true},
+		{name: "山寨币杠杆超限", decision: openLong(func(d *Decision) { d.Leverage = 6 }), wantError: true},
+		{name: "杠杆分级超限", decision: openLong(func(d *Decision) { d.Symbol = "DOGEUSDT"; d.Leverage = 5 }), wantError: true},
+		{name: "止损为负", decision: openLong(func(d *Decision) { d.StopLoss = -1 }), wantError: true},
+		{name: "做多止损高于止盈", decision: openLong(func(d *Decision) { d.StopLoss = 140 }), wantError: true},
+		{name: "做空止损低于止盈", decision: Decision{Symbol: "BTCUSDT", Action: "open_short", Leverage: 10, PositionSizeUSD: 500, StopLoss: 45000, TakeProfit: 52000}, wantError: true},
+		{name: "部分平仓0%", decision: Decision{Symbol: "ETHUSDT", Action: "partial_close"}, wantError: true},
+		{name: "部分平仓超过100%", decision: Decision{Symbol: "ETHUSDT", Action: "partial_close", ClosePercentage: 120}, wantError: true},
+		{name: "加空仓缺少金额", decision: Decision{Symbol: "ETHUSDT", Action: "add_short"}, wantError: true},
+		{name: "调整止损缺少价格", decision: Decision{Symbol: "ETHUSDT", Action: "update_stop_loss"}, wantError: true},
+		{name: "调整止盈价格为负", decision: Decision{Symbol: "ETHUSDT", Action: "update_take_profit", NewTakeProfit: -1}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.decision
+			err := tt.decision.Validate(cfg)
+			if (err != nil) != tt.wantError {
+				t.Errorf("Validate() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.decision.Leverage != before.Leverage {
+				t.Error("Validate 不应修改决策")
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"nofx/config"
+	"sync"
+	"time"
+)
+
+// 决策日志的写入目标
+const (
+	SinkFile = "file" // 只写文件（默认）
+	SinkDB   = "db"   // 只写数据库，写入失败的记录回退写文件；读取记录时以数据库为准
+	SinkBoth = "both" // 同时写文件和数据库，读取记录仍以文件为准
+)
+
+// DecisionLogSink 决策日志写入目标（SinkFile / SinkDB / SinkBoth），可通过配置修改
+var DecisionLogSink = SinkFile
+
+// maxDBBatchSize 单个事务最多写入的决策记录数
+const maxDBBatchSize = 50
+
+// RecordStore 决策记录的数据库存储（*config.Database 实现）
+type RecordStore interface {
+	SaveDecisionLogs(userID, traderID string, entries []config.DecisionLogEntry) error
+	LoadDecisionLogs(userID, traderID string, limit int, since time.Time) ([]string, error)
+	DeleteDecisionLogsBefore(userID, traderID string, cutoff time.Time) (int64, error)
+}
+
+// ValidSink 校验决策日志写入目标
+func ValidSink(sink string) bool {
+	switch sink {
+	case SinkFile, SinkDB, SinkBoth:
+		return true
+	}
+	return false
+}
+
+// dbSink 异步批量写入数据库：记录先进入待写队列，由后台goroutine合并为事务写入，队列写空后goroutine退出
+type dbSink struct {
+	store    RecordStore
+	userID   string
+	traderID string
+	fallback func(record *DecisionRecord) // 数据库写入失败时的回退（nil 表示不回退）
+
+	mu      sync.Mutex
+	pending []config.DecisionLogEntry
+	running bool
+	idle    chan struct{} // 后台写入goroutine退出时关闭
+}
+
+// enqueue 将记录转换为数据库条目（此时序列化，之后调用方修改记录不影响写入内容）并加入待写队列
+func (s *dbSink) enqueue(record *DecisionRecord) error {
+	entry, err := newDecisionLogEntry(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, entry)
+	if !s.running {
+		s.running = true
+		s.idle = make(chan struct{})
+		go s.drain(s.idle)
+	}
+	return nil
+}
+
+// drain 持续写入待写队列直到队列为空
+func (s *dbSink) drain(idle chan struct{}) {
+	defer close(idle)
+	for {
+		s.mu.Lock()
+		batch := s.pending
+		if len(batch) > maxDBBatchSize {
+			batch = batch[:maxDBBatchSize:maxDBBatchSize]
+		}
+		s.pending = s.pending[len(batch):]
+		if len(batch) == 0 {
+			s.pending = nil
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		s.write(batch)
+	}
+}
+
+// write 写入一批记录，失败时逐条回退
+func (s *dbSink) write(batch []config.DecisionLogEntry) {
+	err := s.store.SaveDecisionLogs(s.userID, s.traderID, batch)
+	if err == nil {
+		return
+	}
+	fmt.Printf("⚠ 决策记录写入数据库失败（%d 条）: %v\n", len(batch), err)
+	if s.fallback == nil {
+		return
+	}
+	for _, entry := range batch {
+		var record DecisionRecord
+		if err := json.Unmarshal([]byte(entry.RecordJSON), &record); err != nil {
+			continue
+		}
+		s.fallback(&record)
+	}
+}
+
+// flush 等待待写队列写完
+func (s *dbSink) flush() {
+	s.mu.Lock()
+	running, idle := s.running, s.idle
+	s.mu.Unlock()
+	if running {
+		<-idle
+	}
+}
+
+// load 读取 since 之后的最近 limit 条记录（从新到旧），损坏的记录跳过
+func (s *dbSink) load(limit int, since time.Time) ([]*DecisionRecord, error) {
+	rows, err := s.store.LoadDecisionLogs(s.userID, s.traderID, limit, since)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*DecisionRecord, 0, len(rows))
+	for _, row := range rows {
+		var record DecisionRecord
+		if err := json.Unmarshal([]byte(row), &record); err != nil {
+			fmt.Printf("⚠ 数据库中的决策记录已损坏，已跳过: %v\n", err)
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+// newDecisionLogEntry 将决策记录转换为数据库条目（动作没有执行时间时使用记录时间）
+func newDecisionLogEntry(record *DecisionRecord) (config.DecisionLogEntry, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return config.DecisionLogEntry{}, fmt.Errorf("序列化决策记录失败: %w", err)
+	}
+
+	entry := config.DecisionLogEntry{
+		Timestamp:   record.Timestamp,
+		CycleNumber: record.CycleNumber,
+		Success:     record.Success,
+		RecordJSON:  string(data),
+		Actions:     make([]config.DecisionLogAction, 0, len(record.Decisions)),
+	}
+	for _, action := range record.Decisions {
+		timestamp := action.Timestamp
+		if timestamp.IsZero() {
+			timestamp = record.Timestamp
+		}
+		entry.Actions = append(entry.Actions, config.DecisionLogAction{
+			Timestamp: timestamp,
+			Symbol:    action.Symbol,
+			Action:    action.Action,
+			Quantity:  action.Quantity,
+			Price:     action.Price,
+			OrderID:   action.OrderID,
+			Success:   action.Success,
+			Error:     action.Error,
+		})
+	}
+	return entry, nil
+}
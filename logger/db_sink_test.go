@@ -0,0 +1,208 @@
+package logger
+
+import (
+	"errors"
+	"nofx/config"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryRecordStore 内存中的决策记录存储
+type memoryRecordStore struct {
+	mu      sync.Mutex
+	entries map[string][]config.DecisionLogEntry // userID/traderID -> 按写入顺序
+	fail    bool
+}
+
+func newMemoryRecordStore() *memoryRecordStore {
+	return &memoryRecordStore{entries: make(map[string][]config.DecisionLogEntry)}
+}
+
+func (m *memoryRecordStore) SaveDecisionLogs(userID, traderID string, entries []config.DecisionLogEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail {
+		return errors.New("database is locked")
+	}
+	key := userID + "/" + traderID
+	m.entries[key] = append(m.entries[key], entries...)
+	return nil
+}
+
+func (m *memoryRecordStore) LoadDecisionLogs(userID, traderID string, limit int, since time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail {
+		return nil, errors.New("database is locked")
+	}
+	// 从新到旧（同一时间按写入顺序倒序）
+	entries := m.entries[userID+"/"+traderID]
+	var matched []config.DecisionLogEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Timestamp.Before(since) {
+			matched = append(matched, entries[i])
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Timestamp.After(matched[j].Timestamp) })
+	var rows []string
+	for _, entry := range matched {
+		if limit > 0 && len(rows) >= limit {
+			break
+		}
+		rows = append(rows, entry.RecordJSON)
+	}
+	return rows, nil
+}
+
+func (m *memoryRecordStore) DeleteDecisionLogsBefore(userID, traderID string, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := userID + "/" + traderID
+	var kept []config.DecisionLogEntry
+	for _, entry := range m.entries[key] {
+		if !entry.Timestamp.Before(cutoff) {
+			kept = append(kept, entry)
+		}
+	}
+	removed := int64(len(m.entries[key]) - len(kept))
+	m.entries[key] = kept
+	return removed, nil
+}
+
+func (m *memoryRecordStore) count(userID, traderID string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries[userID+"/"+traderID])
+}
+
+// logTrade 记录一笔开仓和平仓（间隔1ms，保证时间先后）
+func logTrade(t *testing.T, l IDecisionLogger, openPrice, closePrice float64) {
+	t.Helper()
+	for _, action := range []DecisionAction{
+		{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.01, Leverage: 5, Price: openPrice, Timestamp: time.Now(), Success: true},
+		{Action: "close_long", Symbol: "BTCUSDT", Quantity: 0.01, Leverage: 5, Price: closePrice, Timestamp: time.Now(), Success: true},
+	} {
+		record := &DecisionRecord{Exchange: "binance", Success: true, Decisions: []DecisionAction{action}}
+		if err := l.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision failed: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestDecisionLogger_DBSink 只写数据库：不写文件，读取记录和表现分析都来自数据库，按交易员隔离
+func TestDecisionLogger_DBSink(t *testing.T) {
+	dir := t.TempDir()
+	store := newMemoryRecordStore()
+	l := NewDecisionLoggerWithStore(dir, SinkDB, store, "user-1", "trader-1")
+	other := NewDecisionLoggerWithStore(t.TempDir(), SinkDB, store, "user-1", "trader-2")
+
+	logTrade(t, l, 100000, 101000)
+	logTrade(t, other, 100000, 99000)
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	other.Flush()
+
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("只写数据库时不应写文件，发现 %d 个文件", len(files))
+	}
+	if got := store.count("user-1", "trader-1"); got != 2 {
+		t.Fatalf("trader-1 应写入2条记录，实际 %d", got)
+	}
+	entry := store.entries["user-1/trader-1"][0]
+	if len(entry.Actions) != 1 || entry.Actions[0].Action != "open_long" || entry.Actions[0].Price != 100000 {
+		t.Errorf("决策动作应单独写入: %+v", entry.Actions)
+	}
+
+	records, err := l.ReadRecords(0, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].CycleNumber != 2 || records[1].CycleNumber != 1 {
+		t.Fatalf("ReadRecords 应从新到旧返回本交易员的2条记录，实际 %d 条", len(records))
+	}
+	latest, _ := l.GetLatestRecords(10)
+	if len(latest) != 2 || latest[0].CycleNumber != 1 {
+		t.Errorf("GetLatestRecords 应从旧到新返回")
+	}
+
+	analysis, err := l.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.TotalTrades != 1 || analysis.WinningTrades != 1 {
+		t.Errorf("应从数据库分析出1笔盈利交易，实际 total=%d win=%d", analysis.TotalTrades, analysis.WinningTrades)
+	}
+
+	stats, _ := l.GetStatistics()
+	if stats.TotalCycles != 2 || stats.TotalOpenPositions != 1 || stats.TotalClosePositions != 1 {
+		t.Errorf("统计应来自数据库: %+v", stats)
+	}
+}
+
+// TestDecisionLogger_DBSinkFallback 数据库写入失败时回退写文件，读取数据库失败时回退读文件
+func TestDecisionLogger_DBSinkFallback(t *testing.T) {
+	dir := t.TempDir()
+	store := newMemoryRecordStore()
+	store.fail = true
+	l := NewDecisionLoggerWithStore(dir, SinkDB, store, "user-1", "trader-1")
+
+	logTrade(t, l, 100000, 101000)
+	l.Flush()
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Fatalf("数据库写入失败的记录应回退写文件，实际 %d 个文件", len(files))
+	}
+	records, err := l.ReadRecords(0, time.Time{})
+	if err != nil || len(records) != 2 {
+		t.Fatalf("读取数据库失败时应回退读文件，实际 %d 条 (err=%v)", len(records), err)
+	}
+}
+
+// TestDecisionLogger_BothSinks 同时写文件和数据库，清理旧记录时两边都清理
+func TestDecisionLogger_BothSinks(t *testing.T) {
+	dir := t.TempDir()
+	store := newMemoryRecordStore()
+	l := NewDecisionLoggerWithStore(dir, SinkBoth, store, "user-1", "trader-1")
+
+	for i := 0; i < 3; i++ {
+		logTrade(t, l, 100000, 101000)
+	}
+	l.Flush()
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 6 || store.count("user-1", "trader-1") != 6 {
+		t.Errorf("文件和数据库都应有6条记录，实际文件 %d 条、数据库 %d 条", len(files), store.count("user-1", "trader-1"))
+	}
+
+	// 清理旧记录同时清理数据库
+	if err := l.CleanOldRecords(-1); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.count("user-1", "trader-1"); got != 0 {
+		t.Errorf("数据库中的旧记录应被清理，剩余 %d 条", got)
+	}
+}
+
+// TestNewDecisionLoggerWithStore_FileOnly 写入目标为文件或没有数据库时不写数据库
+func TestNewDecisionLoggerWithStore_FileOnly(t *testing.T) {
+	store := newMemoryRecordStore()
+	for _, l := range []IDecisionLogger{
+		NewDecisionLoggerWithStore(t.TempDir(), SinkFile, store, "user-1", "trader-1"),
+		NewDecisionLoggerWithStore(t.TempDir(), SinkDB, nil, "user-1", "trader-1"),
+	} {
+		logTrade(t, l, 100000, 101000)
+		l.Flush()
+		if records, _ := l.ReadRecords(0, time.Time{}); len(records) != 2 {
+			t.Errorf("应写入文件，实际读到 %d 条", len(records))
+		}
+	}
+	if got := store.count("user-1", "trader-1"); got != 0 {
+		t.Errorf("不应写入数据库，实际 %d 条", got)
+	}
+}
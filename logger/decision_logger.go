@@ -3,18 +3,34 @@ package logger
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
+// MaxReasoningLength 决策理由的最大保存长度（字符），避免异常长的输出撑大日志
+const MaxReasoningLength = 2000
+
+// TruncateReasoning 将决策理由截断到 MaxReasoningLength
+func TruncateReasoning(reasoning string) string {
+	runes := []rune(reasoning)
+	if len(runes) <= MaxReasoningLength {
+		return reasoning
+	}
+	return string(runes[:MaxReasoningLength]) + "...(已截断)"
+}
+
 // DecisionRecord 决策记录
 type DecisionRecord struct {
 	Timestamp      time.Time          `json:"timestamp"`       // 决策时间
 	CycleNumber    int                `json:"cycle_number"`    // 周期编号
-	Exchange       string             `json:"exchange"`        // 交易所类型 (binance/hyperliquid/aster)
+	Exchange       string             `json:"exchange"`        // 交易所类型 (binance/hyperliquid/aster/bybit)
 	SystemPrompt   string             `json:"system_prompt"`   // 系统提示词（发送给AI的系统prompt）
 	InputPrompt    string             `json:"input_prompt"`    // 发送给AI的输入prompt
 	CoTTrace       string             `json:"cot_trace"`       // AI思维链（输出）
@@ -26,8 +42,17 @@ type DecisionRecord struct {
 	ExecutionLog   []string           `json:"execution_log"`   // 执行日志
 	Success        bool               `json:"success"`         // 是否成功
 	ErrorMessage   string             `json:"error_message"`   // 错误信息（如果有）
+	AIModel        string             `json:"ai_model"`        // 产生本次决策的AI模型（主模型失败时为备用模型）
 	// AIRequestDurationMs 记录 AI API 调用耗时（毫秒），方便评估调用性能
 	AIRequestDurationMs int64 `json:"ai_request_duration_ms,omitempty"`
+	// Token 用量（provider 未返回 usage 时为 0）
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+	TotalTokens      int `json:"total_tokens,omitempty"`
+	// StrategyTag 决策时的策略标签（如prompt版本），开仓时的标签随该笔交易直到平仓
+	StrategyTag string `json:"strategy_tag,omitempty"`
+	// Shadow 影子模型的决策记录（只记录不执行，写入独立的影子决策日志目录）
+	Shadow bool `json:"shadow,omitempty"`
 }
 
 // AccountSnapshot 账户状态快照
@@ -50,19 +75,29 @@ type PositionSnapshot struct {
 	UnrealizedProfit float64 `json:"unrealized_profit"`
 	Leverage         float64 `json:"leverage"`
 	LiquidationPrice float64 `json:"liquidation_price"`
+	// 快照时的资金费率及其结算时间（毫秒时间戳），未获取到行情时为 0
+	FundingRate     float64 `json:"funding_rate,omitempty"`
+	NextFundingTime int64   `json:"next_funding_time,omitempty"`
 }
 
 // DecisionAction 决策动作
 type DecisionAction struct {
-	Action    string    `json:"action"`    // open_long, open_short, close_long, close_short, update_stop_loss, update_take_profit, partial_close
-	Symbol    string    `json:"symbol"`    // 币种
-	Quantity  float64   `json:"quantity"`  // 数量（部分平仓时使用）
-	Leverage  int       `json:"leverage"`  // 杠杆（开仓时）
-	Price     float64   `json:"price"`     // 执行价格
-	OrderID   int64     `json:"order_id"`  // 订单ID
-	Timestamp time.Time `json:"timestamp"` // 执行时间
-	Success   bool      `json:"success"`   // 是否成功
-	Error     string    `json:"error"`     // 错误信息
+	Action           string    `json:"action"`                      // open_long, open_short, close_long, close_short, update_stop_loss, update_take_profit, partial_close
+	Symbol           string    `json:"symbol"`                      // 币种
+	Quantity         float64   `json:"quantity"`                    // 数量（部分平仓时使用）
+	Leverage         int       `json:"leverage"`                    // 杠杆（开仓时）
+	ResolvedLeverage int       `json:"resolved_leverage,omitempty"` // 按杠杆分级（或两档杠杆）解析出的杠杆上限（开仓时）
+	ParentOrderID    int64     `json:"parent_order_id,omitempty"`   // 关联的开仓订单ID（开仓附带的止损挂单等）
+	OCOGroup         string    `json:"oco_group,omitempty"`         // 止损止盈配对ID（同组的止损单和止盈单一方成交后另一方撤销）
+	Price            float64   `json:"price"`                       // 执行价格
+	OrderID          int64     `json:"order_id"`                    // 订单ID
+	ClientOrderID    string    `json:"client_order_id,omitempty"`   // 客户端订单ID（按决策确定性生成，重试时由交易所去重）
+	Fee              float64   `json:"fee,omitempty"`               // 实际手续费（来自成交推送，0表示未知，按费率估算）
+	Reasoning        string    `json:"reasoning,omitempty"`         // AI给出的决策理由（超过 MaxReasoningLength 截断）
+	Timestamp        time.Time `json:"timestamp"`                   // 执行时间
+	Success          bool      `json:"success"`                     // 是否成功
+	Error            string    `json:"error"`                       // 错误信息
+	Detail           string    `json:"detail,omitempty"`            // 附加说明（非错误，如对账清理的残留缓存）
 }
 
 // IDecisionLogger 决策日志记录器接口
@@ -73,18 +108,29 @@ type IDecisionLogger interface {
 	GetLatestRecords(n int) ([]*DecisionRecord, error)
 	// GetRecordByDate 获取指定日期的所有记录
 	GetRecordByDate(date time.Time) ([]*DecisionRecord, error)
+	// ReadRecords 读取 since 之后的最近 limit 条记录（按时间倒序：从新到旧，limit<=0 表示不限制）
+	ReadRecords(limit int, since time.Time) ([]*DecisionRecord, error)
 	// CleanOldRecords 清理N天前的旧记录
 	CleanOldRecords(days int) error
 	// GetStatistics 获取统计信息
 	GetStatistics() (*Statistics, error)
-	// AnalyzePerformance 分析最近N个周期的交易表现
-	AnalyzePerformance(lookbackCycles int) (*PerformanceAnalysis, error)
+	// AnalyzePerformance 分析最近N个周期的交易表现，可选按策略标签等条件筛选交易
+	AnalyzePerformance(lookbackCycles int, filter ...PerformanceFilter) (*PerformanceAnalysis, error)
+	// AnalyzePerformanceRange 分析在 [from, to] 内平仓的交易表现，可选按策略标签等条件筛选交易
+	AnalyzePerformanceRange(from, to time.Time, filter ...PerformanceFilter) (*PerformanceAnalysis, error)
+	// ExportCSV 将 [from, to] 内平仓的交易按CSV写出（每笔交易一行）
+	ExportCSV(w io.Writer, from, to time.Time) error
+	// Flush 等待正在写入的记录落盘（停止交易员前调用）
+	Flush() error
 }
 
 // DecisionLogger 决策日志记录器
 type DecisionLogger struct {
+	mu          sync.Mutex // 串行化写入，Flush 通过它等待进行中的写入完成
 	logDir      string
 	cycleNumber int
+	sinkMode    string  // 写入目标（SinkFile / SinkDB / SinkBoth）
+	sink        *dbSink // 数据库写入（nil 表示只写文件）
 }
 
 // NewDecisionLogger 创建决策日志记录器
@@ -106,15 +152,74 @@ func NewDecisionLogger(logDir string) IDecisionLogger {
 	return &DecisionLogger{
 		logDir:      logDir,
 		cycleNumber: 0,
+		sinkMode:    SinkFile,
+	}
+}
+
+// NewDecisionLoggerWithStore 创建同时（或只）写入数据库的决策日志记录器，记录按 userID/traderID 区分
+// sink 为 SinkFile 或 store 为 nil 时等同于 NewDecisionLogger
+func NewDecisionLoggerWithStore(logDir, sink string, store RecordStore, userID, traderID string) IDecisionLogger {
+	l := NewDecisionLogger(logDir).(*DecisionLogger)
+	if store == nil || (sink != SinkDB && sink != SinkBoth) {
+		return l
 	}
+
+	l.sinkMode = sink
+	l.sink = &dbSink{store: store, userID: userID, traderID: traderID}
+	if sink == SinkDB {
+		// 只写数据库时，写入失败的记录回退写文件，避免丢失
+		l.sink.fallback = func(record *DecisionRecord) {
+			if err := l.writeRecordFile(record); err != nil {
+				fmt.Printf("⚠ 决策记录回退写文件失败: %v\n", err)
+			}
+		}
+	}
+	return l
+}
+
+// readsFromDB 读取记录时是否以数据库为准（只写数据库时）
+func (l *DecisionLogger) readsFromDB() bool {
+	return l.sink != nil && l.sinkMode == SinkDB
+}
+
+// loadFromDB 从数据库读取记录（先等待待写队列写完），失败时返回 false 由调用方回退读文件
+func (l *DecisionLogger) loadFromDB(limit int, since time.Time) ([]*DecisionRecord, bool) {
+	l.sink.flush()
+	records, err := l.sink.load(limit, since)
+	if err != nil {
+		fmt.Printf("⚠ 从数据库读取决策记录失败，改为读取文件: %v\n", err)
+		return nil, false
+	}
+	return records, true
 }
 
 // LogDecision 记录决策
 func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.cycleNumber++
 	record.CycleNumber = l.cycleNumber
 	record.Timestamp = time.Now()
 
+	for i := range record.Decisions {
+		record.Decisions[i].Reasoning = TruncateReasoning(record.Decisions[i].Reasoning)
+	}
+
+	if l.sink != nil {
+		err := l.sink.enqueue(record)
+		if err == nil && l.sinkMode == SinkDB {
+			return nil
+		}
+		if err != nil {
+			fmt.Printf("⚠ 决策记录写入数据库失败: %v\n", err)
+		}
+	}
+	return l.writeRecordFile(record)
+}
+
+// writeRecordFile 将决策记录写入日志目录
+func (l *DecisionLogger) writeRecordFile(record *DecisionRecord) error {
 	// 生成文件名：decision_YYYYMMDD_HHMMSS_cycleN.json
 	filename := fmt.Sprintf("decision_%s_cycle%d.json",
 		record.Timestamp.Format("20060102_150405"),
@@ -128,8 +233,15 @@ func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 		return fmt.Errorf("序列化决策记录失败: %w", err)
 	}
 
-	// 写入文件（使用安全权限：只有所有者可读写）
-	if err := ioutil.WriteFile(filepath, data, 0600); err != nil {
+	// 先写临时文件再重命名，避免进程中途退出留下不完整的记录
+	// （使用安全权限：只有所有者可读写）
+	tmpPath := filepath + tmpFileSuffix
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入决策记录失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath); err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("写入决策记录失败: %w", err)
 	}
 
@@ -137,8 +249,29 @@ func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 	return nil
 }
 
+// tmpFileSuffix 写入中的临时文件后缀，读取记录时会跳过
+const tmpFileSuffix = ".tmp"
+
+// Flush 等待正在进行的写入完成
+// LogDecision 是同步写盘的，拿到锁即说明没有写了一半的记录；写入数据库时还需等待异步队列写完
+func (l *DecisionLogger) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sink != nil {
+		l.sink.flush()
+	}
+	return nil
+}
+
 // GetLatestRecords 获取最近N条记录（按时间正序：从旧到新）
 func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
+	if l.readsFromDB() {
+		if records, ok := l.loadFromDB(n, time.Time{}); ok {
+			slices.Reverse(records)
+			return records, nil
+		}
+	}
+
 	files, err := ioutil.ReadDir(l.logDir)
 	if err != nil {
 		return nil, fmt.Errorf("读取日志目录失败: %w", err)
@@ -149,7 +282,7 @@ func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
 	count := 0
 	for i := len(files) - 1; i >= 0 && count < n; i-- {
 		file := files[i]
-		if file.IsDir() {
+		if file.IsDir() || strings.HasSuffix(file.Name(), tmpFileSuffix) {
 			continue
 		}
 
@@ -176,8 +309,81 @@ func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
 	return records, nil
 }
 
+// ReadRecords 读取 since 之后的最近 limit 条记录（按时间倒序：从新到旧，limit<=0 表示不限制）
+// 损坏或写了一半的记录文件会被跳过并打印警告，不影响其他记录
+func (l *DecisionLogger) ReadRecords(limit int, since time.Time) ([]*DecisionRecord, error) {
+	if l.readsFromDB() {
+		if records, ok := l.loadFromDB(limit, since); ok {
+			return records, nil
+		}
+	}
+
+	files, err := ioutil.ReadDir(l.logDir)
+	if err != nil {
+		return nil, fmt.Errorf("读取日志目录失败: %w", err)
+	}
+
+	// 文件名自带时间（精确到秒），早于 since 所在秒的文件无需读取
+	sinceSecond := since.Truncate(time.Second)
+
+	var records []*DecisionRecord
+	for i := len(files) - 1; i >= 0 && (limit <= 0 || len(records) < limit); i-- {
+		file := files[i]
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		if fileTime, ok := parseRecordFileTime(file.Name()); ok && !since.IsZero() && fileTime.Before(sinceSecond) {
+			break
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(l.logDir, file.Name()))
+		if err != nil {
+			fmt.Printf("⚠ 读取决策记录失败，已跳过 %s: %v\n", file.Name(), err)
+			continue
+		}
+
+		var record DecisionRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			fmt.Printf("⚠ 决策记录已损坏，已跳过 %s: %v\n", file.Name(), err)
+			continue
+		}
+		if !since.IsZero() && record.Timestamp.Before(since) {
+			continue
+		}
+
+		records = append(records, &record)
+	}
+
+	return records, nil
+}
+
+// parseRecordFileTime 从 decision_YYYYMMDD_HHMMSS_cycleN.json 文件名中解析记录时间
+func parseRecordFileTime(name string) (time.Time, bool) {
+	const prefix = "decision_"
+	const layout = "20060102_150405"
+	if !strings.HasPrefix(name, prefix) || len(name) < len(prefix)+len(layout) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(layout, name[len(prefix):len(prefix)+len(layout)], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
 // GetRecordByDate 获取指定日期的所有记录
 func (l *DecisionLogger) GetRecordByDate(date time.Time) ([]*DecisionRecord, error) {
+	if l.readsFromDB() {
+		dayStart := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+		if records, ok := l.loadFromDB(0, dayStart); ok {
+			// 数据库按时间倒序返回，这里与文件一致按时间正序，并去掉次日的记录
+			slices.Reverse(records)
+			return slices.DeleteFunc(records, func(r *DecisionRecord) bool {
+				return !r.Timestamp.Before(dayStart.AddDate(0, 0, 1))
+			}), nil
+		}
+	}
+
 	dateStr := date.Format("20060102")
 	pattern := filepath.Join(l.logDir, fmt.Sprintf("decision_%s_*.json", dateStr))
 
@@ -208,6 +414,16 @@ func (l *DecisionLogger) GetRecordByDate(date time.Time) ([]*DecisionRecord, err
 func (l *DecisionLogger) CleanOldRecords(days int) error {
 	cutoffTime := time.Now().AddDate(0, 0, -days)
 
+	if l.sink != nil {
+		l.sink.flush()
+		removed, err := l.sink.store.DeleteDecisionLogsBefore(l.sink.userID, l.sink.traderID, cutoffTime)
+		if err != nil {
+			fmt.Printf("⚠ 清理数据库中的旧记录失败: %v\n", err)
+		} else if removed > 0 {
+			fmt.Printf("🗑️ 已从数据库清理 %d 条旧记录（%d天前）\n", removed, days)
+		}
+	}
+
 	files, err := ioutil.ReadDir(l.logDir)
 	if err != nil {
 		return fmt.Errorf("读取日志目录失败: %w", err)
@@ -238,6 +454,16 @@ func (l *DecisionLogger) CleanOldRecords(days int) error {
 
 // GetStatistics 获取统计信息
 func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
+	if l.readsFromDB() {
+		if records, ok := l.loadFromDB(0, time.Time{}); ok {
+			stats := &Statistics{}
+			for _, record := range records {
+				stats.add(record)
+			}
+			return stats, nil
+		}
+	}
+
 	files, err := ioutil.ReadDir(l.logDir)
 	if err != nil {
 		return nil, fmt.Errorf("读取日志目录失败: %w", err)
@@ -246,7 +472,7 @@ func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
 	stats := &Statistics{}
 
 	for _, file := range files {
-		if file.IsDir() {
+		if file.IsDir() || strings.HasSuffix(file.Name(), tmpFileSuffix) {
 			continue
 		}
 
@@ -261,27 +487,7 @@ func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
 			continue
 		}
 
-		stats.TotalCycles++
-
-		for _, action := range record.Decisions {
-			if action.Success {
-				switch action.Action {
-				case "open_long", "open_short":
-					stats.TotalOpenPositions++
-				case "close_long", "close_short", "auto_close_long", "auto_close_short":
-					stats.TotalClosePositions++
-					// 🔧 BUG FIX：partial_close 不計入 TotalClosePositions，避免重複計數
-					// case "partial_close": // 不計數，因為只有完全平倉才算一次
-					// update_stop_loss 和 update_take_profit 不計入統計
-				}
-			}
-		}
-
-		if record.Success {
-			stats.SuccessfulCycles++
-		} else {
-			stats.FailedCycles++
-		}
+		stats.add(&record)
 	}
 
 	return stats, nil
@@ -296,22 +502,65 @@ type Statistics struct {
 	TotalClosePositions int `json:"total_close_positions"`
 }
 
+// add 将一条决策记录计入统计
+func (stats *Statistics) add(record *DecisionRecord) {
+	stats.TotalCycles++
+
+	for _, action := range record.Decisions {
+		if action.Success {
+			switch action.Action {
+			case "open_long", "open_short":
+				stats.TotalOpenPositions++
+			case "close_long", "close_short", "auto_close_long", "auto_close_short":
+				stats.TotalClosePositions++
+				// 🔧 BUG FIX：partial_close 不計入 TotalClosePositions，避免重複計數
+				// case "partial_close": // 不計數，因為只有完全平倉才算一次
+				// update_stop_loss 和 update_take_profit 不計入統計
+			}
+		}
+	}
+
+	if record.Success {
+		stats.SuccessfulCycles++
+	} else {
+		stats.FailedCycles++
+	}
+}
+
 // TradeOutcome 单笔交易结果
 type TradeOutcome struct {
-	Symbol        string    `json:"symbol"`         // 币种
-	Side          string    `json:"side"`           // long/short
-	Quantity      float64   `json:"quantity"`       // 仓位数量
-	Leverage      int       `json:"leverage"`       // 杠杆倍数
-	OpenPrice     float64   `json:"open_price"`     // 开仓价
-	ClosePrice    float64   `json:"close_price"`    // 平仓价
-	PositionValue float64   `json:"position_value"` // 仓位价值（quantity × openPrice）
-	MarginUsed    float64   `json:"margin_used"`    // 保证金使用（positionValue / leverage）
-	PnL           float64   `json:"pn_l"`           // 盈亏（USDT）
-	PnLPct        float64   `json:"pn_l_pct"`       // 盈亏百分比（相对保证金）
-	Duration      string    `json:"duration"`       // 持仓时长
-	OpenTime      time.Time `json:"open_time"`      // 开仓时间
-	CloseTime     time.Time `json:"close_time"`     // 平仓时间
-	WasStopLoss   bool      `json:"was_stop_loss"`  // 是否止损
+	Symbol         string    `json:"symbol"`                    // 币种
+	Side           string    `json:"side"`                      // long/short
+	Quantity       float64   `json:"quantity"`                  // 仓位数量
+	Leverage       int       `json:"leverage"`                  // 杠杆倍数
+	OpenPrice      float64   `json:"open_price"`                // 开仓价
+	ClosePrice     float64   `json:"close_price"`               // 平仓价
+	PositionValue  float64   `json:"position_value"`            // 仓位价值（quantity × openPrice）
+	MarginUsed     float64   `json:"margin_used"`               // 保证金使用（positionValue / leverage）
+	PnL            float64   `json:"pn_l"`                      // 盈亏（USDT）
+	PnLPct         float64   `json:"pn_l_pct"`                  // 盈亏百分比（相对保证金）
+	Duration       string    `json:"duration"`                  // 持仓时长
+	OpenTime       time.Time `json:"open_time"`                 // 开仓时间
+	CloseTime      time.Time `json:"close_time"`                // 平仓时间
+	WasStopLoss    bool      `json:"was_stop_loss"`             // 是否止损
+	OpenReasoning  string    `json:"open_reasoning,omitempty"`  // 开仓时的AI决策理由
+	CloseReasoning string    `json:"close_reasoning,omitempty"` // 平仓时的AI决策理由（被动平仓为空）
+	FundingCost    float64   `json:"funding_cost"`              // 持仓期间的资金费成本估算（正数为支出，已从PnL中扣除）
+	NoFundingData  bool      `json:"no_funding_data,omitempty"` // 持仓期间未采集到资金费率，PnL未计入资金费
+	StrategyTag    string    `json:"strategy_tag,omitempty"`    // 开仓时的策略标签
+	GrossPnL       float64   `json:"gross_pn_l"`                // 价格盈亏（未扣手续费和资金费）
+	Fees           float64   `json:"fees"`                      // 开平仓手续费合计（已从PnL中扣除）
+	CloseReason    string    `json:"close_reason,omitempty"`    // 平仓原因：ai（AI决策平仓）或被动平仓推断的 stop_loss/take_profit/liquidation/timeout 等
+}
+
+// PerformanceFilter 交易表现筛选条件（零值表示不筛选）
+type PerformanceFilter struct {
+	StrategyTag string // 只统计开仓时策略标签等于该值的交易
+}
+
+// match 交易是否符合筛选条件
+func (f PerformanceFilter) match(outcome TradeOutcome) bool {
+	return f.StrategyTag == "" || outcome.StrategyTag == f.StrategyTag
 }
 
 // PerformanceAnalysis 交易表现分析
@@ -328,6 +577,11 @@ type PerformanceAnalysis struct {
 	SymbolStats   map[string]*SymbolPerformance `json:"symbol_stats"`   // 各币种表现
 	BestSymbol    string                        `json:"best_symbol"`    // 表现最好的币种
 	WorstSymbol   string                        `json:"worst_symbol"`   // 表现最差的币种
+
+	// 基于逐笔交易的风险指标（受 filter 筛选影响；少于2笔交易时夏普比率为0）
+	TradeSharpeRatio float64 `json:"trade_sharpe_ratio"` // 逐笔收益率（相对保证金）的夏普比率，按 TradeSharpeAnnualization 年化
+	MaxDrawdown      float64 `json:"max_drawdown"`       // 按平仓顺序累计交易盈亏形成的权益曲线的最大回撤（USDT）
+	AvgHoldMinutes   float64 `json:"avg_hold_minutes"`   // 平均持仓时长（分钟）
 }
 
 // SymbolPerformance 币种表现统计
@@ -341,11 +595,55 @@ type SymbolPerformance struct {
 	AvgPnL        float64 `json:"avg_pn_l"`       // 平均盈亏
 }
 
+// TradeSharpeAnnualization 逐笔夏普比率的年化因子（每年的预期交易笔数，结果乘以其平方根）
+// 默认 1 表示不年化，直接返回每笔交易级别的夏普比率
+var TradeSharpeAnnualization = 1.0
+
+// recordFundingObservations 记录持仓快照中观察到的资金费率（结算时间 -> 结算前最后一次观察到的费率）
+func recordFundingObservations(openPositions map[string]map[string]interface{}, record *DecisionRecord) {
+	for _, pos := range record.Positions {
+		if pos.NextFundingTime <= 0 {
+			continue
+		}
+		openPos, exists := openPositions[pos.Symbol+"_"+pos.Side]
+		if !exists {
+			continue
+		}
+		rates, _ := openPos["fundingRates"].(map[int64]float64)
+		if rates == nil {
+			rates = make(map[int64]float64)
+			openPos["fundingRates"] = rates
+		}
+		rates[pos.NextFundingTime] = pos.FundingRate
+	}
+}
+
+// estimateFundingCost 估算持仓在 (openTime, closeTime] 内各次结算的资金费成本：名义价值 × 费率之和
+// 正数为支出（费率为正时多头支付空头）；持仓期间未采集到资金费率时返回 false
+func estimateFundingCost(openPos map[string]interface{}, side string, notional float64, openTime, closeTime time.Time) (float64, bool) {
+	rates, _ := openPos["fundingRates"].(map[int64]float64)
+	if len(rates) == 0 {
+		return 0, false
+	}
+
+	rateSum := 0.0
+	for settleAt, rate := range rates {
+		if t := time.UnixMilli(settleAt); t.After(openTime) && !t.After(closeTime) {
+			rateSum += rate
+		}
+	}
+	if side == "short" {
+		return -notional * rateSum, true
+	}
+	return notional * rateSum, true
+}
+
 // getTakerFeeRate 获取交易所的Taker费率
 // 基于公开信息：
 // - Aster: Maker 0.010%, Taker 0.035%
 // - Hyperliquid: Maker 0.015%, Taker 0.045%
 // - Binance Futures: Maker 0.020%, Taker 0.050% (默认费率)
+// - Bybit: Maker 0.020%, Taker 0.055%
 func getTakerFeeRate(exchange string) float64 {
 	switch exchange {
 	case "aster":
@@ -354,40 +652,152 @@ func getTakerFeeRate(exchange string) float64 {
 		return 0.00045 // 0.045%
 	case "binance":
 		return 0.0005 // 0.050%
+	case "bybit":
+		return 0.00055 // 0.055%
 	default:
 		// 对于未知交易所，使用保守估计（Binance费率）
 		return 0.0005
 	}
 }
 
-// AnalyzePerformance 分析最近N个周期的交易表现
-func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAnalysis, error) {
+// AnalyzePerformance 分析最近N个周期的交易表现，filter 可选（只使用第一个）
+func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int, filter ...PerformanceFilter) (*PerformanceAnalysis, error) {
 	records, err := l.GetLatestRecords(lookbackCycles)
 	if err != nil {
 		return nil, fmt.Errorf("读取历史记录失败: %w", err)
 	}
 
-	if len(records) == 0 {
-		return &PerformanceAnalysis{
-			RecentTrades: []TradeOutcome{},
-			SymbolStats:  make(map[string]*SymbolPerformance),
-		}, nil
+	// 为了避免开仓记录在窗口外导致匹配失败，需要先从所有历史记录中找出未平仓的持仓
+	// 获取更多历史记录来构建完整的持仓状态（使用更大的窗口）
+	allRecords, err := l.GetLatestRecords(lookbackCycles * 3) // 扩大3倍窗口
+	if err != nil {
+		allRecords = nil
 	}
 
+	var f PerformanceFilter
+	if len(filter) > 0 {
+		f = filter[0]
+	}
+	return AnalyzeRecordsFiltered(records, allRecords, f), nil
+}
+
+// rangeOpenLookback 按时间范围分析时，向 from 之前追溯开仓记录的时长（开仓早于 from、在范围内平仓的交易）
+const rangeOpenLookback = 7 * 24 * time.Hour
+
+// AnalyzePerformanceRange 分析在 [from, to] 内平仓的交易表现（to 为零值表示到现在），filter 可选（只使用第一个）
+// 开仓早于 from 的交易从 from 之前 rangeOpenLookback 内的记录中补全开仓信息；范围内开仓、范围后平仓的交易不计入
+func (l *DecisionLogger) AnalyzePerformanceRange(from, to time.Time, filter ...PerformanceFilter) (*PerformanceAnalysis, error) {
+	if !to.IsZero() && to.Before(from) {
+		return nil, fmt.Errorf("结束时间 %s 早于开始时间 %s", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+
+	records, allRecords, err := l.readRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var f PerformanceFilter
+	if len(filter) > 0 {
+		f = filter[0]
+	}
+	return AnalyzeRecordsFiltered(records, allRecords, f), nil
+}
+
+// readRange 读取 [from, to] 内的记录及向前追溯 rangeOpenLookback 的记录（都按时间正序），to 为零值表示到现在
+func (l *DecisionLogger) readRange(from, to time.Time) (records, allRecords []*DecisionRecord, err error) {
+	// ReadRecords 从新到旧返回，分析需要从旧到新
+	allRecords, err = l.ReadRecords(0, from.Add(-rangeOpenLookback))
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+	slices.Reverse(allRecords)
+
+	for i, record := range allRecords {
+		if !to.IsZero() && record.Timestamp.After(to) {
+			allRecords = allRecords[:i]
+			break
+		}
+		if !record.Timestamp.Before(from) {
+			records = append(records, record)
+		}
+	}
+	return records, allRecords, nil
+}
+
+// applyAddToPosition 将加仓（add_position/add_short）并入已记录的持仓：开仓均价按剩余数量和加仓数量加权，
+// 开仓总量和剩余数量同时增加，开仓时间和策略标签保持第一笔的；没有开仓记录时（开仓在分析窗口之外）把加仓当作开仓
+func applyAddToPosition(openPositions map[string]map[string]interface{}, posKey, side, strategyTag string, action DecisionAction) {
+	openPos, exists := openPositions[posKey]
+	if !exists {
+		openPositions[posKey] = map[string]interface{}{
+			"side":              side,
+			"openPrice":         action.Price,
+			"openTime":          action.Timestamp,
+			"quantity":          action.Quantity,
+			"leverage":          action.Leverage,
+			"remainingQuantity": action.Quantity,
+			"reasoning":         action.Reasoning,
+			"strategyTag":       strategyTag,
+		}
+		return
+	}
+
+	openPrice, _ := openPos["openPrice"].(float64)
+	quantity, _ := openPos["quantity"].(float64)
+	remainingQty, _ := openPos["remainingQuantity"].(float64)
+	if remainingQty == 0 {
+		remainingQty = quantity
+	}
+	newRemaining := remainingQty + action.Quantity
+	if newRemaining <= 0 {
+		return
+	}
+	openPos["openPrice"] = (openPrice*remainingQty + action.Price*action.Quantity) / newRemaining
+	openPos["quantity"] = quantity + action.Quantity
+	openPos["remainingQuantity"] = newRemaining
+}
+
+// AnalyzeRecords 根据决策记录（按时间正序）分析交易表现，不依赖日志文件（回测可直接使用）
+// allRecords 为包含 records 的更大窗口，用于补全窗口外的开仓记录，可为 nil
+func AnalyzeRecords(records, allRecords []*DecisionRecord) *PerformanceAnalysis {
+	return AnalyzeRecordsFiltered(records, allRecords, PerformanceFilter{})
+}
+
+// AnalyzeRecordsFiltered 同 AnalyzeRecords，只统计符合 filter 的交易（按开仓时的策略标签匹配）
+// 夏普比率基于账户净值，不受筛选影响；逐笔风险指标（TradeSharpeRatio/MaxDrawdown/AvgHoldMinutes）只统计筛选后的交易
+func AnalyzeRecordsFiltered(records, allRecords []*DecisionRecord, filter PerformanceFilter) *PerformanceAnalysis {
+	analysis := analyzeRecords(records, allRecords, filter)
+
+	// 只保留最近的交易（倒序：最新的在前）
+	slices.Reverse(analysis.RecentTrades)
+	if len(analysis.RecentTrades) > 10 {
+		analysis.RecentTrades = analysis.RecentTrades[:10]
+	}
+	return analysis
+}
+
+// analyzeRecords 重建交易并计算统计指标，RecentTrades 为按平仓时间正序的全部交易（CSV导出使用完整列表）
+func analyzeRecords(records, allRecords []*DecisionRecord, filter PerformanceFilter) *PerformanceAnalysis {
 	analysis := &PerformanceAnalysis{
 		RecentTrades: []TradeOutcome{},
 		SymbolStats:  make(map[string]*SymbolPerformance),
 	}
 
+	if len(records) == 0 {
+		return analysis
+	}
+
 	// 追踪持仓状态：symbol_side -> {side, openPrice, openTime, quantity, leverage}
 	openPositions := make(map[string]map[string]interface{})
 
-	// 为了避免开仓记录在窗口外导致匹配失败，需要先从所有历史记录中找出未平仓的持仓
-	// 获取更多历史记录来构建完整的持仓状态（使用更大的窗口）
-	allRecords, err := l.GetLatestRecords(lookbackCycles * 3) // 扩大3倍窗口
-	if err == nil && len(allRecords) > len(records) {
-		// 先从扩大的窗口中收集所有开仓记录
+	if len(allRecords) > len(records) {
+		// 先从扩大的窗口中收集分析窗口之前的开仓记录（窗口内的记录由下面的循环处理，
+		// 否则窗口前开仓、窗口内平仓的持仓会在这里被提前移除，导致平仓时找不到开仓记录）
 		for _, record := range allRecords {
+			if !record.Timestamp.Before(records[0].Timestamp) {
+				break
+			}
+			recordFundingObservations(openPositions, record)
 			for _, action := range record.Decisions {
 				if !action.Success {
 					continue
@@ -395,9 +805,9 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 
 				symbol := action.Symbol
 				side := ""
-				if action.Action == "open_long" || action.Action == "close_long" || action.Action == "partial_close" || action.Action == "auto_close_long" {
+				if action.Action == "open_long" || action.Action == "add_position" || action.Action == "close_long" || action.Action == "partial_close" || action.Action == "auto_close_long" {
 					side = "long"
-				} else if action.Action == "open_short" || action.Action == "close_short" || action.Action == "auto_close_short" {
+				} else if action.Action == "open_short" || action.Action == "add_short" || action.Action == "close_short" || action.Action == "auto_close_short" {
 					side = "short"
 				}
 
@@ -417,12 +827,16 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 				case "open_long", "open_short":
 					// 记录开仓
 					openPositions[posKey] = map[string]interface{}{
-						"side":      side,
-						"openPrice": action.Price,
-						"openTime":  action.Timestamp,
-						"quantity":  action.Quantity,
-						"leverage":  action.Leverage,
+						"side":        side,
+						"openPrice":   action.Price,
+						"openTime":    action.Timestamp,
+						"quantity":    action.Quantity,
+						"leverage":    action.Leverage,
+						"reasoning":   action.Reasoning,
+						"strategyTag": record.StrategyTag,
 					}
+				case "add_position", "add_short":
+					applyAddToPosition(openPositions, posKey, side, record.StrategyTag, action)
 				case "close_long", "close_short", "auto_close_long", "auto_close_short":
 					// 移除已平仓记录
 					delete(openPositions, posKey)
@@ -434,6 +848,7 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 
 	// 遍历分析窗口内的记录，生成交易结果
 	for _, record := range records {
+		recordFundingObservations(openPositions, record)
 		for _, action := range record.Decisions {
 			if !action.Success {
 				continue
@@ -441,9 +856,9 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 
 			symbol := action.Symbol
 			side := ""
-			if action.Action == "open_long" || action.Action == "close_long" || action.Action == "partial_close" || action.Action == "auto_close_long" {
+			if action.Action == "open_long" || action.Action == "add_position" || action.Action == "close_long" || action.Action == "partial_close" || action.Action == "auto_close_long" {
 				side = "long"
-			} else if action.Action == "open_short" || action.Action == "close_short" || action.Action == "auto_close_short" {
+			} else if action.Action == "open_short" || action.Action == "add_short" || action.Action == "close_short" || action.Action == "auto_close_short" {
 				side = "short"
 			}
 
@@ -473,8 +888,14 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 					"accumulatedPnL":     0.0,             // 🔧 BUG FIX：累積部分平倉盈虧
 					"partialCloseCount":  0,               // 🔧 BUG FIX：部分平倉次數
 					"partialCloseVolume": 0.0,             // 🔧 BUG FIX：部分平倉總量
+					"reasoning":          action.Reasoning,
+					"strategyTag":        record.StrategyTag,
 				}
 
+			case "add_position", "add_short":
+				// 加仓并入同一笔交易，按成交量加权更新开仓均价
+				applyAddToPosition(openPositions, posKey, side, record.StrategyTag, action)
+
 			case "close_long", "close_short", "partial_close", "auto_close_long", "auto_close_short":
 				// 查找对应的开仓记录（可能来自预填充或当前窗口）
 				if openPos, exists := openPositions[posKey]; exists {
@@ -483,6 +904,8 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 					side := openPos["side"].(string)
 					quantity := openPos["quantity"].(float64)
 					leverage := openPos["leverage"].(int)
+					openReasoning, _ := openPos["reasoning"].(string)
+					strategyTag, _ := openPos["strategyTag"].(string)
 
 					// 🔧 BUG FIX：取得追蹤字段（若不存在則初始化）
 					remainingQty, _ := openPos["remainingQuantity"].(float64)
@@ -510,10 +933,30 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 					// ⚠️ 扣除交易手续费（开仓 + 平仓各一次）
 					// 获取交易所费率（从record中获取，如果没有则使用默认值）
 					feeRate := getTakerFeeRate(record.Exchange)
-					openFee := actualQuantity * openPrice * feeRate   // 开仓手续费
+					openFee := actualQuantity * openPrice * feeRate     // 开仓手续费
 					closeFee := actualQuantity * action.Price * feeRate // 平仓手续费
+					if action.Fee > 0 {
+						closeFee = action.Fee // 成交推送的实际手续费
+					}
 					totalFees := openFee + closeFee
+					grossPnL := pnl
 					pnl -= totalFees // 从盈亏中扣除手续费
+					accumulatedGross, _ := openPos["accumulatedGross"].(float64)
+					accumulatedGross += grossPnL
+					accumulatedFees, _ := openPos["accumulatedFees"].(float64)
+					accumulatedFees += totalFees
+					closeReason := "ai"
+					if strings.HasPrefix(action.Action, "auto_close_") {
+						closeReason = action.Error // 被动平仓的 Error 字段记录推断的平仓原因
+					}
+
+					// 扣除持仓期间的资金费（按本次平仓数量的开仓名义价值估算）
+					fundingCost, hasFunding := estimateFundingCost(openPos, side, actualQuantity*openPrice, openTime, action.Timestamp)
+					pnl -= fundingCost
+					accumulatedFunding, _ := openPos["accumulatedFunding"].(float64)
+					accumulatedFunding += fundingCost
+					noFundingData, _ := openPos["noFundingData"].(bool)
+					noFundingData = noFundingData || !hasFunding
 
 					// 🔧 BUG FIX：處理 partial_close 聚合邏輯
 					if action.Action == "partial_close" {
@@ -528,6 +971,10 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						openPos["accumulatedPnL"] = accumulatedPnL
 						openPos["partialCloseCount"] = partialCloseCount
 						openPos["partialCloseVolume"] = partialCloseVolume
+						openPos["accumulatedFunding"] = accumulatedFunding
+						openPos["noFundingData"] = noFundingData
+						openPos["accumulatedGross"] = accumulatedGross
+						openPos["accumulatedFees"] = accumulatedFees
 
 						// 判斷是否已完全平倉
 						if remainingQty <= 0.0001 { // 使用小閾值避免浮點誤差
@@ -540,21 +987,33 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 							}
 
 							outcome := TradeOutcome{
-								Symbol:        symbol,
-								Side:          side,
-								Quantity:      quantity, // 使用原始總量
-								Leverage:      leverage,
-								OpenPrice:     openPrice,
-								ClosePrice:    action.Price, // 最後一次平倉價格
-								PositionValue: positionValue,
-								MarginUsed:    marginUsed,
-								PnL:           accumulatedPnL, // 🔧 使用累積盈虧
-								PnLPct:        pnlPct,
-								Duration:      action.Timestamp.Sub(openTime).String(),
-								OpenTime:      openTime,
-								CloseTime:     action.Timestamp,
+								Symbol:         symbol,
+								Side:           side,
+								Quantity:       quantity, // 使用原始總量
+								Leverage:       leverage,
+								OpenPrice:      openPrice,
+								ClosePrice:     action.Price, // 最後一次平倉價格
+								PositionValue:  positionValue,
+								MarginUsed:     marginUsed,
+								PnL:            accumulatedPnL, // 🔧 使用累積盈虧
+								PnLPct:         pnlPct,
+								Duration:       action.Timestamp.Sub(openTime).String(),
+								OpenTime:       openTime,
+								CloseTime:      action.Timestamp,
+								OpenReasoning:  openReasoning,
+								CloseReasoning: action.Reasoning,
+								FundingCost:    accumulatedFunding,
+								NoFundingData:  noFundingData,
+								StrategyTag:    strategyTag,
+								GrossPnL:       accumulatedGross,
+								Fees:           accumulatedFees,
+								CloseReason:    closeReason,
 							}
 
+							if !filter.match(outcome) {
+								delete(openPositions, posKey)
+								continue
+							}
 							analysis.RecentTrades = append(analysis.RecentTrades, outcome)
 							analysis.TotalTrades++ // 🔧 只在完全平倉時計數
 
@@ -600,21 +1059,33 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						}
 
 						outcome := TradeOutcome{
-							Symbol:        symbol,
-							Side:          side,
-							Quantity:      quantity, // 使用原始總量
-							Leverage:      leverage,
-							OpenPrice:     openPrice,
-							ClosePrice:    action.Price,
-							PositionValue: positionValue,
-							MarginUsed:    marginUsed,
-							PnL:           totalPnL, // 🔧 包含之前部分平倉的 PnL
-							PnLPct:        pnlPct,
-							Duration:      action.Timestamp.Sub(openTime).String(),
-							OpenTime:      openTime,
-							CloseTime:     action.Timestamp,
+							Symbol:         symbol,
+							Side:           side,
+							Quantity:       quantity, // 使用原始總量
+							Leverage:       leverage,
+							OpenPrice:      openPrice,
+							ClosePrice:     action.Price,
+							PositionValue:  positionValue,
+							MarginUsed:     marginUsed,
+							PnL:            totalPnL, // 🔧 包含之前部分平倉的 PnL
+							PnLPct:         pnlPct,
+							Duration:       action.Timestamp.Sub(openTime).String(),
+							OpenTime:       openTime,
+							CloseTime:      action.Timestamp,
+							OpenReasoning:  openReasoning,
+							CloseReasoning: action.Reasoning,
+							FundingCost:    accumulatedFunding,
+							NoFundingData:  noFundingData,
+							StrategyTag:    strategyTag,
+							GrossPnL:       accumulatedGross,
+							Fees:           accumulatedFees,
+							CloseReason:    closeReason,
 						}
 
+						if !filter.match(outcome) {
+							delete(openPositions, posKey)
+							continue
+						}
 						analysis.RecentTrades = append(analysis.RecentTrades, outcome)
 						analysis.TotalTrades++
 
@@ -694,29 +1165,77 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 		}
 	}
 
-	// 只保留最近的交易（倒序：最新的在前）
-	if len(analysis.RecentTrades) > 10 {
-		// 反转数组，让最新的在前
-		for i, j := 0, len(analysis.RecentTrades)-1; i < j; i, j = i+1, j-1 {
-			analysis.RecentTrades[i], analysis.RecentTrades[j] = analysis.RecentTrades[j], analysis.RecentTrades[i]
+	// 逐笔风险指标（RecentTrades 此时仍是按平仓时间正序的全部交易）
+	analysis.TradeSharpeRatio = calculateTradeSharpeRatio(analysis.RecentTrades, TradeSharpeAnnualization)
+	analysis.MaxDrawdown = calculateTradeMaxDrawdown(analysis.RecentTrades)
+	analysis.AvgHoldMinutes = averageHoldMinutes(analysis.RecentTrades)
+
+	// 计算夏普比率（需要至少2个数据点）
+	analysis.SharpeRatio = calculateSharpeRatio(records)
+
+	return analysis
+}
+
+// calculateTradeSharpeRatio 基于逐笔交易收益率（PnLPct，相对保证金）计算夏普比率，假设无风险利率为0
+// annualization > 0 时乘以其平方根年化；少于2笔交易或收益率无波动时返回0
+func calculateTradeSharpeRatio(trades []TradeOutcome, annualization float64) float64 {
+	if len(trades) < 2 {
+		return 0.0
+	}
+
+	meanReturn := 0.0
+	for _, trade := range trades {
+		meanReturn += trade.PnLPct / 100
+	}
+	meanReturn /= float64(len(trades))
+
+	variance := 0.0
+	for _, trade := range trades {
+		diff := trade.PnLPct/100 - meanReturn
+		variance += diff * diff
+	}
+	stdDev := math.Sqrt(variance / float64(len(trades)))
+	if stdDev == 0 {
+		return 0.0
+	}
+
+	sharpeRatio := meanReturn / stdDev
+	if annualization > 0 {
+		sharpeRatio *= math.Sqrt(annualization)
+	}
+	return sharpeRatio
+}
+
+// calculateTradeMaxDrawdown 按交易顺序累计盈亏构建权益曲线（起点为0），返回从峰值回落的最大幅度（USDT）
+func calculateTradeMaxDrawdown(trades []TradeOutcome) float64 {
+	equity, peak, maxDrawdown := 0.0, 0.0, 0.0
+	for _, trade := range trades {
+		equity += trade.PnL
+		if equity > peak {
+			peak = equity
 		}
-		analysis.RecentTrades = analysis.RecentTrades[:10]
-	} else if len(analysis.RecentTrades) > 0 {
-		// 反转数组
-		for i, j := 0, len(analysis.RecentTrades)-1; i < j; i, j = i+1, j-1 {
-			analysis.RecentTrades[i], analysis.RecentTrades[j] = analysis.RecentTrades[j], analysis.RecentTrades[i]
+		if drawdown := peak - equity; drawdown > maxDrawdown {
+			maxDrawdown = drawdown
 		}
 	}
+	return maxDrawdown
+}
 
-	// 计算夏普比率（需要至少2个数据点）
-	analysis.SharpeRatio = l.calculateSharpeRatio(records)
-
-	return analysis, nil
+// averageHoldMinutes 平均持仓时长（分钟），没有交易时返回0
+func averageHoldMinutes(trades []TradeOutcome) float64 {
+	if len(trades) == 0 {
+		return 0.0
+	}
+	var total time.Duration
+	for _, trade := range trades {
+		total += trade.CloseTime.Sub(trade.OpenTime)
+	}
+	return total.Minutes() / float64(len(trades))
 }
 
 // calculateSharpeRatio 计算夏普比率
 // 基于账户净值的变化计算风险调整后收益
-func (l *DecisionLogger) calculateSharpeRatio(records []*DecisionRecord) float64 {
+func calculateSharpeRatio(records []*DecisionRecord) float64 {
 	if len(records) < 2 {
 		return 0.0
 	}
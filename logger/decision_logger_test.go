@@ -1,6 +1,13 @@
 package logger
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -27,6 +34,11 @@ func TestGetTakerFeeRate(t *testing.T) {
 			exchange: "binance",
 			wantRate: 0.0005,
 		},
+		{
+			name:     "Bybit exchange returns 0.055% taker fee",
+			exchange: "bybit",
+			wantRate: 0.00055,
+		},
 		{
 			name:     "Unknown exchange defaults to 0.050% taker fee",
 			exchange: "unknown_exchange",
@@ -261,6 +273,479 @@ func TestAnalyzePerformance_WithFees(t *testing.T) {
 	}
 }
 
+// TestAnalyzePerformance_ActualCloseFee tests that a streamed close fee replaces the estimated close fee
+func TestAnalyzePerformance_ActualCloseFee(t *testing.T) {
+	logger := NewDecisionLogger(t.TempDir())
+	openTime := time.Now().Add(-1 * time.Hour)
+	closeTime := time.Now()
+
+	records := []*DecisionRecord{
+		{
+			Exchange: "binance", CycleNumber: 1, Timestamp: openTime, Success: true,
+			Decisions: []DecisionAction{
+				{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Leverage: 10, Price: 50000.0, Timestamp: openTime, Success: true},
+			},
+		},
+		{
+			Exchange: "binance", CycleNumber: 2, Timestamp: closeTime, Success: true,
+			Decisions: []DecisionAction{
+				{Action: "auto_close_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 49000.0, Fee: 1.5, Timestamp: closeTime, Success: true, Error: "stop_loss"},
+			},
+		},
+	}
+	for _, record := range records {
+		if err := logger.LogDecision(record); err != nil {
+			t.Fatalf("Failed to log record: %v", err)
+		}
+	}
+
+	analysis, err := logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if len(analysis.RecentTrades) != 1 {
+		t.Fatalf("Expected 1 recent trade, got %d", len(analysis.RecentTrades))
+	}
+
+	// Price diff: 0.1 * (49000 - 50000) = -100
+	// Open fee (estimated): 0.1 * 50000 * 0.0005 = 2.5
+	// Close fee (actual): 1.5
+	expected := -104.0
+	if pnl := analysis.RecentTrades[0].PnL; math.Abs(pnl-expected) > 1e-6 {
+		t.Errorf("Trade P&L = %v, want %v", pnl, expected)
+	}
+}
+
+// TestAnalyzeRecords_FundingCost tests that funding observed during the hold is deducted from P&L,
+// and trades without funding data are flagged
+func TestAnalyzeRecords_FundingCost(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return t0.Add(time.Duration(h) * time.Hour) }
+	snapshot := func(rate float64, settleHour int) []PositionSnapshot {
+		return []PositionSnapshot{{Symbol: "BTCUSDT", Side: "long", PositionAmt: 0.1, FundingRate: rate, NextFundingTime: at(settleHour).UnixMilli()}}
+	}
+
+	records := []*DecisionRecord{
+		{Exchange: "binance", Timestamp: at(0), Decisions: []DecisionAction{
+			{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Leverage: 10, Price: 50000, Timestamp: at(0), Success: true},
+			{Action: "open_short", Symbol: "ETHUSDT", Quantity: 1, Leverage: 5, Price: 3000, Timestamp: at(0), Success: true},
+		}},
+		{Exchange: "binance", Timestamp: at(1), Positions: snapshot(0.00005, 8)},
+		{Exchange: "binance", Timestamp: at(7), Positions: snapshot(0.0001, 8)},  // 同一结算取最后观察到的费率
+		{Exchange: "binance", Timestamp: at(9), Positions: snapshot(0.0002, 16)}, // 第二次结算
+		{Exchange: "binance", Timestamp: at(17), Positions: snapshot(0.0005, 24), Decisions: []DecisionAction{
+			{Action: "close_long", Symbol: "BTCUSDT", Price: 50000, Timestamp: at(17), Success: true},
+			{Action: "close_short", Symbol: "ETHUSDT", Price: 3000, Timestamp: at(17), Success: true},
+		}},
+	}
+
+	analysis := AnalyzeRecords(records, nil)
+	if len(analysis.RecentTrades) != 2 {
+		t.Fatalf("Expected 2 trades, got %d", len(analysis.RecentTrades))
+	}
+
+	feeRate := getTakerFeeRate("binance")
+	for _, trade := range analysis.RecentTrades {
+		fees := 2 * trade.PositionValue * feeRate
+		switch trade.Symbol {
+		case "BTCUSDT":
+			// 0.1 * 50000 * (0.0001 + 0.0002) = 1.5，平仓后的结算不计入
+			if math.Abs(trade.FundingCost-1.5) > 1e-9 || trade.NoFundingData {
+				t.Errorf("BTC funding = %v (no data: %v), want 1.5", trade.FundingCost, trade.NoFundingData)
+			}
+			if want := -fees - 1.5; math.Abs(trade.PnL-want) > 1e-9 {
+				t.Errorf("BTC P&L = %v, want %v", trade.PnL, want)
+			}
+		case "ETHUSDT":
+			if trade.FundingCost != 0 || !trade.NoFundingData {
+				t.Errorf("ETH funding = %v (no data: %v), want 0 and flagged", trade.FundingCost, trade.NoFundingData)
+			}
+			if math.Abs(trade.PnL+fees) > 1e-9 {
+				t.Errorf("ETH P&L = %v, want %v", trade.PnL, -fees)
+			}
+		}
+	}
+}
+
+// TestAnalyzeRecords_AddPosition 测试分两批建仓（open_long + add_position）后一次平仓：
+// 加仓并入同一笔交易，盈亏按成交量加权的开仓均价计算
+func TestAnalyzeRecords_AddPosition(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []*DecisionRecord{
+		{Exchange: "binance", Decisions: []DecisionAction{
+			{Action: "open_long", Symbol: "SOLUSDT", Quantity: 10, Leverage: 5, Price: 100, Timestamp: t0, Success: true},
+		}},
+		{Exchange: "binance", Decisions: []DecisionAction{
+			{Action: "add_position", Symbol: "SOLUSDT", Quantity: 30, Leverage: 5, Price: 120, Timestamp: t0.Add(time.Hour), Success: true},
+		}},
+		{Exchange: "binance", Decisions: []DecisionAction{
+			{Action: "close_long", Symbol: "SOLUSDT", Price: 130, Timestamp: t0.Add(2 * time.Hour), Success: true},
+		}},
+	}
+
+	analysis := AnalyzeRecords(records, nil)
+	if analysis.TotalTrades != 1 || len(analysis.RecentTrades) != 1 {
+		t.Fatalf("加仓应并入同一笔交易: trades = %d", analysis.TotalTrades)
+	}
+
+	trade := analysis.RecentTrades[0]
+	// 均价 = (10×100 + 30×120) / 40 = 115
+	if math.Abs(trade.OpenPrice-115) > 1e-9 || trade.Quantity != 40 {
+		t.Errorf("open price = %v, quantity = %v, want 115 / 40", trade.OpenPrice, trade.Quantity)
+	}
+	if !trade.OpenTime.Equal(t0) {
+		t.Errorf("开仓时间应为第一批的时间: %v", trade.OpenTime)
+	}
+	feeRate := getTakerFeeRate("binance")
+	want := 40*(130-115.0) - 40*115*feeRate - 40*130*feeRate
+	if math.Abs(trade.PnL-want) > 1e-9 {
+		t.Errorf("P&L = %v, want %v", trade.PnL, want)
+	}
+}
+
+// TestTradeRiskMetrics tests trade-based Sharpe ratio, max drawdown and average hold time against hand-computed values
+func TestTradeRiskMetrics(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	trade := func(pnl, pnlPct float64, hold time.Duration) TradeOutcome {
+		return TradeOutcome{PnL: pnl, PnLPct: pnlPct, OpenTime: t0, CloseTime: t0.Add(hold)}
+	}
+
+	// 收益率 +30%, -10%, +30%, -10%：均值 0.1，标准差 0.2 → 夏普 0.5，按每年4笔年化 → 1.0
+	trades := []TradeOutcome{
+		trade(100, 30, 30*time.Minute),
+		trade(-30, -10, 90*time.Minute),
+		trade(-50, 30, 30*time.Minute),
+		trade(40, -10, 90*time.Minute),
+		trade(-70, 30, 30*time.Minute),
+		trade(200, -10, 90*time.Minute),
+	}
+	if got := calculateTradeSharpeRatio(trades[:4], 0); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("sharpe = %v, want 0.5", got)
+	}
+	if got := calculateTradeSharpeRatio(trades[:4], 4); math.Abs(got-1.0) > 1e-9 {
+		t.Errorf("annualized sharpe = %v, want 1.0", got)
+	}
+
+	// 权益曲线 100 → 70 → 20 → 60 → -10 → 190：峰值 100 回落到 -10，最大回撤 110
+	if got := calculateTradeMaxDrawdown(trades); math.Abs(got-110) > 1e-9 {
+		t.Errorf("max drawdown = %v, want 110", got)
+	}
+	if got := averageHoldMinutes(trades); math.Abs(got-60) > 1e-9 {
+		t.Errorf("avg hold = %v minutes, want 60", got)
+	}
+
+	// 少于2笔交易或收益率无波动：夏普为0而不是 NaN/Inf
+	for name, tt := range map[string][]TradeOutcome{
+		"no trades":    nil,
+		"single trade": trades[:1],
+		"no variance":  {trade(10, 5, time.Minute), trade(10, 5, time.Minute)},
+	} {
+		if got := calculateTradeSharpeRatio(tt, 4); got != 0 {
+			t.Errorf("%s: sharpe = %v, want 0", name, got)
+		}
+	}
+	if got := calculateTradeMaxDrawdown(nil); got != 0 {
+		t.Errorf("max drawdown without trades = %v, want 0", got)
+	}
+	if got := averageHoldMinutes(nil); got != 0 {
+		t.Errorf("avg hold without trades = %v, want 0", got)
+	}
+}
+
+// TestAnalyzeRecords_RiskMetrics tests that AnalyzeRecords fills the trade-based risk metrics
+func TestAnalyzeRecords_RiskMetrics(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []*DecisionRecord{
+		{Exchange: "binance", Decisions: []DecisionAction{
+			{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Leverage: 1, Price: 100, Timestamp: t0, Success: true},
+		}},
+		{Exchange: "binance", Decisions: []DecisionAction{
+			{Action: "close_long", Symbol: "BTCUSDT", Price: 90, Timestamp: t0.Add(2 * time.Hour), Success: true},
+		}},
+	}
+
+	analysis := AnalyzeRecords(records, nil)
+	if analysis.TotalTrades != 1 {
+		t.Fatalf("trades = %d, want 1", analysis.TotalTrades)
+	}
+	if analysis.TradeSharpeRatio != 0 {
+		t.Errorf("单笔交易的夏普比率应为0, got %v", analysis.TradeSharpeRatio)
+	}
+	if loss := -analysis.RecentTrades[0].PnL; math.Abs(analysis.MaxDrawdown-loss) > 1e-9 {
+		t.Errorf("max drawdown = %v, want %v", analysis.MaxDrawdown, loss)
+	}
+	if analysis.AvgHoldMinutes != 120 {
+		t.Errorf("avg hold = %v, want 120", analysis.AvgHoldMinutes)
+	}
+}
+
+// TestAnalyzePerformance_Reasoning tests that AI rationale is truncated on storage and surfaced on trade outcomes
+func TestAnalyzePerformance_Reasoning(t *testing.T) {
+	logger := NewDecisionLogger(t.TempDir())
+	openTime := time.Now().Add(-1 * time.Hour)
+	closeTime := time.Now()
+	longReasoning := strings.Repeat("趋势", MaxReasoningLength)
+
+	records := []*DecisionRecord{
+		{
+			Exchange: "binance", Success: true,
+			Decisions: []DecisionAction{
+				{Action: "open_short", Symbol: "ETHUSDT", Quantity: 1, Leverage: 5, Price: 3000.0, Timestamp: openTime, Success: true, Reasoning: longReasoning},
+			},
+		},
+		{
+			Exchange: "binance", Success: true,
+			Decisions: []DecisionAction{
+				{Action: "close_short", Symbol: "ETHUSDT", Quantity: 1, Price: 3100.0, Timestamp: closeTime, Success: true, Reasoning: "止损离场"},
+			},
+		},
+	}
+	for _, record := range records {
+		if err := logger.LogDecision(record); err != nil {
+			t.Fatalf("Failed to log record: %v", err)
+		}
+	}
+
+	stored, err := logger.GetLatestRecords(2)
+	if err != nil || len(stored) != 2 {
+		t.Fatalf("GetLatestRecords failed: %v (%d records)", err, len(stored))
+	}
+	openReasoning := stored[0].Decisions[0].Reasoning
+	if !strings.HasPrefix(openReasoning, longReasoning[:30]) || len([]rune(openReasoning)) > MaxReasoningLength+20 {
+		t.Errorf("Expected stored reasoning truncated to ~%d chars, got %d", MaxReasoningLength, len([]rune(openReasoning)))
+	}
+
+	analysis, err := logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if len(analysis.RecentTrades) != 1 {
+		t.Fatalf("Expected 1 recent trade, got %d", len(analysis.RecentTrades))
+	}
+	trade := analysis.RecentTrades[0]
+	if trade.OpenReasoning != openReasoning {
+		t.Errorf("Expected open reasoning from the open action, got %q", trade.OpenReasoning)
+	}
+	if trade.CloseReasoning != "止损离场" {
+		t.Errorf("Expected close reasoning %q, got %q", "止损离场", trade.CloseReasoning)
+	}
+}
+
+// TestAnalyzePerformance_StrategyTag 测试按策略标签统计：交易归属开仓时的标签（平仓前标签已变化也不影响）
+func TestAnalyzePerformance_StrategyTag(t *testing.T) {
+	logger := NewDecisionLogger(t.TempDir())
+	base := time.Now().Add(-time.Hour)
+
+	trade := func(action, symbol string, price, qty float64, at time.Time) DecisionAction {
+		return DecisionAction{Action: action, Symbol: symbol, Price: price, Quantity: qty, Leverage: 1, Timestamp: at, Success: true}
+	}
+	cycles := []struct {
+		tag     string
+		actions []DecisionAction
+	}{
+		{"v1", []DecisionAction{trade("open_long", "BTCUSDT", 100, 1, base)}},
+		// prompt 已改为 v2：BTC 在 v2 周期平仓，仍归属 v1
+		{"v2", []DecisionAction{
+			trade("open_short", "ETHUSDT", 100, 1, base.Add(time.Minute)),
+			trade("close_long", "BTCUSDT", 110, 1, base.Add(time.Minute)),
+		}},
+		{"v2", []DecisionAction{trade("close_short", "ETHUSDT", 105, 1, base.Add(2*time.Minute))}},
+		{"v2", []DecisionAction{trade("open_long", "SOLUSDT", 10, 10, base.Add(3*time.Minute))}},
+		{"v2", []DecisionAction{trade("close_long", "SOLUSDT", 11, 10, base.Add(4*time.Minute))}},
+	}
+	for i, c := range cycles {
+		record := &DecisionRecord{Exchange: "binance", CycleNumber: i + 1, Timestamp: base.Add(time.Duration(i) * time.Minute),
+			Success: true, StrategyTag: c.tag, Decisions: c.actions}
+		if err := logger.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		tag         string
+		wantTrades  int
+		wantWinning int
+		wantWinRate float64
+		wantSymbols []string
+	}{
+		{tag: "", wantTrades: 3, wantWinning: 2, wantWinRate: 200.0 / 3, wantSymbols: []string{"BTCUSDT", "ETHUSDT", "SOLUSDT"}},
+		{tag: "v1", wantTrades: 1, wantWinning: 1, wantWinRate: 100, wantSymbols: []string{"BTCUSDT"}},
+		{tag: "v2", wantTrades: 2, wantWinning: 1, wantWinRate: 50, wantSymbols: []string{"ETHUSDT", "SOLUSDT"}},
+		{tag: "v3", wantTrades: 0},
+	}
+	for _, tt := range tests {
+		t.Run("tag="+tt.tag, func(t *testing.T) {
+			analysis, err := logger.AnalyzePerformance(10, PerformanceFilter{StrategyTag: tt.tag})
+			if err != nil {
+				t.Fatalf("AnalyzePerformance failed: %v", err)
+			}
+			if analysis.TotalTrades != tt.wantTrades || analysis.WinningTrades != tt.wantWinning {
+				t.Fatalf("trades = %d (winning %d), want %d (winning %d)",
+					analysis.TotalTrades, analysis.WinningTrades, tt.wantTrades, tt.wantWinning)
+			}
+			if math.Abs(analysis.WinRate-tt.wantWinRate) > 1e-9 {
+				t.Errorf("win rate = %.2f, want %.2f", analysis.WinRate, tt.wantWinRate)
+			}
+			if len(analysis.SymbolStats) != len(tt.wantSymbols) {
+				t.Errorf("symbol stats = %v, want %v", analysis.SymbolStats, tt.wantSymbols)
+			}
+			for _, symbol := range tt.wantSymbols {
+				if _, ok := analysis.SymbolStats[symbol]; !ok {
+					t.Errorf("missing symbol stats for %s", symbol)
+				}
+			}
+			for _, trade := range analysis.RecentTrades {
+				if tt.tag != "" && trade.StrategyTag != tt.tag {
+					t.Errorf("%s trade tagged %q, want %q", trade.Symbol, trade.StrategyTag, tt.tag)
+				}
+			}
+		})
+	}
+}
+
+// TestReadRecords tests newest-first reading with limit/since filters and skipping of corrupt files
+func TestReadRecords(t *testing.T) {
+	dir := t.TempDir()
+	l := NewDecisionLogger(dir).(*DecisionLogger)
+
+	base := time.Date(2025, 1, 2, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		record := DecisionRecord{Timestamp: base.Add(time.Duration(i) * time.Hour), CycleNumber: i + 1}
+		data, _ := json.Marshal(record)
+		name := fmt.Sprintf("decision_%s_cycle%d.json", record.Timestamp.Format("20060102_150405"), record.CycleNumber)
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 写了一半的记录和临时文件都应被跳过
+	os.WriteFile(filepath.Join(dir, "decision_20250102_150000_cycle5.json"), []byte(`{"cycle_number": 5, "decis`), 0600)
+	os.WriteFile(filepath.Join(dir, "decision_20250102_160000_cycle6.json.tmp"), []byte(`{}`), 0600)
+
+	cycles := func(records []*DecisionRecord) []int {
+		var result []int
+		for _, r := range records {
+			result = append(result, r.CycleNumber)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		since time.Time
+		want  []int
+	}{
+		{name: "all newest first", limit: 0, want: []int{4, 3, 2, 1}},
+		{name: "limit", limit: 2, want: []int{4, 3}},
+		{name: "since", limit: 10, since: base.Add(time.Hour), want: []int{4, 3, 2}},
+		{name: "since and limit", limit: 1, since: base.Add(90 * time.Minute), want: []int{4}},
+		{name: "since after newest", limit: 10, since: base.Add(5 * time.Hour), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := l.ReadRecords(tt.limit, tt.since)
+			if err != nil {
+				t.Fatalf("ReadRecords failed: %v", err)
+			}
+			if got := cycles(records); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Expected cycles %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestAnalyzePerformanceRange tests that only trades closed inside [from, to] are counted,
+// including trades opened before from, across two days of records
+func TestAnalyzePerformanceRange(t *testing.T) {
+	dir := t.TempDir()
+	l := NewDecisionLogger(dir)
+
+	day1 := time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	cycle := 0
+	logAction := func(at time.Time, action, symbol string, price float64) {
+		t.Helper()
+		cycle++
+		record := DecisionRecord{
+			Timestamp:   at,
+			CycleNumber: cycle,
+			Exchange:    "binance",
+			Success:     true,
+			Decisions: []DecisionAction{
+				{Action: action, Symbol: symbol, Quantity: 1, Leverage: 5, Price: price, Timestamp: at, Success: true},
+			},
+		}
+		data, _ := json.Marshal(record)
+		name := fmt.Sprintf("decision_%s_cycle%d.json", at.Format("20060102_150405"), cycle)
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 第一天开平仓：范围之前，不计入
+	logAction(day1.Add(10*time.Hour), "open_long", "BTCUSDT", 100)
+	logAction(day1.Add(12*time.Hour), "close_long", "BTCUSDT", 110)
+	// 第一天开仓、第二天平仓：计入
+	logAction(day1.Add(22*time.Hour), "open_short", "ETHUSDT", 100)
+	logAction(day2.Add(2*time.Hour), "close_short", "ETHUSDT", 90)
+	// 第二天开平仓：计入
+	logAction(day2.Add(10*time.Hour), "open_long", "SOLUSDT", 100)
+	logAction(day2.Add(11*time.Hour), "close_long", "SOLUSDT", 95)
+	// 第二天开仓、范围之后平仓：不计入
+	logAction(day2.Add(20*time.Hour), "open_long", "BNBUSDT", 100)
+	logAction(day2.Add(25*time.Hour), "close_long", "BNBUSDT", 120)
+
+	analysis, err := l.AnalyzePerformanceRange(day2, day2.Add(24*time.Hour-time.Second))
+	if err != nil {
+		t.Fatalf("AnalyzePerformanceRange failed: %v", err)
+	}
+	if analysis.TotalTrades != 2 || analysis.WinningTrades != 1 || analysis.LosingTrades != 1 {
+		t.Fatalf("Expected 2 trades (1 win, 1 loss) closed on day 2, got total=%d win=%d loss=%d",
+			analysis.TotalTrades, analysis.WinningTrades, analysis.LosingTrades)
+	}
+	var symbols []string
+	for _, trade := range analysis.RecentTrades {
+		symbols = append(symbols, trade.Symbol)
+	}
+	slices.Sort(symbols)
+	if fmt.Sprint(symbols) != "[ETHUSDT SOLUSDT]" {
+		t.Errorf("Expected ETHUSDT and SOLUSDT trades, got %v", symbols)
+	}
+	eth := analysis.SymbolStats["ETHUSDT"]
+	if eth == nil || eth.TotalPnL <= 9 || eth.TotalPnL >= 10 {
+		t.Errorf("ETHUSDT short opened before range should be matched with fees deducted, got %+v", eth)
+	}
+
+	// to 为零值表示到现在：范围之后平仓的 BNBUSDT 也计入
+	analysis, err = l.AnalyzePerformanceRange(day2, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.TotalTrades != 3 {
+		t.Errorf("Expected 3 trades closed since day 2, got %d", analysis.TotalTrades)
+	}
+
+	if _, err := l.AnalyzePerformanceRange(day2, day1); err == nil {
+		t.Error("Expected error when to is before from")
+	}
+}
+
+// TestTruncateReasoning tests rune-safe truncation of AI rationale
+func TestTruncateReasoning(t *testing.T) {
+	if got := TruncateReasoning("short"); got != "short" {
+		t.Errorf("Short reasoning should be unchanged, got %q", got)
+	}
+	long := strings.Repeat("涨", MaxReasoningLength+1)
+	got := TruncateReasoning(long)
+	if !strings.HasPrefix(got, strings.Repeat("涨", MaxReasoningLength)) || !strings.HasSuffix(got, "...(已截断)") {
+		t.Errorf("Expected truncated reasoning with marker, got %d runes", len([]rune(got)))
+	}
+	if strings.Count(got, "涨") != MaxReasoningLength {
+		t.Errorf("Expected %d runes kept, got %d", MaxReasoningLength, strings.Count(got, "涨"))
+	}
+}
+
 // TestAnalyzePerformance_PartialCloseWithFees tests partial close fee accumulation
 func TestAnalyzePerformance_PartialCloseWithFees(t *testing.T) {
 	logger := NewDecisionLogger(t.TempDir())
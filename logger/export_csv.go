@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// csvHeader CSV导出的表头（每笔已平仓交易一行）
+var csvHeader = []string{
+	"symbol", "side", "open_time", "close_time", "open_price", "close_price", "quantity", "leverage",
+	"gross_pnl", "fees", "funding", "net_pnl", "hold_minutes", "close_reason", "prompt_version",
+}
+
+// ExportCSV 将在 [from, to] 内平仓的交易按平仓时间正序写为CSV（to 为零值表示到现在），供表格软件分析
+// 交易重建与 AnalyzePerformanceRange 相同；时间统一按UTC的RFC3339格式输出，prompt_version 为开仓时的策略标签
+func (l *DecisionLogger) ExportCSV(w io.Writer, from, to time.Time) error {
+	if !to.IsZero() && to.Before(from) {
+		return fmt.Errorf("结束时间 %s 早于开始时间 %s", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+	records, allRecords, err := l.readRange(from, to)
+	if err != nil {
+		return err
+	}
+	return writeTradesCSV(w, analyzeRecords(records, allRecords, PerformanceFilter{}).RecentTrades)
+}
+
+// writeTradesCSV 将交易结果写为CSV（含表头）
+func writeTradesCSV(w io.Writer, trades []TradeOutcome) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, t := range trades {
+		row := []string{
+			t.Symbol,
+			t.Side,
+			t.OpenTime.UTC().Format(time.RFC3339),
+			t.CloseTime.UTC().Format(time.RFC3339),
+			formatCSVFloat(t.OpenPrice),
+			formatCSVFloat(t.ClosePrice),
+			formatCSVFloat(t.Quantity),
+			strconv.Itoa(t.Leverage),
+			formatCSVFloat(t.GrossPnL),
+			formatCSVFloat(t.Fees),
+			formatCSVFloat(t.FundingCost),
+			formatCSVFloat(t.PnL),
+			formatCSVFloat(t.CloseTime.Sub(t.OpenTime).Minutes()),
+			t.CloseReason,
+			t.StrategyTag,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatCSVFloat 保留至多8位小数，去掉浮点误差产生的长尾（如 0.30000000000000004）
+func formatCSVFloat(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e8)/1e8, 'f', -1, 64)
+}
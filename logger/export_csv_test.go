@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExportCSV tests the header row and the values of a known trade, with times formatted in UTC
+func TestExportCSV(t *testing.T) {
+	dir := t.TempDir()
+	l := NewDecisionLogger(dir)
+
+	start := time.Date(2025, 1, 2, 22, 0, 0, 0, time.UTC)
+	cycle := 0
+	logAction := func(at time.Time, strategyTag string, action DecisionAction) {
+		t.Helper()
+		cycle++
+		action.Timestamp = at
+		action.Success = true
+		record := DecisionRecord{
+			Timestamp:   at,
+			CycleNumber: cycle,
+			Exchange:    "binance",
+			Success:     true,
+			StrategyTag: strategyTag,
+			Decisions:   []DecisionAction{action},
+		}
+		data, _ := json.Marshal(record)
+		name := fmt.Sprintf("decision_%s_cycle%d.json", at.Local().Format("20060102_150405"), cycle)
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 空单止盈被动平仓：价格盈亏 10，手续费 (100+90)×0.05%
+	logAction(start, "v2", DecisionAction{Action: "open_short", Symbol: "ETHUSDT", Quantity: 1, Leverage: 5, Price: 100})
+	logAction(start.Add(4*time.Hour), "v3", DecisionAction{Action: "auto_close_short", Symbol: "ETHUSDT", Quantity: 1, Price: 90, Error: "take_profit"})
+	// AI平仓
+	logAction(start.Add(5*time.Hour), "v3", DecisionAction{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.5, Leverage: 10, Price: 200})
+	logAction(start.Add(5*time.Hour+30*time.Minute), "v3", DecisionAction{Action: "close_long", Symbol: "BTCUSDT", Price: 190})
+
+	var buf bytes.Buffer
+	if err := l.ExportCSV(&buf, start.Add(-time.Hour), time.Time{}); err != nil {
+		t.Fatalf("ExportCSV failed: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected header + 2 trades, got %d rows: %v", len(rows), rows)
+	}
+
+	wantHeader := "symbol,side,open_time,close_time,open_price,close_price,quantity,leverage,gross_pnl,fees,funding,net_pnl,hold_minutes,close_reason,prompt_version"
+	if got := strings.Join(rows[0], ","); got != wantHeader {
+		t.Errorf("header = %s, want %s", got, wantHeader)
+	}
+	wantETH := "ETHUSDT,short,2025-01-02T22:00:00Z,2025-01-03T02:00:00Z,100,90,1,5,10,0.095,0,9.905,240,take_profit,v2"
+	if got := strings.Join(rows[1], ","); got != wantETH {
+		t.Errorf("ETHUSDT row = %s, want %s", got, wantETH)
+	}
+	if rows[2][0] != "BTCUSDT" || rows[2][8] != "-5" || rows[2][12] != "30" || rows[2][13] != "ai" {
+		t.Errorf("BTCUSDT row = %v, want gross_pnl=-5 hold_minutes=30 close_reason=ai", rows[2])
+	}
+
+	// 范围之后平仓的交易不导出，只有表头
+	buf.Reset()
+	if err := l.ExportCSV(&buf, start.Add(-time.Hour), start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != wantHeader {
+		t.Errorf("Expected only the header, got %q", got)
+	}
+
+	if err := l.ExportCSV(&buf, start, start.Add(-time.Hour)); err == nil {
+		t.Error("Expected error when to is before from")
+	}
+}
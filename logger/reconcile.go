@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DefaultReconcileTolerance 推算盈亏与交易所流水之差的默认容差（USDT）
+const DefaultReconcileTolerance = 1.0
+
+// ExchangeIncome 交易所记录的一笔资金流水（已实现盈亏、手续费或资金费）
+type ExchangeIncome struct {
+	Symbol string
+	Type   string  // REALIZED_PNL / COMMISSION / FUNDING_FEE
+	Amount float64 // 正数为收入，负数为支出
+	Time   time.Time
+}
+
+// SymbolReconciliation 单个币种的盈亏核对结果
+type SymbolReconciliation struct {
+	Symbol         string  `json:"symbol"`
+	InferredPnL    float64 `json:"inferred_pnl"`    // 根据日志开平仓价格推算的净盈亏（已扣手续费和资金费估算）
+	ExchangePnL    float64 `json:"exchange_pnl"`    // 交易所流水净盈亏（已实现盈亏 + 手续费 + 资金费）
+	Difference     float64 `json:"difference"`      // ExchangePnL - InferredPnL
+	HasDiscrepancy bool    `json:"has_discrepancy"` // 差值超过容差
+}
+
+// PnLReconciliation 日志推算盈亏与交易所资金流水的核对结果
+type PnLReconciliation struct {
+	Since              time.Time              `json:"since"`
+	InferredPnL        float64                `json:"inferred_pnl"`        // 日志推算的净盈亏合计
+	ExchangeRealized   float64                `json:"exchange_realized"`   // 交易所已实现盈亏合计（不含手续费和资金费）
+	ExchangeCommission float64                `json:"exchange_commission"` // 交易所实际收取的手续费（负数为支出）
+	ExchangeFunding    float64                `json:"exchange_funding"`    // 交易所实际结算的资金费（负数为支出）
+	ExchangePnL        float64                `json:"exchange_pnl"`        // 交易所净盈亏（以此为准）
+	Difference         float64                `json:"difference"`          // ExchangePnL - InferredPnL
+	Tolerance          float64                `json:"tolerance"`           // 判定差异的容差（USDT）
+	HasDiscrepancy     bool                   `json:"has_discrepancy"`     // 合计或任一币种差值超过容差
+	Symbols            []SymbolReconciliation `json:"symbols"`             // 各币种核对结果（差值绝对值从大到小）
+}
+
+// ReconcilePnL 将表现分析中各币种已平仓交易的推算盈亏与交易所流水逐币种核对
+// 交易所流水是真实结果（包含部分成交、实际手续费和资金费），推算值仅作对照；
+// 仍持仓的币种会有资金费流水而没有已平仓交易，差异会被如实标记
+func ReconcilePnL(analysis *PerformanceAnalysis, income []ExchangeIncome, since time.Time, tolerance float64) *PnLReconciliation {
+	if tolerance <= 0 {
+		tolerance = DefaultReconcileTolerance
+	}
+	result := &PnLReconciliation{Since: since, Tolerance: tolerance, Symbols: []SymbolReconciliation{}}
+
+	bySymbol := make(map[string]*SymbolReconciliation)
+	get := func(symbol string) *SymbolReconciliation {
+		if _, ok := bySymbol[symbol]; !ok {
+			bySymbol[symbol] = &SymbolReconciliation{Symbol: symbol}
+		}
+		return bySymbol[symbol]
+	}
+
+	if analysis != nil {
+		for symbol, stats := range analysis.SymbolStats {
+			get(symbol).InferredPnL = stats.TotalPnL
+			result.InferredPnL += stats.TotalPnL
+		}
+	}
+
+	for _, item := range income {
+		if item.Time.Before(since) {
+			continue
+		}
+		switch item.Type {
+		case "REALIZED_PNL":
+			result.ExchangeRealized += item.Amount
+		case "COMMISSION":
+			result.ExchangeCommission += item.Amount
+		case "FUNDING_FEE":
+			result.ExchangeFunding += item.Amount
+		default:
+			continue
+		}
+		get(item.Symbol).ExchangePnL += item.Amount
+		result.ExchangePnL += item.Amount
+	}
+
+	for _, sym := range bySymbol {
+		sym.Difference = sym.ExchangePnL - sym.InferredPnL
+		sym.HasDiscrepancy = math.Abs(sym.Difference) > tolerance
+		result.HasDiscrepancy = result.HasDiscrepancy || sym.HasDiscrepancy
+		result.Symbols = append(result.Symbols, *sym)
+	}
+	sort.Slice(result.Symbols, func(i, j int) bool {
+		di, dj := math.Abs(result.Symbols[i].Difference), math.Abs(result.Symbols[j].Difference)
+		if di != dj {
+			return di > dj
+		}
+		return result.Symbols[i].Symbol < result.Symbols[j].Symbol
+	})
+
+	result.Difference = result.ExchangePnL - result.InferredPnL
+	result.HasDiscrepancy = result.HasDiscrepancy || math.Abs(result.Difference) > tolerance
+	return result
+}
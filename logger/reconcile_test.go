@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestReconcilePnL 测试推算盈亏与交易所流水按币种核对、区间过滤及超出容差的标记
+func TestReconcilePnL(t *testing.T) {
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	analysis := &PerformanceAnalysis{SymbolStats: map[string]*SymbolPerformance{
+		"BTCUSDT": {Symbol: "BTCUSDT", TotalPnL: 95.0},
+		"ETHUSDT": {Symbol: "ETHUSDT", TotalPnL: -20.0},
+	}}
+	income := []ExchangeIncome{
+		{Symbol: "BTCUSDT", Type: "REALIZED_PNL", Amount: 100, Time: since.Add(time.Hour)},
+		{Symbol: "BTCUSDT", Type: "COMMISSION", Amount: -4.5, Time: since.Add(time.Hour)},
+		{Symbol: "ETHUSDT", Type: "REALIZED_PNL", Amount: -10, Time: since.Add(2 * time.Hour)},
+		{Symbol: "ETHUSDT", Type: "FUNDING_FEE", Amount: -2, Time: since.Add(3 * time.Hour)},
+		{Symbol: "BTCUSDT", Type: "REALIZED_PNL", Amount: 500, Time: since.Add(-time.Hour)}, // 区间之前，忽略
+		{Symbol: "BTCUSDT", Type: "TRANSFER", Amount: 1000, Time: since.Add(time.Hour)},     // 非盈亏流水，忽略
+	}
+
+	result := ReconcilePnL(analysis, income, since, 1.0)
+
+	approx := func(name string, got, want float64) {
+		t.Helper()
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	approx("InferredPnL", result.InferredPnL, 75)
+	approx("ExchangeRealized", result.ExchangeRealized, 90)
+	approx("ExchangeCommission", result.ExchangeCommission, -4.5)
+	approx("ExchangeFunding", result.ExchangeFunding, -2)
+	approx("ExchangePnL", result.ExchangePnL, 83.5)
+	approx("Difference", result.Difference, 8.5)
+	if !result.HasDiscrepancy {
+		t.Error("合计差值超过容差，应标记差异")
+	}
+
+	if len(result.Symbols) != 2 {
+		t.Fatalf("Symbols = %d, want 2", len(result.Symbols))
+	}
+	// 按差值绝对值排序：ETH 差 8，BTC 差 0.5
+	eth, btc := result.Symbols[0], result.Symbols[1]
+	if eth.Symbol != "ETHUSDT" || !eth.HasDiscrepancy {
+		t.Errorf("ETH 应排在首位并标记差异: %+v", eth)
+	}
+	approx("ETH Difference", eth.Difference, 8)
+	if btc.HasDiscrepancy {
+		t.Errorf("BTC 差值 %v 在容差内，不应标记", btc.Difference)
+	}
+}
@@ -0,0 +1,179 @@
+// Package logging 提供基于 log/slog 的结构化日志：本地开发使用易读的文本格式，生产环境使用JSON格式，
+// 由环境变量 LOG_FORMAT 选择。交易执行、AI调用等路径通过统一的字段（trader_id、user_id、exchange、cycle）
+// 关联同一交易员、同一周期的日志
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 统一的日志字段名
+const (
+	KeyTraderID = "trader_id"
+	KeyUserID   = "user_id"
+	KeyExchange = "exchange"
+	KeyCycle    = "cycle"
+)
+
+// 日志格式
+const (
+	FormatText = "text" // 易读的单行文本（本地开发，默认）
+	FormatJSON = "json" // 每行一个JSON对象（生产环境，便于日志平台检索）
+)
+
+var current atomic.Pointer[slog.Logger]
+
+// Logger 返回全局结构化日志（未调用 Init 时为文本格式、info级别、输出到stdout）
+func Logger() *slog.Logger {
+	if l := current.Load(); l != nil {
+		return l
+	}
+	return defaultLogger()
+}
+
+var defaultLogger = sync.OnceValue(func() *slog.Logger {
+	return slog.New(NewHandler(os.Stdout, FormatText, slog.LevelInfo))
+})
+
+// Init 按环境变量 LOG_FORMAT（text/json）和 LOG_LEVEL（debug/info/warn/error）初始化全局结构化日志
+// JSON格式下同时替换标准库 log 的输出，尚未迁移的 log.Printf 日志也以JSON输出
+func Init() *slog.Logger {
+	format := parseFormat(os.Getenv("LOG_FORMAT"))
+	level := parseLevel(os.Getenv("LOG_LEVEL"))
+	l := slog.New(NewHandler(os.Stdout, format, level))
+	current.Store(l)
+	if format == FormatJSON {
+		slog.SetDefault(l)
+	}
+	l.Info("📝 结构化日志已初始化", "format", format, "level", level.String())
+	return l
+}
+
+// NewHandler 创建指定格式的日志处理器（未知格式按文本处理）
+func NewHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	if parseFormat(format) == FormatJSON {
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	}
+	return &textHandler{w: w, level: level, mu: &sync.Mutex{}}
+}
+
+func parseFormat(s string) string {
+	if strings.EqualFold(strings.TrimSpace(s), FormatJSON) {
+		return FormatJSON
+	}
+	return FormatText
+}
+
+func parseLevel(s string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// textHandler 易读的单行文本格式：时间 级别 消息 key=value...，字段顺序与添加顺序一致
+type textHandler struct {
+	w      io.Writer
+	level  slog.Leveler
+	mu     *sync.Mutex
+	attrs  []slog.Attr
+	groups []string
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Time.Format("2006/01/02 15:04:05"))
+	b.WriteByte(' ')
+	b.WriteString(levelLabel(r.Level))
+	b.WriteByte(' ')
+	b.WriteString(r.Message)
+	for _, a := range h.attrs {
+		writeAttr(&b, "", a)
+	}
+	prefix := strings.Join(h.groups, ".")
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, prefix, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	clone := *h
+	clone.attrs = append([]slog.Attr(nil), h.attrs...)
+	prefix := strings.Join(h.groups, ".")
+	for _, a := range attrs {
+		if prefix != "" {
+			a.Key = prefix + "." + a.Key
+		}
+		clone.attrs = append(clone.attrs, a)
+	}
+	return &clone
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.groups = append(append([]string(nil), h.groups...), name)
+	return &clone
+}
+
+func levelLabel(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARN"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	key := a.Key
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, key, ga)
+		}
+		return
+	}
+	value := a.Value.String()
+	if strings.ContainsAny(value, " \t\n\"=") || value == "" {
+		value = fmt.Sprintf("%q", value)
+	}
+	b.WriteByte(' ')
+	b.WriteString(key)
+	b.WriteByte('=')
+	b.WriteString(value)
+}
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestNewHandler_JSON JSON格式每行一个对象，携带统一字段
+func TestNewHandler_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, "JSON", slog.LevelInfo)).
+		With(KeyTraderID, "trader-1", KeyUserID, "user-1", KeyExchange, "binance")
+	l.With(KeyCycle, 7).Info("✓ 开仓成功", "symbol", "BTCUSDT", "quantity", 0.01)
+	l.Debug("低于级别不输出")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("应输出1行，实际 %d 行: %q", len(lines), buf.String())
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("应为JSON: %v", err)
+	}
+	want := map[string]any{
+		"msg":       "✓ 开仓成功",
+		"level":     "INFO",
+		KeyTraderID: "trader-1",
+		KeyUserID:   "user-1",
+		KeyExchange: "binance",
+		KeyCycle:    float64(7),
+		"symbol":    "BTCUSDT",
+		"quantity":  0.01,
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s = %v，期望 %v", k, entry[k], v)
+		}
+	}
+}
+
+// TestNewHandler_Text 文本格式为单行 key=value，包含空格的值加引号，未知格式按文本处理
+func TestNewHandler_Text(t *testing.T) {
+	for _, format := range []string{"text", "", "pretty"} {
+		var buf bytes.Buffer
+		l := slog.New(NewHandler(&buf, format, slog.LevelInfo)).With(KeyTraderID, "trader-1")
+		l.With(KeyCycle, 3).WithGroup("order").Warn("⚠️ 执行决策失败", "symbol", "ETHUSDT", "error", "insufficient margin")
+
+		out := buf.String()
+		if strings.HasPrefix(strings.TrimSpace(out), "{") {
+			t.Fatalf("format=%q 不应输出JSON: %s", format, out)
+		}
+		for _, want := range []string{
+			"WARN ⚠️ 执行决策失败",
+			"trader_id=trader-1 cycle=3",
+			"order.symbol=ETHUSDT",
+			`order.error="insufficient margin"`,
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("format=%q 输出缺少 %q: %s", format, want, out)
+			}
+		}
+		if strings.Count(out, "\n") != 1 {
+			t.Errorf("format=%q 应为单行: %q", format, out)
+		}
+	}
+}
+
+// TestInit 按环境变量选择格式和级别
+func TestInit(t *testing.T) {
+	t.Setenv("LOG_FORMAT", "json")
+	t.Setenv("LOG_LEVEL", "warn")
+	defer current.Store(nil)
+	defer slog.SetDefault(slog.Default())
+
+	l := Init()
+	if Logger() != l {
+		t.Fatal("Logger 应返回 Init 创建的日志")
+	}
+	if _, ok := l.Handler().(*slog.JSONHandler); !ok {
+		t.Errorf("LOG_FORMAT=json 应使用 JSONHandler，实际 %T", l.Handler())
+	}
+	if l.Enabled(context.Background(), slog.LevelInfo) || !l.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("LOG_LEVEL=warn 应只输出 warn 及以上级别")
+	}
+}
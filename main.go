@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -8,14 +9,18 @@ import (
 	"nofx/auth"
 	"nofx/config"
 	"nofx/crypto"
+	"nofx/logger"
+	"nofx/logging"
 	"nofx/manager"
 	"nofx/market"
 	"nofx/pool"
+	"nofx/trader"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -35,7 +40,22 @@ type ConfigFile struct {
 	Leverage           config.LeverageConfig `json:"leverage"`
 	JWTSecret          string                `json:"jwt_secret"`
 	DataKLineTime      string                `json:"data_k_line_time"`
-	Log                *config.LogConfig     `json:"log"` // 日志配置
+	KlineHistory       map[string]int        `json:"kline_history"`           // 各周期保留的K线数量，如 {"4h": 250}（未配置默认100）
+	KlineIntervals     []string              `json:"kline_intervals"`         // 额外订阅的K线周期，如 ["1h", "15m"]（3m/4h 始终订阅）
+	DepthBandPct       float64               `json:"depth_band_pct"`          // 盘口买卖比统计的价格带（中间价上下百分比，未配置默认0.5）
+	RegimeHighVolATR   float64               `json:"regime_high_vol_atr_pct"` // BTC 4小时ATR占价格的百分比达到该值视为极端波动（未配置默认3）
+	Log                *config.LogConfig     `json:"log"`                     // 日志配置
+	// 逐笔夏普比率的年化因子（每年预期交易笔数，未配置不年化）
+	TradeSharpeFactor float64 `json:"sharpe_annualization"`
+	// 决策日志写入目标：file（默认）/ db（只写数据库，失败回退文件）/ both
+	DecisionLogSink string `json:"decision_log_sink"`
+	// 系统杠杆上限：交易员配置和AI决策的杠杆都截断到该值（未配置默认50，负数表示不限制）
+	MaxAllowedLeverage int `json:"max_allowed_leverage"`
+	// 同一交易所账户上所有交易员合计的保证金占用上限（占净值百分比，未配置不限制）
+	MaxAccountMarginPct float64 `json:"max_account_margin_pct"`
+	// 行情组合流地址（ws/wss，未配置使用币安合约主网）和代理（未配置使用环境变量 HTTPS_PROXY）
+	WSStreamURL string `json:"ws_stream_url"`
+	WSProxyURL  string `json:"ws_proxy_url"`
 }
 
 // loadConfigFile 读取并解析config.json文件
@@ -160,6 +180,9 @@ func main() {
 	// In Docker Compose, variables are injected by the runtime and this is harmless.
 	_ = godotenv.Load()
 
+	// 初始化结构化日志（LOG_FORMAT=json 用于生产环境，默认易读文本格式）
+	logging.Init()
+
 	// 初始化数据库配置
 	dbPath := "config.db"
 	if len(os.Args) > 1 {
@@ -262,8 +285,17 @@ func main() {
 		log.Printf("✓ 已配置OI Top API")
 	}
 
+	// 系统杠杆上限需在创建交易员之前设置
+	if configFile.MaxAllowedLeverage != 0 {
+		trader.MaxAllowedLeverage = configFile.MaxAllowedLeverage
+	}
+
 	// 创建TraderManager
 	traderManager := manager.NewTraderManager()
+	if configFile.MaxAccountMarginPct > 0 {
+		traderManager.SetAccountMarginLimit(configFile.MaxAccountMarginPct)
+		log.Printf("✓ 账户保证金占用上限: %.1f%%（同一交易所账户上的交易员合计）", configFile.MaxAccountMarginPct)
+	}
 
 	// 从数据库加载所有交易员到内存
 	err = traderManager.LoadTradersFromDatabase(database)
@@ -346,14 +378,37 @@ func main() {
 	}()
 
 	// 启动流行情数据 - 默认使用所有交易员设置的币种 如果没有设置币种 则优先使用系统默认
-	go market.NewWSMonitor(150).Start(database.GetCustomCoins())
+	wsMonitor := market.NewWSMonitor(150, configFile.KlineIntervals, market.StreamConfig{
+		URL:      configFile.WSStreamURL,
+		ProxyURL: configFile.WSProxyURL,
+	})
+	for interval, bars := range configFile.KlineHistory {
+		wsMonitor.SetKlineHistory(interval, bars)
+	}
+	if configFile.DepthBandPct > 0 {
+		market.DepthBandPct = configFile.DepthBandPct
+	}
+	if configFile.RegimeHighVolATR > 0 {
+		market.RegimeHighVolATRPct = configFile.RegimeHighVolATR
+	}
+	if configFile.TradeSharpeFactor > 0 {
+		logger.TradeSharpeAnnualization = configFile.TradeSharpeFactor
+	}
+	if configFile.DecisionLogSink != "" {
+		if logger.ValidSink(configFile.DecisionLogSink) {
+			logger.DecisionLogSink = configFile.DecisionLogSink
+		} else {
+			log.Printf("⚠️  无效的 decision_log_sink: %s，使用默认的文件日志", configFile.DecisionLogSink)
+		}
+	}
+	go wsMonitor.Start(database.GetCustomCoins())
 	//go market.NewWSMonitor(150).Start([]string{}) //这里是一个使用方式 传入空的话 则使用market市场的所有币种
 	// 设置优雅退出
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	// TODO: 启动数据库中配置为运行状态的交易员
-	// traderManager.StartAll()
+	// 启动数据库中配置为运行状态的交易员（用户暂停的交易员保持空闲）
+	traderManager.StartRunningOnly()
 
 	// 等待退出信号
 	<-sigChan
@@ -363,7 +418,9 @@ func main() {
 
 	// 步骤 1: 停止所有交易员
 	log.Println("⏸️  停止所有交易员...")
-	traderManager.StopAll()
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), 60*time.Second)
+	traderManager.StopAll(stopCtx)
+	cancelStop()
 	log.Println("✅ 所有交易员已停止")
 
 	// 步骤 2: 关闭 API 服务器
@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"log"
+	"nofx/trader"
+)
+
+// eventBufferSize 每个订阅者的事件缓冲区大小，订阅者消费过慢时超出部分直接丢弃
+const eventBufferSize = 64
+
+// ManagerEvent 管理器对外推送的交易员状态变化事件
+type ManagerEvent = trader.Event
+
+// Subscribe 订阅所有交易员的状态变化事件（启动/停止/开平仓/熔断）
+// 推送是非阻塞的：缓冲区满时丢弃新事件，不会拖慢交易主流程
+func (tm *TraderManager) Subscribe() <-chan ManagerEvent {
+	ch := make(chan ManagerEvent, eventBufferSize)
+	tm.eventMu.Lock()
+	tm.subscribers = append(tm.subscribers, ch)
+	tm.eventMu.Unlock()
+	return ch
+}
+
+// Unsubscribe 取消订阅并关闭对应的通道
+func (tm *TraderManager) Unsubscribe(sub <-chan ManagerEvent) {
+	tm.eventMu.Lock()
+	defer tm.eventMu.Unlock()
+	for i, ch := range tm.subscribers {
+		if ch == sub {
+			tm.subscribers = append(tm.subscribers[:i], tm.subscribers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+// publishEvent 向所有订阅者推送事件（作为 AutoTraderConfig.OnEvent 注入到每个交易员）
+func (tm *TraderManager) publishEvent(event trader.Event) {
+	tm.eventMu.Lock()
+	defer tm.eventMu.Unlock()
+	for _, ch := range tm.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("⚠️ 事件订阅者处理过慢，丢弃事件: %s %s", event.TraderID, event.Type)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package manager
+
+import (
+	"fmt"
+	"nofx/clock"
+	"nofx/trader"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exposureReportLag 账户快照相对真实账户的最大滞后（交易所客户端的余额/持仓缓存约15秒）
+// 早于 快照时间-滞后 的预占保证金视为已反映在快照的已用保证金中
+const exposureReportLag = 30 * time.Second
+
+// ExposureTracker 跨交易员的账户保证金占用跟踪：同一用户使用同一交易所配置（同一套API凭证）的交易员共用一个账户，
+// 各交易员开仓前合计检查账户保证金占用，避免各自在限额内、合计却过度加杠杆
+type ExposureTracker struct {
+	mu             sync.Mutex
+	clock          clock.Clock // 时间源（nil 使用系统时间）
+	maxMarginPct   float64     // 账户保证金占用上限（占净值百分比，<=0 表示不限制）
+	accounts       map[string]*accountExposure
+	traderAccounts map[string]string // trader ID -> 账户 key
+}
+
+// accountExposure 单个交易所账户的最近快照和尚未反映在快照中的预占保证金
+type accountExposure struct {
+	equity       float64
+	marginUsed   float64
+	reportedAt   time.Time
+	reservations []exposureReservation
+}
+
+type exposureReservation struct {
+	traderID string
+	margin   float64
+	at       time.Time
+}
+
+// NewExposureTracker 创建账户保证金跟踪（maxMarginPct<=0 表示只跟踪不限制）
+func NewExposureTracker(maxMarginPct float64) *ExposureTracker {
+	return &ExposureTracker{
+		clock:          clock.Real,
+		maxMarginPct:   maxMarginPct,
+		accounts:       make(map[string]*accountExposure),
+		traderAccounts: make(map[string]string),
+	}
+}
+
+// exposureAccountKey 账户 key：同一用户的同一交易所配置
+func exposureAccountKey(userID, exchangeID string) string {
+	return userID + "/" + exchangeID
+}
+
+// SetMaxMarginPct 设置账户保证金占用上限（占净值百分比，<=0 表示不限制）
+func (et *ExposureTracker) SetMaxMarginPct(pct float64) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	et.maxMarginPct = pct
+}
+
+// Register 登记交易员所属的账户
+func (et *ExposureTracker) Register(traderID, accountKey string) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	et.traderAccounts[traderID] = accountKey
+	if et.accounts[accountKey] == nil {
+		et.accounts[accountKey] = &accountExposure{}
+	}
+}
+
+// Unregister 移除交易员；账户上没有其他交易员时一并移除账户
+func (et *ExposureTracker) Unregister(traderID string) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	key, ok := et.traderAccounts[traderID]
+	if !ok {
+		return
+	}
+	delete(et.traderAccounts, traderID)
+	for _, other := range et.traderAccounts {
+		if other == key {
+			return
+		}
+	}
+	delete(et.accounts, key)
+}
+
+// ReportAccount 实现 trader.ExposureGuard：更新账户快照（同一账户的交易员看到的是同一份余额）
+func (et *ExposureTracker) ReportAccount(traderID string, equity, marginUsed float64) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	acct := et.account(traderID)
+	if acct == nil {
+		return
+	}
+	acct.equity = equity
+	acct.marginUsed = marginUsed
+	acct.reportedAt = clock.Or(et.clock).Now()
+	acct.prune()
+}
+
+// ReserveOpen 实现 trader.ExposureGuard：账户已用保证金 + 预占 + 本次开仓超过上限时拒绝，否则预占本次保证金
+// 开仓失败不释放预占：多算只会更保守，下次快照后自动失效
+func (et *ExposureTracker) ReserveOpen(traderID string, margin float64) error {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	acct := et.account(traderID)
+	if acct == nil {
+		return nil
+	}
+	now := clock.Or(et.clock).Now()
+	acct.prune()
+
+	if et.maxMarginPct > 0 && acct.equity > 0 {
+		after := acct.exposure() + margin
+		if pct := after / acct.equity * 100; pct > et.maxMarginPct {
+			return fmt.Errorf("%w: 开仓后账户保证金占用 %.1f%%（%.2f / %.2f USDT），上限 %.1f%%",
+				trader.ErrAccountExposureLimit, pct, after, acct.equity, et.maxMarginPct)
+		}
+	}
+	acct.reservations = append(acct.reservations, exposureReservation{traderID: traderID, margin: margin, at: now})
+	return nil
+}
+
+// Snapshot 返回指定用户各账户的保证金占用（按账户 key 排序）
+func (et *ExposureTracker) Snapshot(userID string) []map[string]interface{} {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	traderIDs := make(map[string][]string)
+	for traderID, key := range et.traderAccounts {
+		traderIDs[key] = append(traderIDs[key], traderID)
+	}
+
+	prefix := userID + "/"
+	keys := make([]string, 0)
+	for key := range et.accounts {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		acct := et.accounts[key]
+		acct.prune()
+		reserved := acct.exposure() - acct.marginUsed
+		marginPct := 0.0
+		if acct.equity > 0 {
+			marginPct = acct.exposure() / acct.equity * 100
+		}
+		ids := traderIDs[key]
+		sort.Strings(ids)
+		result = append(result, map[string]interface{}{
+			"exchange":    strings.TrimPrefix(key, prefix),
+			"trader_ids":  ids,
+			"equity":      acct.equity,
+			"margin_used": acct.marginUsed,
+			"reserved":    reserved,  // 已预占但尚未反映在账户快照中的保证金
+			"margin_pct":  marginPct, // (已用+预占) / 净值
+			"limit_pct":   et.maxMarginPct,
+		})
+	}
+	return result
+}
+
+func (et *ExposureTracker) account(traderID string) *accountExposure {
+	key, ok := et.traderAccounts[traderID]
+	if !ok {
+		return nil
+	}
+	return et.accounts[key]
+}
+
+// prune 移除已反映在快照中的预占
+func (a *accountExposure) prune() {
+	cutoff := a.reportedAt.Add(-exposureReportLag)
+	kept := a.reservations[:0]
+	for _, r := range a.reservations {
+		if r.at.After(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	a.reservations = kept
+}
+
+// exposure 已用保证金 + 尚未反映在快照中的预占
+func (a *accountExposure) exposure() float64 {
+	total := a.marginUsed
+	for _, r := range a.reservations {
+		total += r.margin
+	}
+	return total
+}
+
+var _ trader.ExposureGuard = (*ExposureTracker)(nil)
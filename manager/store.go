@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"fmt"
+	"nofx/config"
+	"sort"
+	"sync"
+)
+
+// TraderStore TraderManager 加载交易员所需的存储接口（*config.Database 实现了该接口）
+type TraderStore interface {
+	GetAllUsers() ([]string, error)
+	GetTraders(userID string) ([]*config.TraderRecord, error)
+	GetAIModels(userID string) ([]*config.AIModelConfig, error)
+	GetExchanges(userID string) ([]*config.ExchangeConfig, error)
+	GetSystemConfig(key string) (string, error)
+	GetUserSignalSource(userID string) (*config.UserSignalSource, error)
+	UpdateTraderInitialBalance(userID, id string, newBalance float64) error
+}
+
+var (
+	_ TraderStore = (*config.Database)(nil)
+	_ TraderStore = (*MemoryStore)(nil)
+)
+
+// MemoryStore 内存版 TraderStore（本地试验和测试使用，无需 SQLite），可直接用结构体字面量预置数据
+// 各 map 的 key 为用户ID；Users 为空时取 Traders 中出现的用户
+type MemoryStore struct {
+	Users         []string
+	Traders       map[string][]*config.TraderRecord
+	AIModels      map[string][]*config.AIModelConfig
+	Exchanges     map[string][]*config.ExchangeConfig
+	SystemConfig  map[string]string
+	SignalSources map[string]*config.UserSignalSource
+
+	mu sync.RWMutex
+}
+
+// GetAllUsers 获取所有用户ID
+func (s *MemoryStore) GetAllUsers() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.Users) > 0 {
+		return append([]string(nil), s.Users...), nil
+	}
+
+	userIDs := make([]string, 0, len(s.Traders))
+	for userID := range s.Traders {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+// GetTraders 获取用户的交易员
+func (s *MemoryStore) GetTraders(userID string) ([]*config.TraderRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*config.TraderRecord(nil), s.Traders[userID]...), nil
+}
+
+// GetAIModels 获取用户的AI模型配置
+func (s *MemoryStore) GetAIModels(userID string) ([]*config.AIModelConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*config.AIModelConfig(nil), s.AIModels[userID]...), nil
+}
+
+// GetExchanges 获取用户的交易所配置
+func (s *MemoryStore) GetExchanges(userID string) ([]*config.ExchangeConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*config.ExchangeConfig(nil), s.Exchanges[userID]...), nil
+}
+
+// GetSystemConfig 获取系统配置（不存在时与数据库一致返回错误）
+func (s *MemoryStore) GetSystemConfig(key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.SystemConfig[key]
+	if !ok {
+		return "", fmt.Errorf("系统配置不存在: %s", key)
+	}
+	return value, nil
+}
+
+// GetUserSignalSource 获取用户信号源配置
+func (s *MemoryStore) GetUserSignalSource(userID string) (*config.UserSignalSource, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	source, ok := s.SignalSources[userID]
+	if !ok {
+		return nil, fmt.Errorf("用户 %s 未配置信号源", userID)
+	}
+	return source, nil
+}
+
+// UpdateTraderInitialBalance 更新交易员初始余额
+func (s *MemoryStore) UpdateTraderInitialBalance(userID, id string, newBalance float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, trader := range s.Traders[userID] {
+		if trader.ID == id {
+			trader.InitialBalance = newBalance
+			return nil
+		}
+	}
+	return fmt.Errorf("交易员不存在: %s", id)
+}
@@ -0,0 +1,403 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"nofx/clock"
+	"nofx/config"
+	"nofx/trader"
+	"testing"
+	"time"
+)
+
+// newTestMemoryStore 预置一个可加载的 aster 交易员，以及 AI 模型未启用、交易所不存在两个应被跳过的交易员
+func newTestMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		Traders: map[string][]*config.TraderRecord{
+			"user1": {
+				{ID: "t1", UserID: "user1", Name: "ok", AIModelID: "deepseek", ExchangeID: "aster", InitialBalance: 1000, ScanIntervalMinutes: 3},
+				{ID: "t2", UserID: "user1", Name: "model-disabled", AIModelID: "qwen", ExchangeID: "aster", InitialBalance: 1000},
+				{ID: "t3", UserID: "user1", Name: "no-exchange", AIModelID: "deepseek", ExchangeID: "binance", InitialBalance: 1000},
+			},
+		},
+		AIModels: map[string][]*config.AIModelConfig{
+			"user1": {
+				{ID: "deepseek", Provider: "deepseek", Enabled: true, APIKey: "sk-test"},
+				{ID: "qwen", Provider: "qwen", Enabled: false},
+			},
+		},
+		Exchanges: map[string][]*config.ExchangeConfig{
+			"user1": {
+				{
+					ID:              "aster",
+					Enabled:         true,
+					AsterUser:       "0x0000000000000000000000000000000000000001",
+					AsterSigner:     "0x0000000000000000000000000000000000000002",
+					AsterPrivateKey: "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318",
+				},
+			},
+		},
+		SystemConfig: map[string]string{
+			"default_coins": `["BTCUSDT","ETHUSDT"]`,
+		},
+	}
+}
+
+func TestLoadTradersFromMemoryStore(t *testing.T) {
+	t.Chdir(t.TempDir()) // NewAutoTrader 会在当前目录创建 decision_logs
+
+	tm := NewTraderManager()
+	if err := tm.LoadTradersFromDatabase(newTestMemoryStore()); err != nil {
+		t.Fatalf("LoadTradersFromDatabase 失败: %v", err)
+	}
+
+	if len(tm.traders) != 1 {
+		t.Fatalf("应只加载 1 个交易员, got %d", len(tm.traders))
+	}
+	if _, err := tm.GetTrader("t1"); err != nil {
+		t.Errorf("交易员 t1 应已加载: %v", err)
+	}
+}
+
+func TestLoadUserTradersAndByID_MemoryStore(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	store := newTestMemoryStore()
+
+	tm := NewTraderManager()
+	if err := tm.LoadUserTraders(store, "user1"); err != nil {
+		t.Fatalf("LoadUserTraders 失败: %v", err)
+	}
+	if len(tm.traders) != 1 {
+		t.Fatalf("应只加载 1 个交易员, got %d", len(tm.traders))
+	}
+
+	tm = NewTraderManager()
+	if err := tm.LoadTraderByID(store, "user1", "t1"); err != nil {
+		t.Fatalf("LoadTraderByID 失败: %v", err)
+	}
+	if err := tm.LoadTraderByID(store, "user1", "t2"); err == nil {
+		t.Error("AI 模型未启用的交易员应返回错误")
+	}
+	if err := tm.LoadTraderByID(store, "user1", "missing"); err == nil {
+		t.Error("不存在的交易员应返回错误")
+	}
+}
+
+func TestMemoryStore_UpdateTraderInitialBalance(t *testing.T) {
+	store := newTestMemoryStore()
+
+	if err := store.UpdateTraderInitialBalance("user1", "t1", 2500); err != nil {
+		t.Fatalf("UpdateTraderInitialBalance 失败: %v", err)
+	}
+	traders, _ := store.GetTraders("user1")
+	if traders[0].InitialBalance != 2500 {
+		t.Errorf("InitialBalance = %v, want 2500", traders[0].InitialBalance)
+	}
+	if err := store.UpdateTraderInitialBalance("user1", "missing", 1); err == nil {
+		t.Error("不存在的交易员应返回错误")
+	}
+
+	users, _ := store.GetAllUsers()
+	if len(users) != 1 || users[0] != "user1" {
+		t.Errorf("GetAllUsers = %v, want [user1]", users)
+	}
+}
+
+func TestReloadTrader_MemoryStore(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	store := newTestMemoryStore()
+	tm := NewTraderManager()
+	if err := tm.LoadTraderByID(store, "user1", "t1"); err != nil {
+		t.Fatalf("LoadTraderByID 失败: %v", err)
+	}
+	old, _ := tm.GetTrader("t1")
+
+	store.Traders["user1"][0].ScanIntervalMinutes = 10
+	if err := tm.ReloadTrader(store, "user1", "t1"); err != nil {
+		t.Fatalf("ReloadTrader 失败: %v", err)
+	}
+	reloaded, err := tm.GetTrader("t1")
+	if err != nil {
+		t.Fatalf("重载后交易员 t1 应存在: %v", err)
+	}
+	if reloaded == old {
+		t.Error("重载后应替换为新实例")
+	}
+	if got := reloaded.GetStatus()["scan_interval"]; got != "10m0s" {
+		t.Errorf("scan_interval = %v, want 10m0s", got)
+	}
+
+	// 新配置加载失败时保留旧实例
+	store.Traders["user1"][0].AIModelID = "qwen"
+	if err := tm.ReloadTrader(store, "user1", "t1"); err == nil {
+		t.Error("AI 模型未启用时重载应返回错误")
+	}
+	if kept, err := tm.GetTrader("t1"); err != nil || kept != reloaded {
+		t.Error("重载失败时应保留原实例")
+	}
+}
+
+func TestReloadTrader_StopTimeout(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	store := newTestMemoryStore()
+	tm := NewTraderManager()
+	if err := tm.LoadTraderByID(store, "user1", "t1"); err != nil {
+		t.Fatalf("LoadTraderByID 失败: %v", err)
+	}
+	old, _ := tm.GetTrader("t1")
+
+	// 旧实例在运行，等待当前周期结束超时
+	tm.stopTrader = func(ctx context.Context, at *trader.AutoTrader) (bool, error) {
+		return true, context.DeadlineExceeded
+	}
+	started := make(chan *trader.AutoTrader, 2)
+	tm.runTrader = func(at *trader.AutoTrader) error {
+		started <- at
+		return nil
+	}
+
+	store.Traders["user1"][0].ScanIntervalMinutes = 10
+	if err := tm.ReloadTrader(store, "user1", "t1"); !errors.Is(err, ErrReloadPending) {
+		t.Fatalf("超时后应返回 ErrReloadPending 并在周期结束时完成重载, got %v", err)
+	}
+	select {
+	case at := <-started:
+		if at == old {
+			t.Fatal("应启动重建的新实例")
+		}
+		if got := at.GetStatus()["scan_interval"]; got != "10m0s" {
+			t.Errorf("scan_interval = %v, want 10m0s", got)
+		}
+		if current, _ := tm.GetTrader("t1"); current != at {
+			t.Error("周期结束后应替换为新实例")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("旧实例已停止，但新实例未启动")
+	}
+
+	// 新配置加载失败时回滚：保留并重新启动旧实例
+	current, _ := tm.GetTrader("t1")
+	store.Traders["user1"][0].AIModelID = "qwen"
+	if err := tm.ReloadTrader(store, "user1", "t1"); !errors.Is(err, ErrReloadPending) {
+		t.Fatalf("ReloadTrader 应返回 ErrReloadPending, got %v", err)
+	}
+	select {
+	case at := <-started:
+		if at != current {
+			t.Error("重载失败时应重新启动原实例")
+		}
+		if kept, _ := tm.GetTrader("t1"); kept != current {
+			t.Error("重载失败时应保留原实例")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("重载失败后原实例未重新启动，交易员将无实例运行")
+	}
+}
+
+// TestReplaceTrader_EntryChanged 测试后台完成热重载前交易员已被替换或删除时放弃替换，不覆盖更新的实例
+func TestReplaceTrader_EntryChanged(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	store := newTestMemoryStore()
+	tm := NewTraderManager()
+	if err := tm.LoadTraderByID(store, "user1", "t1"); err != nil {
+		t.Fatalf("LoadTraderByID 失败: %v", err)
+	}
+	old, _ := tm.GetTrader("t1")
+	started := 0
+	tm.runTrader = func(at *trader.AutoTrader) error {
+		started++
+		return nil
+	}
+
+	// 等待期间另一次热重载已替换实例
+	if err := tm.ReloadTrader(store, "user1", "t1"); err != nil {
+		t.Fatalf("ReloadTrader 失败: %v", err)
+	}
+	newer, _ := tm.GetTrader("t1")
+	if err := tm.replaceTrader(store, "user1", "t1", old, true); err != nil {
+		t.Fatalf("replaceTrader 失败: %v", err)
+	}
+	if current, _ := tm.GetTrader("t1"); current != newer {
+		t.Error("实例已被替换时不应覆盖更新的实例")
+	}
+
+	// 等待期间交易员已被删除
+	tm.RemoveTrader("t1")
+	if err := tm.replaceTrader(store, "user1", "t1", newer, true); err != nil {
+		t.Fatalf("replaceTrader 失败: %v", err)
+	}
+	if _, err := tm.GetTrader("t1"); err == nil {
+		t.Error("交易员已删除时不应重新加载")
+	}
+	if started != 0 {
+		t.Errorf("放弃替换时不应启动实例, started = %d", started)
+	}
+}
+
+func TestStartRunningOnly(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	store := newTestMemoryStore()
+	store.Traders["user1"] = append(store.Traders["user1"],
+		&config.TraderRecord{ID: "t4", UserID: "user1", Name: "running", AIModelID: "deepseek", ExchangeID: "aster", InitialBalance: 1000, IsRunning: true},
+		&config.TraderRecord{ID: "t5", UserID: "user1", Name: "paused", AIModelID: "deepseek", ExchangeID: "aster", InitialBalance: 1000},
+	)
+
+	tm := NewTraderManager()
+	if err := tm.LoadTradersFromDatabase(store); err != nil {
+		t.Fatalf("LoadTradersFromDatabase 失败: %v", err)
+	}
+	if len(tm.traders) != 3 {
+		t.Fatalf("运行中和已暂停的交易员都应加载, got %d", len(tm.traders))
+	}
+
+	started := make(chan string, len(tm.traders))
+	tm.runTrader = func(at *trader.AutoTrader) error {
+		started <- at.GetID()
+		return nil
+	}
+	tm.StartRunningOnly()
+
+	select {
+	case id := <-started:
+		if id != "t4" {
+			t.Errorf("启动了 %s，应只启动运行中的 t4", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("运行中的交易员 t4 未被启动")
+	}
+	select {
+	case id := <-started:
+		t.Errorf("已暂停的交易员 %s 不应被启动", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDisabledTrader_NotLoadedOrStarted(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	store := newTestMemoryStore()
+	store.Traders["user1"] = append(store.Traders["user1"],
+		&config.TraderRecord{ID: "t4", UserID: "user1", Name: "disabled", AIModelID: "deepseek", ExchangeID: "aster", InitialBalance: 1000, IsRunning: true, Disabled: true},
+	)
+
+	// 停用的交易员不加载（即使数据库中标记为运行中）
+	tm := NewTraderManager()
+	if err := tm.LoadTradersFromDatabase(store); err != nil {
+		t.Fatalf("LoadTradersFromDatabase 失败: %v", err)
+	}
+	if _, err := tm.GetTrader("t4"); err == nil {
+		t.Error("停用的交易员不应被加载")
+	}
+	tm = NewTraderManager()
+	if err := tm.LoadUserTraders(store, "user1"); err != nil {
+		t.Fatalf("LoadUserTraders 失败: %v", err)
+	}
+	if _, err := tm.GetTrader("t4"); err == nil {
+		t.Error("LoadUserTraders 不应加载停用的交易员")
+	}
+	if err := tm.LoadTraderByID(store, "user1", "t4"); !errors.Is(err, trader.ErrTraderDisabled) {
+		t.Errorf("LoadTraderByID 加载停用的交易员应返回 ErrTraderDisabled, got %v", err)
+	}
+
+	// 已加载的交易员被停用后不启动
+	started := make(chan string, 2)
+	tm.runTrader = func(at *trader.AutoTrader) error {
+		started <- at.GetID()
+		return nil
+	}
+	if err := tm.SetTraderDisabled(context.Background(), store, "user1", "t1", true); err != nil {
+		t.Fatalf("SetTraderDisabled 失败: %v", err)
+	}
+	loaded, _ := tm.GetTrader("t1")
+	if !loaded.IsDisabled() {
+		t.Fatal("t1 应标记为停用")
+	}
+	if err := loaded.Run(); !errors.Is(err, trader.ErrTraderDisabled) {
+		t.Errorf("停用的交易员 Run 应返回 ErrTraderDisabled, got %v", err)
+	}
+	tm.StartAll()
+	select {
+	case id := <-started:
+		t.Errorf("停用的交易员 %s 不应被启动", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 热重载不会解除停用：数据库中已停用的交易员重载后从内存移除
+	store.Traders["user1"][0].Disabled = true
+	if err := tm.ReloadTrader(store, "user1", "t1"); err != nil {
+		t.Fatalf("ReloadTrader 失败: %v", err)
+	}
+	if _, err := tm.GetTrader("t1"); err == nil {
+		t.Error("停用的交易员重载后不应保留在内存中")
+	}
+
+	// 解除停用后从数据库加载（不自动启动）
+	store.Traders["user1"][0].Disabled = false
+	if err := tm.SetTraderDisabled(context.Background(), store, "user1", "t1", false); err != nil {
+		t.Fatalf("解除停用失败: %v", err)
+	}
+	if reloaded, err := tm.GetTrader("t1"); err != nil || reloaded.IsDisabled() {
+		t.Errorf("解除停用后 t1 应已加载且未停用: %v", err)
+	}
+}
+
+// TestAccountExposureLimit 同一交易所账户上的两个交易员各自在限额内，合计超过上限时后开仓的被拒绝
+func TestAccountExposureLimit(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	store := newTestMemoryStore()
+	store.Traders["user1"] = append(store.Traders["user1"],
+		&config.TraderRecord{ID: "t4", UserID: "user1", Name: "same-account", AIModelID: "deepseek", ExchangeID: "aster", InitialBalance: 1000},
+	)
+	tm := NewTraderManager()
+	tm.SetAccountMarginLimit(80)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	tm.exposure.clock = fake
+	if err := tm.LoadUserTraders(store, "user1"); err != nil {
+		t.Fatalf("LoadUserTraders 失败: %v", err)
+	}
+
+	// 两个交易员看到同一账户：净值1000，已用保证金300
+	tm.exposure.ReportAccount("t1", 1000, 300)
+	if err := tm.exposure.ReserveOpen("t1", 300); err != nil {
+		t.Fatalf("t1 开仓后占用60%%，应允许: %v", err)
+	}
+	tm.exposure.ReportAccount("t4", 1000, 300) // 账户缓存尚未反映 t1 的新仓位
+	if err := tm.exposure.ReserveOpen("t4", 300); !errors.Is(err, trader.ErrAccountExposureLimit) {
+		t.Fatalf("t4 开仓后合计占用90%%，应返回 ErrAccountExposureLimit, got %v", err)
+	}
+
+	accounts := tm.exposure.Snapshot("user1")
+	if len(accounts) != 1 {
+		t.Fatalf("应有1个账户, got %d", len(accounts))
+	}
+	acct := accounts[0]
+	if acct["exchange"] != "aster" || acct["reserved"] != 300.0 || acct["margin_pct"] != 60.0 {
+		t.Errorf("账户占用不符: %v", acct)
+	}
+	if ids, _ := acct["trader_ids"].([]string); len(ids) != 2 {
+		t.Errorf("账户应包含2个交易员: %v", acct["trader_ids"])
+	}
+
+	// 快照反映新仓位后预占失效，不重复计算
+	fake.Advance(time.Minute)
+	tm.exposure.ReportAccount("t1", 1000, 600)
+	if err := tm.exposure.ReserveOpen("t4", 150); err != nil {
+		t.Errorf("合计占用75%%应允许: %v", err)
+	}
+
+	// 移除交易员后不再检查
+	tm.RemoveTrader("t1")
+	tm.RemoveTrader("t4")
+	if err := tm.exposure.ReserveOpen("t4", 10000); err != nil {
+		t.Errorf("已移除的交易员不应被检查: %v", err)
+	}
+	if accounts := tm.exposure.Snapshot("user1"); len(accounts) != 0 {
+		t.Errorf("交易员全部移除后账户应移除: %v", accounts)
+	}
+}
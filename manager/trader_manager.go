@@ -3,10 +3,18 @@ package manager
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"golang.org/x/sync/singleflight"
 	"log"
+	"log/slog"
+	"nofx/clock"
 	"nofx/config"
+	"nofx/logging"
+	"nofx/mcp"
+	"nofx/metrics"
 	"nofx/trader"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -14,11 +22,26 @@ import (
 	"time"
 )
 
-// CompetitionCache 竞赛数据缓存
+// reloadStopTimeout 热重载时等待旧实例当前决策周期结束的最长时间
+const reloadStopTimeout = 30 * time.Second
+
+// ErrReloadPending 热重载时旧实例当前周期仍在执行，新配置将在周期结束后于后台生效
+var ErrReloadPending = errors.New("当前决策周期仍在执行，周期结束后完成热重载")
+
+// 竞赛排行榜
+const (
+	competitionCacheTTL     = 30 * time.Second // 竞赛数据缓存有效期
+	DefaultCompetitionLimit = 50               // 排行榜默认每页数量
+	MaxCompetitionLimit     = 200              // 排行榜每页数量上限
+)
+
+// CompetitionCache 竞赛数据缓存（全部交易员，按收益率降序）
 type CompetitionCache struct {
-	data      map[string]interface{}
+	traders   []map[string]interface{}
 	timestamp time.Time
 	mu        sync.RWMutex
+	clock     clock.Clock        // 时间源（判断缓存是否过期，nil 使用系统时间）
+	refresh   singleflight.Group // 缓存失效时同一时刻只有一次刷新，并发的调用方等待并共享其结果
 }
 
 // TraderManager 管理多个trader实例
@@ -26,6 +49,24 @@ type TraderManager struct {
 	traders          map[string]*trader.AutoTrader // key: trader ID
 	competitionCache *CompetitionCache
 	mu               sync.RWMutex
+
+	// 从数据库加载时记录的运行状态 (trader ID -> is_running)，重启后 StartRunningOnly 只自动启动上次在运行的交易员
+	runningAtLoad map[string]bool
+	// 启动交易员（nil 使用 AutoTrader.Run，测试中替换）
+	runTrader func(*trader.AutoTrader) error
+	// 热重载时停止运行中的旧实例，返回其是否在运行（nil 使用 stopIfRunning，测试中替换）
+	stopTrader func(context.Context, *trader.AutoTrader) (bool, error)
+	// 获取交易员的竞赛数据（nil 使用 getConcurrentTraderData，测试中替换）
+	fetchTraderData func([]*trader.AutoTrader) []map[string]interface{}
+
+	// 事件订阅者（见 events.go）
+	eventMu     sync.Mutex
+	subscribers []chan ManagerEvent
+
+	// 跨交易员的账户保证金占用（见 exposure.go）
+	exposure *ExposureTracker
+
+	logger *slog.Logger // 结构化日志
 }
 
 // NewTraderManager 创建trader管理器
@@ -33,13 +74,34 @@ func NewTraderManager() *TraderManager {
 	return &TraderManager{
 		traders: make(map[string]*trader.AutoTrader),
 		competitionCache: &CompetitionCache{
-			data: make(map[string]interface{}),
+			clock: clock.Real,
 		},
+		exposure: NewExposureTracker(0),
+		logger:   logging.Logger(),
 	}
 }
 
+// SetAccountMarginLimit 设置同一交易所账户上所有交易员合计的保证金占用上限（占净值百分比，<=0 表示不限制）
+func (tm *TraderManager) SetAccountMarginLimit(pct float64) {
+	tm.exposure.SetMaxMarginPct(pct)
+}
+
+// registerExposure 将交易员接入所属账户的保证金占用检查（调用方持有 tm.mu）
+func (tm *TraderManager) registerExposure(at *trader.AutoTrader, userID, exchangeID string) {
+	tm.exposure.Register(at.GetID(), exposureAccountKey(userID, exchangeID))
+	at.SetExposureGuard(tm.exposure)
+}
+
+// log 返回管理器的结构化日志（未通过 NewTraderManager 创建时使用全局日志）
+func (tm *TraderManager) log() *slog.Logger {
+	if tm.logger == nil {
+		return logging.Logger()
+	}
+	return tm.logger
+}
+
 // LoadTradersFromDatabase 从数据库加载所有交易员到内存
-func (tm *TraderManager) LoadTradersFromDatabase(database *config.Database) error {
+func (tm *TraderManager) LoadTradersFromDatabase(database TraderStore) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -56,10 +118,10 @@ func (tm *TraderManager) LoadTradersFromDatabase(database *config.Database) erro
 		// 获取每个用户的交易员
 		traders, err := database.GetTraders(userID)
 		if err != nil {
-			log.Printf("⚠️ 获取用户 %s 的交易员失败: %v", userID, err)
+			tm.log().Warn("⚠️ 获取用户的交易员失败", logging.KeyUserID, userID, "error", err)
 			continue
 		}
-		log.Printf("📋 用户 %s: %d 个交易员", userID, len(traders))
+		tm.log().Info("📋 用户交易员配置", logging.KeyUserID, userID, "traders", len(traders))
 		allTraders = append(allTraders, traders...)
 	}
 
@@ -98,6 +160,11 @@ func (tm *TraderManager) LoadTradersFromDatabase(database *config.Database) erro
 
 	// 为每个交易员获取AI模型和交易所配置
 	for _, traderCfg := range allTraders {
+		if traderCfg.Disabled {
+			log.Printf("⛔ 交易员 %s 已紧急停用，跳过加载", traderCfg.Name)
+			continue
+		}
+
 		// 获取AI模型配置（使用交易员所属的用户ID）
 		aiModels, err := database.GetAIModels(traderCfg.UserID)
 		if err != nil {
@@ -182,7 +249,10 @@ func (tm *TraderManager) LoadTradersFromDatabase(database *config.Database) erro
 }
 
 // addTraderFromConfig 内部方法：从配置添加交易员（不加锁，因为调用方已加锁）
-func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string, database *config.Database, userID string) error {
+func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string, database TraderStore, userID string) error {
+	if err := checkTraderEnabled(traderCfg); err != nil {
+		return err
+	}
 	if _, exists := tm.traders[traderCfg.ID]; exists {
 		return fmt.Errorf("trader ID '%s' 已存在", traderCfg.ID)
 	}
@@ -211,6 +281,9 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		effectiveCoinPoolURL = coinPoolURL
 		log.Printf("✓ 交易员 %s 启用 COIN POOL 信号源: %s", traderCfg.Name, coinPoolURL)
 	}
+	if traderCfg.UseOITop && oiTopURL != "" {
+		log.Printf("✓ 交易员 %s 启用 OI TOP 信号源: %s", traderCfg.Name, oiTopURL)
+	}
 
 	// 构建AutoTraderConfig
 	traderConfig := trader.AutoTraderConfig{
@@ -223,6 +296,8 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		HyperliquidPrivateKey: "",
 		HyperliquidTestnet:    exchangeCfg.Testnet,
 		CoinPoolAPIURL:        effectiveCoinPoolURL,
+		UseOITop:              traderCfg.UseOITop,
+		OITopAPIURL:           oiTopURL,
 		UseQwen:               aiModelCfg.Provider == "qwen",
 		DeepSeekKey:           "",
 		QwenKey:               "",
@@ -236,6 +311,39 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		MaxDrawdown:           maxDrawdown,
 		StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
 		IsCrossMargin:         traderCfg.IsCrossMargin,
+		OnEvent:               tm.publishEvent,
+		MaxHoldTime:           time.Duration(traderCfg.MaxHoldMinutes) * time.Minute,
+		OrderTimeout:          time.Duration(traderCfg.OrderTimeoutSeconds) * time.Second,
+		RepeatDecisionLimit:   traderCfg.RepeatDecisionLimit,
+		RepeatDecisionBackoff: time.Duration(traderCfg.RepeatBackoffMinutes) * time.Minute,
+		AITemperature:         optionalSampling(traderCfg.AITemperature),
+		AITopP:                optionalSampling(traderCfg.AITopP),
+		StrategyTag:           traderCfg.StrategyTag,
+		CloseTolerancePct:     traderCfg.CloseReasonTolerancePct,
+		MaxPositionPct:        traderCfg.MaxPositionPctOfEquity,
+		ClampPositionSize:     traderCfg.ClampPositionSize,
+		AllowHighVolOpens:     traderCfg.AllowHighVolOpens,
+		RebaselineSchedule:    traderCfg.RebaselineSchedule,
+		BTCETHMaxSpreadBps:    traderCfg.BTCETHMaxSpreadBps,
+		AltcoinMaxSpreadBps:   traderCfg.AltcoinMaxSpreadBps,
+		SkipAIWithoutTrigger:  traderCfg.SkipAIWithoutTrigger,
+		TriggerPriceMovePct:   traderCfg.TriggerPriceMovePct,
+		TriggerVolumeSpike:    traderCfg.TriggerVolumeSpike,
+		ConsensusOpens:        traderCfg.ConsensusOpens,
+		RetryEmptyDecision:    traderCfg.RetryEmptyDecision,
+		Timezone:              traderCfg.Timezone,
+		DustThresholdUSD:      traderCfg.DustThresholdUSD,
+		AlwaysContextSymbols:  parseSymbolList(traderCfg.AlwaysContextSymbols),
+		DefaultStopLossPct:    traderCfg.DefaultStopLossPct,
+		LeverageTiers:         parseLeverageTiers(traderCfg.LeverageTiers),
+		MarginModes:           parseMarginModes(traderCfg.MarginModes),
+		MaxCorrelatedExposure: traderCfg.MaxCorrelatedExposure,
+		ScanJitterPercent:     traderCfg.ScanJitterPercent,
+		BlacklistSymbols:      parseSymbolList(traderCfg.BlacklistSymbols),
+		MaxOpenPositions:      traderCfg.MaxOpenPositions,
+		PostStopCooldown:      time.Duration(traderCfg.PostStopCooldownMinutes) * time.Minute,
+		AutoBumpMinNotional:   traderCfg.AutoBumpMinNotional,
+		HedgeMode:             traderCfg.HedgeMode,
 		DefaultCoins:          defaultCoins,
 		TradingCoins:          tradingCoins,
 		SystemPromptTemplate:  traderCfg.SystemPromptTemplate, // 系统提示词模板
@@ -252,6 +360,10 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		traderConfig.AsterUser = exchangeCfg.AsterUser
 		traderConfig.AsterSigner = exchangeCfg.AsterSigner
 		traderConfig.AsterPrivateKey = exchangeCfg.AsterPrivateKey
+	} else if exchangeCfg.ID == "bybit" {
+		traderConfig.BybitAPIKey = exchangeCfg.APIKey
+		traderConfig.BybitSecretKey = exchangeCfg.SecretKey
+		traderConfig.BybitTestnet = exchangeCfg.Testnet
 	}
 
 	// 根据AI模型设置API密钥
@@ -261,11 +373,16 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		traderConfig.DeepSeekKey = aiModelCfg.APIKey
 	}
 
+	// 备用AI模型与影子AI模型（可选）
+	applyFallbackModel(&traderConfig, traderCfg, database, userID)
+	applyShadowModel(&traderConfig, traderCfg, database, userID)
+
 	// 创建trader实例
 	at, err := trader.NewAutoTrader(traderConfig, database, userID)
 	if err != nil {
 		return fmt.Errorf("创建trader失败: %w", err)
 	}
+	loadManualHolds(at, database)
 
 	// 设置自定义prompt（如果有）
 	if traderCfg.CustomPrompt != "" {
@@ -278,18 +395,23 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		}
 	}
 
+	tm.registerExposure(at, userID, exchangeCfg.ID)
 	tm.traders[traderCfg.ID] = at
-	log.Printf("✓ Trader '%s' (%s + %s) 已加载到内存", traderCfg.Name, aiModelCfg.Provider, exchangeCfg.ID)
+	tm.recordRunningState(traderCfg)
+	at.Logger().Info("✓ Trader 已加载到内存", "name", traderCfg.Name, "ai_provider", aiModelCfg.Provider)
 	return nil
 }
 
 // AddTrader 从数据库配置添加trader (移除旧版兼容性)
 
 // AddTraderFromDB 从数据库配置添加trader
-func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string, database *config.Database, userID string) error {
+func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string, database TraderStore, userID string) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	if err := checkTraderEnabled(traderCfg); err != nil {
+		return err
+	}
 	if _, exists := tm.traders[traderCfg.ID]; exists {
 		return fmt.Errorf("trader ID '%s' 已存在", traderCfg.ID)
 	}
@@ -318,6 +440,9 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		effectiveCoinPoolURL = coinPoolURL
 		log.Printf("✓ 交易员 %s 启用 COIN POOL 信号源: %s", traderCfg.Name, coinPoolURL)
 	}
+	if traderCfg.UseOITop && oiTopURL != "" {
+		log.Printf("✓ 交易员 %s 启用 OI TOP 信号源: %s", traderCfg.Name, oiTopURL)
+	}
 
 	// 构建AutoTraderConfig
 	traderConfig := trader.AutoTraderConfig{
@@ -330,6 +455,8 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		HyperliquidPrivateKey: "",
 		HyperliquidTestnet:    exchangeCfg.Testnet,
 		CoinPoolAPIURL:        effectiveCoinPoolURL,
+		UseOITop:              traderCfg.UseOITop,
+		OITopAPIURL:           oiTopURL,
 		UseQwen:               aiModelCfg.Provider == "qwen",
 		DeepSeekKey:           "",
 		QwenKey:               "",
@@ -343,6 +470,39 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		MaxDrawdown:           maxDrawdown,
 		StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
 		IsCrossMargin:         traderCfg.IsCrossMargin,
+		OnEvent:               tm.publishEvent,
+		MaxHoldTime:           time.Duration(traderCfg.MaxHoldMinutes) * time.Minute,
+		OrderTimeout:          time.Duration(traderCfg.OrderTimeoutSeconds) * time.Second,
+		RepeatDecisionLimit:   traderCfg.RepeatDecisionLimit,
+		RepeatDecisionBackoff: time.Duration(traderCfg.RepeatBackoffMinutes) * time.Minute,
+		AITemperature:         optionalSampling(traderCfg.AITemperature),
+		AITopP:                optionalSampling(traderCfg.AITopP),
+		StrategyTag:           traderCfg.StrategyTag,
+		CloseTolerancePct:     traderCfg.CloseReasonTolerancePct,
+		MaxPositionPct:        traderCfg.MaxPositionPctOfEquity,
+		ClampPositionSize:     traderCfg.ClampPositionSize,
+		AllowHighVolOpens:     traderCfg.AllowHighVolOpens,
+		RebaselineSchedule:    traderCfg.RebaselineSchedule,
+		BTCETHMaxSpreadBps:    traderCfg.BTCETHMaxSpreadBps,
+		AltcoinMaxSpreadBps:   traderCfg.AltcoinMaxSpreadBps,
+		SkipAIWithoutTrigger:  traderCfg.SkipAIWithoutTrigger,
+		TriggerPriceMovePct:   traderCfg.TriggerPriceMovePct,
+		TriggerVolumeSpike:    traderCfg.TriggerVolumeSpike,
+		ConsensusOpens:        traderCfg.ConsensusOpens,
+		RetryEmptyDecision:    traderCfg.RetryEmptyDecision,
+		Timezone:              traderCfg.Timezone,
+		DustThresholdUSD:      traderCfg.DustThresholdUSD,
+		AlwaysContextSymbols:  parseSymbolList(traderCfg.AlwaysContextSymbols),
+		DefaultStopLossPct:    traderCfg.DefaultStopLossPct,
+		LeverageTiers:         parseLeverageTiers(traderCfg.LeverageTiers),
+		MarginModes:           parseMarginModes(traderCfg.MarginModes),
+		MaxCorrelatedExposure: traderCfg.MaxCorrelatedExposure,
+		ScanJitterPercent:     traderCfg.ScanJitterPercent,
+		BlacklistSymbols:      parseSymbolList(traderCfg.BlacklistSymbols),
+		MaxOpenPositions:      traderCfg.MaxOpenPositions,
+		PostStopCooldown:      time.Duration(traderCfg.PostStopCooldownMinutes) * time.Minute,
+		AutoBumpMinNotional:   traderCfg.AutoBumpMinNotional,
+		HedgeMode:             traderCfg.HedgeMode,
 		DefaultCoins:          defaultCoins,
 		TradingCoins:          tradingCoins,
 	}
@@ -358,6 +518,10 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		traderConfig.AsterUser = exchangeCfg.AsterUser
 		traderConfig.AsterSigner = exchangeCfg.AsterSigner
 		traderConfig.AsterPrivateKey = exchangeCfg.AsterPrivateKey
+	} else if exchangeCfg.ID == "bybit" {
+		traderConfig.BybitAPIKey = exchangeCfg.APIKey
+		traderConfig.BybitSecretKey = exchangeCfg.SecretKey
+		traderConfig.BybitTestnet = exchangeCfg.Testnet
 	}
 
 	// 根据AI模型设置API密钥
@@ -367,11 +531,16 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		traderConfig.DeepSeekKey = aiModelCfg.APIKey
 	}
 
+	// 备用AI模型与影子AI模型（可选）
+	applyFallbackModel(&traderConfig, traderCfg, database, userID)
+	applyShadowModel(&traderConfig, traderCfg, database, userID)
+
 	// 创建trader实例
 	at, err := trader.NewAutoTrader(traderConfig, database, userID)
 	if err != nil {
 		return fmt.Errorf("创建trader失败: %w", err)
 	}
+	loadManualHolds(at, database)
 
 	// 设置自定义prompt（如果有）
 	if traderCfg.CustomPrompt != "" {
@@ -384,8 +553,10 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		}
 	}
 
+	tm.registerExposure(at, userID, exchangeCfg.ID)
 	tm.traders[traderCfg.ID] = at
-	log.Printf("✓ Trader '%s' (%s + %s) 已添加", traderCfg.Name, aiModelCfg.Provider, exchangeCfg.ID)
+	tm.recordRunningState(traderCfg)
+	at.Logger().Info("✓ Trader 已添加", "name", traderCfg.Name, "ai_provider", aiModelCfg.Provider)
 	return nil
 }
 
@@ -425,30 +596,97 @@ func (tm *TraderManager) GetTraderIDs() []string {
 	return ids
 }
 
-// StartAll 启动所有trader
+// checkTraderEnabled 紧急停用的交易员不加载（停用标记在数据库中持久化，重启和热重载都不会解除）
+func checkTraderEnabled(traderCfg *config.TraderRecord) error {
+	if traderCfg.Disabled {
+		return fmt.Errorf("%w: %s", trader.ErrTraderDisabled, traderCfg.Name)
+	}
+	return nil
+}
+
+// recordRunningState 记录交易员加载时数据库中的运行状态（调用方已加锁）
+func (tm *TraderManager) recordRunningState(traderCfg *config.TraderRecord) {
+	if tm.runningAtLoad == nil {
+		tm.runningAtLoad = make(map[string]bool)
+	}
+	tm.runningAtLoad[traderCfg.ID] = traderCfg.IsRunning
+}
+
+// startTrader 在后台运行交易员
+func (tm *TraderManager) startTrader(at *trader.AutoTrader) {
+	if at.IsDisabled() {
+		at.Logger().Warn("⛔ 交易员已紧急停用，跳过启动", "name", at.GetName())
+		return
+	}
+	run := tm.runTrader
+	if run == nil {
+		run = (*trader.AutoTrader).Run
+	}
+	go func() {
+		at.Logger().Info("▶️ 启动交易员", "name", at.GetName())
+		if err := run(at); err != nil {
+			at.Logger().Error("❌ 交易员运行错误", "name", at.GetName(), "error", err)
+		}
+	}()
+}
+
+// StartAll 启动所有trader（不论数据库中的运行状态）
 func (tm *TraderManager) StartAll() {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 
 	log.Println("🚀 启动所有Trader...")
-	for id, t := range tm.traders {
-		go func(traderID string, at *trader.AutoTrader) {
-			log.Printf("▶️  启动 %s...", at.GetName())
-			if err := at.Run(); err != nil {
-				log.Printf("❌ %s 运行错误: %v", at.GetName(), err)
-			}
-		}(id, t)
+	for _, t := range tm.traders {
+		tm.startTrader(t)
 	}
 }
 
-// StopAll 停止所有trader
-func (tm *TraderManager) StopAll() {
+// StartRunningOnly 服务重启后只启动加载时数据库中标记为运行中的trader，用户暂停的trader保持加载但不运行
+func (tm *TraderManager) StartRunningOnly() {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 
-	log.Println("⏹  停止所有Trader...")
+	log.Println("🚀 恢复重启前运行中的Trader...")
+	for id, t := range tm.traders {
+		if !tm.runningAtLoad[id] {
+			t.Logger().Info("⏸ 重启前已停止，保持空闲", "name", t.GetName())
+			continue
+		}
+		tm.startTrader(t)
+	}
+}
+
+// StopAll 并发停止所有trader，等待各自当前周期结束，整体受 ctx 超时约束
+func (tm *TraderManager) StopAll(ctx context.Context) {
+	tm.mu.RLock()
+	traders := make([]*trader.AutoTrader, 0, len(tm.traders))
 	for _, t := range tm.traders {
-		t.Stop()
+		traders = append(traders, t)
+	}
+	tm.mu.RUnlock()
+
+	log.Println("⏹  停止所有Trader...")
+	var wg sync.WaitGroup
+	for _, t := range traders {
+		wg.Add(1)
+		go func(at *trader.AutoTrader) {
+			defer wg.Done()
+			if err := at.Stop(ctx); err != nil {
+				at.Logger().Warn("⚠️ 停止时未能等到当前周期结束", "name", at.GetName(), "error", err)
+			}
+		}(t)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		tm.log().Warn("⚠️ 停止所有Trader超时", "error", ctx.Err())
 	}
 }
 
@@ -480,6 +718,7 @@ func (tm *TraderManager) GetComparisonData() (map[string]interface{}, error) {
 			"margin_used_pct": account["margin_used_pct"],
 			"call_count":      status["call_count"],
 			"is_running":      status["is_running"],
+			"token_usage":     status["token_usage"],
 		})
 	}
 
@@ -489,22 +728,122 @@ func (tm *TraderManager) GetComparisonData() (map[string]interface{}, error) {
 	return comparison, nil
 }
 
-// GetCompetitionData 获取竞赛数据（全平台所有交易员）
+// GetTokenUsage 汇总AI token用量；traderIDs 为空时统计全部trader
+func (tm *TraderManager) GetTokenUsage(traderIDs ...string) map[string]interface{} {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	selected := tm.traders
+	if len(traderIDs) > 0 {
+		selected = make(map[string]*trader.AutoTrader, len(traderIDs))
+		for _, id := range traderIDs {
+			if t, exists := tm.traders[id]; exists {
+				selected[id] = t
+			}
+		}
+	}
+
+	var total mcp.Usage
+	traders := make([]map[string]interface{}, 0, len(selected))
+	for id, t := range selected {
+		usage := t.GetTokenUsage()
+		total.Add(usage)
+		traders = append(traders, map[string]interface{}{
+			"trader_id":   id,
+			"trader_name": t.GetName(),
+			"ai_model":    t.GetAIModel(),
+			"token_usage": usage,
+		})
+	}
+
+	sort.Slice(traders, func(i, j int) bool {
+		return traders[i]["trader_id"].(string) < traders[j]["trader_id"].(string)
+	})
+
+	return map[string]interface{}{
+		"traders": traders,
+		"total":   total,
+	}
+}
+
+// GetCompetitionData 获取竞赛数据（全平台所有交易员，按收益率排序的前 DefaultCompetitionLimit 名）
 func (tm *TraderManager) GetCompetitionData() (map[string]interface{}, error) {
+	return tm.GetCompetitionPage("", 0, DefaultCompetitionLimit)
+}
+
+// competitionSortKeys 排行榜支持的排序字段（均为降序）
+var competitionSortKeys = map[string]bool{
+	"total_pnl_pct": true,
+	"total_pnl":     true,
+	"total_equity":  true,
+}
+
+// GetCompetitionPage 获取排行榜的一页：按 sortBy 降序（为空时按收益率），从 offset 开始最多 limit 名，
+// total_count 为全部交易员数量（用于客户端分页）。全部交易员的数据缓存30秒，翻页不会重新请求交易所
+func (tm *TraderManager) GetCompetitionPage(sortBy string, offset, limit int) (map[string]interface{}, error) {
+	if sortBy == "" {
+		sortBy = "total_pnl_pct"
+	}
+	if !competitionSortKeys[sortBy] {
+		return nil, fmt.Errorf("不支持的排序字段: %s", sortBy)
+	}
+	if limit <= 0 {
+		limit = DefaultCompetitionLimit
+	}
+	if limit > MaxCompetitionLimit {
+		limit = MaxCompetitionLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	traders := tm.getCompetitionTraders()
+	if sortBy != "total_pnl_pct" {
+		traders = slices.Clone(traders)
+		sortTradersDesc(traders, sortBy)
+	}
+
+	totalCount := len(traders)
+	page := []map[string]interface{}{}
+	if offset < totalCount {
+		page = traders[offset:min(offset+limit, totalCount)]
+	}
+
+	return map[string]interface{}{
+		"traders":     page,
+		"count":       len(page),
+		"total_count": totalCount, // 总交易员数量
+		"offset":      offset,
+		"limit":       limit,
+		"sort_by":     sortBy,
+	}, nil
+}
+
+// competitionRefreshKey 竞赛数据刷新的 singleflight 键（缓存只有一份全部交易员的数据）
+const competitionRefreshKey = "competition"
+
+// getCompetitionTraders 返回全部交易员的竞赛数据（按收益率降序），缓存 competitionCacheTTL
+// 缓存失效时多个并发调用只触发一次刷新（向所有交易所请求账户信息），其余调用等待并共享同一结果
+func (tm *TraderManager) getCompetitionTraders() []map[string]interface{} {
 	// 检查缓存是否有效（30秒内）
 	tm.competitionCache.mu.RLock()
-	if time.Since(tm.competitionCache.timestamp) < 30*time.Second && len(tm.competitionCache.data) > 0 {
-		// 返回缓存数据
-		cachedData := make(map[string]interface{})
-		for k, v := range tm.competitionCache.data {
-			cachedData[k] = v
-		}
+	cacheAge := clock.Or(tm.competitionCache.clock).Since(tm.competitionCache.timestamp)
+	if cacheAge < competitionCacheTTL && tm.competitionCache.traders != nil {
+		traders := tm.competitionCache.traders
 		tm.competitionCache.mu.RUnlock()
-		log.Printf("📋 返回竞赛数据缓存 (缓存时间: %.1fs)", time.Since(tm.competitionCache.timestamp).Seconds())
-		return cachedData, nil
+		log.Printf("📋 返回竞赛数据缓存 (缓存时间: %.1fs)", cacheAge.Seconds())
+		return traders
 	}
 	tm.competitionCache.mu.RUnlock()
 
+	result, _, _ := tm.competitionCache.refresh.Do(competitionRefreshKey, func() (interface{}, error) {
+		return tm.refreshCompetitionTraders(), nil
+	})
+	return result.([]map[string]interface{})
+}
+
+// refreshCompetitionTraders 重新获取全部交易员的竞赛数据并更新缓存
+func (tm *TraderManager) refreshCompetitionTraders() []map[string]interface{} {
 	tm.mu.RLock()
 
 	// 获取所有交易员列表
@@ -516,41 +855,30 @@ func (tm *TraderManager) GetCompetitionData() (map[string]interface{}, error) {
 
 	log.Printf("🔄 重新获取竞赛数据，交易员数量: %d", len(allTraders))
 
-	// 并发获取交易员数据
-	traders := tm.getConcurrentTraderData(allTraders)
-
-	// 按收益率排序（降序）
-	sort.Slice(traders, func(i, j int) bool {
-		pnlPctI, okI := traders[i]["total_pnl_pct"].(float64)
-		pnlPctJ, okJ := traders[j]["total_pnl_pct"].(float64)
-		if !okI {
-			pnlPctI = 0
-		}
-		if !okJ {
-			pnlPctJ = 0
-		}
-		return pnlPctI > pnlPctJ
-	})
-
-	// 限制返回前50名
-	totalCount := len(traders)
-	limit := 50
-	if len(traders) > limit {
-		traders = traders[:limit]
+	// 并发获取交易员数据，按收益率排序（降序）
+	fetch := tm.fetchTraderData
+	if fetch == nil {
+		fetch = tm.getConcurrentTraderData
 	}
-
-	comparison := make(map[string]interface{})
-	comparison["traders"] = traders
-	comparison["count"] = len(traders)
-	comparison["total_count"] = totalCount // 总交易员数量
+	traders := fetch(allTraders)
+	sortTradersDesc(traders, "total_pnl_pct")
 
 	// 更新缓存
 	tm.competitionCache.mu.Lock()
-	tm.competitionCache.data = comparison
-	tm.competitionCache.timestamp = time.Now()
+	tm.competitionCache.traders = traders
+	tm.competitionCache.timestamp = clock.Or(tm.competitionCache.clock).Now()
 	tm.competitionCache.mu.Unlock()
 
-	return comparison, nil
+	return traders
+}
+
+// sortTradersDesc 按指定数值字段对交易员数据降序排序（字段缺失或非数值视为0）
+func sortTradersDesc(traders []map[string]interface{}, key string) {
+	sort.SliceStable(traders, func(i, j int) bool {
+		vi, _ := traders[i][key].(float64)
+		vj, _ := traders[j][key].(float64)
+		return vi > vj
+	})
 }
 
 // getConcurrentTraderData 并发获取多个交易员的数据
@@ -589,6 +917,7 @@ func (tm *TraderManager) getConcurrentTraderData(traders []*trader.AutoTrader) [
 			select {
 			case account := <-accountChan:
 				// 成功获取账户信息
+				observeTraderMetrics(trader, account, status)
 				traderData = map[string]interface{}{
 					"trader_id":              trader.GetID(),
 					"trader_name":            trader.GetName(),
@@ -655,30 +984,199 @@ func (tm *TraderManager) getConcurrentTraderData(traders []*trader.AutoTrader) [
 // GetTopTradersData 获取前5名交易员数据（用于表现对比）
 func (tm *TraderManager) GetTopTradersData() (map[string]interface{}, error) {
 	// 复用竞赛数据缓存，因为前5名是从全部数据中筛选出来的
-	competitionData, err := tm.GetCompetitionData()
+	page, err := tm.GetCompetitionPage("", 0, 5)
 	if err != nil {
 		return nil, err
 	}
 
-	// 从竞赛数据中提取前5名
-	allTraders, ok := competitionData["traders"].([]map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("竞赛数据格式错误")
+	return map[string]interface{}{
+		"traders": page["traders"],
+		"count":   page["count"],
+	}, nil
+}
+
+// GetUserSummary 获取指定用户所有交易员的汇总数据（总净值、合计盈亏、按币种汇总的持仓、各交易员明细）
+func (tm *TraderManager) GetUserSummary(userID string) map[string]interface{} {
+	tm.mu.RLock()
+	userTraders := make([]*trader.AutoTrader, 0)
+	for id, t := range tm.traders {
+		if isUserTrader(id, userID) {
+			userTraders = append(userTraders, t)
+		}
+	}
+	tm.mu.RUnlock()
+
+	sort.Slice(userTraders, func(i, j int) bool {
+		return userTraders[i].GetID() < userTraders[j].GetID()
+	})
+
+	// 账户信息与持仓并发获取
+	var traders []map[string]interface{}
+	var positions [][]map[string]interface{}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		traders = tm.getConcurrentTraderData(userTraders)
+	}()
+	go func() {
+		defer wg.Done()
+		positions = tm.getConcurrentTraderPositions(userTraders)
+	}()
+	wg.Wait()
+
+	summary := summarizeUserTraders(traders, positions)
+	// 各交易所账户的保证金占用（同一账户上的交易员合计）
+	summary["account_exposure"] = tm.exposure.Snapshot(userID)
+	return summary
+}
+
+// getConcurrentTraderPositions 并发获取多个交易员的持仓（失败或超时的交易员返回 nil）
+func (tm *TraderManager) getConcurrentTraderPositions(traders []*trader.AutoTrader) [][]map[string]interface{} {
+	type positionResult struct {
+		index     int
+		positions []map[string]interface{}
+	}
+
+	resultChan := make(chan positionResult, len(traders))
+
+	for i, t := range traders {
+		go func(index int, trader *trader.AutoTrader) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			positionsChan := make(chan []map[string]interface{}, 1)
+			go func() {
+				positions, err := trader.GetPositions()
+				if err != nil {
+					log.Printf("⚠️ 获取交易员 %s 持仓失败: %v", trader.GetID(), err)
+				}
+				positionsChan <- positions
+			}()
+
+			var positions []map[string]interface{}
+			select {
+			case positions = <-positionsChan:
+			case <-ctx.Done():
+				log.Printf("⏰ 获取交易员 %s 持仓超时", trader.GetID())
+			}
+
+			resultChan <- positionResult{index: index, positions: positions}
+		}(i, t)
+	}
+
+	results := make([][]map[string]interface{}, len(traders))
+	for i := 0; i < len(traders); i++ {
+		result := <-resultChan
+		results[result.index] = result.positions
+	}
+
+	return results
+}
+
+// sideTotal 用户汇总中某币种单一方向的持仓合计
+type sideTotal struct {
+	Quantity      float64  `json:"quantity"`
+	Notional      float64  `json:"notional"`
+	UnrealizedPnL float64  `json:"unrealized_pnl"`
+	TraderIDs     []string `json:"trader_ids"`
+}
+
+// symbolTotal 用户汇总中某币种的持仓，多空分开列示
+type symbolTotal struct {
+	Symbol        string     `json:"symbol"`
+	Long          *sideTotal `json:"long,omitempty"`
+	Short         *sideTotal `json:"short,omitempty"`
+	GrossNotional float64    `json:"gross_notional"`
+	Hedged        bool       `json:"hedged"` // 同时存在多仓和空仓（通常来自不同交易员）
+}
+
+// summarizeUserTraders 汇总交易员数据；positions 与 traders 按下标对应
+// 同一币种的多仓和空仓分别累计，不做轧差：不同交易员的反向持仓各自承担风险，净额会低估真实敞口
+func summarizeUserTraders(traders []map[string]interface{}, positions [][]map[string]interface{}) map[string]interface{} {
+	totalEquity, totalPnL := 0.0, 0.0
+	failedCount := 0
+	for _, t := range traders {
+		if _, failed := t["error"]; failed {
+			failedCount++
+			continue
+		}
+		equity, _ := t["total_equity"].(float64)
+		pnl, _ := t["total_pnl"].(float64)
+		totalEquity += equity
+		totalPnL += pnl
 	}
 
-	// 限制返回前5名
-	limit := 5
-	topTraders := allTraders
-	if len(allTraders) > limit {
-		topTraders = allTraders[:limit]
+	// 初始资金合计 = 净值合计 - 盈亏合计
+	totalPnLPct := 0.0
+	if initial := totalEquity - totalPnL; initial > 0 {
+		totalPnLPct = totalPnL / initial * 100
 	}
 
-	result := map[string]interface{}{
-		"traders": topTraders,
-		"count":   len(topTraders),
+	symbols := make(map[string]*symbolTotal)
+	positionCount := 0
+	for i, traderPositions := range positions {
+		traderID := ""
+		if i < len(traders) {
+			traderID, _ = traders[i]["trader_id"].(string)
+		}
+		for _, pos := range traderPositions {
+			symbol, _ := pos["symbol"].(string)
+			side, _ := pos["side"].(string)
+			quantity, _ := pos["quantity"].(float64)
+			if symbol == "" || quantity == 0 {
+				continue
+			}
+			markPrice, _ := pos["mark_price"].(float64)
+			unrealizedPnL, _ := pos["unrealized_pnl"].(float64)
+
+			st, exists := symbols[symbol]
+			if !exists {
+				st = &symbolTotal{Symbol: symbol}
+				symbols[symbol] = st
+			}
+			target := &st.Long
+			if side == "short" {
+				target = &st.Short
+			}
+			if *target == nil {
+				*target = &sideTotal{}
+			}
+			notional := quantity * markPrice
+			(*target).Quantity += quantity
+			(*target).Notional += notional
+			(*target).UnrealizedPnL += unrealizedPnL
+			if traderID != "" {
+				(*target).TraderIDs = append((*target).TraderIDs, traderID)
+			}
+			st.GrossNotional += notional
+			st.Hedged = st.Long != nil && st.Short != nil
+			positionCount++
+		}
 	}
 
-	return result, nil
+	symbolTotals := make([]*symbolTotal, 0, len(symbols))
+	for _, st := range symbols {
+		symbolTotals = append(symbolTotals, st)
+	}
+	sort.Slice(symbolTotals, func(i, j int) bool {
+		return symbolTotals[i].Symbol < symbolTotals[j].Symbol
+	})
+
+	if traders == nil {
+		traders = []map[string]interface{}{}
+	}
+
+	return map[string]interface{}{
+		"total_equity":   totalEquity,
+		"total_pnl":      totalPnL,
+		"total_pnl_pct":  totalPnLPct,
+		"trader_count":   len(traders),
+		"failed_count":   failedCount, // 账户数据获取失败/超时的交易员数（不计入合计）
+		"position_count": positionCount,
+		"positions":      symbolTotals,
+		"traders":        traders,
+	}
 }
 
 // isUserTrader 检查trader是否属于指定用户
@@ -712,7 +1210,7 @@ func containsUserPrefix(traderID string) bool {
 }
 
 // LoadUserTraders 为特定用户加载交易员到内存
-func (tm *TraderManager) LoadUserTraders(database *config.Database, userID string) error {
+func (tm *TraderManager) LoadUserTraders(database TraderStore, userID string) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -722,7 +1220,7 @@ func (tm *TraderManager) LoadUserTraders(database *config.Database, userID strin
 		return fmt.Errorf("获取用户 %s 的交易员列表失败: %w", userID, err)
 	}
 
-	log.Printf("📋 为用户 %s 加载交易员配置: %d 个", userID, len(traders))
+	tm.log().Info("📋 为用户加载交易员配置", logging.KeyUserID, userID, "traders", len(traders))
 
 	// 获取系统配置（不包含信号源，信号源现在为用户级别）
 	maxDailyLossStr, _ := database.GetSystemConfig("max_daily_loss")
@@ -786,6 +1284,10 @@ func (tm *TraderManager) LoadUserTraders(database *config.Database, userID strin
 			log.Printf("⚠️ 交易员 %s 已经加载，跳过", traderCfg.Name)
 			continue
 		}
+		if traderCfg.Disabled {
+			log.Printf("⛔ 交易员 %s 已紧急停用，跳过加载", traderCfg.Name)
+			continue
+		}
 
 		// 从已查询的列表中查找AI模型配置
 
@@ -856,10 +1358,14 @@ func (tm *TraderManager) LoadUserTraders(database *config.Database, userID strin
 //
 // 返回:
 //   - error: 如果交易员不存在、配置无效或加载失败则返回错误
-func (tm *TraderManager) LoadTraderByID(database *config.Database, userID, traderID string) error {
+func (tm *TraderManager) LoadTraderByID(database TraderStore, userID, traderID string) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
+	return tm.loadTraderByID(database, userID, traderID)
+}
 
+// loadTraderByID 从数据库加载指定交易员（调用方须持有 tm.mu 写锁）
+func (tm *TraderManager) loadTraderByID(database TraderStore, userID, traderID string) error {
 	// 1. 检查是否已加载
 	if _, exists := tm.traders[traderID]; exists {
 		log.Printf("⚠️ 交易员 %s 已经加载，跳过", traderID)
@@ -998,7 +1504,10 @@ func (tm *TraderManager) LoadTraderByID(database *config.Database, userID, trade
 }
 
 // loadSingleTrader 加载单个交易员（从现有代码提取的公共逻辑）
-func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string, database *config.Database, userID string) error {
+func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string, database TraderStore, userID string) error {
+	if err := checkTraderEnabled(traderCfg); err != nil {
+		return err
+	}
 	// 处理交易币种列表
 	var tradingCoins []string
 	if traderCfg.TradingSymbols != "" {
@@ -1023,29 +1532,67 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 		effectiveCoinPoolURL = coinPoolURL
 		log.Printf("✓ 交易员 %s 启用 COIN POOL 信号源: %s", traderCfg.Name, coinPoolURL)
 	}
+	if traderCfg.UseOITop && oiTopURL != "" {
+		log.Printf("✓ 交易员 %s 启用 OI TOP 信号源: %s", traderCfg.Name, oiTopURL)
+	}
 
 	// 构建AutoTraderConfig
 	traderConfig := trader.AutoTraderConfig{
-		ID:                   traderCfg.ID,
-		Name:                 traderCfg.Name,
-		AIModel:              aiModelCfg.Provider, // 使用provider作为模型标识
-		Exchange:             exchangeCfg.ID,      // 使用exchange ID
-		InitialBalance:       traderCfg.InitialBalance,
-		BTCETHLeverage:       traderCfg.BTCETHLeverage,
-		AltcoinLeverage:      traderCfg.AltcoinLeverage,
-		ScanInterval:         time.Duration(traderCfg.ScanIntervalMinutes) * time.Minute,
-		CoinPoolAPIURL:       effectiveCoinPoolURL,
-		CustomAPIURL:         aiModelCfg.CustomAPIURL,    // 自定义API URL
-		CustomModelName:      aiModelCfg.CustomModelName, // 自定义模型名称
-		UseQwen:              aiModelCfg.Provider == "qwen",
-		MaxDailyLoss:         maxDailyLoss,
-		MaxDrawdown:          maxDrawdown,
-		StopTradingTime:      time.Duration(stopTradingMinutes) * time.Minute,
-		IsCrossMargin:        traderCfg.IsCrossMargin,
-		DefaultCoins:         defaultCoins,
-		TradingCoins:         tradingCoins,
-		SystemPromptTemplate: traderCfg.SystemPromptTemplate, // 系统提示词模板
-		HyperliquidTestnet:   exchangeCfg.Testnet,            // Hyperliquid测试网
+		ID:                    traderCfg.ID,
+		Name:                  traderCfg.Name,
+		AIModel:               aiModelCfg.Provider, // 使用provider作为模型标识
+		Exchange:              exchangeCfg.ID,      // 使用exchange ID
+		InitialBalance:        traderCfg.InitialBalance,
+		BTCETHLeverage:        traderCfg.BTCETHLeverage,
+		AltcoinLeverage:       traderCfg.AltcoinLeverage,
+		ScanInterval:          time.Duration(traderCfg.ScanIntervalMinutes) * time.Minute,
+		CoinPoolAPIURL:        effectiveCoinPoolURL,
+		UseOITop:              traderCfg.UseOITop,
+		OITopAPIURL:           oiTopURL,
+		CustomAPIURL:          aiModelCfg.CustomAPIURL,    // 自定义API URL
+		CustomModelName:       aiModelCfg.CustomModelName, // 自定义模型名称
+		UseQwen:               aiModelCfg.Provider == "qwen",
+		MaxDailyLoss:          maxDailyLoss,
+		MaxDrawdown:           maxDrawdown,
+		StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
+		IsCrossMargin:         traderCfg.IsCrossMargin,
+		OnEvent:               tm.publishEvent,
+		MaxHoldTime:           time.Duration(traderCfg.MaxHoldMinutes) * time.Minute,
+		OrderTimeout:          time.Duration(traderCfg.OrderTimeoutSeconds) * time.Second,
+		RepeatDecisionLimit:   traderCfg.RepeatDecisionLimit,
+		RepeatDecisionBackoff: time.Duration(traderCfg.RepeatBackoffMinutes) * time.Minute,
+		AITemperature:         optionalSampling(traderCfg.AITemperature),
+		AITopP:                optionalSampling(traderCfg.AITopP),
+		StrategyTag:           traderCfg.StrategyTag,
+		CloseTolerancePct:     traderCfg.CloseReasonTolerancePct,
+		MaxPositionPct:        traderCfg.MaxPositionPctOfEquity,
+		ClampPositionSize:     traderCfg.ClampPositionSize,
+		AllowHighVolOpens:     traderCfg.AllowHighVolOpens,
+		RebaselineSchedule:    traderCfg.RebaselineSchedule,
+		BTCETHMaxSpreadBps:    traderCfg.BTCETHMaxSpreadBps,
+		AltcoinMaxSpreadBps:   traderCfg.AltcoinMaxSpreadBps,
+		SkipAIWithoutTrigger:  traderCfg.SkipAIWithoutTrigger,
+		TriggerPriceMovePct:   traderCfg.TriggerPriceMovePct,
+		TriggerVolumeSpike:    traderCfg.TriggerVolumeSpike,
+		ConsensusOpens:        traderCfg.ConsensusOpens,
+		RetryEmptyDecision:    traderCfg.RetryEmptyDecision,
+		Timezone:              traderCfg.Timezone,
+		DustThresholdUSD:      traderCfg.DustThresholdUSD,
+		AlwaysContextSymbols:  parseSymbolList(traderCfg.AlwaysContextSymbols),
+		DefaultStopLossPct:    traderCfg.DefaultStopLossPct,
+		LeverageTiers:         parseLeverageTiers(traderCfg.LeverageTiers),
+		MarginModes:           parseMarginModes(traderCfg.MarginModes),
+		MaxCorrelatedExposure: traderCfg.MaxCorrelatedExposure,
+		ScanJitterPercent:     traderCfg.ScanJitterPercent,
+		BlacklistSymbols:      parseSymbolList(traderCfg.BlacklistSymbols),
+		MaxOpenPositions:      traderCfg.MaxOpenPositions,
+		PostStopCooldown:      time.Duration(traderCfg.PostStopCooldownMinutes) * time.Minute,
+		AutoBumpMinNotional:   traderCfg.AutoBumpMinNotional,
+		HedgeMode:             traderCfg.HedgeMode,
+		DefaultCoins:          defaultCoins,
+		TradingCoins:          tradingCoins,
+		SystemPromptTemplate:  traderCfg.SystemPromptTemplate, // 系统提示词模板
+		HyperliquidTestnet:    exchangeCfg.Testnet,            // Hyperliquid测试网
 	}
 
 	// 根据交易所类型设置API密钥
@@ -1059,6 +1606,10 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 		traderConfig.AsterUser = exchangeCfg.AsterUser
 		traderConfig.AsterSigner = exchangeCfg.AsterSigner
 		traderConfig.AsterPrivateKey = exchangeCfg.AsterPrivateKey
+	} else if exchangeCfg.ID == "bybit" {
+		traderConfig.BybitAPIKey = exchangeCfg.APIKey
+		traderConfig.BybitSecretKey = exchangeCfg.SecretKey
+		traderConfig.BybitTestnet = exchangeCfg.Testnet
 	}
 
 	// 根据AI模型设置API密钥
@@ -1068,11 +1619,16 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 		traderConfig.DeepSeekKey = aiModelCfg.APIKey
 	}
 
+	// 备用AI模型与影子AI模型（可选）
+	applyFallbackModel(&traderConfig, traderCfg, database, userID)
+	applyShadowModel(&traderConfig, traderCfg, database, userID)
+
 	// 创建trader实例
 	at, err := trader.NewAutoTrader(traderConfig, database, userID)
 	if err != nil {
 		return fmt.Errorf("创建trader失败: %w", err)
 	}
+	loadManualHolds(at, database)
 
 	// 设置自定义prompt（如果有）
 	if traderCfg.CustomPrompt != "" {
@@ -1085,8 +1641,120 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 		}
 	}
 
+	tm.registerExposure(at, userID, exchangeCfg.ID)
 	tm.traders[traderCfg.ID] = at
-	log.Printf("✓ Trader '%s' (%s + %s) 已为用户加载到内存", traderCfg.Name, aiModelCfg.Provider, exchangeCfg.ID)
+	tm.recordRunningState(traderCfg)
+	at.Logger().Info("✓ Trader 已为用户加载到内存", "name", traderCfg.Name, "ai_provider", aiModelCfg.Provider)
+	return nil
+}
+
+// ReloadTrader 热重载单个交易员：停止旧实例（等待当前决策周期和持仓操作完成）后按数据库最新配置重建，
+// 并接管旧实例的运行时状态（峰值盈亏缓存、持仓跟踪、日亏损熔断等）；旧实例原本在运行则新实例自动启动，新配置从下一个周期生效。
+// 等待当前周期超时时不会同时运行新旧实例：在后台等旧实例的周期结束后再完成替换，并返回 ErrReloadPending
+func (tm *TraderManager) ReloadTrader(database TraderStore, userID, traderID string) error {
+	tm.mu.RLock()
+	old, exists := tm.traders[traderID]
+	tm.mu.RUnlock()
+
+	wasRunning := false
+	if exists && old != nil {
+		stop := tm.stopTrader
+		if stop == nil {
+			stop = stopIfRunning
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), reloadStopTimeout)
+		running, err := stop(ctx, old)
+		cancel()
+		wasRunning = running
+		if err != nil {
+			// 当前周期仍在执行（可能正在下单/平仓），此时重建会让新旧实例同时操作持仓；旧实例已收到停止信号，周期结束后再替换
+			old.Logger().Warn("⏳ 等待当前周期结束超时，周期结束后完成热重载", "error", err)
+			go func() {
+				_ = old.WaitStopped(context.Background())
+				if err := tm.replaceTrader(database, userID, traderID, old, wasRunning); err != nil {
+					old.Logger().Error("❌ 交易员热重载失败", "error", err)
+				}
+			}()
+			return ErrReloadPending
+		}
+	}
+
+	return tm.replaceTrader(database, userID, traderID, old, wasRunning)
+}
+
+// stopIfRunning 停止运行中的交易员，返回其停止前是否在运行
+func stopIfRunning(ctx context.Context, at *trader.AutoTrader) (bool, error) {
+	if isRunning, ok := at.GetStatus()["is_running"].(bool); !ok || !isRunning {
+		return false, nil
+	}
+	return true, at.Stop(ctx)
+}
+
+// replaceTrader 按数据库最新配置重建已停止的旧实例（old 可为 nil）并接管其运行时状态，wasRunning 时启动新实例；
+// 新配置加载失败时保留旧实例，旧实例原本在运行则重新启动，避免交易员标记为运行中却没有实例在交易；
+// 等待期间交易员已被删除或被另一次热重载替换时放弃本次替换，不覆盖更新的实例
+func (tm *TraderManager) replaceTrader(database TraderStore, userID, traderID string, old *trader.AutoTrader, wasRunning bool) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.traders[traderID] != old {
+		tm.log().Warn("⚠️ 交易员已被删除或替换，放弃本次热重载", logging.KeyTraderID, traderID)
+		return nil
+	}
+
+	delete(tm.traders, traderID)
+	if err := tm.loadTraderByID(database, userID, traderID); err != nil {
+		if errors.Is(err, trader.ErrTraderDisabled) {
+			// 已紧急停用：旧实例已停止，不再保留在内存中
+			delete(tm.runningAtLoad, traderID)
+			tm.exposure.Unregister(traderID)
+			tm.log().Warn("⛔ 交易员已紧急停用，热重载后不再加载", logging.KeyTraderID, traderID)
+			return nil
+		}
+		if old != nil {
+			tm.traders[traderID] = old // 新配置加载失败时保留旧实例
+			if wasRunning {
+				tm.startTrader(old)
+			}
+		}
+		return err
+	}
+
+	reloaded := tm.traders[traderID]
+	if old != nil {
+		reloaded.TakeOverFrom(old)
+	}
+	if wasRunning {
+		tm.startTrader(reloaded)
+	}
+
+	reloaded.Logger().Info("🔄 交易员已热重载", "running", wasRunning)
+	return nil
+}
+
+// SetTraderDisabled 紧急停用或解除停用交易员（调用方须先更新数据库中的停用标记）
+// 停用：已加载的交易员标记停用（进行中的周期不再执行新的决策）并停止运行，等待当前周期结束受 ctx 超时约束，
+// 停用后仍保留在内存中以便查询状态；解除：已加载的交易员清除标记（不自动启动），未加载的交易员从数据库加载
+func (tm *TraderManager) SetTraderDisabled(ctx context.Context, database TraderStore, userID, traderID string, disabled bool) error {
+	tm.mu.RLock()
+	at, exists := tm.traders[traderID]
+	tm.mu.RUnlock()
+
+	if !disabled {
+		if exists {
+			at.SetDisabled(false)
+			return nil
+		}
+		return tm.LoadTraderByID(database, userID, traderID)
+	}
+
+	if !exists {
+		return nil
+	}
+	at.SetDisabled(true)
+	if isRunning, ok := at.GetStatus()["is_running"].(bool); ok && isRunning {
+		return at.Stop(ctx)
+	}
 	return nil
 }
 
@@ -1096,8 +1764,146 @@ func (tm *TraderManager) RemoveTrader(traderID string) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	if _, exists := tm.traders[traderID]; exists {
+	if t, exists := tm.traders[traderID]; exists {
 		delete(tm.traders, traderID)
-		log.Printf("✓ Trader %s 已从内存中移除", traderID)
+		delete(tm.runningAtLoad, traderID)
+		tm.exposure.Unregister(traderID)
+		if t != nil {
+			metrics.RemoveTrader(traderID, t.GetExchange())
+		}
+		tm.log().Info("✓ Trader 已从内存中移除", logging.KeyTraderID, traderID)
+	}
+}
+
+// observeTraderMetrics 将交易员账户信息和运行状态写入 Prometheus 指标
+func observeTraderMetrics(t *trader.AutoTrader, account, status map[string]interface{}) {
+	snapshot := metrics.TraderSnapshot{}
+	snapshot.Equity, _ = account["total_equity"].(float64)
+	snapshot.UnrealizedPnL, _ = account["unrealized_profit"].(float64)
+	snapshot.OpenPositions, _ = account["position_count"].(int)
+	snapshot.CallCount, _ = status["call_count"].(int)
+	snapshot.ConsecutiveLosses, _ = status["consecutive_losses"].(int)
+	metrics.ObserveTrader(t.GetID(), t.GetExchange(), snapshot)
+}
+
+// applyFallbackModel 按交易员配置的备用AI模型ID填充备用模型配置（模型不存在或未启用时忽略）
+func applyFallbackModel(traderConfig *trader.AutoTraderConfig, traderCfg *config.TraderRecord, database TraderStore, userID string) {
+	if traderCfg.FallbackAIModelID == traderCfg.AIModelID {
+		return
+	}
+	model := findEnabledAIModel(traderCfg, traderCfg.FallbackAIModelID, "备用", database, userID)
+	if model == nil {
+		return
+	}
+	traderConfig.FallbackAIModel = model.Provider
+	traderConfig.FallbackAPIKey = model.APIKey
+	traderConfig.FallbackAPIURL = model.CustomAPIURL
+	traderConfig.FallbackModelName = model.CustomModelName
+}
+
+// applyShadowModel 按交易员配置的影子AI模型ID填充影子模型配置（模型不存在或未启用时忽略）
+func applyShadowModel(traderConfig *trader.AutoTraderConfig, traderCfg *config.TraderRecord, database TraderStore, userID string) {
+	model := findEnabledAIModel(traderCfg, traderCfg.ShadowAIModelID, "影子", database, userID)
+	if model == nil {
+		return
+	}
+	traderConfig.ShadowAIModel = model.Provider
+	traderConfig.ShadowAPIKey = model.APIKey
+	traderConfig.ShadowAPIURL = model.CustomAPIURL
+	traderConfig.ShadowModelName = model.CustomModelName
+}
+
+// findEnabledAIModel 查找交易员引用的已启用AI模型（modelID 为空、模型不存在或未启用时返回 nil），role 用于日志
+func findEnabledAIModel(traderCfg *config.TraderRecord, modelID, role string, database TraderStore, userID string) *config.AIModelConfig {
+	if modelID == "" {
+		return nil
+	}
+
+	aiModels, err := database.GetAIModels(userID)
+	if err != nil {
+		log.Printf("⚠️  获取交易员 %s 的%sAI模型失败: %v", traderCfg.Name, role, err)
+		return nil
+	}
+	for _, model := range aiModels {
+		if model.ID != modelID {
+			continue
+		}
+		if !model.Enabled {
+			log.Printf("⚠️  交易员 %s 的%sAI模型 %s 未启用，忽略", traderCfg.Name, role, model.ID)
+			return nil
+		}
+		log.Printf("✓ 交易员 %s 启用%sAI模型: %s", traderCfg.Name, role, model.ID)
+		return model
+	}
+	log.Printf("⚠️  交易员 %s 的%sAI模型 %s 不存在，忽略", traderCfg.Name, role, modelID)
+	return nil
+}
+
+// parseSymbolList 解析逗号分隔的币种列表（忽略空项）
+func parseSymbolList(value string) []string {
+	var symbols []string
+	for _, symbol := range strings.Split(value, ",") {
+		if symbol = strings.TrimSpace(symbol); symbol != "" {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+// parseLeverageTiers 解析 JSON 格式的杠杆分级（币种 -> 杠杆倍数），为空或格式错误时返回 nil（使用两档杠杆）
+func parseLeverageTiers(value string) map[string]int {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var tiers map[string]int
+	if err := json.Unmarshal([]byte(value), &tiers); err != nil {
+		log.Printf("⚠️  杠杆分级配置格式错误，使用BTC/ETH与山寨币两档杠杆: %v", err)
+		return nil
+	}
+	return tiers
+}
+
+// manualHoldLoader 可读取手动持仓标记的存储（*config.Database 实现，MemoryStore 不支持）
+type manualHoldLoader interface {
+	GetManualHolds(traderID string) ([]*config.ManualHold, error)
+}
+
+// loadManualHolds 从数据库恢复交易员的手动持仓标记（存储不支持或读取失败时忽略）
+func loadManualHolds(at *trader.AutoTrader, database TraderStore) {
+	loader, ok := database.(manualHoldLoader)
+	if !ok {
+		return
+	}
+	holds, err := loader.GetManualHolds(at.GetID())
+	if err != nil {
+		log.Printf("⚠️ 读取交易员 %s 的手动持仓标记失败: %v", at.GetID(), err)
+		return
+	}
+	for _, hold := range holds {
+		at.SetManualHold(hold.Symbol, hold.Note)
+	}
+	if len(holds) > 0 {
+		log.Printf("✓ 已恢复 %d 个手动持仓标记", len(holds))
+	}
+}
+
+// optionalSampling 将数据库中的采样参数转换为可选值：负数表示未设置（使用AI客户端默认值）
+func optionalSampling(value float64) *float64 {
+	if value < 0 {
+		return nil
+	}
+	return &value
+}
+
+// parseMarginModes 解析 JSON 格式的按币种仓位模式（币种 -> cross/isolated），为空或格式错误时返回 nil（全部使用账户级仓位模式）
+func parseMarginModes(value string) map[string]string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var modes map[string]string
+	if err := json.Unmarshal([]byte(value), &modes); err != nil {
+		log.Printf("⚠️  按币种仓位模式配置格式错误，全部使用默认仓位模式: %v", err)
+		return nil
 	}
+	return modes
 }
@@ -1,7 +1,14 @@
 package manager
 
 import (
+	"fmt"
+	"nofx/clock"
+	"nofx/trader"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // TestRemoveTrader 测试从内存中移除trader
@@ -85,3 +92,237 @@ func TestGetTrader_AfterRemove(t *testing.T) {
 		t.Error("获取已移除的 trader 应该返回错误")
 	}
 }
+
+// TestSummarizeUserTraders 测试用户汇总：失败的交易员不计入合计，同币种多空分开列示
+func TestSummarizeUserTraders(t *testing.T) {
+	traders := []map[string]interface{}{
+		{"trader_id": "u1_a", "total_equity": 1200.0, "total_pnl": 200.0},
+		{"trader_id": "u1_b", "total_equity": 900.0, "total_pnl": -100.0},
+		{"trader_id": "u1_c", "total_equity": 0.0, "total_pnl": 0.0, "error": "获取超时"},
+	}
+	positions := [][]map[string]interface{}{
+		{
+			{"symbol": "BTCUSDT", "side": "long", "quantity": 0.1, "mark_price": 50000.0, "unrealized_pnl": 50.0},
+			{"symbol": "ETHUSDT", "side": "long", "quantity": 1.0, "mark_price": 3000.0, "unrealized_pnl": 10.0},
+		},
+		{
+			{"symbol": "BTCUSDT", "side": "short", "quantity": 0.1, "mark_price": 50000.0, "unrealized_pnl": -50.0},
+			{"symbol": "ETHUSDT", "side": "long", "quantity": 0.5, "mark_price": 3000.0, "unrealized_pnl": 5.0},
+		},
+		nil,
+	}
+
+	summary := summarizeUserTraders(traders, positions)
+
+	if summary["total_equity"] != 2100.0 || summary["total_pnl"] != 100.0 {
+		t.Errorf("合计净值/盈亏错误: %v / %v", summary["total_equity"], summary["total_pnl"])
+	}
+	if pct := summary["total_pnl_pct"].(float64); pct != 5.0 {
+		t.Errorf("total_pnl_pct = %v, want 5 (100 / 2000)", pct)
+	}
+	if summary["failed_count"] != 1 || summary["trader_count"] != 3 || summary["position_count"] != 4 {
+		t.Errorf("计数错误: failed=%v traders=%v positions=%v", summary["failed_count"], summary["trader_count"], summary["position_count"])
+	}
+
+	symbols := summary["positions"].([]*symbolTotal)
+	if len(symbols) != 2 || symbols[0].Symbol != "BTCUSDT" || symbols[1].Symbol != "ETHUSDT" {
+		t.Fatalf("币种汇总错误: %+v", symbols)
+	}
+
+	// BTC 一多一空：不轧差，总名义价值为两边之和
+	btc := symbols[0]
+	if !btc.Hedged || btc.Long == nil || btc.Short == nil {
+		t.Fatalf("BTC 应同时列出多空: %+v", btc)
+	}
+	if btc.Long.Notional != 5000 || btc.Short.Notional != 5000 || btc.GrossNotional != 10000 {
+		t.Errorf("BTC 名义价值错误: long=%v short=%v gross=%v", btc.Long.Notional, btc.Short.Notional, btc.GrossNotional)
+	}
+	if len(btc.Long.TraderIDs) != 1 || btc.Long.TraderIDs[0] != "u1_a" || btc.Short.TraderIDs[0] != "u1_b" {
+		t.Errorf("BTC 交易员归属错误: long=%v short=%v", btc.Long.TraderIDs, btc.Short.TraderIDs)
+	}
+
+	eth := symbols[1]
+	if eth.Hedged || eth.Short != nil || eth.Long.Quantity != 1.5 || eth.Long.UnrealizedPnL != 15 {
+		t.Errorf("ETH 同向持仓应合并: %+v", eth.Long)
+	}
+}
+
+// TestPublishEvent_NonBlocking 测试事件推送给所有订阅者，订阅者缓冲区满时丢弃而不阻塞
+func TestPublishEvent_NonBlocking(t *testing.T) {
+	tm := NewTraderManager()
+	fast := tm.Subscribe()
+	slow := tm.Subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < eventBufferSize+10; i++ {
+			tm.publishEvent(trader.Event{TraderID: "t1", Type: trader.EventStarted})
+			if i < eventBufferSize {
+				<-fast
+			}
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("publishEvent 在订阅者缓冲区满时阻塞")
+	}
+
+	if got := len(slow); got != eventBufferSize {
+		t.Errorf("慢订阅者应缓冲 %d 个事件, got %d", eventBufferSize, got)
+	}
+	event := <-slow
+	if event.TraderID != "t1" || event.Type != trader.EventStarted {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	tm.Unsubscribe(fast)
+	for range fast { // 读出剩余事件直到通道关闭
+	}
+	tm.publishEvent(trader.Event{TraderID: "t1", Type: trader.EventStopped})
+	if len(tm.subscribers) != 1 {
+		t.Errorf("取消订阅后应剩 1 个订阅者, got %d", len(tm.subscribers))
+	}
+}
+
+// TestGetCompetitionData_CacheExpiry 测试竞赛数据缓存30秒内直接返回，过期后重新获取
+func TestGetCompetitionData_CacheExpiry(t *testing.T) {
+	tm := NewTraderManager()
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	tm.competitionCache.clock = fake
+
+	if _, err := tm.GetCompetitionData(); err != nil {
+		t.Fatalf("GetCompetitionData 失败: %v", err)
+	}
+	// 标记缓存内容，用于区分是否重新获取
+	tm.competitionCache.traders = []map[string]interface{}{{"trader_id": "cached"}}
+
+	fake.Advance(29 * time.Second)
+	data, _ := tm.GetCompetitionData()
+	if data["count"] != 1 {
+		t.Errorf("30秒内应返回缓存, got count=%v", data["count"])
+	}
+
+	fake.Advance(2 * time.Second)
+	data, _ = tm.GetCompetitionData()
+	if data["count"] != 0 {
+		t.Errorf("缓存过期后应重新获取, got count=%v", data["count"])
+	}
+}
+
+// TestGetCompetitionData_SingleFlight 测试缓存失效时并发请求只触发一次刷新，所有调用方共享同一结果
+func TestGetCompetitionData_SingleFlight(t *testing.T) {
+	tm := NewTraderManager()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	tm.fetchTraderData = func([]*trader.AutoTrader) []map[string]interface{} {
+		calls.Add(1)
+		<-release // 模拟缓慢的交易所请求
+		return []map[string]interface{}{{"trader_id": "t1", "total_pnl_pct": 1.0}}
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	counts := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := tm.GetCompetitionData()
+			if err != nil {
+				t.Errorf("GetCompetitionData 失败: %v", err)
+				return
+			}
+			counts[i] = data["count"]
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond) // 等待所有调用进入刷新
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("并发请求应只刷新一次, got %d", got)
+	}
+	for i, count := range counts {
+		if count != 1 {
+			t.Errorf("调用 %d 应得到刷新结果, got count=%v", i, count)
+		}
+	}
+
+	// 刷新完成后命中缓存，不再请求
+	tm.GetCompetitionData()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("缓存有效期内不应再次刷新, got %d", got)
+	}
+}
+
+// TestGetCompetitionPage 测试排行榜分页：按排序字段切出请求的窗口，total_count 为全部交易员数量
+func TestGetCompetitionPage(t *testing.T) {
+	tm := NewTraderManager()
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	tm.competitionCache.clock = fake
+
+	// 预置缓存：12 名交易员，收益率从高到低，净值从低到高
+	var traders []map[string]interface{}
+	for i := 0; i < 12; i++ {
+		traders = append(traders, map[string]interface{}{
+			"trader_id":     fmt.Sprintf("t%02d", i),
+			"total_pnl_pct": float64(100 - i),
+			"total_equity":  float64(1000 + i),
+		})
+	}
+	tm.competitionCache.traders = traders
+	tm.competitionCache.timestamp = fake.Now()
+
+	ids := func(page map[string]interface{}) []string {
+		var result []string
+		for _, tr := range page["traders"].([]map[string]interface{}) {
+			result = append(result, tr["trader_id"].(string))
+		}
+		return result
+	}
+
+	page, err := tm.GetCompetitionPage("", 5, 5)
+	if err != nil {
+		t.Fatalf("GetCompetitionPage 失败: %v", err)
+	}
+	if got, want := ids(page), []string{"t05", "t06", "t07", "t08", "t09"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("第2页 = %v, want %v", got, want)
+	}
+	if page["count"] != 5 || page["total_count"] != 12 {
+		t.Errorf("count=%v total_count=%v, want 5 / 12", page["count"], page["total_count"])
+	}
+
+	// 最后一页不足 limit
+	page, _ = tm.GetCompetitionPage("", 10, 5)
+	if got, want := ids(page), []string{"t10", "t11"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("最后一页 = %v, want %v", got, want)
+	}
+
+	// 超出范围返回空页，total_count 不变
+	page, _ = tm.GetCompetitionPage("", 20, 5)
+	if page["count"] != 0 || page["total_count"] != 12 {
+		t.Errorf("越界页 count=%v total_count=%v", page["count"], page["total_count"])
+	}
+
+	// 按净值排序不改变缓存中的收益率顺序
+	page, _ = tm.GetCompetitionPage("total_equity", 0, 2)
+	if got, want := ids(page), []string{"t11", "t10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("按净值排序 = %v, want %v", got, want)
+	}
+	if tm.competitionCache.traders[0]["trader_id"] != "t00" {
+		t.Error("按其他字段排序不应修改缓存")
+	}
+
+	if _, err := tm.GetCompetitionPage("name", 0, 5); err == nil {
+		t.Error("不支持的排序字段应返回错误")
+	}
+
+	// 前5名复用同一缓存
+	top, _ := tm.GetTopTradersData()
+	if got, want := ids(top), []string{"t00", "t01", "t02", "t03", "t04"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("前5名 = %v, want %v", got, want)
+	}
+}
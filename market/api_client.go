@@ -100,6 +100,66 @@ func (c *APIClient) GetKlines(symbol, interval string, limit int) ([]Kline, erro
 	return klines, nil
 }
 
+// klinesRangePageLimit 单次请求K线的最大数量（币安上限1500）
+const klinesRangePageLimit = 1500
+
+// GetKlinesRange 获取指定时间范围内的历史K线（毫秒时间戳，自动分页）
+func (c *APIClient) GetKlinesRange(symbol, interval string, startTime, endTime int64) ([]Kline, error) {
+	url := fmt.Sprintf("%s/fapi/v1/klines", baseURL)
+
+	var klines []Kline
+	for startTime < endTime {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		q := req.URL.Query()
+		q.Add("symbol", symbol)
+		q.Add("interval", interval)
+		q.Add("startTime", strconv.FormatInt(startTime, 10))
+		q.Add("endTime", strconv.FormatInt(endTime, 10))
+		q.Add("limit", strconv.Itoa(klinesRangePageLimit))
+		req.URL.RawQuery = q.Encode()
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		var klineResponses []KlineResponse
+		if err := json.Unmarshal(body, &klineResponses); err != nil {
+			log.Printf("获取K线数据失败,响应内容: %s", string(body))
+			return nil, err
+		}
+		if len(klineResponses) == 0 {
+			break
+		}
+
+		for _, kr := range klineResponses {
+			kline, err := parseKline(kr)
+			if err != nil {
+				log.Printf("解析K线数据失败: %v", err)
+				continue
+			}
+			klines = append(klines, kline)
+		}
+
+		if len(klineResponses) < klinesRangePageLimit || len(klines) == 0 {
+			break
+		}
+		// 下一页从最后一根K线收盘之后开始
+		startTime = klines[len(klines)-1].CloseTime + 1
+	}
+
+	return klines, nil
+}
+
 func parseKline(kr KlineResponse) (Kline, error) {
 	var kline Kline
 
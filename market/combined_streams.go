@@ -4,44 +4,119 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"nofx/metrics"
 	"strings"
 	"sync"
 	"time"
-	"net/http"
 
 	"github.com/gorilla/websocket"
 )
 
+// DefaultCombinedStreamURL 币安合约组合流地址
+const DefaultCombinedStreamURL = "wss://fstream.binance.com/stream"
+
+// StreamConfig 组合流连接配置（字段为空时使用默认值）
+type StreamConfig struct {
+	URL      string // 组合流地址（ws:// 或 wss://，默认 DefaultCombinedStreamURL，测试网或区域节点需修改）
+	ProxyURL string // 代理地址（如 http://proxy:8080、socks5://127.0.0.1:1080），为空时使用环境变量 HTTPS_PROXY/HTTP_PROXY
+}
+
+// Validate 校验组合流地址必须为 ws/wss，代理地址必须包含协议和主机
+func (cfg StreamConfig) Validate() error {
+	if cfg.URL != "" {
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			return fmt.Errorf("组合流地址无效: %w", err)
+		}
+		if u.Scheme != "ws" && u.Scheme != "wss" {
+			return fmt.Errorf("组合流地址必须使用 ws:// 或 wss://: %s", cfg.URL)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("组合流地址缺少主机: %s", cfg.URL)
+		}
+	}
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("代理地址无效: %w", err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("代理地址必须包含协议和主机（如 http://proxy:8080）: %s", cfg.ProxyURL)
+		}
+	}
+	return nil
+}
+
+// newStreamDialer 按配置创建拨号器：配置了代理时固定走该代理，否则按环境变量
+func newStreamDialer(cfg StreamConfig) websocket.Dialer {
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		Proxy:            http.ProxyFromEnvironment,
+	}
+	if cfg.ProxyURL != "" {
+		proxyURL, _ := url.Parse(cfg.ProxyURL) // 已在 Validate 中校验
+		dialer.Proxy = http.ProxyURL(proxyURL)
+	}
+	return dialer
+}
+
+// resubscribeVerifyTimeout 重新订阅后等待数据恢复的时长，超时仍无消息则强制重连
+const resubscribeVerifyTimeout = 30 * time.Second
+
 type CombinedStreamsClient struct {
-	conn        *websocket.Conn
-	mu          sync.RWMutex
-	subscribers map[string]chan []byte
-	reconnect   bool
-	done        chan struct{}
-	batchSize   int // 每批订阅的流数量
+	conn          *websocket.Conn
+	mu            sync.RWMutex
+	subscribers   map[string]chan []byte
+	lastMessageAt map[string]time.Time // 各流最近一次收到消息的时间（订阅时记为起点）
+	reconnect     bool
+	done          chan struct{}
+	batchSize     int              // 每批订阅的流数量
+	endpoint      string           // 组合流地址
+	dialer        websocket.Dialer // 连接使用的拨号器（含代理配置）
+
+	resubscribeTimeout time.Duration // 重新订阅后等待数据恢复的时长
 
 	// 测试用 hook（生产环境为 nil）
 	// 重连时调用，传入需要重新订阅的流列表
 	onReconnectSubscribeFunc func(streams []string)
+	// 重新订阅后超时仍未收到数据、强制重连前调用
+	onResubscribeStalledFunc func(streams []string)
+}
+
+// StreamHealth 组合流连接健康状态
+type StreamHealth struct {
+	ActiveStreams    int           // 当前订阅的流数量
+	OldestMessageAge time.Duration // 各流距最近一条消息的最长时长（从未收到消息的流从订阅时起算）
 }
 
-func NewCombinedStreamsClient(batchSize int) *CombinedStreamsClient {
+// NewCombinedStreamsClient 创建组合流客户端，stream 为连接地址和代理配置（为空时使用默认地址和环境变量代理，
+// 配置无效时打印警告并回退到默认值）
+func NewCombinedStreamsClient(batchSize int, stream StreamConfig) *CombinedStreamsClient {
+	if err := stream.Validate(); err != nil {
+		log.Printf("⚠️ 组合流配置无效: %v，使用默认地址 %s 和环境变量代理", err, DefaultCombinedStreamURL)
+		stream = StreamConfig{}
+	}
+	endpoint := stream.URL
+	if endpoint == "" {
+		endpoint = DefaultCombinedStreamURL
+	}
 	return &CombinedStreamsClient{
-		subscribers: make(map[string]chan []byte),
-		reconnect:   true,
-		done:        make(chan struct{}),
-		batchSize:   batchSize,
+		subscribers:        make(map[string]chan []byte),
+		lastMessageAt:      make(map[string]time.Time),
+		reconnect:          true,
+		done:               make(chan struct{}),
+		batchSize:          batchSize,
+		endpoint:           endpoint,
+		dialer:             newStreamDialer(stream),
+		resubscribeTimeout: resubscribeVerifyTimeout,
 	}
 }
 
 func (c *CombinedStreamsClient) Connect() error {
-	dialer := websocket.Dialer{
-		HandshakeTimeout: 10 * time.Second,
-		Proxy           : http.ProxyFromEnvironment,
-	}
-
 	// 组合流使用不同的端点
-	conn, _, err := dialer.Dial("wss://fstream.binance.com/stream", nil)
+	conn, _, err := c.dialer.Dial(c.endpoint, nil)
 	if err != nil {
 		return fmt.Errorf("组合流WebSocket连接失败: %v", err)
 	}
@@ -99,8 +174,20 @@ func (c *CombinedStreamsClient) splitIntoBatches(symbols []string, batchSize int
 
 // subscribeStreams 订阅多个流
 func (c *CombinedStreamsClient) subscribeStreams(streams []string) error {
-	subscribeMsg := map[string]interface{}{
-		"method": "SUBSCRIBE",
+	log.Printf("订阅流: %v", streams)
+	return c.sendStreamRequest("SUBSCRIBE", streams)
+}
+
+// unsubscribeStreams 取消订阅多个流
+func (c *CombinedStreamsClient) unsubscribeStreams(streams []string) error {
+	log.Printf("取消订阅流: %v", streams)
+	return c.sendStreamRequest("UNSUBSCRIBE", streams)
+}
+
+// sendStreamRequest 发送订阅/取消订阅请求
+func (c *CombinedStreamsClient) sendStreamRequest(method string, streams []string) error {
+	request := map[string]interface{}{
+		"method": method,
 		"params": streams,
 		"id":     time.Now().UnixNano(),
 	}
@@ -111,9 +198,7 @@ func (c *CombinedStreamsClient) subscribeStreams(streams []string) error {
 	if c.conn == nil {
 		return fmt.Errorf("WebSocket未连接")
 	}
-
-	log.Printf("订阅流: %v", streams)
-	return c.conn.WriteJSON(subscribeMsg)
+	return c.conn.WriteJSON(request)
 }
 
 func (c *CombinedStreamsClient) readMessages() {
@@ -154,16 +239,18 @@ func (c *CombinedStreamsClient) handleCombinedMessage(message []byte) {
 		return
 	}
 
-	c.mu.RLock()
+	// 持锁投递（非阻塞），避免与 RemoveSubscriber 关闭通道并发导致向已关闭的通道发送
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	ch, exists := c.subscribers[combinedMsg.Stream]
-	c.mu.RUnlock()
-
-	if exists {
-		select {
-		case ch <- combinedMsg.Data:
-		default:
-			log.Printf("订阅者通道已满: %s", combinedMsg.Stream)
-		}
+	if !exists {
+		return
+	}
+	c.lastMessageAt[combinedMsg.Stream] = time.Now()
+	select {
+	case ch <- combinedMsg.Data:
+	default:
+		log.Printf("订阅者通道已满: %s", combinedMsg.Stream)
 	}
 }
 
@@ -171,16 +258,90 @@ func (c *CombinedStreamsClient) AddSubscriber(stream string, bufferSize int) <-c
 	ch := make(chan []byte, bufferSize)
 	c.mu.Lock()
 	c.subscribers[stream] = ch
+	c.lastMessageAt[stream] = time.Now()
 	c.mu.Unlock()
 	return ch
 }
 
+// RemoveSubscriber 移除流的订阅者并关闭其通道（流不存在时返回 false）
+func (c *CombinedStreamsClient) RemoveSubscriber(stream string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, exists := c.subscribers[stream]
+	if !exists {
+		return false
+	}
+	close(ch)
+	delete(c.subscribers, stream)
+	delete(c.lastMessageAt, stream)
+	return true
+}
+
+// HealthStatus 返回订阅流数量和各流中最久未收到消息的时长
+func (c *CombinedStreamsClient) HealthStatus() StreamHealth {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	health := StreamHealth{ActiveStreams: len(c.subscribers)}
+	for stream := range c.subscribers {
+		if age := time.Since(c.lastMessageAt[stream]); age > health.OldestMessageAge {
+			health.OldestMessageAge = age
+		}
+	}
+	return health
+}
+
+// streamsResumedSince 指定的流中是否有任何一个在 since 之后收到过消息
+func (c *CombinedStreamsClient) streamsResumedSince(streams []string, since time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, stream := range streams {
+		if c.lastMessageAt[stream].After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyResubscribe 重新订阅后等待 resubscribeTimeout，期间重新订阅的流都没有收到消息时
+// （交易所接受了订阅却不推送数据），主动关闭连接，由读循环触发完整的重连和重新订阅
+func (c *CombinedStreamsClient) verifyResubscribe(streams []string, since time.Time) {
+	timer := time.NewTimer(c.resubscribeTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-c.done:
+		return
+	case <-timer.C:
+	}
+
+	if c.streamsResumedSince(streams, since) {
+		return
+	}
+
+	log.Printf("⚠️  重新订阅后 %v 内未收到任何数据，强制重连", c.resubscribeTimeout)
+	metrics.WSResubscribeStalls.Inc()
+	if c.onResubscribeStalledFunc != nil {
+		c.onResubscribeStalledFunc(streams)
+	}
+
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
 func (c *CombinedStreamsClient) handleReconnect() {
 	if !c.reconnect {
 		return
 	}
 
 	log.Println("组合流尝试重新连接...")
+	metrics.WSReconnects.Inc()
 	time.Sleep(3 * time.Second)
 
 	if err := c.Connect(); err != nil {
@@ -206,10 +367,13 @@ func (c *CombinedStreamsClient) handleReconnect() {
 			c.onReconnectSubscribeFunc(streams)
 		}
 
+		subscribedAt := time.Now()
 		if err := c.subscribeStreams(streams); err != nil {
 			log.Printf("⚠️  重新订阅失败: %v", err)
 		} else {
 			log.Printf("✅ 重新订阅成功")
+			// 订阅成功不代表数据已恢复，超时未收到消息则强制重连
+			go c.verifyResubscribe(streams, subscribedAt)
 		}
 	}
 }
@@ -229,5 +393,6 @@ func (c *CombinedStreamsClient) Close() {
 	for stream, ch := range c.subscribers {
 		close(ch)
 		delete(c.subscribers, stream)
+		delete(c.lastMessageAt, stream)
 	}
 }
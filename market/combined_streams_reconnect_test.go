@@ -1,15 +1,20 @@
 package market
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 // TestCombinedStreamsClient_ReconnectResubscribes 测试重连后是否重新订阅
 // TDD Red: 这个测试应该失败，证明当前没有重新订阅
 func TestCombinedStreamsClient_ReconnectResubscribes(t *testing.T) {
-	client := NewCombinedStreamsClient(10)
+	client := NewCombinedStreamsClient(10, StreamConfig{})
 
 	// 模拟初始化时添加的订阅者（正常情况下是在 Start() 时添加的）
 	expectedStreams := []string{
@@ -92,7 +97,7 @@ func TestCombinedStreamsClient_ReconnectResubscribes(t *testing.T) {
 
 // TestCombinedStreamsClient_ReconnectWithNoSubscribers 测试没有订阅者时的重连
 func TestCombinedStreamsClient_ReconnectWithNoSubscribers(t *testing.T) {
-	client := NewCombinedStreamsClient(10)
+	client := NewCombinedStreamsClient(10, StreamConfig{})
 
 	// 没有添加任何订阅者
 
@@ -137,7 +142,7 @@ func TestCombinedStreamsClient_ReconnectWithNoSubscribers(t *testing.T) {
 
 // TestCombinedStreamsClient_GetSubscribersList 辅助测试：验证可以获取订阅者列表
 func TestCombinedStreamsClient_GetSubscribersList(t *testing.T) {
-	client := NewCombinedStreamsClient(10)
+	client := NewCombinedStreamsClient(10, StreamConfig{})
 
 	// 添加订阅者
 	expectedStreams := []string{
@@ -167,3 +172,122 @@ func TestCombinedStreamsClient_GetSubscribersList(t *testing.T) {
 	t.Logf("✅ 可以从 subscribers map 获取到 %d 个流", len(streams))
 	t.Logf("   流列表: %v", streams)
 }
+
+// TestCombinedStreamsClient_HealthStatus 测试订阅流数量和最久未收到消息的时长
+func TestCombinedStreamsClient_HealthStatus(t *testing.T) {
+	client := NewCombinedStreamsClient(10, StreamConfig{})
+	client.AddSubscriber("btcusdt@kline_3m", 10)
+	client.AddSubscriber("ethusdt@kline_3m", 10)
+
+	client.mu.Lock()
+	client.lastMessageAt["ethusdt@kline_3m"] = time.Now().Add(-2 * time.Minute)
+	client.mu.Unlock()
+	client.handleCombinedMessage([]byte(`{"stream":"btcusdt@kline_3m","data":{}}`))
+
+	health := client.HealthStatus()
+	if health.ActiveStreams != 2 {
+		t.Errorf("ActiveStreams = %d, want 2", health.ActiveStreams)
+	}
+	if health.OldestMessageAge < 2*time.Minute || health.OldestMessageAge > 3*time.Minute {
+		t.Errorf("OldestMessageAge = %v, want ≈ 2m", health.OldestMessageAge)
+	}
+}
+
+// TestCombinedStreamsClient_VerifyResubscribe 测试重新订阅后超时未收到数据时强制重连，收到数据时不重连
+func TestCombinedStreamsClient_VerifyResubscribe(t *testing.T) {
+	streams := []string{"btcusdt@kline_3m", "ethusdt@kline_4h"}
+
+	for _, resumed := range []bool{false, true} {
+		client := NewCombinedStreamsClient(10, StreamConfig{})
+		client.resubscribeTimeout = 20 * time.Millisecond
+		for _, stream := range streams {
+			client.AddSubscriber(stream, 10)
+		}
+
+		stalled := false
+		client.onResubscribeStalledFunc = func([]string) { stalled = true }
+
+		since := time.Now()
+		if resumed {
+			client.handleCombinedMessage([]byte(`{"stream":"ethusdt@kline_4h","data":{}}`))
+		}
+		client.verifyResubscribe(streams, since)
+
+		if stalled == resumed {
+			t.Errorf("resumed=%v: 强制重连 = %v, want %v", resumed, stalled, !resumed)
+		}
+	}
+}
+
+// TestNewCombinedStreamsClient_StreamConfig 测试组合流地址和代理配置：自定义地址和代理生效，未配置或配置无效时使用默认值
+func TestNewCombinedStreamsClient_StreamConfig(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://fstream.binance.com/stream", nil)
+
+	client := NewCombinedStreamsClient(10, StreamConfig{
+		URL:      "wss://stream.binancefuture.com/stream",
+		ProxyURL: "http://proxy.internal:8080",
+	})
+	if client.endpoint != "wss://stream.binancefuture.com/stream" {
+		t.Errorf("endpoint = %s, 应使用自定义地址", client.endpoint)
+	}
+	proxy, err := client.dialer.Proxy(req)
+	if err != nil || proxy == nil || proxy.String() != "http://proxy.internal:8080" {
+		t.Errorf("proxy = %v (err=%v), 应使用配置的代理", proxy, err)
+	}
+
+	for _, cfg := range []StreamConfig{{}, {URL: "https://fstream.binance.com/stream"}, {ProxyURL: "proxy.internal"}} {
+		client := NewCombinedStreamsClient(10, cfg)
+		if client.endpoint != DefaultCombinedStreamURL {
+			t.Errorf("%+v: endpoint = %s, want %s", cfg, client.endpoint, DefaultCombinedStreamURL)
+		}
+		if client.dialer.Proxy == nil {
+			t.Errorf("%+v: 未配置代理时应按环境变量设置代理", cfg)
+		}
+	}
+
+	// Connect 实际拨号到配置的地址
+	upgrader := websocket.Upgrader{}
+	connected := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		connected <- struct{}{}
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	client = NewCombinedStreamsClient(10, StreamConfig{URL: "ws" + strings.TrimPrefix(server.URL, "http") + "/stream"})
+	client.reconnect = false
+	if err := client.Connect(); err != nil {
+		t.Fatalf("连接自定义地址失败: %v", err)
+	}
+	defer client.Close()
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		t.Error("应连接到自定义地址")
+	}
+}
+
+// TestStreamConfig_Validate 测试组合流配置校验
+func TestStreamConfig_Validate(t *testing.T) {
+	tests := []struct {
+		cfg     StreamConfig
+		wantErr bool
+	}{
+		{cfg: StreamConfig{}},
+		{cfg: StreamConfig{URL: "wss://fstream.binance.com/stream", ProxyURL: "socks5://127.0.0.1:1080"}},
+		{cfg: StreamConfig{URL: "ws://localhost:9000/stream"}},
+		{cfg: StreamConfig{URL: "https://fstream.binance.com/stream"}, wantErr: true},
+		{cfg: StreamConfig{URL: "wss:///stream"}, wantErr: true},
+		{cfg: StreamConfig{ProxyURL: "proxy.internal:8080"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%+v: err = %v, wantErr %v", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
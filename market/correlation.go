@@ -0,0 +1,166 @@
+package market
+
+import (
+	"math"
+	"sort"
+)
+
+// correlationLookback 计算相关性使用的4小时K线数量（约8天）
+const correlationLookback = 50
+
+// Exposure 带方向的持仓敞口
+type Exposure struct {
+	Symbol   string
+	Notional float64 // 名义价值（USDT）：多仓为正，空仓为负
+}
+
+// CorrelationSummary 持仓相关性摘要
+type CorrelationSummary struct {
+	MaxCorrelation     float64   // 持仓两两之间考虑方向后的最大相关系数（多空相反的持仓按对冲计，取相反数）
+	MaxPair            [2]string // 最大相关系数对应的两个币种
+	EffectivePositions float64   // 等效独立持仓数 (Σ|w|)² / wᵀρw，取值 [1, N]
+	CorrelatedExposure float64   // 相关性调整后的总敞口 √(wᵀρw)（USDT）
+}
+
+// ReturnCorrelation 计算两组收盘价序列的收益率皮尔逊相关系数（按末尾对齐）
+// 收益率少于2个或任一序列没有波动时返回 false
+func ReturnCorrelation(a, b []float64) (float64, bool) {
+	n := min(len(a), len(b))
+	ra := returns(a[len(a)-n:])
+	rb := returns(b[len(b)-n:])
+	if len(ra) < 2 || len(ra) != len(rb) {
+		return 0, false
+	}
+
+	meanA, meanB := mean(ra), mean(rb)
+	var cov, varA, varB float64
+	for i := range ra {
+		da, db := ra[i]-meanA, rb[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(varA*varB), true
+}
+
+// CorrelationMatrix 计算各币种两两之间的收益率相关系数（symbol -> symbol -> ρ，对角线为 1）
+// 数据不足无法计算的币种对不出现在结果中
+func CorrelationMatrix(closes map[string][]float64) map[string]map[string]float64 {
+	symbols := make([]string, 0, len(closes))
+	for symbol := range closes {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	matrix := make(map[string]map[string]float64, len(symbols))
+	for _, symbol := range symbols {
+		matrix[symbol] = map[string]float64{symbol: 1}
+	}
+	for i, a := range symbols {
+		for _, b := range symbols[i+1:] {
+			if corr, ok := ReturnCorrelation(closes[a], closes[b]); ok {
+				matrix[a][b] = corr
+				matrix[b][a] = corr
+			}
+		}
+	}
+	return matrix
+}
+
+// GetCorrelationMatrix 基于最近的4小时K线计算币种间的相关系数矩阵（获取K线失败的币种跳过）
+func GetCorrelationMatrix(symbols []string) map[string]map[string]float64 {
+	closes := make(map[string][]float64, len(symbols))
+	if WSMonitorCli == nil {
+		return CorrelationMatrix(closes)
+	}
+
+	for _, symbol := range symbols {
+		symbol = Normalize(symbol)
+		klines, err := WSMonitorCli.GetCurrentKlines(symbol, "4h")
+		if err != nil || len(klines) == 0 {
+			continue
+		}
+		if len(klines) > correlationLookback {
+			klines = klines[len(klines)-correlationLookback:]
+		}
+		series := make([]float64, len(klines))
+		for i, k := range klines {
+			series[i] = k.Close
+		}
+		closes[symbol] = series
+	}
+	return CorrelationMatrix(closes)
+}
+
+// SummarizeCorrelation 根据相关系数矩阵汇总持仓的集中度（矩阵中缺失的币种对按不相关处理）
+func SummarizeCorrelation(matrix map[string]map[string]float64, exposures []Exposure) CorrelationSummary {
+	var summary CorrelationSummary
+	if len(exposures) == 0 {
+		return summary
+	}
+
+	first := true
+	grossNotional, variance := 0.0, 0.0
+	for i, a := range exposures {
+		grossNotional += math.Abs(a.Notional)
+		for j, b := range exposures {
+			corr := 0.0
+			if i == j {
+				corr = 1
+			} else if c, ok := matrix[a.Symbol][b.Symbol]; ok {
+				corr = c
+			}
+			variance += a.Notional * b.Notional * corr
+
+			if j <= i {
+				continue
+			}
+			directional := corr
+			if (a.Notional < 0) != (b.Notional < 0) {
+				directional = -corr
+			}
+			if first || directional > summary.MaxCorrelation {
+				summary.MaxCorrelation = directional
+				summary.MaxPair = [2]string{a.Symbol, b.Symbol}
+				first = false
+			}
+		}
+	}
+
+	variance = math.Max(variance, 0)
+	summary.CorrelatedExposure = math.Sqrt(variance)
+
+	// 完全对冲时 wᵀρw 为 0，等效持仓数取上限 N
+	n := float64(len(exposures))
+	summary.EffectivePositions = n
+	if variance > 0 {
+		summary.EffectivePositions = math.Min(math.Max(grossNotional*grossNotional/variance, 1), n)
+	}
+	return summary
+}
+
+// returns 收盘价序列的简单收益率
+func returns(closes []float64) []float64 {
+	if len(closes) < 2 {
+		return nil
+	}
+	result := make([]float64, 0, len(closes)-1)
+	for i := 1; i < len(closes); i++ {
+		if closes[i-1] == 0 {
+			return nil
+		}
+		result = append(result, closes[i]/closes[i-1]-1)
+	}
+	return result
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
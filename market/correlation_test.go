@@ -0,0 +1,135 @@
+package market
+
+import (
+	"math"
+	"testing"
+)
+
+// TestReturnCorrelation 测试收益率相关系数：同步、反向、数据不足与无波动
+func TestReturnCorrelation(t *testing.T) {
+	base := []float64{100, 102, 101, 105, 103, 108}
+	doubled := []float64{50, 52, 51, 55, 53, 58} // 收益率与 base 不完全相同
+	mirror := make([]float64, len(base))
+	for i, p := range base {
+		mirror[i] = 10000 / p // 收益率方向与 base 相反
+	}
+
+	tests := []struct {
+		name   string
+		a, b   []float64
+		want   float64
+		wantOK bool
+		approx bool // 只校验符号和量级
+	}{
+		{name: "同一序列", a: base, b: base, want: 1, wantOK: true},
+		{name: "等比缩放", a: base, b: []float64{200, 204, 202, 210, 206, 216}, want: 1, wantOK: true},
+		{name: "走势相近", a: base, b: doubled, want: 0.99, wantOK: true, approx: true},
+		{name: "走势相反", a: base, b: mirror, want: -0.99, wantOK: true, approx: true},
+		{name: "按末尾对齐", a: append([]float64{1, 1000}, base...), b: base, want: 1, wantOK: true},
+		{name: "数据不足", a: []float64{100, 101}, b: []float64{100, 102}, wantOK: false},
+		{name: "无波动", a: base, b: []float64{1, 1, 1, 1, 1, 1}, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ReturnCorrelation(tt.a, tt.b)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if tt.approx {
+				if math.Abs(got-tt.want) > 0.05 {
+					t.Errorf("correlation = %.4f, want ≈ %.2f", got, tt.want)
+				}
+				return
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("correlation = %.6f, want %.6f", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCorrelationMatrix 测试相关系数矩阵对称、对角线为1、数据不足的币种对缺省
+func TestCorrelationMatrix(t *testing.T) {
+	matrix := CorrelationMatrix(map[string][]float64{
+		"BTCUSDT": {100, 102, 101, 105, 103, 108},
+		"ETHUSDT": {10, 10.2, 10.1, 10.5, 10.3, 10.8},
+		"NEWUSDT": {1, 1.1},
+	})
+
+	if matrix["BTCUSDT"]["BTCUSDT"] != 1 || matrix["NEWUSDT"]["NEWUSDT"] != 1 {
+		t.Error("对角线应为 1")
+	}
+	if math.Abs(matrix["BTCUSDT"]["ETHUSDT"]-1) > 1e-9 || matrix["BTCUSDT"]["ETHUSDT"] != matrix["ETHUSDT"]["BTCUSDT"] {
+		t.Errorf("BTC/ETH 应完全相关且对称: %v / %v", matrix["BTCUSDT"]["ETHUSDT"], matrix["ETHUSDT"]["BTCUSDT"])
+	}
+	if _, ok := matrix["BTCUSDT"]["NEWUSDT"]; ok {
+		t.Error("数据不足的币种对不应出现在矩阵中")
+	}
+}
+
+// TestSummarizeCorrelation 测试等效独立持仓数、方向调整后的最大相关和相关性调整敞口
+func TestSummarizeCorrelation(t *testing.T) {
+	matrix := map[string]map[string]float64{
+		"BTCUSDT": {"BTCUSDT": 1, "ETHUSDT": 0.9, "SOLUSDT": 0.8},
+		"ETHUSDT": {"ETHUSDT": 1, "BTCUSDT": 0.9, "SOLUSDT": 0.85},
+		"SOLUSDT": {"SOLUSDT": 1, "BTCUSDT": 0.8, "ETHUSDT": 0.85},
+	}
+
+	tests := []struct {
+		name          string
+		exposures     []Exposure
+		wantMax       float64
+		wantPair      [2]string
+		wantEffective float64
+		wantExposure  float64
+	}{
+		{
+			name:          "单个持仓",
+			exposures:     []Exposure{{"BTCUSDT", 1000}},
+			wantEffective: 1,
+			wantExposure:  1000,
+		},
+		{
+			name:      "同向高相关：接近一笔押注",
+			exposures: []Exposure{{"BTCUSDT", 1000}, {"ETHUSDT", 1000}, {"SOLUSDT", 1000}},
+			wantMax:   0.9, wantPair: [2]string{"BTCUSDT", "ETHUSDT"},
+			// wᵀρw = 1000² × (3 + 2×(0.9+0.8+0.85)) = 1000² × 8.1
+			wantEffective: 9 / 8.1,
+			wantExposure:  1000 * math.Sqrt(8.1),
+		},
+		{
+			name:      "多空对冲",
+			exposures: []Exposure{{"BTCUSDT", 1000}, {"ETHUSDT", -1000}},
+			wantMax:   -0.9, wantPair: [2]string{"BTCUSDT", "ETHUSDT"},
+			// wᵀρw = 1000² × (2 - 2×0.9) = 1000² × 0.2，等效持仓数封顶为 2
+			wantEffective: 2,
+			wantExposure:  1000 * math.Sqrt(0.2),
+		},
+		{
+			name:      "缺失的币种对按不相关处理",
+			exposures: []Exposure{{"BTCUSDT", 1000}, {"DOGEUSDT", 1000}},
+			wantMax:   0, wantPair: [2]string{"BTCUSDT", "DOGEUSDT"},
+			wantEffective: 2,
+			wantExposure:  1000 * math.Sqrt(2),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SummarizeCorrelation(matrix, tt.exposures)
+			if math.Abs(got.MaxCorrelation-tt.wantMax) > 1e-9 || got.MaxPair != tt.wantPair {
+				t.Errorf("max = %v %v, want %v %v", got.MaxCorrelation, got.MaxPair, tt.wantMax, tt.wantPair)
+			}
+			if math.Abs(got.EffectivePositions-tt.wantEffective) > 1e-9 {
+				t.Errorf("effective = %v, want %v", got.EffectivePositions, tt.wantEffective)
+			}
+			if math.Abs(got.CorrelatedExposure-tt.wantExposure) > 1e-6 {
+				t.Errorf("exposure = %v, want %v", got.CorrelatedExposure, tt.wantExposure)
+			}
+		})
+	}
+}
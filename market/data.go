@@ -15,39 +15,57 @@ import (
 // FundingRateCache 资金费率缓存结构
 // Binance Funding Rate 每 8 小时才更新一次，使用 1 小时缓存可显著减少 API 调用
 type FundingRateCache struct {
-	Rate      float64
+	Rate            float64
+	NextFundingTime int64 // 毫秒时间戳
+	UpdatedAt       time.Time
+}
+
+// OICache 持仓量缓存结构
+// OI 变化相对价格较慢，短 TTL 缓存即可避免每个周期对每个币种都请求一次
+type OICache struct {
+	Data      *OIData
 	UpdatedAt time.Time
 }
 
 var (
 	fundingRateMap sync.Map // map[string]*FundingRateCache
 	frCacheTTL     = 1 * time.Hour
+
+	oiCacheMap sync.Map // map[string]*OICache
+	oiCacheTTL = 5 * time.Minute
 )
 
 // Get 获取指定代币的市场数据
 func Get(symbol string) (*Data, error) {
-	var klines3m, klines4h []Kline
-	var err error
 	// 标准化symbol
 	symbol = Normalize(symbol)
-	// 获取3分钟K线数据 (最近10个)
-	klines3m, err = WSMonitorCli.GetCurrentKlines(symbol, "3m") // 多获取一些用于计算
+	// 获取3分钟和4小时K线（WebSocket 缓存优先，失败时重试并回退到 REST 接口）
+	klines3m, klines4h, err := fetchKlines(symbol)
 	if err != nil {
-		return nil, fmt.Errorf("获取3分钟K线失败: %v", err)
+		return nil, err
 	}
 
-	// Data staleness detection: Prevent DOGEUSDT-style price freeze issues
-	if isStaleData(klines3m, symbol) {
-		log.Printf("⚠️  WARNING: %s detected stale data (consecutive price freeze), skipping symbol", symbol)
-		return nil, fmt.Errorf("%s data is stale, possible cache failure", symbol)
+	data, err := BuildData(symbol, klines3m, klines4h)
+	if err != nil {
+		return nil, err
 	}
 
-	// 获取4小时K线数据 (最近10个)
-	klines4h, err = WSMonitorCli.GetCurrentKlines(symbol, "4h") // 多获取用于计算指标
+	// 获取OI数据
+	oiData, err := getOpenInterestData(symbol)
 	if err != nil {
-		return nil, fmt.Errorf("获取4小时K线失败: %v", err)
+		// OI失败不影响整体,使用默认值
+		oiData = &OIData{Latest: 0, Average: 0}
 	}
+	data.OpenInterest = oiData
+
+	// 获取Funding Rate（失败时保持为 0，不影响整体）
+	data.FundingRate, data.NextFundingTime, _ = getFundingRate(symbol)
 
+	return data, nil
+}
+
+// BuildData 仅根据给定的K线计算市场数据（不含OI和资金费率），回测时可传入历史K线窗口
+func BuildData(symbol string, klines3m, klines4h []Kline) (*Data, error) {
 	// 检查数据是否为空
 	if len(klines3m) == 0 {
 		return nil, fmt.Errorf("3分钟K线数据为空")
@@ -81,16 +99,6 @@ func Get(symbol string) (*Data, error) {
 		}
 	}
 
-	// 获取OI数据
-	oiData, err := getOpenInterestData(symbol)
-	if err != nil {
-		// OI失败不影响整体,使用默认值
-		oiData = &OIData{Latest: 0, Average: 0}
-	}
-
-	// 获取Funding Rate
-	fundingRate, _ := getFundingRate(symbol)
-
 	// 计算日内系列数据
 	intradayData := calculateIntradaySeries(klines3m)
 
@@ -105,10 +113,9 @@ func Get(symbol string) (*Data, error) {
 		CurrentEMA20:      currentEMA20,
 		CurrentMACD:       currentMACD,
 		CurrentRSI7:       currentRSI7,
-		OpenInterest:      oiData,
-		FundingRate:       fundingRate,
 		IntradaySeries:    intradayData,
 		LongerTermContext: longerTermData,
+		Technical:         calculateTechnicalContext(klines3m, klines4h),
 	}, nil
 }
 
@@ -322,8 +329,15 @@ func calculateLongerTermData(klines []Kline) *LongerTermData {
 	return data
 }
 
-// getOpenInterestData 获取OI数据
+// getOpenInterestData 获取OI数据（使用短 TTL 缓存）
 func getOpenInterestData(symbol string) (*OIData, error) {
+	if cached, ok := oiCacheMap.Load(symbol); ok {
+		cache := cached.(*OICache)
+		if time.Since(cache.UpdatedAt) < oiCacheTTL {
+			return cache.Data, nil
+		}
+	}
+
 	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/openInterest?symbol=%s", symbol)
 
 	apiClient := NewAPIClient()
@@ -350,21 +364,30 @@ func getOpenInterestData(symbol string) (*OIData, error) {
 
 	oi, _ := strconv.ParseFloat(result.OpenInterest, 64)
 
-	return &OIData{
+	oiData := &OIData{
 		Latest:  oi,
 		Average: oi * 0.999, // 近似平均值
-	}, nil
+	}
+
+	oiCacheMap.Store(symbol, &OICache{
+		Data:      oiData,
+		UpdatedAt: time.Now(),
+	})
+
+	return oiData, nil
 }
 
-// getFundingRate 获取资金费率（优化：使用 1 小时缓存）
-func getFundingRate(symbol string) (float64, error) {
+// getFundingRate 获取资金费率及下次结算时间（优化：使用 1 小时缓存）
+func getFundingRate(symbol string) (float64, int64, error) {
 	// 检查缓存（有效期 1 小时）
 	// Funding Rate 每 8 小时才更新，1 小时缓存非常合理
+	// 已经过了结算时间的缓存直接作废，避免返回过期的下次结算时间
 	if cached, ok := fundingRateMap.Load(symbol); ok {
 		cache := cached.(*FundingRateCache)
-		if time.Since(cache.UpdatedAt) < frCacheTTL {
+		if time.Since(cache.UpdatedAt) < frCacheTTL &&
+			(cache.NextFundingTime == 0 || time.Now().UnixMilli() < cache.NextFundingTime) {
 			// 缓存命中，直接返回
-			return cache.Rate, nil
+			return cache.Rate, cache.NextFundingTime, nil
 		}
 	}
 
@@ -374,13 +397,13 @@ func getFundingRate(symbol string) (float64, error) {
 	apiClient := NewAPIClient()
 	resp, err := apiClient.client.Get(url)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	var result struct {
@@ -394,18 +417,19 @@ func getFundingRate(symbol string) (float64, error) {
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	rate, _ := strconv.ParseFloat(result.LastFundingRate, 64)
 
 	// 更新缓存
 	fundingRateMap.Store(symbol, &FundingRateCache{
-		Rate:      rate,
-		UpdatedAt: time.Now(),
+		Rate:            rate,
+		NextFundingTime: result.NextFundingTime,
+		UpdatedAt:       time.Now(),
 	})
 
-	return rate, nil
+	return rate, result.NextFundingTime, nil
 }
 
 // Format 格式化输出市场数据
@@ -420,15 +444,32 @@ func Format(data *Data) string {
 	sb.WriteString(fmt.Sprintf("In addition, here is the latest %s open interest and funding rate for perps:\n\n",
 		data.Symbol))
 
-	if data.OpenInterest != nil {
+	// OI / 资金费率为 0 表示数据源未提供，明确标注 N/A 避免 AI 误判为真实的 0
+	if data.OpenInterest != nil && data.OpenInterest.Latest > 0 {
 		// 使用动态精度格式化 OI 数据
 		oiLatestStr := formatPriceWithDynamicPrecision(data.OpenInterest.Latest)
 		oiAverageStr := formatPriceWithDynamicPrecision(data.OpenInterest.Average)
 		sb.WriteString(fmt.Sprintf("Open Interest: Latest: %s Average: %s\n\n",
 			oiLatestStr, oiAverageStr))
+	} else {
+		sb.WriteString("Open Interest: N/A\n\n")
+	}
+
+	if data.FundingRate != 0 || data.NextFundingTime > 0 {
+		sb.WriteString(fmt.Sprintf("Funding Rate: %.2e\n\n", data.FundingRate))
+	} else {
+		sb.WriteString("Funding Rate: N/A\n\n")
 	}
 
-	sb.WriteString(fmt.Sprintf("Funding Rate: %.2e\n\n", data.FundingRate))
+	if data.NextFundingTime > 0 {
+		nextFunding := time.UnixMilli(data.NextFundingTime).UTC()
+		minutesLeft := int(time.Until(nextFunding).Minutes())
+		if minutesLeft < 0 {
+			minutesLeft = 0
+		}
+		sb.WriteString(fmt.Sprintf("Next Funding Time: %s UTC (in %d min)\n\n",
+			nextFunding.Format("2006-01-02 15:04"), minutesLeft))
+	}
 
 	if data.IntradaySeries != nil {
 		sb.WriteString("Intraday series (3‑minute intervals, oldest → latest):\n\n")
@@ -481,9 +522,35 @@ func Format(data *Data) string {
 		}
 	}
 
+	if data.Technical != nil {
+		sb.WriteString("Multi‑timeframe confirmation (trend = price vs. EMA20/EMA50 alignment):\n\n")
+		sb.WriteString(formatTimeframeIndicators("3m", data.Technical.Timeframe3m))
+		sb.WriteString(formatTimeframeIndicators("4h", data.Technical.Timeframe4h))
+		if data.Technical.TrendAligned {
+			sb.WriteString(fmt.Sprintf("Trend alignment: aligned (%s)\n\n", data.Technical.Timeframe4h.Trend))
+		} else {
+			sb.WriteString("Trend alignment: mixed\n\n")
+		}
+	}
+
 	return sb.String()
 }
 
+// formatTimeframeIndicators 格式化单一周期指标（K线不足时 EMA/ATR 为 0，输出 N/A）
+func formatTimeframeIndicators(timeframe string, tf *TimeframeIndicators) string {
+	if tf == nil {
+		return ""
+	}
+	value := func(v float64) string {
+		if v == 0 {
+			return "N/A"
+		}
+		return fmt.Sprintf("%.3f", v)
+	}
+	return fmt.Sprintf("%s: EMA20 = %s, EMA50 = %s, RSI14 = %.3f, ATR14 = %s, trend = %s\n\n",
+		timeframe, value(tf.EMA20), value(tf.EMA50), tf.RSI14, value(tf.ATR14), tf.Trend)
+}
+
 // formatPriceWithDynamicPrecision 根据价格区间动态选择精度
 // 这样可以完美支持从超低价 meme coin (< 0.0001) 到 BTC/ETH 的所有币种
 func formatPriceWithDynamicPrecision(price float64) string {
@@ -592,3 +659,8 @@ func isStaleData(klines []Kline, symbol string) bool {
 	log.Printf("⚠️  %s detected extreme price stability (no fluctuation for %d consecutive periods), but volume is normal", symbol, stalePriceThreshold)
 	return false
 }
+
+// GetFundingRate 获取资金费率及下次结算时间（毫秒时间戳，未知时为 0），使用1小时缓存
+func GetFundingRate(symbol string) (float64, int64, error) {
+	return getFundingRate(Normalize(symbol))
+}
@@ -2,7 +2,9 @@ package market
 
 import (
 	"math"
+	"strings"
 	"testing"
+	"time"
 )
 
 // generateTestKlines 生成测试用的 K线数据
@@ -500,3 +502,48 @@ func TestIsStaleData_EmptyKlines(t *testing.T) {
 		t.Error("Expected false for empty klines, got true")
 	}
 }
+
+// TestFormat_FundingAndOpenInterest 测试资金费率与持仓量的格式化输出
+func TestFormat_FundingAndOpenInterest(t *testing.T) {
+	nextFunding := time.Now().Add(90 * time.Minute)
+	data := &Data{
+		Symbol:          "BTCUSDT",
+		CurrentPrice:    50000,
+		OpenInterest:    &OIData{Latest: 12345.6, Average: 12333.2},
+		FundingRate:     0.0001,
+		NextFundingTime: nextFunding.UnixMilli(),
+	}
+
+	output := Format(data)
+
+	if !strings.Contains(output, "Funding Rate: 1.00e-04") {
+		t.Errorf("expected funding rate in output, got: %s", output)
+	}
+	if !strings.Contains(output, "Next Funding Time: "+nextFunding.UTC().Format("2006-01-02 15:04")) {
+		t.Errorf("expected next funding time in output, got: %s", output)
+	}
+	if strings.Contains(output, "Open Interest: N/A") {
+		t.Errorf("open interest should not be N/A, got: %s", output)
+	}
+}
+
+// TestFormat_MissingFundingAndOpenInterest 测试数据源不提供 OI / 资金费率时输出 N/A
+func TestFormat_MissingFundingAndOpenInterest(t *testing.T) {
+	data := &Data{
+		Symbol:       "XYZUSDT",
+		CurrentPrice: 1.23,
+		OpenInterest: &OIData{Latest: 0, Average: 0},
+	}
+
+	output := Format(data)
+
+	if !strings.Contains(output, "Open Interest: N/A") {
+		t.Errorf("expected Open Interest N/A, got: %s", output)
+	}
+	if !strings.Contains(output, "Funding Rate: N/A") {
+		t.Errorf("expected Funding Rate N/A, got: %s", output)
+	}
+	if strings.Contains(output, "Next Funding Time") {
+		t.Errorf("next funding time should be omitted when zero, got: %s", output)
+	}
+}
@@ -0,0 +1,187 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// depthLevels 拉取的盘口档位数（币安 limit=100 权重为5）
+	depthLevels = 100
+	// depthCacheTTL 盘口失衡缓存有效期，同一周期内多处使用只请求一次
+	depthCacheTTL = 15 * time.Second
+	// spreadDepthLevels 计算点差时拉取的盘口档位数（只需要最优买卖价，limit=5 权重为2）
+	spreadDepthLevels = 5
+)
+
+// DepthBandPct 计算盘口失衡时统计的价格带（中间价上下百分比），可通过配置修改
+var DepthBandPct = 0.5
+
+// DepthLevel 盘口一档
+type DepthLevel struct {
+	Price    float64
+	Quantity float64
+}
+
+// OrderBook 盘口快照（买盘价格从高到低，卖盘价格从低到高）
+type OrderBook struct {
+	Bids []DepthLevel
+	Asks []DepthLevel
+}
+
+// DepthImbalance 价格带内的买卖盘力量对比
+type DepthImbalance struct {
+	BidNotional float64 // 价格带内买单名义价值（USDT）
+	AskNotional float64 // 价格带内卖单名义价值（USDT）
+	Ratio       float64 // 买卖比 BidNotional / AskNotional，>1 买盘更强
+	BandPct     float64 // 统计的价格带（中间价上下百分比）
+}
+
+// ComputeDepthImbalance 统计中间价上下 bandPct% 以内的买卖盘名义价值及买卖比
+// 盘口为空或价格带内没有卖单时返回 false
+func ComputeDepthImbalance(book OrderBook, bandPct float64) (DepthImbalance, bool) {
+	if len(book.Bids) == 0 || len(book.Asks) == 0 || bandPct <= 0 {
+		return DepthImbalance{}, false
+	}
+
+	mid := (book.Bids[0].Price + book.Asks[0].Price) / 2
+	lower := mid * (1 - bandPct/100)
+	upper := mid * (1 + bandPct/100)
+
+	result := DepthImbalance{BandPct: bandPct}
+	for _, level := range book.Bids {
+		if level.Price < lower {
+			break
+		}
+		result.BidNotional += level.Price * level.Quantity
+	}
+	for _, level := range book.Asks {
+		if level.Price > upper {
+			break
+		}
+		result.AskNotional += level.Price * level.Quantity
+	}
+	if result.AskNotional == 0 {
+		return DepthImbalance{}, false
+	}
+	result.Ratio = result.BidNotional / result.AskNotional
+	return result, true
+}
+
+// SpreadBps 最优买卖价差相对中间价的比例（基点，1bp=0.01%），盘口为空或价格异常时返回 false
+func SpreadBps(book OrderBook) (float64, bool) {
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return 0, false
+	}
+	bid, ask := book.Bids[0].Price, book.Asks[0].Price
+	if bid <= 0 || ask < bid {
+		return 0, false
+	}
+	mid := (bid + ask) / 2
+	return (ask - bid) / mid * 10000, true
+}
+
+// GetOrderBook 获取币安合约盘口前几档（实时请求，不缓存），用于下单前检查点差
+func GetOrderBook(symbol string) (*OrderBook, error) {
+	book, err := NewAPIClient().GetDepth(Normalize(symbol), spreadDepthLevels)
+	if err != nil {
+		return nil, fmt.Errorf("获取%s盘口失败: %w", symbol, err)
+	}
+	return book, nil
+}
+
+// depthResponse 币安 /fapi/v1/depth 响应
+type depthResponse struct {
+	Bids [][2]string `json:"bids"`
+	Asks [][2]string `json:"asks"`
+}
+
+// GetDepth 获取合约盘口（前 limit 档）
+func (c *APIClient) GetDepth(symbol string, limit int) (*OrderBook, error) {
+	url := fmt.Sprintf("%s/fapi/v1/depth", baseURL)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	q.Add("symbol", symbol)
+	q.Add("limit", strconv.Itoa(limit))
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var depth depthResponse
+	if err := json.Unmarshal(body, &depth); err != nil {
+		return nil, err
+	}
+	return &OrderBook{Bids: parseDepthLevels(depth.Bids), Asks: parseDepthLevels(depth.Asks)}, nil
+}
+
+func parseDepthLevels(raw [][2]string) []DepthLevel {
+	levels := make([]DepthLevel, 0, len(raw))
+	for _, r := range raw {
+		price, err1 := strconv.ParseFloat(r[0], 64)
+		quantity, err2 := strconv.ParseFloat(r[1], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		levels = append(levels, DepthLevel{Price: price, Quantity: quantity})
+	}
+	return levels
+}
+
+type cachedDepthImbalance struct {
+	imbalance DepthImbalance
+	fetchedAt time.Time
+}
+
+var (
+	depthCache   = map[string]cachedDepthImbalance{}
+	depthCacheMu sync.Mutex
+)
+
+// GetDepthImbalance 获取币安合约盘口在 DepthBandPct 价格带内的买卖比（缓存 depthCacheTTL）
+func GetDepthImbalance(symbol string) (*DepthImbalance, error) {
+	symbol = Normalize(symbol)
+	bandPct := DepthBandPct
+
+	depthCacheMu.Lock()
+	cached, ok := depthCache[symbol]
+	depthCacheMu.Unlock()
+	if ok && cached.imbalance.BandPct == bandPct && time.Since(cached.fetchedAt) < depthCacheTTL {
+		imbalance := cached.imbalance
+		return &imbalance, nil
+	}
+
+	book, err := NewAPIClient().GetDepth(symbol, depthLevels)
+	if err != nil {
+		return nil, fmt.Errorf("获取%s盘口失败: %w", symbol, err)
+	}
+	imbalance, ok := ComputeDepthImbalance(*book, bandPct)
+	if !ok {
+		return nil, fmt.Errorf("%s 盘口数据不足，无法计算买卖比", symbol)
+	}
+
+	depthCacheMu.Lock()
+	depthCache[symbol] = cachedDepthImbalance{imbalance: imbalance, fetchedAt: time.Now()}
+	depthCacheMu.Unlock()
+	return &imbalance, nil
+}
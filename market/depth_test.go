@@ -0,0 +1,67 @@
+package market
+
+import (
+	"math"
+	"testing"
+)
+
+// TestComputeDepthImbalance 测试只统计价格带内的档位，以及盘口为空/带内无卖单时不返回结果
+func TestComputeDepthImbalance(t *testing.T) {
+	// 中间价 100，0.5% 价格带为 [99.5, 100.5]
+	book := OrderBook{
+		Bids: []DepthLevel{{99.9, 10}, {99.6, 20}, {99.4, 1000}},
+		Asks: []DepthLevel{{100.1, 5}, {100.4, 5}, {100.6, 1000}},
+	}
+
+	got, ok := ComputeDepthImbalance(book, 0.5)
+	if !ok {
+		t.Fatal("应能计算买卖比")
+	}
+	wantBid := 99.9*10 + 99.6*20
+	wantAsk := 100.1*5 + 100.4*5
+	if math.Abs(got.BidNotional-wantBid) > 1e-9 || math.Abs(got.AskNotional-wantAsk) > 1e-9 {
+		t.Errorf("bid/ask = %.4f/%.4f, want %.4f/%.4f", got.BidNotional, got.AskNotional, wantBid, wantAsk)
+	}
+	if math.Abs(got.Ratio-wantBid/wantAsk) > 1e-9 {
+		t.Errorf("ratio = %.4f, want %.4f", got.Ratio, wantBid/wantAsk)
+	}
+
+	// 放宽价格带后包含外侧大单
+	wide, _ := ComputeDepthImbalance(book, 1)
+	if wide.BidNotional <= got.BidNotional || wide.AskNotional <= got.AskNotional {
+		t.Errorf("1%% 价格带应包含更多档位: %+v", wide)
+	}
+
+	if _, ok := ComputeDepthImbalance(OrderBook{Bids: book.Bids}, 0.5); ok {
+		t.Error("没有卖盘时不应返回结果")
+	}
+	if _, ok := ComputeDepthImbalance(OrderBook{Bids: book.Bids, Asks: []DepthLevel{{100, 0}}}, 0.5); ok {
+		t.Error("价格带内卖单为0时不应返回结果")
+	}
+}
+
+// TestSpreadBps 测试最优买卖价差（基点）以及盘口为空/价格倒挂时不返回结果
+func TestSpreadBps(t *testing.T) {
+	tests := []struct {
+		name   string
+		book   OrderBook
+		want   float64
+		wantOK bool
+	}{
+		{name: "窄点差", book: OrderBook{Bids: []DepthLevel{{99.99, 1}}, Asks: []DepthLevel{{100.01, 1}}}, want: 2, wantOK: true},
+		{name: "宽点差", book: OrderBook{Bids: []DepthLevel{{99, 1}}, Asks: []DepthLevel{{101, 1}}}, want: 200, wantOK: true},
+		{name: "无卖盘", book: OrderBook{Bids: []DepthLevel{{99, 1}}}, wantOK: false},
+		{name: "价格倒挂", book: OrderBook{Bids: []DepthLevel{{101, 1}}, Asks: []DepthLevel{{99, 1}}}, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SpreadBps(tt.book)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("spread = %.6f bps, want %.6f", got, tt.want)
+			}
+		})
+	}
+}
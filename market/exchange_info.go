@@ -0,0 +1,203 @@
+package market
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SymbolFilters 交易对下单规则（来自 exchangeInfo 的 PRICE_FILTER / LOT_SIZE / MIN_NOTIONAL）
+type SymbolFilters struct {
+	TickSize    float64 // 价格步进值
+	StepSize    float64 // 数量步进值
+	MinNotional float64 // 最小名义价值（USDT）
+}
+
+// ExchangeInfoStore 带 TTL 的 exchangeInfo 缓存，多个交易员共享，避免重复请求触发限频
+type ExchangeInfoStore struct {
+	fetch func() (*ExchangeInfo, error)
+	ttl   time.Duration
+
+	mu          sync.RWMutex
+	symbols     []SymbolInfo
+	filters     map[string]SymbolFilters
+	updatedAt   time.Time
+	lastForced  time.Time // 上次因未知币种强制刷新的时间
+	refreshOnce sync.Once
+}
+
+var (
+	// ExchangeInfoTTL exchangeInfo 缓存有效期（交易规则很少变化），同时也是后台刷新间隔
+	ExchangeInfoTTL = 4 * time.Hour
+
+	// forcedRefreshInterval 未知币种触发强制刷新的最小间隔，避免无效币种反复拉取
+	forcedRefreshInterval = 1 * time.Minute
+
+	exchangeInfoStores   = map[string]*ExchangeInfoStore{}
+	exchangeInfoStoresMu sync.Mutex
+)
+
+// NewExchangeInfoStore 创建 exchangeInfo 缓存（fetch 为实际拉取函数，便于测试注入）
+func NewExchangeInfoStore(fetch func() (*ExchangeInfo, error), ttl time.Duration) *ExchangeInfoStore {
+	return &ExchangeInfoStore{
+		fetch: fetch,
+		ttl:   ttl,
+	}
+}
+
+// GetExchangeInfoStore 获取指定交易所的共享缓存（目前仅支持 binance），首次获取时启动后台刷新
+func GetExchangeInfoStore(exchange string) (*ExchangeInfoStore, error) {
+	exchangeInfoStoresMu.Lock()
+	defer exchangeInfoStoresMu.Unlock()
+
+	if store, ok := exchangeInfoStores[exchange]; ok {
+		return store, nil
+	}
+
+	var fetch func() (*ExchangeInfo, error)
+	switch exchange {
+	case "binance":
+		fetch = func() (*ExchangeInfo, error) {
+			return NewAPIClient().GetExchangeInfo()
+		}
+	default:
+		return nil, fmt.Errorf("不支持的交易所: %s", exchange)
+	}
+
+	store := NewExchangeInfoStore(fetch, ExchangeInfoTTL)
+	store.startAutoRefresh()
+	exchangeInfoStores[exchange] = store
+	return store, nil
+}
+
+// GetSymbolFilters 获取币安交易对的下单规则（共享缓存）
+func GetSymbolFilters(symbol string) (SymbolFilters, error) {
+	store, err := GetExchangeInfoStore("binance")
+	if err != nil {
+		return SymbolFilters{}, err
+	}
+	return store.GetSymbolFilters(symbol)
+}
+
+// GetSymbolFilters 获取交易对的下单规则，缓存过期时刷新；未知币种会强制刷新一次（可能是新上线币种）
+func (s *ExchangeInfoStore) GetSymbolFilters(symbol string) (SymbolFilters, error) {
+	if err := s.ensureFresh(); err != nil {
+		return SymbolFilters{}, err
+	}
+
+	if filters, ok := s.lookup(symbol); ok {
+		return filters, nil
+	}
+
+	s.mu.Lock()
+	canForce := time.Since(s.lastForced) >= forcedRefreshInterval
+	if canForce {
+		s.lastForced = time.Now()
+	}
+	s.mu.Unlock()
+
+	if canForce {
+		log.Printf("🔄 未找到 %s 的交易规则，强制刷新 exchangeInfo", symbol)
+		if err := s.Refresh(); err != nil {
+			return SymbolFilters{}, err
+		}
+		if filters, ok := s.lookup(symbol); ok {
+			return filters, nil
+		}
+	}
+
+	return SymbolFilters{}, fmt.Errorf("未找到交易对 %s 的交易规则", symbol)
+}
+
+// Symbols 获取全部交易对信息
+func (s *ExchangeInfoStore) Symbols() ([]SymbolInfo, error) {
+	if err := s.ensureFresh(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	symbols := make([]SymbolInfo, len(s.symbols))
+	copy(symbols, s.symbols)
+	return symbols, nil
+}
+
+// Refresh 立即重新拉取 exchangeInfo
+func (s *ExchangeInfoStore) Refresh() error {
+	info, err := s.fetch()
+	if err != nil {
+		return fmt.Errorf("获取交易规则失败: %w", err)
+	}
+
+	filters := make(map[string]SymbolFilters, len(info.Symbols))
+	for _, symbol := range info.Symbols {
+		filters[symbol.Symbol] = parseSymbolFilters(symbol.Filters)
+	}
+
+	s.mu.Lock()
+	s.symbols = info.Symbols
+	s.filters = filters
+	s.updatedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// ensureFresh 缓存为空或过期时刷新
+func (s *ExchangeInfoStore) ensureFresh() error {
+	s.mu.RLock()
+	fresh := s.filters != nil && time.Since(s.updatedAt) < s.ttl
+	s.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+	return s.Refresh()
+}
+
+func (s *ExchangeInfoStore) lookup(symbol string) (SymbolFilters, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	filters, ok := s.filters[symbol]
+	return filters, ok
+}
+
+// startAutoRefresh 后台按 TTL 周期刷新，避免交易时才同步拉取
+func (s *ExchangeInfoStore) startAutoRefresh() {
+	s.refreshOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(s.ttl)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := s.Refresh(); err != nil {
+					log.Printf("⚠️  后台刷新 exchangeInfo 失败: %v", err)
+				}
+			}
+		}()
+	})
+}
+
+// parseSymbolFilters 从 exchangeInfo 的 filters 数组解析下单规则
+func parseSymbolFilters(rawFilters []map[string]interface{}) SymbolFilters {
+	var filters SymbolFilters
+	for _, filter := range rawFilters {
+		switch filter["filterType"] {
+		case "PRICE_FILTER":
+			filters.TickSize = parseFilterFloat(filter["tickSize"])
+		case "LOT_SIZE":
+			filters.StepSize = parseFilterFloat(filter["stepSize"])
+		case "MIN_NOTIONAL":
+			filters.MinNotional = parseFilterFloat(filter["notional"])
+		}
+	}
+	return filters
+}
+
+func parseFilterFloat(v interface{}) float64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
@@ -0,0 +1,86 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+// countingFetch 返回固定 exchangeInfo 的拉取函数，并统计调用次数
+func countingFetch(count *int, symbols ...string) func() (*ExchangeInfo, error) {
+	return func() (*ExchangeInfo, error) {
+		*count++
+		info := &ExchangeInfo{}
+		for _, symbol := range symbols {
+			info.Symbols = append(info.Symbols, SymbolInfo{
+				Symbol: symbol,
+				Filters: []map[string]interface{}{
+					{"filterType": "PRICE_FILTER", "tickSize": "0.10"},
+					{"filterType": "LOT_SIZE", "stepSize": "0.001"},
+					{"filterType": "MIN_NOTIONAL", "notional": "100"},
+				},
+			})
+		}
+		return info, nil
+	}
+}
+
+func TestExchangeInfoStore_CachesWithinTTL(t *testing.T) {
+	fetchCount := 0
+	store := NewExchangeInfoStore(countingFetch(&fetchCount, "BTCUSDT", "ETHUSDT"), time.Hour)
+
+	filters, err := store.GetSymbolFilters("BTCUSDT")
+	if err != nil {
+		t.Fatalf("GetSymbolFilters 失败: %v", err)
+	}
+	want := SymbolFilters{TickSize: 0.1, StepSize: 0.001, MinNotional: 100}
+	if filters != want {
+		t.Errorf("filters = %+v, want %+v", filters, want)
+	}
+
+	if _, err := store.GetSymbolFilters("ETHUSDT"); err != nil {
+		t.Fatalf("GetSymbolFilters 失败: %v", err)
+	}
+	if _, err := store.Symbols(); err != nil {
+		t.Fatalf("Symbols 失败: %v", err)
+	}
+	if fetchCount != 1 {
+		t.Errorf("TTL 内重复查询不应再次拉取, fetchCount = %d", fetchCount)
+	}
+}
+
+func TestExchangeInfoStore_RefetchAfterTTL(t *testing.T) {
+	fetchCount := 0
+	store := NewExchangeInfoStore(countingFetch(&fetchCount, "BTCUSDT"), time.Hour)
+
+	if _, err := store.GetSymbolFilters("BTCUSDT"); err != nil {
+		t.Fatalf("GetSymbolFilters 失败: %v", err)
+	}
+	store.updatedAt = time.Now().Add(-2 * time.Hour)
+
+	if _, err := store.GetSymbolFilters("BTCUSDT"); err != nil {
+		t.Fatalf("GetSymbolFilters 失败: %v", err)
+	}
+	if fetchCount != 2 {
+		t.Errorf("缓存过期后应重新拉取, fetchCount = %d", fetchCount)
+	}
+}
+
+func TestExchangeInfoStore_UnknownSymbolForcesRefresh(t *testing.T) {
+	fetchCount := 0
+	store := NewExchangeInfoStore(countingFetch(&fetchCount, "BTCUSDT"), time.Hour)
+
+	if _, err := store.GetSymbolFilters("NEWUSDT"); err == nil {
+		t.Fatal("未知币种应返回错误")
+	}
+	if fetchCount != 2 {
+		t.Errorf("未知币种应强制刷新一次, fetchCount = %d", fetchCount)
+	}
+
+	// 强制刷新有最小间隔，短时间内再次查询未知币种不再拉取
+	if _, err := store.GetSymbolFilters("NEWUSDT"); err == nil {
+		t.Fatal("未知币种应返回错误")
+	}
+	if fetchCount != 2 {
+		t.Errorf("强制刷新间隔内不应重复拉取, fetchCount = %d", fetchCount)
+	}
+}
@@ -0,0 +1,51 @@
+package market
+
+// 趋势方向
+const (
+	TrendBullish = "bullish"
+	TrendBearish = "bearish"
+	TrendNeutral = "neutral"
+)
+
+// calculateTechnicalContext 基于3分钟和4小时K线计算多周期指标
+func calculateTechnicalContext(klines3m, klines4h []Kline) *TechnicalContext {
+	tf3m := calculateTimeframeIndicators(klines3m)
+	tf4h := calculateTimeframeIndicators(klines4h)
+
+	return &TechnicalContext{
+		Timeframe3m:  tf3m,
+		Timeframe4h:  tf4h,
+		TrendAligned: tf3m.Trend != TrendNeutral && tf3m.Trend == tf4h.Trend,
+	}
+}
+
+// calculateTimeframeIndicators 计算单一周期的 EMA20/50、RSI14、ATR14 和趋势方向
+func calculateTimeframeIndicators(klines []Kline) *TimeframeIndicators {
+	indicators := &TimeframeIndicators{
+		EMA20: calculateEMA(klines, 20),
+		EMA50: calculateEMA(klines, 50),
+		RSI14: calculateRSI(klines, 14),
+		ATR14: calculateATR(klines, 14),
+		Trend: TrendNeutral,
+	}
+
+	if len(klines) > 0 {
+		indicators.Trend = classifyTrend(klines[len(klines)-1].Close, indicators.EMA20, indicators.EMA50)
+	}
+	return indicators
+}
+
+// classifyTrend 根据价格与均线排列判断趋势：价格 > EMA20 > EMA50 为多头，反之为空头，其余为震荡
+func classifyTrend(price, ema20, ema50 float64) string {
+	if ema20 == 0 || ema50 == 0 {
+		return TrendNeutral // K线不足，无法判断
+	}
+	switch {
+	case price > ema20 && ema20 > ema50:
+		return TrendBullish
+	case price < ema20 && ema20 < ema50:
+		return TrendBearish
+	default:
+		return TrendNeutral
+	}
+}
@@ -0,0 +1,108 @@
+package market
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// rampKlines 生成收盘价逐根变化 step 的K线，最高/最低价为收盘价 ±1
+func rampKlines(count int, start, step float64) []Kline {
+	klines := make([]Kline, count)
+	for i := range klines {
+		close := start + float64(i)*step
+		klines[i] = Kline{
+			Open:  close - step,
+			High:  close + 1,
+			Low:   close - 1,
+			Close: close,
+		}
+	}
+	return klines
+}
+
+func TestCalculateTimeframeIndicators(t *testing.T) {
+	tests := []struct {
+		name   string
+		klines []Kline
+		want   TimeframeIndicators
+	}{
+		{
+			// 线性上涨时 EMA 恒定滞后 (period-1)/2 个步长
+			name:   "线性上涨",
+			klines: rampKlines(60, 100, 1),
+			want:   TimeframeIndicators{EMA20: 159 - 9.5, EMA50: 159 - 24.5, RSI14: 100, ATR14: 2, Trend: TrendBullish},
+		},
+		{
+			name:   "线性下跌",
+			klines: rampKlines(60, 200, -1),
+			want:   TimeframeIndicators{EMA20: 141 + 9.5, EMA50: 141 + 24.5, RSI14: 0, ATR14: 2, Trend: TrendBearish},
+		},
+		{
+			// 不足50根时 EMA50 为 0，无法判断趋势
+			name:   "K线不足",
+			klines: rampKlines(30, 100, 1),
+			want:   TimeframeIndicators{EMA20: 129 - 9.5, EMA50: 0, RSI14: 100, ATR14: 2, Trend: TrendNeutral},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateTimeframeIndicators(tt.klines)
+			for _, c := range []struct {
+				field     string
+				got, want float64
+			}{
+				{"EMA20", got.EMA20, tt.want.EMA20},
+				{"EMA50", got.EMA50, tt.want.EMA50},
+				{"RSI14", got.RSI14, tt.want.RSI14},
+				{"ATR14", got.ATR14, tt.want.ATR14},
+			} {
+				if math.Abs(c.got-c.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+				}
+			}
+			if got.Trend != tt.want.Trend {
+				t.Errorf("Trend = %s, want %s", got.Trend, tt.want.Trend)
+			}
+		})
+	}
+}
+
+func TestClassifyTrend(t *testing.T) {
+	tests := []struct {
+		price, ema20, ema50 float64
+		want                string
+	}{
+		{110, 105, 100, TrendBullish},
+		{90, 95, 100, TrendBearish},
+		{102, 105, 100, TrendNeutral}, // 价格跌破EMA20
+		{110, 100, 105, TrendNeutral}, // 均线空头排列但价格在上方
+		{110, 105, 0, TrendNeutral},   // 数据不足
+	}
+
+	for _, tt := range tests {
+		if got := classifyTrend(tt.price, tt.ema20, tt.ema50); got != tt.want {
+			t.Errorf("classifyTrend(%v, %v, %v) = %s, want %s", tt.price, tt.ema20, tt.ema50, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateTechnicalContext_TrendAlignment(t *testing.T) {
+	up := rampKlines(60, 100, 1)
+	down := rampKlines(60, 200, -1)
+
+	if tc := calculateTechnicalContext(up, up); !tc.TrendAligned {
+		t.Error("3m 与 4h 同为多头时应判定为趋势一致")
+	}
+	if tc := calculateTechnicalContext(up, down); tc.TrendAligned {
+		t.Error("3m 多头、4h 空头时不应判定为趋势一致")
+	}
+
+	output := Format(&Data{Symbol: "BTCUSDT", Technical: calculateTechnicalContext(up, up)})
+	for _, want := range []string{"3m: EMA20 = 149.500", "4h: EMA20 = 149.500", "Trend alignment: aligned (bullish)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Format 输出缺少 %q:\n%s", want, output)
+		}
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"nofx/clock"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,13 +18,18 @@ type WSMonitor struct {
 	symbols        []string
 	featuresMap    sync.Map
 	alertsChan     chan Alert
-	klineDataMap3m sync.Map // 存储每个交易对的K线历史数据
-	klineDataMap4h sync.Map // 存储每个交易对的K线历史数据
+	klineData      sync.Map // 各周期的K线缓存（interval -> *sync.Map，内层为 symbol -> *KlineCacheEntry）
+	intervals      []string // 订阅的K线周期，为空时使用 DefaultKlineIntervals
 	tickerDataMap  sync.Map // 存储每个交易对的ticker数据
 	batchSize      int
-	filterSymbols  sync.Map // 使用sync.Map来存储需要监控的币种和其状态
-	symbolStats    sync.Map // 存储币种统计信息
-	FilterSymbol   []string //经过筛选的币种
+	filterSymbols  sync.Map       // 使用sync.Map来存储需要监控的币种和其状态
+	symbolStats    sync.Map       // 存储币种统计信息
+	FilterSymbol   []string       //经过筛选的币种
+	lastKlineAt    atomic.Int64   // 最近一次收到 WebSocket K线推送的时间（UnixMilli，用于健康检查）
+	klineHistory   map[string]int // 各周期保留的K线数量（interval -> 根数），未配置的周期使用 DefaultKlineHistory
+	clock          clock.Clock    // 时间源（K线接收时间与新鲜度检查，nil 使用系统时间）
+	lastAccess     sync.Map       // 各币种最近一次被订阅或读取K线的时间（symbol -> time.Time），用于清理长期无人使用的订阅
+	sweepStop      chan struct{}  // 关闭时停止空闲订阅清理
 }
 type SymbolStats struct {
 	LastActiveTime   time.Time
@@ -39,31 +47,124 @@ type KlineCacheEntry struct {
 }
 
 var WSMonitorCli *WSMonitor
-var subKlineTime = []string{"3m", "4h"} // 管理订阅流的K线周期
 
-func NewWSMonitor(batchSize int) *WSMonitor {
+// DefaultKlineIntervals 默认订阅的K线周期（market.Get 依赖 3m 和 4h）
+var DefaultKlineIntervals = []string{"3m", "4h"}
+
+// binanceKlineIntervals 币安合约K线接口支持的周期
+var binanceKlineIntervals = map[string]bool{
+	"1m": true, "3m": true, "5m": true, "15m": true, "30m": true,
+	"1h": true, "2h": true, "4h": true, "6h": true, "8h": true, "12h": true,
+	"1d": true, "3d": true, "1w": true, "1M": true,
+}
+
+// KlineMaxAge K线缓存的最大有效期，超过则视为 WebSocket 数据过期
+// 使用 15 分钟阈值：对于 3m 和 4h K线都适用
+// - 3m K线：15分钟 = 5个周期，足以检测 WebSocket 停止
+// - 4h K线：虽然新 K线 4小时才生成，但当前 K线 是实时更新的
+const KlineMaxAge = 15 * time.Minute
+
+// DefaultKlineHistory 每个周期默认保留的K线数量
+const DefaultKlineHistory = 100
+
+// maxKlineHistory 币安K线接口单次请求的最大数量
+const maxKlineHistory = 1500
+
+// SymbolIdleTTL 币种超过该时长未被读取K线时，由定期清理取消订阅并释放缓存（再次读取时重新拉取并订阅）
+var SymbolIdleTTL = 2 * time.Hour
+
+// idleSweepInterval 空闲订阅清理的检查间隔
+const idleSweepInterval = 10 * time.Minute
+
+// warmupPollInterval WaitForWarmup 检查缓存就绪状态的间隔
+var warmupPollInterval = 500 * time.Millisecond
+
+// NewWSMonitor 创建行情监控器，intervals 为订阅的K线周期（为空时使用 DefaultKlineIntervals），
+// 不合法的周期会被忽略，3m 和 4h 始终订阅；stream 为组合流地址和代理配置（为空时使用默认值）
+func NewWSMonitor(batchSize int, intervals []string, stream StreamConfig) *WSMonitor {
+	resolved, invalid := ResolveKlineIntervals(intervals)
+	if len(invalid) > 0 {
+		log.Printf("⚠️ 忽略不支持的K线周期: %v（支持: 1m 3m 5m 15m 30m 1h 2h 4h 6h 8h 12h 1d 3d 1w 1M）", invalid)
+	}
 	WSMonitorCli = &WSMonitor{
 		wsClient:       NewWSClient(),
-		combinedClient: NewCombinedStreamsClient(batchSize),
+		combinedClient: NewCombinedStreamsClient(batchSize, stream),
 		alertsChan:     make(chan Alert, 1000),
 		batchSize:      batchSize,
+		intervals:      resolved,
+		clock:          clock.Real,
+		sweepStop:      make(chan struct{}),
 	}
 	return WSMonitorCli
 }
 
+// ValidKlineInterval 是否为币安支持的K线周期
+func ValidKlineInterval(interval string) bool {
+	return binanceKlineIntervals[interval]
+}
+
+// ResolveKlineIntervals 在默认周期基础上追加配置的周期（去重、保持顺序），返回被忽略的不合法周期
+func ResolveKlineIntervals(intervals []string) (resolved []string, invalid []string) {
+	seen := make(map[string]bool)
+	for _, interval := range append(append([]string{}, DefaultKlineIntervals...), intervals...) {
+		interval = strings.TrimSpace(interval)
+		if !ValidKlineInterval(interval) {
+			invalid = append(invalid, interval)
+			continue
+		}
+		if !seen[interval] {
+			seen[interval] = true
+			resolved = append(resolved, interval)
+		}
+	}
+	return resolved, invalid
+}
+
+// klineIntervals 订阅的K线周期
+func (m *WSMonitor) klineIntervals() []string {
+	if len(m.intervals) == 0 {
+		return DefaultKlineIntervals
+	}
+	return m.intervals
+}
+
+// SetKlineHistory 设置指定周期保留的K线数量（如 4h 计算 EMA200 需要 200 根以上），
+// 初始API拉取和WebSocket滑动窗口均按此长度，须在 Start 之前调用
+func (m *WSMonitor) SetKlineHistory(interval string, bars int) {
+	if bars <= 0 {
+		return
+	}
+	if bars > maxKlineHistory {
+		log.Printf("⚠️ %s K线保留数量 %d 超过接口上限，使用 %d", interval, bars, maxKlineHistory)
+		bars = maxKlineHistory
+	}
+	if m.klineHistory == nil {
+		m.klineHistory = make(map[string]int)
+	}
+	m.klineHistory[interval] = bars
+}
+
+// klineHistoryLimit 指定周期保留的K线数量
+func (m *WSMonitor) klineHistoryLimit(interval string) int {
+	if bars, ok := m.klineHistory[interval]; ok {
+		return bars
+	}
+	return DefaultKlineHistory
+}
+
 func (m *WSMonitor) Initialize(coins []string) error {
 	log.Println("初始化WebSocket监控器...")
-	// 获取交易对信息
-	apiClient := NewAPIClient()
-	// 如果不指定交易对，则使用market市场的所有交易对币种
+	// 如果不指定交易对，则使用market市场的所有交易对币种（交易对信息来自共享缓存）
 	if len(coins) == 0 {
-		exchangeInfo, err := apiClient.GetExchangeInfo()
+		store, err := GetExchangeInfoStore("binance")
 		if err != nil {
 			return err
 		}
-		// 筛选永续合约交易对 --仅测试时使用
-		//exchangeInfo.Symbols = exchangeInfo.Symbols[0:2]
-		for _, symbol := range exchangeInfo.Symbols {
+		symbols, err := store.Symbols()
+		if err != nil {
+			return err
+		}
+		for _, symbol := range symbols {
 			if symbol.Status == "TRADING" && symbol.ContractType == "PERPETUAL" && strings.ToUpper(symbol.Symbol[len(symbol.Symbol)-4:]) == "USDT" {
 				m.symbols = append(m.symbols, symbol.Symbol)
 				m.filterSymbols.Store(symbol.Symbol, true)
@@ -96,33 +197,21 @@ func (m *WSMonitor) initializeHistoricalData() error {
 			defer wg.Done()
 			defer func() { <-semaphore }()
 
-			// 获取历史K线数据
-			klines, err := apiClient.GetKlines(s, "3m", 100)
-			if err != nil {
-				log.Printf("获取 %s 历史数据失败: %v", s, err)
-				return
-			}
-			if len(klines) > 0 {
-				entry := &KlineCacheEntry{
-					Klines:     klines,
-					ReceivedAt: time.Now(),
+			for _, st := range m.klineIntervals() {
+				// 获取历史K线数据
+				klines, err := apiClient.GetKlines(s, st, m.klineHistoryLimit(st))
+				if err != nil {
+					log.Printf("获取 %s %s 历史数据失败: %v", s, st, err)
+					continue
 				}
-				m.klineDataMap3m.Store(s, entry)
-				log.Printf("已加载 %s 的历史K线数据-3m: %d 条", s, len(klines))
-			}
-			// 获取历史K线数据
-			klines4h, err := apiClient.GetKlines(s, "4h", 100)
-			if err != nil {
-				log.Printf("获取 %s 历史数据失败: %v", s, err)
-				return
-			}
-			if len(klines4h) > 0 {
-				entry4h := &KlineCacheEntry{
-					Klines:     klines4h,
-					ReceivedAt: time.Now(),
+				if len(klines) > 0 {
+					entry := &KlineCacheEntry{
+						Klines:     klines,
+						ReceivedAt: clock.Or(m.clock).Now(),
+					}
+					m.getKlineDataMap(st).Store(s, entry)
+					log.Printf("已加载 %s 的历史K线数据-%s: %d 条", s, st, len(klines))
 				}
-				m.klineDataMap4h.Store(s, entry4h)
-				log.Printf("已加载 %s 的历史K线数据-4h: %d 条", s, len(klines4h))
 			}
 		}(symbol)
 	}
@@ -151,27 +240,112 @@ func (m *WSMonitor) Start(coins []string) {
 		log.Printf("❌ 订阅币种交易对失败: %v", err)
 		return
 	}
+	go m.runIdleSweep(m.sweepStop)
+}
+
+// klineStream K线组合流名称
+func klineStream(symbol, interval string) string {
+	return fmt.Sprintf("%s@kline_%s", strings.ToLower(symbol), interval)
 }
 
 // subscribeSymbol 注册监听
 func (m *WSMonitor) subscribeSymbol(symbol, st string) []string {
 	var streams []string
-	stream := fmt.Sprintf("%s@kline_%s", strings.ToLower(symbol), st)
+	stream := klineStream(symbol, st)
 	ch := m.combinedClient.AddSubscriber(stream, 100)
 	streams = append(streams, stream)
 	go m.handleKlineData(symbol, ch, st)
+	m.touchSymbol(symbol)
 
 	return streams
 }
+
+// touchSymbol 记录币种最近一次被使用的时间
+func (m *WSMonitor) touchSymbol(symbol string) {
+	m.lastAccess.Store(strings.ToUpper(symbol), clock.Or(m.clock).Now())
+}
+
+// Unsubscribe 取消币种指定周期的K线订阅：关闭订阅通道（处理该流的goroutine随之退出）并删除该周期的K线缓存，
+// 该币种所有周期都已取消时一并清除特征、ticker和统计信息
+func (m *WSMonitor) Unsubscribe(symbol, interval string) {
+	symbol = strings.ToUpper(symbol)
+	stream := klineStream(symbol, interval)
+	if m.combinedClient.RemoveSubscriber(stream) {
+		if err := m.combinedClient.unsubscribeStreams([]string{stream}); err != nil {
+			log.Printf("⚠️ 取消订阅 %s 失败: %v", stream, err)
+		}
+	}
+	m.getKlineDataMap(interval).Delete(symbol)
+
+	if m.hasCachedKlines(symbol) {
+		return
+	}
+	m.featuresMap.Delete(symbol)
+	m.tickerDataMap.Delete(symbol)
+	m.symbolStats.Delete(symbol)
+	m.lastAccess.Delete(symbol)
+}
+
+// hasCachedKlines 币种是否还有任一周期的K线缓存
+func (m *WSMonitor) hasCachedKlines(symbol string) bool {
+	cached := false
+	m.klineData.Range(func(_, value any) bool {
+		_, cached = value.(*sync.Map).Load(symbol)
+		return !cached
+	})
+	return cached
+}
+
+// runIdleSweep 定期清理长期未被读取的币种订阅，直到 stop 关闭
+func (m *WSMonitor) runIdleSweep(stop <-chan struct{}) {
+	ticker := clock.Or(m.clock).NewTicker(idleSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			if removed := m.sweepIdleSymbols(); len(removed) > 0 {
+				log.Printf("🧹 已取消 %d 个超过 %v 未使用的币种订阅: %v", len(removed), SymbolIdleTTL, removed)
+			}
+		}
+	}
+}
+
+// sweepIdleSymbols 取消超过 SymbolIdleTTL 未被读取的币种在所有周期上的订阅，返回被清理的币种
+func (m *WSMonitor) sweepIdleSymbols() []string {
+	now := clock.Or(m.clock).Now()
+	var idle []string
+	m.lastAccess.Range(func(key, value any) bool {
+		if now.Sub(value.(time.Time)) > SymbolIdleTTL {
+			idle = append(idle, key.(string))
+		}
+		return true
+	})
+	sort.Strings(idle)
+
+	var intervals []string
+	m.klineData.Range(func(key, _ any) bool {
+		intervals = append(intervals, key.(string))
+		return true
+	})
+	for _, symbol := range idle {
+		for _, interval := range intervals {
+			m.Unsubscribe(symbol, interval)
+		}
+		m.lastAccess.Delete(symbol)
+	}
+	return idle
+}
 func (m *WSMonitor) subscribeAll() error {
 	// 执行批量订阅
 	log.Println("开始订阅所有交易对...")
 	for _, symbol := range m.symbols {
-		for _, st := range subKlineTime {
+		for _, st := range m.klineIntervals() {
 			m.subscribeSymbol(symbol, st)
 		}
 	}
-	for _, st := range subKlineTime {
+	for _, st := range m.klineIntervals() {
 		err := m.combinedClient.BatchSubscribeKlines(m.symbols, st)
 		if err != nil {
 			log.Printf("❌ 订阅 %s K线失败: %v", st, err)
@@ -193,16 +367,13 @@ func (m *WSMonitor) handleKlineData(symbol string, ch <-chan []byte, _time strin
 	}
 }
 
+// getKlineDataMap 指定周期的K线缓存（symbol -> *KlineCacheEntry），不存在时创建
 func (m *WSMonitor) getKlineDataMap(_time string) *sync.Map {
-	var klineDataMap *sync.Map
-	if _time == "3m" {
-		klineDataMap = &m.klineDataMap3m
-	} else if _time == "4h" {
-		klineDataMap = &m.klineDataMap4h
-	} else {
-		klineDataMap = &sync.Map{}
+	if value, ok := m.klineData.Load(_time); ok {
+		return value.(*sync.Map)
 	}
-	return klineDataMap
+	value, _ := m.klineData.LoadOrStore(_time, &sync.Map{})
+	return value.(*sync.Map)
 }
 func (m *WSMonitor) processKlineUpdate(symbol string, wsData KlineWSData, _time string) {
 	// 转换WebSocket数据为Kline结构
@@ -238,8 +409,8 @@ func (m *WSMonitor) processKlineUpdate(symbol string, wsData KlineWSData, _time
 			klines = append(klines, kline)
 
 			// 保持数据长度
-			if len(klines) > 100 {
-				klines = klines[1:]
+			if limit := m.klineHistoryLimit(_time); len(klines) > limit {
+				klines = klines[len(klines)-limit:]
 			}
 		}
 	} else {
@@ -247,20 +418,77 @@ func (m *WSMonitor) processKlineUpdate(symbol string, wsData KlineWSData, _time
 	}
 
 	// 存储时加上接收时间戳
+	now := clock.Or(m.clock).Now()
 	entry := &KlineCacheEntry{
 		Klines:     klines,
-		ReceivedAt: time.Now(),
+		ReceivedAt: now,
 	}
 	klineDataMap.Store(symbol, entry)
+	m.lastKlineAt.Store(now.UnixMilli())
+}
+
+// LastKlineAge 距最近一次收到 WebSocket K线推送的时长（从未收到时 ok=false）
+func (m *WSMonitor) LastKlineAge() (age time.Duration, ok bool) {
+	last := m.lastKlineAt.Load()
+	if last == 0 {
+		return 0, false
+	}
+	return clock.Or(m.clock).Since(time.UnixMilli(last)), true
+}
+
+// StreamHealth 组合流订阅数量和最久未收到消息的时长
+func (m *WSMonitor) StreamHealth() StreamHealth {
+	return m.combinedClient.HealthStatus()
+}
+
+// WaitForWarmup 等待指定币种所有订阅周期的K线缓存就绪（存在且未过期），最多等待 timeout
+// 超时后打印仍未就绪的币种并返回；其中已过期的缓存会被清除，使 GetCurrentKlines 走 API 兜底而不是直接报错
+func (m *WSMonitor) WaitForWarmup(symbols []string, timeout time.Duration) []string {
+	deadline := time.Now().Add(timeout)
+	for {
+		cold := m.coldSymbols(symbols)
+		if len(cold) == 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			log.Printf("⚠️ K线缓存预热超时（%v），%d 个币种未就绪，将使用API兜底: %v", timeout, len(cold), cold)
+			for _, symbol := range cold {
+				for _, st := range m.klineIntervals() {
+					if value, ok := m.getKlineDataMap(st).Load(symbol); ok && clock.Or(m.clock).Since(value.(*KlineCacheEntry).ReceivedAt) > KlineMaxAge {
+						m.getKlineDataMap(st).Delete(symbol)
+					}
+				}
+			}
+			return cold
+		}
+		time.Sleep(warmupPollInterval)
+	}
+}
+
+// coldSymbols 返回任一订阅周期K线缓存缺失/过期的币种
+func (m *WSMonitor) coldSymbols(symbols []string) []string {
+	var cold []string
+	for _, symbol := range symbols {
+		symbol = Normalize(symbol)
+		for _, st := range m.klineIntervals() {
+			value, ok := m.getKlineDataMap(st).Load(symbol)
+			if !ok || clock.Or(m.clock).Since(value.(*KlineCacheEntry).ReceivedAt) > KlineMaxAge {
+				cold = append(cold, symbol)
+				break
+			}
+		}
+	}
+	return cold
 }
 
 func (m *WSMonitor) GetCurrentKlines(symbol string, duration string) ([]Kline, error) {
+	m.touchSymbol(symbol)
 	// 对每一个进来的symbol检测是否存在内类 是否的话就订阅它
 	value, exists := m.getKlineDataMap(duration).Load(symbol)
 	if !exists {
 		// 如果Ws数据未初始化完成时,单独使用api获取 - 兼容性代码 (防止在未初始化完成是,已经有交易员运行)
 		apiClient := NewAPIClient()
-		klines, err := apiClient.GetKlines(symbol, duration, 100)
+		klines, err := apiClient.GetKlines(symbol, duration, m.klineHistoryLimit(duration))
 		if err != nil {
 			return nil, fmt.Errorf("获取%v分钟K线失败: %v", duration, err)
 		}
@@ -268,7 +496,7 @@ func (m *WSMonitor) GetCurrentKlines(symbol string, duration string) ([]Kline, e
 		// 动态缓存进缓存（使用 KlineCacheEntry 包装，加上时间戳）
 		entry := &KlineCacheEntry{
 			Klines:     klines,
-			ReceivedAt: time.Now(),
+			ReceivedAt: clock.Or(m.clock).Now(),
 		}
 		m.getKlineDataMap(duration).Store(strings.ToUpper(symbol), entry)
 
@@ -289,14 +517,10 @@ func (m *WSMonitor) GetCurrentKlines(symbol string, duration string) ([]Kline, e
 	// 从缓存读取数据
 	entry := value.(*KlineCacheEntry)
 
-	// ✅ 检查数据新鲜度（防止使用过期数据）
-	// 使用 15 分钟阈值：对于 3m 和 4h K线都适用
-	// - 3m K线：15分钟 = 5个周期，足以检测 WebSocket 停止
-	// - 4h K线：虽然新 K线 4小时才生成，但当前 K线 是实时更新的
-	dataAge := time.Since(entry.ReceivedAt)
-	maxAge := 15 * time.Minute
+	// ✅ 检查数据新鲜度（防止使用过期数据，阈值见 KlineMaxAge）
+	dataAge := clock.Or(m.clock).Since(entry.ReceivedAt)
 
-	if dataAge > maxAge {
+	if dataAge > KlineMaxAge {
 		// 数据过期，返回错误（不 fallback API，避免增加负担）
 		// 这表明 WebSocket 可能未正常工作，需要修复根本原因
 		return nil, fmt.Errorf("%s 的 %s K线数据已过期 (%.1f 分钟)，WebSocket 可能未正常工作",
@@ -311,6 +535,9 @@ func (m *WSMonitor) GetCurrentKlines(symbol string, duration string) ([]Kline, e
 }
 
 func (m *WSMonitor) Close() {
+	if m.sweepStop != nil {
+		close(m.sweepStop)
+	}
 	m.wsClient.Close()
 	close(m.alertsChan)
 }
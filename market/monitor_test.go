@@ -0,0 +1,219 @@
+package market
+
+import (
+	"nofx/clock"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestWaitForWarmup 测试K线缓存预热等待：数据到齐后立即返回，超时返回未就绪币种并清除过期缓存
+func TestWaitForWarmup(t *testing.T) {
+	oldInterval := warmupPollInterval
+	warmupPollInterval = 5 * time.Millisecond
+	defer func() { warmupPollInterval = oldInterval }()
+
+	fresh := func() *KlineCacheEntry { return &KlineCacheEntry{Klines: []Kline{{}}, ReceivedAt: time.Now()} }
+	stale := &KlineCacheEntry{Klines: []Kline{{}}, ReceivedAt: time.Now().Add(-KlineMaxAge - time.Minute)}
+
+	t.Run("数据陆续就绪", func(t *testing.T) {
+		m := &WSMonitor{}
+		m.getKlineDataMap("3m").Store("BTCUSDT", fresh())
+		m.getKlineDataMap("4h").Store("BTCUSDT", fresh())
+		m.getKlineDataMap("3m").Store("ETHUSDT", fresh())
+
+		go func() {
+			time.Sleep(30 * time.Millisecond)
+			m.getKlineDataMap("4h").Store("ETHUSDT", fresh())
+		}()
+
+		start := time.Now()
+		cold := m.WaitForWarmup([]string{"BTCUSDT", "eth"}, time.Second)
+		if len(cold) != 0 {
+			t.Errorf("期望全部就绪，实际未就绪: %v", cold)
+		}
+		if elapsed := time.Since(start); elapsed < 30*time.Millisecond || elapsed > 500*time.Millisecond {
+			t.Errorf("等待时长异常: %v", elapsed)
+		}
+	})
+
+	t.Run("超时返回未就绪币种", func(t *testing.T) {
+		m := &WSMonitor{}
+		m.getKlineDataMap("3m").Store("BTCUSDT", fresh())
+		m.getKlineDataMap("4h").Store("BTCUSDT", fresh())
+		m.getKlineDataMap("3m").Store("SOLUSDT", stale)
+		m.getKlineDataMap("4h").Store("SOLUSDT", fresh())
+
+		cold := m.WaitForWarmup([]string{"BTCUSDT", "SOLUSDT", "DOGEUSDT"}, 20*time.Millisecond)
+		if !reflect.DeepEqual(cold, []string{"SOLUSDT", "DOGEUSDT"}) {
+			t.Errorf("未就绪币种不匹配: %v", cold)
+		}
+
+		// 过期缓存被清除（后续走API兜底），新鲜缓存保留
+		if _, ok := m.getKlineDataMap("3m").Load("SOLUSDT"); ok {
+			t.Error("过期的3m缓存应被清除")
+		}
+		if _, ok := m.getKlineDataMap("4h").Load("SOLUSDT"); !ok {
+			t.Error("新鲜的4h缓存不应被清除")
+		}
+	})
+}
+
+// TestProcessKlineUpdate_HistoryDepth 测试滑动窗口按配置的保留数量裁剪（而不是固定100根），未配置的周期仍为默认值
+func TestProcessKlineUpdate_HistoryDepth(t *testing.T) {
+	m := &WSMonitor{}
+	m.SetKlineHistory("4h", 200)
+
+	push := func(interval string, n int) {
+		for i := 0; i < n; i++ {
+			var data KlineWSData
+			data.Kline.StartTime = int64(i) * 1000
+			data.Kline.ClosePrice = "100"
+			data.Kline.Volume = "1"
+			m.processKlineUpdate("BTCUSDT", data, interval)
+		}
+	}
+	push("4h", 250)
+	push("3m", 250)
+
+	value, _ := m.getKlineDataMap("4h").Load("BTCUSDT")
+	klines := value.(*KlineCacheEntry).Klines
+	if len(klines) != 200 {
+		t.Fatalf("4h 应保留 200 根K线, got %d", len(klines))
+	}
+	if klines[0].OpenTime != 50*1000 || klines[len(klines)-1].OpenTime != 249*1000 {
+		t.Errorf("应保留最新的K线: first=%d last=%d", klines[0].OpenTime, klines[len(klines)-1].OpenTime)
+	}
+
+	value, _ = m.getKlineDataMap("3m").Load("BTCUSDT")
+	if got := len(value.(*KlineCacheEntry).Klines); got != DefaultKlineHistory {
+		t.Errorf("3m 未配置应保留默认 %d 根, got %d", DefaultKlineHistory, got)
+	}
+
+	// 更长的历史不影响数据新鲜度检查
+	if cold := m.coldSymbols([]string{"BTCUSDT"}); len(cold) != 0 {
+		t.Errorf("刚更新的缓存不应视为过期: %v", cold)
+	}
+
+	// 超过接口上限时截断，非正数忽略
+	m.SetKlineHistory("4h", 5000)
+	m.SetKlineHistory("3m", 0)
+	if m.klineHistoryLimit("4h") != maxKlineHistory || m.klineHistoryLimit("3m") != DefaultKlineHistory {
+		t.Errorf("保留数量校验错误: 4h=%d 3m=%d", m.klineHistoryLimit("4h"), m.klineHistoryLimit("3m"))
+	}
+}
+
+// TestResolveKlineIntervals 测试K线周期配置：默认周期始终保留、去重、忽略不合法周期
+func TestResolveKlineIntervals(t *testing.T) {
+	resolved, invalid := ResolveKlineIntervals([]string{"1h", "4h", "2m", " 15m", "1h", "1M"})
+	if want := []string{"3m", "4h", "1h", "15m", "1M"}; !reflect.DeepEqual(resolved, want) {
+		t.Errorf("resolved = %v, want %v", resolved, want)
+	}
+	if want := []string{"2m"}; !reflect.DeepEqual(invalid, want) {
+		t.Errorf("invalid = %v, want %v", invalid, want)
+	}
+
+	if resolved, _ := ResolveKlineIntervals(nil); !reflect.DeepEqual(resolved, DefaultKlineIntervals) {
+		t.Errorf("未配置应使用默认周期: %v", resolved)
+	}
+}
+
+// TestKlineDataMap_ExtraInterval 测试额外周期的K线写入独立缓存，并参与预热检查
+func TestKlineDataMap_ExtraInterval(t *testing.T) {
+	m := &WSMonitor{intervals: []string{"3m", "4h", "1h"}}
+
+	var data KlineWSData
+	data.Kline.StartTime = 1000
+	data.Kline.ClosePrice = "100"
+	m.processKlineUpdate("BTCUSDT", data, "1h")
+
+	if _, ok := m.getKlineDataMap("1h").Load("BTCUSDT"); !ok {
+		t.Fatal("1h K线应写入缓存")
+	}
+	if _, ok := m.getKlineDataMap("3m").Load("BTCUSDT"); ok {
+		t.Error("1h K线不应写入 3m 缓存")
+	}
+
+	m.processKlineUpdate("BTCUSDT", data, "3m")
+	if cold := m.coldSymbols([]string{"BTCUSDT"}); !reflect.DeepEqual(cold, []string{"BTCUSDT"}) {
+		t.Errorf("4h 缓存缺失时应视为未就绪: %v", cold)
+	}
+	m.processKlineUpdate("BTCUSDT", data, "4h")
+	if cold := m.coldSymbols([]string{"BTCUSDT"}); len(cold) != 0 {
+		t.Errorf("所有周期就绪后不应有未就绪币种: %v", cold)
+	}
+}
+
+// TestWSMonitor_Unsubscribe 测试取消订阅：关闭订阅通道、删除该周期K线缓存，所有周期都取消后清除统计信息
+func TestWSMonitor_Unsubscribe(t *testing.T) {
+	client := NewCombinedStreamsClient(10, StreamConfig{})
+	m := &WSMonitor{combinedClient: client}
+
+	ch3m := client.AddSubscriber(klineStream("BTCUSDT", "3m"), 1)
+	ch4h := client.AddSubscriber(klineStream("BTCUSDT", "4h"), 1)
+	entry := &KlineCacheEntry{Klines: []Kline{{}}, ReceivedAt: time.Now()}
+	m.getKlineDataMap("3m").Store("BTCUSDT", entry)
+	m.getKlineDataMap("4h").Store("BTCUSDT", entry)
+	m.symbolStats.Store("BTCUSDT", &SymbolStats{AlertCount: 1})
+	m.touchSymbol("BTCUSDT")
+
+	m.Unsubscribe("btcusdt", "3m")
+	if _, open := <-ch3m; open {
+		t.Error("取消订阅后通道应被关闭")
+	}
+	if _, ok := m.getKlineDataMap("3m").Load("BTCUSDT"); ok {
+		t.Error("取消订阅后 3m K线缓存应被删除")
+	}
+	if health := client.HealthStatus(); health.ActiveStreams != 1 {
+		t.Errorf("应只剩 4h 一个订阅流, got %d", health.ActiveStreams)
+	}
+	if _, ok := m.symbolStats.Load("BTCUSDT"); !ok {
+		t.Error("仍有 4h 订阅时不应清除统计信息")
+	}
+
+	// 已移除的流再收到消息不会向已关闭的通道发送
+	client.handleCombinedMessage([]byte(`{"stream":"btcusdt@kline_3m","data":{}}`))
+
+	m.Unsubscribe("BTCUSDT", "4h")
+	if _, open := <-ch4h; open {
+		t.Error("取消订阅后通道应被关闭")
+	}
+	if _, ok := m.symbolStats.Load("BTCUSDT"); ok {
+		t.Error("所有周期都取消后应清除统计信息")
+	}
+	if _, ok := m.lastAccess.Load("BTCUSDT"); ok {
+		t.Error("所有周期都取消后应清除访问时间")
+	}
+}
+
+// TestWSMonitor_SweepIdleSymbols 测试定期清理：只取消超过 SymbolIdleTTL 未被读取的币种
+func TestWSMonitor_SweepIdleSymbols(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	client := NewCombinedStreamsClient(10, StreamConfig{})
+	m := &WSMonitor{combinedClient: client, clock: fake}
+
+	for _, symbol := range []string{"BTCUSDT", "DOGEUSDT"} {
+		client.AddSubscriber(klineStream(symbol, "3m"), 1)
+		m.getKlineDataMap("3m").Store(symbol, &KlineCacheEntry{Klines: []Kline{{}}, ReceivedAt: fake.Now()})
+		m.touchSymbol(symbol)
+	}
+
+	fake.Advance(SymbolIdleTTL / 2)
+	if _, err := m.GetCurrentKlines("BTCUSDT", "3m"); err == nil {
+		t.Error("缓存已过期应返回错误（仍记录访问时间）")
+	}
+	fake.Advance(SymbolIdleTTL/2 + time.Minute)
+
+	if removed := m.sweepIdleSymbols(); !reflect.DeepEqual(removed, []string{"DOGEUSDT"}) {
+		t.Fatalf("应只清理空闲的 DOGEUSDT, got %v", removed)
+	}
+	if _, ok := m.getKlineDataMap("3m").Load("DOGEUSDT"); ok {
+		t.Error("空闲币种的K线缓存应被删除")
+	}
+	if _, ok := m.getKlineDataMap("3m").Load("BTCUSDT"); !ok {
+		t.Error("最近读取过的币种不应被清理")
+	}
+	if health := client.HealthStatus(); health.ActiveStreams != 1 {
+		t.Errorf("应只剩 BTCUSDT 一个订阅流, got %d", health.ActiveStreams)
+	}
+}
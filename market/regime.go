@@ -0,0 +1,138 @@
+package market
+
+import (
+	"fmt"
+	"math"
+)
+
+// Regime 市场状态分类
+type Regime string
+
+const (
+	RegimeTrend   Regime = "trend"    // 趋势行情（ADX 高于阈值）
+	RegimeRange   Regime = "range"    // 震荡行情
+	RegimeHighVol Regime = "high_vol" // 极端波动（ATR 占价格比例超过阈值，优先于趋势/震荡判断）
+)
+
+const (
+	// regimePeriod ADX / ATR 的计算周期
+	regimePeriod = 14
+	// RegimeSymbol 作为整体市场代表的币种
+	RegimeSymbol = "BTCUSDT"
+)
+
+var (
+	// RegimeTrendADX ADX 不低于该值视为趋势行情
+	RegimeTrendADX = 25.0
+	// RegimeHighVolATRPct 4小时ATR占收盘价的百分比不低于该值视为极端波动，可通过配置修改
+	RegimeHighVolATRPct = 3.0
+)
+
+// MarketRegime 市场状态及判断依据
+type MarketRegime struct {
+	Regime Regime  `json:"regime"`
+	ADX    float64 `json:"adx"`
+	ATRPct float64 `json:"atr_pct"` // ATR占最新收盘价的百分比
+}
+
+// ClassifyRegime 根据K线（通常为4小时）判断市场状态：先看 ATR% 是否达到极端波动，再按 ADX 区分趋势与震荡
+// K线不足以计算 ADX（少于 2*regimePeriod+1 根）或价格无效时返回 false
+func ClassifyRegime(klines []Kline) (MarketRegime, bool) {
+	adx, ok := calculateADX(klines, regimePeriod)
+	if !ok {
+		return MarketRegime{}, false
+	}
+	lastClose := klines[len(klines)-1].Close
+	if lastClose <= 0 {
+		return MarketRegime{}, false
+	}
+
+	result := MarketRegime{
+		ADX:    adx,
+		ATRPct: calculateATR(klines, regimePeriod) / lastClose * 100,
+	}
+	switch {
+	case result.ATRPct >= RegimeHighVolATRPct:
+		result.Regime = RegimeHighVol
+	case adx >= RegimeTrendADX:
+		result.Regime = RegimeTrend
+	default:
+		result.Regime = RegimeRange
+	}
+	return result, true
+}
+
+// GetRegime 基于 WebSocket 缓存的4小时K线判断币种的市场状态
+func GetRegime(symbol string) (MarketRegime, error) {
+	symbol = Normalize(symbol)
+	if WSMonitorCli == nil {
+		return MarketRegime{}, fmt.Errorf("WebSocket 监控器未初始化")
+	}
+	klines, err := WSMonitorCli.GetCurrentKlines(symbol, "4h")
+	if err != nil {
+		return MarketRegime{}, fmt.Errorf("获取%s 4小时K线失败: %w", symbol, err)
+	}
+	regime, ok := ClassifyRegime(klines)
+	if !ok {
+		return MarketRegime{}, fmt.Errorf("%s 4小时K线不足（%d根），无法判断市场状态", symbol, len(klines))
+	}
+	return regime, nil
+}
+
+// calculateADX 计算 Wilder ADX（需要至少 2*period+1 根K线）
+func calculateADX(klines []Kline, period int) (float64, bool) {
+	if period <= 0 || len(klines) < 2*period+1 {
+		return 0, false
+	}
+
+	var trSum, plusSum, minusSum float64
+	var dxSum, adx float64
+	for i := 1; i < len(klines); i++ {
+		high, low, prevClose := klines[i].High, klines[i].Low, klines[i-1].Close
+		tr := math.Max(high-low, math.Max(math.Abs(high-prevClose), math.Abs(low-prevClose)))
+
+		upMove := high - klines[i-1].High
+		downMove := klines[i-1].Low - low
+		plusDM, minusDM := 0.0, 0.0
+		if upMove > downMove && upMove > 0 {
+			plusDM = upMove
+		}
+		if downMove > upMove && downMove > 0 {
+			minusDM = downMove
+		}
+
+		// 前 period 根累加，之后按 Wilder 方式平滑
+		if i <= period {
+			trSum += tr
+			plusSum += plusDM
+			minusSum += minusDM
+		} else {
+			trSum = trSum - trSum/float64(period) + tr
+			plusSum = plusSum - plusSum/float64(period) + plusDM
+			minusSum = minusSum - minusSum/float64(period) + minusDM
+		}
+		if i < period {
+			continue
+		}
+
+		dx := 0.0
+		if trSum > 0 {
+			plusDI := 100 * plusSum / trSum
+			minusDI := 100 * minusSum / trSum
+			if plusDI+minusDI > 0 {
+				dx = 100 * math.Abs(plusDI-minusDI) / (plusDI + minusDI)
+			}
+		}
+
+		// 第一个 ADX 为前 period 个 DX 的均值，之后平滑
+		switch n := i - period + 1; {
+		case n < period:
+			dxSum += dx
+		case n == period:
+			adx = (dxSum + dx) / float64(period)
+		default:
+			adx = (adx*float64(period-1) + dx) / float64(period)
+		}
+	}
+	return adx, true
+}
@@ -0,0 +1,77 @@
+package market
+
+import (
+	"math"
+	"testing"
+)
+
+// regimeKlines 按收盘价序列生成K线（开盘价为前一根收盘价），high/low 在开收盘价基础上外扩 spreadPct%
+func regimeKlines(closes []float64, spreadPct float64) []Kline {
+	klines := make([]Kline, len(closes))
+	for i, c := range closes {
+		open := c
+		if i > 0 {
+			open = closes[i-1]
+		}
+		klines[i] = Kline{
+			Open:  open,
+			High:  max(open, c) * (1 + spreadPct/100),
+			Low:   min(open, c) * (1 - spreadPct/100),
+			Close: c,
+		}
+	}
+	return klines
+}
+
+// TestClassifyRegime 测试市场状态分类：单边趋势、来回震荡、极端波动与K线不足
+func TestClassifyRegime(t *testing.T) {
+	const n = 60
+	trending := make([]float64, n)
+	choppy := make([]float64, n)
+	for i := range n {
+		trending[i] = 100 * (1 + 0.005*float64(i))       // 每根上涨约0.5%
+		choppy[i] = 100 + math.Sin(float64(i)*math.Pi/4) // 8根一个来回
+	}
+
+	tests := []struct {
+		name   string
+		klines []Kline
+		want   Regime
+		wantOK bool
+	}{
+		{name: "单边上涨", klines: regimeKlines(trending, 0.1), want: RegimeTrend, wantOK: true},
+		{name: "来回震荡", klines: regimeKlines(choppy, 0.1), want: RegimeRange, wantOK: true},
+		{name: "极端波动", klines: regimeKlines(choppy, 3), want: RegimeHighVol, wantOK: true},
+		{name: "K线不足", klines: regimeKlines(trending[:2*regimePeriod], 0.1), wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ClassifyRegime(tt.klines)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.Regime != tt.want {
+				t.Errorf("regime = %s (ADX %.1f, ATR %.2f%%), want %s", got.Regime, got.ADX, got.ATRPct, tt.want)
+			}
+		})
+	}
+}
+
+// TestCalculateADX_MonotonicTrend 单边行情中 -DM 恒为0，ADX 应为100
+func TestCalculateADX_MonotonicTrend(t *testing.T) {
+	closes := make([]float64, 40)
+	for i := range closes {
+		closes[i] = 100 + float64(i)
+	}
+	adx, ok := calculateADX(regimeKlines(closes, 0), regimePeriod)
+	if !ok {
+		t.Fatal("expected ADX to be computed")
+	}
+	if adx < 99.999 || adx > 100.001 {
+		t.Errorf("ADX = %.4f, want 100", adx)
+	}
+}
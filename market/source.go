@@ -0,0 +1,95 @@
+package market
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrNoMarketData 所有数据源（含重试）都无法提供行情，调用方应跳过该币种而不是中止整个周期
+var ErrNoMarketData = errors.New("无法获取行情数据")
+
+// errStaleData 数据源返回的K线价格长时间冻结（重试同一数据源无意义，直接换下一个数据源）
+var errStaleData = errors.New("data is stale, possible cache failure")
+
+var (
+	// marketDataRetries 每个数据源的尝试次数
+	marketDataRetries = 2
+	// marketDataRetryBackoff 同一数据源重试前的等待时间（按尝试次数递增）
+	marketDataRetryBackoff = 200 * time.Millisecond
+)
+
+// klineSource K线数据源
+type klineSource struct {
+	name  string
+	fetch func(symbol, interval string) ([]Kline, error)
+}
+
+// klineSources 按优先级排列的K线数据源：WebSocket 缓存失败（未初始化、数据过期或冻结）时改用 REST 接口
+var klineSources = []klineSource{
+	{name: "websocket", fetch: wsKlines},
+	{name: "rest", fetch: restKlines},
+}
+
+// wsKlines 从 WebSocket 缓存读取K线（缓存未命中时 GetCurrentKlines 会走一次API并订阅）
+func wsKlines(symbol, interval string) ([]Kline, error) {
+	if WSMonitorCli == nil {
+		return nil, fmt.Errorf("WebSocket 监控器未初始化")
+	}
+	return WSMonitorCli.GetCurrentKlines(symbol, interval)
+}
+
+// restKlines 直接请求币安K线接口（不写入缓存）
+func restKlines(symbol, interval string) ([]Kline, error) {
+	limit := DefaultKlineHistory
+	if WSMonitorCli != nil {
+		limit = WSMonitorCli.klineHistoryLimit(interval)
+	}
+	return NewAPIClient().GetKlines(symbol, interval, limit)
+}
+
+// fetchKlines 依次尝试各数据源获取 3m 和 4h K线，单个数据源失败时短暂退避重试
+// 所有数据源都失败时返回包装了 ErrNoMarketData 的错误
+func fetchKlines(symbol string) (klines3m, klines4h []Kline, err error) {
+	var errs []error
+	for i, source := range klineSources {
+		for attempt := 1; attempt <= marketDataRetries; attempt++ {
+			if attempt > 1 {
+				time.Sleep(time.Duration(attempt-1) * marketDataRetryBackoff)
+			}
+			klines3m, klines4h, err = fetchKlinesFrom(source, symbol)
+			if err == nil {
+				if i > 0 {
+					log.Printf("⚠️  %s 主数据源不可用，已改用 %s 数据源: %v", symbol, source.name, errors.Join(errs...))
+				}
+				return klines3m, klines4h, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", source.name, err))
+			if errors.Is(err, errStaleData) {
+				break
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: %s: %w", ErrNoMarketData, symbol, errors.Join(errs...))
+}
+
+// fetchKlinesFrom 从单个数据源获取 3m 和 4h K线，并检查 3m 价格是否冻结
+func fetchKlinesFrom(source klineSource, symbol string) (klines3m, klines4h []Kline, err error) {
+	klines3m, err = source.fetch(symbol, "3m")
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取3分钟K线失败: %w", err)
+	}
+
+	// Data staleness detection: Prevent DOGEUSDT-style price freeze issues
+	if isStaleData(klines3m, symbol) {
+		log.Printf("⚠️  WARNING: %s detected stale data from %s (consecutive price freeze)", symbol, source.name)
+		return nil, nil, fmt.Errorf("%s %w", symbol, errStaleData)
+	}
+
+	klines4h, err = source.fetch(symbol, "4h")
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取4小时K线失败: %w", err)
+	}
+	return klines3m, klines4h, nil
+}
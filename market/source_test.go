@@ -0,0 +1,83 @@
+package market
+
+import (
+	"errors"
+	"testing"
+)
+
+// withKlineSources 临时替换K线数据源（关闭重试等待）
+func withKlineSources(t *testing.T, sources ...klineSource) {
+	t.Helper()
+	oldSources, oldBackoff := klineSources, marketDataRetryBackoff
+	klineSources, marketDataRetryBackoff = sources, 0
+	t.Cleanup(func() { klineSources, marketDataRetryBackoff = oldSources, oldBackoff })
+}
+
+// risingKlines 价格逐根上涨的K线（不会被判定为冻结）
+func risingKlines(n int) []Kline {
+	klines := make([]Kline, n)
+	for i := range klines {
+		price := 100 + float64(i)
+		klines[i] = Kline{Open: price, High: price + 1, Low: price - 1, Close: price, Volume: 10}
+	}
+	return klines
+}
+
+// TestFetchKlines_FallbackSource 测试主数据源失败（含重试）后改用备用数据源
+func TestFetchKlines_FallbackSource(t *testing.T) {
+	primaryCalls, fallbackCalls := 0, 0
+	withKlineSources(t,
+		klineSource{name: "websocket", fetch: func(symbol, interval string) ([]Kline, error) {
+			primaryCalls++
+			return nil, errors.New("K线数据已过期")
+		}},
+		klineSource{name: "rest", fetch: func(symbol, interval string) ([]Kline, error) {
+			fallbackCalls++
+			return risingKlines(30), nil
+		}},
+	)
+
+	klines3m, klines4h, err := fetchKlines("BTCUSDT")
+	if err != nil {
+		t.Fatalf("备用数据源成功时不应返回错误: %v", err)
+	}
+	if len(klines3m) != 30 || len(klines4h) != 30 {
+		t.Errorf("应返回备用数据源的K线: 3m=%d 4h=%d", len(klines3m), len(klines4h))
+	}
+	if primaryCalls != marketDataRetries {
+		t.Errorf("主数据源应重试 %d 次, got %d", marketDataRetries, primaryCalls)
+	}
+	if fallbackCalls != 2 {
+		t.Errorf("备用数据源应请求 3m 和 4h 各一次, got %d", fallbackCalls)
+	}
+}
+
+// TestFetchKlines_AllSourcesFail 测试所有数据源失败时返回 ErrNoMarketData；价格冻结的数据源不重试
+func TestFetchKlines_AllSourcesFail(t *testing.T) {
+	staleCalls := 0
+	frozen := make([]Kline, 10)
+	for i := range frozen {
+		frozen[i] = Kline{Open: 1, High: 1, Low: 1, Close: 1}
+	}
+	withKlineSources(t,
+		klineSource{name: "websocket", fetch: func(symbol, interval string) ([]Kline, error) {
+			staleCalls++
+			return frozen, nil
+		}},
+		klineSource{name: "rest", fetch: func(symbol, interval string) ([]Kline, error) {
+			return nil, errors.New("HTTP 503")
+		}},
+	)
+
+	_, _, err := fetchKlines("DOGEUSDT")
+	if !errors.Is(err, ErrNoMarketData) {
+		t.Fatalf("应返回 ErrNoMarketData, got %v", err)
+	}
+	if staleCalls != 1 {
+		t.Errorf("价格冻结的数据源不应重试, got %d 次", staleCalls)
+	}
+
+	if _, err := Get("DOGEUSDT"); !errors.Is(err, ErrNoMarketData) {
+		t.Errorf("Get 应透传 ErrNoMarketData, got %v", err)
+	}
+}
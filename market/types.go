@@ -13,8 +13,10 @@ type Data struct {
 	CurrentRSI7       float64
 	OpenInterest      *OIData
 	FundingRate       float64
+	NextFundingTime   int64 // 下次资金费结算时间（毫秒时间戳），交易所不提供时为 0
 	IntradaySeries    *IntradayData
 	LongerTermContext *LongerTermData
+	Technical         *TechnicalContext // 多周期预计算指标
 }
 
 // OIData Open Interest数据
@@ -46,6 +48,22 @@ type LongerTermData struct {
 	RSI14Values   []float64
 }
 
+// TechnicalContext 多周期技术指标（预先计算，避免AI从原始K线自行推导）
+type TechnicalContext struct {
+	Timeframe3m  *TimeframeIndicators
+	Timeframe4h  *TimeframeIndicators
+	TrendAligned bool // 3m 与 4h 趋势方向一致（均为 bullish 或均为 bearish）
+}
+
+// TimeframeIndicators 单一周期的技术指标（K线不足时对应指标为 0）
+type TimeframeIndicators struct {
+	EMA20 float64
+	EMA50 float64
+	RSI14 float64
+	ATR14 float64
+	Trend string // bullish / bearish / neutral
+}
+
 // Binance API 响应结构
 type ExchangeInfo struct {
 	Symbols []SymbolInfo `json:"symbols"`
@@ -59,6 +77,8 @@ type SymbolInfo struct {
 	ContractType      string `json:"contractType"`
 	PricePrecision    int    `json:"pricePrecision"`
 	QuantityPrecision int    `json:"quantityPrecision"`
+
+	Filters []map[string]interface{} `json:"filters"` // PRICE_FILTER / LOT_SIZE / MIN_NOTIONAL 等
 }
 
 type Kline struct {
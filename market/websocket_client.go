@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"nofx/metrics"
 	"sync"
 	"time"
 
@@ -189,6 +190,7 @@ func (w *WSClient) handleReconnect() {
 	}
 
 	log.Println("尝试重新连接...")
+	metrics.WSReconnects.Inc()
 	time.Sleep(3 * time.Second)
 
 	if err := w.Connect(); err != nil {
@@ -1,7 +1,7 @@
 package market
 
 import (
-	"sync"
+	"nofx/clock"
 	"testing"
 	"time"
 )
@@ -9,10 +9,7 @@ import (
 // TestWSMonitor_GetCurrentKlines_StaleDataDetection tests that stale data is detected
 // TDD Red: This test should FAIL initially, demonstrating the bug
 func TestWSMonitor_GetCurrentKlines_StaleDataDetection(t *testing.T) {
-	monitor := &WSMonitor{
-		klineDataMap3m: sync.Map{},
-		klineDataMap4h: sync.Map{},
-	}
+	monitor := &WSMonitor{}
 
 	symbol := "BTCUSDT"
 
@@ -43,7 +40,7 @@ func TestWSMonitor_GetCurrentKlines_StaleDataDetection(t *testing.T) {
 	}
 
 	// Store stale data in cache (simulating old WebSocket data that hasn't been updated)
-	monitor.klineDataMap3m.Store(symbol, staleEntry)
+	monitor.getKlineDataMap("3m").Store(symbol, staleEntry)
 
 	// Try to get current klines
 	klines, err := monitor.GetCurrentKlines(symbol, "3m")
@@ -68,10 +65,7 @@ func TestWSMonitor_GetCurrentKlines_StaleDataDetection(t *testing.T) {
 // TestWSMonitor_GetCurrentKlines_FreshDataPasses tests that fresh data is accepted
 // This test should PASS even before the fix (verifies we don't break existing behavior)
 func TestWSMonitor_GetCurrentKlines_FreshDataPasses(t *testing.T) {
-	monitor := &WSMonitor{
-		klineDataMap3m: sync.Map{},
-		klineDataMap4h: sync.Map{},
-	}
+	monitor := &WSMonitor{}
 
 	symbol := "ETHUSDT"
 
@@ -102,7 +96,7 @@ func TestWSMonitor_GetCurrentKlines_FreshDataPasses(t *testing.T) {
 	}
 
 	// Store fresh data in cache
-	monitor.klineDataMap3m.Store(symbol, freshEntry)
+	monitor.getKlineDataMap("3m").Store(symbol, freshEntry)
 
 	// Try to get current klines
 	klines, err := monitor.GetCurrentKlines(symbol, "3m")
@@ -126,10 +120,7 @@ func TestWSMonitor_GetCurrentKlines_FreshDataPasses(t *testing.T) {
 
 // TestWSMonitor_GetCurrentKlines_BoundaryCase tests the 15-minute boundary
 func TestWSMonitor_GetCurrentKlines_BoundaryCase(t *testing.T) {
-	monitor := &WSMonitor{
-		klineDataMap3m: sync.Map{},
-		klineDataMap4h: sync.Map{},
-	}
+	monitor := &WSMonitor{}
 
 	symbol := "SOLUSDT"
 
@@ -150,7 +141,7 @@ func TestWSMonitor_GetCurrentKlines_BoundaryCase(t *testing.T) {
 		ReceivedAt: fifteenMinOneSecAgo,
 	}
 
-	monitor.klineDataMap3m.Store(symbol, boundaryKlines)
+	monitor.getKlineDataMap("3m").Store(symbol, boundaryKlines)
 
 	klines, err := monitor.GetCurrentKlines(symbol, "3m")
 
@@ -166,10 +157,7 @@ func TestWSMonitor_GetCurrentKlines_BoundaryCase(t *testing.T) {
 func TestWSMonitor_GetCurrentKlines_NoDataFallsBackToAPI(t *testing.T) {
 	t.Skip("Skipping API test - requires network connection")
 
-	monitor := &WSMonitor{
-		klineDataMap3m: sync.Map{},
-		klineDataMap4h: sync.Map{},
-	}
+	monitor := &WSMonitor{}
 
 	symbol := "BTCUSDT"
 
@@ -250,3 +238,46 @@ func TestDataAgeCalculation(t *testing.T) {
 		})
 	}
 }
+
+// TestWSMonitor_LastKlineAge tests that the last WebSocket kline time is tracked for health checks
+func TestWSMonitor_LastKlineAge(t *testing.T) {
+	monitor := &WSMonitor{}
+
+	if _, ok := monitor.LastKlineAge(); ok {
+		t.Fatal("LastKlineAge should report ok=false before any kline is received")
+	}
+
+	var wsData KlineWSData
+	wsData.Kline.StartTime = time.Now().UnixMilli()
+	wsData.Kline.ClosePrice = "43500.5"
+	monitor.processKlineUpdate("BTCUSDT", wsData, "3m")
+
+	age, ok := monitor.LastKlineAge()
+	if !ok {
+		t.Fatal("LastKlineAge should report ok=true after a kline is received")
+	}
+	if age < 0 || age > KlineMaxAge {
+		t.Errorf("LastKlineAge = %v, want a fresh age within %v", age, KlineMaxAge)
+	}
+}
+
+// TestWSMonitor_GetCurrentKlines_FakeClock tests staleness crossing KlineMaxAge with a simulated clock
+func TestWSMonitor_GetCurrentKlines_FakeClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	monitor := &WSMonitor{clock: fake}
+
+	monitor.getKlineDataMap("3m").Store("BTCUSDT", &KlineCacheEntry{
+		Klines:     []Kline{{Close: 50000.0}},
+		ReceivedAt: fake.Now(),
+	})
+
+	fake.Advance(KlineMaxAge)
+	if _, err := monitor.GetCurrentKlines("BTCUSDT", "3m"); err != nil {
+		t.Fatalf("data exactly KlineMaxAge old should be accepted: %v", err)
+	}
+
+	fake.Advance(time.Second)
+	if _, err := monitor.GetCurrentKlines("BTCUSDT", "3m"); err == nil {
+		t.Fatal("data older than KlineMaxAge should be rejected")
+	}
+}
@@ -0,0 +1,196 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"nofx/clock"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// BreakerFailureThreshold 连续失败多少次（每次调用已含重试）后熔断
+	BreakerFailureThreshold = 5
+	// BreakerCooldown 熔断后拒绝调用的时长，之后放行一次探测请求
+	BreakerCooldown = 2 * time.Minute
+
+	// ErrCircuitOpen 熔断中，调用被直接拒绝
+	ErrCircuitOpen = errors.New("AI服务熔断中")
+)
+
+// BreakerState 熔断器状态
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // 正常放行
+	BreakerOpen     BreakerState = "open"      // 熔断，直接拒绝
+	BreakerHalfOpen BreakerState = "half_open" // 冷却结束，放行一次探测请求
+)
+
+// CircuitBreaker 按 provider+BaseURL 共享的熔断器：同一端点的所有交易员一起退避，
+// 避免服务宕机时每个交易员每个周期都耗尽重试
+type CircuitBreaker struct {
+	key       string
+	threshold int
+	cooldown  time.Duration
+	clock     clock.Clock
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int       // 连续失败次数
+	openedAt time.Time // 最近一次熔断时间
+	probing  bool      // 半开状态下已有探测请求在途
+	lastErr  error     // 最近一次失败原因
+}
+
+// BreakerStatus 熔断器状态快照（用于 /healthz）
+type BreakerStatus struct {
+	Endpoint            string       `json:"endpoint"`
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+	RetryAfterSeconds   float64      `json:"retry_after_seconds,omitempty"`
+	LastError           string       `json:"last_error,omitempty"`
+}
+
+func newCircuitBreaker(key string, threshold int, cooldown time.Duration, clk clock.Clock) *CircuitBreaker {
+	return &CircuitBreaker{key: key, threshold: threshold, cooldown: cooldown, clock: clk, state: BreakerClosed}
+}
+
+// Allow 判断是否放行本次调用：熔断中返回 ErrCircuitOpen；冷却结束后转为半开，只放行一个探测请求
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		remaining := b.cooldown - clock.Or(b.clock).Since(b.openedAt)
+		if remaining > 0 {
+			return fmt.Errorf("%w（%s 连续失败 %d 次，%s 后重试）: %v", ErrCircuitOpen, b.key, b.failures, remaining.Round(time.Second), b.lastErr)
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		log.Printf("🔌 [MCP] 熔断冷却结束，放行探测请求: %s", b.key)
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w（%s 探测请求进行中）", ErrCircuitOpen, b.key)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record 记录调用结果：成功时恢复正常；失败累计到阈值（或半开探测失败）时熔断
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		if b.state != BreakerClosed {
+			log.Printf("✅ [MCP] AI服务恢复，解除熔断: %s", b.key)
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		b.probing = false
+		b.lastErr = nil
+		return
+	}
+
+	b.failures++
+	b.lastErr = err
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			log.Printf("🔌 [MCP] AI服务连续失败 %d 次，熔断 %v: %s", b.failures, b.cooldown, b.key)
+		}
+		b.state = BreakerOpen
+		b.openedAt = clock.Or(b.clock).Now()
+		b.probing = false
+	}
+}
+
+// Status 当前状态快照
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{Endpoint: b.key, State: b.state, ConsecutiveFailures: b.failures}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+		if remaining := b.cooldown - clock.Or(b.clock).Since(b.openedAt); b.state == BreakerOpen && remaining > 0 {
+			status.RetryAfterSeconds = remaining.Seconds()
+		}
+	}
+	return status
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = map[string]*CircuitBreaker{}
+)
+
+// breakerFor 获取端点共享的熔断器，首次使用时按当前配置创建
+func breakerFor(key string) *CircuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[key]
+	if !ok {
+		b = newCircuitBreaker(key, BreakerFailureThreshold, BreakerCooldown, clock.Real)
+		breakers[key] = b
+	}
+	return b
+}
+
+// BreakerStatuses 所有已使用端点的熔断器状态（按端点排序）
+func BreakerStatuses() []BreakerStatus {
+	breakersMu.Lock()
+	list := make([]*CircuitBreaker, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b)
+	}
+	breakersMu.Unlock()
+
+	statuses := make([]BreakerStatus, 0, len(list))
+	for _, b := range list {
+		statuses = append(statuses, b.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Endpoint < statuses[j].Endpoint })
+	return statuses
+}
+
+// breakerClient 带熔断的AI客户端：调用前检查端点熔断器，调用结果计入熔断器，其余方法透传
+type breakerClient struct {
+	AIClient
+}
+
+// WithCircuitBreaker 为AI客户端加上按 provider+BaseURL 共享的熔断器
+// 熔断器在调用时按当前端点查找，包装后再调用 SetAPIKey 修改地址也会使用对应端点的熔断器
+func WithCircuitBreaker(client AIClient) AIClient {
+	if _, ok := client.(*breakerClient); ok {
+		return client
+	}
+	return &breakerClient{AIClient: client}
+}
+
+// CallWithMessages 同 AIClient.CallWithMessages，熔断中直接返回 ErrCircuitOpen
+func (c *breakerClient) CallWithMessages(systemPrompt, userPrompt string) (string, error) {
+	result, _, err := c.CallWithMessagesUsage(systemPrompt, userPrompt)
+	return result, err
+}
+
+// CallWithMessagesUsage 同 AIClient.CallWithMessagesUsage，熔断中直接返回 ErrCircuitOpen
+func (c *breakerClient) CallWithMessagesUsage(systemPrompt, userPrompt string) (string, Usage, error) {
+	breaker := breakerFor(c.endpoint())
+	if err := breaker.Allow(); err != nil {
+		return "", Usage{}, err
+	}
+	result, usage, err := c.AIClient.CallWithMessagesUsage(systemPrompt, userPrompt)
+	breaker.Record(err)
+	return result, usage, err
+}
@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"errors"
+	"nofx/clock"
+	"testing"
+	"time"
+)
+
+// TestCircuitBreaker_Transitions 测试熔断器状态转换：连续失败熔断 → 冷却后半开只放行一个探测 → 探测失败重新熔断 → 探测成功恢复
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := newCircuitBreaker("deepseek|https://api.example.com", 3, time.Minute, fake)
+	errDown := errors.New("HTTP 503")
+
+	// 未达到阈值前保持放行，成功会清零失败计数
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("第 %d 次调用不应被拒绝: %v", i+1, err)
+		}
+		b.Record(errDown)
+	}
+	b.Record(nil)
+	if s := b.Status(); s.State != BreakerClosed || s.ConsecutiveFailures != 0 {
+		t.Fatalf("成功后应恢复正常: %+v", s)
+	}
+
+	for i := 0; i < 3; i++ {
+		b.Allow()
+		b.Record(errDown)
+	}
+	if s := b.Status(); s.State != BreakerOpen || s.RetryAfterSeconds != 60 {
+		t.Fatalf("连续失败 3 次应熔断 60 秒: %+v", s)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("熔断中应直接拒绝, got %v", err)
+	}
+
+	// 冷却结束：放行一个探测请求，探测在途时其他调用仍被拒绝
+	fake.Advance(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("冷却结束应放行探测请求: %v", err)
+	}
+	if s := b.Status(); s.State != BreakerHalfOpen {
+		t.Fatalf("探测期间应为半开: %+v", s)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("探测在途时应拒绝其他调用, got %v", err)
+	}
+
+	// 探测失败：重新熔断并重新计时
+	b.Record(errDown)
+	if s := b.Status(); s.State != BreakerOpen || s.RetryAfterSeconds != 60 {
+		t.Fatalf("探测失败应重新熔断: %+v", s)
+	}
+	fake.Advance(30 * time.Second)
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("重新熔断后冷却未结束应拒绝, got %v", err)
+	}
+
+	// 探测成功：恢复正常
+	fake.Advance(30 * time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("冷却结束应放行探测请求: %v", err)
+	}
+	b.Record(nil)
+	if s := b.Status(); s.State != BreakerClosed || s.ConsecutiveFailures != 0 || s.LastError != "" {
+		t.Fatalf("探测成功应恢复正常: %+v", s)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("恢复后应放行: %v", err)
+	}
+}
+
+// failingClient 调用总是失败的AI客户端，记录实际调用次数
+type failingClient struct {
+	*Client
+	calls int
+}
+
+func (c *failingClient) CallWithMessagesUsage(systemPrompt, userPrompt string) (string, Usage, error) {
+	c.calls++
+	return "", Usage{}, errors.New("HTTP 503")
+}
+
+// TestWithCircuitBreaker_SharedPerEndpoint 测试同一端点的客户端共享熔断器，其他端点不受影响
+func TestWithCircuitBreaker_SharedPerEndpoint(t *testing.T) {
+	oldThreshold := BreakerFailureThreshold
+	BreakerFailureThreshold = 2
+	defer func() { BreakerFailureThreshold = oldThreshold }()
+
+	newClient := func(baseURL string) *failingClient {
+		return &failingClient{Client: &Client{Provider: ProviderCustom, BaseURL: baseURL}}
+	}
+	down := "https://down.example.com/" + t.Name()
+	first, second, other := newClient(down), newClient(down), newClient("https://other.example.com/"+t.Name())
+
+	firstAI := WithCircuitBreaker(first)
+	firstAI.CallWithMessages("s", "u")
+	firstAI.CallWithMessages("s", "u")
+	if _, err := firstAI.CallWithMessages("s", "u"); !errors.Is(err, ErrCircuitOpen) || first.calls != 2 {
+		t.Fatalf("连续失败 2 次后应熔断: err=%v calls=%d", err, first.calls)
+	}
+
+	// 同一端点的另一个交易员直接快速失败
+	if _, _, err := WithCircuitBreaker(second).CallWithMessagesUsage("s", "u"); !errors.Is(err, ErrCircuitOpen) || second.calls != 0 {
+		t.Fatalf("同一端点应共享熔断状态: err=%v calls=%d", err, second.calls)
+	}
+	// 其他端点照常调用
+	if _, err := WithCircuitBreaker(other).CallWithMessages("s", "u"); errors.Is(err, ErrCircuitOpen) || other.calls != 1 {
+		t.Fatalf("其他端点不应熔断: err=%v calls=%d", err, other.calls)
+	}
+
+	var found bool
+	for _, s := range BreakerStatuses() {
+		if s.Endpoint == first.endpoint() {
+			found = s.State == BreakerOpen
+		}
+	}
+	if !found {
+		t.Error("BreakerStatuses 应报告熔断中的端点")
+	}
+}
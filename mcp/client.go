@@ -3,13 +3,17 @@ package mcp
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"nofx/logging"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,6 +23,9 @@ const (
 
 var (
 	DefaultTimeout = 120 * time.Second
+
+	// ProbeInterval 健康探测结果缓存时间（避免健康检查频繁请求AI端点）
+	ProbeInterval = 1 * time.Minute
 )
 
 // Client AI API配置
@@ -29,31 +36,151 @@ type Client struct {
 	Model      string
 	Timeout    time.Duration
 	UseFullURL bool // 是否使用完整URL（不添加/chat/completions）
-	MaxTokens  int  // AI响应的最大token数
+	MaxTokens  int  // AI响应的最大token数（推理模型未显式配置时至少为 DefaultReasonerMaxTokens）
+	JSONMode   bool // 是否发送 response_format: json_object（仅OpenAI兼容网关支持，DeepSeek/Qwen不支持）
+
+	// 采样参数：nil 时请求体不携带该参数（部分严格的网关/推理模型会拒绝不支持的参数）
+	Temperature *float64 // 默认 DefaultTemperature
+	TopP        *float64 // 默认不设置
+
+	// 调试日志：记录每次调用的完整 prompt 和原始响应（API Key 打码）
+	DebugLog         bool // 是否开启（环境变量 AI_DEBUG_LOG）
+	DebugLogMaxChars int  // 单个 prompt/响应 的最大记录字符数（环境变量 AI_DEBUG_LOG_MAX_CHARS，默认20000）
+	debugMu          sync.Mutex
+	debugLogDir      string       // 日志目录（通常为 trader 的决策日志目录）
+	debugLogger      *debugLogger // 按需创建
+
+	// 健康状态（用于 /healthz）
+	healthMu      sync.Mutex
+	lastSuccessAt time.Time // 最近一次成功调用时间
+	lastProbeAt   time.Time // 最近一次探测时间
+	lastProbeErr  error     // 最近一次探测结果
+
+	maxTokensFromEnv bool   // MaxTokens 来自环境变量 AI_MAX_TOKENS（显式配置时不再按模型调整）
+	lastReasoning    string // 最近一次响应中推理模型返回的推理过程（受 healthMu 保护）
+
+	logger *slog.Logger // 结构化日志（携带所属交易员的字段），nil 时使用全局日志
+}
+
+// Usage AI响应中的token用量（部分provider不返回usage，此时为零值）
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
+// Add 累加另一份用量
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// DefaultTemperature 默认采样温度（较低的温度提高JSON格式稳定性）
+const DefaultTemperature = 0.5
+
 func New() AIClient {
 	// 从环境变量读取 MaxTokens，默认 2000
 	maxTokens := 2000
+	maxTokensFromEnv := false
 	if envMaxTokens := os.Getenv("AI_MAX_TOKENS"); envMaxTokens != "" {
 		if parsed, err := strconv.Atoi(envMaxTokens); err == nil && parsed > 0 {
 			maxTokens = parsed
+			maxTokensFromEnv = true
 			log.Printf("🔧 [MCP] 使用环境变量 AI_MAX_TOKENS: %d", maxTokens)
 		} else {
 			log.Printf("⚠️  [MCP] 环境变量 AI_MAX_TOKENS 无效 (%s)，使用默认值: %d", envMaxTokens, maxTokens)
 		}
 	}
 
+	// 调试日志开关与截断长度
+	debugLog := false
+	if envDebugLog := os.Getenv("AI_DEBUG_LOG"); envDebugLog != "" {
+		if enabled, err := strconv.ParseBool(envDebugLog); err == nil {
+			debugLog = enabled
+			log.Printf("🔧 [MCP] 使用环境变量 AI_DEBUG_LOG: %v", enabled)
+		} else {
+			log.Printf("⚠️  [MCP] 环境变量 AI_DEBUG_LOG 无效 (%s)，不开启调试日志", envDebugLog)
+		}
+	}
+	debugLogMaxChars := defaultDebugLogMaxChars
+	if envMaxChars := os.Getenv("AI_DEBUG_LOG_MAX_CHARS"); envMaxChars != "" {
+		if parsed, err := strconv.Atoi(envMaxChars); err == nil && parsed > 0 {
+			debugLogMaxChars = parsed
+		} else {
+			log.Printf("⚠️  [MCP] 环境变量 AI_DEBUG_LOG_MAX_CHARS 无效 (%s)，使用默认值: %d", envMaxChars, debugLogMaxChars)
+		}
+	}
+
 	// 默认配置
+	temperature := DefaultTemperature
 	return &Client{
-		Provider:  ProviderDeepSeek,
-		BaseURL:   DefaultDeepSeekBaseURL,
-		Model:     DefaultDeepSeekModel,
-		Timeout:   DefaultTimeout,
-		MaxTokens: maxTokens,
+		Provider:         ProviderDeepSeek,
+		BaseURL:          DefaultDeepSeekBaseURL,
+		Model:            DefaultDeepSeekModel,
+		Timeout:          DefaultTimeout,
+		MaxTokens:        maxTokens,
+		Temperature:      &temperature,
+		DebugLog:         debugLog,
+		DebugLogMaxChars: debugLogMaxChars,
+		maxTokensFromEnv: maxTokensFromEnv,
+	}
+}
+
+// SetSampling 设置采样参数，nil 表示保持当前值（temperature 默认 DefaultTemperature，top_p 默认不发送）
+func (client *Client) SetSampling(temperature, topP *float64) {
+	if temperature != nil {
+		t := *temperature
+		client.Temperature = &t
+	}
+	if topP != nil {
+		p := *topP
+		client.TopP = &p
 	}
 }
 
+// SetDebugLogDir 设置调试日志目录（日志文件为 <dir>/ai_debug.log），仅在 DebugLog 开启时写入
+func (client *Client) SetDebugLogDir(dir string) {
+	client.debugMu.Lock()
+	defer client.debugMu.Unlock()
+	client.debugLogDir = dir
+	client.debugLogger = nil
+}
+
+// SetLogger 设置结构化日志（通常为携带 trader_id/user_id/exchange 字段的交易员日志）
+func (client *Client) SetLogger(l *slog.Logger) {
+	client.logger = l
+}
+
+// log 返回结构化日志（未设置时使用全局日志），附带 provider 和 model 字段
+func (client *Client) log() *slog.Logger {
+	l := client.logger
+	if l == nil {
+		l = logging.Logger()
+	}
+	return l.With("provider", client.Provider, "model", client.Model)
+}
+
+// writeDebugLog 记录一次调用（未开启调试日志时直接返回）
+func (client *Client) writeDebugLog(systemPrompt, userPrompt string, status int, response string, callErr error) {
+	if !client.DebugLog {
+		return
+	}
+
+	client.debugMu.Lock()
+	if client.debugLogger == nil {
+		dir := client.debugLogDir
+		if dir == "" {
+			dir = "decision_logs"
+		}
+		client.debugLogger = newDebugLogger(dir, client.DebugLogMaxChars)
+	}
+	dl := client.debugLogger
+	client.debugMu.Unlock()
+
+	dl.write(client.APIKey, systemPrompt, userPrompt, status, response, callErr)
+}
+
 // SetCustomAPI 设置自定义OpenAI兼容API
 func (client *Client) SetAPIKey(apiKey, apiURL, customModel string) {
 	client.Provider = ProviderCustom
@@ -70,46 +197,174 @@ func (client *Client) SetAPIKey(apiKey, apiURL, customModel string) {
 
 	client.Model = customModel
 	client.Timeout = 120 * time.Second
+
+	// 自定义OpenAI兼容API默认开启JSON模式，可通过 AI_JSON_MODE=false 关闭
+	client.JSONMode = true
+	if envJSONMode := os.Getenv("AI_JSON_MODE"); envJSONMode != "" {
+		if enabled, err := strconv.ParseBool(envJSONMode); err == nil {
+			client.JSONMode = enabled
+			log.Printf("🔧 [MCP] 使用环境变量 AI_JSON_MODE: %v", enabled)
+		} else {
+			log.Printf("⚠️  [MCP] 环境变量 AI_JSON_MODE 无效 (%s)，保持开启JSON模式", envJSONMode)
+		}
+	}
 }
 
 // CallWithMessages 使用 system + user prompt 调用AI API（推荐）
 func (client *Client) CallWithMessages(systemPrompt, userPrompt string) (string, error) {
+	result, _, err := client.CallWithMessagesUsage(systemPrompt, userPrompt)
+	return result, err
+}
+
+// CallWithMessagesUsage 同 CallWithMessages，额外返回成功那次调用的token用量
+func (client *Client) CallWithMessagesUsage(systemPrompt, userPrompt string) (string, Usage, error) {
 	if client.APIKey == "" {
-		return "", fmt.Errorf("AI API密钥未设置，请先调用 SetAPIKey")
+		return "", Usage{}, fmt.Errorf("AI API密钥未设置，请先调用 SetAPIKey")
 	}
 
 	// 重试配置
 	maxRetries := 3
 	var lastErr error
 
+	logger := client.log()
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		if attempt > 1 {
-			fmt.Printf("⚠️  AI API调用失败，正在重试 (%d/%d)...\n", attempt, maxRetries)
+			logger.Warn("⚠️ AI API调用失败，正在重试", "attempt", attempt, "max_retries", maxRetries)
 		}
 
-		result, err := client.callOnce(systemPrompt, userPrompt)
+		start := time.Now()
+		result, usage, err := client.callOnce(systemPrompt, userPrompt)
 		if err == nil {
-			if attempt > 1 {
-				fmt.Printf("✓ AI API重试成功\n")
-			}
-			return result, nil
+			client.markSuccess()
+			logger.Info("✓ AI API调用成功",
+				"attempt", attempt,
+				"duration_ms", time.Since(start).Milliseconds(),
+				"prompt_tokens", usage.PromptTokens,
+				"completion_tokens", usage.CompletionTokens,
+				"total_tokens", usage.TotalTokens)
+			return result, usage, nil
 		}
 
 		lastErr = err
 		// 如果不是网络错误，不重试
 		if !isRetryableError(err) {
-			return "", err
+			logger.Error("❌ AI API调用失败（不可重试）", "attempt", attempt, "error", err)
+			return "", Usage{}, err
 		}
 
 		// 重试前等待
 		if attempt < maxRetries {
 			waitTime := time.Duration(attempt) * 2 * time.Second
-			fmt.Printf("⏳ 等待%v后重试...\n", waitTime)
+			logger.Warn("⏳ AI API调用失败，等待后重试", "attempt", attempt, "wait", waitTime, "error", err)
 			time.Sleep(waitTime)
 		}
 	}
+	logger.Error("❌ AI API重试后仍然失败", "max_retries", maxRetries, "error", lastErr)
+
+	return "", Usage{}, fmt.Errorf("重试%d次后仍然失败: %w", maxRetries, lastErr)
+}
+
+// LastSuccessTime 最近一次成功调用AI的时间（从未成功时为零值）
+func (client *Client) LastSuccessTime() time.Time {
+	client.healthMu.Lock()
+	defer client.healthMu.Unlock()
+	return client.lastSuccessAt
+}
+
+// ErrProbeUnsupported 自定义完整URL的端点无法推导出模型列表接口，只能依据最近一次成功调用判断连通性
+var ErrProbeUnsupported = errors.New("自定义完整URL的AI端点不支持模型列表探测")
+
+// Probe 请求模型列表（GET /models，不消耗 token）检查AI端点连通性和API密钥
+// 结果缓存 ProbeInterval，期间重复调用直接返回上次结果
+func (client *Client) Probe() error {
+	client.healthMu.Lock()
+	if !client.lastProbeAt.IsZero() && time.Since(client.lastProbeAt) < ProbeInterval {
+		err := client.lastProbeErr
+		client.healthMu.Unlock()
+		return err
+	}
+	client.lastProbeAt = time.Now()
+	client.healthMu.Unlock()
+
+	err := client.listModels()
+
+	client.healthMu.Lock()
+	client.lastProbeErr = err
+	client.healthMu.Unlock()
+	return err
+}
+
+// listModels 请求模型列表接口，返回非 200 时视为不可用
+func (client *Client) listModels() error {
+	if client.APIKey == "" {
+		return fmt.Errorf("AI API密钥未设置")
+	}
+	baseURL := client.BaseURL
+	if client.UseFullURL {
+		trimmed, ok := strings.CutSuffix(strings.TrimRight(baseURL, "/"), "/chat/completions")
+		if !ok {
+			return ErrProbeUnsupported
+		}
+		baseURL = trimmed
+	}
+
+	req, err := http.NewRequest("GET", baseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	client.setAuthHeader(req.Header)
 
-	return "", fmt.Errorf("重试%d次后仍然失败: %w", maxRetries, lastErr)
+	httpClient := &http.Client{Timeout: client.Timeout}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("API返回错误 (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// ProbeCompletion 发送一次真实的对话补全请求检查AI能否正常响应（会消耗 token，不缓存，仅供已认证用户手动触发）
+func (client *Client) ProbeCompletion() error {
+	if client.APIKey == "" {
+		return fmt.Errorf("AI API密钥未设置")
+	}
+	// JSON模式要求消息中出现 "json" 字样，探测文本兼顾两种模式
+	if _, _, err := client.callOnce("", `ping, reply with json {"status":"OK"}`); err != nil {
+		return err
+	}
+	client.markSuccess()
+	return nil
+}
+
+// LastReasoning 最近一次响应中推理模型返回的推理过程（非推理模型为空）
+func (client *Client) LastReasoning() string {
+	client.healthMu.Lock()
+	defer client.healthMu.Unlock()
+	return client.lastReasoning
+}
+
+// requestMaxTokens 请求使用的 max_tokens：推理模型的输出包含推理过程，未通过 AI_MAX_TOKENS 显式配置时提高到 DefaultReasonerMaxTokens
+func (client *Client) requestMaxTokens() int {
+	if isReasonerModel(client.Model) && !client.maxTokensFromEnv && client.MaxTokens < DefaultReasonerMaxTokens {
+		return DefaultReasonerMaxTokens
+	}
+	return client.MaxTokens
+}
+
+// markSuccess 记录一次成功调用
+func (client *Client) markSuccess() {
+	client.healthMu.Lock()
+	client.lastSuccessAt = time.Now()
+	client.healthMu.Unlock()
+}
+
+// endpoint 熔断器按 provider+BaseURL 区分端点
+func (client *Client) endpoint() string {
+	return client.Provider + "|" + client.BaseURL
 }
 
 func (client *Client) setAuthHeader(reqHeader http.Header) {
@@ -117,16 +372,8 @@ func (client *Client) setAuthHeader(reqHeader http.Header) {
 }
 
 // callOnce 单次调用AI API（内部使用）
-func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error) {
-	// 打印当前 AI 配置
-	log.Printf("📡 [MCP] AI 请求配置:")
-	log.Printf("   Provider: %s", client.Provider)
-	log.Printf("   BaseURL: %s", client.BaseURL)
-	log.Printf("   Model: %s", client.Model)
-	log.Printf("   UseFullURL: %v", client.UseFullURL)
-	if len(client.APIKey) > 8 {
-		log.Printf("   API Key: %s...%s", client.APIKey[:4], client.APIKey[len(client.APIKey)-4:])
-	}
+func (client *Client) callOnce(systemPrompt, userPrompt string) (string, Usage, error) {
+	logger := client.log()
 
 	// 构建 messages 数组
 	messages := []map[string]string{}
@@ -147,18 +394,26 @@ func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error)
 
 	// 构建请求体
 	requestBody := map[string]interface{}{
-		"model":       client.Model,
-		"messages":    messages,
-		"temperature": 0.5, // 降低temperature以提高JSON格式稳定性
-		"max_tokens":  client.MaxTokens,
+		"model":      client.Model,
+		"messages":   messages,
+		"max_tokens": client.requestMaxTokens(),
+	}
+	if client.Temperature != nil {
+		requestBody["temperature"] = *client.Temperature
+	}
+	if client.TopP != nil {
+		requestBody["top_p"] = *client.TopP
 	}
 
-	// 注意：response_format 参数仅 OpenAI 支持，DeepSeek/Qwen 不支持
-	// 我们通过强化 prompt 和后处理来确保 JSON 格式正确
+	// 注意：response_format 参数仅 OpenAI 及部分兼容网关支持，DeepSeek/Qwen 不支持
+	// 未开启 JSONMode 时通过强化 prompt 和后处理来确保 JSON 格式正确
+	if client.JSONMode {
+		requestBody["response_format"] = map[string]string{"type": "json_object"}
+	}
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求失败: %w", err)
+		return "", Usage{}, fmt.Errorf("序列化请求失败: %w", err)
 	}
 
 	// 创建HTTP请求
@@ -170,11 +425,16 @@ func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error)
 		// 默认行为：添加/chat/completions
 		url = fmt.Sprintf("%s/chat/completions", client.BaseURL)
 	}
-	log.Printf("📡 [MCP] 请求 URL: %s", url)
+	// 打印当前 AI 配置（API Key 打码）
+	attrs := []any{"url", url, "use_full_url", client.UseFullURL, "json_mode", client.JSONMode}
+	if len(client.APIKey) > 8 {
+		attrs = append(attrs, "api_key", client.APIKey[:4]+"..."+client.APIKey[len(client.APIKey)-4:])
+	}
+	logger.Info("📡 [MCP] AI 请求", attrs...)
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("创建请求失败: %w", err)
+		return "", Usage{}, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -185,38 +445,50 @@ func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error)
 	httpClient := &http.Client{Timeout: client.Timeout}
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("发送请求失败: %w", err)
+		client.writeDebugLog(systemPrompt, userPrompt, 0, "", err)
+		return "", Usage{}, fmt.Errorf("发送请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// 读取响应
 	body, err := io.ReadAll(resp.Body)
+	client.writeDebugLog(systemPrompt, userPrompt, resp.StatusCode, string(body), err)
 	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %w", err)
+		return "", Usage{}, fmt.Errorf("读取响应失败: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API返回错误 (status %d): %s", resp.StatusCode, string(body))
+		return "", Usage{}, fmt.Errorf("API返回错误 (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	// 解析响应
 	var result struct {
 		Choices []struct {
 			Message struct {
-				Content string `json:"content"`
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"` // 推理模型的推理过程，不参与决策JSON解析
 			} `json:"message"`
 		} `json:"choices"`
+		Usage Usage `json:"usage"` // 未返回 usage 的 provider 保持零值
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+		return "", Usage{}, fmt.Errorf("解析响应失败: %w", err)
 	}
 
 	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("API返回空响应")
+		return "", Usage{}, fmt.Errorf("API返回空响应")
+	}
+
+	message := result.Choices[0].Message
+	client.healthMu.Lock()
+	client.lastReasoning = message.ReasoningContent
+	client.healthMu.Unlock()
+	if message.ReasoningContent != "" && client.DebugLog {
+		logger.Info("🧠 [MCP] 推理过程", "chars", len(message.ReasoningContent), "reasoning", truncateForLog(message.ReasoningContent, client.DebugLogMaxChars))
 	}
 
-	return result.Choices[0].Message.Content, nil
+	return message.Content, result.Usage, nil
 }
 
 // isRetryableError 判断错误是否可重试
@@ -0,0 +1,300 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureRequestBody 启动假的 chat/completions 服务，返回收到的请求体
+func captureRequestBody(t *testing.T, client *Client) map[string]interface{} {
+	t.Helper()
+
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("解析请求体失败: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"{}"}}]}`))
+	}))
+	defer server.Close()
+
+	client.BaseURL = server.URL
+	client.APIKey = "test-key"
+	if _, _, err := client.callOnce("system", "user"); err != nil {
+		t.Fatalf("callOnce 失败: %v", err)
+	}
+	return body
+}
+
+func TestCallOnce_ResponseFormat(t *testing.T) {
+	t.Run("JSONMode开启时携带response_format", func(t *testing.T) {
+		client := New().(*Client)
+		client.JSONMode = true
+
+		body := captureRequestBody(t, client)
+		format, ok := body["response_format"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("请求体缺少 response_format: %v", body)
+		}
+		if format["type"] != "json_object" {
+			t.Errorf("response_format.type = %v, want json_object", format["type"])
+		}
+	})
+
+	t.Run("JSONMode关闭时不携带response_format", func(t *testing.T) {
+		client := New().(*Client)
+
+		body := captureRequestBody(t, client)
+		if _, ok := body["response_format"]; ok {
+			t.Errorf("请求体不应包含 response_format: %v", body)
+		}
+	})
+}
+
+func TestCallOnce_Sampling(t *testing.T) {
+	t.Run("默认temperature为0.5且不发送top_p", func(t *testing.T) {
+		body := captureRequestBody(t, New().(*Client))
+		if body["temperature"] != DefaultTemperature {
+			t.Errorf("temperature = %v, want %v", body["temperature"], DefaultTemperature)
+		}
+		if _, ok := body["top_p"]; ok {
+			t.Errorf("未设置时请求体不应包含 top_p: %v", body)
+		}
+	})
+
+	t.Run("自定义temperature和top_p", func(t *testing.T) {
+		client := New().(*Client)
+		temperature, topP := 0.0, 0.9
+		client.SetSampling(&temperature, &topP)
+
+		body := captureRequestBody(t, client)
+		if body["temperature"] != 0.0 {
+			t.Errorf("temperature = %v, want 0", body["temperature"])
+		}
+		if body["top_p"] != 0.9 {
+			t.Errorf("top_p = %v, want 0.9", body["top_p"])
+		}
+	})
+
+	t.Run("temperature为nil时不发送", func(t *testing.T) {
+		client := New().(*Client)
+		client.Temperature = nil
+
+		body := captureRequestBody(t, client)
+		if _, ok := body["temperature"]; ok {
+			t.Errorf("请求体不应包含 temperature: %v", body)
+		}
+	})
+}
+
+func TestJSONModeDefaults(t *testing.T) {
+	t.Run("自定义API默认开启", func(t *testing.T) {
+		t.Setenv("AI_JSON_MODE", "")
+		client := New().(*Client)
+		client.SetAPIKey("key", "https://example.com/v1", "gpt-4o")
+		if !client.JSONMode {
+			t.Error("自定义API应默认开启 JSONMode")
+		}
+	})
+
+	t.Run("自定义API可通过环境变量关闭", func(t *testing.T) {
+		t.Setenv("AI_JSON_MODE", "false")
+		client := New().(*Client)
+		client.SetAPIKey("key", "https://example.com/v1", "gpt-4o")
+		if client.JSONMode {
+			t.Error("AI_JSON_MODE=false 时应关闭 JSONMode")
+		}
+	})
+
+	t.Run("DeepSeek和Qwen保持关闭", func(t *testing.T) {
+		t.Setenv("AI_JSON_MODE", "")
+		deepseek := NewDeepSeekClient().(*DeepSeekClient)
+		deepseek.SetAPIKey("key", "", "")
+		if deepseek.JSONMode {
+			t.Error("DeepSeek 不应开启 JSONMode")
+		}
+
+		qwen := NewQwenClient().(*QwenClient)
+		qwen.SetAPIKey("key", "", "")
+		if qwen.JSONMode {
+			t.Error("Qwen 不应开启 JSONMode")
+		}
+	})
+}
+
+func TestCallOnce_Usage(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     Usage
+	}{
+		{
+			name:     "返回usage时解析token用量",
+			response: `{"choices":[{"message":{"content":"{}"}}],"usage":{"prompt_tokens":120,"completion_tokens":30,"total_tokens":150}}`,
+			want:     Usage{PromptTokens: 120, CompletionTokens: 30, TotalTokens: 150},
+		},
+		{
+			name:     "未返回usage时为零值",
+			response: `{"choices":[{"message":{"content":"{}"}}]}`,
+			want:     Usage{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			client := New().(*Client)
+			client.BaseURL = server.URL
+			client.APIKey = "test-key"
+
+			_, usage, err := client.CallWithMessagesUsage("system", "user")
+			if err != nil {
+				t.Fatalf("CallWithMessagesUsage 失败: %v", err)
+			}
+			if usage != tt.want {
+				t.Errorf("usage = %+v, want %+v", usage, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsage_Add(t *testing.T) {
+	total := Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	total.Add(Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3})
+	if want := (Usage{PromptTokens: 11, CompletionTokens: 7, TotalTokens: 18}); total != want {
+		t.Errorf("total = %+v, want %+v", total, want)
+	}
+}
+
+func TestCallOnce_ReasonerModel(t *testing.T) {
+	const decisionJSON = `[{"symbol":"BTCUSDT","action":"hold","reasoning":"趋势不明"}]`
+	const reasoning = "先看BTC的4小时趋势……结论：观望"
+
+	tests := []struct {
+		name          string
+		model         string
+		response      string
+		wantMaxTokens float64
+		wantReasoning string
+	}{
+		{
+			name:          "推理模型提高max_tokens并单独记录推理过程",
+			model:         DeepSeekReasonerModel,
+			response:      `{"choices":[{"message":{"reasoning_content":"` + reasoning + `","content":"` + strings.ReplaceAll(decisionJSON, `"`, `\"`) + `"}}]}`,
+			wantMaxTokens: DefaultReasonerMaxTokens,
+			wantReasoning: reasoning,
+		},
+		{
+			name:          "deepseek-chat保持原有行为",
+			model:         DefaultDeepSeekModel,
+			response:      `{"choices":[{"message":{"content":"` + strings.ReplaceAll(decisionJSON, `"`, `\"`) + `"}}]}`,
+			wantMaxTokens: 2000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			client := &Client{Provider: ProviderDeepSeek, BaseURL: server.URL, APIKey: "test-key", Model: tt.model, MaxTokens: 2000}
+			content, _, err := client.callOnce("system", "user")
+			if err != nil {
+				t.Fatalf("callOnce 失败: %v", err)
+			}
+			if content != decisionJSON {
+				t.Errorf("content = %q, want %q（推理过程不应混入决策JSON）", content, decisionJSON)
+			}
+			if client.LastReasoning() != tt.wantReasoning {
+				t.Errorf("LastReasoning = %q, want %q", client.LastReasoning(), tt.wantReasoning)
+			}
+			if body["max_tokens"] != tt.wantMaxTokens {
+				t.Errorf("max_tokens = %v, want %v", body["max_tokens"], tt.wantMaxTokens)
+			}
+		})
+	}
+
+	t.Run("显式配置AI_MAX_TOKENS时不调整", func(t *testing.T) {
+		client := &Client{Model: DeepSeekReasonerModel, MaxTokens: 3000, maxTokensFromEnv: true}
+		if got := client.requestMaxTokens(); got != 3000 {
+			t.Errorf("requestMaxTokens = %d, want 3000", got)
+		}
+	})
+}
+
+// TestProbe 测试健康探测只请求模型列表，不发送消耗 token 的对话请求
+func TestProbe(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[{"id":"deepseek-chat"}]}`))
+	}))
+	defer server.Close()
+
+	t.Run("请求模型列表", func(t *testing.T) {
+		paths = nil
+		client := New().(*Client)
+		client.BaseURL = server.URL + "/v1"
+		client.APIKey = "test-key"
+		if err := client.Probe(); err != nil {
+			t.Fatalf("Probe 失败: %v", err)
+		}
+		if len(paths) != 1 || paths[0] != "GET /v1/models" {
+			t.Errorf("请求 = %v, want [GET /v1/models]", paths)
+		}
+	})
+
+	t.Run("完整URL按chat/completions推导模型列表地址", func(t *testing.T) {
+		paths = nil
+		client := New().(*Client)
+		client.BaseURL = server.URL + "/v1/chat/completions"
+		client.UseFullURL = true
+		client.APIKey = "test-key"
+		if err := client.Probe(); err != nil {
+			t.Fatalf("Probe 失败: %v", err)
+		}
+		if len(paths) != 1 || paths[0] != "GET /v1/models" {
+			t.Errorf("请求 = %v, want [GET /v1/models]", paths)
+		}
+
+		client = New().(*Client)
+		client.BaseURL = server.URL + "/custom/endpoint"
+		client.UseFullURL = true
+		client.APIKey = "test-key"
+		if err := client.Probe(); !errors.Is(err, ErrProbeUnsupported) {
+			t.Errorf("无法推导模型列表地址时应返回 ErrProbeUnsupported, got %v", err)
+		}
+	})
+
+	t.Run("密钥无效", func(t *testing.T) {
+		client := New().(*Client)
+		client.BaseURL = server.URL
+		client.APIKey = "bad-key"
+		if err := client.Probe(); err == nil {
+			t.Error("密钥无效时探测应失败")
+		}
+		if !client.LastSuccessTime().IsZero() {
+			t.Error("探测不应记为成功调用")
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package mcp
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DebugLogFileName AI 调试日志文件名（位于 trader 的决策日志目录下）
+	DebugLogFileName = "ai_debug.log"
+
+	defaultDebugLogMaxChars = 20000            // 单个 prompt/响应 的最大记录字符数
+	defaultDebugLogMaxBytes = 10 * 1024 * 1024 // 单个日志文件的轮转阈值
+	debugLogBackups         = 3                // 保留的历史日志文件数（ai_debug.log.1 ~ .3）
+)
+
+// debugLogger 记录每次 AI 调用的 system/user prompt 与原始响应，用于排查异常决策
+// 写入失败（目录不可写等）只告警一次，不影响正常调用
+type debugLogger struct {
+	mu       sync.Mutex
+	path     string
+	maxChars int
+	maxBytes int64
+	warnOnce sync.Once
+}
+
+// newDebugLogger 创建调试日志记录器
+func newDebugLogger(dir string, maxChars int) *debugLogger {
+	if maxChars <= 0 {
+		maxChars = defaultDebugLogMaxChars
+	}
+	return &debugLogger{
+		path:     filepath.Join(dir, DebugLogFileName),
+		maxChars: maxChars,
+		maxBytes: defaultDebugLogMaxBytes,
+	}
+}
+
+// write 追加一条调用记录（secret 会在所有文本中被打码）
+func (d *debugLogger) write(secret, systemPrompt, userPrompt string, status int, response string, callErr error) {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("===== %s status=%d =====\n", time.Now().Format(time.RFC3339), status))
+	sb.WriteString("--- system prompt ---\n")
+	sb.WriteString(truncateForLog(systemPrompt, d.maxChars))
+	sb.WriteString("\n--- user prompt ---\n")
+	sb.WriteString(truncateForLog(userPrompt, d.maxChars))
+	sb.WriteString("\n--- raw response ---\n")
+	sb.WriteString(truncateForLog(response, d.maxChars))
+	if callErr != nil {
+		sb.WriteString("\n--- error ---\n")
+		sb.WriteString(callErr.Error())
+	}
+	sb.WriteString("\n\n")
+
+	entry := redactSecret(sb.String(), secret)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.rotateIfNeeded(int64(len(entry))); err != nil {
+		d.warn(err)
+		return
+	}
+
+	f, err := os.OpenFile(d.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		d.warn(err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(entry); err != nil {
+		d.warn(err)
+	}
+}
+
+// rotateIfNeeded 写入后超过阈值时轮转：ai_debug.log -> .1 -> .2 ...，最旧的被覆盖
+func (d *debugLogger) rotateIfNeeded(incoming int64) error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return os.MkdirAll(filepath.Dir(d.path), 0755)
+		}
+		return err
+	}
+	if info.Size()+incoming <= d.maxBytes {
+		return nil
+	}
+
+	for i := debugLogBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", d.path, i), fmt.Sprintf("%s.%d", d.path, i+1))
+	}
+	return os.Rename(d.path, d.path+".1")
+}
+
+// warn 写入失败只告警一次，避免刷屏
+func (d *debugLogger) warn(err error) {
+	d.warnOnce.Do(func() {
+		log.Printf("⚠️  [MCP] AI 调试日志写入失败（后续失败不再提示）: %v", err)
+	})
+}
+
+// truncateForLog 超过 maxChars 的内容截断并注明原始长度
+func truncateForLog(s string, maxChars int) string {
+	runes := []rune(s)
+	if len(runes) <= maxChars {
+		return s
+	}
+	return string(runes[:maxChars]) + fmt.Sprintf("\n...[已截断，原始长度 %d 字符]", len(runes))
+}
+
+// redactSecret 将文本中出现的密钥替换为打码形式
+func redactSecret(s, secret string) string {
+	if secret == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, secret, maskSecret(secret))
+}
+
+// maskSecret 密钥打码（保留首尾4位，与启动日志一致）
+func maskSecret(secret string) string {
+	if len(secret) > 8 {
+		return secret[:4] + "..." + secret[len(secret)-4:]
+	}
+	return "****"
+}
@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newDebugTestClient 启动假的 chat/completions 服务，返回开启调试日志的客户端
+func newDebugTestClient(t *testing.T, dir string) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"raw-answer"}}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client := New().(*Client)
+	client.BaseURL = server.URL
+	client.APIKey = "sk-secret-key-123456"
+	client.DebugLog = true
+	client.SetDebugLogDir(dir)
+	return client
+}
+
+func TestDebugLog_WritesPromptAndRawResponse(t *testing.T) {
+	dir := t.TempDir()
+	client := newDebugTestClient(t, dir)
+	client.DebugLogMaxChars = 50
+
+	longPrompt := "user-" + strings.Repeat("x", 100) + " key=" + client.APIKey
+	if _, _, err := client.callOnce("system-prompt", longPrompt); err != nil {
+		t.Fatalf("callOnce 失败: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, DebugLogFileName))
+	if err != nil {
+		t.Fatalf("读取调试日志失败: %v", err)
+	}
+	content := string(data)
+
+	for _, want := range []string{"system-prompt", "user-xxx", `"content":"raw-answer"`, "已截断"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("调试日志缺少 %q:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, strings.Repeat("x", 100)) {
+		t.Errorf("超长 prompt 应被截断")
+	}
+}
+
+func TestDebugLog_RedactsAPIKey(t *testing.T) {
+	dir := t.TempDir()
+	client := newDebugTestClient(t, dir)
+
+	if _, _, err := client.callOnce("", "key="+client.APIKey); err != nil {
+		t.Fatalf("callOnce 失败: %v", err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, DebugLogFileName))
+	if strings.Contains(string(data), client.APIKey) {
+		t.Errorf("调试日志不应包含明文 API Key")
+	}
+	if !strings.Contains(string(data), "sk-s...3456") {
+		t.Errorf("调试日志应包含打码后的 API Key:\n%s", data)
+	}
+}
+
+func TestDebugLog_DisabledWritesNothing(t *testing.T) {
+	dir := t.TempDir()
+	client := newDebugTestClient(t, dir)
+	client.DebugLog = false
+
+	if _, _, err := client.callOnce("", "hello"); err != nil {
+		t.Fatalf("callOnce 失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, DebugLogFileName)); !os.IsNotExist(err) {
+		t.Errorf("未开启调试日志时不应创建文件")
+	}
+}
+
+func TestDebugLog_UnwritablePathDoesNotFail(t *testing.T) {
+	// 以普通文件作为目录，MkdirAll/OpenFile 必然失败
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	client := newDebugTestClient(t, filepath.Join(blocker, "logs"))
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.callOnce("", "hello"); err != nil {
+			t.Fatalf("日志写入失败不应影响调用: %v", err)
+		}
+	}
+}
+
+func TestDebugLog_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	dl := newDebugLogger(dir, 0)
+	dl.maxBytes = 200
+
+	for i := 0; i < 10; i++ {
+		dl.write("", "system", strings.Repeat("p", 100), 200, "resp", nil)
+	}
+
+	for _, name := range []string{DebugLogFileName, DebugLogFileName + ".1", DebugLogFileName + ".3"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("应存在轮转文件 %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, DebugLogFileName+".4")); !os.IsNotExist(err) {
+		t.Errorf("历史文件不应超过 %d 个", debugLogBackups)
+	}
+}
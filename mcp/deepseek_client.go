@@ -3,14 +3,25 @@ package mcp
 import (
 	"log"
 	"net/http"
+	"strings"
 )
 
 const (
 	ProviderDeepSeek       = "deepseek"
 	DefaultDeepSeekBaseURL = "https://api.deepseek.com/v1"
 	DefaultDeepSeekModel   = "deepseek-chat"
+	DeepSeekReasonerModel  = "deepseek-reasoner"
+
+	// DefaultReasonerMaxTokens 推理模型的默认 max_tokens（输出包含推理过程，默认的2000不足以容纳推理和决策JSON）
+	DefaultReasonerMaxTokens = 8000
 )
 
+// isReasonerModel 是否为推理类模型（deepseek-reasoner / deepseek-r1 等），推理过程在响应的 reasoning_content 字段中单独返回
+func isReasonerModel(model string) bool {
+	model = strings.ToLower(model)
+	return strings.Contains(model, "reasoner") || strings.Contains(model, "-r1")
+}
+
 type DeepSeekClient struct {
 	*Client
 }
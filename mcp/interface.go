@@ -1,12 +1,31 @@
 package mcp
 
-import "net/http"
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
 
 // AIClient AI客户端接口
 type AIClient interface {
 	SetAPIKey(apiKey string, customURL string, customModel string)
 	// CallWithMessages 使用 system + user prompt 调用AI API
 	CallWithMessages(systemPrompt, userPrompt string) (string, error)
+	// CallWithMessagesUsage 同 CallWithMessages，额外返回token用量
+	CallWithMessagesUsage(systemPrompt, userPrompt string) (string, Usage, error)
+	// LastSuccessTime 最近一次成功调用的时间（用于健康检查）
+	LastSuccessTime() time.Time
+	// Probe 请求模型列表检查连通性（不消耗 token，结果有短时缓存）
+	Probe() error
+	// ProbeCompletion 发送一次真实的对话补全请求检查AI能否正常响应（消耗 token）
+	ProbeCompletion() error
+	// SetSampling 设置采样参数 temperature / top_p（nil 表示保持默认）
+	SetSampling(temperature, topP *float64)
+	// SetDebugLogDir 设置AI调试日志目录（AI_DEBUG_LOG 开启时记录完整 prompt 和原始响应）
+	SetDebugLogDir(dir string)
+	// SetLogger 设置结构化日志（nil 表示使用全局日志）
+	SetLogger(l *slog.Logger)
 
 	setAuthHeader(reqHeaders http.Header)
+	endpoint() string
 }
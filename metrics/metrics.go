@@ -0,0 +1,104 @@
+// Package metrics 定义 Prometheus 指标：交易员状态由管理器在刷新竞赛数据时写入，
+// 开平仓、AI调用失败、交易所错误由执行器在发生时递增，WebSocket 重连由行情客户端递增。
+// 为控制基数，交易员维度的指标只使用 trader_id 和 exchange 两个标签
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var traderLabels = []string{"trader_id", "exchange"}
+
+var (
+	// 交易员状态（管理器刷新竞赛数据时更新）
+	Equity = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nofx_trader_equity_usdt",
+		Help: "Account equity (wallet balance + unrealized PnL) in USDT.",
+	}, traderLabels)
+	UnrealizedPnL = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nofx_trader_unrealized_pnl_usdt",
+		Help: "Unrealized PnL of open positions in USDT.",
+	}, traderLabels)
+	OpenPositions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nofx_trader_open_positions",
+		Help: "Number of open positions.",
+	}, traderLabels)
+	CallCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nofx_trader_call_count",
+		Help: "Decision cycles run since the trader started.",
+	}, traderLabels)
+	ConsecutiveLosses = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nofx_trader_consecutive_losses",
+		Help: "Losing trades in a row since the last winning trade.",
+	}, traderLabels)
+
+	// 事件计数（发生时递增）
+	TradesOpened = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nofx_trades_opened_total",
+		Help: "Opening orders submitted successfully.",
+	}, traderLabels)
+	TradesWon = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nofx_trades_won_total",
+		Help: "Closed trades with positive PnL.",
+	}, traderLabels)
+	TradesLost = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nofx_trades_lost_total",
+		Help: "Closed trades with zero or negative PnL.",
+	}, traderLabels)
+	AICallErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nofx_ai_call_errors_total",
+		Help: "AI model calls that failed after retries.",
+	}, traderLabels)
+	ExchangeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nofx_exchange_errors_total",
+		Help: "Order requests rejected or failed at the exchange.",
+	}, traderLabels)
+
+	// 行情 WebSocket 为所有交易员共享，不带标签
+	WSReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nofx_websocket_reconnects_total",
+		Help: "Market data WebSocket reconnect attempts.",
+	})
+	WSResubscribeStalls = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nofx_websocket_resubscribe_stalls_total",
+		Help: "Resubscribes that received no data within the timeout and forced a reconnect.",
+	})
+)
+
+// TraderSnapshot 交易员状态快照
+type TraderSnapshot struct {
+	Equity            float64
+	UnrealizedPnL     float64
+	OpenPositions     int
+	CallCount         int
+	ConsecutiveLosses int
+}
+
+// ObserveTrader 写入交易员状态
+func ObserveTrader(traderID, exchange string, s TraderSnapshot) {
+	Equity.WithLabelValues(traderID, exchange).Set(s.Equity)
+	UnrealizedPnL.WithLabelValues(traderID, exchange).Set(s.UnrealizedPnL)
+	OpenPositions.WithLabelValues(traderID, exchange).Set(float64(s.OpenPositions))
+	CallCount.WithLabelValues(traderID, exchange).Set(float64(s.CallCount))
+	ConsecutiveLosses.WithLabelValues(traderID, exchange).Set(float64(s.ConsecutiveLosses))
+}
+
+// RecordTradeClosed 按盈亏记录一笔平仓
+func RecordTradeClosed(traderID, exchange string, pnl float64) {
+	if pnl > 0 {
+		TradesWon.WithLabelValues(traderID, exchange).Inc()
+	} else {
+		TradesLost.WithLabelValues(traderID, exchange).Inc()
+	}
+}
+
+// RemoveTrader 删除交易员的所有指标序列（交易员被删除后不再导出）
+func RemoveTrader(traderID, exchange string) {
+	for _, vec := range []*prometheus.GaugeVec{Equity, UnrealizedPnL, OpenPositions, CallCount, ConsecutiveLosses} {
+		vec.DeleteLabelValues(traderID, exchange)
+	}
+	for _, vec := range []*prometheus.CounterVec{TradesOpened, TradesWon, TradesLost, AICallErrors, ExchangeErrors} {
+		vec.DeleteLabelValues(traderID, exchange)
+	}
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestObserveTraderAndRemove 测试写入交易员状态、按盈亏计数平仓，删除交易员后不再导出
+func TestObserveTraderAndRemove(t *testing.T) {
+	ObserveTrader("t1", "binance", TraderSnapshot{Equity: 1050, UnrealizedPnL: -12.5, OpenPositions: 2, CallCount: 30, ConsecutiveLosses: 3})
+	if got := testutil.ToFloat64(Equity.WithLabelValues("t1", "binance")); got != 1050 {
+		t.Errorf("equity = %v, want 1050", got)
+	}
+	if got := testutil.ToFloat64(ConsecutiveLosses.WithLabelValues("t1", "binance")); got != 3 {
+		t.Errorf("consecutive losses = %v, want 3", got)
+	}
+
+	RecordTradeClosed("t1", "binance", 25)
+	RecordTradeClosed("t1", "binance", -10)
+	RecordTradeClosed("t1", "binance", 0)
+	if won := testutil.ToFloat64(TradesWon.WithLabelValues("t1", "binance")); won != 1 {
+		t.Errorf("won = %v, want 1", won)
+	}
+	if lost := testutil.ToFloat64(TradesLost.WithLabelValues("t1", "binance")); lost != 2 {
+		t.Errorf("lost = %v, want 2", lost)
+	}
+
+	RemoveTrader("t1", "binance")
+	if n := testutil.CollectAndCount(Equity); n != 0 {
+		t.Errorf("删除后仍导出 %d 个净值序列", n)
+	}
+	if n := testutil.CollectAndCount(TradesWon); n != 0 {
+		t.Errorf("删除后仍导出 %d 个盈利平仓序列", n)
+	}
+}
@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -420,8 +421,13 @@ var oiTopConfig = struct {
 
 // GetOITopPositions 获取持仓量增长Top20数据（带重试和缓存）
 func GetOITopPositions() ([]OIPosition, error) {
+	return getOITopPositions(oiTopConfig.APIURL)
+}
+
+// getOITopPositions 从指定 API 获取OI Top数据（带重试和缓存），未配置URL时返回空列表
+func getOITopPositions(apiURL string) ([]OIPosition, error) {
 	// 检查API URL是否配置
-	if strings.TrimSpace(oiTopConfig.APIURL) == "" {
+	if strings.TrimSpace(apiURL) == "" {
 		log.Printf("⚠️  未配置OI Top API URL，跳过OI Top数据获取")
 		return []OIPosition{}, nil // 返回空列表，不是错误
 	}
@@ -436,13 +442,13 @@ func GetOITopPositions() ([]OIPosition, error) {
 			time.Sleep(2 * time.Second)
 		}
 
-		positions, err := fetchOITop()
+		positions, err := fetchOITop(apiURL)
 		if err == nil {
 			if attempt > 1 {
 				log.Printf("✓ 第%d次重试成功", attempt)
 			}
 			// 成功获取后保存到缓存
-			if err := saveOITopCache(positions); err != nil {
+			if err := saveOITopCache(apiURL, positions); err != nil {
 				log.Printf("⚠️  保存OI Top缓存失败: %v", err)
 			}
 			return positions, nil
@@ -454,7 +460,7 @@ func GetOITopPositions() ([]OIPosition, error) {
 
 	// API获取失败，尝试使用缓存
 	log.Printf("⚠️  OI Top API请求全部失败，尝试使用历史缓存数据...")
-	cachedPositions, err := loadOITopCache()
+	cachedPositions, err := loadOITopCache(apiURL)
 	if err == nil {
 		log.Printf("✓ 使用历史OI Top缓存数据（共%d个币种）", len(cachedPositions))
 		return cachedPositions, nil
@@ -466,14 +472,14 @@ func GetOITopPositions() ([]OIPosition, error) {
 }
 
 // fetchOITop 实际执行OI Top请求
-func fetchOITop() ([]OIPosition, error) {
+func fetchOITop(apiURL string) ([]OIPosition, error) {
 	log.Printf("🔄 正在请求OI Top数据...")
 
 	client := &http.Client{
 		Timeout: oiTopConfig.Timeout,
 	}
 
-	resp, err := client.Get(oiTopConfig.APIURL)
+	resp, err := client.Get(apiURL)
 	if err != nil {
 		return nil, fmt.Errorf("请求OI Top API失败: %w", err)
 	}
@@ -507,8 +513,17 @@ func fetchOITop() ([]OIPosition, error) {
 	return response.Data.Positions, nil
 }
 
+// oiTopCachePath OI Top缓存文件路径：全局配置的 API 使用 oi_top_latest.json，其他 API（交易员自己的信号源）按URL哈希区分
+func oiTopCachePath(apiURL string) string {
+	if apiURL == oiTopConfig.APIURL {
+		return filepath.Join(oiTopConfig.CacheDir, "oi_top_latest.json")
+	}
+	sum := sha256.Sum256([]byte(apiURL))
+	return filepath.Join(oiTopConfig.CacheDir, fmt.Sprintf("oi_top_%x.json", sum[:4]))
+}
+
 // saveOITopCache 保存OI Top数据到缓存
-func saveOITopCache(positions []OIPosition) error {
+func saveOITopCache(apiURL string, positions []OIPosition) error {
 	if err := os.MkdirAll(oiTopConfig.CacheDir, 0755); err != nil {
 		return fmt.Errorf("创建缓存目录失败: %w", err)
 	}
@@ -524,7 +539,7 @@ func saveOITopCache(positions []OIPosition) error {
 		return fmt.Errorf("序列化OI Top缓存数据失败: %w", err)
 	}
 
-	cachePath := filepath.Join(oiTopConfig.CacheDir, "oi_top_latest.json")
+	cachePath := oiTopCachePath(apiURL)
 	if err := ioutil.WriteFile(cachePath, data, 0644); err != nil {
 		return fmt.Errorf("写入OI Top缓存文件失败: %w", err)
 	}
@@ -534,8 +549,8 @@ func saveOITopCache(positions []OIPosition) error {
 }
 
 // loadOITopCache 从缓存加载OI Top数据
-func loadOITopCache() ([]OIPosition, error) {
-	cachePath := filepath.Join(oiTopConfig.CacheDir, "oi_top_latest.json")
+func loadOITopCache(apiURL string) ([]OIPosition, error) {
+	cachePath := oiTopCachePath(apiURL)
 
 	if _, err := os.Stat(cachePath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("OI Top缓存文件不存在")
@@ -565,7 +580,12 @@ func loadOITopCache() ([]OIPosition, error) {
 
 // GetOITopSymbols 获取OI Top的币种符号列表
 func GetOITopSymbols() ([]string, error) {
-	positions, err := GetOITopPositions()
+	return GetOITopSymbolsFrom(oiTopConfig.APIURL)
+}
+
+// GetOITopSymbolsFrom 从指定 API（如交易员所属用户配置的OI Top信号源）获取OI Top的币种符号列表
+func GetOITopSymbolsFrom(apiURL string) ([]string, error) {
+	positions, err := getOITopPositions(apiURL)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,63 @@
+package trader
+
+import (
+	"fmt"
+	"math"
+	"nofx/decision"
+	"nofx/market"
+)
+
+// 无持仓时触发AI调用的默认阈值
+const (
+	DefaultTriggerPriceMovePct = 1.0 // 1小时涨跌幅绝对值（%）
+	DefaultTriggerVolumeSpike  = 3.0 // 最新3分钟成交量 / 此前3分钟均量
+)
+
+// triggerThresholds 触发AI调用的涨跌幅和放量阈值（未配置时使用默认值）
+func (at *AutoTrader) triggerThresholds() (priceMovePct, volumeSpike float64) {
+	priceMovePct = at.config.TriggerPriceMovePct
+	if priceMovePct <= 0 {
+		priceMovePct = DefaultTriggerPriceMovePct
+	}
+	volumeSpike = at.config.TriggerVolumeSpike
+	if volumeSpike <= 0 {
+		volumeSpike = DefaultTriggerVolumeSpike
+	}
+	return priceMovePct, volumeSpike
+}
+
+// findAITrigger 检查候选币种是否出现值得调用AI的行情（1小时涨跌幅或3分钟放量达到阈值），返回首个触发原因，
+// 没有触发时返回空字符串。行情获取失败时无法判断，按触发处理（宁可多调用一次AI，也不漏掉机会）
+func (at *AutoTrader) findAITrigger(ctx *decision.Context) string {
+	priceMovePct, volumeSpike := at.triggerThresholds()
+	for _, coin := range ctx.CandidateCoins {
+		data, err := market.Get(coin.Symbol)
+		if err != nil {
+			return fmt.Sprintf("%s 行情获取失败，无法判断触发条件: %v", coin.Symbol, err)
+		}
+		if math.Abs(data.PriceChange1h) >= priceMovePct {
+			return fmt.Sprintf("%s 1小时涨跌 %+.2f%%（阈值 %.2f%%）", coin.Symbol, data.PriceChange1h, priceMovePct)
+		}
+		if ratio, ok := latestVolumeRatio(data); ok && ratio >= volumeSpike {
+			return fmt.Sprintf("%s 3分钟成交量放大 %.1f 倍（阈值 %.1f 倍）", coin.Symbol, ratio, volumeSpike)
+		}
+	}
+	return ""
+}
+
+// latestVolumeRatio 最新一根3分钟K线成交量与此前几根均量之比（数据不足或此前无成交时返回 false）
+func latestVolumeRatio(data *market.Data) (float64, bool) {
+	if data.IntradaySeries == nil || len(data.IntradaySeries.Volume) < 2 {
+		return 0, false
+	}
+	volumes := data.IntradaySeries.Volume
+	var sum float64
+	for _, v := range volumes[:len(volumes)-1] {
+		sum += v
+	}
+	avg := sum / float64(len(volumes)-1)
+	if avg <= 0 {
+		return 0, false
+	}
+	return volumes[len(volumes)-1] / avg, true
+}
@@ -45,6 +45,7 @@ type SymbolPrecision struct {
 	QuantityPrecision int
 	TickSize          float64 // 价格步进值
 	StepSize          float64 // 数量步进值
+	MinNotional       float64 // 最小名义价值
 }
 
 // NewAsterTrader 创建Aster交易器
@@ -136,6 +137,10 @@ func (t *AsterTrader) getPrecision(symbol string) (SymbolPrecision, error) {
 				if stepSizeStr, ok := filter["stepSize"].(string); ok {
 					prec.StepSize, _ = strconv.ParseFloat(stepSizeStr, 64)
 				}
+			case "MIN_NOTIONAL":
+				if notionalStr, ok := filter["notional"].(string); ok {
+					prec.MinNotional, _ = strconv.ParseFloat(notionalStr, 64)
+				}
 			}
 		}
 
@@ -396,7 +401,7 @@ func (t *AsterTrader) doRequest(method, endpoint string, params map[string]inter
 
 		body, _ := io.ReadAll(resp.Body)
 		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+			return nil, classifyHTTPError(resp.StatusCode, body)
 		}
 		return body, nil
 
@@ -422,7 +427,7 @@ func (t *AsterTrader) doRequest(method, endpoint string, params map[string]inter
 
 		body, _ := io.ReadAll(resp.Body)
 		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+			return nil, classifyHTTPError(resp.StatusCode, body)
 		}
 		return body, nil
 
@@ -549,6 +554,7 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 		unRealizedProfit, _ := strconv.ParseFloat(pos["unRealizedProfit"].(string), 64)
 		leverageVal, _ := strconv.ParseFloat(pos["leverage"].(string), 64)
 		liquidationPrice, _ := strconv.ParseFloat(pos["liquidationPrice"].(string), 64)
+		marginType, _ := pos["marginType"].(string)
 
 		// 判断方向（与Binance一致）
 		side := "long"
@@ -567,6 +573,7 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 			"unRealizedProfit": unRealizedProfit,
 			"leverage":         leverageVal,
 			"liquidationPrice": liquidationPrice,
+			"marginMode":       normalizeMarginMode(marginType),
 		})
 	}
 
@@ -574,7 +581,8 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 }
 
 // OpenLong 开多单
-func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+// Aster 使用单向持仓（positionSide=BOTH），忽略 positionSide 参数
+func (t *AsterTrader) OpenLong(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
 	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
@@ -641,7 +649,7 @@ func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (m
 }
 
 // OpenShort 开空单
-func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *AsterTrader) OpenShort(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
 	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
@@ -708,7 +716,7 @@ func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (
 }
 
 // CloseLong 平多单
-func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *AsterTrader) CloseLong(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -724,7 +732,7 @@ func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]int
 		}
 
 		if quantity == 0 {
-			return nil, fmt.Errorf("没有找到 %s 的多仓", symbol)
+			return nil, fmt.Errorf("%w: %s 多仓", ErrPositionNotFound, symbol)
 		}
 		log.Printf("  📊 获取到多仓数量: %.8f", quantity)
 	}
@@ -767,6 +775,7 @@ func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]int
 		"timeInForce":  "GTC",
 		"quantity":     qtyStr,
 		"price":        priceStr,
+		"reduceOnly":   "true", // 只减仓：数量超过持仓时也不会反向开仓
 	}
 
 	body, err := t.request("POST", "/fapi/v3/order", params)
@@ -790,7 +799,7 @@ func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]int
 }
 
 // CloseShort 平空单
-func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *AsterTrader) CloseShort(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -807,7 +816,7 @@ func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]in
 		}
 
 		if quantity == 0 {
-			return nil, fmt.Errorf("没有找到 %s 的空仓", symbol)
+			return nil, fmt.Errorf("%w: %s 空仓", ErrPositionNotFound, symbol)
 		}
 		log.Printf("  📊 获取到空仓数量: %.8f", quantity)
 	}
@@ -850,6 +859,7 @@ func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]in
 		"timeInForce":  "GTC",
 		"quantity":     qtyStr,
 		"price":        priceStr,
+		"reduceOnly":   "true", // 只减仓：数量超过持仓时也不会反向开仓
 	}
 
 	body, err := t.request("POST", "/fapi/v3/order", params)
@@ -890,11 +900,17 @@ func (t *AsterTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
 	_, err := t.request("POST", "/fapi/v3/marginType", params)
 	if err != nil {
 		// 如果错误表示无需更改，忽略错误
-		if strings.Contains(err.Error(), "No need to change") ||
-			strings.Contains(err.Error(), "Margin type cannot be changed") {
-			log.Printf("  ✓ %s 仓位模式已是 %s 或有持仓无法更改", symbol, marginType)
+		if strings.Contains(err.Error(), "No need to change") {
+			log.Printf("  ✓ %s 仓位模式已是 %s", symbol, marginType)
 			return nil
 		}
+		// 有持仓时无法更改，由调用方决定是否继续使用当前模式
+		if errors.Is(err, ErrMarginModeLocked) {
+			return err
+		}
+		if strings.Contains(err.Error(), "Margin type cannot be changed") {
+			return fmt.Errorf("%w: %v", ErrMarginModeLocked, err)
+		}
 		// 检测多资产模式（错误码 -4168）
 		if strings.Contains(err.Error(), "Multi-Assets mode") ||
 			strings.Contains(err.Error(), "-4168") ||
@@ -1033,6 +1049,7 @@ func (t *AsterTrader) SetTakeProfit(symbol string, positionSide string, quantity
 		"stopPrice":    priceStr,
 		"quantity":     qtyStr,
 		"timeInForce":  "GTC",
+		"reduceOnly":   "true", // 只减仓，分批止盈挂多张单时不会反向开仓
 	}
 
 	_, err = t.request("POST", "/fapi/v3/order", params)
@@ -1230,3 +1247,29 @@ func (t *AsterTrader) FormatQuantity(symbol string, quantity float64) (string, e
 	}
 	return fmt.Sprintf("%v", formatted), nil
 }
+
+// FormatPrice 按 tick size（没有时按价格精度）格式化价格（实现Trader接口）
+func (t *AsterTrader) FormatPrice(symbol string, price float64) (string, error) {
+	prec, err := t.getPrecision(symbol)
+	if err != nil {
+		return "", err
+	}
+	if prec.TickSize > 0 {
+		return formatStep(price, prec.TickSize), nil
+	}
+	return strconv.FormatFloat(price, 'f', prec.PricePrecision, 64), nil
+}
+
+// GetSymbolFilters 获取交易对的数量步进值和最小名义价值（实现Trader接口）
+func (t *AsterTrader) GetSymbolFilters(symbol string) (SymbolFilters, error) {
+	prec, err := t.getPrecision(symbol)
+	if err != nil {
+		return SymbolFilters{}, err
+	}
+
+	stepSize := prec.StepSize
+	if stepSize <= 0 {
+		stepSize = math.Pow10(-prec.QuantityPrecision)
+	}
+	return SymbolFilters{StepSize: stepSize, MinNotional: prec.MinNotional}, nil
+}
@@ -1,8 +1,13 @@
 package trader
 
 import (
+	"math"
 	"nofx/decision"
+	"nofx/logger"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // TestDetectClosedPositions_StopLossTriggered tests detection of positions closed by stop-loss
@@ -468,6 +473,60 @@ func TestInferCloseDetails_Liquidation(t *testing.T) {
 	}
 }
 
+// TestClassifyClose_Boundaries tests that the classification flips exactly at the edge of each tolerance band
+func TestClassifyClose_Boundaries(t *testing.T) {
+	tests := []struct {
+		name       string
+		pos        decision.PositionInfo
+		tol        float64
+		wantPrice  float64
+		wantReason string
+	}{
+		// 止损带：1%
+		{"long stop inside", decision.PositionInfo{Side: "long", MarkPrice: 100.99, StopLoss: 100}, 1, 100, "stop_loss"},
+		{"long stop outside", decision.PositionInfo{Side: "long", MarkPrice: 101.01, StopLoss: 100}, 1, 101.01, "unknown"},
+		{"short stop inside", decision.PositionInfo{Side: "short", MarkPrice: 99.01, StopLoss: 100}, 1, 100, "stop_loss"},
+		{"short stop outside", decision.PositionInfo{Side: "short", MarkPrice: 98.99, StopLoss: 100}, 1, 98.99, "unknown"},
+		// 止盈带：1%
+		{"long take profit inside", decision.PositionInfo{Side: "long", MarkPrice: 198.01, TakeProfit: 200}, 1, 200, "take_profit"},
+		{"long take profit outside", decision.PositionInfo{Side: "long", MarkPrice: 197.99, TakeProfit: 200}, 1, 197.99, "unknown"},
+		{"short take profit inside", decision.PositionInfo{Side: "short", MarkPrice: 100.99, TakeProfit: 100}, 1, 100, "take_profit"},
+		{"short take profit outside", decision.PositionInfo{Side: "short", MarkPrice: 101.01, TakeProfit: 100}, 1, 101.01, "unknown"},
+		// 强平带：容差的两倍（2%）
+		{"long liquidation inside", decision.PositionInfo{Side: "long", MarkPrice: 101.99, LiquidationPrice: 100}, 1, 100, "liquidation"},
+		{"long liquidation outside", decision.PositionInfo{Side: "long", MarkPrice: 102.01, LiquidationPrice: 100}, 1, 102.01, "unknown"},
+		{"short liquidation inside", decision.PositionInfo{Side: "short", MarkPrice: 98.01, LiquidationPrice: 100}, 1, 100, "liquidation"},
+		{"short liquidation outside", decision.PositionInfo{Side: "short", MarkPrice: 97.99, LiquidationPrice: 100}, 1, 97.99, "unknown"},
+		// 放宽容差后原本在带外的价格落入带内
+		{"wider stop band", decision.PositionInfo{Side: "long", MarkPrice: 101.5, StopLoss: 100}, 2, 100, "stop_loss"},
+		{"wider liquidation band", decision.PositionInfo{Side: "long", MarkPrice: 103.5, LiquidationPrice: 100}, 2, 100, "liquidation"},
+		// 同时落入多个带时强平优先于止损
+		{"liquidation before stop", decision.PositionInfo{Side: "long", MarkPrice: 100.5, LiquidationPrice: 100, StopLoss: 100.2}, 1, 100, "liquidation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, reason := classifyClose(tt.pos, tt.tol)
+			if reason != tt.wantReason || price != tt.wantPrice {
+				t.Errorf("classifyClose() = (%v, %s), want (%v, %s)", price, reason, tt.wantPrice, tt.wantReason)
+			}
+		})
+	}
+}
+
+// TestInferCloseDetails_ConfiguredTolerance tests that inferCloseDetails uses CloseTolerancePct and defaults to 1%
+func TestInferCloseDetails_ConfiguredTolerance(t *testing.T) {
+	pos := decision.PositionInfo{Symbol: "BTCUSDT", Side: "long", MarkPrice: 101.5, StopLoss: 100}
+
+	if _, reason := (&AutoTrader{}).inferCloseDetails(pos); reason != "unknown" {
+		t.Errorf("default 1%% tolerance: reason = %s, want unknown", reason)
+	}
+	at := &AutoTrader{config: AutoTraderConfig{CloseTolerancePct: 2}}
+	if _, reason := at.inferCloseDetails(pos); reason != "stop_loss" {
+		t.Errorf("2%% tolerance: reason = %s, want stop_loss", reason)
+	}
+}
+
 // TestInferCloseDetails_Unknown tests unknown close reason (manual close)
 func TestInferCloseDetails_Unknown(t *testing.T) {
 	at := &AutoTrader{}
@@ -540,3 +599,336 @@ func TestIntegration_AutoCloseWorkflow(t *testing.T) {
 		t.Errorf("Expected no closed positions in cycle 3, got %d", len(closedPositions3))
 	}
 }
+
+// TestDetectClosedPositions_HedgeModeBothSides tests a symbol holding long and short at the same time (hedge mode)
+func TestDetectClosedPositions_HedgeModeBothSides(t *testing.T) {
+	at := &AutoTrader{
+		lastPositions: make(map[string]decision.PositionInfo),
+	}
+
+	// Both sides of BTCUSDT are held at once
+	bothSides := []decision.PositionInfo{
+		{Symbol: "BTCUSDT", Side: "long", EntryPrice: 50000.0, MarkPrice: 50500.0, Quantity: 0.1, Leverage: 10},
+		{Symbol: "BTCUSDT", Side: "short", EntryPrice: 51000.0, MarkPrice: 50500.0, Quantity: 0.05, Leverage: 10},
+	}
+	at.updatePositionSnapshot(bothSides)
+
+	if len(at.lastPositions) != 2 {
+		t.Fatalf("Expected 2 positions in snapshot, got %d", len(at.lastPositions))
+	}
+	if _, exists := at.lastPositions["BTCUSDT_long"]; !exists {
+		t.Fatalf("BTCUSDT_long not found in snapshot")
+	}
+	if _, exists := at.lastPositions["BTCUSDT_short"]; !exists {
+		t.Fatalf("BTCUSDT_short not found in snapshot")
+	}
+
+	// Both sides still open: nothing closed
+	if closed := at.detectClosedPositions(bothSides); len(closed) != 0 {
+		t.Fatalf("Expected 0 closed positions, got %d", len(closed))
+	}
+
+	// Long side closed, short side still open
+	onlyShort := []decision.PositionInfo{bothSides[1]}
+	closed := at.detectClosedPositions(onlyShort)
+
+	if len(closed) != 1 {
+		t.Fatalf("Expected 1 closed position, got %d", len(closed))
+	}
+	if closed[0].Symbol != "BTCUSDT" || closed[0].Side != "long" {
+		t.Errorf("Expected BTCUSDT long closed, got %s %s", closed[0].Symbol, closed[0].Side)
+	}
+
+	at.updatePositionSnapshot(onlyShort)
+	if _, exists := at.lastPositions["BTCUSDT_long"]; exists {
+		t.Errorf("BTCUSDT_long should be removed from snapshot")
+	}
+	if _, exists := at.lastPositions["BTCUSDT_short"]; !exists {
+		t.Errorf("BTCUSDT_short should still exist")
+	}
+}
+
+// TestReconcilePositions_CleansOrphanedState tests that reconciliation drops internal state for positions
+// that no longer exist on the exchange (e.g. manually closed in the exchange UI)
+func TestReconcilePositions_CleansOrphanedState(t *testing.T) {
+	at := &AutoTrader{
+		trader: &MockTrader{
+			positions: []map[string]interface{}{
+				{"symbol": "ETHUSDT", "side": "short", "positionAmt": -1.0},
+			},
+		},
+		lastPositions:         make(map[string]decision.PositionInfo),
+		positionFirstSeenTime: make(map[string]int64),
+		positionStopLoss:      make(map[string]float64),
+		positionTakeProfit:    make(map[string]float64),
+		peakPnLCache:          make(map[string]float64),
+	}
+
+	// BTCUSDT_long was held last cycle but is gone on the exchange now
+	at.lastPositions["BTCUSDT_long"] = decision.PositionInfo{
+		Symbol: "BTCUSDT", Side: "long", EntryPrice: 50000.0, MarkPrice: 50100.0, Quantity: 0.1, Leverage: 10,
+	}
+	at.lastPositions["ETHUSDT_short"] = decision.PositionInfo{Symbol: "ETHUSDT", Side: "short", Quantity: 1.0}
+	at.positionFirstSeenTime["BTCUSDT_long"] = 1
+	at.positionFirstSeenTime["ETHUSDT_short"] = 2
+	at.positionStopLoss["BTCUSDT_long"] = 49000.0
+	// SOLUSDT_long leaked from an earlier cycle and never made it into lastPositions
+	at.positionFirstSeenTime["SOLUSDT_long"] = 3
+	at.peakPnLCache["SOLUSDT_long"] = 12.5
+	at.peakPnLCache["ETHUSDT_short"] = 4.0
+
+	record := &logger.DecisionRecord{}
+	at.reconcilePositions(record)
+
+	// Live position untouched
+	if _, exists := at.lastPositions["ETHUSDT_short"]; !exists {
+		t.Errorf("ETHUSDT_short should remain in lastPositions")
+	}
+	if _, exists := at.positionFirstSeenTime["ETHUSDT_short"]; !exists {
+		t.Errorf("ETHUSDT_short should remain in positionFirstSeenTime")
+	}
+	if _, exists := at.peakPnLCache["ETHUSDT_short"]; !exists {
+		t.Errorf("ETHUSDT_short should remain in peakPnLCache")
+	}
+
+	// Orphans removed
+	for _, key := range []string{"BTCUSDT_long", "SOLUSDT_long"} {
+		if _, exists := at.lastPositions[key]; exists {
+			t.Errorf("%s should be removed from lastPositions", key)
+		}
+		if _, exists := at.positionFirstSeenTime[key]; exists {
+			t.Errorf("%s should be removed from positionFirstSeenTime", key)
+		}
+		if _, exists := at.peakPnLCache[key]; exists {
+			t.Errorf("%s should be removed from peakPnLCache", key)
+		}
+	}
+	if _, exists := at.positionStopLoss["BTCUSDT_long"]; exists {
+		t.Errorf("BTCUSDT_long should be removed from positionStopLoss")
+	}
+
+	// BTCUSDT_long reported as a passive close, SOLUSDT_long as a reconciliation
+	if len(record.Decisions) != 2 {
+		t.Fatalf("Expected 2 actions, got %d: %+v", len(record.Decisions), record.Decisions)
+	}
+	actions := make(map[string]logger.DecisionAction)
+	for _, action := range record.Decisions {
+		actions[action.Symbol] = action
+	}
+	if actions["BTCUSDT"].Action != "auto_close_long" {
+		t.Errorf("Expected auto_close_long for BTCUSDT, got %s", actions["BTCUSDT"].Action)
+	}
+	reconciliation := actions["SOLUSDT"]
+	if reconciliation.Action != "reconciliation" {
+		t.Errorf("Expected reconciliation for SOLUSDT, got %s", reconciliation.Action)
+	}
+	if reconciliation.Error != "" || !strings.HasPrefix(reconciliation.Detail, "cleaned SOLUSDT_long:") {
+		t.Errorf("Expected cleanup details in Detail (not Error), got detail=%q error=%q", reconciliation.Detail, reconciliation.Error)
+	}
+}
+
+// TestReconcilePositions_PrefersStreamedFills tests that streamed fills are recorded with exact fill data
+// and that the snapshot-diff fallback does not duplicate them
+func TestReconcilePositions_PrefersStreamedFills(t *testing.T) {
+	at := &AutoTrader{
+		trader: &MockTrader{
+			positions: []map[string]interface{}{
+				{"symbol": "ETHUSDT", "side": "short", "positionAmt": -0.5},
+			},
+		},
+		config:                AutoTraderConfig{PostStopCooldown: 30 * time.Minute},
+		lastPositions:         make(map[string]decision.PositionInfo),
+		positionFirstSeenTime: make(map[string]int64),
+		positionStopLoss:      make(map[string]float64),
+		positionTakeProfit:    make(map[string]float64),
+		peakPnLCache:          make(map[string]float64),
+	}
+	at.lastPositions["BTCUSDT_long"] = decision.PositionInfo{
+		Symbol: "BTCUSDT", Side: "long", EntryPrice: 50000.0, MarkPrice: 50100.0, Quantity: 0.2, Leverage: 10, StopLoss: 49000.0,
+	}
+	at.lastPositions["ETHUSDT_short"] = decision.PositionInfo{Symbol: "ETHUSDT", Side: "short", Quantity: 1.0, Leverage: 5}
+
+	fillTime := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	// BTC stop-loss filled in two parts, ETH take-profit partially filled, plus fills that must be ignored
+	at.handleFill(FillEvent{Symbol: "BTCUSDT", Side: "long", OrderID: 7, Price: 48990.0, Quantity: 0.1, Commission: 1.0, IsClose: true, Reason: "stop_loss", Time: fillTime})
+	at.handleFill(FillEvent{Symbol: "BTCUSDT", Side: "long", OrderID: 7, Price: 48970.0, Quantity: 0.1, Commission: 2.0, IsClose: true, Reason: "stop_loss", Time: fillTime})
+	at.handleFill(FillEvent{Symbol: "ETHUSDT", Side: "short", OrderID: 8, Price: 2800.0, Quantity: 0.5, Commission: 0.5, IsClose: true, Reason: "take_profit", Time: fillTime})
+	at.handleFill(FillEvent{Symbol: "SOLUSDT", Side: "long", Price: 150.0, Quantity: 1, IsClose: true, Reason: "system"})
+	at.handleFill(FillEvent{Symbol: "SOLUSDT", Side: "long", Price: 150.0, Quantity: 1})
+
+	record := &logger.DecisionRecord{}
+	at.reconcilePositions(record)
+
+	if len(record.Decisions) != 2 {
+		t.Fatalf("Expected 2 actions (no snapshot-diff duplicate), got %d: %+v", len(record.Decisions), record.Decisions)
+	}
+
+	btc := record.Decisions[0]
+	if btc.Action != "auto_close_long" || btc.Symbol != "BTCUSDT" || btc.Error != "stop_loss" {
+		t.Errorf("Expected BTCUSDT auto_close_long stop_loss, got %+v", btc)
+	}
+	if math.Abs(btc.Quantity-0.2) > 1e-9 || math.Abs(btc.Price-48980.0) > 1e-9 || math.Abs(btc.Fee-3.0) > 1e-9 {
+		t.Errorf("Expected aggregated fill 0.2 @ 48980 fee 3, got %.4f @ %.4f fee %.4f", btc.Quantity, btc.Price, btc.Fee)
+	}
+	if btc.OrderID != 7 || !btc.Timestamp.Equal(fillTime) || btc.Leverage != 10 {
+		t.Errorf("Expected order 7 at fill time with leverage 10, got %+v", btc)
+	}
+	if closedAt := at.lastStopLossTime["BTCUSDT"]; !closedAt.Equal(fillTime) {
+		t.Errorf("Expected stop-loss cooldown to start at the fill time, got %v", closedAt)
+	}
+
+	eth := record.Decisions[1]
+	if eth.Action != "partial_close" || eth.Symbol != "ETHUSDT" || eth.Quantity != 0.5 || eth.Fee != 0.5 {
+		t.Errorf("Expected ETHUSDT partial_close of 0.5 with fee 0.5, got %+v", eth)
+	}
+
+	if fills := at.takePendingFills(); len(fills) != 0 {
+		t.Errorf("Expected pending fills to be drained, got %d", len(fills))
+	}
+}
+
+// TestReconcilePositions_ExchangeErrorKeepsState tests that nothing is cleaned when positions cannot be fetched
+func TestReconcilePositions_ExchangeErrorKeepsState(t *testing.T) {
+	at := &AutoTrader{
+		trader:                &MockTrader{shouldFailPositions: true},
+		lastPositions:         map[string]decision.PositionInfo{"BTCUSDT_long": {Symbol: "BTCUSDT", Side: "long"}},
+		positionFirstSeenTime: map[string]int64{"BTCUSDT_long": 1},
+		positionStopLoss:      make(map[string]float64),
+		positionTakeProfit:    make(map[string]float64),
+		peakPnLCache:          map[string]float64{"BTCUSDT_long": 5.0},
+	}
+
+	record := &logger.DecisionRecord{}
+	at.reconcilePositions(record)
+
+	if len(record.Decisions) != 0 {
+		t.Errorf("Expected no actions, got %d", len(record.Decisions))
+	}
+	if len(at.lastPositions) != 1 || len(at.positionFirstSeenTime) != 1 || len(at.peakPnLCache) != 1 {
+		t.Errorf("State should be kept when exchange positions are unavailable")
+	}
+}
+
+// TestPostStopCooldown_BlocksReentryAfterStopLoss tests that a stop-loss close blocks re-entry on the same symbol
+func TestPostStopCooldown_BlocksReentryAfterStopLoss(t *testing.T) {
+	at := &AutoTrader{
+		trader:        &MockTrader{},
+		config:        AutoTraderConfig{PostStopCooldown: 30 * time.Minute},
+		lastPositions: make(map[string]decision.PositionInfo),
+	}
+
+	// Previous cycle: BTC long near its stop-loss, ETH short near its take-profit
+	at.lastPositions["BTCUSDT_long"] = decision.PositionInfo{
+		Symbol: "BTCUSDT", Side: "long", EntryPrice: 50000.0, MarkPrice: 48950.0,
+		Quantity: 0.1, Leverage: 10, StopLoss: 49000.0, TakeProfit: 53000.0,
+	}
+	at.lastPositions["ETHUSDT_short"] = decision.PositionInfo{
+		Symbol: "ETHUSDT", Side: "short", EntryPrice: 3000.0, MarkPrice: 2805.0,
+		Quantity: 1, Leverage: 10, StopLoss: 3100.0, TakeProfit: 2800.0,
+	}
+
+	// Both positions disappear
+	at.generateAutoCloseActions(at.detectClosedPositions([]decision.PositionInfo{}))
+
+	// Opening BTC again is rejected during the cooldown
+	for _, action := range []string{"open_long", "open_short"} {
+		record := &logger.DecisionAction{}
+		err := at.executeDecisionWithRecord(&decision.Decision{Symbol: "BTCUSDT", Action: action}, record)
+		if err == nil || !strings.Contains(err.Error(), "冷却") {
+			t.Errorf("Expected cooldown error for %s BTCUSDT, got %v", action, err)
+		}
+	}
+
+	// Non-open actions on the cooled-down symbol are still allowed
+	if err := at.executeDecisionWithRecord(&decision.Decision{Symbol: "BTCUSDT", Action: "hold"}, &logger.DecisionAction{}); err != nil {
+		t.Errorf("Expected hold to be allowed during cooldown, got %v", err)
+	}
+
+	// Take-profit close does not start a cooldown
+	if remaining := at.stopLossCooldownRemaining("ETHUSDT"); remaining != 0 {
+		t.Errorf("Expected no cooldown for ETHUSDT after take-profit, got %v", remaining)
+	}
+
+	cooldowns := at.GetStopLossCooldowns()
+	if _, ok := cooldowns["BTCUSDT"]; !ok || len(cooldowns) != 1 {
+		t.Errorf("Expected only BTCUSDT in active cooldowns, got %v", cooldowns)
+	}
+	if _, ok := at.GetStatus()["stop_cooldowns"]; !ok {
+		t.Error("Expected GetStatus to include stop_cooldowns")
+	}
+}
+
+// TestPostStopCooldown_ExpiryAndDisabled tests cooldown expiry and the disabled (zero) config
+func TestPostStopCooldown_ExpiryAndDisabled(t *testing.T) {
+	at := &AutoTrader{config: AutoTraderConfig{PostStopCooldown: 30 * time.Minute}}
+
+	at.recordStopLoss("BTCUSDT", time.Now().Add(-31*time.Minute))
+	if remaining := at.stopLossCooldownRemaining("BTCUSDT"); remaining != 0 {
+		t.Errorf("Expected expired cooldown, got %v", remaining)
+	}
+	if cooldowns := at.GetStopLossCooldowns(); len(cooldowns) != 0 {
+		t.Errorf("Expected no active cooldowns, got %v", cooldowns)
+	}
+
+	at.recordStopLoss("BTCUSDT", time.Now())
+	at.config.PostStopCooldown = 0
+	if remaining := at.stopLossCooldownRemaining("BTCUSDT"); remaining != 0 {
+		t.Errorf("Expected no cooldown when disabled, got %v", remaining)
+	}
+}
+
+// TestPositionState_ConcurrentAccess tests that the drawdown monitor, the scan cycle's snapshot bookkeeping
+// and API getters can touch position state concurrently (run with -race)
+func TestPositionState_ConcurrentAccess(t *testing.T) {
+	at := &AutoTrader{
+		trader: &MockTrader{
+			positions: []map[string]interface{}{
+				{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.1, "entryPrice": 50000.0, "markPrice": 50100.0, "leverage": 10.0},
+				{"symbol": "ETHUSDT", "side": "short", "positionAmt": -1.0, "entryPrice": 3000.0, "markPrice": 2990.0, "leverage": 5.0},
+			},
+		},
+		lastPositions:         make(map[string]decision.PositionInfo),
+		positionFirstSeenTime: make(map[string]int64),
+		positionStopLoss:      make(map[string]float64),
+		positionTakeProfit:    make(map[string]float64),
+		peakPnLCache:          make(map[string]float64),
+		lastStopLossTime:      make(map[string]time.Time),
+	}
+	current := []decision.PositionInfo{
+		{Symbol: "BTCUSDT", Side: "long", EntryPrice: 50000.0, Quantity: 0.1, Leverage: 10},
+		{Symbol: "ETHUSDT", Side: "short", EntryPrice: 3000.0, Quantity: 1.0, Leverage: 5},
+	}
+
+	const iterations = 200
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			at.checkPositionDrawdown()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			at.updatePositionSnapshot(current)
+			at.reconcilePositions(&logger.DecisionRecord{})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			at.detectClosedPositions(current)
+			cache := at.GetPeakPnLCache()
+			cache["mutated"] = 1 // 返回的是副本，修改不影响内部缓存
+		}
+	}()
+	wg.Wait()
+
+	if _, exists := at.GetPeakPnLCache()["mutated"]; exists {
+		t.Errorf("GetPeakPnLCache should return a copy")
+	}
+	if len(at.detectClosedPositions(current)) != 0 {
+		t.Errorf("No position should be reported closed")
+	}
+}
@@ -1,20 +1,36 @@
 package trader
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"maps"
 	"math"
+	"math/rand/v2"
+	"nofx/clock"
 	"nofx/decision"
 	"nofx/logger"
+	"nofx/logging"
 	"nofx/market"
 	"nofx/mcp"
+	"nofx/metrics"
 	"nofx/pool"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// MaxAllowedLeverage 系统杠杆上限：交易员配置的杠杆和AI决策的杠杆都不会超过该值（<=0 表示不限制），可通过配置修改
+var MaxAllowedLeverage = 50
+
 // AutoTraderConfig 自动交易配置（简化版 - AI全权决策）
 type AutoTraderConfig struct {
 	// Trader标识
@@ -23,7 +39,7 @@ type AutoTraderConfig struct {
 	AIModel string // AI模型: "qwen" 或 "deepseek"
 
 	// 交易平台选择
-	Exchange string // "binance", "hyperliquid" 或 "aster"
+	Exchange string // "binance", "hyperliquid", "aster" 或 "bybit"
 
 	// 币安API配置
 	BinanceAPIKey    string
@@ -39,8 +55,17 @@ type AutoTraderConfig struct {
 	AsterSigner     string // Aster API钱包地址
 	AsterPrivateKey string // Aster API钱包私钥
 
+	// Bybit配置
+	BybitAPIKey    string
+	BybitSecretKey string
+	BybitTestnet   bool
+
 	CoinPoolAPIURL string
 
+	// OI Top信号源（开启且配置了URL时，持仓量增长Top币种并入候选币种，来源标记为 "oi_top"）
+	UseOITop    bool
+	OITopAPIURL string
+
 	// AI配置
 	UseQwen     bool
 	DeepSeekKey string
@@ -51,30 +76,129 @@ type AutoTraderConfig struct {
 	CustomAPIKey    string
 	CustomModelName string
 
+	// 备用AI配置（可选）：主模型重试耗尽后改用备用模型重试一次，为空表示不启用
+	FallbackAIModel   string // 备用模型 provider（deepseek/qwen/custom）
+	FallbackAPIKey    string
+	FallbackAPIURL    string
+	FallbackModelName string
+
+	// 影子AI配置（可选）：每个周期用同一上下文请求影子模型，决策只写入影子决策日志（shadow=true），从不执行，为空表示不启用
+	ShadowAIModel   string // 影子模型 provider（deepseek/qwen/custom）
+	ShadowAPIKey    string
+	ShadowAPIURL    string
+	ShadowModelName string
+
+	// AI采样参数（可选）：nil 使用客户端默认值（temperature 0.5，不发送 top_p），主备模型共用
+	AITemperature *float64
+	AITopP        *float64
+
+	// 策略标签（如prompt版本），写入决策记录用于按版本对比交易表现；为空时按模板和自定义prompt自动生成
+	StrategyTag string
+
 	// 扫描配置
-	ScanInterval time.Duration // 扫描间隔（建议3分钟）
+	ScanInterval      time.Duration // 扫描间隔（建议3分钟）
+	ScanJitterPercent int           // 扫描间隔随机抖动（±N%），错开多个交易员的决策周期，0表示不抖动
 
 	// 账户配置
 	InitialBalance float64 // 初始金额（用于计算盈亏，需手动设置）
 
 	// 杠杆配置
-	BTCETHLeverage  int // BTC和ETH的杠杆倍数
-	AltcoinLeverage int // 山寨币的杠杆倍数
+	BTCETHLeverage  int            // BTC和ETH的杠杆倍数
+	AltcoinLeverage int            // 山寨币的杠杆倍数
+	LeverageTiers   map[string]int // 杠杆分级（币种 -> 杠杆上限，default 为其余币种），配置后优先于上面两档
 
-	// 风险控制（仅作为提示，AI可自主决定）
-	MaxDailyLoss    float64       // 最大日亏损百分比（提示）
+	// 风险控制
+	MaxDailyLoss    float64       // 最大日亏损百分比（相对初始余额，当日UTC亏损超过后停止开新仓至次日，0=不限制）
 	MaxDrawdown     float64       // 最大回撤百分比（提示）
 	StopTradingTime time.Duration // 触发风控后暂停时长
 
 	// 仓位模式
 	IsCrossMargin bool // true=全仓模式, false=逐仓模式
 
+	// 按币种覆盖仓位模式（symbol -> cross/isolated），未覆盖的币种使用 IsCrossMargin
+	MarginModes map[string]string
+
+	// 持仓模式
+	HedgeMode bool // true=双向持仓（同币种多空可并存，仅币安支持）, false=单向持仓；构造时按此切换账户持仓模式
+
+	// 下单规则
+	AutoBumpMinNotional bool // 下单金额低于交易所最小名义价值时：true=上调数量到最小值, false=拒绝开仓
+
+	// 默认止损
+	DefaultStopLossPct float64 // 开仓决策未给出有效止损时，按入场价该百分比设置保护性止损（0=不设置）
+
+	// 被动平仓原因推断
+	CloseTolerancePct float64 // 标记价距止损/止盈价在该百分比以内时判定为对应原因，强平价容差为其两倍（0=默认1%）
+
+	// 最长持仓时间（从首次发现持仓开始计时），超过后由监控协程强制平仓，不论盈亏（0=不限制）
+	MaxHoldTime time.Duration
+
+	// 重复决策退避：某币种连续 RepeatDecisionLimit 个周期的决策完全相同（不含理由）时，
+	// 在 RepeatDecisionBackoff 内不再提交给AI、不执行其决策（Limit<=1 关闭，Backoff=0 默认15分钟）
+	RepeatDecisionLimit   int
+	RepeatDecisionBackoff time.Duration
+
+	// 单笔下单超时：交易所超过该时长未返回时按客户端订单ID撤单并返回超时错误（0=默认 defaultOrderTimeout）
+	OrderTimeout time.Duration
+
+	// 止损冷却
+	PostStopCooldown time.Duration // 止损平仓后同币种禁止开仓的时长（0=不限制）
+
+	// 持仓数量限制
+	MaxOpenPositions int // 最大同时持仓数（0=不限制），达到上限后拒绝开新仓，平仓/调整不受影响
+
+	// 零头持仓：名义价值低于该值（USDT）的持仓视为零头（见 dust.go），0=使用交易所该币种的最小名义价值
+	DustThresholdUSD float64
+
+	// 单币种仓位上限：开仓保证金占当前净值的比例（百分比，0=不限制），超限时 ClampPositionSize=true 缩减到上限，否则拒绝开仓
+	MaxPositionPct    float64
+	ClampPositionSize bool
+
+	// 市场状态（BTC 4小时）处于极端波动时是否仍允许开新仓（默认拒绝开新仓，平仓/调整不受影响）
+	AllowHighVolOpens bool
+
+	// 点差保护：开仓/加仓前最优买卖价差超过阈值（基点，0=不检查）时跳过，平仓不检查（仅币安提供盘口）
+	BTCETHMaxSpreadBps  float64 // BTC/ETH 的点差上限
+	AltcoinMaxSpreadBps float64 // 山寨币的点差上限
+
+	// 无持仓时的AI调用预过滤：开启后，无持仓且候选币种都没有触发条件时跳过本周期AI调用，记录一条 hold 决策
+	SkipAIWithoutTrigger bool
+	TriggerPriceMovePct  float64 // 1小时涨跌幅绝对值达到该值（%）视为触发（0=DefaultTriggerPriceMovePct）
+	TriggerVolumeSpike   float64 // 最新3分钟成交量达到此前均量的倍数视为触发（0=DefaultTriggerVolumeSpike）
+
+	// 共识开仓：开启后用同一上下文再请求一次AI，两次对同一币种给出相同开仓方向时才开仓，平仓和调整仍按第一次决策执行
+	ConsensusOpens bool
+
+	// 空决策重试：开启后，有持仓且AI返回空决策数组（可能输出被截断）时用同一上下文重新请求一次
+	RetryEmptyDecision bool
+
+	// 初始余额基准定时重置：RebaselineDaily / RebaselineWeekly（空=不自动重置，仍可通过 ReBaseline 手动重置）
+	RebaselineSchedule string
+
+	// 日界时区（IANA名称，如 Asia/Shanghai）：日盈亏重置、日亏损熔断截止和定时重置基准按该时区的0点计算（空或无效=UTC）
+	Timezone string
+
+	// 相关性敞口限制
+	MaxCorrelatedExposure float64 // 相关性调整后的总敞口上限（净值倍数，0=不限制），开仓后超过上限则拒绝
+
+	// 币种黑名单
+	BlacklistSymbols []string // 禁止开仓的币种（无论是否在候选列表中），平仓/调整不受影响
+
+	// 参考币种：始终获取行情放入交易上下文（如BTC/ETH，供AI判断大盘方向），不在候选列表中时只作参考，不可开仓
+	AlwaysContextSymbols []string
+
 	// 币种配置
 	DefaultCoins []string // 默认币种列表（从数据库获取）
 	TradingCoins []string // 实际交易币种列表
 
 	// 系统提示词模板
 	SystemPromptTemplate string // 系统提示词模板名称（如 "default", "aggressive"）
+
+	// 事件回调（由管理器在构造时注入，用于推送启动/停止/开平仓/熔断等状态变化），须非阻塞
+	OnEvent func(Event)
+
+	// 时间源（nil 使用系统时间，测试中注入 clock.Fake）
+	Clock clock.Clock
 }
 
 // AutoTrader 自动交易器
@@ -86,6 +210,13 @@ type AutoTrader struct {
 	config                AutoTraderConfig
 	trader                Trader // 使用Trader接口（支持多平台）
 	mcpClient             mcp.AIClient
+	fallbackClient        mcp.AIClient // 备用AI客户端（首次需要时创建，之后复用）
+	fallbackOnce          sync.Once
+	shadowClient          mcp.AIClient           // 影子AI客户端（首次需要时创建，之后复用）
+	shadowLogger          logger.IDecisionLogger // 影子决策日志记录器（decision_logs/<id>/shadow，只写文件）
+	shadowOnce            sync.Once
+	shadowRunning         atomic.Bool            // 影子决策请求进行中（上一次未返回时跳过本周期）
+	shadowWG              sync.WaitGroup         // 进行中的影子决策请求
 	decisionLogger        logger.IDecisionLogger // 决策日志记录器
 	initialBalance        float64
 	dailyPnL              float64
@@ -95,8 +226,9 @@ type AutoTrader struct {
 	defaultCoins          []string // 默认币种列表（从数据库获取）
 	tradingCoins          []string // 实际交易币种列表
 	lastResetTime         time.Time
+	lastRebaselineTime    time.Time // 最近一次重置初始余额基准的时间（受 dailyLossMutex 保护）
 	stopUntil             time.Time
-	isRunning             bool
+	isRunning             atomic.Bool                      // 主循环应继续运行（Stop 置为 false）
 	startTime             time.Time          // 系统启动时间
 	callCount             int                // AI调用次数
 	positionFirstSeenTime map[string]int64                 // 持仓首次出现时间 (symbol_side -> timestamp毫秒)
@@ -104,12 +236,61 @@ type AutoTrader struct {
 	positionStopLoss      map[string]float64               // 持仓止损价格 (symbol_side -> stop_loss_price)
 	positionTakeProfit    map[string]float64               // 持仓止盈价格 (symbol_side -> take_profit_price)
 	stopMonitorCh         chan struct{}                    // 用于停止监控goroutine
-	monitorWg             sync.WaitGroup                   // 用于等待监控goroutine结束
+	monitorWg             *sync.WaitGroup                  // 用于等待本次运行的主循环和监控goroutine结束（每次 Run 新建，重新启动不影响仍在等待旧循环的调用方）
 	peakPnLCache          map[string]float64               // 最高收益缓存 (symbol -> 峰值盈亏百分比)
 	peakPnLCacheMutex     sync.RWMutex                     // 缓存读写锁
 	lastBalanceSyncTime   time.Time                        // 上次余额同步时间
 	database              interface{}                      // 数据库引用（用于自动更新余额）
 	userID                string                           // 用户ID
+	slogger               *slog.Logger                     // 结构化日志（携带 trader_id/user_id/exchange 字段，见 traderLogger）
+	tokenUsage            mcp.Usage                        // 累计AI token用量
+	pendingActions        []logger.DecisionAction          // 执行决策时产生的附加动作（如分批止盈挂单），由 runCycle 写入决策记录
+	tokenUsageMutex       sync.Mutex                       // token用量锁（GetStatus 可能被API并发调用）
+	positionMutex         sync.Mutex                       // 持仓操作锁（周期内执行决策、回撤平仓与手动一键平仓互斥）
+	positionStateMutex    sync.RWMutex                     // 持仓状态锁（保护 positionFirstSeenTime / lastPositions / positionStopLoss / positionTakeProfit / consecutiveLosses）
+	lastStopLossTime      map[string]time.Time             // 最近一次止损平仓时间 (symbol -> time)，用于止损冷却
+	stopLossTimeMutex     sync.RWMutex                     // 止损时间锁（GetStatus 可能被API并发调用）
+	dayStartEquity        float64                          // 当日（UTC）起始净值，用于计算当日已实现+未实现盈亏
+	tradingHaltedUntil    time.Time                        // 日亏损熔断后禁止开新仓的截止时间（次日UTC 0点）
+	dailyLossMutex        sync.RWMutex                     // 日盈亏状态锁（保护 dailyPnL / dayStartEquity / tradingHaltedUntil / lastResetTime / initialBalance）
+	fillStreamer          FillStreamer                     // 已启动的成交推送（nil 表示仅靠持仓快照对比检测被动平仓）
+	pendingFills          []FillEvent                      // 成交推送收到的被动平仓成交，由 reconcilePositions 写入决策记录
+	fillMutex             sync.Mutex                       // 成交推送锁（推送goroutine写入，交易周期读取）
+	poolSymbols           map[string]bool                  // 最近一次从合并币种池获取的候选币种（未配置自定义/默认币种时作为允许开仓范围）
+	oiTopSymbols          map[string]bool                  // 最近一次从交易员OI Top信号源并入的候选币种（同样允许开仓）
+	correlationSummary    market.CorrelationSummary        // 最近一次周期的持仓相关性摘要
+	correlationMutex      sync.RWMutex                     // 相关性摘要锁（GetStatus 可能被API并发调用）
+	marketRegime          market.MarketRegime               // 最近一次周期判断的市场状态（BTC 4小时，获取失败时为空）
+	marketRegimeMutex     sync.RWMutex                      // 市场状态锁（GetStatus 可能被API并发调用）
+	submittedOrders       map[string]map[string]interface{} // 本周期已成功提交的订单 (clientOrderID -> 订单结果)，周期内重复执行同一决策时不重复下单
+	submittedOrdersCycle  int                              // submittedOrders 所属的周期编号
+	submittedOrdersMutex  sync.Mutex                       // 已提交订单锁
+	orderIDSeed           int64                            // 客户端订单ID种子（进程重启后周期编号重新计数，避免与上次运行的订单ID重复；热重载时沿用）
+	marginModeSet         map[string]bool                  // 已成功设置的仓位模式 (symbol -> 是否全仓)，避免重复设置（受 positionMutex 保护）
+	clock                 clock.Clock                      // 时间源（nil 使用系统时间）
+	consecutiveLosses     int                              // 连续亏损平仓次数（盈利平仓后清零）
+	recentDecisions       map[string][][sha256.Size]byte   // 各币种最近几个周期的决策指纹（见 repeated_decisions.go）
+	repeatBackoffUntil    map[string]time.Time             // 因连续重复决策暂停的币种及截止时间
+	repeatMutex           sync.Mutex                       // 重复决策状态锁
+	protectivePairs       map[string]protectivePair        // 开仓时挂出的止损止盈配对 (posKey -> 配对)，持仓消失后撤销残留的一方（受 positionStateMutex 保护）
+	positionLeverage      map[string]int                   // 本交易员开仓时使用的杠杆 (posKey -> 杠杆)，用于检测持仓杠杆被手动修改（受 positionStateMutex 保护）
+	driftWarnings         map[string]string                // 已告警的杠杆/仓位模式偏离 (symbol -> 告警内容)，相同偏离不重复告警（受 positionMutex 保护）
+	loopActive            atomic.Bool                      // 主循环执行中（Stop 等待超时后仍为 true，直到当前周期结束、主循环退出）
+	disabled              atomic.Bool                      // 紧急停用（见 kill_switch.go）
+	exposureGuard         ExposureGuard                    // 跨交易员的账户保证金协调（见 exposure_guard.go，nil 表示不检查）
+	skippedAICalls        atomic.Int64                     // 无持仓且无触发条件而跳过AI调用的周期数
+	manualHolds           map[string]string                // 手动持仓标记 (symbol -> 备注)，自动风控动作跳过这些币种（见 manual_hold.go）
+	manualHoldMutex       sync.RWMutex                     // 手动持仓标记锁（API 并发修改）
+	batchReserved         openReservation                  // 批量开仓中已通过校验、尚未下单的仓位（见 batch_orders.go，受 positionMutex 保护）
+	fundingHistory        *fundingHistoryCache             // 交易所资金费流水缓存（见 pnl_breakdown.go）
+	fundingHistoryMutex   sync.Mutex                       // 资金费流水缓存锁（API 和交易周期并发读取持仓）
+	location              *time.Location                   // 日界时区（见 timezone.go，nil 表示UTC）
+}
+
+// protectivePair 开仓时成对挂出的止损单和止盈单
+type protectivePair struct {
+	Group  string // 配对ID，记录在止损、止盈动作的 OCOGroup 中
+	Native bool   // 交易所联动挂单（OCOTrader），一方成交后由交易所撤销另一方
 }
 
 // NewAutoTrader 创建自动交易器
@@ -129,6 +310,15 @@ func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string)
 		}
 	}
 
+	// 设置默认系统提示词模板，并校验模板名称（拼写错误不再静默回退到 default）
+	systemPromptTemplate := config.SystemPromptTemplate
+	if systemPromptTemplate == "" {
+		systemPromptTemplate = "default"
+	}
+	if err := decision.ValidatePromptTemplate(systemPromptTemplate); err != nil {
+		return nil, err
+	}
+
 	mcpClient := mcp.New()
 
 	// 初始化AI
@@ -156,6 +346,19 @@ func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string)
 		}
 	}
 
+	mcpClient.SetSampling(config.AITemperature, config.AITopP)
+	// 同一AI端点的交易员共享熔断器：服务宕机时快速失败，配置了备用模型时直接切换
+	mcpClient = mcp.WithCircuitBreaker(mcpClient)
+
+	// 杠杆安全上限：误配的过高杠杆（如125x）截断到系统上限
+	clampConfigLeverage(&config)
+
+	location, tzErr := resolveTimezone(config.Timezone)
+	if tzErr != nil {
+		log.Printf("⚠️ [%s] 无效的时区 %q，日界按UTC计算: %v", config.Name, config.Timezone, tzErr)
+		location = time.UTC
+	}
+
 	// 初始化币种池API
 	if config.CoinPoolAPIURL != "" {
 		pool.SetCoinPoolAPI(config.CoinPoolAPIURL)
@@ -176,6 +379,15 @@ func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string)
 		marginModeStr = "逐仓"
 	}
 	log.Printf("📊 [%s] 仓位模式: %s", config.Name, marginModeStr)
+	if len(config.MarginModes) > 0 {
+		log.Printf("📊 [%s] 按币种覆盖仓位模式: %v", config.Name, config.MarginModes)
+	}
+
+	// 双向持仓仅币安支持（Hyperliquid/Aster/Bybit 为单向净持仓）
+	if config.HedgeMode && config.Exchange != "binance" {
+		log.Printf("⚠️ [%s] %s 不支持双向持仓模式，已回退为单向持仓", config.Name, config.Exchange)
+		config.HedgeMode = false
+	}
 
 	switch config.Exchange {
 	case "binance":
@@ -193,25 +405,41 @@ func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string)
 		if err != nil {
 			return nil, fmt.Errorf("初始化Aster交易器失败: %w", err)
 		}
+	case "bybit":
+		log.Printf("🏦 [%s] 使用Bybit合约交易", config.Name)
+		trader = NewBybitTrader(config.BybitAPIKey, config.BybitSecretKey, config.BybitTestnet)
 	default:
 		return nil, fmt.Errorf("不支持的交易平台: %s", config.Exchange)
 	}
 
+	// 按 HedgeMode 切换账户持仓模式，切换失败（有持仓或挂单）时按账户实际模式运行，避免配置与交易所不一致
+	if modeTrader, ok := trader.(PositionModeTrader); ok {
+		dualSide, err := modeTrader.SetPositionMode(config.HedgeMode)
+		if err != nil {
+			log.Printf("⚠️ [%s] %v", config.Name, err)
+		}
+		if dualSide != config.HedgeMode {
+			log.Printf("⚠️ [%s] 账户实际持仓模式与配置不一致，按账户实际模式运行（双向持仓: %v）", config.Name, dualSide)
+			config.HedgeMode = dualSide
+		}
+	}
+	if config.HedgeMode {
+		log.Printf("📊 [%s] 持仓模式: 双向持仓（允许同币种多空并存）", config.Name)
+	}
+
 	// 验证初始金额配置
 	if config.InitialBalance <= 0 {
 		return nil, fmt.Errorf("初始金额必须大于0，请在配置中设置InitialBalance")
 	}
 
-	// 初始化决策日志记录器（使用trader ID创建独立目录）
+	// 初始化决策日志记录器（使用trader ID创建独立目录，按配置同时或只写入数据库）
 	logDir := fmt.Sprintf("decision_logs/%s", config.ID)
-	decisionLogger := logger.NewDecisionLogger(logDir)
+	recordStore, _ := database.(logger.RecordStore)
+	decisionLogger := logger.NewDecisionLoggerWithStore(logDir, logger.DecisionLogSink, recordStore, userID, config.ID)
+	mcpClient.SetDebugLogDir(logDir) // AI调试日志与决策日志放在同一目录
+	slogger := newTraderLogger(config.ID, userID, config.Exchange)
+	mcpClient.SetLogger(slogger)
 
-	// 设置默认系统提示词模板
-	systemPromptTemplate := config.SystemPromptTemplate
-	if systemPromptTemplate == "" {
-		// feature/partial-close-dynamic-tpsl 分支默认使用 adaptive（支持动态止盈止损）
-		systemPromptTemplate = "adaptive"
-	}
 
 	return &AutoTrader{
 		id:                    config.ID,
@@ -226,31 +454,50 @@ func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string)
 		systemPromptTemplate:  systemPromptTemplate,
 		defaultCoins:          config.DefaultCoins,
 		tradingCoins:          config.TradingCoins,
-		lastResetTime:         time.Now(),
-		startTime:             time.Now(),
+		location:              location,
+		lastResetTime:         clock.Or(config.Clock).Now(),
+		lastRebaselineTime:    clock.Or(config.Clock).Now(),
+		startTime:             clock.Or(config.Clock).Now(),
 		callCount:             0,
-		isRunning:             false,
 		positionFirstSeenTime: make(map[string]int64),
 		lastPositions:         make(map[string]decision.PositionInfo),
 		positionStopLoss:      make(map[string]float64),
 		positionTakeProfit:    make(map[string]float64),
 		stopMonitorCh:         make(chan struct{}),
-		monitorWg:             sync.WaitGroup{},
+		monitorWg:             &sync.WaitGroup{},
 		peakPnLCache:          make(map[string]float64),
 		peakPnLCacheMutex:     sync.RWMutex{},
-		lastBalanceSyncTime:   time.Now(), // 初始化为当前时间
+		lastStopLossTime:      make(map[string]time.Time),
+		lastBalanceSyncTime:   clock.Or(config.Clock).Now(), // 初始化为当前时间
+		orderIDSeed:           time.Now().UnixNano(),
+		clock:                 config.Clock,
 		database:              database,
 		userID:                userID,
+		slogger:               slogger,
 	}, nil
 }
 
+// ErrLoopStillActive 上一次启动的主循环尚未退出（停止时等待当前周期超时，周期仍在执行）
+var ErrLoopStillActive = errors.New("上一次启动的主循环尚未退出")
+
 // Run 运行自动交易主循环
+// 同一实例同时只允许一个主循环：停止等待超时后立即重新启动时，旧主循环的周期仍在执行，
+// 再启动一个主循环会让两个周期并发下单和读写持仓状态，此时返回 ErrLoopStillActive
 func (at *AutoTrader) Run() error {
-	at.isRunning = true
+	if at.IsDisabled() {
+		return fmt.Errorf("%w: %s", ErrTraderDisabled, at.name)
+	}
+	if !at.loopActive.CompareAndSwap(false, true) {
+		return fmt.Errorf("%w: %s", ErrLoopStillActive, at.name)
+	}
+	defer at.loopActive.Store(false)
+	at.isRunning.Store(true)
 	at.stopMonitorCh = make(chan struct{})
-	at.startTime = time.Now()
+	at.monitorWg = &sync.WaitGroup{}
+	at.startTime = at.now()
 
 	log.Println("🚀 AI驱动自动交易系统启动")
+	at.emit(EventStarted, nil)
 	log.Printf("💰 初始余额: %.2f USDT", at.initialBalance)
 	log.Printf("⚙️  扫描间隔: %v", at.config.ScanInterval)
 	log.Println("🤖 AI将全权决定杠杆、仓位大小、止损止盈等参数")
@@ -260,20 +507,28 @@ func (at *AutoTrader) Run() error {
 	// 启动回撤监控
 	at.startDrawdownMonitor()
 
-	ticker := time.NewTicker(at.config.ScanInterval)
-	defer ticker.Stop()
+	// 启动成交推送（交易所支持时）
+	at.startFillStream()
+
+	// 等待候选币种K线缓存预热，避免首个周期因数据未初始化失败
+	at.waitForKlineWarmup()
 
-	// 首次立即执行
-	if err := at.runCycle(); err != nil {
-		log.Printf("❌ 执行失败: %v", err)
+	// 启用抖动时首个周期在扫描间隔内随机延迟执行，否则立即执行
+	firstDelay := time.Duration(0)
+	if at.config.ScanJitterPercent > 0 && at.config.ScanInterval > 0 {
+		firstDelay = time.Duration(rand.Int64N(int64(at.config.ScanInterval)))
+		log.Printf("⏳ [%s] 首个决策周期将在 %v 后执行", at.name, firstDelay.Round(time.Second))
 	}
+	timer := time.NewTimer(firstDelay)
+	defer timer.Stop()
 
-	for at.isRunning {
+	for at.isRunning.Load() {
 		select {
-		case <-ticker.C:
+		case <-timer.C:
 			if err := at.runCycle(); err != nil {
 				log.Printf("❌ 执行失败: %v", err)
 			}
+			timer.Reset(jitteredInterval(at.config.ScanInterval, at.config.ScanJitterPercent))
 		case <-at.stopMonitorCh:
 			log.Printf("[%s] ⏹ 收到停止信号，退出自动交易主循环", at.name)
 			return nil
@@ -283,35 +538,289 @@ func (at *AutoTrader) Run() error {
 	return nil
 }
 
+// requestDecision 请求AI决策，主模型调用失败（重试耗尽）且配置了备用模型时改用备用模型重试一次
+// 返回实际产生决策的模型标识
+func (at *AutoTrader) requestDecision(ctx *decision.Context) (*decision.FullDecision, string, error) {
+	primaryModel := aiModelLabel(at.aiModel, at.config.CustomModelName)
+	fullDecision, err := decision.GetFullDecisionWithCustomPrompt(ctx, at.mcpClient, at.customPrompt, at.overrideBasePrompt, at.systemPromptTemplate)
+	if fullDecision != nil || errors.Is(err, decision.ErrAICallFailed) {
+		// 行情数据已拉取成功，影子模型复用同一上下文异步决策（不影响主模型的执行）
+		at.startShadowDecision(ctx)
+	}
+	if err == nil || !errors.Is(err, decision.ErrAICallFailed) {
+		return fullDecision, primaryModel, err
+	}
+	metrics.AICallErrors.WithLabelValues(at.id, at.exchange).Inc()
+
+	fallbackClient := at.getFallbackClient()
+	if fallbackClient == nil {
+		return fullDecision, primaryModel, err
+	}
+
+	fallbackModel := aiModelLabel(at.config.FallbackAIModel, at.config.FallbackModelName)
+	at.cycleLogger().Warn("⚠️ 主模型调用失败，改用备用模型", "primary_model", primaryModel, "fallback_model", fallbackModel, "error", err)
+
+	// 行情数据已在主模型请求时拉取，直接复用
+	fallbackDecision, fallbackErr := decision.GetFullDecisionFromMarketData(ctx, fallbackClient, at.customPrompt, at.overrideBasePrompt, at.systemPromptTemplate)
+	if fallbackErr != nil && errors.Is(fallbackErr, decision.ErrAICallFailed) {
+		metrics.AICallErrors.WithLabelValues(at.id, at.exchange).Inc()
+		at.cycleLogger().Error("❌ 备用模型调用失败", "fallback_model", fallbackModel, "error", fallbackErr)
+		return nil, fallbackModel, fmt.Errorf("主模型 %s 与备用模型 %s 均调用失败: %w", primaryModel, fallbackModel, fallbackErr)
+	}
+	return fallbackDecision, fallbackModel, fallbackErr
+}
+
+// PreviewPrompt 按实盘周期的方式构建交易上下文并渲染提示词，不调用AI、不下单、不写决策日志
+// 用于调试自定义prompt（override_base_prompt 与追加模式）和确认行情数据是否完整；
+// 只读取加锁保护的状态，可在交易员运行中并发调用
+func (at *AutoTrader) PreviewPrompt() (systemPrompt, userPrompt string, err error) {
+	ctx, err := at.buildTradingContext()
+	if err != nil {
+		return "", "", fmt.Errorf("构建交易上下文失败: %w", err)
+	}
+	ctx.CallCount++ // 实盘周期在构建上下文前递增，预览的是下一个周期
+	return decision.BuildPrompts(ctx, at.customPrompt, at.overrideBasePrompt, at.systemPromptTemplate)
+}
+
+// DecisionCheck 单条决策的执行前校验结果
+type DecisionCheck struct {
+	Decision decision.Decision `json:"decision"`
+	Valid    bool              `json:"valid"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// DecisionValidation 一段AI原始响应的解析和校验结果
+type DecisionValidation struct {
+	CoTTrace      string          `json:"cot_trace"`
+	ParseError    string          `json:"parse_error,omitempty"`    // 解析失败原因（实盘周期遇到该错误时整个周期不执行任何决策）
+	SchemaWarning string          `json:"schema_warning,omitempty"` // 决策格式版本缺失或不匹配（按当前版本尽力解析）
+	Decisions     []DecisionCheck `json:"decisions"`                // 按执行顺序（先平仓后开仓）排列
+	Dropped       []string        `json:"dropped,omitempty"`        // 去重时丢弃的决策
+}
+
+// ValidateDecisionResponse 按实盘周期的流程处理一段AI原始响应：解析（含解析时的风控校验）、排序去重，
+// 再用交易员配置逐条执行前校验；不调用AI、不拉取行情、不下单、不写决策日志。
+// accountEquity<=0 时按初始余额校验仓位上限；解析失败时已提取出的决策仍会逐条校验
+func (at *AutoTrader) ValidateDecisionResponse(raw string, accountEquity float64) *DecisionValidation {
+	if accountEquity <= 0 {
+		accountEquity = at.getInitialBalance()
+	}
+	cfg := at.validationConfig()
+	fullDecision, err := decision.ParseResponse(raw, accountEquity, cfg)
+
+	result := &DecisionValidation{Decisions: []DecisionCheck{}}
+	if err != nil {
+		result.ParseError = fmt.Sprintf("解析AI响应失败: %v", err)
+	}
+	if fullDecision == nil {
+		return result
+	}
+	result.CoTTrace = fullDecision.CoTTrace
+	result.SchemaWarning = fullDecision.SchemaWarning
+
+	decisions, dropped := dedupeDecisions(sortDecisionsByPriority(fullDecision.Decisions))
+	result.Dropped = dropped
+	for _, d := range decisions {
+		check := DecisionCheck{Decision: d, Valid: true}
+		if err := d.Validate(cfg); err != nil {
+			check.Valid = false
+			check.Error = fmt.Sprintf("无效决策: %v", err)
+		}
+		result.Decisions = append(result.Decisions, check)
+	}
+	return result
+}
+
+// getFallbackClient 获取备用AI客户端（未配置时返回 nil），首次调用时创建
+func (at *AutoTrader) getFallbackClient() mcp.AIClient {
+	if at.config.FallbackAIModel == "" {
+		return nil
+	}
+	at.fallbackOnce.Do(func() {
+		at.fallbackClient = newAIClient(at.config.FallbackAIModel, at.config.FallbackAPIKey, at.config.FallbackAPIURL, at.config.FallbackModelName)
+		at.fallbackClient.SetSampling(at.config.AITemperature, at.config.AITopP)
+		at.fallbackClient.SetDebugLogDir(fmt.Sprintf("decision_logs/%s", at.id))
+		at.fallbackClient.SetLogger(at.traderLogger())
+		log.Printf("🤖 [%s] 已创建备用AI客户端: %s", at.name, aiModelLabel(at.config.FallbackAIModel, at.config.FallbackModelName))
+	})
+	return at.fallbackClient
+}
+
+// newTraderLogger 创建携带交易员字段的结构化日志
+func newTraderLogger(traderID, userID, exchange string) *slog.Logger {
+	return logging.Logger().With(logging.KeyTraderID, traderID, logging.KeyUserID, userID, logging.KeyExchange, exchange)
+}
+
+// traderLogger 交易员的结构化日志（未通过 NewAutoTrader 创建时按当前字段临时生成）
+func (at *AutoTrader) traderLogger() *slog.Logger {
+	if at.slogger == nil {
+		return newTraderLogger(at.id, at.userID, at.exchange)
+	}
+	return at.slogger
+}
+
+// cycleLogger 附带当前决策周期编号的结构化日志（交易执行和AI调用路径使用）
+func (at *AutoTrader) cycleLogger() *slog.Logger {
+	return at.traderLogger().With(logging.KeyCycle, at.callCount)
+}
+
+// newAIClient 按 provider 创建AI客户端（deepseek/qwen/custom）
+func newAIClient(provider, apiKey, customURL, customModel string) mcp.AIClient {
+	var client mcp.AIClient
+	switch provider {
+	case "qwen":
+		client = mcp.NewQwenClient()
+	case "deepseek":
+		client = mcp.NewDeepSeekClient()
+	default:
+		client = mcp.New()
+	}
+	client.SetAPIKey(apiKey, customURL, customModel)
+	return mcp.WithCircuitBreaker(client)
+}
+
+// aiModelLabel 模型标识：provider，指定了模型名时附加模型名（用于决策日志归因）
+func aiModelLabel(provider, modelName string) string {
+	if modelName == "" {
+		return provider
+	}
+	return provider + "/" + modelName
+}
+
+// jitteredInterval 在扫描间隔上加 ±percent% 的随机抖动，平均间隔不变
+func jitteredInterval(interval time.Duration, percent int) time.Duration {
+	if percent <= 0 || interval <= 0 {
+		return interval
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	maxJitter := float64(interval) * float64(percent) / 100
+	return interval + time.Duration((rand.Float64()*2-1)*maxJitter)
+}
+
 // Stop 停止自动交易
-func (at *AutoTrader) Stop() {
-	if !at.isRunning {
-		return
+// 会阻塞直到正在执行的决策周期（包括止损止盈下单和决策日志写入）完成，
+// 或 ctx 到期；返回前会刷新决策日志，保证不会留下写了一半的记录
+func (at *AutoTrader) Stop(ctx context.Context) error {
+	if !at.isRunning.CompareAndSwap(true, false) {
+		return nil
+	}
+	close(at.stopMonitorCh) // 通知主循环和监控goroutine停止
+
+	// 等待主循环（当前周期）和监控goroutine结束
+	var err error
+	select {
+	case <-at.loopDone():
+	case <-ctx.Done():
+		err = ctx.Err()
+		log.Printf("⚠️  [%s] 等待当前周期结束超时: %v", at.name, err)
+	}
+
+	at.stopFillStream()
+
+	if flushErr := at.decisionLogger.Flush(); flushErr != nil {
+		log.Printf("⚠️  [%s] 刷新决策日志失败: %v", at.name, flushErr)
 	}
-	at.isRunning = false
-	close(at.stopMonitorCh) // 通知监控goroutine停止
-	at.monitorWg.Wait()     // 等待监控goroutine结束
+
 	log.Println("⏹ 自动交易系统停止")
+	at.emit(EventStopped, nil)
+	return err
+}
+
+// WaitStopped 等待主循环和监控goroutine退出（Stop 等待超时后，仍在执行的周期结束时返回），或 ctx 到期
+func (at *AutoTrader) WaitStopped(ctx context.Context) error {
+	select {
+	case <-at.loopDone():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loopDone 返回本次运行的主循环和监控goroutine全部结束时关闭的 channel（从未运行过时立即关闭）
+func (at *AutoTrader) loopDone() <-chan struct{} {
+	done := make(chan struct{})
+	wg := at.monitorWg
+	go func() {
+		if wg != nil {
+			wg.Wait()
+		}
+		close(done)
+	}()
+	return done
+}
+
+// TakeOverFrom 热重载时从旧实例接管运行时状态：周期计数与订单ID种子、持仓跟踪（首次出现时间/快照/止损止盈价）、
+// 峰值盈亏缓存、止损冷却、日盈亏熔断和token用量。旧实例须已停止；会等待其正在进行的持仓操作
+// （回撤平仓、手动一键平仓）结束后再复制，避免接管到平了一半的持仓状态
+func (at *AutoTrader) TakeOverFrom(old *AutoTrader) {
+	old.positionMutex.Lock()
+	defer old.positionMutex.Unlock()
+
+	at.callCount = old.callCount
+	at.orderIDSeed = old.orderIDSeed
+	old.submittedOrdersMutex.Lock()
+	at.submittedOrders = old.submittedOrders
+	at.submittedOrdersCycle = old.submittedOrdersCycle
+	old.submittedOrdersMutex.Unlock()
+
+	old.positionStateMutex.RLock()
+	at.positionFirstSeenTime = maps.Clone(old.positionFirstSeenTime)
+	at.lastPositions = maps.Clone(old.lastPositions)
+	at.positionStopLoss = maps.Clone(old.positionStopLoss)
+	at.positionTakeProfit = maps.Clone(old.positionTakeProfit)
+	at.protectivePairs = maps.Clone(old.protectivePairs)
+	at.positionLeverage = maps.Clone(old.positionLeverage)
+	old.positionStateMutex.RUnlock()
+
+	old.peakPnLCacheMutex.RLock()
+	at.peakPnLCache = maps.Clone(old.peakPnLCache)
+	old.peakPnLCacheMutex.RUnlock()
+
+	old.stopLossTimeMutex.RLock()
+	at.lastStopLossTime = maps.Clone(old.lastStopLossTime)
+	old.stopLossTimeMutex.RUnlock()
+
+	old.dailyLossMutex.RLock()
+	at.dailyPnL = old.dailyPnL
+	at.dayStartEquity = old.dayStartEquity
+	at.tradingHaltedUntil = old.tradingHaltedUntil
+	at.lastResetTime = old.lastResetTime
+	at.lastRebaselineTime = old.lastRebaselineTime
+	old.dailyLossMutex.RUnlock()
+
+	at.stopUntil = old.stopUntil
+	at.tokenUsage = old.GetTokenUsage()
 }
 
 // runCycle 运行一个交易周期（使用AI全权决策）
 func (at *AutoTrader) runCycle() error {
+	if at.IsDisabled() {
+		return fmt.Errorf("%w，跳过决策周期", ErrTraderDisabled)
+	}
 	at.callCount++
 
 	log.Print("\n" + strings.Repeat("=", 70) + "\n")
-	log.Printf("⏰ %s - AI决策周期 #%d", time.Now().Format("2006-01-02 15:04:05"), at.callCount)
+	log.Printf("⏰ %s - AI决策周期 #%d", at.now().Format("2006-01-02 15:04:05"), at.callCount)
 	log.Println(strings.Repeat("=", 70))
 
 	// 创建决策记录
 	record := &logger.DecisionRecord{
 		Exchange:     at.config.Exchange, // 记录交易所类型，用于计算手续费
+		StrategyTag:  at.StrategyTag(),
 		ExecutionLog: []string{},
 		Success:      true,
 	}
 
+	// 0. 对账：以交易所持仓为准，检测被动平仓并清理内部缓存（必须在构建上下文前执行，保证AI看到准确状态）
+	at.reconcilePositions(record)
+	at.resyncLeverageAndMargin(record)
+	at.closeDustPositions(record)
+
 	// 1. 检查是否需要停止交易
-	if time.Now().Before(at.stopUntil) {
-		remaining := at.stopUntil.Sub(time.Now())
+	if at.now().Before(at.stopUntil) {
+		remaining := at.stopUntil.Sub(at.now())
 		log.Printf("⏸ 风险控制：暂停交易中，剩余 %.0f 分钟", remaining.Minutes())
 		record.Success = false
 		record.ErrorMessage = fmt.Sprintf("风险控制暂停中，剩余 %.0f 分钟", remaining.Minutes())
@@ -319,11 +828,15 @@ func (at *AutoTrader) runCycle() error {
 		return nil
 	}
 
-	// 2. 重置日盈亏（每天重置）
-	if time.Since(at.lastResetTime) > 24*time.Hour {
-		at.dailyPnL = 0
-		at.lastResetTime = time.Now()
-		log.Println("📅 日盈亏已重置")
+	// 2. 重置日盈亏（UTC跨日重置）
+	at.resetDailyLossIfNewDay(at.now())
+
+	// 3. 按计划重置初始余额基准（竞赛按日/周重新计算收益）
+	if baseline, due, err := at.rebaselineIfDue(at.now()); err != nil {
+		log.Printf("⚠️ 定时重置初始余额基准失败: %v", err)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠️ 定时重置初始余额基准失败: %v", err))
+	} else if due {
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("📏 初始余额基准已按计划重置为 %.2f USDT", baseline))
 	}
 
 	// 4. 收集交易上下文
@@ -335,6 +848,12 @@ func (at *AutoTrader) runCycle() error {
 		return fmt.Errorf("构建交易上下文失败: %w", err)
 	}
 
+	// 4.1 日亏损熔断：当日亏损超限后停止开新仓（平仓/调整不受影响）
+	if haltAction := at.checkDailyLoss(ctx.Account.TotalEquity, at.now()); haltAction != nil {
+		record.Decisions = append(record.Decisions, *haltAction)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🛑 日亏损熔断: %s", haltAction.Error))
+	}
+
 	// 保存账户状态快照
 	record.AccountState = logger.AccountSnapshot{
 		TotalBalance:          ctx.Account.TotalEquity - ctx.Account.UnrealizedPnL,
@@ -342,7 +861,7 @@ func (at *AutoTrader) runCycle() error {
 		TotalUnrealizedProfit: ctx.Account.UnrealizedPnL,
 		PositionCount:         ctx.Account.PositionCount,
 		MarginUsedPct:         ctx.Account.MarginUsedPct,
-		InitialBalance:        at.initialBalance, // 记录当时的初始余额基准
+		InitialBalance:        at.getInitialBalance(), // 记录当时的初始余额基准
 	}
 
 	// 保存持仓快照
@@ -359,42 +878,6 @@ func (at *AutoTrader) runCycle() error {
 		})
 	}
 
-	// 检测被动平仓（止损/止盈/强平/手动）
-	closedPositions := at.detectClosedPositions(ctx.Positions)
-	if len(closedPositions) > 0 {
-		autoCloseActions := at.generateAutoCloseActions(closedPositions)
-		record.Decisions = append(record.Decisions, autoCloseActions...)
-		log.Printf("🔔 检测到 %d 个被动平仓", len(closedPositions))
-		for i, closed := range closedPositions {
-			action := autoCloseActions[i]
-			pnl := closed.Quantity * (closed.MarkPrice - closed.EntryPrice)
-			if closed.Side == "short" {
-				pnl = -pnl
-			}
-			pnlPct := pnl / (closed.EntryPrice * closed.Quantity) * 100 * float64(closed.Leverage)
-
-			// 平仓原因中文映射
-			reasonMap := map[string]string{
-				"stop_loss":   "止损",
-				"take_profit": "止盈",
-				"liquidation": "强平",
-				"unknown":     "未知",
-			}
-			reasonCN := reasonMap[action.Error]
-			if reasonCN == "" {
-				reasonCN = action.Error
-			}
-
-			log.Printf("   └─ %s %s | 开仓: %.4f → 平仓: %.4f | 盈亏: %+.2f%% | 原因: %s",
-				closed.Symbol,
-				closed.Side,
-				closed.EntryPrice,
-				action.Price,    // 使用推断的平仓价格
-				pnlPct,
-				reasonCN)
-		}
-	}
-
 	log.Print(strings.Repeat("=", 70))
 	for _, coin := range ctx.CandidateCoins {
 		record.CandidateCoins = append(record.CandidateCoins, coin.Symbol)
@@ -403,22 +886,81 @@ func (at *AutoTrader) runCycle() error {
 	log.Printf("📊 账户净值: %.2f USDT | 可用: %.2f USDT | 持仓: %d",
 		ctx.Account.TotalEquity, ctx.Account.AvailableBalance, ctx.Account.PositionCount)
 
+	// 4.2 无持仓且候选币种都没有触发条件时跳过AI调用（有持仓时始终调用AI管理持仓）
+	if at.config.SkipAIWithoutTrigger && len(ctx.Positions) == 0 {
+		trigger := at.findAITrigger(ctx)
+		if trigger == "" {
+			skipped := at.skippedAICalls.Add(1)
+			log.Printf("💤 无持仓且候选币种无触发条件，跳过AI调用（累计 %d 次）", skipped)
+			record.Decisions = append(record.Decisions, logger.DecisionAction{
+				Action:    "hold",
+				Reasoning: "no trigger",
+				Timestamp: at.now(),
+				Success:   true,
+			})
+			record.ExecutionLog = append(record.ExecutionLog, "💤 无持仓且无触发条件，跳过AI调用")
+			at.updatePositionSnapshot(ctx.Positions)
+			if err := at.decisionLogger.LogDecision(record); err != nil {
+				log.Printf("⚠ 保存决策记录失败: %v", err)
+			}
+			return nil
+		}
+		log.Printf("⚡ 触发AI调用: %s", trigger)
+	}
+
 	// 5. 调用AI获取完整决策
-	log.Printf("🤖 正在请求AI分析并决策... [模板: %s]", at.systemPromptTemplate)
-	decision, err := decision.GetFullDecisionWithCustomPrompt(ctx, at.mcpClient, at.customPrompt, at.overrideBasePrompt, at.systemPromptTemplate)
+	cycleLog := at.cycleLogger()
+	cycleLog.Info("🤖 正在请求AI分析并决策", "template", at.systemPromptTemplate)
+	decision, aiModelUsed, err := at.requestDecision(ctx)
+	record.AIModel = aiModelUsed
+
+	// 行情在请求决策时才拉取，拿到后补充持仓快照的资金费率（用于统计持仓期间的资金费成本）
+	for i := range record.Positions {
+		if data, ok := ctx.MarketDataMap[record.Positions[i].Symbol]; ok && data.NextFundingTime > 0 {
+			record.Positions[i].FundingRate = data.FundingRate
+			record.Positions[i].NextFundingTime = data.NextFundingTime
+		}
+	}
+	if len(ctx.SkippedSymbols) > 0 {
+		record.ExecutionLog = append(record.ExecutionLog,
+			fmt.Sprintf("行情获取失败已跳过: %s", strings.Join(ctx.SkippedSymbols, ", ")))
+	}
 
 	if decision != nil && decision.AIRequestDurationMs > 0 {
 		record.AIRequestDurationMs = decision.AIRequestDurationMs
-		log.Printf("⏱️ AI调用耗时: %.2f 秒", float64(record.AIRequestDurationMs)/1000)
 		record.ExecutionLog = append(record.ExecutionLog,
 			fmt.Sprintf("AI调用耗时: %d ms", record.AIRequestDurationMs))
 	}
 
+	// 累计token用量（provider未返回usage时为零，不影响统计）
+	if decision != nil && decision.TokenUsage != (mcp.Usage{}) {
+		usage := decision.TokenUsage
+		record.PromptTokens = usage.PromptTokens
+		record.CompletionTokens = usage.CompletionTokens
+		record.TotalTokens = usage.TotalTokens
+		at.addTokenUsage(usage)
+	}
+	aiAttrs := []any{
+		"model", aiModelUsed,
+		"duration_ms", record.AIRequestDurationMs,
+		"prompt_tokens", record.PromptTokens,
+		"completion_tokens", record.CompletionTokens,
+		"total_tokens", record.TotalTokens,
+	}
+	if err != nil {
+		cycleLog.Error("❌ 获取AI决策失败", append(aiAttrs, "error", err)...)
+	} else {
+		cycleLog.Info("🤖 AI决策返回", append(aiAttrs, "decisions", len(decision.Decisions))...)
+	}
+
 	// 即使有错误，也保存思维链、决策和输入prompt（用于debug）
 	if decision != nil {
 		record.SystemPrompt = decision.SystemPrompt // 保存系统提示词
 		record.InputPrompt = decision.UserPrompt
 		record.CoTTrace = decision.CoTTrace
+		if decision.SchemaWarning != "" {
+			record.ExecutionLog = append(record.ExecutionLog, "⚠️ "+decision.SchemaWarning)
+		}
 		if len(decision.Decisions) > 0 {
 			decisionJSON, _ := json.MarshalIndent(decision.Decisions, "", "  ")
 			record.DecisionJSON = string(decisionJSON)
@@ -478,40 +1020,149 @@ func (at *AutoTrader) runCycle() error {
 	// 8. 对决策排序：确保先平仓后开仓（防止仓位叠加超限）
 	log.Print(strings.Repeat("-", 70))
 
+	// AI返回空决策数组：按需重试一次，仍为空时记录为 hold（与解析失败区分）
+	if len(decision.Decisions) == 0 {
+		decision = at.handleEmptyDecision(ctx, decision, record)
+	}
+
+	// 共识开仓：再请求一次AI确认开仓方向，未确认的开仓在执行时跳过（平仓和调整按第一次决策执行）
+	var consensusOpens map[string]string
+	if at.config.ConsensusOpens && hasOpenDecision(decision.Decisions) {
+		consensusOpens = at.requestOpenConsensus(ctx, record)
+	}
+
 	// 8. 对决策排序：确保先平仓后开仓（防止仓位叠加超限）
 	sortedDecisions := sortDecisionsByPriority(decision.Decisions)
 
+	// 去重：同一币种同一动作只执行第一条，同一币种同时开多开空则全部丢弃
+	sortedDecisions, dropped := dedupeDecisions(sortedDecisions)
+	for _, msg := range dropped {
+		log.Printf("⚠️  %s", msg)
+		record.ExecutionLog = append(record.ExecutionLog, "⏭ "+msg)
+	}
+
+	// 记录决策指纹，检测AI连续输出相同决策的币种
+	at.observeRepeatedDecisions(sortedDecisions)
+
 	log.Println("🔄 执行顺序（已优化）: 先平仓→后开仓")
 	for i, d := range sortedDecisions {
 		log.Printf("  [%d] %s %s", i+1, d.Symbol, d.Action)
 	}
 	log.Println()
 
-	// 执行决策并记录结果
+	// 执行决策并记录结果（持有持仓操作锁，避免与手动一键平仓交错执行）
+	at.positionMutex.Lock()
+	rateLimited := false
+	recordResult := func(actionRecord logger.DecisionAction, err error) {
+		if errors.Is(err, ErrPostOnlyRejected) {
+			// 只挂单会立即成交被交易所拒绝：行情已越过挂单价，跳过本次开仓，不按执行失败处理
+			cycleLog.Info("⏭️ 只挂单会立即成交，跳过", "symbol", actionRecord.Symbol, "action", actionRecord.Action, "error", err)
+			actionRecord.Error = err.Error()
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⏭️ %s %s 跳过: 只挂单会立即成交", actionRecord.Symbol, actionRecord.Action))
+		} else if err != nil {
+			cycleLog.Error("❌ 执行决策失败", "symbol", actionRecord.Symbol, "action", actionRecord.Action, "error", err)
+			actionRecord.Error = err.Error()
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 失败: %v", actionRecord.Symbol, actionRecord.Action, err))
+			if errors.Is(err, ErrRateLimited) {
+				rateLimited = true
+			}
+		} else {
+			actionRecord.Success = true
+			cycleLog.Info("✓ 执行决策成功",
+				"symbol", actionRecord.Symbol,
+				"action", actionRecord.Action,
+				"quantity", actionRecord.Quantity,
+				"price", actionRecord.Price,
+				"order_id", actionRecord.OrderID)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 成功", actionRecord.Symbol, actionRecord.Action))
+		}
+		record.Decisions = append(record.Decisions, actionRecord)
+	}
+
+	// 交易所支持批量下单时，连续的开仓决策先暂存，遇到其他决策或执行结束时合并为一次批量请求
+	_, canBatch := at.trader.(BatchOrderTrader)
+	var openBatch []batchOpen
+	flushOpenBatch := func() {
+		if len(openBatch) == 0 {
+			return
+		}
+		errs := at.executeOpenBatch(openBatch)
+		succeeded := false
+		for k, item := range openBatch {
+			recordResult(*item.record, errs[k])
+			succeeded = succeeded || errs[k] == nil
+		}
+		record.Decisions = append(record.Decisions, at.takePendingActions()...)
+		openBatch = nil
+		if succeeded {
+			time.Sleep(1 * time.Second)
+		}
+	}
+
 	for _, d := range sortedDecisions {
+		if d.Action != "open_long" && d.Action != "open_short" {
+			flushOpenBatch()
+		}
 		actionRecord := logger.DecisionAction{
 			Action:    d.Action,
 			Symbol:    d.Symbol,
 			Quantity:  0,
 			Leverage:  d.Leverage,
 			Price:     0,
-			Timestamp: time.Now(),
+			Reasoning: logger.TruncateReasoning(d.Reasoning),
+			Timestamp: at.now(),
 			Success:   false,
 		}
 
-		if err := at.executeDecisionWithRecord(&d, &actionRecord); err != nil {
-			log.Printf("❌ 执行决策失败 (%s %s): %v", d.Symbol, d.Action, err)
-			actionRecord.Error = err.Error()
-			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 失败: %v", d.Symbol, d.Action, err))
-		} else {
-			actionRecord.Success = true
-			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 成功", d.Symbol, d.Action))
+		// 交易所已限频：本周期剩余决策不再提交，避免加重限频（下个周期重新决策）
+		if rateLimited {
+			actionRecord.Error = fmt.Sprintf("%v，本周期跳过", ErrRateLimited)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⏭ %s %s 跳过: %s", d.Symbol, d.Action, actionRecord.Error))
+			record.Decisions = append(record.Decisions, actionRecord)
+			continue
+		}
+
+		// 连续重复决策的币种处于退避期：不执行
+		if d.Symbol != "" && at.inRepeatBackoff(d.Symbol) {
+			actionRecord.Error = "连续重复决策，退避中"
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⏭ %s %s 跳过: %s", d.Symbol, d.Action, actionRecord.Error))
+			record.Decisions = append(record.Decisions, actionRecord)
+			continue
+		}
+
+		// 共识开仓：两次AI调用对该币种的开仓方向不一致时不开仓
+		if at.config.ConsensusOpens && (d.Action == "open_long" || d.Action == "open_short") && consensusOpens[d.Symbol] != d.Action {
+			cycleLog.Warn("⏭ 第二次AI调用未给出相同方向，跳过开仓", "symbol", d.Symbol, "action", d.Action)
+			actionRecord.Error = "无共识"
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⏭ %s %s 跳过: %s", d.Symbol, d.Action, actionRecord.Error))
+			record.Decisions = append(record.Decisions, actionRecord)
+			continue
+		}
+
+		// 执行前校验决策字段，无效决策记录原因后跳过
+		if err := d.Validate(at.validationConfig()); err != nil {
+			cycleLog.Warn("⚠️ 跳过无效决策", "symbol", d.Symbol, "action", d.Action, "error", err)
+			actionRecord.Error = fmt.Sprintf("无效决策: %v", err)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⏭ %s %s 跳过: %s", d.Symbol, d.Action, actionRecord.Error))
+			record.Decisions = append(record.Decisions, actionRecord)
+			continue
+		}
+
+		if canBatch && (d.Action == "open_long" || d.Action == "open_short") {
+			openBatch = append(openBatch, batchOpen{decision: &d, record: &actionRecord})
+			continue
+		}
+
+		err := at.executeDecisionWithRecord(&d, &actionRecord)
+		recordResult(actionRecord, err)
+		record.Decisions = append(record.Decisions, at.takePendingActions()...)
+		if err == nil {
 			// 成功执行后短暂延迟
 			time.Sleep(1 * time.Second)
 		}
-
-		record.Decisions = append(record.Decisions, actionRecord)
 	}
+	flushOpenBatch()
+	at.positionMutex.Unlock()
 
 	// 9. 更新持仓快照（用于下一周期检测被动平仓）
 	at.updatePositionSnapshot(ctx.Positions)
@@ -558,16 +1209,14 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 
 	var positionInfos []decision.PositionInfo
 	totalMarginUsed := 0.0
-
-	// 当前持仓的key集合（用于清理已平仓的记录）
-	currentPositionKeys := make(map[string]bool)
+	funding := at.newFundingAccrual(positions)
 
 	for _, pos := range positions {
 		symbol := pos["symbol"].(string)
 		side := pos["side"].(string)
-		entryPrice := pos["entryPrice"].(float64)
-		markPrice := pos["markPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
+		entryPrice, _ := asFloat(pos["entryPrice"])
+		markPrice, _ := asFloat(pos["markPrice"])
+		quantity, _ := asFloat(pos["positionAmt"])
 		if quantity < 0 {
 			quantity = -quantity // 空仓数量为负，转为正数
 		}
@@ -577,12 +1226,12 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			continue
 		}
 
-		unrealizedPnl := pos["unRealizedProfit"].(float64)
-		liquidationPrice := pos["liquidationPrice"].(float64)
+		unrealizedPnl, _ := asFloat(pos["unRealizedProfit"])
+		liquidationPrice, _ := asFloat(pos["liquidationPrice"])
 
 		// 计算占用保证金（基于开仓价）
 		leverage := 10 // 默认值，实际应该从持仓信息获取
-		if lev, ok := pos["leverage"].(float64); ok {
+		if lev, ok := asFloat(pos["leverage"]); ok {
 			leverage = int(lev)
 		}
 		marginUsed := (quantity * entryPrice) / float64(leverage)
@@ -593,21 +1242,21 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 
 		// 跟踪持仓首次出现时间
 		posKey := symbol + "_" + side
-		currentPositionKeys[posKey] = true
-		if _, exists := at.positionFirstSeenTime[posKey]; !exists {
-			// 新持仓，记录当前时间
-			at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
-		}
-		updateTime := at.positionFirstSeenTime[posKey]
+		updateTime := at.markPositionSeen(posKey)
+
+		// 获取止损止盈价格（用于后续推断平仓原因）
+		at.positionStateMutex.RLock()
+		stopLoss := at.positionStopLoss[posKey]
+		takeProfit := at.positionTakeProfit[posKey]
+		at.positionStateMutex.RUnlock()
 
 		// 获取该持仓的历史最高收益率
 		at.peakPnLCacheMutex.RLock()
 		peakPnlPct := at.peakPnLCache[posKey]
 		at.peakPnLCacheMutex.RUnlock()
 
-		// 获取止损止盈价格（用于后续推断平仓原因）
-		stopLoss := at.positionStopLoss[posKey]
-		takeProfit := at.positionTakeProfit[posKey]
+		// 盈亏拆分：让AI知道此刻平仓扣除资金费和手续费后的实际盈亏
+		breakdown := funding.breakdown(symbol, side, updateTime, entryPrice, markPrice, quantity, marginUsed)
 
 		positionInfos = append(positionInfos, decision.PositionInfo{
 			Symbol:           symbol,
@@ -624,35 +1273,47 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			UpdateTime:       updateTime,
 			StopLoss:         stopLoss,
 			TakeProfit:       takeProfit,
+			GrossPnL:         breakdown.GrossPnL,
+			FundingCost:      breakdown.FundingCost,
+			CloseFee:         breakdown.CloseFee,
+			NetPnL:           breakdown.NetPnL,
 		})
 	}
 
-	// 清理已平仓的持仓记录（包括止损止盈记录）
-	for key := range at.positionFirstSeenTime {
-		if !currentPositionKeys[key] {
-			delete(at.positionFirstSeenTime, key)
-			delete(at.positionStopLoss, key)
-			delete(at.positionTakeProfit, key)
-		}
-	}
+	// 持仓相关性（基于4小时K线收益率），用于提示AI避免集中押注同一方向
+	correlations, correlationSummary := at.updatePositionCorrelation(positionInfos)
+
+	// 市场状态（以BTC 4小时K线为代表），提示AI并在极端波动时限制开新仓
+	regime := at.updateMarketRegime()
 
 	// 3. 获取交易员的候选币种池
 	candidateCoins, err := at.getCandidateCoins()
 	if err != nil {
 		return nil, fmt.Errorf("获取候选币种失败: %w", err)
 	}
+	// 连续重复决策退避中的币种不再提交给AI（已持仓的仍随持仓信息提交）
+	candidateCoins = slices.DeleteFunc(candidateCoins, func(c decision.CandidateCoin) bool {
+		return at.inRepeatBackoff(c.Symbol)
+	})
+
+	contextSymbols := at.contextOnlySymbols(positionInfos, candidateCoins)
+
+	// 盘口买卖比（持仓 + 候选币种），短期挂单压力信号
+	depthImbalances := at.collectDepthImbalances(positionInfos, candidateCoins)
 
 	// 4. 计算总盈亏
-	totalPnL := totalEquity - at.initialBalance
+	initialBalance := at.getInitialBalance()
+	totalPnL := totalEquity - initialBalance
 	totalPnLPct := 0.0
-	if at.initialBalance > 0 {
-		totalPnLPct = (totalPnL / at.initialBalance) * 100
+	if initialBalance > 0 {
+		totalPnLPct = (totalPnL / initialBalance) * 100
 	}
 
 	marginUsedPct := 0.0
 	if totalEquity > 0 {
 		marginUsedPct = (totalMarginUsed / totalEquity) * 100
 	}
+	at.reportAccountExposure(totalEquity, totalMarginUsed)
 
 	// 5. 分析历史表现（最近100个周期，避免长期持仓的交易记录丢失）
 	// 假设每3分钟一个周期，100个周期 = 5小时，足够覆盖大部分交易
@@ -665,11 +1326,12 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 
 	// 6. 构建上下文
 	ctx := &decision.Context{
-		CurrentTime:     time.Now().Format("2006-01-02 15:04:05"),
-		RuntimeMinutes:  int(time.Since(at.startTime).Minutes()),
+		CurrentTime:     at.now().Format("2006-01-02 15:04:05"),
+		RuntimeMinutes:  int(at.since(at.startTime).Minutes()),
 		CallCount:       at.callCount,
 		BTCETHLeverage:  at.config.BTCETHLeverage,  // 使用配置的杠杆倍数
 		AltcoinLeverage: at.config.AltcoinLeverage, // 使用配置的杠杆倍数
+		LeverageTiers:   at.config.LeverageTiers,
 		Account: decision.AccountInfo{
 			TotalEquity:      totalEquity,
 			AvailableBalance: availableBalance,
@@ -680,25 +1342,71 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			MarginUsedPct:    marginUsedPct,
 			PositionCount:    len(positionInfos),
 		},
-		Positions:      positionInfos,
-		CandidateCoins: candidateCoins,
-		Performance:    performance, // 添加历史表现分析
+		Positions:          positionInfos,
+		CandidateCoins:     candidateCoins,
+		ContextSymbols:     contextSymbols,
+		Performance:        performance, // 添加历史表现分析
+		Correlations:       correlations,
+		CorrelationSummary: correlationSummary,
+		DepthImbalances:    depthImbalances,
+		MarketRegime:       regime,
 	}
 
 	return ctx, nil
 }
 
-// executeDecisionWithRecord 执行AI决策并记录详细信息
-func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
-	switch decision.Action {
-	case "open_long":
-		return at.executeOpenLongWithRecord(decision, actionRecord)
-	case "open_short":
-		return at.executeOpenShortWithRecord(decision, actionRecord)
-	case "close_long":
-		return at.executeCloseLongWithRecord(decision, actionRecord)
-	case "close_short":
-		return at.executeCloseShortWithRecord(decision, actionRecord)
+// collectDepthImbalances 获取持仓和候选币种的盘口买卖比（目前仅币安提供盘口数据，其他交易所返回 nil）
+// 单个币种获取失败只跳过该币种
+func (at *AutoTrader) collectDepthImbalances(positions []decision.PositionInfo, candidates []decision.CandidateCoin) map[string]*market.DepthImbalance {
+	if at.exchange != "binance" {
+		return nil
+	}
+
+	imbalances := make(map[string]*market.DepthImbalance)
+	fetch := func(symbol string) {
+		if _, done := imbalances[symbol]; done {
+			return
+		}
+		imbalance, err := market.GetDepthImbalance(symbol)
+		if err != nil {
+			log.Printf("⚠️  %v", err)
+			return
+		}
+		imbalances[symbol] = imbalance
+	}
+	for _, pos := range positions {
+		fetch(pos.Symbol)
+	}
+	for _, coin := range candidates {
+		fetch(coin.Symbol)
+	}
+	return imbalances
+}
+
+// executeDecisionWithRecord 执行AI决策并记录详细信息
+func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	if at.IsDisabled() {
+		return ErrTraderDisabled
+	}
+	if decision.Action == "open_long" || decision.Action == "open_short" || decision.Action == "add_position" || decision.Action == "add_short" {
+		if err := at.checkOpenAllowed(decision.Symbol); err != nil {
+			return err
+		}
+	}
+
+	switch decision.Action {
+	case "open_long":
+		return at.executeOpenLongWithRecord(decision, actionRecord)
+	case "open_short":
+		return at.executeOpenShortWithRecord(decision, actionRecord)
+	case "add_position":
+		return at.executeAddPositionWithRecord(decision, actionRecord, "long")
+	case "add_short":
+		return at.executeAddPositionWithRecord(decision, actionRecord, "short")
+	case "close_long":
+		return at.executeCloseLongWithRecord(decision, actionRecord)
+	case "close_short":
+		return at.executeCloseShortWithRecord(decision, actionRecord)
 	case "update_stop_loss":
 		return at.executeUpdateStopLossWithRecord(decision, actionRecord)
 	case "update_take_profit":
@@ -713,172 +1421,1022 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 	}
 }
 
+// checkOpenAllowed 开仓/加仓前校验币种范围、手动持仓、日亏损熔断和止损冷却
+// （止损冷却期内拒绝同币种开仓，其他币种和平仓/调整类操作不受影响）
+func (at *AutoTrader) checkOpenAllowed(symbol string) error {
+	if err := at.checkSymbolScope(symbol); err != nil {
+		return err
+	}
+	if err := at.checkManualHold(symbol); err != nil {
+		return err
+	}
+	if haltedUntil := at.dailyLossHaltedUntil(); at.now().Before(haltedUntil) {
+		return fmt.Errorf("❌ 当日亏损已超过上限 %.2f%%，%s 前暂停开新仓", at.config.MaxDailyLoss, haltedUntil.Format(time.RFC3339))
+	}
+	if remaining := at.stopLossCooldownRemaining(symbol); remaining > 0 {
+		return fmt.Errorf("❌ %s 止损后冷却中，%s 后才能重新开仓", symbol, remaining.Round(time.Second))
+	}
+	if regime := at.currentMarketRegime(); regime.Regime == market.RegimeHighVol && !at.config.AllowHighVolOpens {
+		return fmt.Errorf("❌ 市场处于极端波动（BTC 4小时ATR %.2f%%），暂停开新仓", regime.ATRPct)
+	}
+	return nil
+}
+
+// ensureMarginMode 开仓前按币种设置仓位模式，已设置为相同模式的币种不再重复调用
+// 设置失败（包括有持仓时交易所拒绝更改）不影响开仓，继续使用交易所当前的仓位模式
+func (at *AutoTrader) ensureMarginMode(symbol string) {
+	isCross := ResolveMarginMode(symbol, at.config.MarginModes, at.config.IsCrossMargin)
+	if current, ok := at.marginModeSet[symbol]; ok && current == isCross {
+		return
+	}
+
+	if err := at.trader.SetMarginMode(symbol, isCross); err != nil {
+		if errors.Is(err, ErrMarginModeLocked) {
+			log.Printf("  ⚠️ %s 有持仓，无法更改仓位模式，继续使用当前模式", symbol)
+		} else {
+			log.Printf("  ⚠️ 设置仓位模式失败: %v", err)
+		}
+		return
+	}
+	if at.marginModeSet == nil {
+		at.marginModeSet = make(map[string]bool)
+	}
+	at.marginModeSet[symbol] = isCross
+}
+
+// validationConfig 执行前校验决策使用的配置（杠杆上限）
+func (at *AutoTrader) validationConfig() decision.ValidationConfig {
+	return decision.ValidationConfig{
+		BTCETHLeverage:  at.config.BTCETHLeverage,
+		AltcoinLeverage: at.config.AltcoinLeverage,
+		LeverageTiers:   at.config.LeverageTiers,
+	}
+}
+
+// clampLeverage 将杠杆截断到系统杠杆上限 MaxAllowedLeverage（上限未配置时不截断）
+func clampLeverage(leverage int) int {
+	if MaxAllowedLeverage > 0 && leverage > MaxAllowedLeverage {
+		return MaxAllowedLeverage
+	}
+	return leverage
+}
+
+// clampConfigLeverage 将交易员配置的各档杠杆截断到系统杠杆上限，截断时打印警告
+func clampConfigLeverage(config *AutoTraderConfig) {
+	clamp := func(label string, leverage int) int {
+		clamped := clampLeverage(leverage)
+		if clamped != leverage {
+			log.Printf("⚠️ [%s] %s 杠杆 %dx 超过系统上限，调整为 %dx", config.Name, label, leverage, clamped)
+		}
+		return clamped
+	}
+	config.BTCETHLeverage = clamp("BTC/ETH", config.BTCETHLeverage)
+	config.AltcoinLeverage = clamp("山寨币", config.AltcoinLeverage)
+	if len(config.LeverageTiers) > 0 {
+		tiers := make(map[string]int, len(config.LeverageTiers)) // 复制一份，不修改调用方的配置
+		for symbol, leverage := range config.LeverageTiers {
+			tiers[symbol] = clamp(symbol, leverage)
+		}
+		config.LeverageTiers = tiers
+	}
+}
+
+// applyLeverageLimit 按币种解析杠杆上限（杠杆分级优先，未匹配时为BTC/ETH与山寨币两档），
+// 决策杠杆超限或未提供时修正为上限，并把实际杠杆和上限记录到决策动作
+func (at *AutoTrader) applyLeverageLimit(d *decision.Decision, actionRecord *logger.DecisionAction) {
+	limit := decision.ResolveLeverage(d.Symbol, at.config.LeverageTiers, at.config.BTCETHLeverage, at.config.AltcoinLeverage)
+	if limit > 0 && (d.Leverage <= 0 || d.Leverage > limit) {
+		log.Printf("  ⚠️ %s 杠杆 %dx 超出上限，调整为 %dx", d.Symbol, d.Leverage, limit)
+		d.Leverage = limit
+	}
+	if clamped := clampLeverage(d.Leverage); clamped != d.Leverage {
+		log.Printf("  ⚠️ %s 杠杆 %dx 超过系统上限，调整为 %dx", d.Symbol, d.Leverage, clamped)
+		d.Leverage = clamped
+	}
+	actionRecord.Leverage = d.Leverage
+	actionRecord.ResolvedLeverage = limit
+}
+
 // executeOpenLongWithRecord 执行开多仓并记录详细信息
 func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	log.Printf("  📈 开多仓: %s", decision.Symbol)
 
-	// ⚠️ 关键：检查是否已有同币种同方向持仓，如果有则拒绝开仓（防止仓位叠加超限）
-	positions, err := at.trader.GetPositions()
-	if err == nil {
-		for _, pos := range positions {
-			if pos["symbol"] == decision.Symbol && pos["side"] == "long" {
-				return fmt.Errorf("❌ %s 已有多仓，拒绝开仓以防止仓位叠加超限。如需换仓，请先给出 close_long 决策", decision.Symbol)
-			}
-		}
+	plan, err := at.prepareOpen(decision, actionRecord, "long")
+	if err != nil {
+		return err
+	}
+
+	// 开仓
+	order, err := at.submitOrder(decision.Symbol, decision.Action, plan.orderType, plan.quantity, decision.Leverage)
+	if err != nil {
+		return err
 	}
 
+	at.finishOpen(decision, actionRecord, plan, order)
+	return nil
+}
+
+// openPlan 开仓前校验通过后确定的下单参数
+type openPlan struct {
+	side         string  // long / short
+	orderType    string  // open_long / open_short
+	positionSide string  // PositionSideLong / PositionSideShort
+	quantity     float64 // 下单数量
+	price        float64 // 校验时的市价
+	margin       float64 // 占用保证金（含手续费估算）
+}
+
+// openReservation 批量开仓时已通过校验但尚未下单的仓位，后续开仓校验最大持仓数和可用保证金时计入
+type openReservation struct {
+	positions int
+	margin    float64
+}
+
+// prepareOpen 开仓前校验（已有持仓、最大持仓数、点差、最小名义价值、相关性敞口、保证金）并计算下单数量，设置仓位模式
+func (at *AutoTrader) prepareOpen(decision *decision.Decision, actionRecord *logger.DecisionAction, side string) (*openPlan, error) {
+	// ⚠️ 关键：检查是否已有同币种持仓，如果有则拒绝开仓（防止仓位叠加超限）
+	if err := at.checkExistingPosition(decision.Symbol, side); err != nil {
+		return nil, err
+	}
+
+	// ⚠️ 关键：检查最大持仓数
+	if err := at.checkMaxOpenPositions(); err != nil {
+		return nil, err
+	}
+
+	// 按杠杆分级限制杠杆
+	at.applyLeverageLimit(decision, actionRecord)
+
 	// 获取当前价格
 	marketData, err := market.Get(decision.Symbol)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// ⚠️ 点差保护：流动性差时市价单滑点过大
+	if err := at.checkSpread(decision.Symbol); err != nil {
+		return nil, err
+	}
+
+	// 计算数量（提供 risk_percent 时按止损距离定仓）
+	quantity, err := at.calculateOpenQuantity(decision, marketData.CurrentPrice, side == "long")
+	if err != nil {
+		return nil, err
+	}
+
+	// ⚠️ 单币种仓位上限：避免资金集中在一个币种
+	quantity, err = at.checkPositionConcentration(decision.Symbol, quantity, marketData.CurrentPrice, decision.Leverage)
+	if err != nil {
+		return nil, err
 	}
 
-	// 计算数量
-	quantity := decision.PositionSizeUSD / marketData.CurrentPrice
+	// ⚠️ 最小名义价值校验：避免交易所返回晦涩的错误
+	quantity, err = at.checkMinNotional(decision.Symbol, quantity, marketData.CurrentPrice)
+	if err != nil {
+		return nil, err
+	}
+	positionSizeUSD := quantity * marketData.CurrentPrice
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
 
+	// ⚠️ 相关性敞口校验：避免同方向押注高度相关的币种
+	if err := at.checkCorrelatedExposure(decision.Symbol, side, positionSizeUSD); err != nil {
+		return nil, err
+	}
+
 	// ⚠️ 保证金验证：防止保证金不足错误（code=-2019）
-	requiredMargin := decision.PositionSizeUSD / float64(decision.Leverage)
+	requiredMargin := positionSizeUSD / float64(decision.Leverage)
 
 	balance, err := at.trader.GetBalance()
 	if err != nil {
-		return fmt.Errorf("获取账户余额失败: %w", err)
+		return nil, fmt.Errorf("获取账户余额失败: %w", err)
 	}
 	availableBalance := 0.0
 	if avail, ok := balance["availableBalance"].(float64); ok {
 		availableBalance = avail
 	}
+	// 批量开仓中排在前面、尚未下单的仓位先占用保证金
+	availableBalance -= at.batchReserved.margin
 
 	// 手续费估算（Taker费率 0.04%）
-	estimatedFee := decision.PositionSizeUSD * 0.0004
+	estimatedFee := positionSizeUSD * 0.0004
 	totalRequired := requiredMargin + estimatedFee
 
 	if totalRequired > availableBalance {
-		return fmt.Errorf("❌ 保证金不足: 需要 %.2f USDT（保证金 %.2f + 手续费 %.2f），可用 %.2f USDT",
-			totalRequired, requiredMargin, estimatedFee, availableBalance)
+		return nil, fmt.Errorf("❌ %w: 需要 %.2f USDT（保证金 %.2f + 手续费 %.2f），可用 %.2f USDT",
+			ErrInsufficientMargin, totalRequired, requiredMargin, estimatedFee, availableBalance)
 	}
 
-	// 设置仓位模式
-	if err := at.trader.SetMarginMode(decision.Symbol, at.config.IsCrossMargin); err != nil {
-		log.Printf("  ⚠️ 设置仓位模式失败: %v", err)
-		// 继续执行，不影响交易
+	// ⚠️ 账户级保证金上限：同一账户上的其他交易员合计占用也计入
+	if err := at.reserveAccountExposure(decision.Symbol, totalRequired); err != nil {
+		return nil, err
 	}
 
-	// 开仓
-	order, err := at.trader.OpenLong(decision.Symbol, quantity, decision.Leverage)
-	if err != nil {
-		return err
+	// 设置仓位模式
+	at.ensureMarginMode(decision.Symbol)
+
+	plan := &openPlan{
+		side:         side,
+		orderType:    "open_" + side,
+		positionSide: PositionSideLong,
+		quantity:     quantity,
+		price:        marketData.CurrentPrice,
+		margin:       totalRequired,
+	}
+	if side == "short" {
+		plan.positionSide = PositionSideShort
 	}
+	return plan, nil
+}
 
+// finishOpen 开仓成交后记录订单ID和开仓时间，并挂保护性止损止盈
+func (at *AutoTrader) finishOpen(decision *decision.Decision, actionRecord *logger.DecisionAction, plan *openPlan, order map[string]interface{}) {
 	// 记录订单ID
 	if orderID, ok := order["orderId"].(int64); ok {
 		actionRecord.OrderID = orderID
 	}
+	actionRecord.ClientOrderID, _ = order["clientOrderId"].(string)
 
-	log.Printf("  ✓ 开仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
+	at.cycleLogger().Info("✓ 开仓成功", "symbol", decision.Symbol, "side", plan.side, "order_id", order["orderId"], "quantity", plan.quantity, "price", plan.price)
 
 	// 记录开仓时间
-	posKey := decision.Symbol + "_long"
-	at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+	posKey := decision.Symbol + "_" + plan.side
+	at.positionStateMutex.Lock()
+	at.positionFirstSeenTime[posKey] = at.now().UnixMilli()
+	if at.positionLeverage == nil {
+		at.positionLeverage = make(map[string]int)
+	}
+	at.positionLeverage[posKey] = decision.Leverage
+	at.positionStateMutex.Unlock()
 
-	// 设置止损止盈
-	if err := at.trader.SetStopLoss(decision.Symbol, "LONG", quantity, decision.StopLoss); err != nil {
-		log.Printf("  ⚠ 设置止损失败: %v", err)
-	} else {
-		at.positionStopLoss[posKey] = decision.StopLoss // 记录止损价格
+	// 设置止损止盈（成交后立即挂保护性止损，不依赖下个周期的 update_stop_loss）
+	at.placeProtectiveOrders(decision, plan.positionSide, plan.quantity, plan.price, actionRecord)
+}
+
+// resolveStopLoss 确定开仓后的保护性止损价：依次使用决策的 stop_loss、new_stop_loss，
+// 都没有或位于入场价错误一侧（多仓止损须低于入场价，空仓须高于）时按 DefaultStopLossPct 从入场价推算；没有可用止损时返回 0
+func (at *AutoTrader) resolveStopLoss(d *decision.Decision, entryPrice float64, isLong bool) float64 {
+	validSide := func(stop float64) bool {
+		if isLong {
+			return stop < entryPrice
+		}
+		return stop > entryPrice
 	}
-	if err := at.trader.SetTakeProfit(decision.Symbol, "LONG", quantity, decision.TakeProfit); err != nil {
+
+	for _, stop := range []float64{d.StopLoss, d.NewStopLoss} {
+		if stop <= 0 {
+			continue
+		}
+		if validSide(stop) {
+			return stop
+		}
+		log.Printf("  ⚠ %s 止损价 %.4f 位于入场价 %.4f 错误一侧，忽略", d.Symbol, stop, entryPrice)
+	}
+
+	if at.config.DefaultStopLossPct > 0 && entryPrice > 0 {
+		if isLong {
+			return entryPrice * (1 - at.config.DefaultStopLossPct/100)
+		}
+		return entryPrice * (1 + at.config.DefaultStopLossPct/100)
+	}
+	return 0
+}
+
+// placeProtectiveOrders 开仓成交后挂止损止盈
+// 同时有止损和单一止盈时成对挂出（见 placeStopLossTakeProfitPair），否则分别挂止损和（分批）止盈
+func (at *AutoTrader) placeProtectiveOrders(d *decision.Decision, positionSide string, quantity, entryPrice float64, entry *logger.DecisionAction) {
+	posKey := d.Symbol + "_long"
+	if positionSide != PositionSideLong {
+		posKey = d.Symbol + "_short"
+	}
+
+	stop := at.resolveStopLoss(d, entryPrice, positionSide == PositionSideLong)
+	if stop > 0 && d.TakeProfit > 0 && len(d.TakeProfitLadder) == 0 {
+		at.placeStopLossTakeProfitPair(d, positionSide, quantity, stop, entry)
+		return
+	}
+
+	at.placeProtectiveStop(d, positionSide, quantity, entryPrice, entry)
+	if err := at.setTakeProfitOrders(d, positionSide, quantity, entryPrice); err != nil {
 		log.Printf("  ⚠ 设置止盈失败: %v", err)
+		return
+	}
+	at.positionStateMutex.Lock()
+	at.positionTakeProfit[posKey] = d.TakeProfit // 记录止盈价格
+	at.positionStateMutex.Unlock()
+}
+
+// formatOrderQuantity 按交易所的数量精度格式化下单数量（格式化失败时使用原值）
+func (at *AutoTrader) formatOrderQuantity(symbol string, quantity float64) float64 {
+	quantityStr, err := at.trader.FormatQuantity(symbol, quantity)
+	if err != nil {
+		return quantity
+	}
+	parsed, err := strconv.ParseFloat(quantityStr, 64)
+	if err != nil {
+		return quantity
+	}
+	return parsed
+}
+
+// formatOrderPrice 按交易所的价格精度格式化挂单价格（格式化失败时使用原值）
+func (at *AutoTrader) formatOrderPrice(symbol string, price float64) float64 {
+	priceStr, err := at.trader.FormatPrice(symbol, price)
+	if err != nil {
+		return price
+	}
+	parsed, err := strconv.ParseFloat(priceStr, 64)
+	if err != nil {
+		return price
+	}
+	return parsed
+}
+
+// setStopLoss 按交易所精度格式化数量和价格后挂止损单（各交易所精度不同，不能统一按币安规则取整）
+func (at *AutoTrader) setStopLoss(symbol, positionSide string, quantity, stopPrice float64) error {
+	return at.trader.SetStopLoss(symbol, positionSide, at.formatOrderQuantity(symbol, quantity), at.formatOrderPrice(symbol, stopPrice))
+}
+
+// setTakeProfit 按交易所精度格式化数量和价格后挂止盈单
+func (at *AutoTrader) setTakeProfit(symbol, positionSide string, quantity, takeProfitPrice float64) error {
+	return at.trader.SetTakeProfit(symbol, positionSide, at.formatOrderQuantity(symbol, quantity), at.formatOrderPrice(symbol, takeProfitPrice))
+}
+
+// setStopLossTakeProfit 按交易所精度格式化数量和价格后挂联动止损止盈单
+func (at *AutoTrader) setStopLossTakeProfit(oco OCOTrader, symbol, positionSide string, quantity, stopPrice, takeProfitPrice float64) error {
+	return oco.SetStopLossTakeProfit(symbol, positionSide, at.formatOrderQuantity(symbol, quantity),
+		at.formatOrderPrice(symbol, stopPrice), at.formatOrderPrice(symbol, takeProfitPrice))
+}
+
+// placeStopLossTakeProfitPair 成对挂止损单和止盈单，两个动作记录相同的 OCOGroup 以便对账时识别配对
+// 交易所支持联动挂单（OCOTrader）时一方成交后由交易所撤销另一方；否则分别挂只减仓的止损和止盈单，
+// 持仓消失后由 reconcilePositions 撤销残留的一方
+func (at *AutoTrader) placeStopLossTakeProfitPair(d *decision.Decision, positionSide string, quantity, stop float64, entry *logger.DecisionAction) {
+	posKey := d.Symbol + "_long"
+	if positionSide != PositionSideLong {
+		posKey = d.Symbol + "_short"
+	}
+	group := "oco-" + entry.ClientOrderID
+	if entry.ClientOrderID == "" {
+		group = fmt.Sprintf("oco-%s-%d", posKey, at.now().UnixMilli())
+	}
+
+	slAction := logger.DecisionAction{
+		Action:        "stop_loss",
+		Symbol:        d.Symbol,
+		Quantity:      quantity,
+		Price:         stop,
+		ParentOrderID: entry.OrderID,
+		OCOGroup:      group,
+		Timestamp:     at.now(),
+	}
+	tpAction := slAction
+	tpAction.Action = "take_profit"
+	tpAction.Price = d.TakeProfit
+
+	var slErr, tpErr error
+	oco, native := at.trader.(OCOTrader)
+	if native {
+		if err := at.setStopLossTakeProfit(oco, d.Symbol, positionSide, quantity, stop, d.TakeProfit); err != nil {
+			tpErr = err
+			if !errors.Is(err, ErrTakeProfitNotSet) {
+				slErr = err
+			}
+		}
+	} else {
+		slErr = at.setStopLoss(d.Symbol, positionSide, quantity, stop)
+		tpErr = at.setTakeProfit(d.Symbol, positionSide, quantity, d.TakeProfit)
+	}
+
+	at.positionStateMutex.Lock()
+	if slErr == nil {
+		slAction.Success = true
+		at.positionStopLoss[posKey] = stop // 记录止损价格
+	} else {
+		slAction.Error = slErr.Error()
+	}
+	if tpErr == nil {
+		tpAction.Success = true
+		at.positionTakeProfit[posKey] = d.TakeProfit // 记录止盈价格
 	} else {
-		at.positionTakeProfit[posKey] = decision.TakeProfit // 记录止盈价格
+		tpAction.Error = tpErr.Error()
+	}
+	if slErr == nil && tpErr == nil {
+		if at.protectivePairs == nil {
+			at.protectivePairs = make(map[string]protectivePair)
+		}
+		at.protectivePairs[posKey] = protectivePair{Group: group, Native: native}
+	}
+	at.positionStateMutex.Unlock()
+
+	if slErr != nil {
+		log.Printf("  ⚠ 设置止损失败: %v", slErr)
+	}
+	if tpErr != nil {
+		log.Printf("  ⚠ 设置止盈失败: %v", tpErr)
 	}
+	if slErr == nil && tpErr == nil {
+		log.Printf("  🛡 已挂止损止盈配对 [%s]: 止损 %.4f / 止盈 %.4f（联动: %v）", group, stop, d.TakeProfit, native)
+	}
+	at.pendingActions = append(at.pendingActions, slAction, tpAction)
+}
+
+// placeProtectiveStop 开仓成交后挂保护性止损，止损挂单记录为关联到开仓订单的 stop_loss 动作
+// 没有可用止损或挂单失败时同样记录（Error 说明原因），便于发现未受保护的仓位
+func (at *AutoTrader) placeProtectiveStop(d *decision.Decision, positionSide string, quantity, entryPrice float64, entry *logger.DecisionAction) {
+	isLong := positionSide == PositionSideLong
+	stop := at.resolveStopLoss(d, entryPrice, isLong)
+
+	action := logger.DecisionAction{
+		Action:        "stop_loss",
+		Symbol:        d.Symbol,
+		Quantity:      quantity,
+		Price:         stop,
+		ParentOrderID: entry.OrderID,
+		Timestamp:     at.now(),
+	}
+	defer func() { at.pendingActions = append(at.pendingActions, action) }()
+
+	if stop <= 0 {
+		log.Printf("  ⚠ %s 没有有效止损价且未配置默认止损，仓位未受保护", d.Symbol)
+		action.Error = "没有有效止损价且未配置默认止损"
+		return
+	}
+	if err := at.setStopLoss(d.Symbol, positionSide, quantity, stop); err != nil {
+		log.Printf("  ⚠ 设置止损失败: %v", err)
+		action.Error = err.Error()
+		return
+	}
+
+	log.Printf("  🛡 已挂保护性止损: %.4f", stop)
+	action.Success = true
+	posKey := d.Symbol + "_long"
+	if !isLong {
+		posKey = d.Symbol + "_short"
+	}
+	at.positionStateMutex.Lock()
+	at.positionStopLoss[posKey] = stop // 记录止损价格
+	at.positionStateMutex.Unlock()
+}
 
+// setTakeProfitOrders 开仓后挂止盈单
+// 有分批止盈时按档位拆分数量挂多张只减仓止盈单，每档记录为单独的决策动作；
+// 分批止盈相对当前标记价格无效时退回单一止盈单，保证仓位始终有止盈保护
+func (at *AutoTrader) setTakeProfitOrders(d *decision.Decision, positionSide string, quantity, markPrice float64) error {
+	if len(d.TakeProfitLadder) == 0 {
+		return at.setTakeProfit(d.Symbol, positionSide, quantity, d.TakeProfit)
+	}
+
+	isLong := positionSide == PositionSideLong
+	if err := decision.ValidateTakeProfitLadder(d.TakeProfitLadder, isLong, markPrice); err != nil {
+		log.Printf("  ⚠ 分批止盈无效，改用单一止盈: %v", err)
+		return at.setTakeProfit(d.Symbol, positionSide, quantity, d.TakeProfit)
+	}
+
+	placed := 0
+	for i, level := range d.TakeProfitLadder {
+		sliceQty := quantity * level.Percent / 100
+		action := logger.DecisionAction{
+			Action:    "take_profit_ladder",
+			Symbol:    d.Symbol,
+			Quantity:  sliceQty,
+			Price:     level.Price,
+			Timestamp: at.now(),
+		}
+		if err := at.setTakeProfit(d.Symbol, positionSide, sliceQty, level.Price); err != nil {
+			log.Printf("  ⚠ 分批止盈第%d档设置失败: %v", i+1, err)
+			action.Error = err.Error()
+		} else {
+			log.Printf("  🎯 分批止盈第%d档: %.4f 平 %.0f%% (数量 %.6f)", i+1, level.Price, level.Percent, sliceQty)
+			action.Success = true
+			placed++
+		}
+		at.pendingActions = append(at.pendingActions, action)
+	}
+
+	if placed == 0 {
+		return fmt.Errorf("分批止盈全部设置失败")
+	}
 	return nil
 }
 
-// executeOpenShortWithRecord 执行开空仓并记录详细信息
-func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
-	log.Printf("  📉 开空仓: %s", decision.Symbol)
+// takePendingActions 取出执行决策过程中产生的附加动作
+func (at *AutoTrader) takePendingActions() []logger.DecisionAction {
+	actions := at.pendingActions
+	at.pendingActions = nil
+	return actions
+}
+
+// calculateOpenQuantity 计算开仓数量
+// 决策提供 risk_percent 时按风险定仓：数量 = 净值 × 风险百分比 / |入场价 - 止损价|，
+// 使触及止损时恰好亏损净值的该比例；名义价值受可用余额 × 杠杆限制。否则按 position_size_usd 计算
+func (at *AutoTrader) calculateOpenQuantity(d *decision.Decision, price float64, isLong bool) (float64, error) {
+	if d.RiskPercent <= 0 {
+		return d.PositionSizeUSD / price, nil
+	}
+
+	stopLoss := d.StopLoss
+	if stopLoss <= 0 {
+		stopLoss = d.NewStopLoss
+	}
+	if stopLoss <= 0 {
+		return 0, fmt.Errorf("❌ 按风险百分比定仓需要提供止损价")
+	}
+	if (isLong && stopLoss >= price) || (!isLong && stopLoss <= price) {
+		return 0, fmt.Errorf("❌ 止损价 %.4f 不在当前价 %.4f 的亏损一侧，无法按风险百分比定仓", stopLoss, price)
+	}
+
+	balance, err := at.trader.GetBalance()
+	if err != nil {
+		return 0, fmt.Errorf("获取账户余额失败: %w", err)
+	}
+	totalWalletBalance, _ := balance["totalWalletBalance"].(float64)
+	totalUnrealizedProfit, _ := balance["totalUnrealizedProfit"].(float64)
+	availableBalance, _ := balance["availableBalance"].(float64)
+	totalEquity := totalWalletBalance + totalUnrealizedProfit
+
+	riskUSD := totalEquity * d.RiskPercent / 100
+	quantity := riskUSD / math.Abs(price-stopLoss)
+	positionSizeUSD := quantity * price
+
+	// 名义价值不能超过可用余额在当前杠杆下可开的上限（含手续费，留1%余量避免保证金校验临界失败）
+	maxPositionSizeUSD := availableBalance * 0.99 / (1/float64(d.Leverage) + 0.0004)
+	if positionSizeUSD > maxPositionSizeUSD {
+		log.Printf("  ⚠️ 风险定仓 %.2f USDT 超过可用保证金上限 %.2f USDT（%dx），按上限开仓，止损亏损将低于 %.2f%%",
+			positionSizeUSD, maxPositionSizeUSD, d.Leverage, d.RiskPercent)
+		quantity = maxPositionSizeUSD / price
+		positionSizeUSD = maxPositionSizeUSD
+	}
 
-	// ⚠️ 关键：检查是否已有同币种同方向持仓，如果有则拒绝开仓（防止仓位叠加超限）
+	log.Printf("  📐 风险定仓: 净值 %.2f × %.2f%% = %.2f USDT，止损距离 %.4f，仓位 %.2f USDT",
+		totalEquity, d.RiskPercent, riskUSD, math.Abs(price-stopLoss), positionSizeUSD)
+	return quantity, nil
+}
+
+// maxSpreadBps 币种适用的点差上限（BTC/ETH 与山寨币两档，0=不检查）
+func (at *AutoTrader) maxSpreadBps(symbol string) float64 {
+	if symbol == "BTCUSDT" || symbol == "ETHUSDT" {
+		return at.config.BTCETHMaxSpreadBps
+	}
+	return at.config.AltcoinMaxSpreadBps
+}
+
+// checkSpread 开仓/加仓前校验最优买卖价差不超过上限（平仓不检查，始终允许退出）
+// 目前仅币安提供盘口数据；获取盘口失败时不阻止开仓
+func (at *AutoTrader) checkSpread(symbol string) error {
+	limit := at.maxSpreadBps(symbol)
+	if limit <= 0 || at.exchange != "binance" {
+		return nil
+	}
+
+	book, err := market.GetOrderBook(symbol)
+	if err != nil {
+		log.Printf("  ⚠️ %v，跳过点差检查", err)
+		return nil
+	}
+	spread, ok := market.SpreadBps(*book)
+	if !ok {
+		log.Printf("  ⚠️ %s 盘口数据不足，跳过点差检查", symbol)
+		return nil
+	}
+	if spread > limit {
+		log.Printf("  ⚠️ %s 点差过大，跳过开仓: %.1f bps > 上限 %.1f bps", symbol, spread, limit)
+		return fmt.Errorf("❌ %s 点差过大，跳过开仓: %.1f bps 超过上限 %.1f bps", symbol, spread, limit)
+	}
+	return nil
+}
+
+// checkMinNotional 开仓前校验订单名义价值是否满足交易所最小值（按交易所精度格式化后的数量计算）
+// 不足时：开启 AutoBumpMinNotional 则按步进值上调到最小值，否则拒绝开仓
+func (at *AutoTrader) checkMinNotional(symbol string, quantity, price float64) (float64, error) {
+	filters, err := at.trader.GetSymbolFilters(symbol)
+	if err != nil {
+		log.Printf("  ⚠️ 获取 %s 交易规则失败，跳过最小名义价值校验: %v", symbol, err)
+		return quantity, nil
+	}
+	if filters.MinNotional <= 0 || price <= 0 {
+		return quantity, nil
+	}
+
+	formatted := at.formatOrderQuantity(symbol, quantity)
+	notional := formatted * price
+	if notional >= filters.MinNotional {
+		return quantity, nil
+	}
+
+	if !at.config.AutoBumpMinNotional {
+		return 0, fmt.Errorf("❌ %w: %.2f USDT < %.2f USDT (数量: %.6f, 价格: %.4f)",
+			ErrMinNotional, notional, filters.MinNotional, formatted, price)
+	}
+
+	bumped := filters.MinNotional / price
+	if filters.StepSize > 0 {
+		bumped = math.Ceil(bumped/filters.StepSize-1e-9) * filters.StepSize
+	}
+	log.Printf("  ⬆️ %s 订单名义价值 %.2f USDT 低于最小值 %.2f USDT，数量上调: %.6f → %.6f",
+		symbol, notional, filters.MinNotional, formatted, bumped)
+	return bumped, nil
+}
+
+// checkPositionConcentration 校验开仓保证金占当前净值（钱包余额+未实现盈亏，不是初始余额）的比例不超过 MaxPositionPct
+// 超限时开启 ClampPositionSize 则按步进值缩减数量到上限，否则拒绝开仓；未配置上限时不检查
+func (at *AutoTrader) checkPositionConcentration(symbol string, quantity, price float64, leverage int) (float64, error) {
+	limitPct := at.config.MaxPositionPct
+	if limitPct <= 0 || price <= 0 || leverage <= 0 {
+		return quantity, nil
+	}
+
+	account, err := at.GetAccountInfo()
+	if err != nil {
+		return 0, fmt.Errorf("获取账户信息失败，无法校验单币种仓位上限: %w", err)
+	}
+	equity, _ := account["total_equity"].(float64)
+	if equity <= 0 {
+		return quantity, nil
+	}
+
+	margin := quantity * price / float64(leverage)
+	maxMargin := equity * limitPct / 100
+	if margin <= maxMargin {
+		return quantity, nil
+	}
+
+	pct := margin / equity * 100
+	if !at.config.ClampPositionSize {
+		return 0, fmt.Errorf("❌ %s 保证金 %.2f USDT 占净值 %.2f%%，超过单币种上限 %.2f%%", symbol, margin, pct, limitPct)
+	}
+
+	clamped := maxMargin * float64(leverage) / price
+	if filters, err := at.trader.GetSymbolFilters(symbol); err == nil && filters.StepSize > 0 {
+		clamped = math.Floor(clamped/filters.StepSize+1e-9) * filters.StepSize
+	}
+	log.Printf("  ⬇️ %s 保证金占净值 %.2f%% 超过上限 %.2f%%，数量缩减: %.6f → %.6f", symbol, pct, limitPct, quantity, clamped)
+	return clamped, nil
+}
+
+// checkExistingPosition 开仓前检查同币种已有持仓
+// 单向持仓：同币种已有任意方向持仓都拒绝（反向开仓会与原仓位相互抵消）
+// 双向持仓：仅拒绝同方向持仓，允许多空并存
+func (at *AutoTrader) checkExistingPosition(symbol, side string) error {
 	positions, err := at.trader.GetPositions()
-	if err == nil {
-		for _, pos := range positions {
-			if pos["symbol"] == decision.Symbol && pos["side"] == "short" {
-				return fmt.Errorf("❌ %s 已有空仓，拒绝开仓以防止仓位叠加超限。如需换仓，请先给出 close_short 决策", decision.Symbol)
+	if err != nil {
+		return nil
+	}
+
+	for _, pos := range positions {
+		if pos["symbol"] != symbol {
+			continue
+		}
+		posSide, _ := pos["side"].(string)
+		if posSide == side {
+			if side == "long" {
+				return fmt.Errorf("❌ %w: %s 多仓，拒绝开仓以防止仓位叠加超限。如需换仓，请先给出 close_long 决策", ErrPositionExists, symbol)
+			}
+			return fmt.Errorf("❌ %w: %s 空仓，拒绝开仓以防止仓位叠加超限。如需换仓，请先给出 close_short 决策", ErrPositionExists, symbol)
+		}
+		if !at.config.HedgeMode {
+			sideName := "多"
+			if posSide == "short" {
+				sideName = "空"
 			}
+			return fmt.Errorf("❌ %w: %s %s仓，单向持仓模式下不能同时持有反向仓位。如需反手，请先给出 close_%s 决策",
+				ErrPositionExists, symbol, sideName, posSide)
 		}
 	}
 
-	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	return nil
+}
+
+// countOpenPositions 统计当前真实持仓数量（忽略数量为0的空仓记录）
+func (at *AutoTrader) countOpenPositions() (int, error) {
+	positions, err := at.trader.GetPositions()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// 计算数量
-	quantity := decision.PositionSizeUSD / marketData.CurrentPrice
-	actionRecord.Quantity = quantity
-	actionRecord.Price = marketData.CurrentPrice
+	count := 0
+	for _, pos := range positions {
+		amt, _ := asFloat(pos["positionAmt"])
+		if amt != 0 && !at.isDustPosition(pos) {
+			count++ // 零头持仓不占用持仓数
+		}
+	}
+	return count, nil
+}
 
-	// ⚠️ 保证金验证：防止保证金不足错误（code=-2019）
-	requiredMargin := decision.PositionSizeUSD / float64(decision.Leverage)
+// updatePositionCorrelation 计算当前持仓的相关系数矩阵和摘要并缓存（供 GetStatus 使用），少于2个持仓时返回 nil
+func (at *AutoTrader) updatePositionCorrelation(positions []decision.PositionInfo) (map[string]map[string]float64, *market.CorrelationSummary) {
+	var matrix map[string]map[string]float64
+	var summary market.CorrelationSummary
+	if len(positions) >= 2 {
+		exposures := make([]market.Exposure, 0, len(positions))
+		symbols := make([]string, 0, len(positions))
+		for _, pos := range positions {
+			exposures = append(exposures, signedExposure(pos.Symbol, pos.Side, pos.Quantity*pos.MarkPrice))
+			symbols = append(symbols, pos.Symbol)
+		}
+		matrix = market.GetCorrelationMatrix(symbols)
+		summary = market.SummarizeCorrelation(matrix, exposures)
+	}
+
+	at.correlationMutex.Lock()
+	at.correlationSummary = summary
+	at.correlationMutex.Unlock()
+
+	if matrix == nil {
+		return nil, nil
+	}
+	return matrix, &summary
+}
+
+// updateMarketRegime 判断当前市场状态（BTC 4小时）并缓存（供开仓校验和 GetStatus 使用），获取失败时清空并返回 nil
+func (at *AutoTrader) updateMarketRegime() *market.MarketRegime {
+	regime, err := market.GetRegime(market.RegimeSymbol)
+	if err != nil {
+		log.Printf("⚠️  判断市场状态失败: %v", err)
+	}
+
+	at.marketRegimeMutex.Lock()
+	at.marketRegime = regime
+	at.marketRegimeMutex.Unlock()
+
+	if err != nil {
+		return nil
+	}
+	return &regime
+}
+
+// currentMarketRegime 返回最近一次周期判断的市场状态
+func (at *AutoTrader) currentMarketRegime() market.MarketRegime {
+	at.marketRegimeMutex.RLock()
+	defer at.marketRegimeMutex.RUnlock()
+	return at.marketRegime
+}
+
+// checkCorrelatedExposure 检查开仓后相关性调整的总敞口是否超过上限（未配置上限时不检查）
+// notional 为本次开仓的名义价值，side 为 long/short
+func (at *AutoTrader) checkCorrelatedExposure(symbol, side string, notional float64) error {
+	if at.config.MaxCorrelatedExposure <= 0 {
+		return nil
+	}
 
 	balance, err := at.trader.GetBalance()
 	if err != nil {
-		return fmt.Errorf("获取账户余额失败: %w", err)
+		return fmt.Errorf("获取账户余额失败，无法校验相关性敞口: %w", err)
 	}
-	availableBalance := 0.0
-	if avail, ok := balance["availableBalance"].(float64); ok {
-		availableBalance = avail
+	wallet, _ := balance["totalWalletBalance"].(float64)
+	unrealized, _ := balance["totalUnrealizedProfit"].(float64)
+	equity := wallet + unrealized
+	if equity <= 0 {
+		return nil
 	}
 
-	// 手续费估算（Taker费率 0.04%）
-	estimatedFee := decision.PositionSizeUSD * 0.0004
-	totalRequired := requiredMargin + estimatedFee
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return fmt.Errorf("获取持仓失败，无法校验相关性敞口: %w", err)
+	}
+	exposures := []market.Exposure{signedExposure(symbol, side, notional)}
+	symbols := []string{symbol}
+	for _, pos := range positions {
+		posSymbol, _ := pos["symbol"].(string)
+		posSide, _ := pos["side"].(string)
+		amt, _ := asFloat(pos["positionAmt"])
+		markPrice, _ := asFloat(pos["markPrice"])
+		if amt == 0 {
+			continue
+		}
+		exposures = append(exposures, signedExposure(posSymbol, posSide, math.Abs(amt)*markPrice))
+		symbols = append(symbols, posSymbol)
+	}
 
-	if totalRequired > availableBalance {
-		return fmt.Errorf("❌ 保证金不足: 需要 %.2f USDT（保证金 %.2f + 手续费 %.2f），可用 %.2f USDT",
-			totalRequired, requiredMargin, estimatedFee, availableBalance)
+	summary := market.SummarizeCorrelation(market.GetCorrelationMatrix(symbols), exposures)
+	limit := equity * at.config.MaxCorrelatedExposure
+	if summary.CorrelatedExposure > limit {
+		return fmt.Errorf("❌ 开仓后相关性调整敞口 %.2f USDT 超过上限 %.2f USDT（净值的 %.1f 倍），等效独立持仓仅 %.1f 个，拒绝开仓",
+			summary.CorrelatedExposure, limit, at.config.MaxCorrelatedExposure, summary.EffectivePositions)
+	}
+	return nil
+}
+
+// signedExposure 构造带方向的敞口（空仓名义价值取负）
+func signedExposure(symbol, side string, notional float64) market.Exposure {
+	if side == "short" {
+		notional = -notional
+	}
+	return market.Exposure{Symbol: symbol, Notional: notional}
+}
+
+// checkMaxOpenPositions 检查持仓数是否已达上限（未配置上限时不检查）
+func (at *AutoTrader) checkMaxOpenPositions() error {
+	if at.config.MaxOpenPositions <= 0 {
+		return nil
+	}
+
+	count, err := at.countOpenPositions()
+	if err != nil {
+		return fmt.Errorf("获取持仓失败，无法校验最大持仓数: %w", err)
+	}
+	count += at.batchReserved.positions
+	if count >= at.config.MaxOpenPositions {
+		return fmt.Errorf("❌ 当前持仓数 %d 已达上限 %d，拒绝开新仓。如需换仓，请先平掉已有仓位", count, at.config.MaxOpenPositions)
+	}
+	return nil
+}
+
+// executeOpenShortWithRecord 执行开空仓并记录详细信息
+func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	log.Printf("  📉 开空仓: %s", decision.Symbol)
+
+	plan, err := at.prepareOpen(decision, actionRecord, "short")
+	if err != nil {
+		return err
+	}
+
+	// 开仓
+	order, err := at.submitOrder(decision.Symbol, decision.Action, plan.orderType, plan.quantity, decision.Leverage)
+	if err != nil {
+		return err
+	}
+
+	at.finishOpen(decision, actionRecord, plan, order)
+	return nil
+}
+
+// executeAddPositionWithRecord 在已有持仓上加仓（add_position 加多仓，add_short 加空仓），加仓金额为 position_size_usd
+// 没有同方向持仓时拒绝（开新仓须使用 open_long/open_short）；成交后按成交量加权更新记录的开仓均价，
+// 并按加仓后的总数量重挂已记录的止损止盈单
+func (at *AutoTrader) executeAddPositionWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction, side string) error {
+	log.Printf("  ➕ 加仓(%s): %s", side, decision.Symbol)
+
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return fmt.Errorf("获取持仓失败: %w", err)
+	}
+	var existingQty, existingEntry float64
+	leverage := 0
+	for _, pos := range positions {
+		if pos["symbol"] != decision.Symbol || pos["side"] != side {
+			continue
+		}
+		amt, _ := asFloat(pos["positionAmt"])
+		existingQty = math.Abs(amt)
+		existingEntry, _ = asFloat(pos["entryPrice"])
+		lev, _ := asFloat(pos["leverage"])
+		leverage = int(lev)
+	}
+	if existingQty == 0 {
+		sideName := "多"
+		if side == "short" {
+			sideName = "空"
+		}
+		return fmt.Errorf("❌ %w: %s 没有%s仓，无法加仓。开新仓请使用 open_%s 决策", ErrPositionNotFound, decision.Symbol, sideName, side)
+	}
+	if decision.PositionSizeUSD <= 0 {
+		return fmt.Errorf("加仓金额必须大于0: %.2f", decision.PositionSizeUSD)
+	}
+	if leverage <= 0 {
+		leverage = clampLeverage(decision.Leverage)
+	}
+	actionRecord.Leverage = leverage
+
+	marketData, err := market.Get(decision.Symbol)
+	if err != nil {
+		return err
+	}
+	if err := at.checkSpread(decision.Symbol); err != nil {
+		return err
+	}
+	// 单币种仓位上限按现有持仓+加仓后的总保证金校验，缩减时只缩减加仓部分
+	totalQty, err := at.checkPositionConcentration(decision.Symbol, existingQty+decision.PositionSizeUSD/marketData.CurrentPrice, marketData.CurrentPrice, leverage)
+	if err != nil {
+		return err
+	}
+	if totalQty <= existingQty {
+		return fmt.Errorf("❌ %s 现有持仓保证金已达单币种上限 %.2f%%，无法加仓", decision.Symbol, at.config.MaxPositionPct)
+	}
+	quantity, err := at.checkMinNotional(decision.Symbol, totalQty-existingQty, marketData.CurrentPrice)
+	if err != nil {
+		return err
+	}
+	notional := quantity * marketData.CurrentPrice
+	actionRecord.Quantity = quantity
+	actionRecord.Price = marketData.CurrentPrice
+
+	if err := at.checkCorrelatedExposure(decision.Symbol, side, notional); err != nil {
+		return err
+	}
+
+	// 保证金验证（杠杆沿用现有持仓）
+	if leverage > 0 {
+		balance, err := at.trader.GetBalance()
+		if err != nil {
+			return fmt.Errorf("获取账户余额失败: %w", err)
+		}
+		availableBalance, _ := balance["availableBalance"].(float64)
+		requiredMargin := notional / float64(leverage)
+		estimatedFee := notional * 0.0004
+		if requiredMargin+estimatedFee > availableBalance {
+			return fmt.Errorf("❌ %w: 加仓需要 %.2f USDT（保证金 %.2f + 手续费 %.2f），可用 %.2f USDT",
+				ErrInsufficientMargin, requiredMargin+estimatedFee, requiredMargin, estimatedFee, availableBalance)
+		}
+		if err := at.reserveAccountExposure(decision.Symbol, requiredMargin+estimatedFee); err != nil {
+			return err
+		}
 	}
 
-	// 设置仓位模式
-	if err := at.trader.SetMarginMode(decision.Symbol, at.config.IsCrossMargin); err != nil {
-		log.Printf("  ⚠️ 设置仓位模式失败: %v", err)
-		// 继续执行，不影响交易
+	orderType, positionSide := "open_long", PositionSideLong
+	if side == "short" {
+		orderType, positionSide = "open_short", PositionSideShort
 	}
-
-	// 开仓
-	order, err := at.trader.OpenShort(decision.Symbol, quantity, decision.Leverage)
+	order, err := at.submitOrder(decision.Symbol, decision.Action, orderType, quantity, leverage)
 	if err != nil {
 		return err
 	}
-
-	// 记录订单ID
 	if orderID, ok := order["orderId"].(int64); ok {
 		actionRecord.OrderID = orderID
 	}
+	actionRecord.ClientOrderID, _ = order["clientOrderId"].(string)
+
+	totalQty = existingQty + quantity
+	blendedEntry := (existingQty*existingEntry + quantity*marketData.CurrentPrice) / totalQty
+	at.cycleLogger().Info("✓ 加仓成功",
+		"symbol", decision.Symbol,
+		"side", side,
+		"order_id", order["orderId"],
+		"quantity", quantity,
+		"total_quantity", totalQty,
+		"entry_price", existingEntry,
+		"blended_entry_price", blendedEntry)
+
+	posKey := decision.Symbol + "_" + side
+	at.positionStateMutex.Lock()
+	if pos, ok := at.lastPositions[posKey]; ok {
+		pos.EntryPrice = blendedEntry
+		pos.Quantity = totalQty
+		at.lastPositions[posKey] = pos
+	}
+	stop, takeProfit := at.positionStopLoss[posKey], at.positionTakeProfit[posKey]
+	pair, paired := at.protectivePairs[posKey]
+	at.positionStateMutex.Unlock()
+
+	at.resizeProtectiveOrders(decision.Symbol, positionSide, totalQty, stop, takeProfit, pair, paired, actionRecord)
+	return nil
+}
 
-	log.Printf("  ✓ 开仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
-
-	// 记录开仓时间
-	posKey := decision.Symbol + "_short"
-	at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+// resizeProtectiveOrders 加仓后按新的总数量重挂止损止盈（价格不变，数量随仓位等比例放大）
+// 未记录止损/止盈价的一侧不处理；分批止盈无法按档位还原，重挂为单一止盈单
+func (at *AutoTrader) resizeProtectiveOrders(symbol, positionSide string, quantity, stop, takeProfit float64, pair protectivePair, paired bool, entry *logger.DecisionAction) {
+	if stop <= 0 && takeProfit <= 0 {
+		return
+	}
 
-	// 设置止损止盈
-	if err := at.trader.SetStopLoss(decision.Symbol, "SHORT", quantity, decision.StopLoss); err != nil {
-		log.Printf("  ⚠ 设置止损失败: %v", err)
-	} else {
-		at.positionStopLoss[posKey] = decision.StopLoss // 记录止损价格
+	newAction := func(action string, price float64) logger.DecisionAction {
+		return logger.DecisionAction{
+			Action:        action,
+			Symbol:        symbol,
+			Quantity:      quantity,
+			Price:         price,
+			ParentOrderID: entry.OrderID,
+			OCOGroup:      pair.Group,
+			Timestamp:     at.now(),
+		}
 	}
-	if err := at.trader.SetTakeProfit(decision.Symbol, "SHORT", quantity, decision.TakeProfit); err != nil {
-		log.Printf("  ⚠ 设置止盈失败: %v", err)
-	} else {
-		at.positionTakeProfit[posKey] = decision.TakeProfit // 记录止盈价格
+	record := func(action logger.DecisionAction, err error) {
+		if err != nil {
+			log.Printf("  ⚠ 加仓后重挂%s失败: %v", action.Action, err)
+			action.Error = err.Error()
+		} else {
+			action.Success = true
+		}
+		at.pendingActions = append(at.pendingActions, action)
 	}
 
-	return nil
+	if oco, ok := at.trader.(OCOTrader); ok && paired && pair.Native && stop > 0 && takeProfit > 0 {
+		if err := at.trader.CancelStopOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消旧止损止盈单失败: %v", err)
+		}
+		err := at.setStopLossTakeProfit(oco, symbol, positionSide, quantity, stop, takeProfit)
+		slErr := err
+		if errors.Is(err, ErrTakeProfitNotSet) {
+			slErr = nil
+		}
+		record(newAction("stop_loss", stop), slErr)
+		record(newAction("take_profit", takeProfit), err)
+		return
+	}
+
+	if stop > 0 {
+		if err := at.trader.CancelStopLossOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消旧止损单失败: %v", err)
+		}
+		record(newAction("stop_loss", stop), at.setStopLoss(symbol, positionSide, quantity, stop))
+	}
+	if takeProfit > 0 {
+		if err := at.trader.CancelTakeProfitOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消旧止盈单失败: %v", err)
+		}
+		record(newAction("take_profit", takeProfit), at.setTakeProfit(symbol, positionSide, quantity, takeProfit))
+	}
 }
 
 // executeCloseLongWithRecord 执行平多仓并记录详细信息
@@ -892,8 +2450,8 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 	}
 	actionRecord.Price = marketData.CurrentPrice
 
-	// 平仓
-	order, err := at.trader.CloseLong(decision.Symbol, 0) // 0 = 全部平仓
+	// 平仓（按实时持仓校验，0 = 全部平仓）
+	order, _, err := at.closePosition(decision.Symbol, "long", 0, decision.Action)
 	if err != nil {
 		return err
 	}
@@ -902,8 +2460,9 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 	if orderID, ok := order["orderId"].(int64); ok {
 		actionRecord.OrderID = orderID
 	}
+	actionRecord.ClientOrderID, _ = order["clientOrderId"].(string)
 
-	log.Printf("  ✓ 平仓成功")
+	at.cycleLogger().Info("✓ 平仓成功", "symbol", decision.Symbol, "side", "long", "order_id", order["orderId"], "price", actionRecord.Price)
 	return nil
 }
 
@@ -918,8 +2477,8 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 	}
 	actionRecord.Price = marketData.CurrentPrice
 
-	// 平仓
-	order, err := at.trader.CloseShort(decision.Symbol, 0) // 0 = 全部平仓
+	// 平仓（按实时持仓校验，0 = 全部平仓）
+	order, _, err := at.closePosition(decision.Symbol, "short", 0, decision.Action)
 	if err != nil {
 		return err
 	}
@@ -928,11 +2487,256 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 	if orderID, ok := order["orderId"].(int64); ok {
 		actionRecord.OrderID = orderID
 	}
+	actionRecord.ClientOrderID, _ = order["clientOrderId"].(string)
 
-	log.Printf("  ✓ 平仓成功")
+	at.cycleLogger().Info("✓ 平仓成功", "symbol", decision.Symbol, "side", "short", "order_id", order["orderId"], "price", actionRecord.Price)
 	return nil
 }
 
+// closePosition 按实时持仓平仓：平仓数量超过当前持仓时截断为持仓数量，保证平仓单只减仓、不会反向开仓
+// quantity=0 表示全部平仓，返回实际提交的平仓数量（全部平仓时为持仓数量）；action 为触发平仓的决策动作（用于生成客户端订单ID）
+func (at *AutoTrader) closePosition(symbol, side string, quantity float64, action string) (map[string]interface{}, float64, error) {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return nil, 0, fmt.Errorf("获取持仓失败: %w", err)
+	}
+
+	held, unrealizedPnl := 0.0, 0.0
+	for _, pos := range positions {
+		if pos["symbol"] == symbol && pos["side"] == side {
+			amt, _ := asFloat(pos["positionAmt"])
+			held = math.Abs(amt)
+			unrealizedPnl, _ = asFloat(pos["unRealizedProfit"])
+			break
+		}
+	}
+	if held == 0 && quantity > 0 {
+		return nil, 0, fmt.Errorf("持仓不存在: %s %s", symbol, side)
+	}
+
+	orderQuantity := quantity // 0 = 全部平仓，由交易所适配器按最新持仓数量下单
+	if quantity > held {
+		log.Printf("  ⚠️ %s %s 平仓数量 %.8f 超过实际持仓 %.8f，截断为持仓数量", symbol, side, quantity, held)
+		orderQuantity = held
+	}
+
+	order, err := at.submitOrder(symbol, action, "close_"+side, orderQuantity, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	closedQuantity := orderQuantity
+	if closedQuantity <= 0 {
+		closedQuantity = held
+	}
+	if held > 0 {
+		// 按平仓比例估算本次平仓盈亏（下单前的未实现盈亏）
+		at.recordTradeResult(unrealizedPnl * closedQuantity / held)
+	}
+	return order, closedQuantity, nil
+}
+
+// recordTradeResult 记录一笔平仓的盈亏结果：更新连续亏损次数和盈亏平仓计数
+func (at *AutoTrader) recordTradeResult(pnl float64) {
+	at.positionStateMutex.Lock()
+	if pnl > 0 {
+		at.consecutiveLosses = 0
+	} else {
+		at.consecutiveLosses++
+	}
+	at.positionStateMutex.Unlock()
+	metrics.RecordTradeClosed(at.id, at.exchange, pnl)
+}
+
+// ConsecutiveLosses 返回连续亏损平仓次数
+func (at *AutoTrader) ConsecutiveLosses() int {
+	at.positionStateMutex.RLock()
+	defer at.positionStateMutex.RUnlock()
+	return at.consecutiveLosses
+}
+
+// orderSubmitAttempts 支持客户端订单ID的交易所下单最多尝试次数（同一ID重试由交易所去重）
+const orderSubmitAttempts = 2
+
+// orderRetryDelay 下单失败后重试前的等待时间（测试中置0）
+var orderRetryDelay = time.Second
+
+// defaultOrderTimeout 未配置下单超时时单笔下单的最长等待时间
+const defaultOrderTimeout = 10 * time.Second
+
+// clientOrderID 生成决策的确定性客户端订单ID：同一交易员实例、同一周期、同一币种和决策动作始终得到相同ID
+func clientOrderID(traderID string, seed int64, cycle int, symbol, action string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%s|%s", traderID, seed, cycle, symbol, action)))
+	return hex.EncodeToString(sum[:])[:20]
+}
+
+// isRetryableOrderError 判断下单失败是否值得重试：交易所明确拒绝（保证金不足、低于最小名义价值、
+// 持仓已存在/不存在）时重试结果不会改变
+func isRetryableOrderError(err error) bool {
+	return !errors.Is(err, ErrInsufficientMargin) &&
+		!errors.Is(err, ErrOrderTimeout) &&
+		!errors.Is(err, ErrMinNotional) &&
+		!errors.Is(err, ErrPositionExists) &&
+		!errors.Is(err, ErrPositionNotFound)
+}
+
+// orderTimeout 单次下单请求的超时时间（未配置时使用默认值）
+func (at *AutoTrader) orderTimeout() time.Duration {
+	if at.config.OrderTimeout > 0 {
+		return at.config.OrderTimeout
+	}
+	return defaultOrderTimeout
+}
+
+// awaitWithTimeout 在 timeout 内等待 call 返回，ok=false 表示超时（请求仍在后台完成，结果被丢弃）
+func awaitWithTimeout[T any](timeout time.Duration, call func() (T, error)) (result T, ok bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type outcome struct {
+		result T
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := call()
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, true, o.err
+	case <-ctx.Done():
+		return result, false, nil
+	}
+}
+
+// placeWithTimeout 在下单超时内等待交易所返回，超时后按客户端订单ID尝试撤单并返回 ErrOrderTimeout，
+// 避免交易所响应缓慢时阻塞整个扫描周期（超时的请求仍在后台完成，结果被丢弃）
+func (at *AutoTrader) placeWithTimeout(symbol, clientOrderID string, place func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	timeout := at.orderTimeout()
+	if order, ok, err := awaitWithTimeout(timeout, place); ok {
+		return order, err
+	}
+
+	if canceler, ok := at.trader.(OrderCanceler); ok {
+		log.Printf("  ⏱ %s 下单 %v 未返回，撤销订单 %s", symbol, timeout, clientOrderID)
+		if err := canceler.CancelOrderByClientID(symbol, clientOrderID); err != nil {
+			log.Printf("  ⚠️ %s 撤销超时订单 %s 失败（订单可能已成交或未到达交易所）: %v", symbol, clientOrderID, err)
+		}
+	} else {
+		log.Printf("  ⏱ %s 下单 %v 未返回（交易所不支持按客户端订单ID撤单）", symbol, timeout)
+	}
+	return nil, fmt.Errorf("%w: %s 订单 %s 在 %v 内未返回", ErrOrderTimeout, symbol, clientOrderID, timeout)
+}
+
+// submitOrder 以确定性客户端订单ID提交市价单（orderType: open_long / open_short / close_long / close_short）
+// 本周期内已成功提交过的同一决策直接返回原订单；交易所支持客户端订单ID时失败后用同一ID重试，
+// 请求已到达交易所但响应丢失时由交易所去重，只会产生一笔订单
+func (at *AutoTrader) submitOrder(symbol, action, orderType string, quantity float64, leverage int) (map[string]interface{}, error) {
+	id := clientOrderID(at.id, at.orderIDSeed, at.callCount, symbol, action)
+	if order, ok := at.lookupSubmittedOrder(id); ok {
+		log.Printf("  ↻ %s %s 本周期已提交过订单 %s，跳过重复下单", symbol, action, id)
+		return order, nil
+	}
+
+	place := func() (map[string]interface{}, error) {
+		switch orderType {
+		case "open_long":
+			return at.trader.OpenLong(symbol, PositionSideLong, quantity, leverage)
+		case "open_short":
+			return at.trader.OpenShort(symbol, PositionSideShort, quantity, leverage)
+		case "close_long":
+			return at.trader.CloseLong(symbol, PositionSideLong, quantity)
+		default:
+			return at.trader.CloseShort(symbol, PositionSideShort, quantity)
+		}
+	}
+	attempts := 1
+	if idTrader, ok := at.trader.(ClientOrderIDTrader); ok {
+		attempts = orderSubmitAttempts
+		place = func() (map[string]interface{}, error) {
+			switch orderType {
+			case "open_long":
+				return idTrader.OpenLongWithClientID(symbol, PositionSideLong, quantity, leverage, id)
+			case "open_short":
+				return idTrader.OpenShortWithClientID(symbol, PositionSideShort, quantity, leverage, id)
+			case "close_long":
+				return idTrader.CloseLongWithClientID(symbol, PositionSideLong, quantity, id)
+			default:
+				return idTrader.CloseShortWithClientID(symbol, PositionSideShort, quantity, id)
+			}
+		}
+	}
+
+	var order map[string]interface{}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		order, err = at.placeWithTimeout(symbol, id, place)
+		if err == nil {
+			break
+		}
+		metrics.ExchangeErrors.WithLabelValues(at.id, at.exchange).Inc()
+		if !isRetryableOrderError(err) {
+			break
+		}
+		if attempt < attempts {
+			log.Printf("  ⚠️ %s %s 下单失败（第%d次），使用同一订单ID %s 重试: %v", symbol, action, attempt, id, err)
+			time.Sleep(orderRetryDelay)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return at.recordSubmittedOrder(id, symbol, action, orderType, quantity, leverage, order), nil
+}
+
+// lookupSubmittedOrder 查找本周期已成功提交的订单（进入新周期时清空记录）
+func (at *AutoTrader) lookupSubmittedOrder(id string) (map[string]interface{}, bool) {
+	at.submittedOrdersMutex.Lock()
+	defer at.submittedOrdersMutex.Unlock()
+	if at.submittedOrders == nil || at.submittedOrdersCycle != at.callCount {
+		at.submittedOrders = make(map[string]map[string]interface{})
+		at.submittedOrdersCycle = at.callCount
+	}
+	order, ok := at.submittedOrders[id]
+	return order, ok
+}
+
+// recordSubmittedOrder 记录本周期已成功提交的订单（周期内去重），并发送开仓/平仓事件
+func (at *AutoTrader) recordSubmittedOrder(id, symbol, action, orderType string, quantity float64, leverage int, order map[string]interface{}) map[string]interface{} {
+	if order == nil {
+		order = make(map[string]interface{})
+	}
+	if _, ok := order["clientOrderId"]; !ok {
+		order["clientOrderId"] = id
+	}
+
+	at.submittedOrdersMutex.Lock()
+	if at.submittedOrdersCycle == at.callCount {
+		at.submittedOrders[id] = order
+	}
+	at.submittedOrdersMutex.Unlock()
+
+	eventType, side, _ := strings.Cut(orderType, "_")
+	payload := map[string]interface{}{
+		"symbol":          symbol,
+		"side":            side,
+		"action":          action,
+		"quantity":        quantity,
+		"order_id":        order["orderId"],
+		"client_order_id": order["clientOrderId"],
+	}
+	if eventType == "open" {
+		payload["leverage"] = leverage
+		metrics.TradesOpened.WithLabelValues(at.id, at.exchange).Inc()
+		at.emit(EventTradeOpened, payload)
+	} else {
+		at.emit(EventTradeClosed, payload)
+	}
+	return order
+}
+
 // executeUpdateStopLossWithRecord 执行调整止损并记录详细信息
 func (at *AutoTrader) executeUpdateStopLossWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	log.Printf("  🎯 调整止损: %s → %.2f", decision.Symbol, decision.NewStopLoss)
@@ -954,7 +2758,7 @@ func (at *AutoTrader) executeUpdateStopLossWithRecord(decision *decision.Decisio
 	var targetPosition map[string]interface{}
 	for _, pos := range positions {
 		symbol, _ := pos["symbol"].(string)
-		posAmt, _ := pos["positionAmt"].(float64)
+		posAmt, _ := asFloat(pos["positionAmt"])
 		if symbol == decision.Symbol && posAmt != 0 {
 			targetPosition = pos
 			break
@@ -968,7 +2772,7 @@ func (at *AutoTrader) executeUpdateStopLossWithRecord(decision *decision.Decisio
 	// 获取持仓方向和数量
 	side, _ := targetPosition["side"].(string)
 	positionSide := strings.ToUpper(side)
-	positionAmt, _ := targetPosition["positionAmt"].(float64)
+	positionAmt, _ := asFloat(targetPosition["positionAmt"])
 
 	// 验证新止损价格合理性
 	if positionSide == "LONG" && decision.NewStopLoss >= marketData.CurrentPrice {
@@ -984,7 +2788,7 @@ func (at *AutoTrader) executeUpdateStopLossWithRecord(decision *decision.Decisio
 	for _, pos := range positions {
 		symbol, _ := pos["symbol"].(string)
 		posSide, _ := pos["side"].(string)
-		posAmt, _ := pos["positionAmt"].(float64)
+		posAmt, _ := asFloat(pos["positionAmt"])
 		if symbol == decision.Symbol && posAmt != 0 && strings.ToUpper(posSide) != positionSide {
 			hasOppositePosition = true
 			oppositeSide = strings.ToUpper(posSide)
@@ -1008,7 +2812,7 @@ func (at *AutoTrader) executeUpdateStopLossWithRecord(decision *decision.Decisio
 
 	// 调用交易所 API 修改止损
 	quantity := math.Abs(positionAmt)
-	err = at.trader.SetStopLoss(decision.Symbol, positionSide, quantity, decision.NewStopLoss)
+	err = at.setStopLoss(decision.Symbol, positionSide, quantity, decision.NewStopLoss)
 	if err != nil {
 		return fmt.Errorf("修改止损失败: %w", err)
 	}
@@ -1038,7 +2842,7 @@ func (at *AutoTrader) executeUpdateTakeProfitWithRecord(decision *decision.Decis
 	var targetPosition map[string]interface{}
 	for _, pos := range positions {
 		symbol, _ := pos["symbol"].(string)
-		posAmt, _ := pos["positionAmt"].(float64)
+		posAmt, _ := asFloat(pos["positionAmt"])
 		if symbol == decision.Symbol && posAmt != 0 {
 			targetPosition = pos
 			break
@@ -1052,7 +2856,7 @@ func (at *AutoTrader) executeUpdateTakeProfitWithRecord(decision *decision.Decis
 	// 获取持仓方向和数量
 	side, _ := targetPosition["side"].(string)
 	positionSide := strings.ToUpper(side)
-	positionAmt, _ := targetPosition["positionAmt"].(float64)
+	positionAmt, _ := asFloat(targetPosition["positionAmt"])
 
 	// 验证新止盈价格合理性
 	if positionSide == "LONG" && decision.NewTakeProfit <= marketData.CurrentPrice {
@@ -1068,7 +2872,7 @@ func (at *AutoTrader) executeUpdateTakeProfitWithRecord(decision *decision.Decis
 	for _, pos := range positions {
 		symbol, _ := pos["symbol"].(string)
 		posSide, _ := pos["side"].(string)
-		posAmt, _ := pos["positionAmt"].(float64)
+		posAmt, _ := asFloat(pos["positionAmt"])
 		if symbol == decision.Symbol && posAmt != 0 && strings.ToUpper(posSide) != positionSide {
 			hasOppositePosition = true
 			oppositeSide = strings.ToUpper(posSide)
@@ -1092,7 +2896,7 @@ func (at *AutoTrader) executeUpdateTakeProfitWithRecord(decision *decision.Decis
 
 	// 调用交易所 API 修改止盈
 	quantity := math.Abs(positionAmt)
-	err = at.trader.SetTakeProfit(decision.Symbol, positionSide, quantity, decision.NewTakeProfit)
+	err = at.setTakeProfit(decision.Symbol, positionSide, quantity, decision.NewTakeProfit)
 	if err != nil {
 		return fmt.Errorf("修改止盈失败: %w", err)
 	}
@@ -1103,11 +2907,16 @@ func (at *AutoTrader) executeUpdateTakeProfitWithRecord(decision *decision.Decis
 
 // executePartialCloseWithRecord 执行部分平仓并记录详细信息
 func (at *AutoTrader) executePartialCloseWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
-	log.Printf("  📊 部分平仓: %s %.1f%%", decision.Symbol, decision.ClosePercentage)
-
-	// 验证百分比范围
-	if decision.ClosePercentage <= 0 || decision.ClosePercentage > 100 {
-		return fmt.Errorf("平仓百分比必须在 0-100 之间，当前: %.1f", decision.ClosePercentage)
+	// 验证平仓数量/百分比范围（设置了 close_quantity 时优先按数量平仓）
+	if decision.CloseQuantity > 0 {
+		log.Printf("  📊 部分平仓: %s 数量 %.8f", decision.Symbol, decision.CloseQuantity)
+	} else if decision.CloseQuantity < 0 {
+		return fmt.Errorf("平仓数量必须大于0，当前: %.8f", decision.CloseQuantity)
+	} else {
+		log.Printf("  📊 部分平仓: %s %.1f%%", decision.Symbol, decision.ClosePercentage)
+		if decision.ClosePercentage <= 0 || decision.ClosePercentage > 100 {
+			return fmt.Errorf("平仓百分比必须在 0-100 之间，当前: %.1f", decision.ClosePercentage)
+		}
 	}
 
 	// 获取当前价格
@@ -1127,7 +2936,7 @@ func (at *AutoTrader) executePartialCloseWithRecord(decision *decision.Decision,
 	var targetPosition map[string]interface{}
 	for _, pos := range positions {
 		symbol, _ := pos["symbol"].(string)
-		posAmt, _ := pos["positionAmt"].(float64)
+		posAmt, _ := asFloat(pos["positionAmt"])
 		if symbol == decision.Symbol && posAmt != 0 {
 			targetPosition = pos
 			break
@@ -1141,15 +2950,23 @@ func (at *AutoTrader) executePartialCloseWithRecord(decision *decision.Decision,
 	// 获取持仓方向和数量
 	side, _ := targetPosition["side"].(string)
 	positionSide := strings.ToUpper(side)
-	positionAmt, _ := targetPosition["positionAmt"].(float64)
+	positionAmt, _ := asFloat(targetPosition["positionAmt"])
 
 	// 计算平仓数量
 	totalQuantity := math.Abs(positionAmt)
 	closeQuantity := totalQuantity * (decision.ClosePercentage / 100.0)
+	if decision.CloseQuantity > 0 {
+		closeQuantity = decision.CloseQuantity
+		if closeQuantity > totalQuantity {
+			log.Printf("  ⚠️ 平仓数量 %.8f 超过持仓 %.8f，按持仓数量平仓", closeQuantity, totalQuantity)
+			closeQuantity = totalQuantity
+		}
+	}
+	closePct := closeQuantity / totalQuantity * 100
 	actionRecord.Quantity = closeQuantity
 
 	// ✅ Layer 2: 最小仓位检查（防止产生小额剩余）
-	markPrice, ok := targetPosition["markPrice"].(float64)
+	markPrice, ok := asFloat(targetPosition["markPrice"])
 	if !ok || markPrice <= 0 {
 		return fmt.Errorf("无法解析当前价格，无法执行最小仓位检查")
 	}
@@ -1164,7 +2981,7 @@ func (at *AutoTrader) executePartialCloseWithRecord(decision *decision.Decision,
 		log.Printf("⚠️ 检测到 partial_close 后剩余仓位 %.2f USDT < %.0f USDT",
 			remainingValue, MIN_POSITION_VALUE)
 		log.Printf("  → 当前仓位价值: %.2f USDT, 平仓 %.1f%%, 剩余: %.2f USDT",
-			currentPositionValue, decision.ClosePercentage, remainingValue)
+			currentPositionValue, closePct, remainingValue)
 		log.Printf("  → 自动修正为全部平仓，避免产生无法平仓的小额剩余")
 
 		// 🔄 自动修正为全部平仓
@@ -1179,32 +2996,29 @@ func (at *AutoTrader) executePartialCloseWithRecord(decision *decision.Decision,
 		}
 	}
 
-	// 执行平仓
-	var order map[string]interface{}
-	if positionSide == "LONG" {
-		order, err = at.trader.CloseLong(decision.Symbol, closeQuantity)
-	} else {
-		order, err = at.trader.CloseShort(decision.Symbol, closeQuantity)
-	}
-
+	// 执行平仓（下单前再按实时持仓截断数量）
+	order, closeQuantity, err := at.closePosition(decision.Symbol, side, closeQuantity, decision.Action)
 	if err != nil {
 		return fmt.Errorf("部分平仓失败: %w", err)
 	}
+	actionRecord.Quantity = closeQuantity
+	remainingQuantity = totalQuantity - closeQuantity
 
 	// 记录订单ID
 	if orderID, ok := order["orderId"].(int64); ok {
 		actionRecord.OrderID = orderID
 	}
+	actionRecord.ClientOrderID, _ = order["clientOrderId"].(string)
 
 	log.Printf("  ✓ 部分平仓成功: 平仓 %.4f (%.1f%%), 剩余 %.4f",
-		closeQuantity, decision.ClosePercentage, remainingQuantity)
+		closeQuantity, closeQuantity/totalQuantity*100, remainingQuantity)
 
 	// ✅ Step 4: 恢复止盈止损（防止剩余仓位裸奔）
 	// 重要：币安等交易所在部分平仓后会自动取消原有的 TP/SL 订单（因为数量不匹配）
 	// 如果 AI 提供了新的止损止盈价格，则为剩余仓位重新设置保护
 	if decision.NewStopLoss > 0 {
 		log.Printf("  → 为剩余仓位 %.4f 恢复止损单: %.2f", remainingQuantity, decision.NewStopLoss)
-		err = at.trader.SetStopLoss(decision.Symbol, positionSide, remainingQuantity, decision.NewStopLoss)
+		err = at.setStopLoss(decision.Symbol, positionSide, remainingQuantity, decision.NewStopLoss)
 		if err != nil {
 			log.Printf("  ⚠️ 恢复止损失败: %v（不影响平仓结果）", err)
 		}
@@ -1212,7 +3026,7 @@ func (at *AutoTrader) executePartialCloseWithRecord(decision *decision.Decision,
 
 	if decision.NewTakeProfit > 0 {
 		log.Printf("  → 为剩余仓位 %.4f 恢复止盈单: %.2f", remainingQuantity, decision.NewTakeProfit)
-		err = at.trader.SetTakeProfit(decision.Symbol, positionSide, remainingQuantity, decision.NewTakeProfit)
+		err = at.setTakeProfit(decision.Symbol, positionSide, remainingQuantity, decision.NewTakeProfit)
 		if err != nil {
 			log.Printf("  ⚠️ 恢复止盈失败: %v（不影响平仓结果）", err)
 		}
@@ -1233,6 +3047,11 @@ func (at *AutoTrader) GetID() string {
 	return at.id
 }
 
+// Logger 获取交易员的结构化日志（携带 trader_id/user_id/exchange 字段）
+func (at *AutoTrader) Logger() *slog.Logger {
+	return at.traderLogger()
+}
+
 // GetName 获取trader名称
 func (at *AutoTrader) GetName() string {
 	return at.name
@@ -1263,6 +3082,22 @@ func (at *AutoTrader) SetSystemPromptTemplate(templateName string) {
 	at.systemPromptTemplate = templateName
 }
 
+// StrategyTag 当前策略标签：优先使用配置的标签，否则为 模板名[@自定义prompt摘要]，修改prompt后自动变为新版本
+func (at *AutoTrader) StrategyTag() string {
+	if at.config.StrategyTag != "" {
+		return at.config.StrategyTag
+	}
+	tag := at.systemPromptTemplate
+	if tag == "" {
+		tag = "default"
+	}
+	if at.customPrompt != "" {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%t|%s", at.overrideBasePrompt, at.customPrompt)))
+		tag += "@" + hex.EncodeToString(sum[:4])
+	}
+	return tag
+}
+
 // GetSystemPromptTemplate 获取当前系统提示词模板名称
 func (at *AutoTrader) GetSystemPromptTemplate() string {
 	return at.systemPromptTemplate
@@ -1273,6 +3108,38 @@ func (at *AutoTrader) GetDecisionLogger() logger.IDecisionLogger {
 	return at.decisionLogger
 }
 
+// reconcileOpenLookback 核对盈亏时向前多读取的决策记录时长，用于匹配核对区间之前开仓、区间内平仓的交易
+const reconcileOpenLookback = 7 * 24 * time.Hour
+
+// ReconcilePnL 将 since 之后根据决策日志推算的已平仓盈亏与交易所资金流水核对（交易所需支持查询资金流水）
+func (at *AutoTrader) ReconcilePnL(since time.Time, tolerance float64) (*logger.PnLReconciliation, error) {
+	incomeTrader, ok := at.trader.(IncomeHistoryTrader)
+	if !ok {
+		return nil, fmt.Errorf("交易所 %s 不支持查询资金流水", at.exchange)
+	}
+	history, err := incomeTrader.GetIncomeHistory(since)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := at.decisionLogger.ReadRecords(0, since)
+	if err != nil {
+		return nil, fmt.Errorf("读取决策记录失败: %w", err)
+	}
+	allRecords, err := at.decisionLogger.ReadRecords(0, since.Add(-reconcileOpenLookback))
+	if err != nil {
+		allRecords = nil
+	}
+	slices.Reverse(records) // ReadRecords 从新到旧，分析需要按时间正序
+	slices.Reverse(allRecords)
+
+	income := make([]logger.ExchangeIncome, 0, len(history))
+	for _, item := range history {
+		income = append(income, logger.ExchangeIncome{Symbol: item.Symbol, Type: item.IncomeType, Amount: item.Income, Time: item.Time})
+	}
+	return logger.ReconcilePnL(logger.AnalyzeRecords(records, allRecords), income, since, tolerance), nil
+}
+
 // GetStatus 获取系统状态（用于API）
 func (at *AutoTrader) GetStatus() map[string]interface{} {
 	aiProvider := "DeepSeek"
@@ -1280,21 +3147,207 @@ func (at *AutoTrader) GetStatus() map[string]interface{} {
 		aiProvider = "Qwen"
 	}
 
+	// 获取失败时返回 -1，避免与“无持仓”混淆
+	openPositions, err := at.countOpenPositions()
+	if err != nil {
+		openPositions = -1
+	}
+
+	at.dailyLossMutex.RLock()
+	lastResetTime := at.lastResetTime
+	dailyPnLPct := at.dailyPnLPctLocked()
+	haltedUntil := at.tradingHaltedUntil
+	initialBalance := at.initialBalance
+	lastRebaselineTime := at.lastRebaselineTime
+	at.dailyLossMutex.RUnlock()
+
+	at.correlationMutex.RLock()
+	correlation := at.correlationSummary
+	at.correlationMutex.RUnlock()
+
 	return map[string]interface{}{
 		"trader_id":       at.id,
 		"trader_name":     at.name,
 		"ai_model":        at.aiModel,
 		"exchange":        at.exchange,
-		"is_running":      at.isRunning,
+		"is_running":      at.isRunning.Load(),
+		"is_stopping":     !at.isRunning.Load() && at.loopActive.Load(), // 已停止但当前周期仍在执行，结束前不能重新启动
+		"disabled":        at.IsDisabled(),
 		"start_time":      at.startTime.Format(time.RFC3339),
-		"runtime_minutes": int(time.Since(at.startTime).Minutes()),
+		"runtime_minutes": int(at.since(at.startTime).Minutes()),
 		"call_count":      at.callCount,
-		"initial_balance": at.initialBalance,
-		"scan_interval":   at.config.ScanInterval.String(),
+		"strategy_tag":    at.StrategyTag(),
+		"shadow_ai_model": aiModelLabel(at.config.ShadowAIModel, at.config.ShadowModelName),
+		"manual_holds":    at.ManualHolds(),
+		"consecutive_losses": at.ConsecutiveLosses(),
+		"initial_balance": initialBalance,
+		"last_rebaseline_time": lastRebaselineTime.Format(time.RFC3339),
+		"scan_interval":   at.config.ScanInterval.String(), // 名义扫描间隔（不含随机抖动）
 		"stop_until":      at.stopUntil.Format(time.RFC3339),
-		"last_reset_time": at.lastResetTime.Format(time.RFC3339),
+		"last_reset_time": lastResetTime.Format(time.RFC3339),
 		"ai_provider":     aiProvider,
+		"token_usage":     at.GetTokenUsage(),
+		"stop_cooldowns":  at.GetStopLossCooldowns(),
+		"repeat_backoff_symbols": at.repeatBackoffCount(), // 因连续重复决策暂停的币种数
+		"skipped_ai_calls":     at.skippedAICalls.Load(), // 无持仓且无触发条件而跳过AI调用的周期数
+		"open_positions":       openPositions,
+		"max_open_positions":   at.config.MaxOpenPositions,
+		"daily_pnl_pct":        dailyPnLPct,
+		"trading_halted_until": haltedUntil.Format(time.RFC3339),
+		"correlation": map[string]interface{}{ // 最近一次周期的持仓相关性（少于2个持仓时为0）
+			"max_pair_correlation": correlation.MaxCorrelation,
+			"max_pair":             correlation.MaxPair,
+			"effective_positions":  correlation.EffectivePositions,
+		},
+		"market_regime": at.currentMarketRegime(), // 最近一次周期的市场状态（BTC 4小时，未获取到时 regime 为空）
+	}
+}
+
+// recordStopLoss 记录币种的止损平仓时间（开启止损冷却时生效）
+func (at *AutoTrader) recordStopLoss(symbol string, closedAt time.Time) {
+	at.stopLossTimeMutex.Lock()
+	defer at.stopLossTimeMutex.Unlock()
+
+	if at.lastStopLossTime == nil {
+		at.lastStopLossTime = make(map[string]time.Time)
+	}
+	at.lastStopLossTime[symbol] = closedAt
+}
+
+// stopLossCooldownRemaining 返回币种剩余的止损冷却时间（未开启或已过期返回 0）
+func (at *AutoTrader) stopLossCooldownRemaining(symbol string) time.Duration {
+	if at.config.PostStopCooldown <= 0 {
+		return 0
+	}
+
+	at.stopLossTimeMutex.RLock()
+	closedAt, ok := at.lastStopLossTime[symbol]
+	at.stopLossTimeMutex.RUnlock()
+	if !ok {
+		return 0
+	}
+
+	remaining := time.Until(closedAt.Add(at.config.PostStopCooldown))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// resetDailyLossIfNewDay 跨过日界（按交易员时区，默认UTC）时重置日盈亏和熔断状态
+func (at *AutoTrader) resetDailyLossIfNewDay(now time.Time) {
+	at.dailyLossMutex.Lock()
+	defer at.dailyLossMutex.Unlock()
+
+	loc := at.dayLocation()
+	if dayStart(at.lastResetTime, loc).Equal(dayStart(now, loc)) {
+		return
+	}
+	at.dailyPnL = 0
+	at.dayStartEquity = 0 // 下次检查时以当时净值作为当日起点
+	at.tradingHaltedUntil = time.Time{}
+	at.lastResetTime = now
+	log.Println("📅 日盈亏已重置")
+}
+
+// checkDailyLoss 用当前净值更新当日盈亏，亏损超过 MaxDailyLoss 时熔断至次日0点（按交易员时区）
+// 触发时返回 daily_loss_halt 动作供写入决策记录，未触发（或已处于熔断中）返回 nil
+func (at *AutoTrader) checkDailyLoss(totalEquity float64, now time.Time) *logger.DecisionAction {
+	if totalEquity <= 0 {
+		return nil // 净值获取异常时不更新，避免误触发
+	}
+
+	at.dailyLossMutex.Lock()
+	defer at.dailyLossMutex.Unlock()
+
+	// 当日首次检查：以当前净值作为起点（含此前已实现盈亏，之后的已实现+未实现变化都计入当日）
+	if at.dayStartEquity <= 0 {
+		at.dayStartEquity = totalEquity
+	}
+	at.dailyPnL = totalEquity - at.dayStartEquity
+
+	if at.config.MaxDailyLoss <= 0 || now.Before(at.tradingHaltedUntil) {
+		return nil
+	}
+
+	pct := at.dailyPnLPctLocked()
+	if pct > -at.config.MaxDailyLoss {
+		return nil
+	}
+
+	at.tradingHaltedUntil = dayStart(now, at.dayLocation()).AddDate(0, 0, 1)
+	detail := fmt.Sprintf("当日盈亏 %.2f USDT (%.2f%%) 超过上限 -%.2f%%，%s 前停止开新仓",
+		at.dailyPnL, pct, at.config.MaxDailyLoss, at.tradingHaltedUntil.Format(time.RFC3339))
+	log.Printf("🛑 日亏损熔断: %s", detail)
+	at.emit(EventHalted, map[string]interface{}{
+		"reason": "daily_loss",
+		"detail": detail,
+		"until":  at.tradingHaltedUntil.Format(time.RFC3339),
+	})
+
+	return &logger.DecisionAction{
+		Action:    "daily_loss_halt",
+		Timestamp: now,
+		Success:   true,
+		Detail:    detail,
+	}
+}
+
+// dailyPnLPctLocked 当日盈亏百分比（以初始余额为基准，未设置时退回当日起始净值），调用方需持有 dailyLossMutex
+func (at *AutoTrader) dailyPnLPctLocked() float64 {
+	base := at.initialBalance
+	if base <= 0 {
+		base = at.dayStartEquity
+	}
+	if base <= 0 {
+		return 0
+	}
+	return at.dailyPnL / base * 100
+}
+
+// dailyLossHaltedUntil 获取日亏损熔断截止时间（未熔断时为零值）
+func (at *AutoTrader) dailyLossHaltedUntil() time.Time {
+	at.dailyLossMutex.RLock()
+	defer at.dailyLossMutex.RUnlock()
+	return at.tradingHaltedUntil
+}
+
+// getDailyPnL 获取当日盈亏
+func (at *AutoTrader) getDailyPnL() float64 {
+	at.dailyLossMutex.RLock()
+	defer at.dailyLossMutex.RUnlock()
+	return at.dailyPnL
+}
+
+// GetStopLossCooldowns 获取冷却中的币种及冷却结束时间 (symbol -> RFC3339)
+func (at *AutoTrader) GetStopLossCooldowns() map[string]string {
+	cooldowns := make(map[string]string)
+	if at.config.PostStopCooldown <= 0 {
+		return cooldowns
+	}
+
+	at.stopLossTimeMutex.RLock()
+	defer at.stopLossTimeMutex.RUnlock()
+	for symbol, closedAt := range at.lastStopLossTime {
+		if until := closedAt.Add(at.config.PostStopCooldown); at.now().Before(until) {
+			cooldowns[symbol] = until.Format(time.RFC3339)
+		}
 	}
+	return cooldowns
+}
+
+// addTokenUsage 累加一次AI调用的token用量
+func (at *AutoTrader) addTokenUsage(usage mcp.Usage) {
+	at.tokenUsageMutex.Lock()
+	defer at.tokenUsageMutex.Unlock()
+	at.tokenUsage.Add(usage)
+}
+
+// GetTokenUsage 获取自启动以来累计的AI token用量
+func (at *AutoTrader) GetTokenUsage() mcp.Usage {
+	at.tokenUsageMutex.Lock()
+	defer at.tokenUsageMutex.Unlock()
+	return at.tokenUsage
 }
 
 // GetAccountInfo 获取账户信息（用于API）
@@ -1331,16 +3384,16 @@ func (at *AutoTrader) GetAccountInfo() (map[string]interface{}, error) {
 	totalMarginUsed := 0.0
 	totalUnrealizedPnLCalculated := 0.0
 	for _, pos := range positions {
-		entryPrice := pos["entryPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
+		entryPrice, _ := asFloat(pos["entryPrice"])
+		quantity, _ := asFloat(pos["positionAmt"])
 		if quantity < 0 {
 			quantity = -quantity
 		}
-		unrealizedPnl := pos["unRealizedProfit"].(float64)
+		unrealizedPnl, _ := asFloat(pos["unRealizedProfit"])
 		totalUnrealizedPnLCalculated += unrealizedPnl
 
 		leverage := 10
-		if lev, ok := pos["leverage"].(float64); ok {
+		if lev, ok := asFloat(pos["leverage"]); ok {
 			leverage = int(lev)
 		}
 		marginUsed := (quantity * entryPrice) / float64(leverage)
@@ -1354,12 +3407,13 @@ func (at *AutoTrader) GetAccountInfo() (map[string]interface{}, error) {
 			totalUnrealizedProfit, totalUnrealizedPnLCalculated, diff)
 	}
 
-	totalPnL := totalEquity - at.initialBalance
+	initialBalance := at.getInitialBalance()
+	totalPnL := totalEquity - initialBalance
 	totalPnLPct := 0.0
-	if at.initialBalance > 0 {
-		totalPnLPct = (totalPnL / at.initialBalance) * 100
+	if initialBalance > 0 {
+		totalPnLPct = (totalPnL / initialBalance) * 100
 	} else {
-		log.Printf("⚠️ Initial Balance异常: %.2f，无法计算PNL百分比", at.initialBalance)
+		log.Printf("⚠️ Initial Balance异常: %.2f，无法计算PNL百分比", initialBalance)
 	}
 
 	marginUsedPct := 0.0
@@ -1377,8 +3431,8 @@ func (at *AutoTrader) GetAccountInfo() (map[string]interface{}, error) {
 		// 盈亏统计
 		"total_pnl":       totalPnL,          // 总盈亏 = equity - initial
 		"total_pnl_pct":   totalPnLPct,       // 总盈亏百分比
-		"initial_balance": at.initialBalance, // 初始余额
-		"daily_pnl":       at.dailyPnL,       // 日盈亏
+		"initial_balance": initialBalance,   // 初始余额
+		"daily_pnl":       at.getDailyPnL(),  // 日盈亏（当日UTC已实现+未实现）
 
 		// 持仓信息
 		"position_count":  len(positions),  // 持仓数量
@@ -1394,21 +3448,22 @@ func (at *AutoTrader) GetPositions() ([]map[string]interface{}, error) {
 		return nil, fmt.Errorf("获取持仓失败: %w", err)
 	}
 
+	funding := at.newFundingAccrual(positions)
 	var result []map[string]interface{}
 	for _, pos := range positions {
 		symbol := pos["symbol"].(string)
 		side := pos["side"].(string)
-		entryPrice := pos["entryPrice"].(float64)
-		markPrice := pos["markPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
+		entryPrice, _ := asFloat(pos["entryPrice"])
+		markPrice, _ := asFloat(pos["markPrice"])
+		quantity, _ := asFloat(pos["positionAmt"])
 		if quantity < 0 {
 			quantity = -quantity
 		}
-		unrealizedPnl := pos["unRealizedProfit"].(float64)
-		liquidationPrice := pos["liquidationPrice"].(float64)
+		unrealizedPnl, _ := asFloat(pos["unRealizedProfit"])
+		liquidationPrice, _ := asFloat(pos["liquidationPrice"])
 
 		leverage := 10
-		if lev, ok := pos["leverage"].(float64); ok {
+		if lev, ok := asFloat(pos["leverage"]); ok {
 			leverage = int(lev)
 		}
 
@@ -1418,6 +3473,15 @@ func (at *AutoTrader) GetPositions() ([]map[string]interface{}, error) {
 		// 计算盈亏百分比（基于保证金）
 		pnlPct := calculatePnLPercentage(unrealizedPnl, marginUsed)
 
+		// 持仓时长（从首次发现持仓开始计时）和盈亏拆分（资金费从首次发现持仓开始累计）
+		ageSeconds := int64(0)
+		var breakdown PnLBreakdown
+		if quantity > 0 {
+			openedAt := at.markPositionSeen(symbol + "_" + side)
+			ageSeconds = (at.now().UnixMilli() - openedAt) / 1000
+			breakdown = funding.breakdown(symbol, side, openedAt, entryPrice, markPrice, quantity, marginUsed)
+		}
+
 		result = append(result, map[string]interface{}{
 			"symbol":             symbol,
 			"side":               side,
@@ -1429,12 +3493,37 @@ func (at *AutoTrader) GetPositions() ([]map[string]interface{}, error) {
 			"unrealized_pnl_pct": pnlPct,
 			"liquidation_price":  liquidationPrice,
 			"margin_used":        marginUsed,
+			"age_seconds":        ageSeconds,
+			"gross_pnl":          breakdown.GrossPnL,
+			"funding_cost":       breakdown.FundingCost,
+			"close_fee":          breakdown.CloseFee,
+			"net_pnl":            breakdown.NetPnL,
+			"net_pnl_pct":        breakdown.NetPnLPct,
+			"funding_estimated":  breakdown.FundingEstimated,
+			"is_dust":            at.isDustPosition(pos),
 		})
 	}
 
 	return result, nil
 }
 
+// asFloat 宽松解析持仓字段：部分交易所适配器以字符串或 json.Number 返回数量/价格
+// 无法解析时返回 (0, false)，调用方不会因类型断言 panic
+func asFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
 // calculatePnLPercentage 计算盈亏百分比（基于保证金，自动考虑杠杆）
 // 收益率 = 未实现盈亏 / 保证金 × 100%
 func calculatePnLPercentage(unrealizedPnl, marginUsed float64) float64 {
@@ -1458,8 +3547,8 @@ func sortDecisionsByPriority(decisions []decision.Decision) []decision.Decision
 			return 1 // 最高优先级：先平仓（包括部分平仓）
 		case "update_stop_loss", "update_take_profit":
 			return 2 // 调整持仓止盈止损
-		case "open_long", "open_short":
-			return 3 // 次优先级：后开仓
+		case "open_long", "open_short", "add_position", "add_short":
+			return 3 // 次优先级：后开仓（含加仓）
 		case "hold", "wait":
 			return 4 // 最低优先级：观望
 		default:
@@ -1483,8 +3572,100 @@ func sortDecisionsByPriority(decisions []decision.Decision) []decision.Decision
 	return sorted
 }
 
-// getCandidateCoins 获取交易员的候选币种列表
+// dedupeDecisions 对排序后的决策去重（保持原有顺序）：
+//   - 同一币种的同一动作只保留第一条（AI 偶尔会重复输出同一决策）
+//   - 同一币种同时出现 open_long 和 open_short 时两者都丢弃，不执行互相矛盾的订单
+//
+// 返回保留的决策和被丢弃决策的说明
+func dedupeDecisions(decisions []decision.Decision) ([]decision.Decision, []string) {
+	conflicted := make(map[string]bool)
+	opens := make(map[string]string)
+	for _, d := range decisions {
+		if d.Action != "open_long" && d.Action != "open_short" {
+			continue
+		}
+		if prev, ok := opens[d.Symbol]; ok && prev != d.Action {
+			conflicted[d.Symbol] = true
+		}
+		opens[d.Symbol] = d.Action
+	}
+
+	kept := make([]decision.Decision, 0, len(decisions))
+	var dropped []string
+	seen := make(map[string]bool)
+	for _, d := range decisions {
+		if (d.Action == "open_long" || d.Action == "open_short") && conflicted[d.Symbol] {
+			dropped = append(dropped, fmt.Sprintf("%s %s 已丢弃: 同一周期同时开多和开空，决策矛盾", d.Symbol, d.Action))
+			continue
+		}
+		key := d.Symbol + "|" + d.Action
+		if seen[key] {
+			dropped = append(dropped, fmt.Sprintf("%s %s 已丢弃: 重复决策", d.Symbol, d.Action))
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, d)
+	}
+	return kept, dropped
+}
+
+// getCandidateCoins 获取交易员的候选币种列表（启用OI Top信号源时并入OI Top币种）
 func (at *AutoTrader) getCandidateCoins() ([]decision.CandidateCoin, error) {
+	candidateCoins, err := at.baseCandidateCoins()
+	if err != nil {
+		return nil, err
+	}
+	return at.mergeOITopCandidates(candidateCoins), nil
+}
+
+// mergeOITopCandidates 将交易员OI Top信号源的币种并入候选列表：已有币种追加 "oi_top" 来源，新币种追加到末尾
+// 获取失败时沿用原候选列表（OI Top是可选信号源）
+func (at *AutoTrader) mergeOITopCandidates(candidateCoins []decision.CandidateCoin) []decision.CandidateCoin {
+	if !at.config.UseOITop || at.config.OITopAPIURL == "" {
+		at.oiTopSymbols = nil
+		return candidateCoins
+	}
+
+	symbols, err := pool.GetOITopSymbolsFrom(at.config.OITopAPIURL)
+	if err != nil {
+		log.Printf("⚠️  [%s] 获取OI Top信号源失败，仅使用原候选币种: %v", at.name, err)
+		return candidateCoins
+	}
+
+	index := make(map[string]int, len(candidateCoins))
+	for i, coin := range candidateCoins {
+		index[coin.Symbol] = i
+	}
+	oiTopSymbols := make(map[string]bool, len(symbols))
+	added := 0
+	for _, symbol := range symbols {
+		symbol = normalizeSymbol(symbol)
+		if oiTopSymbols[symbol] {
+			continue
+		}
+		oiTopSymbols[symbol] = true
+		if i, exists := index[symbol]; exists {
+			if !slices.Contains(candidateCoins[i].Sources, "oi_top") {
+				candidateCoins[i].Sources = append(candidateCoins[i].Sources, "oi_top")
+			}
+			continue
+		}
+		index[symbol] = len(candidateCoins)
+		candidateCoins = append(candidateCoins, decision.CandidateCoin{
+			Symbol:  symbol,
+			Sources: []string{"oi_top"},
+		})
+		added++
+	}
+	at.oiTopSymbols = oiTopSymbols
+
+	log.Printf("📋 [%s] 并入OI Top信号源: %d个币种（新增%d个），总计%d个候选币种",
+		at.name, len(oiTopSymbols), added, len(candidateCoins))
+	return candidateCoins
+}
+
+// baseCandidateCoins 按自定义币种、数据库默认币种、合并币种池的优先级获取候选币种
+func (at *AutoTrader) baseCandidateCoins() ([]decision.CandidateCoin, error) {
 	if len(at.tradingCoins) == 0 {
 		// 使用数据库配置的默认币种列表
 		var candidateCoins []decision.CandidateCoin
@@ -1510,8 +3691,10 @@ func (at *AutoTrader) getCandidateCoins() ([]decision.CandidateCoin, error) {
 				return nil, fmt.Errorf("获取合并币种池失败: %w", err)
 			}
 
-			// 构建候选币种列表（包含来源信息）
+			// 构建候选币种列表（包含来源信息），并记录为允许开仓范围
+			at.poolSymbols = make(map[string]bool, len(mergedPool.AllSymbols))
 			for _, symbol := range mergedPool.AllSymbols {
+				at.poolSymbols[normalizeSymbol(symbol)] = true
 				sources := mergedPool.SymbolSources[symbol]
 				candidateCoins = append(candidateCoins, decision.CandidateCoin{
 					Symbol:  symbol,
@@ -1535,10 +3718,71 @@ func (at *AutoTrader) getCandidateCoins() ([]decision.CandidateCoin, error) {
 			})
 		}
 
-		log.Printf("📋 [%s] 使用自定义币种: %d个币种 %v",
-			at.name, len(candidateCoins), at.tradingCoins)
-		return candidateCoins, nil
+		log.Printf("📋 [%s] 使用自定义币种: %d个币种 %v",
+			at.name, len(candidateCoins), at.tradingCoins)
+		return candidateCoins, nil
+	}
+}
+
+// contextOnlySymbols 本周期仅作参考的币种：AlwaysContextSymbols 中既不是候选币种也没有持仓的（已在候选或持仓中的随其提交，可正常交易）
+func (at *AutoTrader) contextOnlySymbols(positions []decision.PositionInfo, candidates []decision.CandidateCoin) []string {
+	if len(at.config.AlwaysContextSymbols) == 0 {
+		return nil
+	}
+	present := make(map[string]bool, len(positions)+len(candidates))
+	for _, pos := range positions {
+		present[pos.Symbol] = true
+	}
+	for _, coin := range candidates {
+		present[coin.Symbol] = true
+	}
+
+	var symbols []string
+	for _, symbol := range at.config.AlwaysContextSymbols {
+		symbol = normalizeSymbol(symbol)
+		if present[symbol] {
+			continue
+		}
+		present[symbol] = true
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// allowedSymbols 当前允许开仓的币种集合（与 getCandidateCoins 的来源一致），范围未知时返回 nil 表示不限制
+func (at *AutoTrader) allowedSymbols() map[string]bool {
+	coins := at.tradingCoins
+	if len(coins) == 0 {
+		coins = at.defaultCoins
+	}
+	if len(coins) == 0 && at.poolSymbols == nil {
+		return nil
+	}
+
+	allowed := make(map[string]bool, len(coins)+len(at.poolSymbols)+len(at.oiTopSymbols))
+	for _, coin := range coins {
+		allowed[normalizeSymbol(coin)] = true
+	}
+	if len(coins) == 0 {
+		maps.Copy(allowed, at.poolSymbols)
+	}
+	maps.Copy(allowed, at.oiTopSymbols) // 交易员OI Top信号源并入的币种
+	return allowed
+}
+
+// checkSymbolScope 开仓前校验币种：黑名单始终拒绝，且必须在允许交易的币种范围内（防止AI返回候选列表之外的币种）
+func (at *AutoTrader) checkSymbolScope(symbol string) error {
+	normalized := normalizeSymbol(symbol)
+	for _, blocked := range at.config.BlacklistSymbols {
+		if normalizeSymbol(blocked) == normalized {
+			return fmt.Errorf("❌ %s 在黑名单中，拒绝开仓", normalized)
+		}
+	}
+
+	if allowed := at.allowedSymbols(); allowed != nil && !allowed[normalized] {
+		return fmt.Errorf("❌ %s 不在允许交易的币种范围内，拒绝开仓（可能是AI返回了候选列表之外的币种）", normalized)
 	}
+	return nil
 }
 
 // normalizeSymbol 标准化币种符号（确保以USDT结尾）
@@ -1560,15 +3804,16 @@ func (at *AutoTrader) startDrawdownMonitor() {
 	go func() {
 		defer at.monitorWg.Done()
 
-		ticker := time.NewTicker(1 * time.Minute) // 每分钟检查一次
+		ticker := clock.Or(at.clock).NewTicker(1 * time.Minute) // 每分钟检查一次
 		defer ticker.Stop()
 
 		log.Println("📊 启动持仓回撤监控（每分钟检查一次）")
 
 		for {
 			select {
-			case <-ticker.C:
+			case <-ticker.C():
 				at.checkPositionDrawdown()
+				at.checkMaxHoldTime()
 			case <-at.stopMonitorCh:
 				log.Println("⏹ 停止持仓回撤监控")
 				return
@@ -1589,16 +3834,22 @@ func (at *AutoTrader) checkPositionDrawdown() {
 	for _, pos := range positions {
 		symbol := pos["symbol"].(string)
 		side := pos["side"].(string)
-		entryPrice := pos["entryPrice"].(float64)
-		markPrice := pos["markPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
+		if at.isManualHold(symbol) {
+			continue // 手动持仓不做回撤平仓
+		}
+		if at.isDustPosition(pos) {
+			continue // 零头持仓由决策周期统一清理
+		}
+		entryPrice, _ := asFloat(pos["entryPrice"])
+		markPrice, _ := asFloat(pos["markPrice"])
+		quantity, _ := asFloat(pos["positionAmt"])
 		if quantity < 0 {
 			quantity = -quantity // 空仓数量为负，转为正数
 		}
 
 		// 计算当前盈亏百分比
 		leverage := 10 // 默认值
-		if lev, ok := pos["leverage"].(float64); ok {
+		if lev, ok := asFloat(pos["leverage"]); ok {
 			leverage = int(lev)
 		}
 
@@ -1638,7 +3889,10 @@ func (at *AutoTrader) checkPositionDrawdown() {
 				symbol, side, currentPnLPct, peakPnLPct, drawdownPct)
 
 			// 执行平仓
-			if err := at.emergencyClosePosition(symbol, side); err != nil {
+			at.positionMutex.Lock()
+			err := at.emergencyClosePosition(symbol, side)
+			at.positionMutex.Unlock()
+			if err != nil {
 				log.Printf("❌ 回撤平仓失败 (%s %s): %v", symbol, side, err)
 			} else {
 				log.Printf("✅ 回撤平仓成功: %s %s", symbol, side)
@@ -1653,17 +3907,128 @@ func (at *AutoTrader) checkPositionDrawdown() {
 	}
 }
 
+// now 返回时间源的当前时间（冷却期、最长持仓、日切重置等时间相关逻辑统一使用）
+func (at *AutoTrader) now() time.Time {
+	return clock.Or(at.clock).Now()
+}
+
+// since 返回时间源的当前时间距 t 的时长
+func (at *AutoTrader) since(t time.Time) time.Duration {
+	return clock.Or(at.clock).Since(t)
+}
+
+// markPositionSeen 返回持仓首次出现时间（毫秒），首次发现时记录为当前时间
+func (at *AutoTrader) markPositionSeen(posKey string) int64 {
+	at.positionStateMutex.Lock()
+	defer at.positionStateMutex.Unlock()
+	if _, exists := at.positionFirstSeenTime[posKey]; !exists {
+		at.positionFirstSeenTime[posKey] = at.now().UnixMilli()
+	}
+	return at.positionFirstSeenTime[posKey]
+}
+
+// checkMaxHoldTime 强制平掉持仓时间超过 MaxHoldTime 的持仓（不论盈亏）
+// 同时清理交易所已不存在的持仓的首次出现时间：手动平仓后同方向重新出现的持仓按新持仓重新计时，
+// 不会沿用上一笔持仓的时长而被立即平掉
+func (at *AutoTrader) checkMaxHoldTime() {
+	if at.config.MaxHoldTime <= 0 {
+		return
+	}
+
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		log.Printf("❌ 持仓时间监控：获取持仓失败: %v", err)
+		return
+	}
+
+	liveKeys := make(map[string]bool)
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		quantity, _ := asFloat(pos["positionAmt"])
+		if symbol != "" && quantity != 0 {
+			liveKeys[symbol+"_"+side] = true
+		}
+	}
+	at.positionStateMutex.Lock()
+	for key := range at.positionFirstSeenTime {
+		if !liveKeys[key] {
+			delete(at.positionFirstSeenTime, key)
+		}
+	}
+	at.positionStateMutex.Unlock()
+
+	record := &logger.DecisionRecord{
+		Exchange: at.exchange,
+	}
+	now := at.now()
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		posKey := symbol + "_" + side
+		if !liveKeys[posKey] {
+			continue
+		}
+		age := now.Sub(time.UnixMilli(at.markPositionSeen(posKey)))
+		if age < at.config.MaxHoldTime || at.isManualHold(symbol) {
+			continue
+		}
+
+		quantity, _ := asFloat(pos["positionAmt"])
+		if quantity < 0 {
+			quantity = -quantity
+		}
+		markPrice, _ := asFloat(pos["markPrice"])
+		log.Printf("⏰ 持仓超时平仓: %s %s | 持仓时长: %s | 上限: %s",
+			symbol, side, age.Truncate(time.Second), at.config.MaxHoldTime)
+
+		action := logger.DecisionAction{
+			Action:    "auto_close_timeout",
+			Symbol:    symbol,
+			Quantity:  quantity,
+			Price:     markPrice,
+			Timestamp: now,
+		}
+		at.positionMutex.Lock()
+		err := at.emergencyClosePosition(symbol, side)
+		at.positionMutex.Unlock()
+		if err != nil {
+			log.Printf("❌ 超时平仓失败 (%s %s): %v", symbol, side, err)
+			action.Error = err.Error()
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 超时平仓失败: %v", symbol, side, err))
+		} else {
+			action.Success = true
+			at.ClearPeakPnLCache(symbol, side)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 持仓 %s 超时平仓", symbol, side, age.Truncate(time.Second)))
+		}
+		record.Decisions = append(record.Decisions, action)
+	}
+
+	// 平仓结果由下一周期的被动平仓检测计入交易统计，这里记录的 auto_close_timeout 动作仅用于审计
+	if len(record.Decisions) > 0 {
+		record.Success = true
+		for _, action := range record.Decisions {
+			if !action.Success {
+				record.Success = false
+			}
+		}
+		if err := at.decisionLogger.LogDecision(record); err != nil {
+			log.Printf("⚠ 保存超时平仓记录失败: %v", err)
+		}
+	}
+}
+
 // 紧急平仓函数
 func (at *AutoTrader) emergencyClosePosition(symbol, side string) error {
 	switch side {
 	case "long":
-		order, err := at.trader.CloseLong(symbol, 0) // 0 = 全部平仓
+		order, err := at.trader.CloseLong(symbol, PositionSideLong, 0) // 0 = 全部平仓
 		if err != nil {
 			return err
 		}
 		log.Printf("✅ 紧急平多仓成功，订单ID: %v", order["orderId"])
 	case "short":
-		order, err := at.trader.CloseShort(symbol, 0) // 0 = 全部平仓
+		order, err := at.trader.CloseShort(symbol, PositionSideShort, 0) // 0 = 全部平仓
 		if err != nil {
 			return err
 		}
@@ -1675,6 +4040,104 @@ func (at *AutoTrader) emergencyClosePosition(symbol, side string) error {
 	return nil
 }
 
+// FlattenedPosition 一键平仓中已平掉的持仓
+type FlattenedPosition struct {
+	Symbol    string  `json:"symbol"`
+	Side      string  `json:"side"`
+	Quantity  float64 `json:"quantity"`
+	MarkPrice float64 `json:"mark_price"`
+}
+
+// FlattenResult 一键平仓结果
+type FlattenResult struct {
+	Closed []FlattenedPosition `json:"closed"`
+	Errors map[string]string   `json:"errors,omitempty"` // symbol 或 symbol_side -> 错误信息
+}
+
+// FlattenAll 手动一键平掉所有持仓并撤销挂单（极端行情下的紧急按钮）
+// 单个币种失败不会中断其余币种；可在扫描循环运行时调用（与执行决策共用持仓操作锁）
+// 平仓结果由下一周期的被动平仓检测计入交易统计，这里记录的 manual_flatten 动作仅用于审计
+func (at *AutoTrader) FlattenAll() (*FlattenResult, error) {
+	at.positionMutex.Lock()
+	defer at.positionMutex.Unlock()
+
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return nil, fmt.Errorf("获取持仓失败: %w", err)
+	}
+
+	result := &FlattenResult{
+		Closed: []FlattenedPosition{},
+		Errors: make(map[string]string),
+	}
+	record := &logger.DecisionRecord{
+		Exchange: at.exchange,
+	}
+
+	log.Printf("🚨 [%s] 手动一键平仓: %d 个持仓", at.name, len(positions))
+
+	symbols := make(map[string]bool)
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		quantity, _ := asFloat(pos["positionAmt"])
+		if quantity < 0 {
+			quantity = -quantity
+		}
+		if symbol == "" || quantity == 0 {
+			continue
+		}
+		symbols[symbol] = true
+		markPrice, _ := asFloat(pos["markPrice"])
+
+		action := logger.DecisionAction{
+			Action:    "manual_flatten",
+			Symbol:    symbol,
+			Quantity:  quantity,
+			Price:     markPrice,
+			Timestamp: at.now(),
+		}
+		if err := at.emergencyClosePosition(symbol, side); err != nil {
+			log.Printf("❌ 一键平仓失败 (%s %s): %v", symbol, side, err)
+			action.Error = err.Error()
+			result.Errors[symbol+"_"+side] = err.Error()
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 平仓失败: %v", symbol, side, err))
+		} else {
+			action.Success = true
+			at.ClearPeakPnLCache(symbol, side)
+			result.Closed = append(result.Closed, FlattenedPosition{
+				Symbol:    symbol,
+				Side:      side,
+				Quantity:  quantity,
+				MarkPrice: markPrice,
+			})
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 已平仓", symbol, side))
+		}
+		record.Decisions = append(record.Decisions, action)
+	}
+
+	// 撤销每个币种的剩余挂单（止盈止损等），避免平仓后被触发反向开仓
+	for symbol := range symbols {
+		if err := at.trader.CancelAllOrders(symbol); err != nil {
+			log.Printf("⚠️  撤销 %s 挂单失败: %v", symbol, err)
+			result.Errors[symbol] = fmt.Sprintf("撤销挂单失败: %v", err)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠️ %s 撤销挂单失败: %v", symbol, err))
+		}
+	}
+
+	record.Success = len(result.Errors) == 0
+	if !record.Success {
+		record.ErrorMessage = fmt.Sprintf("%d 项操作失败", len(result.Errors))
+	}
+	if len(record.Decisions) > 0 {
+		if err := at.decisionLogger.LogDecision(record); err != nil {
+			log.Printf("⚠ 保存一键平仓记录失败: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
 // GetPeakPnLCache 获取最高收益缓存
 func (at *AutoTrader) GetPeakPnLCache() map[string]float64 {
 	at.peakPnLCacheMutex.RLock()
@@ -1714,9 +4177,344 @@ func (at *AutoTrader) ClearPeakPnLCache(symbol, side string) {
 	delete(at.peakPnLCache, posKey)
 }
 
+// reconcilePositions 对账：以交易所持仓为准修正内部状态
+// 用户在交易所界面手动平仓、或上一周期异常退出时，lastPositions / peakPnLCache /
+// positionFirstSeenTime 等缓存会残留已不存在的持仓，这里统一检测并清理：
+//  1. 成交推送收到的被动平仓成交 → 按真实成交价/数量/手续费生成 auto_close_* 或 partial_close 记录
+//  2. lastPositions 中消失且未被成交推送覆盖的持仓 → 推断价格和原因生成 auto_close_* 记录（兜底）
+//  3. 其他缓存中残留的孤立 key → 生成 reconciliation 记录并删除
+func (at *AutoTrader) reconcilePositions(record *logger.DecisionRecord) {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		// 获取失败时不做任何清理，避免误删
+		log.Printf("⚠️ 对账失败，跳过本次清理: %v", err)
+		return
+	}
+
+	// 交易所真实持仓
+	var livePositions []decision.PositionInfo
+	liveKeys := make(map[string]bool)
+	liveSymbols := make(map[string]bool)
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		positionAmt, _ := asFloat(pos["positionAmt"])
+		if symbol == "" || positionAmt == 0 {
+			continue
+		}
+		liveKeys[symbol+"_"+side] = true
+		liveSymbols[symbol] = true
+		livePositions = append(livePositions, decision.PositionInfo{Symbol: symbol, Side: side})
+	}
+
+	// 1. 成交推送确认的被动平仓（真实成交，优先于快照推断）
+	streamActions, closedKeys := at.fillCloseActions(at.takePendingFills(), liveKeys)
+	if len(streamActions) > 0 {
+		record.Decisions = append(record.Decisions, streamActions...)
+		log.Printf("🔔 成交推送确认 %d 个被动平仓/减仓", len(streamActions))
+		for _, action := range streamActions {
+			log.Printf("   └─ %s %s | 成交: %.4f @ %.4f | 手续费: %.4f | 原因: %s",
+				action.Symbol, action.Action, action.Quantity, action.Price, action.Fee, action.Error)
+		}
+	}
+
+	// 2. 兜底：对比持仓快照检测被动平仓（止损/止盈/强平/手动），跳过已由成交推送记录的持仓
+	var closedPositions []decision.PositionInfo
+	for _, pos := range at.detectClosedPositions(livePositions) {
+		if !closedKeys[pos.Symbol+"_"+pos.Side] {
+			closedPositions = append(closedPositions, pos)
+		}
+	}
+	if len(closedPositions) > 0 {
+		autoCloseActions := at.generateAutoCloseActions(closedPositions)
+		record.Decisions = append(record.Decisions, autoCloseActions...)
+		log.Printf("🔔 检测到 %d 个被动平仓", len(closedPositions))
+		for i, closed := range closedPositions {
+			closedKeys[closed.Symbol+"_"+closed.Side] = true
+			action := autoCloseActions[i]
+			pnl := closed.Quantity * (closed.MarkPrice - closed.EntryPrice)
+			if closed.Side == "short" {
+				pnl = -pnl
+			}
+			pnlPct := pnl / (closed.EntryPrice * closed.Quantity) * 100 * float64(closed.Leverage)
+			at.recordTradeResult(pnl)
+
+			// 平仓原因中文映射
+			reasonMap := map[string]string{
+				"stop_loss":   "止损",
+				"take_profit": "止盈",
+				"liquidation": "强平",
+				"unknown":     "未知",
+			}
+			reasonCN := reasonMap[action.Error]
+			if reasonCN == "" {
+				reasonCN = action.Error
+			}
+
+			log.Printf("   └─ %s %s | 开仓: %.4f → 平仓: %.4f | 盈亏: %+.2f%% | 原因: %s",
+				closed.Symbol,
+				closed.Side,
+				closed.EntryPrice,
+				action.Price,    // 使用推断的平仓价格
+				pnlPct,
+				reasonCN)
+		}
+	}
+
+	// 3. 收集所有内部缓存中的孤立 key（交易所已不存在的持仓）
+	orphans := make(map[string][]string) // posKey -> 被清理的缓存名称
+	at.positionStateMutex.Lock()
+	for key := range at.lastPositions {
+		if !liveKeys[key] {
+			orphans[key] = append(orphans[key], "lastPositions")
+			delete(at.lastPositions, key)
+		}
+	}
+	for key := range at.positionFirstSeenTime {
+		if !liveKeys[key] {
+			orphans[key] = append(orphans[key], "positionFirstSeenTime")
+			delete(at.positionFirstSeenTime, key)
+		}
+	}
+	for key := range at.positionStopLoss {
+		if !liveKeys[key] {
+			orphans[key] = append(orphans[key], "positionStopLoss")
+			delete(at.positionStopLoss, key)
+		}
+	}
+	for key := range at.positionTakeProfit {
+		if !liveKeys[key] {
+			orphans[key] = append(orphans[key], "positionTakeProfit")
+			delete(at.positionTakeProfit, key)
+		}
+	}
+	for key := range at.positionLeverage {
+		if !liveKeys[key] {
+			orphans[key] = append(orphans[key], "positionLeverage")
+			delete(at.positionLeverage, key)
+		}
+	}
+	closedPairs := make(map[string]protectivePair)
+	for key, pair := range at.protectivePairs {
+		if !liveKeys[key] {
+			closedPairs[key] = pair
+			delete(at.protectivePairs, key)
+		}
+	}
+	at.positionStateMutex.Unlock()
+	record.Decisions = append(record.Decisions, at.cancelPairSurvivors(closedPairs, liveKeys)...)
+	at.peakPnLCacheMutex.Lock()
+	for key := range at.peakPnLCache {
+		if !liveKeys[key] {
+			orphans[key] = append(orphans[key], "peakPnLCache")
+			delete(at.peakPnLCache, key)
+		}
+	}
+	at.peakPnLCacheMutex.Unlock()
+	at.clearClosedManualHolds(liveSymbols)
+
+	// 4. 记录对账动作（已生成 auto_close 记录的持仓不再重复记录）
+	for key, cleaned := range orphans {
+		if closedKeys[key] {
+			continue
+		}
+		symbol := key
+		if idx := strings.LastIndex(key, "_"); idx > 0 {
+			symbol = key[:idx]
+		}
+		log.Printf("🧹 对账清理 %s 的残留缓存: %s", key, strings.Join(cleaned, ", "))
+		record.Decisions = append(record.Decisions, logger.DecisionAction{
+			Action:    "reconciliation",
+			Symbol:    symbol,
+			Timestamp: at.now(),
+			Success:   true,
+			Detail:    fmt.Sprintf("cleaned %s: %s", key, strings.Join(cleaned, ",")),
+		})
+	}
+}
+
+// klineWarmupTimeout 启动时等待K线缓存预热的最长时间
+const klineWarmupTimeout = 30 * time.Second
+
+// waitForKlineWarmup 首个决策周期前等待候选币种的K线缓存就绪，超时则继续运行（未就绪币种走API兜底）
+func (at *AutoTrader) waitForKlineWarmup() {
+	if market.WSMonitorCli == nil {
+		return
+	}
+	candidateCoins, err := at.getCandidateCoins()
+	if err != nil {
+		log.Printf("⚠️ [%s] 获取候选币种失败，跳过K线预热: %v", at.name, err)
+		return
+	}
+
+	symbols := make([]string, 0, len(candidateCoins))
+	for _, coin := range candidateCoins {
+		symbols = append(symbols, coin.Symbol)
+	}
+	if cold := market.WSMonitorCli.WaitForWarmup(symbols, klineWarmupTimeout); len(cold) == 0 {
+		log.Printf("🔥 [%s] %d 个候选币种K线缓存已就绪", at.name, len(symbols))
+	}
+}
+
+// startFillStream 交易所支持用户数据流时启动成交推送，被动平仓优先使用真实成交记录
+func (at *AutoTrader) startFillStream() {
+	streamer, ok := at.trader.(FillStreamer)
+	if !ok {
+		return
+	}
+	if err := streamer.StartFillStream(at.handleFill); err != nil {
+		log.Printf("⚠️ [%s] 启动成交推送失败，使用持仓快照对比检测被动平仓: %v", at.name, err)
+		return
+	}
+
+	at.fillMutex.Lock()
+	at.fillStreamer = streamer
+	at.fillMutex.Unlock()
+}
+
+// stopFillStream 停止成交推送
+func (at *AutoTrader) stopFillStream() {
+	at.fillMutex.Lock()
+	streamer := at.fillStreamer
+	at.fillStreamer = nil
+	at.fillMutex.Unlock()
+
+	if streamer != nil {
+		streamer.StopFillStream()
+	}
+}
+
+// handleFill 处理成交推送：只缓存交易所侧触发的平仓成交（本系统下的市价单已由执行器记录）
+func (at *AutoTrader) handleFill(fill FillEvent) {
+	if !fill.IsClose || fill.Reason == "system" {
+		return
+	}
+
+	log.Printf("📨 [%s] 成交推送: %s %s 平仓 %.4f @ %.4f | 手续费: %.4f %s | 原因: %s",
+		at.name, fill.Symbol, fill.Side, fill.Quantity, fill.Price, fill.Commission, fill.CommissionAsset, fill.Reason)
+
+	at.fillMutex.Lock()
+	at.pendingFills = append(at.pendingFills, fill)
+	at.fillMutex.Unlock()
+}
+
+// takePendingFills 取出并清空待记录的成交
+func (at *AutoTrader) takePendingFills() []FillEvent {
+	at.fillMutex.Lock()
+	defer at.fillMutex.Unlock()
+
+	fills := at.pendingFills
+	at.pendingFills = nil
+	return fills
+}
+
+// cancelPairSurvivors 撤销已平仓持仓的止损止盈配对中残留的一方（止损或止盈成交、或仓位被其他方式平掉后剩下的挂单）
+// 交易所联动挂单由交易所自行撤销，不在这里处理；CancelStopOrders 按币种撤单，
+// 同币种另一方向仍有持仓时保留挂单（只减仓单不会开出新仓），避免撤掉另一方向的保护单
+func (at *AutoTrader) cancelPairSurvivors(pairs map[string]protectivePair, liveKeys map[string]bool) []logger.DecisionAction {
+	var actions []logger.DecisionAction
+	for key, pair := range pairs {
+		if pair.Native {
+			continue
+		}
+		symbol := key
+		if idx := strings.LastIndex(key, "_"); idx > 0 {
+			symbol = key[:idx]
+		}
+		action := logger.DecisionAction{
+			Action:    "cancel_oco_survivor",
+			Symbol:    symbol,
+			OCOGroup:  pair.Group,
+			Timestamp: at.now(),
+		}
+		if liveKeys[symbol+"_long"] || liveKeys[symbol+"_short"] {
+			log.Printf("⚠️ %s 另一方向仍有持仓，保留止损止盈配对 [%s] 的残留挂单", key, pair.Group)
+			action.Error = "同币种另一方向仍有持仓，未撤单"
+		} else if err := at.trader.CancelStopOrders(symbol); err != nil {
+			log.Printf("⚠️ 撤销 %s 止损止盈配对 [%s] 的残留挂单失败: %v", key, pair.Group, err)
+			action.Error = err.Error()
+		} else {
+			log.Printf("🧹 %s 已平仓，撤销止损止盈配对 [%s] 的残留挂单", key, pair.Group)
+			action.Success = true
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// fillCloseActions 将成交按持仓（symbol_side）聚合为决策动作：
+// 持仓已消失 → auto_close_*（成交均价、总数量、总手续费），仍有剩余 → partial_close
+// 返回的 closedKeys 为已完全平仓的持仓，供快照对比兜底时跳过
+func (at *AutoTrader) fillCloseActions(fills []FillEvent, liveKeys map[string]bool) ([]logger.DecisionAction, map[string]bool) {
+	type fillAgg struct {
+		last        FillEvent // 最后一笔成交（原因、订单ID、时间以此为准）
+		quantity    float64
+		notional    float64
+		commission  float64
+		realizedPnL float64
+	}
+
+	var keys []string
+	aggs := make(map[string]*fillAgg)
+	for _, fill := range fills {
+		key := fill.Symbol + "_" + fill.Side
+		agg, ok := aggs[key]
+		if !ok {
+			agg = &fillAgg{}
+			aggs[key] = agg
+			keys = append(keys, key)
+		}
+		agg.last = fill
+		agg.quantity += fill.Quantity
+		agg.notional += fill.Quantity * fill.Price
+		agg.commission += fill.Commission
+		agg.realizedPnL += fill.RealizedPnL
+	}
+
+	var actions []logger.DecisionAction
+	closedKeys := make(map[string]bool)
+	for _, key := range keys {
+		agg := aggs[key]
+		fill := agg.last
+
+		action := "auto_close_" + fill.Side
+		if liveKeys[key] {
+			action = "partial_close" // 部分成交/部分止盈，持仓仍在
+		} else {
+			closedKeys[key] = true
+			if fill.Reason == "stop_loss" {
+				at.recordStopLoss(fill.Symbol, fill.Time)
+			}
+			at.recordTradeResult(agg.realizedPnL - agg.commission)
+		}
+
+		at.positionStateMutex.RLock()
+		leverage := at.lastPositions[key].Leverage
+		at.positionStateMutex.RUnlock()
+
+		actions = append(actions, logger.DecisionAction{
+			Action:    action,
+			Symbol:    fill.Symbol,
+			Quantity:  agg.quantity,
+			Leverage:  leverage,
+			Price:     agg.notional / agg.quantity, // 成交均价
+			OrderID:   fill.OrderID,
+			Fee:       agg.commission,
+			Timestamp: fill.Time, // 真实成交时间
+			Success:   true,
+			Error:     fill.Reason, // 使用 Error 字段存储平仓原因，与快照推断的 auto_close 记录一致
+		})
+	}
+
+	return actions, closedKeys
+}
+
 // detectClosedPositions 检测被交易所自动平仓的持仓（止损/止盈触发）
 // 对比上一次和当前的持仓快照，找出消失的持仓
 func (at *AutoTrader) detectClosedPositions(currentPositions []decision.PositionInfo) []decision.PositionInfo {
+	at.positionStateMutex.RLock()
+	defer at.positionStateMutex.RUnlock()
+
 	// 首次运行或没有缓存，返回空列表
 	if at.lastPositions == nil || len(at.lastPositions) == 0 {
 		return []decision.PositionInfo{}
@@ -1755,6 +4553,9 @@ func (at *AutoTrader) generateAutoCloseActions(closedPositions []decision.Positi
 
 		// 智能推断平仓价格和原因
 		closePrice, closeReason := at.inferCloseDetails(pos)
+		if closeReason == "stop_loss" {
+			at.recordStopLoss(pos.Symbol, at.now())
+		}
 
 		// 生成 DecisionAction
 		actions = append(actions, logger.DecisionAction{
@@ -1764,7 +4565,7 @@ func (at *AutoTrader) generateAutoCloseActions(closedPositions []decision.Positi
 			Leverage:  pos.Leverage,
 			Price:     closePrice,    // 推断的平仓价格（止损/止盈/强平/市价）
 			OrderID:   0,             // 自动平仓没有订单ID
-			Timestamp: time.Now(),    // 检测时间（非真实触发时间）
+			Timestamp: at.now(),    // 检测时间（非真实触发时间）
 			Success:   true,
 			Error:     closeReason,   // 使用 Error 字段存储平仓原因（stop_loss/take_profit/liquidation/manual/unknown）
 		})
@@ -1773,15 +4574,30 @@ func (at *AutoTrader) generateAutoCloseActions(closedPositions []decision.Positi
 	return actions
 }
 
+// defaultCloseReasonTolerancePct 被动平仓原因推断的默认价格容差（百分比）
+const defaultCloseReasonTolerancePct = 1.0
+
 // inferCloseDetails - Intelligently infer close price and reason based on position data
+// 价格容差使用 CloseTolerancePct（未配置时为 defaultCloseReasonTolerancePct）
 func (at *AutoTrader) inferCloseDetails(pos decision.PositionInfo) (price float64, reason string) {
-	const priceThreshold = 0.01 // 1% 价格阈值，用于判断是否接近目标价格
+	tol := at.config.CloseTolerancePct
+	if tol <= 0 {
+		tol = defaultCloseReasonTolerancePct
+	}
+	return classifyClose(pos, tol)
+}
+
+// classifyClose 根据被动平仓前的持仓快照推断平仓价和原因（stop_loss/take_profit/liquidation/unknown）
+// tol 为止损/止盈价格容差（价格的百分比，1 表示标记价在目标价 1% 以内即视为触发），强平价容差为其两倍
+// 优先级：强平 > 止损 > 止盈，都不满足时返回标记价和 unknown
+func classifyClose(pos decision.PositionInfo, tol float64) (price float64, reason string) {
+	priceThreshold := tol / 100 // 止损/止盈价格容差
 
 	markPrice := pos.MarkPrice
 
 	// 1. 优先检查是否接近强平价（爆仓）- 因为这是最严重的情况
 	if pos.LiquidationPrice > 0 {
-		liquidationThreshold := 0.02 // 2% 强平价阈值（更宽松，因为接近强平时会被系统平仓）
+		liquidationThreshold := 2 * priceThreshold // 强平价容差加倍（更宽松，因为接近强平时会被系统平仓）
 		if pos.Side == "long" {
 			// 多头爆仓：价格接近强平价
 			if markPrice <= pos.LiquidationPrice*(1+liquidationThreshold) {
@@ -1832,6 +4648,9 @@ func (at *AutoTrader) inferCloseDetails(pos decision.PositionInfo) (price float6
 
 // updatePositionSnapshot 更新持仓快照（在每次 buildTradingContext 后调用）
 func (at *AutoTrader) updatePositionSnapshot(currentPositions []decision.PositionInfo) {
+	at.positionStateMutex.Lock()
+	defer at.positionStateMutex.Unlock()
+
 	// 清空旧快照
 	at.lastPositions = make(map[string]decision.PositionInfo)
 
@@ -1841,3 +4660,26 @@ func (at *AutoTrader) updatePositionSnapshot(currentPositions []decision.Positio
 		at.lastPositions[key] = pos
 	}
 }
+
+// GetAIHealth 获取AI连通性状态（用于健康检查）
+// 最近 maxAge 内有成功调用则直接视为正常，否则请求模型列表探测（不消耗 token）
+func (at *AutoTrader) GetAIHealth(maxAge time.Duration) (lastOK time.Time, err error) {
+	if at.mcpClient == nil {
+		return time.Time{}, fmt.Errorf("AI客户端未初始化")
+	}
+
+	lastOK = at.mcpClient.LastSuccessTime()
+	if !lastOK.IsZero() && at.since(lastOK) <= maxAge {
+		return lastOK, nil
+	}
+	return lastOK, at.mcpClient.Probe()
+}
+
+// ProbeAI 发送一次真实的AI对话请求检查模型能否正常响应（消耗 token，仅供手动触发）
+func (at *AutoTrader) ProbeAI() (lastOK time.Time, err error) {
+	if at.mcpClient == nil {
+		return time.Time{}, fmt.Errorf("AI客户端未初始化")
+	}
+	err = at.mcpClient.ProbeCompletion()
+	return at.mcpClient.LastSuccessTime(), err
+}
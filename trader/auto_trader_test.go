@@ -1,18 +1,32 @@
 package trader
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"nofx/clock"
 	"nofx/decision"
 	"nofx/logger"
 	"nofx/market"
+	"nofx/mcp"
 	"nofx/pool"
 
 	"github.com/agiledragon/gomonkey/v2"
+	"github.com/sonirico/go-hyperliquid"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -36,6 +50,9 @@ type AutoTraderTestSuite struct {
 	// gomonkey patches
 	patches *gomonkey.Patches
 
+	// 模拟时钟（冷却期、持仓时长等时间相关逻辑通过 Advance 推进）
+	clock *clock.Fake
+
 	// 测试配置
 	config AutoTraderConfig
 }
@@ -66,6 +83,7 @@ func (s *AutoTraderTestSuite) SetupTest() {
 	}
 
 	s.mockDB = &MockDatabase{}
+	s.clock = clock.NewFake(time.Now())
 
 	// 创建临时决策日志记录器
 	s.mockLogger = logger.NewDecisionLogger("/tmp/test_decision_logs")
@@ -101,13 +119,17 @@ func (s *AutoTraderTestSuite) SetupTest() {
 		lastResetTime:         time.Now(),
 		startTime:             time.Now(),
 		callCount:             0,
-		isRunning:             false,
 		positionFirstSeenTime: make(map[string]int64),
+		lastPositions:         make(map[string]decision.PositionInfo),
+		positionStopLoss:      make(map[string]float64),
+		positionTakeProfit:    make(map[string]float64),
 		stopMonitorCh:         make(chan struct{}),
+		monitorWg:             &sync.WaitGroup{},
 		peakPnLCache:          make(map[string]float64),
 		lastBalanceSyncTime:   time.Now(),
 		database:              s.mockDB,
 		userID:                "test_user",
+		clock:                 s.clock,
 	}
 }
 
@@ -172,6 +194,71 @@ func (s *AutoTraderTestSuite) TestSortDecisionsByPriority() {
 	}
 }
 
+// TestDedupeDecisions 测试排序后的去重：重复决策保留第一条，同一币种开多开空同时丢弃
+func (s *AutoTraderTestSuite) TestDedupeDecisions() {
+	tests := []struct {
+		name        string
+		input       []decision.Decision
+		wantActions []string // 保留的 "币种 动作"，按顺序
+		wantDropped int
+	}{
+		{
+			name: "重复开仓_保留第一条",
+			input: []decision.Decision{
+				{Action: "close_short", Symbol: "ETHUSDT"},
+				{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 100},
+				{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 200},
+				{Action: "close_short", Symbol: "ETHUSDT"},
+			},
+			wantActions: []string{"ETHUSDT close_short", "BTCUSDT open_long"},
+			wantDropped: 2,
+		},
+		{
+			name: "同一币种开多开空_全部丢弃",
+			input: []decision.Decision{
+				{Action: "open_long", Symbol: "BTCUSDT"},
+				{Action: "open_short", Symbol: "ETHUSDT"},
+				{Action: "open_short", Symbol: "BTCUSDT"},
+				{Action: "open_long", Symbol: "BTCUSDT"},
+			},
+			wantActions: []string{"ETHUSDT open_short"},
+			wantDropped: 3,
+		},
+		{
+			name: "不同币种或不同动作_不受影响",
+			input: []decision.Decision{
+				{Action: "close_long", Symbol: "BTCUSDT"},
+				{Action: "open_short", Symbol: "BTCUSDT"},
+				{Action: "open_long", Symbol: "ETHUSDT"},
+				{Action: "hold", Symbol: "SOLUSDT"},
+			},
+			wantActions: []string{"BTCUSDT close_long", "BTCUSDT open_short", "ETHUSDT open_long", "SOLUSDT hold"},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			kept, dropped := dedupeDecisions(sortDecisionsByPriority(tt.input))
+
+			var got []string
+			for _, d := range kept {
+				got = append(got, d.Symbol+" "+d.Action)
+			}
+			s.Equal(tt.wantActions, got)
+			s.Len(dropped, tt.wantDropped)
+		})
+	}
+
+	// 重复决策保留的是第一条
+	kept, _ := dedupeDecisions([]decision.Decision{
+		{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 100},
+		{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 200},
+	})
+	if s.Len(kept, 1) {
+		s.Equal(100.0, kept[0].PositionSizeUSD)
+	}
+}
+
 func (s *AutoTraderTestSuite) TestNormalizeSymbol() {
 	tests := []struct {
 		name     string
@@ -252,7 +339,7 @@ func (s *AutoTraderTestSuite) TestPeakPnLCache() {
 // ============================================================
 
 func (s *AutoTraderTestSuite) TestGetStatus() {
-	s.autoTrader.isRunning = true
+	s.autoTrader.isRunning.Store(true)
 	s.autoTrader.callCount = 15
 
 	status := s.autoTrader.GetStatus()
@@ -323,12 +410,142 @@ func (s *AutoTraderTestSuite) TestGetPositions() {
 		s.Equal(0.1, pos["quantity"])
 		s.Equal(50000.0, pos["entry_price"])
 	})
+
+	s.Run("字符串类型字段", func() {
+		// 部分交易所适配器以字符串返回数量/价格
+		s.mockTrader.positions = []map[string]interface{}{
+			{
+				"symbol":           "ETHUSDT",
+				"side":             "short",
+				"entryPrice":       "3000.5",
+				"markPrice":        json.Number("2990"),
+				"positionAmt":      "-2.5",
+				"unRealizedProfit": "26.25",
+				"liquidationPrice": "3500",
+				"leverage":         "5",
+			},
+		}
+		defer func() { s.mockTrader.positions = []map[string]interface{}{} }()
+
+		var positions []map[string]interface{}
+		var err error
+		s.NotPanics(func() { positions, err = s.autoTrader.GetPositions() })
+		s.NoError(err)
+		if !s.Len(positions, 1) {
+			return
+		}
+		pos := positions[0]
+		s.Equal(2.5, pos["quantity"])
+		s.Equal(3000.5, pos["entry_price"])
+		s.Equal(2990.0, pos["mark_price"])
+		s.Equal(5, pos["leverage"])
+		s.InDelta(2.5*3000.5/5, pos["margin_used"], 1e-9)
+
+		s.NotPanics(func() { s.autoTrader.checkPositionDrawdown() })
+		s.NotPanics(func() {
+			_, err := s.autoTrader.GetAccountInfo()
+			s.NoError(err)
+		})
+	})
 }
 
 // ============================================================
 // 层次 7: getCandidateCoins 测试
 // ============================================================
 
+// incomeMockTrader 在 MockTrader 基础上支持查询资金流水
+type incomeMockTrader struct {
+	*MockTrader
+	income []IncomeRecord
+	calls  int
+}
+
+func (t *incomeMockTrader) GetIncomeHistory(since time.Time) ([]IncomeRecord, error) {
+	t.calls++
+	var records []IncomeRecord
+	for _, r := range t.income {
+		if !r.Time.Before(since) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// TestGetPositions_PnLBreakdown 测试持仓盈亏拆分：资金费优先取交易所流水，否则按当前费率估算，拆分之和等于净盈亏
+func (s *AutoTraderTestSuite) TestGetPositions_PnLBreakdown() {
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "entryPrice": 50000.0, "markPrice": 51000.0, "positionAmt": 0.1, "unRealizedProfit": 100.0, "leverage": 10.0},
+		{"symbol": "ETHUSDT", "side": "short", "entryPrice": 3000.0, "markPrice": 2900.0, "positionAmt": -2.0, "unRealizedProfit": 200.0, "leverage": 5.0},
+	}
+	defer func() { s.mockTrader.positions = []map[string]interface{}{} }()
+	_, err := s.autoTrader.GetPositions() // 记录持仓首次出现时间
+	s.Require().NoError(err)
+	openedAt := s.clock.Now()
+	s.clock.Advance(9 * time.Hour)
+
+	assertSums := func(pos map[string]interface{}) {
+		gross, fee, funding, net := pos["gross_pnl"].(float64), pos["close_fee"].(float64), pos["funding_cost"].(float64), pos["net_pnl"].(float64)
+		s.InDelta(gross-funding-fee, net, 1e-9, "净盈亏 = 价格盈亏 - 资金费 - 平仓手续费")
+		s.InDelta(net/pos["margin_used"].(float64)*100, pos["net_pnl_pct"], 1e-9)
+	}
+
+	s.Run("交易所资金流水", func() {
+		income := &incomeMockTrader{MockTrader: s.mockTrader, income: []IncomeRecord{
+			{Symbol: "BTCUSDT", IncomeType: IncomeTypeFundingFee, Income: -1.5, Time: openedAt.Add(-time.Hour)}, // 持仓之前，不计入
+			{Symbol: "BTCUSDT", IncomeType: IncomeTypeFundingFee, Income: -2.0, Time: openedAt.Add(time.Hour)},
+			{Symbol: "BTCUSDT", IncomeType: IncomeTypeCommission, Income: -0.8, Time: openedAt.Add(time.Hour)},
+			{Symbol: "ETHUSDT", IncomeType: IncomeTypeFundingFee, Income: 0.6, Time: openedAt.Add(2 * time.Hour)},
+		}}
+		s.autoTrader.trader = income
+		defer func() {
+			s.autoTrader.trader = s.mockTrader
+			s.autoTrader.fundingHistory = nil
+		}()
+
+		positions, err := s.autoTrader.GetPositions()
+		s.Require().NoError(err)
+		s.Require().Len(positions, 2)
+		btc, eth := positions[0], positions[1]
+		s.InDelta(100.0, btc["gross_pnl"], 1e-9)
+		s.InDelta(2.0, btc["funding_cost"], 1e-9, "只计入持仓以来的资金费，不含手续费")
+		s.InDelta(0.1*51000*closeFeeRate, btc["close_fee"], 1e-9)
+		s.Equal(false, btc["funding_estimated"])
+		s.InDelta(200.0, eth["gross_pnl"], 1e-9)
+		s.InDelta(-0.6, eth["funding_cost"], 1e-9, "收到的资金费为负成本")
+		assertSums(btc)
+		assertSums(eth)
+		s.InDelta(calculatePnLPercentage(100, 500), btc["unrealized_pnl_pct"], 1e-9, "unrealized_pnl_pct 保持基于开仓保证金")
+
+		// 资金流水带缓存，交易周期和API轮询不重复请求
+		ctx, err := s.autoTrader.buildTradingContext()
+		s.Require().NoError(err)
+		s.Equal(1, income.calls)
+		s.Require().Len(ctx.Positions, 2)
+		s.InDelta(2.0, ctx.Positions[0].FundingCost, 1e-9)
+		s.InDelta(btc["net_pnl"].(float64), ctx.Positions[0].NetPnL, 1e-9, "交易上下文与持仓接口的拆分一致")
+
+		breakdown, err := s.autoTrader.GetPositionPnLBreakdown("ETHUSDT", "short")
+		s.Require().NoError(err)
+		s.InDelta(eth["net_pnl"].(float64), breakdown.NetPnL, 1e-9)
+		_, err = s.autoTrader.GetPositionPnLBreakdown("ETHUSDT", "long")
+		s.Error(err)
+	})
+
+	s.Run("按资金费率估算", func() {
+		s.patches.ApplyFunc(market.GetFundingRate, func(symbol string) (float64, int64, error) {
+			return 0.0001, openedAt.Add(10 * time.Hour).UnixMilli(), nil // 持仓期间结算过一次（openedAt+2h）
+		})
+		positions, err := s.autoTrader.GetPositions()
+		s.Require().NoError(err)
+		btc, eth := positions[0], positions[1]
+		s.Equal(true, btc["funding_estimated"])
+		s.InDelta(0.0001*0.1*51000, btc["funding_cost"], 1e-9, "费率为正时多头支付")
+		s.InDelta(-0.0001*2*2900, eth["funding_cost"], 1e-9, "费率为正时空头收取")
+		assertSums(btc)
+		assertSums(eth)
+	})
+}
+
 func (s *AutoTraderTestSuite) TestGetCandidateCoins() {
 	s.Run("使用数据库默认币种", func() {
 		s.autoTrader.defaultCoins = []string{"BTC", "ETH", "BNB"}
@@ -376,6 +593,54 @@ func (s *AutoTraderTestSuite) TestGetCandidateCoins() {
 		s.NoError(err)
 		s.Equal(2, len(coins))
 	})
+
+	s.Run("启用OI Top信号源_并入候选币种", func() {
+		s.autoTrader.tradingCoins = []string{"SOL", "AVAX"}
+		s.autoTrader.config.UseOITop = true
+		s.autoTrader.config.OITopAPIURL = "https://oi.example.com/top"
+		defer func() {
+			s.autoTrader.config.UseOITop = false
+			s.autoTrader.config.OITopAPIURL = ""
+			s.autoTrader.oiTopSymbols = nil
+		}()
+
+		var requestedURL string
+		var fetchErr error
+		s.patches.ApplyFunc(pool.GetOITopSymbolsFrom, func(apiURL string) ([]string, error) {
+			requestedURL = apiURL
+			if fetchErr != nil {
+				return nil, fetchErr
+			}
+			return []string{"SOLUSDT", "pepe"}, nil
+		})
+
+		coins, err := s.autoTrader.getCandidateCoins()
+
+		s.NoError(err)
+		s.Equal("https://oi.example.com/top", requestedURL)
+		if s.Len(coins, 3) {
+			s.Equal([]string{"custom", "oi_top"}, coins[0].Sources)
+			s.Equal([]string{"custom"}, coins[1].Sources)
+			s.Equal(decision.CandidateCoin{Symbol: "PEPEUSDT", Sources: []string{"oi_top"}}, coins[2])
+		}
+		// OI Top并入的币种允许开仓
+		s.NoError(s.autoTrader.checkSymbolScope("PEPEUSDT"))
+
+		// 获取失败时沿用原候选列表
+		fetchErr = errors.New("HTTP 502")
+		coins, err = s.autoTrader.getCandidateCoins()
+		s.NoError(err)
+		s.Len(coins, 2)
+
+		// 未启用时不请求
+		requestedURL = ""
+		s.autoTrader.config.UseOITop = false
+		coins, err = s.autoTrader.getCandidateCoins()
+		s.NoError(err)
+		s.Len(coins, 2)
+		s.Empty(requestedURL)
+		s.Error(s.autoTrader.checkSymbolScope("PEPEUSDT"))
+	})
 }
 
 // ============================================================
@@ -387,6 +652,12 @@ func (s *AutoTraderTestSuite) TestBuildTradingContext() {
 	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
 		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
 	})
+	s.patches.ApplyFunc(market.GetDepthImbalance, func(symbol string) (*market.DepthImbalance, error) {
+		if symbol == "ETHUSDT" {
+			return nil, errors.New("获取ETHUSDT盘口失败: timeout")
+		}
+		return &market.DepthImbalance{BidNotional: 300, AskNotional: 100, Ratio: 3, BandPct: 0.5}, nil
+	})
 
 	ctx, err := s.autoTrader.buildTradingContext()
 
@@ -398,6 +669,78 @@ func (s *AutoTraderTestSuite) TestBuildTradingContext() {
 	s.Equal(8000.0, ctx.Account.AvailableBalance)
 	s.Equal(10, ctx.BTCETHLeverage)
 	s.Equal(5, ctx.AltcoinLeverage)
+
+	// 盘口买卖比：获取失败的币种跳过
+	if s.Contains(ctx.DepthImbalances, "BTCUSDT") {
+		s.Equal(3.0, ctx.DepthImbalances["BTCUSDT"].Ratio)
+	}
+	s.NotContains(ctx.DepthImbalances, "ETHUSDT")
+
+	// 没有盘口数据的交易所不设置
+	s.autoTrader.exchange = "hyperliquid"
+	defer func() { s.autoTrader.exchange = s.config.Exchange }()
+	ctx, err = s.autoTrader.buildTradingContext()
+	s.NoError(err)
+	s.Nil(ctx.DepthImbalances)
+}
+
+// TestAlwaysContextSymbols 测试参考币种：不在候选列表中也提供行情并在提示词中标为仅参考，对其开仓被币种范围校验拒绝
+func (s *AutoTraderTestSuite) TestAlwaysContextSymbols() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100.0}, nil
+	})
+	s.patches.ApplyFunc(market.GetDepthImbalance, func(symbol string) (*market.DepthImbalance, error) {
+		return nil, errors.New("no depth")
+	})
+	positions := s.mockTrader.positions
+	s.mockTrader.positions = []map[string]interface{}{}
+	s.autoTrader.tradingCoins = []string{"SOL", "DOGE"}
+	s.autoTrader.config.AlwaysContextSymbols = []string{"btc", "SOL"} // SOL 已是候选币种，正常交易
+	defer func() {
+		s.mockTrader.positions = positions
+		s.autoTrader.tradingCoins = nil
+		s.autoTrader.config.AlwaysContextSymbols = nil
+	}()
+
+	ctx, err := s.autoTrader.buildTradingContext()
+	s.Require().NoError(err)
+	s.Equal([]string{"BTCUSDT"}, ctx.ContextSymbols)
+	for _, coin := range ctx.CandidateCoins {
+		s.NotEqual("BTCUSDT", coin.Symbol, "参考币种不加入候选列表")
+	}
+
+	_, userPrompt, err := s.autoTrader.PreviewPrompt()
+	s.Require().NoError(err)
+	s.Contains(userPrompt, "参考币种")
+	s.Contains(userPrompt, "BTCUSDT（仅参考）")
+	s.NotContains(userPrompt, "SOLUSDT（仅参考）")
+
+	d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 500.0, Leverage: 5}
+	actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	err = s.autoTrader.executeDecisionWithRecord(d, actionRecord)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "不在允许交易的币种范围内")
+	s.Zero(actionRecord.OrderID)
+}
+
+// TestPreviewPrompt 测试提示词预览：按实盘方式渲染自定义prompt和行情，不调用AI（测试中 mcpClient 为 nil）
+func (s *AutoTraderTestSuite) TestPreviewPrompt() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	s.patches.ApplyFunc(market.GetDepthImbalance, func(symbol string) (*market.DepthImbalance, error) {
+		return nil, errors.New("no depth")
+	})
+	s.autoTrader.customPrompt = "只在趋势明确时开仓"
+	defer func() { s.autoTrader.customPrompt = "" }()
+	callCount := s.autoTrader.callCount
+
+	systemPrompt, userPrompt, err := s.autoTrader.PreviewPrompt()
+	s.Require().NoError(err)
+	s.Contains(systemPrompt, "只在趋势明确时开仓")
+	s.Contains(userPrompt, "BTCUSDT")
+	s.Contains(userPrompt, fmt.Sprintf("周期: #%d", callCount+1), "预览的是下一个周期")
+	s.Equal(callCount, s.autoTrader.callCount, "预览不应推进周期计数")
 }
 
 // ============================================================
@@ -411,8 +754,9 @@ func (s *AutoTraderTestSuite) TestExecuteOpenPosition() {
 		action        string
 		expectedOrder int64
 		existingSide  string
+		hedgeMode     bool
 		availBalance  float64
-		expectedErr   string
+		expectedErr   error
 		executeFn     func(*decision.Decision, *logger.DecisionAction) error
 	}{
 		{
@@ -437,7 +781,7 @@ func (s *AutoTraderTestSuite) TestExecuteOpenPosition() {
 			name:         "多仓_保证金不足",
 			action:       "open_long",
 			availBalance: 0.0,
-			expectedErr:  "保证金不足",
+			expectedErr:  ErrInsufficientMargin,
 			executeFn: func(d *decision.Decision, a *logger.DecisionAction) error {
 				return s.autoTrader.executeOpenLongWithRecord(d, a)
 			},
@@ -446,7 +790,7 @@ func (s *AutoTraderTestSuite) TestExecuteOpenPosition() {
 			name:         "空仓_保证金不足",
 			action:       "open_short",
 			availBalance: 0.0,
-			expectedErr:  "保证金不足",
+			expectedErr:  ErrInsufficientMargin,
 			executeFn: func(d *decision.Decision, a *logger.DecisionAction) error {
 				return s.autoTrader.executeOpenShortWithRecord(d, a)
 			},
@@ -456,7 +800,7 @@ func (s *AutoTraderTestSuite) TestExecuteOpenPosition() {
 			action:       "open_long",
 			existingSide: "long",
 			availBalance: 8000.0,
-			expectedErr:  "已有多仓",
+			expectedErr:  ErrPositionExists,
 			executeFn: func(d *decision.Decision, a *logger.DecisionAction) error {
 				return s.autoTrader.executeOpenLongWithRecord(d, a)
 			},
@@ -466,47 +810,2093 @@ func (s *AutoTraderTestSuite) TestExecuteOpenPosition() {
 			action:       "open_short",
 			existingSide: "short",
 			availBalance: 8000.0,
-			expectedErr:  "已有空仓",
+			expectedErr:  ErrPositionExists,
+			executeFn: func(d *decision.Decision, a *logger.DecisionAction) error {
+				return s.autoTrader.executeOpenShortWithRecord(d, a)
+			},
+		},
+		{
+			name:         "单向持仓_已有空仓_拒绝开多",
+			action:       "open_long",
+			existingSide: "short",
+			availBalance: 8000.0,
+			expectedErr:  ErrPositionExists,
+			executeFn: func(d *decision.Decision, a *logger.DecisionAction) error {
+				return s.autoTrader.executeOpenLongWithRecord(d, a)
+			},
+		},
+		{
+			name:          "双向持仓_已有空仓_允许开多",
+			action:        "open_long",
+			expectedOrder: 123456,
+			existingSide:  "short",
+			hedgeMode:     true,
+			availBalance:  8000.0,
+			executeFn: func(d *decision.Decision, a *logger.DecisionAction) error {
+				return s.autoTrader.executeOpenLongWithRecord(d, a)
+			},
+		},
+		{
+			name:          "双向持仓_已有多仓_允许开空",
+			action:        "open_short",
+			expectedOrder: 123457,
+			existingSide:  "long",
+			hedgeMode:     true,
+			availBalance:  8000.0,
 			executeFn: func(d *decision.Decision, a *logger.DecisionAction) error {
 				return s.autoTrader.executeOpenShortWithRecord(d, a)
 			},
 		},
+		{
+			name:         "双向持仓_已有同方向持仓_仍拒绝",
+			action:       "open_long",
+			existingSide: "long",
+			hedgeMode:    true,
+			availBalance: 8000.0,
+			expectedErr:  ErrPositionExists,
+			executeFn: func(d *decision.Decision, a *logger.DecisionAction) error {
+				return s.autoTrader.executeOpenLongWithRecord(d, a)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		s.clock.Advance(time.Millisecond)
+		s.Run(tt.name, func() {
+			s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+				return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+			})
+
+			s.mockTrader.balance["availableBalance"] = tt.availBalance
+			s.autoTrader.config.HedgeMode = tt.hedgeMode
+			if tt.existingSide != "" {
+				s.mockTrader.positions = []map[string]interface{}{{"symbol": "BTCUSDT", "side": tt.existingSide}}
+			} else {
+				s.mockTrader.positions = []map[string]interface{}{}
+			}
+
+			decision := &decision.Decision{Action: tt.action, Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10}
+			actionRecord := &logger.DecisionAction{Action: tt.action, Symbol: "BTCUSDT"}
+
+			err := tt.executeFn(decision, actionRecord)
+
+			if tt.expectedErr != nil {
+				s.ErrorIs(err, tt.expectedErr)
+			} else {
+				s.NoError(err)
+				s.Equal(tt.expectedOrder, actionRecord.OrderID)
+				s.Greater(actionRecord.Quantity, 0.0)
+				s.Equal(50000.0, actionRecord.Price)
+			}
+
+			// 恢复默认状态
+			s.mockTrader.balance["availableBalance"] = 8000.0
+			s.mockTrader.positions = []map[string]interface{}{}
+			s.autoTrader.config.HedgeMode = false
+		})
+	}
+}
+
+// TestExecuteOpenPosition_LeverageTiers 测试开仓时按杠杆分级修正杠杆，并在决策动作上记录解析出的上限
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_LeverageTiers() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100.0}, nil
+	})
+	s.autoTrader.config.LeverageTiers = map[string]int{"SOLUSDT": 3}
+	defer func() { s.autoTrader.config.LeverageTiers = nil }()
+
+	d := &decision.Decision{Action: "open_long", Symbol: "SOLUSDT", PositionSizeUSD: 1000.0, Leverage: 5}
+	actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol, Leverage: d.Leverage}
+	s.NoError(s.autoTrader.executeOpenLongWithRecord(d, actionRecord))
+	s.Equal(3, actionRecord.Leverage, "超出分级上限的杠杆应被修正")
+	s.Equal(3, actionRecord.ResolvedLeverage)
+
+	// 未匹配分级时回退到两档杠杆（BTC/ETH 10x）
+	d = &decision.Decision{Action: "open_short", Symbol: "ETHUSDT", PositionSizeUSD: 1000.0, Leverage: 8}
+	actionRecord = &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol, Leverage: d.Leverage}
+	s.NoError(s.autoTrader.executeOpenShortWithRecord(d, actionRecord))
+	s.Equal(8, actionRecord.Leverage)
+	s.Equal(10, actionRecord.ResolvedLeverage)
+}
+
+// TestNewAutoTrader_MaxAllowedLeverage 测试系统杠杆上限：构造时截断配置的杠杆（含杠杆分级），开仓时截断决策杠杆
+func (s *AutoTraderTestSuite) TestNewAutoTrader_MaxAllowedLeverage() {
+	s.patches.ApplyFunc(NewFuturesTrader, func(apiKey, secretKey string, userId string) *FuturesTrader {
+		return &FuturesTrader{}
+	})
+	s.patches.ApplyMethod(reflect.TypeOf(&FuturesTrader{}), "SetPositionMode", func(_ *FuturesTrader, dualSide bool) (bool, error) {
+		return dualSide, nil
+	})
+	oldMax := MaxAllowedLeverage
+	MaxAllowedLeverage = 20
+	defer func() { MaxAllowedLeverage = oldMax }()
+	s.T().Chdir(s.T().TempDir()) // 决策日志目录写到临时目录
+
+	tiers := map[string]int{"SOLUSDT": 100, "DOGEUSDT": 3}
+	at, err := NewAutoTrader(AutoTraderConfig{
+		ID:              "leverage_clamp",
+		Exchange:        "binance",
+		InitialBalance:  1000,
+		BTCETHLeverage:  125,
+		AltcoinLeverage: 10,
+		LeverageTiers:   tiers,
+	}, nil, "user-1")
+	s.Require().NoError(err)
+	s.Equal(20, at.config.BTCETHLeverage, "125x 应被截断到系统上限")
+	s.Equal(10, at.config.AltcoinLeverage, "未超限的杠杆保持不变")
+	s.Equal(map[string]int{"SOLUSDT": 20, "DOGEUSDT": 3}, at.config.LeverageTiers)
+	s.Equal(100, tiers["SOLUSDT"], "不应修改调用方的杠杆分级")
+
+	// 未配置交易员杠杆上限时，决策杠杆也不超过系统上限
+	s.autoTrader.config.BTCETHLeverage = 0
+	defer func() { s.autoTrader.config.BTCETHLeverage = 10 }()
+	d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 125}
+	actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol, Leverage: d.Leverage}
+	s.autoTrader.applyLeverageLimit(d, actionRecord)
+	s.Equal(20, d.Leverage)
+	s.Equal(20, actionRecord.Leverage)
+}
+
+// TestNewAutoTrader_HedgeMode 测试 HedgeMode 配置切换币安账户持仓模式：单向持仓时拒绝同币种反向开仓，
+// 账户无法切换（有持仓或挂单）时按账户实际模式运行
+func (s *AutoTraderTestSuite) TestNewAutoTrader_HedgeMode() {
+	s.patches.ApplyFunc(NewFuturesTrader, func(apiKey, secretKey string, userId string) *FuturesTrader {
+		return &FuturesTrader{}
+	})
+	var requested []bool
+	accountDualSide := func(want bool) bool { return want }
+	s.patches.ApplyMethod(reflect.TypeOf(&FuturesTrader{}), "SetPositionMode", func(_ *FuturesTrader, dualSide bool) (bool, error) {
+		requested = append(requested, dualSide)
+		actual := accountDualSide(dualSide)
+		if actual != dualSide {
+			return actual, errors.New("切换持仓模式失败")
+		}
+		return actual, nil
+	})
+	s.T().Chdir(s.T().TempDir()) // 决策日志目录写到临时目录
+	defer func() { s.mockTrader.positions = []map[string]interface{}{} }()
+
+	newTrader := func(hedgeMode bool) *AutoTrader {
+		at, err := NewAutoTrader(AutoTraderConfig{
+			ID:             "binance_hedge",
+			Exchange:       "binance",
+			InitialBalance: 1000,
+			HedgeMode:      hedgeMode,
+		}, nil, "user-1")
+		s.Require().NoError(err)
+		at.trader = s.mockTrader
+		s.mockTrader.positions = []map[string]interface{}{{"symbol": "BTCUSDT", "side": "long"}}
+		return at
+	}
+
+	s.Run("单向持仓拒绝反向开仓", func() {
+		at := newTrader(false)
+		s.False(at.config.HedgeMode)
+		s.ErrorIs(at.checkExistingPosition("BTCUSDT", "short"), ErrPositionExists)
+	})
+
+	s.Run("双向持仓允许多空并存", func() {
+		at := newTrader(true)
+		s.True(at.config.HedgeMode)
+		s.NoError(at.checkExistingPosition("BTCUSDT", "short"))
+		s.ErrorIs(at.checkExistingPosition("BTCUSDT", "long"), ErrPositionExists)
+	})
+
+	s.Run("账户无法切换时按实际模式运行", func() {
+		accountDualSide = func(bool) bool { return true }
+		at := newTrader(false)
+		s.True(at.config.HedgeMode, "账户仍为双向持仓，HedgeMode 应与账户一致")
+		s.NoError(at.checkExistingPosition("BTCUSDT", "short"))
+	})
+
+	s.Equal([]bool{false, true, false}, requested, "应按配置请求切换账户持仓模式")
+}
+
+// TestExecuteOpenPosition_ProtectiveStop 测试开仓后立即挂保护性止损（多空两侧）：
+// 有效止损直接使用，位于入场价错误一侧或缺失时按默认百分比推算，止损动作关联到开仓订单
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_ProtectiveStop() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	defer func() { s.autoTrader.config.DefaultStopLossPct = 0 }()
+
+	tests := []struct {
+		name          string
+		action        string
+		stopLoss      float64
+		newStopLoss   float64
+		defaultPct    float64
+		wantStop      float64
+		wantSide      string
+		wantOrderID   int64
+		wantUnprotect bool
+	}{
+		{name: "多仓_使用决策止损", action: "open_long", stopLoss: 48000, wantStop: 48000, wantSide: PositionSideLong, wantOrderID: 123456},
+		{name: "空仓_使用决策止损", action: "open_short", stopLoss: 52000, wantStop: 52000, wantSide: PositionSideShort, wantOrderID: 123457},
+		{name: "多仓_使用new_stop_loss", action: "open_long", newStopLoss: 49000, wantStop: 49000, wantSide: PositionSideLong, wantOrderID: 123456},
+		{name: "多仓_止损在错误一侧_按默认百分比", action: "open_long", stopLoss: 51000, defaultPct: 2, wantStop: 49000, wantSide: PositionSideLong, wantOrderID: 123456},
+		{name: "空仓_止损在错误一侧_按默认百分比", action: "open_short", stopLoss: 49000, defaultPct: 2, wantStop: 51000, wantSide: PositionSideShort, wantOrderID: 123457},
+		{name: "空仓_无止损无默认_记录未受保护", action: "open_short", wantSide: PositionSideShort, wantOrderID: 123457, wantUnprotect: true},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.mockTrader.positions = []map[string]interface{}{}
+			s.mockTrader.stopLossOrders = nil
+			s.autoTrader.pendingActions = nil
+			s.autoTrader.config.DefaultStopLossPct = tt.defaultPct
+			s.autoTrader.callCount++
+
+			d := &decision.Decision{Action: tt.action, Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10,
+				StopLoss: tt.stopLoss, NewStopLoss: tt.newStopLoss}
+			entry := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+			var err error
+			if tt.action == "open_long" {
+				err = s.autoTrader.executeOpenLongWithRecord(d, entry)
+			} else {
+				err = s.autoTrader.executeOpenShortWithRecord(d, entry)
+			}
+			if !s.NoError(err) {
+				return
+			}
+
+			actions := s.autoTrader.takePendingActions()
+			if !s.NotEmpty(actions) {
+				return
+			}
+			stopAction := actions[0]
+			s.Equal("stop_loss", stopAction.Action)
+			s.Equal(tt.wantOrderID, stopAction.ParentOrderID, "止损动作应关联开仓订单")
+
+			if tt.wantUnprotect {
+				s.False(stopAction.Success)
+				s.NotEmpty(stopAction.Error)
+				s.Empty(s.mockTrader.stopLossOrders)
+				return
+			}
+			s.True(stopAction.Success)
+			s.InDelta(tt.wantStop, stopAction.Price, 1e-6)
+			if s.Len(s.mockTrader.stopLossOrders, 1) {
+				s.Equal(tt.wantSide, s.mockTrader.stopLossOrders[0].positionSide)
+				s.InDelta(tt.wantStop, s.mockTrader.stopLossOrders[0].price, 1e-6)
+				s.Equal(entry.Quantity, s.mockTrader.stopLossOrders[0].quantity)
+			}
+		})
+	}
+}
+
+// TestRun_RejectsOverlappingLoop 测试停止时等待当前周期超时（AI决策缓慢）后立即重新启动：旧主循环的周期仍在执行，
+// 新的 Run 被拒绝，不会出现两个周期并发执行；旧周期结束、主循环退出后可以正常启动
+func (s *AutoTraderTestSuite) TestRun_RejectsOverlappingLoop() {
+	s.patches.ApplyFunc(pool.GetOITopPositions, func() ([]pool.OIPosition, error) {
+		return nil, errors.New("disabled in test")
+	})
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	s.patches.ApplyFunc(market.GetDepthImbalance, func(symbol string) (*market.DepthImbalance, error) {
+		return nil, errors.New("no depth")
+	})
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	var active, maxActive atomic.Int32
+	s.patches.ApplyFunc(decision.GetFullDecisionWithCustomPrompt, func(ctx *decision.Context, mcpClient mcp.AIClient, customPrompt string, overrideBase bool, templateName string) (*decision.FullDecision, error) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		if n > maxActive.Load() {
+			maxActive.Store(n)
+		}
+		entered <- struct{}{}
+		<-release // 模拟缓慢的AI决策
+		return &decision.FullDecision{}, nil
+	})
+	s.autoTrader.config.ScanInterval = time.Hour
+
+	waitEntered := func() {
+		select {
+		case <-entered:
+		case <-time.After(5 * time.Second):
+			s.FailNow("决策周期未开始")
+		}
+	}
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.autoTrader.Run() }()
+	waitEntered()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	s.ErrorIs(s.autoTrader.Stop(ctx), context.DeadlineExceeded)
+	cancel()
+	s.Equal(true, s.autoTrader.GetStatus()["is_stopping"])
+
+	// 旧周期仍在执行：再次启动被拒绝
+	s.ErrorIs(s.autoTrader.Run(), ErrLoopStillActive)
+
+	close(release)
+	select {
+	case err := <-runErr:
+		s.NoError(err)
+	case <-time.After(5 * time.Second):
+		s.FailNow("周期结束后主循环未退出")
+	}
+	s.Equal(false, s.autoTrader.GetStatus()["is_stopping"])
+	s.Equal(int32(1), maxActive.Load(), "不应有两个周期同时执行")
+
+	// 旧主循环退出后可以正常启动
+	go func() { runErr <- s.autoTrader.Run() }()
+	waitEntered()
+	s.Require().NoError(s.autoTrader.Stop(context.Background()))
+	s.NoError(<-runErr)
+}
+
+// TestExecuteAddPosition 测试分批建仓：无持仓时拒绝加仓；开仓后加仓按总数量重挂止损止盈并更新开仓均价，最后一次性全部平仓
+func (s *AutoTraderTestSuite) TestExecuteAddPosition() {
+	price := 50000.0
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: price}, nil
+	})
+	s.mockTrader.positions = []map[string]interface{}{}
+	s.mockTrader.stopLossOrders = nil
+	s.mockTrader.takeProfitOrders = nil
+	s.autoTrader.pendingActions = nil
+
+	add := &decision.Decision{Action: "add_position", Symbol: "BTCUSDT", PositionSizeUSD: 1000}
+	err := s.autoTrader.executeDecisionWithRecord(add, &logger.DecisionAction{Action: add.Action, Symbol: add.Symbol})
+	s.ErrorIs(err, ErrPositionNotFound, "没有持仓时加仓应被拒绝")
+
+	// 第一批：开多 0.02 @ 50000，止损 48000 / 止盈 55000
+	s.autoTrader.callCount++
+	open := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000, Leverage: 10, StopLoss: 48000, TakeProfit: 55000}
+	s.Require().NoError(s.autoTrader.executeDecisionWithRecord(open, &logger.DecisionAction{Action: open.Action, Symbol: open.Symbol}))
+	s.autoTrader.takePendingActions()
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.02, "entryPrice": 50000.0, "markPrice": 50000.0, "leverage": 10.0},
+	}
+	s.autoTrader.lastPositions["BTCUSDT_long"] = decision.PositionInfo{Symbol: "BTCUSDT", Side: "long", EntryPrice: 50000, Quantity: 0.02}
+
+	// 第二批：52500 加仓 2100 USDT（0.04）
+	price = 52500
+	s.autoTrader.callCount++
+	entry := &logger.DecisionAction{Action: add.Action, Symbol: add.Symbol}
+	add.PositionSizeUSD = 2100
+	s.Require().NoError(s.autoTrader.executeDecisionWithRecord(add, entry))
+	s.InDelta(0.04, entry.Quantity, 1e-9)
+	s.Equal(10, entry.Leverage, "加仓沿用现有持仓的杠杆")
+
+	// 均价 = (0.02×50000 + 0.04×52500) / 0.06
+	s.InDelta((0.02*50000+0.04*52500)/0.06, s.autoTrader.lastPositions["BTCUSDT_long"].EntryPrice, 1e-6)
+	s.InDelta(0.06, s.autoTrader.lastPositions["BTCUSDT_long"].Quantity, 1e-9)
+
+	// 止损止盈按总数量重挂，价格不变
+	s.Require().Len(s.mockTrader.stopLossOrders, 2)
+	s.Require().Len(s.mockTrader.takeProfitOrders, 2)
+	s.InDelta(0.06, s.mockTrader.stopLossOrders[1].quantity, 1e-9)
+	s.InDelta(48000, s.mockTrader.stopLossOrders[1].price, 1e-9)
+	s.InDelta(0.06, s.mockTrader.takeProfitOrders[1].quantity, 1e-9)
+	s.InDelta(55000, s.mockTrader.takeProfitOrders[1].price, 1e-9)
+	actions := s.autoTrader.takePendingActions()
+	s.Require().Len(actions, 2)
+	for _, action := range actions {
+		s.True(action.Success)
+		s.InDelta(0.06, action.Quantity, 1e-9)
+	}
+
+	// 一次性全部平仓
+	s.mockTrader.closeOrders = nil
+	s.mockTrader.positions[0]["positionAmt"] = 0.06
+	closeLong := &decision.Decision{Action: "close_long", Symbol: "BTCUSDT"}
+	s.Require().NoError(s.autoTrader.executeDecisionWithRecord(closeLong, &logger.DecisionAction{Action: closeLong.Action, Symbol: closeLong.Symbol}))
+	s.Require().Len(s.mockTrader.closeOrders, 1)
+}
+
+// ocoMockTrader 支持止损止盈联动挂单的 mock 交易所，记录 SetStopLossTakeProfit 调用
+type ocoMockTrader struct {
+	*MockTrader
+	ocoCalls []mockOCOOrder
+	ocoErr   error // 非 nil 时 SetStopLossTakeProfit 返回该错误
+}
+
+// mockOCOOrder 记录 SetStopLossTakeProfit 调用
+type mockOCOOrder struct {
+	symbol       string
+	positionSide string
+	quantity     float64
+	stopPrice    float64
+	tpPrice      float64
+}
+
+func (m *ocoMockTrader) SetStopLossTakeProfit(symbol string, positionSide string, quantity, stopPrice, takeProfitPrice float64) error {
+	m.ocoCalls = append(m.ocoCalls, mockOCOOrder{symbol, positionSide, quantity, stopPrice, takeProfitPrice})
+	return m.ocoErr
+}
+
+// TestExecuteOpenPosition_StopLossTakeProfitPair 测试开仓时同时有止损和止盈时成对挂单：
+// 支持联动挂单的交易所走 SetStopLossTakeProfit，否则分别挂止损和止盈；两个动作记录相同的 OCOGroup，
+// 非联动配对在持仓消失后由对账撤销残留挂单
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_StopLossTakeProfitPair() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+
+	openLong := func() []logger.DecisionAction {
+		s.autoTrader.callCount++
+		d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10,
+			StopLoss: 48000, TakeProfit: 55000}
+		entry := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+		s.Require().NoError(s.autoTrader.executeOpenLongWithRecord(d, entry))
+		return s.autoTrader.takePendingActions()
+	}
+	assertPaired := func(actions []logger.DecisionAction) {
+		s.Require().Len(actions, 2)
+		s.Equal("stop_loss", actions[0].Action)
+		s.Equal("take_profit", actions[1].Action)
+		s.True(actions[0].Success)
+		s.True(actions[1].Success)
+		s.NotEmpty(actions[0].OCOGroup)
+		s.Equal(actions[0].OCOGroup, actions[1].OCOGroup, "止损和止盈应记录相同的配对ID")
+		s.InDelta(48000, actions[0].Price, 1e-6)
+		s.InDelta(55000, actions[1].Price, 1e-6)
+	}
+
+	s.Run("联动挂单", func() {
+		oco := &ocoMockTrader{MockTrader: s.mockTrader}
+		s.autoTrader.trader = oco
+		defer func() { s.autoTrader.trader = s.mockTrader }()
+		s.mockTrader.positions = []map[string]interface{}{}
+		s.mockTrader.stopLossOrders = nil
+		s.mockTrader.takeProfitOrders = nil
+
+		actions := openLong()
+		assertPaired(actions)
+		s.Require().Len(oco.ocoCalls, 1)
+		s.Equal(mockOCOOrder{"BTCUSDT", PositionSideLong, 0.02, 48000, 55000}, oco.ocoCalls[0])
+		s.Empty(s.mockTrader.stopLossOrders, "联动挂单不应再单独挂止损")
+		s.Empty(s.mockTrader.takeProfitOrders, "联动挂单不应再单独挂止盈")
+		s.Equal(protectivePair{Group: actions[0].OCOGroup, Native: true}, s.autoTrader.protectivePairs["BTCUSDT_long"])
+
+		// 交易所联动撤单，对账时不再撤销残留挂单
+		s.mockTrader.positions = []map[string]interface{}{}
+		s.mockTrader.stopOrderCancels = nil
+		record := &logger.DecisionRecord{}
+		s.autoTrader.reconcilePositions(record)
+		s.Empty(s.mockTrader.stopOrderCancels)
+		s.NotContains(s.autoTrader.protectivePairs, "BTCUSDT_long")
+	})
+
+	s.Run("联动挂单_止盈失败保留止损", func() {
+		oco := &ocoMockTrader{MockTrader: s.mockTrader, ocoErr: fmt.Errorf("%w: rejected", ErrTakeProfitNotSet)}
+		s.autoTrader.trader = oco
+		defer func() { s.autoTrader.trader = s.mockTrader }()
+		s.mockTrader.positions = []map[string]interface{}{}
+
+		actions := openLong()
+		s.Require().Len(actions, 2)
+		s.True(actions[0].Success, "止损已挂上")
+		s.False(actions[1].Success)
+		s.NotContains(s.autoTrader.protectivePairs, "BTCUSDT_long", "未成对挂上时不记录配对")
+	})
+
+	s.Run("分别挂单_平仓后撤销残留", func() {
+		s.mockTrader.positions = []map[string]interface{}{}
+		s.mockTrader.stopLossOrders = nil
+		s.mockTrader.takeProfitOrders = nil
+
+		actions := openLong()
+		assertPaired(actions)
+		s.Len(s.mockTrader.stopLossOrders, 1)
+		s.Len(s.mockTrader.takeProfitOrders, 1)
+		s.Equal(protectivePair{Group: actions[0].OCOGroup, Native: false}, s.autoTrader.protectivePairs["BTCUSDT_long"])
+
+		// 持仓仍在时不撤单
+		s.mockTrader.positions = []map[string]interface{}{
+			{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.02, "entryPrice": 50000.0, "markPrice": 50000.0},
+		}
+		s.mockTrader.stopOrderCancels = nil
+		s.autoTrader.reconcilePositions(&logger.DecisionRecord{})
+		s.Empty(s.mockTrader.stopOrderCancels)
+
+		// 止盈成交后持仓消失，撤销残留的止损单
+		s.mockTrader.positions = []map[string]interface{}{}
+		record := &logger.DecisionRecord{}
+		s.autoTrader.reconcilePositions(record)
+		s.Equal([]string{"BTCUSDT"}, s.mockTrader.stopOrderCancels)
+		s.NotContains(s.autoTrader.protectivePairs, "BTCUSDT_long")
+
+		var cancel *logger.DecisionAction
+		for i := range record.Decisions {
+			if record.Decisions[i].Action == "cancel_oco_survivor" {
+				cancel = &record.Decisions[i]
+			}
+		}
+		if s.NotNil(cancel, "应记录撤销残留挂单的动作") {
+			s.True(cancel.Success)
+			s.Equal(actions[0].OCOGroup, cancel.OCOGroup)
+		}
+	})
+}
+
+// precisionMockTrader 按 Hyperliquid 规则格式化价格和数量的模拟交易器
+type precisionMockTrader struct {
+	*MockTrader
+	hl *HyperliquidTrader
+}
+
+func (m *precisionMockTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
+	return m.hl.FormatQuantity(symbol, quantity)
+}
+
+func (m *precisionMockTrader) FormatPrice(symbol string, price float64) (string, error) {
+	return m.hl.FormatPrice(symbol, price)
+}
+
+// TestExecuteOpenPosition_FormatsProtectiveOrders 测试挂止损止盈单前按交易所精度格式化价格和数量：
+// Hyperliquid 的 BTC 价格为5位有效数字，与币安按 tickSize=0.1 格式化的结果不同
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_FormatsProtectiveOrders() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100000.0}, nil
+	})
+	precise := &precisionMockTrader{MockTrader: s.mockTrader, hl: &HyperliquidTrader{
+		meta: &hyperliquid.Meta{Universe: []hyperliquid.AssetInfo{{Name: "BTC", SzDecimals: 5}}},
+	}}
+	s.autoTrader.trader = precise
+	defer func() { s.autoTrader.trader = s.mockTrader }()
+	s.mockTrader.positions = []map[string]interface{}{}
+	s.mockTrader.stopLossOrders = nil
+	s.mockTrader.takeProfitOrders = nil
+
+	s.autoTrader.callCount++
+	d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1234.5, Leverage: 10,
+		StopLoss: 97654.32, TakeProfit: 104123.7}
+	entry := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	s.Require().NoError(s.autoTrader.executeOpenLongWithRecord(d, entry))
+
+	s.Require().Len(s.mockTrader.stopLossOrders, 1)
+	s.Require().Len(s.mockTrader.takeProfitOrders, 1)
+	s.Equal(97654.0, s.mockTrader.stopLossOrders[0].price)
+	s.Equal(104120.0, s.mockTrader.takeProfitOrders[0].price)
+	s.Equal(0.01235, s.mockTrader.stopLossOrders[0].quantity)
+	s.Equal(0.01235, s.mockTrader.takeProfitOrders[0].quantity)
+}
+
+// TestExecuteOpenPosition_MinNotional 测试开仓前的最小名义价值校验
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_MinNotional() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	s.mockTrader.symbolFilters = map[string]SymbolFilters{
+		"BTCUSDT": {StepSize: 0.001, MinNotional: 100.0},
+	}
+
+	tests := []struct {
+		name             string
+		positionSizeUSD  float64
+		autoBump         bool
+		expectedErr      error
+		expectedQuantity float64
+	}{
+		{
+			name:             "满足最小名义价值_正常开仓",
+			positionSizeUSD:  1000.0,
+			expectedQuantity: 0.02,
+		},
+		{
+			name:            "低于最小名义价值_拒绝开仓",
+			positionSizeUSD: 20.0,
+			expectedErr:     ErrMinNotional,
+		},
+		{
+			name:             "低于最小名义价值_允许上调数量",
+			positionSizeUSD:  20.0,
+			autoBump:         true,
+			expectedQuantity: 0.002,
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.autoTrader.config.AutoBumpMinNotional = tt.autoBump
+			defer func() { s.autoTrader.config.AutoBumpMinNotional = false }()
+
+			for _, action := range []string{"open_long", "open_short"} {
+				decision := &decision.Decision{Action: action, Symbol: "BTCUSDT", PositionSizeUSD: tt.positionSizeUSD, Leverage: 10}
+				actionRecord := &logger.DecisionAction{Action: action, Symbol: "BTCUSDT"}
+
+				var err error
+				if action == "open_long" {
+					err = s.autoTrader.executeOpenLongWithRecord(decision, actionRecord)
+				} else {
+					err = s.autoTrader.executeOpenShortWithRecord(decision, actionRecord)
+				}
+
+				if tt.expectedErr != nil {
+					s.ErrorIs(err, tt.expectedErr)
+					s.Zero(actionRecord.OrderID, "被拒绝的订单不应提交到交易所")
+				} else {
+					s.NoError(err)
+					s.InDelta(tt.expectedQuantity, actionRecord.Quantity, 1e-9)
+					s.GreaterOrEqual(actionRecord.Quantity*actionRecord.Price, 100.0-1e-6)
+				}
+			}
+		})
+	}
+}
+
+// TestExecuteOpenPosition_MaxOpenPositions 测试最大持仓数限制：达到上限拒绝开仓，平仓后可再开
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_MaxOpenPositions() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	s.autoTrader.config.MaxOpenPositions = 2
+	s.autoTrader.tradingCoins = []string{"BTC", "ETH", "SOL", "BNB"}
+	defer func() {
+		s.autoTrader.config.MaxOpenPositions = 0
+		s.mockTrader.positions = []map[string]interface{}{}
+	}()
+
+	// 已有2个持仓 + 1条数量为0的空仓记录（不计入）
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.5},
+		{"symbol": "ETHUSDT", "side": "short", "positionAmt": -2.0},
+		{"symbol": "SOLUSDT", "side": "long", "positionAmt": 0.0},
+	}
+
+	status := s.autoTrader.GetStatus()
+	s.Equal(2, status["open_positions"])
+	s.Equal(2, status["max_open_positions"])
+
+	// 第 N+1 个开仓被拒绝（多空都一样）
+	for _, action := range []string{"open_long", "open_short"} {
+		d := &decision.Decision{Action: action, Symbol: "BNBUSDT", PositionSizeUSD: 1000.0, Leverage: 5}
+		actionRecord := &logger.DecisionAction{Action: action, Symbol: "BNBUSDT"}
+		err := s.autoTrader.executeDecisionWithRecord(d, actionRecord)
+		s.Error(err)
+		s.Contains(err.Error(), "已达上限")
+		s.Zero(actionRecord.OrderID, "被拒绝的订单不应提交到交易所")
+	}
+
+	// 达到上限时平仓不受影响
+	closeRecord := &logger.DecisionAction{Action: "close_long", Symbol: "BTCUSDT"}
+	s.NoError(s.autoTrader.executeDecisionWithRecord(&decision.Decision{Action: "close_long", Symbol: "BTCUSDT"}, closeRecord))
+	s.NotZero(closeRecord.OrderID)
+
+	// 平仓后持仓数低于上限，可以开新仓
+	s.mockTrader.positions = s.mockTrader.positions[1:]
+	d := &decision.Decision{Action: "open_long", Symbol: "BNBUSDT", PositionSizeUSD: 1000.0, Leverage: 5}
+	actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	s.NoError(s.autoTrader.executeDecisionWithRecord(d, actionRecord))
+	s.NotZero(actionRecord.OrderID)
+}
+
+// TestDustPositions 测试零头持仓：名义价值低于最小名义价值时标记 is_dust、不计入最大持仓数，决策周期尝试全部平掉
+func (s *AutoTraderTestSuite) TestDustPositions() {
+	s.autoTrader.config.MaxOpenPositions = 2
+	s.mockTrader.symbolFilters = map[string]SymbolFilters{"BTCUSDT": {MinNotional: 100}, "ETHUSDT": {MinNotional: 20}}
+	s.mockTrader.closeOrders = nil
+	defer func() {
+		s.autoTrader.config.MaxOpenPositions = 0
+		s.autoTrader.config.DustThresholdUSD = 0
+		s.mockTrader.symbolFilters = nil
+		s.mockTrader.positions = []map[string]interface{}{}
+		s.mockTrader.closeOrders = nil
+	}()
+
+	// BTC 部分平仓后残留 0.0001 × 50000 = 5 USDT，低于最小名义价值 100
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "entryPrice": 50000.0, "markPrice": 50000.0, "positionAmt": 0.0001, "leverage": 10.0},
+		{"symbol": "ETHUSDT", "side": "short", "entryPrice": 3000.0, "markPrice": 3000.0, "positionAmt": -1.0, "leverage": 5.0},
+	}
+
+	positions, err := s.autoTrader.GetPositions()
+	s.Require().NoError(err)
+	s.Require().Len(positions, 2)
+	s.Equal(true, positions[0]["is_dust"])
+	s.Equal(false, positions[1]["is_dust"])
+
+	s.Equal(1, s.autoTrader.GetStatus()["open_positions"], "零头持仓不计入持仓数")
+	s.NoError(s.autoTrader.checkMaxOpenPositions(), "只有1个有效持仓，未达上限")
+
+	// 配置的阈值优先于交易所最小名义价值
+	s.autoTrader.config.DustThresholdUSD = 4000
+	s.Equal(0, s.autoTrader.GetStatus()["open_positions"])
+	s.autoTrader.config.DustThresholdUSD = 0
+
+	record := &logger.DecisionRecord{}
+	s.autoTrader.closeDustPositions(record)
+	s.Require().Len(s.mockTrader.closeOrders, 1)
+	s.Equal(mockCloseOrder{symbol: "BTCUSDT", side: "long", quantity: 0}, s.mockTrader.closeOrders[0], "零头按全部持仓平仓")
+	s.Require().Len(record.Decisions, 1)
+	s.Equal("auto_close_dust", record.Decisions[0].Action)
+	s.True(record.Decisions[0].Success)
+
+	// 交易所拒绝时只记录失败，不中断周期
+	s.mockTrader.shouldFailCloseLong = true
+	defer func() { s.mockTrader.shouldFailCloseLong = false }()
+	record = &logger.DecisionRecord{}
+	s.autoTrader.closeDustPositions(record)
+	s.Require().Len(record.Decisions, 1)
+	s.False(record.Decisions[0].Success)
+	s.NotEmpty(record.Decisions[0].Error)
+}
+
+// TestExecuteOpenPosition_MaxPositionPct 测试单币种仓位上限：按当前净值（而非初始余额）计算保证金占比，
+// 恰好等于上限时放行，超过上限时拒绝或缩减到上限
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_MaxPositionPct() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100.0}, nil
+	})
+	// 净值 = 10000 + 100 = 10100，上限 10% → 保证金最多 1010 USDT（10x 杠杆下名义价值 10100）
+	s.autoTrader.config.MaxPositionPct = 10
+	s.autoTrader.initialBalance = 1000
+	s.mockTrader.symbolFilters = map[string]SymbolFilters{"BTCUSDT": {StepSize: 1}}
+
+	open := func(sizeUSD float64) (*logger.DecisionAction, error) {
+		s.autoTrader.callCount++
+		s.mockTrader.positions = []map[string]interface{}{}
+		d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: sizeUSD, Leverage: 10}
+		actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+		err := s.autoTrader.executeDecisionWithRecord(d, actionRecord)
+		s.autoTrader.takePendingActions()
+		return actionRecord, err
+	}
+
+	for _, clamp := range []bool{false, true} {
+		s.autoTrader.config.ClampPositionSize = clamp
+
+		actionRecord, err := open(10100)
+		s.NoError(err, "恰好等于上限时放行")
+		s.InDelta(101, actionRecord.Quantity, 1e-9)
+	}
+
+	s.Run("超过上限拒绝", func() {
+		s.autoTrader.config.ClampPositionSize = false
+		actionRecord, err := open(10250)
+		s.Require().Error(err)
+		s.Contains(err.Error(), "超过单币种上限")
+		s.Zero(actionRecord.OrderID, "被拒绝的订单不应提交到交易所")
+	})
+
+	s.Run("超过上限缩减", func() {
+		s.autoTrader.config.ClampPositionSize = true
+		actionRecord, err := open(10250)
+		s.Require().NoError(err)
+		s.InDelta(101, actionRecord.Quantity, 1e-9, "数量应缩减到上限并按步进值取整")
+		s.NotZero(actionRecord.OrderID)
+	})
+}
+
+// TestExecuteAddPosition_MaxPositionPct 测试加仓按现有持仓+加仓后的总保证金校验单币种上限：超过上限时拒绝或只缩减加仓部分，
+// 现有持仓已达上限时缩减模式下也拒绝加仓
+func (s *AutoTraderTestSuite) TestExecuteAddPosition_MaxPositionPct() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100.0}, nil
+	})
+	// 净值 10100，上限 10% → 保证金最多 1010 USDT（10x 杠杆下最多持有 101 个）
+	s.autoTrader.config.MaxPositionPct = 10
+	s.mockTrader.symbolFilters = map[string]SymbolFilters{"BTCUSDT": {StepSize: 1}}
+	defer func() {
+		s.autoTrader.config.MaxPositionPct = 0
+		s.autoTrader.config.ClampPositionSize = false
+		s.mockTrader.symbolFilters = nil
+		s.mockTrader.positions = []map[string]interface{}{}
+	}()
+
+	add := func(existingQty, sizeUSD float64) (*logger.DecisionAction, error) {
+		s.autoTrader.callCount++
+		s.mockTrader.positions = []map[string]interface{}{
+			{"symbol": "BTCUSDT", "side": "long", "positionAmt": existingQty, "entryPrice": 100.0, "markPrice": 100.0, "leverage": 10.0},
+		}
+		d := &decision.Decision{Action: "add_position", Symbol: "BTCUSDT", PositionSizeUSD: sizeUSD}
+		actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+		err := s.autoTrader.executeDecisionWithRecord(d, actionRecord)
+		s.autoTrader.takePendingActions()
+		return actionRecord, err
+	}
+
+	s.Run("未超过上限放行", func() {
+		actionRecord, err := add(50, 5100)
+		s.Require().NoError(err)
+		s.InDelta(51, actionRecord.Quantity, 1e-9)
+	})
+
+	s.Run("加仓后超过上限拒绝", func() {
+		s.autoTrader.config.ClampPositionSize = false
+		actionRecord, err := add(50, 10000)
+		s.Require().Error(err)
+		s.Contains(err.Error(), "超过单币种上限")
+		s.Zero(actionRecord.OrderID, "被拒绝的加仓不应提交到交易所")
+	})
+
+	s.Run("加仓后超过上限缩减加仓部分", func() {
+		s.autoTrader.config.ClampPositionSize = true
+		actionRecord, err := add(50, 10000)
+		s.Require().NoError(err)
+		s.InDelta(51, actionRecord.Quantity, 1e-9, "总数量缩减到上限 101，加仓 51")
+		s.NotZero(actionRecord.OrderID)
+	})
+
+	s.Run("现有持仓已达上限_缩减模式也拒绝", func() {
+		s.autoTrader.config.ClampPositionSize = true
+		actionRecord, err := add(101, 1000)
+		s.Require().Error(err)
+		s.Contains(err.Error(), "无法加仓")
+		s.Zero(actionRecord.OrderID)
+	})
+}
+
+// TestExecuteOpenPosition_SpreadGuard 测试点差保护：点差超过所属档位上限时拒绝开仓且不下单，点差正常时开仓，平仓不检查点差
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_SpreadGuard() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100.0}, nil
+	})
+	var book market.OrderBook
+	bookFetches := 0
+	s.patches.ApplyFunc(market.GetOrderBook, func(symbol string) (*market.OrderBook, error) {
+		bookFetches++
+		return &book, nil
+	})
+	wide := market.OrderBook{Bids: []market.DepthLevel{{Price: 99.8, Quantity: 1}}, Asks: []market.DepthLevel{{Price: 100.2, Quantity: 1}}}    // 40 bps
+	tight := market.OrderBook{Bids: []market.DepthLevel{{Price: 99.99, Quantity: 1}}, Asks: []market.DepthLevel{{Price: 100.01, Quantity: 1}}} // 2 bps
+
+	s.autoTrader.config.BTCETHMaxSpreadBps = 5
+	s.autoTrader.config.AltcoinMaxSpreadBps = 50
+	defer func() {
+		s.autoTrader.config.BTCETHMaxSpreadBps = 0
+		s.autoTrader.config.AltcoinMaxSpreadBps = 0
+	}()
+
+	open := func(symbol string) (*logger.DecisionAction, error) {
+		s.autoTrader.callCount++
+		s.mockTrader.positions = []map[string]interface{}{}
+		d := &decision.Decision{Action: "open_long", Symbol: symbol, PositionSizeUSD: 1000, Leverage: 5}
+		actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+		err := s.autoTrader.executeDecisionWithRecord(d, actionRecord)
+		s.autoTrader.takePendingActions()
+		return actionRecord, err
+	}
+
+	book = wide
+	actionRecord, err := open("BTCUSDT")
+	s.Require().Error(err)
+	s.Contains(err.Error(), "点差过大，跳过开仓")
+	s.Zero(actionRecord.OrderID, "被拒绝的订单不应提交到交易所")
+
+	// 同样的点差在山寨币档位内
+	s.autoTrader.defaultCoins = append(s.autoTrader.defaultCoins, "SOL")
+	defer func() { s.autoTrader.defaultCoins = []string{"BTC", "ETH"} }()
+	actionRecord, err = open("SOLUSDT")
+	s.Require().NoError(err)
+	s.NotZero(actionRecord.OrderID)
+
+	book = tight
+	actionRecord, err = open("BTCUSDT")
+	s.Require().NoError(err)
+	s.NotZero(actionRecord.OrderID)
+
+	// 平仓不检查点差
+	book = wide
+	fetches := bookFetches
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 10.0, "entryPrice": 100.0, "markPrice": 100.0, "leverage": 5.0},
+	}
+	defer func() { s.mockTrader.positions = []map[string]interface{}{} }()
+	err = s.autoTrader.executeDecisionWithRecord(&decision.Decision{Action: "close_long", Symbol: "BTCUSDT"}, &logger.DecisionAction{Action: "close_long", Symbol: "BTCUSDT"})
+	s.NoError(err)
+	s.Equal(fetches, bookFetches)
+}
+
+// TestExecuteOpenPosition_CorrelatedExposure 测试相关性敞口限制：同向加仓高相关币种被拒绝，对冲方向允许；GetStatus 汇总持仓相关性
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_CorrelatedExposure() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	s.patches.ApplyFunc(market.GetCorrelationMatrix, func(symbols []string) map[string]map[string]float64 {
+		return map[string]map[string]float64{
+			"BTCUSDT": {"BTCUSDT": 1, "ETHUSDT": 0.9},
+			"ETHUSDT": {"ETHUSDT": 1, "BTCUSDT": 0.9},
+		}
+	})
+	s.autoTrader.config.MaxCorrelatedExposure = 1.5 // 净值 10100 → 上限 15150 USDT
+	defer func() {
+		s.autoTrader.config.MaxCorrelatedExposure = 0
+		s.mockTrader.positions = []map[string]interface{}{}
+	}()
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.2, "markPrice": 50000.0}, // 10000 USDT
+	}
+
+	// 同向开多 ETH 8000 USDT：√(10000² + 8000² + 2×0.9×10000×8000) ≈ 17550 > 15150
+	d := &decision.Decision{Action: "open_long", Symbol: "ETHUSDT", PositionSizeUSD: 8000.0, Leverage: 5}
+	actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	err := s.autoTrader.executeDecisionWithRecord(d, actionRecord)
+	s.Error(err)
+	s.Contains(err.Error(), "相关性调整敞口")
+	s.Zero(actionRecord.OrderID, "被拒绝的订单不应提交到交易所")
+
+	// 反向开空相当于对冲：√(10000² + 8000² − 2×0.9×10000×8000) ≈ 4472
+	d = &decision.Decision{Action: "open_short", Symbol: "ETHUSDT", PositionSizeUSD: 8000.0, Leverage: 5}
+	actionRecord = &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	s.NoError(s.autoTrader.executeDecisionWithRecord(d, actionRecord))
+	s.NotZero(actionRecord.OrderID)
+
+	// 持仓相关性摘要写入状态
+	correlations, summary := s.autoTrader.updatePositionCorrelation([]decision.PositionInfo{
+		{Symbol: "BTCUSDT", Side: "long", Quantity: 0.2, MarkPrice: 50000},
+		{Symbol: "ETHUSDT", Side: "long", Quantity: 4, MarkPrice: 2500},
+	})
+	s.Equal(0.9, correlations["BTCUSDT"]["ETHUSDT"])
+	if !s.NotNil(summary) {
+		return
+	}
+	status := s.autoTrader.GetStatus()["correlation"].(map[string]interface{})
+	s.Equal(0.9, status["max_pair_correlation"])
+	s.Equal([2]string{"BTCUSDT", "ETHUSDT"}, status["max_pair"])
+	s.InDelta(4/3.8, status["effective_positions"], 1e-9)
+
+	// 少于2个持仓时清空摘要
+	correlations, summary = s.autoTrader.updatePositionCorrelation(nil)
+	s.Nil(correlations)
+	s.Nil(summary)
+	s.Zero(s.autoTrader.GetStatus()["correlation"].(map[string]interface{})["effective_positions"])
+}
+
+// stubExposureGuard 记录上报和预占，按 err 拒绝开仓
+type stubExposureGuard struct {
+	reports  int
+	reserved []float64
+	err      error
+}
+
+func (g *stubExposureGuard) ReportAccount(traderID string, equity, marginUsed float64) {
+	g.reports++
+}
+
+func (g *stubExposureGuard) ReserveOpen(traderID string, margin float64) error {
+	if g.err != nil {
+		return g.err
+	}
+	g.reserved = append(g.reserved, margin)
+	return nil
+}
+
+// TestExecuteOpenPosition_AccountExposure 测试开仓前向账户协调方预占保证金，超过账户上限时不提交订单
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_AccountExposure() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	guard := &stubExposureGuard{}
+	s.autoTrader.SetExposureGuard(guard)
+	defer func() {
+		s.autoTrader.SetExposureGuard(nil)
+		s.mockTrader.positions = []map[string]interface{}{}
+	}()
+
+	d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 5}
+	actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	s.NoError(s.autoTrader.executeDecisionWithRecord(d, actionRecord))
+	s.NotZero(actionRecord.OrderID)
+	if s.Len(guard.reserved, 1) {
+		s.InDelta(200.0, guard.reserved[0], 1.0, "预占保证金 + 手续费")
+	}
+
+	guard.err = ErrAccountExposureLimit
+	d = &decision.Decision{Action: "open_long", Symbol: "ETHUSDT", PositionSizeUSD: 1000.0, Leverage: 5}
+	actionRecord = &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	err := s.autoTrader.executeDecisionWithRecord(d, actionRecord)
+	s.ErrorIs(err, ErrAccountExposureLimit)
+	s.Zero(actionRecord.OrderID, "被拒绝的订单不应提交到交易所")
+
+	// 构建上下文时上报账户快照
+	_, err = s.autoTrader.buildTradingContext()
+	s.NoError(err)
+	s.Equal(1, guard.reports)
+}
+
+// TestRequestDecision_FallbackModel 测试主模型调用失败时改用备用模型，并记录产生决策的模型
+func (s *AutoTraderTestSuite) TestRequestDecision_FallbackModel() {
+	s.patches.ApplyFunc(pool.GetOITopPositions, func() ([]pool.OIPosition, error) {
+		return nil, errors.New("disabled in test")
+	})
+
+	var primaryCalls, fallbackCalls int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"service unavailable"}`))
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalls++
+		content := "市场震荡，观望\n```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"观望\"}]\n```"
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+		})
+	}))
+	defer fallback.Close()
+
+	s.autoTrader.mcpClient = mcp.New()
+	s.autoTrader.mcpClient.SetAPIKey("primary-key", primary.URL, "primary-model")
+	s.autoTrader.aiModel = "custom"
+	s.autoTrader.config.CustomModelName = "primary-model"
+	ctx := &decision.Context{Account: decision.AccountInfo{TotalEquity: 10000}, BTCETHLeverage: 10, AltcoinLeverage: 5}
+
+	// 未配置备用模型：直接返回主模型错误
+	_, model, err := s.autoTrader.requestDecision(ctx)
+	s.Error(err)
+	s.ErrorIs(err, decision.ErrAICallFailed)
+	s.Equal("custom/primary-model", model)
+	s.Zero(fallbackCalls)
+
+	// 配置备用模型：主模型失败后由备用模型产生决策，客户端只创建一次并复用
+	s.autoTrader.config.FallbackAIModel = "custom"
+	s.autoTrader.config.FallbackAPIKey = "fallback-key"
+	s.autoTrader.config.FallbackAPIURL = fallback.URL
+	s.autoTrader.config.FallbackModelName = "fallback-model"
+
+	for i := 1; i <= 2; i++ {
+		fullDecision, model, err := s.autoTrader.requestDecision(ctx)
+		s.Require().NoError(err)
+		s.Equal("custom/fallback-model", model)
+		s.Require().Len(fullDecision.Decisions, 1)
+		s.Equal("wait", fullDecision.Decisions[0].Action)
+		s.Equal(i, fallbackCalls)
+	}
+	s.Equal(3, primaryCalls, "每个周期都应先尝试主模型")
+
+	client := s.autoTrader.getFallbackClient()
+	s.Same(client, s.autoTrader.getFallbackClient())
+}
+
+// orderCountingMockTrader 统计开仓下单次数的 mock 交易所
+type orderCountingMockTrader struct {
+	*MockTrader
+	opens int
+}
+
+func (m *orderCountingMockTrader) OpenLong(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	m.opens++
+	return m.MockTrader.OpenLong(symbol, positionSide, quantity, leverage)
+}
+
+func (m *orderCountingMockTrader) OpenShort(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	m.opens++
+	return m.MockTrader.OpenShort(symbol, positionSide, quantity, leverage)
+}
+
+// TestRunCycle_ShadowModel 测试影子模型：决策写入影子决策日志（shadow=true），只执行主模型的决策，影子决策不下单
+func (s *AutoTraderTestSuite) TestRunCycle_ShadowModel() {
+	s.patches.ApplyFunc(pool.GetOITopPositions, func() ([]pool.OIPosition, error) {
+		return nil, errors.New("disabled in test")
+	})
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	s.patches.ApplyFunc(market.GetDepthImbalance, func(symbol string) (*market.DepthImbalance, error) {
+		return nil, errors.New("no depth")
+	})
+
+	aiServer := func(content string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+			})
+		}))
+	}
+	primary := aiServer("市场震荡，观望\n```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"观望\"}]\n```")
+	defer primary.Close()
+	shadow := aiServer("趋势向上\n```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"open_long\", \"leverage\": 5, \"position_size_usd\": 1000, " +
+		"\"stop_loss\": 49000, \"take_profit\": 53000, \"confidence\": 80, \"risk_usd\": 20, \"reasoning\": \"突破做多\"}]\n```")
+	defer shadow.Close()
+
+	counting := &orderCountingMockTrader{MockTrader: s.mockTrader}
+	s.autoTrader.trader = counting
+	s.autoTrader.mcpClient = mcp.New()
+	s.autoTrader.mcpClient.SetAPIKey("primary-key", primary.URL, "primary-model")
+	s.autoTrader.config.ShadowAIModel = "custom"
+	s.autoTrader.config.ShadowAPIKey = "shadow-key"
+	s.autoTrader.config.ShadowAPIURL = shadow.URL
+	s.autoTrader.config.ShadowModelName = "shadow-model"
+	shadowLogger := logger.NewDecisionLogger(s.T().TempDir())
+	s.autoTrader.shadowLogger = shadowLogger
+
+	s.Require().NoError(s.autoTrader.runCycle())
+	s.autoTrader.shadowWG.Wait()
+
+	s.Zero(counting.opens, "影子决策不应下单")
+	records, err := s.mockLogger.GetLatestRecords(1)
+	s.Require().NoError(err)
+	s.Require().Len(records, 1)
+	s.False(records[0].Shadow)
+	s.Require().Len(records[0].Decisions, 1)
+	s.Equal("wait", records[0].Decisions[0].Action)
+
+	shadowRecords, err := shadowLogger.GetLatestRecords(10)
+	s.Require().NoError(err)
+	s.Require().Len(shadowRecords, 1)
+	shadowRecord := shadowRecords[0]
+	s.True(shadowRecord.Shadow)
+	s.True(shadowRecord.Success)
+	s.Equal("custom/shadow-model", shadowRecord.AIModel)
+	s.Require().Len(shadowRecord.Decisions, 1)
+	action := shadowRecord.Decisions[0]
+	s.Equal("open_long", action.Action)
+	s.False(action.Success, "影子决策从不执行")
+	s.Equal(50000.0, action.Price)
+	s.InDelta(0.02, action.Quantity, 1e-9)
+}
+
+// TestValidateDecisionResponse 测试解析并校验AI原始响应：与实盘周期相同的清洗、解析、排序去重和执行前校验，不下单
+func (s *AutoTraderTestSuite) TestValidateDecisionResponse() {
+	raw := "先平ETH再开BTC\n```json\n[\n" +
+		`{"symbol": "BTCUSDT", "action": "open_long", "leverage": 5, "position_size_usd": 1000, "stop_loss": 49000, "take_profit": 53000, "confidence": 80, "risk_usd": 20, "reasoning": "突破"},` + "\n" +
+		`{"symbol": "ETHUSDT", "action": "close_long", "reasoning": "止盈"},` + "\n" +
+		`{"symbol": "", "action": "close_short", "reasoning": "漏写币种"},` + "\n" +
+		`{"symbol": "ETHUSDT", "action": "close_long", "reasoning": "重复"},` + "\n" +
+		"]\n```"
+
+	result := s.autoTrader.ValidateDecisionResponse(raw, 0)
+	s.Empty(result.ParseError)
+	s.Contains(result.CoTTrace, "先平ETH再开BTC")
+	s.Contains(result.SchemaWarning, "缺少 schema_version", "未输出决策格式版本时应提示")
+	s.Len(result.Dropped, 1, "同一币种同一动作只保留第一条")
+	s.Require().Len(result.Decisions, 3)
+	s.Equal("close_long", result.Decisions[0].Decision.Action, "应按先平仓后开仓排序")
+	s.True(result.Decisions[0].Valid)
+	var invalid, open DecisionCheck
+	for _, check := range result.Decisions {
+		switch check.Decision.Symbol {
+		case "":
+			invalid = check
+		case "BTCUSDT":
+			open = check
+		}
+	}
+	s.False(invalid.Valid)
+	s.Contains(invalid.Error, "缺少币种", "执行前校验失败的决策应标记原因")
+	s.True(open.Valid)
+	s.Empty(s.mockTrader.stopLossOrders, "校验不应下单")
+
+	// 仓位超过账户净值允许的上限时解析失败（实盘周期不会执行任何决策），已提取的决策仍逐条校验
+	result = s.autoTrader.ValidateDecisionResponse(raw, 50)
+	s.Contains(result.ParseError, "BTC/ETH单币种仓位价值不能超过")
+	s.Len(result.Decisions, 3)
+
+	result = s.autoTrader.ValidateDecisionResponse("市场不明朗，继续观望", 0)
+	s.Empty(result.ParseError)
+	s.Require().Len(result.Decisions, 1)
+	s.Equal("wait", result.Decisions[0].Decision.Action, "没有JSON时与实盘一样回退为 wait")
+	s.Empty(result.SchemaWarning)
+}
+
+// TestRunCycle_ConsensusOpens 测试共识开仓：两次AI调用对同一币种开仓方向不一致时跳过开仓（记录"无共识"），一致时开仓
+func (s *AutoTraderTestSuite) TestRunCycle_ConsensusOpens() {
+	s.patches.ApplyFunc(pool.GetOITopPositions, func() ([]pool.OIPosition, error) {
+		return nil, errors.New("disabled in test")
+	})
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	s.patches.ApplyFunc(market.GetDepthImbalance, func(symbol string) (*market.DepthImbalance, error) {
+		return nil, errors.New("no depth")
+	})
+
+	openDecision := func(action string, stopLoss, takeProfit float64) string {
+		return fmt.Sprintf("分析\n```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"%s\", \"leverage\": 5, \"position_size_usd\": 1000, "+
+			"\"stop_loss\": %.0f, \"take_profit\": %.0f, \"confidence\": 80, \"risk_usd\": 20, \"reasoning\": \"开仓\"}]\n```", action, stopLoss, takeProfit)
+	}
+	openLong := openDecision("open_long", 49000, 53000)
+	openShort := openDecision("open_short", 51000, 47000)
+
+	var responses []string
+	aiCalls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content := responses[aiCalls%len(responses)]
+		aiCalls++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+		})
+	}))
+	defer server.Close()
+
+	counting := &orderCountingMockTrader{MockTrader: s.mockTrader}
+	s.autoTrader.trader = counting
+	s.autoTrader.mcpClient = mcp.New()
+	s.autoTrader.mcpClient.SetAPIKey("key", server.URL, "model")
+	s.autoTrader.config.ConsensusOpens = true
+
+	tests := []struct {
+		name      string
+		responses []string
+		wantOpens int
+		wantError string
+	}{
+		{name: "方向不一致_跳过开仓", responses: []string{openLong, openShort}, wantOpens: 0, wantError: "无共识"},
+		{name: "方向一致_开仓", responses: []string{openLong, openLong}, wantOpens: 1},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.mockTrader.positions = []map[string]interface{}{}
+			responses = tt.responses
+			aiCalls = 0
+			counting.opens = 0
+
+			s.Require().NoError(s.autoTrader.runCycle())
+
+			s.Equal(2, aiCalls, "有开仓决策时应再调用一次AI确认")
+			s.Equal(tt.wantOpens, counting.opens)
+			records, err := s.mockLogger.GetLatestRecords(1)
+			s.Require().NoError(err)
+			s.Require().NotEmpty(records)
+			s.Require().NotEmpty(records[0].Decisions)
+			action := records[0].Decisions[0]
+			s.Equal("open_long", action.Action)
+			s.Equal(tt.wantError, action.Error)
+			s.Equal(tt.wantError == "", action.Success)
+		})
+	}
+}
+
+// TestRunCycle_EmptyDecision 测试AI返回空决策数组时记录为成功的 hold（不是错误），开启重试且有持仓时重新请求一次
+func (s *AutoTraderTestSuite) TestRunCycle_EmptyDecision() {
+	s.patches.ApplyFunc(pool.GetOITopPositions, func() ([]pool.OIPosition, error) {
+		return nil, errors.New("disabled in test")
+	})
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	s.patches.ApplyFunc(market.GetDepthImbalance, func(symbol string) (*market.DepthImbalance, error) {
+		return nil, errors.New("no depth")
+	})
+
+	empty := "<reasoning>行情平淡</reasoning>\n<decision>\n```json\n[]\n```\n</decision>"
+	closeLong := "<reasoning>止盈</reasoning>\n<decision>\n```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"close_long\", \"reasoning\": \"止盈\"}]\n```\n</decision>"
+
+	var responses []string
+	aiCalls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content := responses[min(aiCalls, len(responses)-1)]
+		aiCalls++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+		})
+	}))
+	defer server.Close()
+	s.autoTrader.mcpClient = mcp.New()
+	s.autoTrader.mcpClient.SetAPIKey("key", server.URL, "model")
+	defer func() { s.mockTrader.positions = []map[string]interface{}{} }()
+
+	btcLong := []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "entryPrice": 49000.0, "markPrice": 50000.0, "positionAmt": 0.1, "unRealizedProfit": 100.0, "leverage": 5.0},
+	}
+
+	tests := []struct {
+		name       string
+		retry      bool
+		positions  []map[string]interface{}
+		responses  []string
+		wantCalls  int
+		wantAction string
+	}{
+		{name: "空决策记录为hold", responses: []string{empty}, wantCalls: 1, wantAction: "hold"},
+		{name: "开启重试但无持仓_不重试", retry: true, responses: []string{empty, closeLong}, wantCalls: 1, wantAction: "hold"},
+		{name: "有持仓_重试仍为空", retry: true, positions: btcLong, responses: []string{empty, empty}, wantCalls: 2, wantAction: "hold"},
+		{name: "有持仓_重试返回决策", retry: true, positions: btcLong, responses: []string{empty, closeLong}, wantCalls: 2, wantAction: "close_long"},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.autoTrader.config.RetryEmptyDecision = tt.retry
+			s.mockTrader.positions = tt.positions
+			s.autoTrader.decisionLogger = logger.NewDecisionLogger(s.T().TempDir())
+			responses = tt.responses
+			aiCalls = 0
+
+			s.Require().NoError(s.autoTrader.runCycle(), "空决策不是错误")
+			s.Equal(tt.wantCalls, aiCalls)
+
+			records, err := s.autoTrader.decisionLogger.GetLatestRecords(1)
+			s.Require().NoError(err)
+			s.Require().Len(records, 1)
+			record := records[0]
+			s.True(record.Success, "空决策周期应记录为成功，与解析失败区分")
+			s.Empty(record.ErrorMessage)
+			s.Require().NotEmpty(record.Decisions)
+			action := record.Decisions[0]
+			s.Equal(tt.wantAction, action.Action)
+			s.True(action.Success)
+			if tt.wantAction == "hold" {
+				s.Equal(emptyDecisionReason, action.Reasoning)
+			}
+		})
+	}
+}
+
+// TestRunCycle_SkipAIWithoutTrigger 测试AI调用预过滤：无持仓且无触发条件时跳过AI调用并记录 hold，
+// 涨跌幅或放量达到阈值、或有持仓时照常调用AI
+func (s *AutoTraderTestSuite) TestRunCycle_SkipAIWithoutTrigger() {
+	s.patches.ApplyFunc(pool.GetOITopPositions, func() ([]pool.OIPosition, error) {
+		return nil, errors.New("disabled in test")
+	})
+	s.patches.ApplyFunc(market.GetDepthImbalance, func(symbol string) (*market.DepthImbalance, error) {
+		return nil, errors.New("no depth")
+	})
+	var priceChange1h float64
+	var volumes []float64
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{
+			Symbol:         symbol,
+			CurrentPrice:   50000.0,
+			PriceChange1h:  priceChange1h,
+			IntradaySeries: &market.IntradayData{Volume: volumes},
+		}, nil
+	})
+
+	aiCalls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		aiCalls++
+		content := "观望\n```json\n[{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"观望\"}]\n```"
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+		})
+	}))
+	defer server.Close()
+	s.autoTrader.mcpClient = mcp.New()
+	s.autoTrader.mcpClient.SetAPIKey("key", server.URL, "model")
+	s.autoTrader.config.SkipAIWithoutTrigger = true
+	s.autoTrader.config.TriggerPriceMovePct = 1.5
+
+	tests := []struct {
+		name          string
+		priceChange1h float64
+		volumes       []float64
+		positions     []map[string]interface{}
+		wantAICall    bool
+	}{
+		{name: "无持仓且无触发条件时跳过", priceChange1h: -1.2, volumes: []float64{100, 120, 80, 150}},
+		{name: "1小时涨跌幅达到阈值", priceChange1h: -1.6, volumes: []float64{100, 120, 80, 150}, wantAICall: true},
+		{name: "3分钟放量达到默认阈值", priceChange1h: 0.3, volumes: []float64{100, 120, 80, 300}, wantAICall: true},
+		{
+			name:    "有持仓时始终调用AI",
+			volumes: []float64{100, 120, 80, 150},
+			positions: []map[string]interface{}{{
+				"symbol": "BTCUSDT", "side": "long", "entryPrice": 50000.0, "markPrice": 50000.0,
+				"positionAmt": 0.1, "unRealizedProfit": 0.0, "liquidationPrice": 45000.0, "leverage": 10.0,
+			}},
+			wantAICall: true,
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			priceChange1h, volumes = tt.priceChange1h, tt.volumes
+			s.mockTrader.positions = tt.positions
+			defer func() { s.mockTrader.positions = []map[string]interface{}{} }()
+			callsBefore := aiCalls
+			skippedBefore := s.autoTrader.GetStatus()["skipped_ai_calls"].(int64)
+
+			s.Require().NoError(s.autoTrader.runCycle())
+
+			records, err := s.mockLogger.GetLatestRecords(1)
+			s.Require().NoError(err)
+			s.Require().Len(records, 1)
+			s.Require().NotEmpty(records[0].Decisions)
+			action := records[0].Decisions[len(records[0].Decisions)-1]
+			skipped := s.autoTrader.GetStatus()["skipped_ai_calls"].(int64) - skippedBefore
+			if tt.wantAICall {
+				s.Equal(callsBefore+1, aiCalls)
+				s.Zero(skipped)
+				s.Equal("wait", action.Action)
+			} else {
+				s.Equal(callsBefore, aiCalls, "不应调用AI")
+				s.Equal(int64(1), skipped)
+				s.Equal("hold", action.Action)
+				s.Equal("no trigger", action.Reasoning)
+			}
+		})
+	}
+}
+
+// idempotentMockTrader 按客户端订单ID去重的 mock 交易所，可模拟订单已成交但响应丢失
+type idempotentMockTrader struct {
+	*MockTrader
+	orders       map[string]map[string]interface{} // clientOrderID -> 订单
+	calls        int
+	lostResponse int           // 剩余需要丢失响应的次数
+	rejectErr    error         // 非 nil 时交易所拒绝下单
+	delay        time.Duration // 下单响应延迟（模拟交易所响应缓慢）
+	canceled     []string      // CancelOrderByClientID 撤销的客户端订单ID
+}
+
+func (m *idempotentMockTrader) CancelOrderByClientID(symbol string, clientOrderID string) error {
+	m.canceled = append(m.canceled, clientOrderID)
+	return nil
+}
+
+func (m *idempotentMockTrader) GetOrderByClientID(symbol string, clientOrderID string) (map[string]interface{}, error) {
+	return m.orders[clientOrderID], nil
+}
+
+func (m *idempotentMockTrader) submit(symbol, clientOrderID string) (map[string]interface{}, error) {
+	if m.delay > 0 {
+		time.Sleep(m.delay)
+		return nil, errors.New("slow exchange")
+	}
+	m.calls++
+	if m.rejectErr != nil {
+		return nil, m.rejectErr
+	}
+	order, exists := m.orders[clientOrderID]
+	if !exists {
+		order = map[string]interface{}{"orderId": int64(len(m.orders) + 1), "symbol": symbol, "clientOrderId": clientOrderID}
+		m.orders[clientOrderID] = order
+	}
+	if m.lostResponse > 0 {
+		m.lostResponse--
+		return nil, errors.New("read: connection reset by peer")
+	}
+	return order, nil
+}
+
+func (m *idempotentMockTrader) OpenLongWithClientID(symbol string, positionSide string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
+	return m.submit(symbol, clientOrderID)
+}
+
+func (m *idempotentMockTrader) OpenShortWithClientID(symbol string, positionSide string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
+	return m.submit(symbol, clientOrderID)
+}
+
+func (m *idempotentMockTrader) CloseLongWithClientID(symbol string, positionSide string, quantity float64, clientOrderID string) (map[string]interface{}, error) {
+	return m.submit(symbol, clientOrderID)
+}
+
+func (m *idempotentMockTrader) CloseShortWithClientID(symbol string, positionSide string, quantity float64, clientOrderID string) (map[string]interface{}, error) {
+	return m.submit(symbol, clientOrderID)
+}
+
+// TestSubmitOrder_IdempotentRetry 测试下单响应丢失后用同一客户端订单ID重试只产生一笔订单，周期内重跑同一决策不重复下单
+func (s *AutoTraderTestSuite) TestSubmitOrder_IdempotentRetry() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	oldDelay := orderRetryDelay
+	orderRetryDelay = 0
+	defer func() { orderRetryDelay = oldDelay }()
+
+	exchange := &idempotentMockTrader{MockTrader: s.mockTrader, orders: make(map[string]map[string]interface{}), lostResponse: 1}
+	s.autoTrader.trader = exchange
+	s.autoTrader.callCount = 7
+
+	d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10}
+	actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	s.NoError(s.autoTrader.executeDecisionWithRecord(d, actionRecord))
+
+	wantID := clientOrderID("test_trader", 0, 7, "BTCUSDT", "open_long")
+	s.Equal(2, exchange.calls, "响应丢失后应重试一次")
+	s.Len(exchange.orders, 1, "重试不应产生第二笔订单")
+	s.Equal(wantID, actionRecord.ClientOrderID)
+	s.Equal(int64(1), actionRecord.OrderID)
+
+	// 同一周期重跑同一决策：直接返回已提交的订单
+	actionRecord = &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	s.NoError(s.autoTrader.executeDecisionWithRecord(d, actionRecord))
+	s.Equal(2, exchange.calls)
+	s.Equal(wantID, actionRecord.ClientOrderID)
+
+	// 新周期的同一决策是新订单
+	s.autoTrader.callCount++
+	actionRecord = &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	s.NoError(s.autoTrader.executeDecisionWithRecord(d, actionRecord))
+	s.Len(exchange.orders, 2)
+	s.NotEqual(wantID, actionRecord.ClientOrderID)
+
+	// 确定性：相同输入得到相同ID，长度满足交易所限制
+	s.Equal(wantID, clientOrderID("test_trader", 0, 7, "BTCUSDT", "open_long"))
+	s.NotEqual(wantID, clientOrderID("test_trader", 0, 7, "BTCUSDT", "open_short"))
+	s.Len(wantID, 20)
+}
+
+// TestSubmitOrder_NoRetryOnRejection 测试交易所明确拒绝（保证金不足等）时不重试，网络错误和限频仍会重试
+func (s *AutoTraderTestSuite) TestSubmitOrder_NoRetryOnRejection() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	oldDelay := orderRetryDelay
+	orderRetryDelay = 0
+	defer func() { orderRetryDelay = oldDelay }()
+
+	tests := []struct {
+		name      string
+		rejectErr error
+		wantCalls int
+	}{
+		{name: "保证金不足", rejectErr: fmt.Errorf("%w: HTTP 400", ErrInsufficientMargin), wantCalls: 1},
+		{name: "低于最小名义价值", rejectErr: fmt.Errorf("%w: HTTP 400", ErrMinNotional), wantCalls: 1},
+		{name: "请求频率超限", rejectErr: fmt.Errorf("%w: HTTP 429", ErrRateLimited), wantCalls: orderSubmitAttempts},
+		{name: "网络错误", rejectErr: errors.New("read: connection reset by peer"), wantCalls: orderSubmitAttempts},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			exchange := &idempotentMockTrader{MockTrader: s.mockTrader, orders: make(map[string]map[string]interface{}), rejectErr: tt.rejectErr}
+			s.autoTrader.trader = exchange
+			s.autoTrader.callCount++
+
+			d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10}
+			err := s.autoTrader.executeDecisionWithRecord(d, &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol})
+			s.ErrorIs(err, tt.rejectErr)
+			s.Equal(tt.wantCalls, exchange.calls)
+		})
+	}
+}
+
+// batchMockTrader 支持批量下单的 mock 交易所，记录每次批量请求和逐笔开仓
+type batchMockTrader struct {
+	*MockTrader
+	batches    [][]OrderRequest
+	sequential []string         // 逐笔开仓的币种
+	rejects    map[string]error // 批量中被交易所拒绝的币种
+	batchErr   error            // 非 nil 时批量请求整体失败
+	batchDelay time.Duration    // 批量请求响应延迟（模拟批量接口响应缓慢）
+}
+
+func (m *batchMockTrader) PlaceBatchOrders(orders []OrderRequest) ([]OrderResult, error) {
+	m.batches = append(m.batches, orders)
+	if m.batchDelay > 0 {
+		time.Sleep(m.batchDelay)
+		return nil, errors.New("slow exchange")
+	}
+	if m.batchErr != nil {
+		return nil, m.batchErr
+	}
+	results := make([]OrderResult, len(orders))
+	for k, o := range orders {
+		if err := m.rejects[o.Symbol]; err != nil {
+			results[k].Err = err
+			continue
+		}
+		results[k].Order = map[string]interface{}{"orderId": int64(2000 + k), "symbol": o.Symbol, "clientOrderId": o.ClientOrderID}
+	}
+	return results, nil
+}
+
+func (m *batchMockTrader) OpenLong(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	m.sequential = append(m.sequential, symbol)
+	return m.MockTrader.OpenLong(symbol, positionSide, quantity, leverage)
+}
+
+func (m *batchMockTrader) OpenShort(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	m.sequential = append(m.sequential, symbol)
+	return m.MockTrader.OpenShort(symbol, positionSide, quantity, leverage)
+}
+
+// idempotentBatchMockTrader 支持批量下单、按客户端订单ID查询和撤单的 mock 交易所，批量接口响应缓慢或响应丢失
+type idempotentBatchMockTrader struct {
+	*idempotentMockTrader
+	batchDelay  time.Duration
+	batchFilled bool // 批量订单已在交易所成交，但响应丢失
+}
+
+func (m *idempotentBatchMockTrader) PlaceBatchOrders(orders []OrderRequest) ([]OrderResult, error) {
+	if m.batchFilled {
+		for _, o := range orders {
+			m.orders[o.ClientOrderID] = map[string]interface{}{"orderId": int64(len(m.orders) + 1), "symbol": o.Symbol, "clientOrderId": o.ClientOrderID}
+		}
+		return nil, errors.New("read: connection reset by peer")
+	}
+	time.Sleep(m.batchDelay)
+	return nil, errors.New("slow exchange")
+}
+
+// sequentialMockTrader 不支持批量下单的 mock 交易所，记录逐笔开仓
+type sequentialMockTrader struct {
+	*MockTrader
+	opens []string
+}
+
+func (m *sequentialMockTrader) OpenLong(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	m.opens = append(m.opens, symbol)
+	return m.MockTrader.OpenLong(symbol, positionSide, quantity, leverage)
+}
+
+func (m *sequentialMockTrader) OpenShort(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	m.opens = append(m.opens, symbol)
+	return m.MockTrader.OpenShort(symbol, positionSide, quantity, leverage)
+}
+
+// TestExecuteOpenBatch 测试同一周期的多个开仓合并为一次批量请求，每笔订单的结果记回对应的决策；
+// 不支持批量的交易所和批量请求整体失败时逐笔下单
+func (s *AutoTraderTestSuite) TestExecuteOpenBatch() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100.0}, nil
+	})
+	s.autoTrader.defaultCoins = []string{"BTC", "ETH", "SOL"}
+	newItems := func() []batchOpen {
+		s.autoTrader.callCount++
+		s.mockTrader.positions = []map[string]interface{}{}
+		var items []batchOpen
+		for _, d := range []decision.Decision{
+			{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10},
+			{Action: "open_short", Symbol: "ETHUSDT", PositionSizeUSD: 1000.0, Leverage: 5},
+			{Action: "open_long", Symbol: "SOLUSDT", PositionSizeUSD: 1000.0, Leverage: 5},
+		} {
+			items = append(items, batchOpen{decision: &d, record: &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}})
+		}
+		return items
+	}
+
+	s.Run("批量提交_逐笔记录结果", func() {
+		exchange := &batchMockTrader{MockTrader: s.mockTrader, rejects: map[string]error{
+			"ETHUSDT": fmt.Errorf("%w: code=-2019", ErrInsufficientMargin),
+		}}
+		s.autoTrader.trader = exchange
+		defer func() { s.autoTrader.trader = s.mockTrader }()
+
+		items := newItems()
+		errs := s.autoTrader.executeOpenBatch(items)
+		s.autoTrader.takePendingActions()
+
+		s.Require().Len(exchange.batches, 1, "三笔开仓应合并为一次批量请求")
+		s.Require().Len(exchange.batches[0], 3)
+		s.Empty(exchange.sequential)
+		s.Equal(OrderRequest{Symbol: "ETHUSDT", PositionSide: PositionSideShort, Quantity: 10, Leverage: 5,
+			ClientOrderID: clientOrderID("test_trader", 0, s.autoTrader.callCount, "ETHUSDT", "open_short")}, exchange.batches[0][1])
+
+		s.NoError(errs[0])
+		s.ErrorIs(errs[1], ErrInsufficientMargin, "被拒绝的订单错误应记回对应决策")
+		s.NoError(errs[2])
+		s.Equal(int64(2000), items[0].record.OrderID)
+		s.Zero(items[1].record.OrderID)
+		s.Equal(int64(2002), items[2].record.OrderID)
+		s.Equal(exchange.batches[0][2].ClientOrderID, items[2].record.ClientOrderID)
+
+		// 同一周期重跑：已提交的订单不再重复下单
+		exchange.rejects = nil
+		items[0].record.OrderID = 0
+		s.autoTrader.executeOpenBatch(items[:1:1])
+		s.autoTrader.takePendingActions()
+		s.Len(exchange.batches, 1)
+	})
+
+	s.Run("最大持仓数计入同批次的仓位", func() {
+		exchange := &batchMockTrader{MockTrader: s.mockTrader}
+		s.autoTrader.trader = exchange
+		s.autoTrader.config.MaxOpenPositions = 2
+		defer func() {
+			s.autoTrader.trader = s.mockTrader
+			s.autoTrader.config.MaxOpenPositions = 0
+		}()
+
+		errs := s.autoTrader.executeOpenBatch(newItems())
+		s.autoTrader.takePendingActions()
+
+		s.NoError(errs[0])
+		s.NoError(errs[1])
+		s.Error(errs[2], "第三笔开仓超过最大持仓数")
+		s.Require().Len(exchange.batches, 1)
+		s.Len(exchange.batches[0], 2)
+		s.Zero(s.autoTrader.batchReserved, "批量校验结束后应释放预占")
+	})
+
+	s.Run("批量请求失败_逐笔回退", func() {
+		exchange := &batchMockTrader{MockTrader: s.mockTrader, batchErr: errors.New("read: connection reset by peer")}
+		s.autoTrader.trader = exchange
+		defer func() { s.autoTrader.trader = s.mockTrader }()
+
+		errs := s.autoTrader.executeOpenBatch(newItems())
+		s.autoTrader.takePendingActions()
+
+		s.Len(exchange.batches, 1)
+		s.Equal([]string{"BTCUSDT", "ETHUSDT", "SOLUSDT"}, exchange.sequential)
+		for _, err := range errs {
+			s.NoError(err)
+		}
+	})
+
+	s.Run("批量请求超时_撤单后按客户端订单ID逐笔回退", func() {
+		exchange := &idempotentBatchMockTrader{
+			idempotentMockTrader: &idempotentMockTrader{MockTrader: s.mockTrader, orders: make(map[string]map[string]interface{})},
+			batchDelay:           time.Second,
+		}
+		s.autoTrader.trader = exchange
+		s.autoTrader.config.OrderTimeout = 20 * time.Millisecond
+		defer func() {
+			s.autoTrader.trader = s.mockTrader
+			s.autoTrader.config.OrderTimeout = 0
+		}()
+
+		start := time.Now()
+		items := newItems()
+		errs := s.autoTrader.executeOpenBatch(items)
+		s.autoTrader.takePendingActions()
+
+		s.Less(time.Since(start), 500*time.Millisecond, "超时后应立即返回，不等待批量接口响应")
+		var ids []string
+		for k, item := range items {
+			s.NoError(errs[k])
+			ids = append(ids, clientOrderID("test_trader", 0, s.autoTrader.callCount, item.decision.Symbol, item.decision.Action))
+		}
+		s.Equal(ids, exchange.canceled, "超时的批量订单应逐笔按客户端订单ID撤销")
+		s.Len(exchange.orders, 3, "逐笔回退沿用原客户端订单ID")
+	})
+
+	s.Run("批量已成交但响应丢失_查询到订单不重复提交", func() {
+		exchange := &idempotentBatchMockTrader{
+			idempotentMockTrader: &idempotentMockTrader{MockTrader: s.mockTrader, orders: make(map[string]map[string]interface{})},
+			batchFilled:          true,
+		}
+		s.autoTrader.trader = exchange
+		defer func() { s.autoTrader.trader = s.mockTrader }()
+
+		items := newItems()
+		errs := s.autoTrader.executeOpenBatch(items)
+		s.autoTrader.takePendingActions()
+
+		s.Zero(exchange.calls, "批量订单已成交，不应逐笔重新提交")
+		s.Len(exchange.orders, 3)
+		for k, item := range items {
+			s.NoError(errs[k])
+			s.Equal(exchange.orders[item.record.ClientOrderID]["orderId"], item.record.OrderID, "应记录交易所上已有的订单")
+		}
+	})
+
+	s.Run("批量请求超时_交易所不能去重时不重试", func() {
+		exchange := &batchMockTrader{MockTrader: s.mockTrader, batchDelay: time.Second}
+		s.autoTrader.trader = exchange
+		s.autoTrader.config.OrderTimeout = 20 * time.Millisecond
+		defer func() {
+			s.autoTrader.trader = s.mockTrader
+			s.autoTrader.config.OrderTimeout = 0
+		}()
+
+		errs := s.autoTrader.executeOpenBatch(newItems())
+		s.autoTrader.takePendingActions()
+
+		s.Empty(exchange.sequential, "订单可能已到达交易所，不应逐笔重复下单")
+		for _, err := range errs {
+			s.ErrorIs(err, ErrOrderTimeout)
+		}
+	})
+
+	s.Run("不支持批量的交易所逐笔下单", func() {
+		exchange := &sequentialMockTrader{MockTrader: s.mockTrader}
+		s.autoTrader.trader = exchange
+		defer func() { s.autoTrader.trader = s.mockTrader }()
+
+		items := newItems()
+		errs := s.autoTrader.executeOpenBatch(items)
+		s.autoTrader.takePendingActions()
+
+		s.Equal([]string{"BTCUSDT", "ETHUSDT", "SOLUSDT"}, exchange.opens)
+		for k, err := range errs {
+			s.NoError(err)
+			s.NotZero(items[k].record.OrderID)
+		}
+	})
+}
+
+// TestSubmitOrder_Timeout 测试交易所超过下单超时未返回时按客户端订单ID撤单并返回超时错误，且不重试
+func (s *AutoTraderTestSuite) TestSubmitOrder_Timeout() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+
+	exchange := &idempotentMockTrader{MockTrader: s.mockTrader, orders: make(map[string]map[string]interface{}), delay: time.Second}
+	s.autoTrader.trader = exchange
+	s.autoTrader.config.OrderTimeout = 20 * time.Millisecond
+	s.autoTrader.callCount = 3
+
+	d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10}
+	start := time.Now()
+	err := s.autoTrader.executeDecisionWithRecord(d, &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol})
+
+	s.ErrorIs(err, ErrOrderTimeout)
+	s.Less(time.Since(start), 500*time.Millisecond, "超时后应立即返回，不等待交易所响应")
+	s.Equal([]string{clientOrderID("test_trader", 0, 3, "BTCUSDT", "open_long")}, exchange.canceled, "超时订单应按客户端订单ID撤销一次")
+}
+
+// TestClosePosition_ClampToHeldQuantity 测试平仓数量超过实际持仓时截断为持仓数量，不会反向开仓
+func (s *AutoTraderTestSuite) TestClosePosition_ClampToHeldQuantity() {
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.5, "markPrice": 50000.0},
+		{"symbol": "ETHUSDT", "side": "short", "positionAmt": -2.0, "markPrice": 3000.0},
+	}
+	s.mockTrader.closeOrders = nil
+	defer func() { s.mockTrader.positions = []map[string]interface{}{} }()
+
+	tests := []struct {
+		name         string
+		symbol       string
+		side         string
+		quantity     float64
+		wantQuantity float64
+		wantOrderQty float64
+	}{
+		{name: "多仓_超过持仓截断", symbol: "BTCUSDT", side: "long", quantity: 0.8, wantQuantity: 0.5, wantOrderQty: 0.5},
+		{name: "空仓_超过持仓截断", symbol: "ETHUSDT", side: "short", quantity: 5.0, wantQuantity: 2.0, wantOrderQty: 2.0},
+		{name: "未超过持仓不变", symbol: "BTCUSDT", side: "long", quantity: 0.2, wantQuantity: 0.2, wantOrderQty: 0.2},
+		{name: "全部平仓", symbol: "ETHUSDT", side: "short", quantity: 0, wantQuantity: 2.0, wantOrderQty: 0},
 	}
 
 	for _, tt := range tests {
-		time.Sleep(time.Millisecond)
 		s.Run(tt.name, func() {
-			s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
-				return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
-			})
+			s.autoTrader.callCount++ // 每个用例模拟一个新周期（同一周期内同一决策不会重复下单）
+			_, quantity, err := s.autoTrader.closePosition(tt.symbol, tt.side, tt.quantity, "partial_close")
+			s.NoError(err)
+			s.Equal(tt.wantQuantity, quantity)
 
-			s.mockTrader.balance["availableBalance"] = tt.availBalance
-			if tt.existingSide != "" {
-				s.mockTrader.positions = []map[string]interface{}{{"symbol": "BTCUSDT", "side": tt.existingSide}}
-			} else {
-				s.mockTrader.positions = []map[string]interface{}{}
-			}
+			last := s.mockTrader.closeOrders[len(s.mockTrader.closeOrders)-1]
+			s.Equal(tt.side, last.side)
+			s.Equal(tt.wantOrderQty, last.quantity)
+		})
+	}
 
-			decision := &decision.Decision{Action: tt.action, Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10}
-			actionRecord := &logger.DecisionAction{Action: tt.action, Symbol: "BTCUSDT"}
+	// 没有对应方向的持仓时不下单（避免平仓单变成反向开仓）
+	count := len(s.mockTrader.closeOrders)
+	_, _, err := s.autoTrader.closePosition("BTCUSDT", "short", 0.1, "partial_close")
+	s.Error(err)
+	s.Len(s.mockTrader.closeOrders, count)
+}
 
-			err := tt.executeFn(decision, actionRecord)
+// TestSymbolScope 测试币种范围校验：范围外和黑名单币种拒绝开仓，已有持仓始终可以平仓
+func (s *AutoTraderTestSuite) TestSymbolScope() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100.0}, nil
+	})
+	s.autoTrader.tradingCoins = []string{"btc", "ETH", "SOL"}
+	s.autoTrader.config.BlacklistSymbols = []string{"sol"}
+
+	tests := []struct {
+		name        string
+		action      string
+		symbol      string
+		expectedErr string
+	}{
+		{name: "范围内_开多", action: "open_long", symbol: "BTCUSDT"},
+		{name: "范围内_未带USDT后缀", action: "open_short", symbol: "eth"},
+		{name: "范围外_拒绝开仓", action: "open_long", symbol: "PEPEUSDT", expectedErr: "不在允许交易的币种范围内"},
+		{name: "黑名单_拒绝开仓", action: "open_short", symbol: "SOLUSDT", expectedErr: "黑名单"},
+		{name: "范围外_允许平仓", action: "close_long", symbol: "PEPEUSDT"},
+		{name: "黑名单_允许平仓", action: "close_short", symbol: "SOLUSDT"},
+	}
 
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			d := &decision.Decision{Action: tt.action, Symbol: tt.symbol, PositionSizeUSD: 500.0, Leverage: 5}
+			actionRecord := &logger.DecisionAction{Action: tt.action, Symbol: tt.symbol}
+			err := s.autoTrader.executeDecisionWithRecord(d, actionRecord)
 			if tt.expectedErr != "" {
 				s.Error(err)
 				s.Contains(err.Error(), tt.expectedErr)
+				s.Zero(actionRecord.OrderID, "被拒绝的订单不应提交到交易所")
 			} else {
 				s.NoError(err)
-				s.Equal(tt.expectedOrder, actionRecord.OrderID)
-				s.Greater(actionRecord.Quantity, 0.0)
-				s.Equal(50000.0, actionRecord.Price)
+				s.NotZero(actionRecord.OrderID)
 			}
+		})
+	}
 
-			// 恢复默认状态
-			s.mockTrader.balance["availableBalance"] = 8000.0
-			s.mockTrader.positions = []map[string]interface{}{}
+	// 未配置任何币种且尚未获取币种池时不限制范围（黑名单仍生效）
+	s.autoTrader.tradingCoins = nil
+	s.autoTrader.defaultCoins = nil
+	s.NoError(s.autoTrader.checkSymbolScope("PEPEUSDT"))
+	s.Error(s.autoTrader.checkSymbolScope("SOLUSDT"))
+
+	// 使用合并币种池时以最近一次获取的币种为准
+	s.autoTrader.poolSymbols = map[string]bool{"DOGEUSDT": true}
+	s.NoError(s.autoTrader.checkSymbolScope("DOGEUSDT"))
+	s.Error(s.autoTrader.checkSymbolScope("PEPEUSDT"))
+}
+
+// TestRiskPercentSizing 测试按风险百分比定仓：触及止损时的亏损等于净值 × 风险百分比
+func (s *AutoTraderTestSuite) TestRiskPercentSizing() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	equity := 10000.0 + 100.0 // wallet + unrealized
+
+	tests := []struct {
+		name        string
+		action      string
+		stopLoss    float64
+		riskPercent float64
+	}{
+		{name: "多仓_止损1%", action: "open_long", stopLoss: 49500, riskPercent: 1},
+		{name: "多仓_止损5%", action: "open_long", stopLoss: 47500, riskPercent: 2},
+		{name: "多仓_止损0.2%", action: "open_long", stopLoss: 49900, riskPercent: 0.5},
+		{name: "空仓_止损1%", action: "open_short", stopLoss: 50500, riskPercent: 1},
+		{name: "空仓_止损3%", action: "open_short", stopLoss: 51500, riskPercent: 3},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			// position_size_usd 同时存在时以风险定仓为准
+			d := &decision.Decision{Action: tt.action, Symbol: "BTCUSDT", Leverage: 10, PositionSizeUSD: 1000,
+				StopLoss: tt.stopLoss, RiskPercent: tt.riskPercent}
+			actionRecord := &logger.DecisionAction{Action: tt.action, Symbol: "BTCUSDT"}
+			s.NoError(s.autoTrader.executeDecisionWithRecord(d, actionRecord))
+
+			lossAtStop := actionRecord.Quantity * math.Abs(actionRecord.Price-tt.stopLoss)
+			s.InDelta(equity*tt.riskPercent/100, lossAtStop, 0.01)
+			s.NotEqual(1000.0, actionRecord.Quantity*actionRecord.Price)
 		})
 	}
+
+	// 仓位超过可用保证金 × 杠杆时按上限开仓
+	d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", Leverage: 2, StopLoss: 49950, RiskPercent: 5}
+	actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+	s.NoError(s.autoTrader.executeDecisionWithRecord(d, actionRecord))
+	s.InDelta(8000.0*0.99/(0.5+0.0004), actionRecord.Quantity*actionRecord.Price, 0.01)
+
+	// 止损价在盈利一侧时拒绝开仓
+	d = &decision.Decision{Action: "open_short", Symbol: "BTCUSDT", Leverage: 10, StopLoss: 49000, RiskPercent: 1}
+	err := s.autoTrader.executeDecisionWithRecord(d, &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol})
+	s.Error(err)
+	s.Contains(err.Error(), "亏损一侧")
+}
+
+// TestDailyLossHalt 测试日亏损熔断：超限后拒绝开仓、允许平仓，跨UTC日后恢复
+func (s *AutoTraderTestSuite) TestDailyLossHalt() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+	s.autoTrader.config.MaxDailyLoss = 5.0
+	day := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	s.autoTrader.lastResetTime = day
+
+	// 当日起点净值 10000，亏损 4%（400/10000）未触发
+	s.Nil(s.autoTrader.checkDailyLoss(10000.0, day))
+	s.Nil(s.autoTrader.checkDailyLoss(9600.0, day.Add(time.Hour)))
+	s.InDelta(-4.0, s.autoTrader.GetStatus()["daily_pnl_pct"], 1e-9)
+
+	// 亏损 6% 触发熔断，截止到次日 UTC 0 点
+	halt := s.autoTrader.checkDailyLoss(9400.0, day.Add(2*time.Hour))
+	s.Require().NotNil(halt)
+	s.Equal("daily_loss_halt", halt.Action)
+	s.Contains(halt.Detail, "超过上限")
+	s.Empty(halt.Error)
+	s.Equal(day.Truncate(24*time.Hour).Add(24*time.Hour), s.autoTrader.dailyLossHaltedUntil())
+	s.Nil(s.autoTrader.checkDailyLoss(9300.0, day.Add(3*time.Hour)), "熔断期间不重复记录")
+
+	status := s.autoTrader.GetStatus()
+	s.InDelta(-7.0, status["daily_pnl_pct"], 1e-9)
+	s.Equal("2025-03-11T00:00:00Z", status["trading_halted_until"])
+
+	// 熔断期间拒绝开仓（手动设置截止时间到未来，避免依赖当前时间）
+	s.autoTrader.tradingHaltedUntil = time.Now().Add(time.Hour)
+	for _, action := range []string{"open_long", "open_short"} {
+		record := &logger.DecisionAction{Action: action, Symbol: "BTCUSDT"}
+		err := s.autoTrader.executeDecisionWithRecord(&decision.Decision{Action: action, Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 5}, record)
+		s.Error(err)
+		s.Contains(err.Error(), "暂停开新仓")
+		s.Zero(record.OrderID)
+	}
+
+	// 平仓不受影响
+	closeRecord := &logger.DecisionAction{Action: "close_long", Symbol: "BTCUSDT"}
+	s.NoError(s.autoTrader.executeDecisionWithRecord(&decision.Decision{Action: "close_long", Symbol: "BTCUSDT"}, closeRecord))
+
+	// 跨UTC日后重置，以新净值为当日起点
+	s.autoTrader.resetDailyLossIfNewDay(day.Add(20 * time.Hour))
+	s.True(s.autoTrader.dailyLossHaltedUntil().IsZero())
+	s.Zero(s.autoTrader.getDailyPnL())
+	s.Nil(s.autoTrader.checkDailyLoss(9300.0, day.Add(20*time.Hour)))
+	s.Zero(s.autoTrader.getDailyPnL())
+
+	record := &logger.DecisionAction{Action: "open_long", Symbol: "BTCUSDT"}
+	s.NoError(s.autoTrader.executeDecisionWithRecord(&decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 5}, record))
+}
+
+// TestDailyLossHalt_Timezone 测试配置时区后日界按当地0点计算：跨过当地0点（未跨UTC 0点）即重置，熔断截止到当地次日0点
+func (s *AutoTraderTestSuite) TestDailyLossHalt_Timezone() {
+	shanghai, err := resolveTimezone("Asia/Shanghai")
+	s.Require().NoError(err)
+	s.autoTrader.location = shanghai
+	s.autoTrader.config.MaxDailyLoss = 5.0
+
+	day := time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC) // 当地 18:00
+	s.autoTrader.lastResetTime = day
+	s.Nil(s.autoTrader.checkDailyLoss(10000.0, day))
+	halt := s.autoTrader.checkDailyLoss(9400.0, day.Add(time.Hour))
+	s.Require().NotNil(halt)
+	s.True(time.Date(2025, 3, 10, 16, 0, 0, 0, time.UTC).Equal(s.autoTrader.dailyLossHaltedUntil()), "熔断截止到当地次日0点")
+	s.Equal("2025-03-11T00:00:00+08:00", s.autoTrader.GetStatus()["trading_halted_until"])
+
+	// 当地 23:30（UTC 15:30）仍是同一天
+	s.autoTrader.resetDailyLossIfNewDay(time.Date(2025, 3, 10, 15, 30, 0, 0, time.UTC))
+	s.False(s.autoTrader.dailyLossHaltedUntil().IsZero())
+
+	// 当地次日 00:30（UTC 16:30，UTC 日期未变）重置
+	s.autoTrader.resetDailyLossIfNewDay(time.Date(2025, 3, 10, 16, 30, 0, 0, time.UTC))
+	s.True(s.autoTrader.dailyLossHaltedUntil().IsZero())
+	s.Zero(s.autoTrader.getDailyPnL())
+
+	// 定时重置基准同样按当地日界
+	s.True(time.Date(2025, 3, 10, 16, 0, 0, 0, time.UTC).Equal(
+		rebaselinePeriodStart(RebaselineDaily, time.Date(2025, 3, 10, 16, 30, 0, 0, time.UTC), s.autoTrader.dayLocation())))
+
+	// 未配置或无效的时区按UTC处理
+	_, err = resolveTimezone("Mars/Olympus")
+	s.Error(err)
+	loc, err := resolveTimezone("")
+	s.NoError(err)
+	s.Equal(time.UTC, loc)
+}
+
+// TestExecuteOpenPosition_TakeProfitLadder 测试开仓后按档位挂分批止盈单
+func (s *AutoTraderTestSuite) TestExecuteOpenPosition_TakeProfitLadder() {
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+
+	s.Run("多仓_按比例拆分数量并逐档记录", func() {
+		s.mockTrader.takeProfitOrders = nil
+		d := &decision.Decision{
+			Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10,
+			StopLoss: 48000, TakeProfit: 56000,
+			TakeProfitLadder: []decision.TakeProfitLevel{{Price: 52000, Percent: 50}, {Price: 54000, Percent: 30}, {Price: 56000, Percent: 20}},
+		}
+		actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+
+		s.Require().NoError(s.autoTrader.executeOpenLongWithRecord(d, actionRecord))
+
+		orders := s.mockTrader.takeProfitOrders
+		s.Require().Len(orders, 3)
+		s.InDelta(0.01, orders[0].quantity, 1e-9)
+		s.InDelta(0.006, orders[1].quantity, 1e-9)
+		s.InDelta(0.004, orders[2].quantity, 1e-9)
+		s.Equal(PositionSideLong, orders[0].positionSide)
+
+		actions := s.autoTrader.takePendingActions()
+		s.Require().Len(actions, 4)
+		s.Equal("stop_loss", actions[0].Action, "开仓先挂保护性止损")
+		rungs := actions[1:]
+		totalQty := 0.0
+		for i, rung := range rungs {
+			s.Equal("take_profit_ladder", rung.Action)
+			s.True(rung.Success)
+			s.Equal(d.TakeProfitLadder[i].Price, rung.Price)
+			totalQty += rung.Quantity
+		}
+		s.InDelta(actionRecord.Quantity, totalQty, 1e-9)
+		s.Empty(s.autoTrader.takePendingActions())
+	})
+
+	s.Run("空仓_档位在标记价格错误一侧时退回单一止盈", func() {
+		s.mockTrader.takeProfitOrders = nil
+		d := &decision.Decision{
+			Action: "open_short", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10,
+			StopLoss: 53000, TakeProfit: 45000,
+			TakeProfitLadder: []decision.TakeProfitLevel{{Price: 51000, Percent: 50}, {Price: 45000, Percent: 50}},
+		}
+		actionRecord := &logger.DecisionAction{Action: d.Action, Symbol: d.Symbol}
+
+		s.Require().NoError(s.autoTrader.executeOpenShortWithRecord(d, actionRecord))
+
+		s.Require().Len(s.mockTrader.takeProfitOrders, 1)
+		s.Equal(45000.0, s.mockTrader.takeProfitOrders[0].price)
+		s.InDelta(actionRecord.Quantity, s.mockTrader.takeProfitOrders[0].quantity, 1e-9)
+		actions := s.autoTrader.takePendingActions()
+		s.Require().Len(actions, 1, "退回单一止盈时只有止损动作")
+		s.Equal("stop_loss", actions[0].Action)
+	})
 }
 
 // TestExecuteClosePosition 测试平仓操作（多空通用）
@@ -539,7 +2929,7 @@ func (s *AutoTraderTestSuite) TestExecuteClosePosition() {
 	}
 
 	for _, tt := range tests {
-		time.Sleep(time.Millisecond)
+		s.clock.Advance(time.Millisecond)
 		s.Run(tt.name, func() {
 			s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
 				return &market.Data{Symbol: symbol, CurrentPrice: tt.currentPrice}, nil
@@ -681,7 +3071,7 @@ func (s *AutoTraderTestSuite) TestExecuteUpdateStopOrTakeProfit() {
 	}
 
 	for _, tt := range tests {
-		time.Sleep(time.Millisecond)
+		s.clock.Advance(time.Millisecond)
 		s.Run(tt.name, func() {
 			// 设置当前测试用例的价格
 			testPrice = &tt.currentPrice
@@ -756,6 +3146,38 @@ func (s *AutoTraderTestSuite) TestExecutePartialCloseWithRecord() {
 		s.Equal(0.05, actionRecord.Quantity) // 50% of 0.1
 	})
 
+	s.Run("按数量平仓_优先于百分比", func() {
+		s.mockTrader.closeOrders = nil
+		s.autoTrader.callCount++
+		d := &decision.Decision{Action: "partial_close", Symbol: "BTCUSDT", ClosePercentage: 50.0, CloseQuantity: 0.03}
+		actionRecord := &logger.DecisionAction{Action: "partial_close", Symbol: "BTCUSDT"}
+
+		s.Require().NoError(s.autoTrader.executePartialCloseWithRecord(d, actionRecord))
+		s.InDelta(0.03, actionRecord.Quantity, 1e-9)
+		if s.Len(s.mockTrader.closeOrders, 1) {
+			s.InDelta(0.03, s.mockTrader.closeOrders[0].quantity, 1e-9)
+		}
+	})
+
+	s.Run("平仓数量超过持仓_按持仓截断", func() {
+		s.mockTrader.closeOrders = nil
+		s.autoTrader.callCount++
+		d := &decision.Decision{Action: "partial_close", Symbol: "BTCUSDT", CloseQuantity: 0.5}
+		actionRecord := &logger.DecisionAction{Action: "partial_close", Symbol: "BTCUSDT"}
+
+		s.Require().NoError(s.autoTrader.executePartialCloseWithRecord(d, actionRecord))
+		s.InDelta(0.1, actionRecord.Quantity, 1e-9)
+		if s.Len(s.mockTrader.closeOrders, 1) {
+			s.InDelta(0.1, s.mockTrader.closeOrders[0].quantity, 1e-9)
+		}
+	})
+
+	s.Run("无效的平仓数量", func() {
+		d := &decision.Decision{Action: "partial_close", Symbol: "BTCUSDT", ClosePercentage: 50.0, CloseQuantity: -0.01}
+		err := s.autoTrader.executePartialCloseWithRecord(d, &logger.DecisionAction{})
+		s.ErrorContains(err, "平仓数量必须大于0")
+	})
+
 	s.Run("无效的平仓百分比", func() {
 		decision := &decision.Decision{
 			Action:          "partial_close",
@@ -833,6 +3255,149 @@ func (s *AutoTraderTestSuite) TestExecuteDecisionWithRecord() {
 	})
 }
 
+// startFakeCycle 模拟 Run 中正在执行的决策周期：依次执行决策并写入决策日志
+func (s *AutoTraderTestSuite) startFakeCycle(decisions []decision.Decision) <-chan struct{} {
+	s.autoTrader.isRunning.Store(true)
+	s.autoTrader.monitorWg.Add(1)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer s.autoTrader.monitorWg.Done()
+
+		record := &logger.DecisionRecord{Exchange: s.autoTrader.exchange, Success: true}
+		for i := range decisions {
+			actionRecord := logger.DecisionAction{Action: decisions[i].Action, Symbol: decisions[i].Symbol}
+			if err := s.autoTrader.executeDecisionWithRecord(&decisions[i], &actionRecord); err == nil {
+				actionRecord.Success = true
+			}
+			record.Decisions = append(record.Decisions, actionRecord)
+		}
+		s.autoTrader.decisionLogger.LogDecision(record)
+	}()
+	return finished
+}
+
+// assertCompleteLogRecord 日志目录中只能有一条完整的记录，不能残留临时文件
+func (s *AutoTraderTestSuite) assertCompleteLogRecord(logDir string, wantDecisions int) {
+	entries, err := os.ReadDir(logDir)
+	s.Require().NoError(err)
+	s.Require().Len(entries, 1)
+	s.True(strings.HasSuffix(entries[0].Name(), ".json"), "残留了非记录文件: %s", entries[0].Name())
+
+	data, err := os.ReadFile(filepath.Join(logDir, entries[0].Name()))
+	s.Require().NoError(err)
+	var record logger.DecisionRecord
+	s.Require().NoError(json.Unmarshal(data, &record))
+	s.Len(record.Decisions, wantDecisions)
+}
+
+func (s *AutoTraderTestSuite) TestStop_WaitsForInFlightCycle() {
+	decisions := []decision.Decision{
+		{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10},
+		{Action: "open_short", Symbol: "ETHUSDT", PositionSizeUSD: 1000.0, Leverage: 5},
+	}
+
+	// market.Get 阻塞直到 release 关闭，用来把周期卡在执行中途
+	var entered chan struct{}
+	var enteredOnce *sync.Once
+	var release chan struct{}
+	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		enteredOnce.Do(func() { close(entered) })
+		<-release
+		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+	})
+
+	reset := func() string {
+		logDir := s.T().TempDir()
+		s.autoTrader.decisionLogger = logger.NewDecisionLogger(logDir)
+		s.autoTrader.stopMonitorCh = make(chan struct{})
+		s.mockTrader.positions = []map[string]interface{}{}
+		entered = make(chan struct{})
+		enteredOnce = &sync.Once{}
+		release = make(chan struct{})
+		return logDir
+	}
+
+	s.Run("等待当前周期完成并写完日志", func() {
+		logDir := reset()
+		finished := s.startFakeCycle(decisions)
+		<-entered
+
+		stopErr := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			stopErr <- s.autoTrader.Stop(ctx)
+		}()
+
+		select {
+		case <-stopErr:
+			s.Fail("Stop 在周期执行中途就返回了")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		s.NoError(<-stopErr)
+		<-finished
+		s.False(s.autoTrader.isRunning.Load())
+		s.assertCompleteLogRecord(logDir, len(decisions))
+	})
+
+	s.Run("超时返回错误，周期结束后记录仍完整", func() {
+		logDir := reset()
+		finished := s.startFakeCycle(decisions)
+		<-entered
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		s.ErrorIs(s.autoTrader.Stop(ctx), context.DeadlineExceeded)
+
+		close(release)
+		<-finished
+		s.assertCompleteLogRecord(logDir, len(decisions))
+	})
+}
+
+func (s *AutoTraderTestSuite) TestTakeOverFrom() {
+	old := s.autoTrader
+	old.callCount = 42
+	old.orderIDSeed = 7
+	old.peakPnLCache = map[string]float64{"BTCUSDT": 12.5}
+	old.positionStopLoss = map[string]float64{"BTCUSDT_long": 48000}
+	old.lastStopLossTime = map[string]time.Time{"ETHUSDT": time.Now()}
+	old.dailyPnL = -150
+	old.tokenUsage = mcp.Usage{TotalTokens: 1000}
+
+	reloaded := &AutoTrader{peakPnLCache: map[string]float64{}}
+
+	// 旧实例正在进行持仓操作时等待其完成
+	old.positionMutex.Lock()
+	done := make(chan struct{})
+	go func() {
+		reloaded.TakeOverFrom(old)
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.Fail("持仓操作进行中时不应接管")
+	case <-time.After(50 * time.Millisecond):
+	}
+	old.positionMutex.Unlock()
+	<-done
+
+	s.Equal(42, reloaded.callCount)
+	s.Equal(int64(7), reloaded.orderIDSeed)
+	s.Equal(12.5, reloaded.peakPnLCache["BTCUSDT"])
+	s.Equal(48000.0, reloaded.positionStopLoss["BTCUSDT_long"])
+	s.Contains(reloaded.lastStopLossTime, "ETHUSDT")
+	s.Equal(-150.0, reloaded.dailyPnL)
+	s.Equal(1000, reloaded.tokenUsage.TotalTokens)
+
+	// 复制而非共享：新实例的修改不影响旧实例
+	reloaded.peakPnLCache["BTCUSDT"] = 20
+	s.Equal(12.5, old.peakPnLCache["BTCUSDT"])
+}
+
 func (s *AutoTraderTestSuite) TestCheckPositionDrawdown() {
 	tests := []struct {
 		name             string
@@ -958,6 +3523,37 @@ func (s *AutoTraderTestSuite) TestCheckPositionDrawdown() {
 	}
 }
 
+// TestFlattenAll 测试一键平仓：单个持仓失败不影响其余持仓
+func (s *AutoTraderTestSuite) TestFlattenAll() {
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.1, "entryPrice": 50000.0, "markPrice": 50500.0, "leverage": 10.0},
+		{"symbol": "ETHUSDT", "side": "short", "positionAmt": -0.5, "entryPrice": 3000.0, "markPrice": 2950.0, "leverage": 10.0},
+	}
+	s.mockTrader.shouldFailCloseShort = true
+	defer func() {
+		s.mockTrader.shouldFailCloseShort = false
+		s.mockTrader.positions = []map[string]interface{}{}
+	}()
+
+	result, err := s.autoTrader.FlattenAll()
+	s.Require().NoError(err)
+
+	s.Require().Len(result.Closed, 1)
+	s.Equal("BTCUSDT", result.Closed[0].Symbol)
+	s.Equal("long", result.Closed[0].Side)
+	s.Equal(0.1, result.Closed[0].Quantity)
+	s.Contains(result.Errors, "ETHUSDT_short")
+
+	records, err := s.mockLogger.GetLatestRecords(1)
+	s.Require().NoError(err)
+	s.Require().Len(records, 1)
+	s.Require().Len(records[0].Decisions, 2)
+	for _, action := range records[0].Decisions {
+		s.Equal("manual_flatten", action.Action)
+		s.Equal(action.Symbol == "BTCUSDT", action.Success)
+	}
+}
+
 // ============================================================
 // Mock 实现
 // ============================================================
@@ -983,6 +3579,50 @@ type MockTrader struct {
 	shouldFailOpenLong   bool
 	shouldFailCloseLong  bool
 	shouldFailCloseShort bool
+	symbolFilters        map[string]SymbolFilters
+	takeProfitOrders     []mockTakeProfitOrder
+	stopLossOrders       []mockStopLossOrder
+	stopOrderCancels     []string // CancelStopOrders 撤单的币种
+	closeOrders          []mockCloseOrder
+	marginModeCalls      []mockMarginModeCall
+	marginModeErr        error
+	leverageCalls        []mockLeverageCall
+	leverageErr          error
+}
+
+// mockLeverageCall 记录 SetLeverage 调用
+type mockLeverageCall struct {
+	symbol   string
+	leverage int
+}
+
+// mockMarginModeCall 记录 SetMarginMode 调用
+type mockMarginModeCall struct {
+	symbol        string
+	isCrossMargin bool
+}
+
+// mockCloseOrder 记录 CloseLong/CloseShort 调用
+type mockCloseOrder struct {
+	symbol   string
+	side     string
+	quantity float64
+}
+
+// mockStopLossOrder 记录 SetStopLoss 调用
+type mockStopLossOrder struct {
+	symbol       string
+	positionSide string
+	quantity     float64
+	price        float64
+}
+
+// mockTakeProfitOrder 记录 SetTakeProfit 调用
+type mockTakeProfitOrder struct {
+	symbol       string
+	positionSide string
+	quantity     float64
+	price        float64
 }
 
 func (m *MockTrader) GetBalance() (map[string]interface{}, error) {
@@ -1009,7 +3649,7 @@ func (m *MockTrader) GetPositions() ([]map[string]interface{}, error) {
 	return m.positions, nil
 }
 
-func (m *MockTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (m *MockTrader) OpenLong(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
 	if m.shouldFailOpenLong {
 		return nil, errors.New("failed to open long")
 	}
@@ -1019,27 +3659,29 @@ func (m *MockTrader) OpenLong(symbol string, quantity float64, leverage int) (ma
 	}, nil
 }
 
-func (m *MockTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (m *MockTrader) OpenShort(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
 	return map[string]interface{}{
 		"orderId": int64(123457),
 		"symbol":  symbol,
 	}, nil
 }
 
-func (m *MockTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+func (m *MockTrader) CloseLong(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
 	if m.shouldFailCloseLong {
 		return nil, errors.New("failed to close long")
 	}
+	m.closeOrders = append(m.closeOrders, mockCloseOrder{symbol: symbol, side: "long", quantity: quantity})
 	return map[string]interface{}{
 		"orderId": int64(123458),
 		"symbol":  symbol,
 	}, nil
 }
 
-func (m *MockTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+func (m *MockTrader) CloseShort(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
 	if m.shouldFailCloseShort {
 		return nil, errors.New("failed to close short")
 	}
+	m.closeOrders = append(m.closeOrders, mockCloseOrder{symbol: symbol, side: "short", quantity: quantity})
 	return map[string]interface{}{
 		"orderId": int64(123459),
 		"symbol":  symbol,
@@ -1047,11 +3689,13 @@ func (m *MockTrader) CloseShort(symbol string, quantity float64) (map[string]int
 }
 
 func (m *MockTrader) SetLeverage(symbol string, leverage int) error {
-	return nil
+	m.leverageCalls = append(m.leverageCalls, mockLeverageCall{symbol: symbol, leverage: leverage})
+	return m.leverageErr
 }
 
 func (m *MockTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
-	return nil
+	m.marginModeCalls = append(m.marginModeCalls, mockMarginModeCall{symbol: symbol, isCrossMargin: isCrossMargin})
+	return m.marginModeErr
 }
 
 func (m *MockTrader) GetMarketPrice(symbol string) (float64, error) {
@@ -1059,10 +3703,12 @@ func (m *MockTrader) GetMarketPrice(symbol string) (float64, error) {
 }
 
 func (m *MockTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+	m.stopLossOrders = append(m.stopLossOrders, mockStopLossOrder{symbol, positionSide, quantity, stopPrice})
 	return nil
 }
 
 func (m *MockTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	m.takeProfitOrders = append(m.takeProfitOrders, mockTakeProfitOrder{symbol, positionSide, quantity, takeProfitPrice})
 	return nil
 }
 
@@ -1079,6 +3725,7 @@ func (m *MockTrader) CancelAllOrders(symbol string) error {
 }
 
 func (m *MockTrader) CancelStopOrders(symbol string) error {
+	m.stopOrderCancels = append(m.stopOrderCancels, symbol)
 	return nil
 }
 
@@ -1086,6 +3733,14 @@ func (m *MockTrader) FormatQuantity(symbol string, quantity float64) (string, er
 	return fmt.Sprintf("%.4f", quantity), nil
 }
 
+func (m *MockTrader) FormatPrice(symbol string, price float64) (string, error) {
+	return strconv.FormatFloat(price, 'f', -1, 64), nil
+}
+
+func (m *MockTrader) GetSymbolFilters(symbol string) (SymbolFilters, error) {
+	return m.symbolFilters[symbol], nil
+}
+
 // ============================================================
 // 测试套件入口
 // ============================================================
@@ -1175,6 +3830,34 @@ func TestCalculatePnLPercentage(t *testing.T) {
 	}
 }
 
+// TestAsFloat 测试持仓字段宽松解析
+func TestAsFloat(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  interface{}
+		want   float64
+		wantOK bool
+	}{
+		{"float64", 1.5, 1.5, true},
+		{"json.Number", json.Number("-0.25"), -0.25, true},
+		{"字符串", "50000.12", 50000.12, true},
+		{"带空白的字符串", " 3 ", 3, true},
+		{"非法字符串", "abc", 0, false},
+		{"空字符串", "", 0, false},
+		{"nil", nil, 0, false},
+		{"不支持的类型", true, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := asFloat(tt.input)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("asFloat(%#v) = (%v, %v), want (%v, %v)", tt.input, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
 // TestCalculatePnLPercentage_RealWorldScenarios 真实场景测试
 func TestCalculatePnLPercentage_RealWorldScenarios(t *testing.T) {
 	t.Run("BTC 10倍杠杆，价格上涨2%", func(t *testing.T) {
@@ -1386,3 +4069,401 @@ func (s *AutoTraderTestSuite) TestGetPositions_MarginCalculationRegression() {
 		}
 	})
 }
+
+// TestJitteredInterval 测试扫描间隔抖动：结果落在 ±N% 范围内，平均值接近名义间隔
+func TestJitteredInterval(t *testing.T) {
+	interval := 3 * time.Minute
+
+	if got := jitteredInterval(interval, 0); got != interval {
+		t.Errorf("抖动为0时应返回原间隔，实际 %v", got)
+	}
+
+	var total time.Duration
+	const n = 2000
+	for i := 0; i < n; i++ {
+		d := jitteredInterval(interval, 10)
+		if d < interval*9/10 || d > interval*11/10 {
+			t.Fatalf("间隔 %v 超出 ±10%% 范围", d)
+		}
+		total += d
+	}
+	if avg := total / n; math.Abs(float64(avg-interval)) > float64(interval)*0.01 {
+		t.Errorf("平均间隔 %v 应接近名义间隔 %v", avg, interval)
+	}
+}
+
+// TestSubmitOrder_EmitsTradeEvents 测试开仓/平仓订单提交成功后发布事件，同一周期重复提交不重复发布
+func (s *AutoTraderTestSuite) TestSubmitOrder_EmitsTradeEvents() {
+	var events []Event
+	s.autoTrader.config.OnEvent = func(e Event) { events = append(events, e) }
+	defer func() { s.autoTrader.config.OnEvent = nil }()
+	s.autoTrader.callCount++
+
+	_, err := s.autoTrader.submitOrder("BTCUSDT", "open_long", "open_long", 0.1, 10)
+	if !s.NoError(err) {
+		return
+	}
+	_, err = s.autoTrader.submitOrder("BTCUSDT", "open_long", "open_long", 0.1, 10)
+	s.NoError(err)
+	_, err = s.autoTrader.submitOrder("ETHUSDT", "close_short", "close_short", 2, 0)
+	s.NoError(err)
+
+	if !s.Len(events, 2) {
+		return
+	}
+	s.Equal(EventTradeOpened, events[0].Type)
+	s.Equal(s.autoTrader.id, events[0].TraderID)
+	s.Equal("BTCUSDT", events[0].Payload["symbol"])
+	s.Equal("long", events[0].Payload["side"])
+	s.Equal(10, events[0].Payload["leverage"])
+	s.Equal(EventTradeClosed, events[1].Type)
+	s.Equal("short", events[1].Payload["side"])
+}
+
+// TestCheckMaxHoldTime 测试持仓时间越过上限后被强制平仓，手动平仓后重新出现的持仓重新计时
+func (s *AutoTraderTestSuite) TestCheckMaxHoldTime() {
+	s.autoTrader.config.MaxHoldTime = 30 * time.Minute
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.5, "entryPrice": 50000.0, "markPrice": 49000.0, "leverage": 10.0},
+	}
+	s.mockTrader.closeOrders = nil
+	defer func() { s.mockTrader.positions = []map[string]interface{}{} }()
+
+	positions, err := s.autoTrader.GetPositions()
+	if !s.NoError(err) || !s.Len(positions, 1) {
+		return
+	}
+	s.Equal(int64(0), positions[0]["age_seconds"])
+
+	// 未到上限：不平仓，age_seconds 随时间增长
+	s.clock.Advance(29 * time.Minute)
+	s.autoTrader.checkMaxHoldTime()
+	s.Empty(s.mockTrader.closeOrders)
+	positions, _ = s.autoTrader.GetPositions()
+	s.Equal(int64(29*60), positions[0]["age_seconds"])
+
+	// 手动平仓后重新开仓：首次出现时间重置，不会沿用旧持仓的时长
+	s.mockTrader.positions = []map[string]interface{}{}
+	s.clock.Advance(time.Minute)
+	s.autoTrader.checkMaxHoldTime()
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.2, "entryPrice": 51000.0, "markPrice": 51000.0, "leverage": 10.0},
+	}
+	s.clock.Advance(time.Minute)
+	s.autoTrader.checkMaxHoldTime()
+	s.Empty(s.mockTrader.closeOrders)
+
+	// 越过上限：不论盈亏强制平仓
+	s.clock.Advance(31 * time.Minute)
+	s.autoTrader.checkMaxHoldTime()
+	if s.Len(s.mockTrader.closeOrders, 1) {
+		s.Equal("BTCUSDT", s.mockTrader.closeOrders[0].symbol)
+		s.Equal("long", s.mockTrader.closeOrders[0].side)
+	}
+
+	// 未配置上限时不检查
+	s.autoTrader.config.MaxHoldTime = 0
+	s.mockTrader.closeOrders = nil
+	s.clock.Advance(24 * time.Hour)
+	s.autoTrader.checkMaxHoldTime()
+	s.Empty(s.mockTrader.closeOrders)
+}
+
+// fakeManualHoldStore 记录被删除的手动持仓标记
+type fakeManualHoldStore struct {
+	deleted []string
+}
+
+func (f *fakeManualHoldStore) DeleteManualHold(traderID, symbol string) error {
+	f.deleted = append(f.deleted, traderID+"/"+symbol)
+	return nil
+}
+
+// TestManualHold 测试手动持仓标记：回撤监控和最长持仓跳过、拒绝自动开仓，持仓平仓后对账清除标记
+func (s *AutoTraderTestSuite) TestManualHold() {
+	store := &fakeManualHoldStore{}
+	s.autoTrader.database = store
+	s.autoTrader.config.MaxHoldTime = 30 * time.Minute
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.1, "entryPrice": 50000.0, "markPrice": 50300.0, "leverage": 10.0},
+	}
+	s.mockTrader.closeOrders = nil
+	defer func() {
+		s.autoTrader.database = nil
+		s.autoTrader.config.MaxHoldTime = 0
+		s.mockTrader.positions = []map[string]interface{}{}
+	}()
+
+	s.autoTrader.SetManualHold("btc", "手动加仓")
+	s.Equal(map[string]string{"BTCUSDT": "手动加仓"}, s.autoTrader.ManualHolds())
+
+	// 回撤满足平仓条件，但手动持仓不平仓，峰值缓存保留
+	s.autoTrader.UpdatePeakPnL("BTCUSDT", "long", 10.0)
+	s.autoTrader.checkPositionDrawdown()
+	s.Empty(s.mockTrader.closeOrders)
+	_, exists := s.autoTrader.GetPeakPnLCache()["BTCUSDT_long"]
+	s.True(exists)
+
+	// 超过最长持仓时间也不平仓
+	s.autoTrader.checkMaxHoldTime()
+	s.clock.Advance(time.Hour)
+	s.autoTrader.checkMaxHoldTime()
+	s.Empty(s.mockTrader.closeOrders)
+
+	// 自动开仓/加仓被拒绝
+	err := s.autoTrader.executeDecisionWithRecord(&decision.Decision{Action: "add_position", Symbol: "BTCUSDT"}, &logger.DecisionAction{})
+	s.ErrorContains(err, "手动持仓")
+
+	// 仍有持仓时对账保留标记；平仓后清除并删除数据库记录
+	s.autoTrader.reconcilePositions(&logger.DecisionRecord{})
+	s.True(s.autoTrader.isManualHold("BTCUSDT"))
+	s.mockTrader.positions = []map[string]interface{}{}
+	s.autoTrader.reconcilePositions(&logger.DecisionRecord{})
+	s.False(s.autoTrader.isManualHold("BTCUSDT"))
+	s.Equal([]string{s.autoTrader.id + "/BTCUSDT"}, store.deleted)
+
+	// 取消标记后恢复回撤平仓
+	s.autoTrader.SetManualHold("ETHUSDT", "")
+	s.True(s.autoTrader.ClearManualHold("ETHUSDT"))
+	s.False(s.autoTrader.ClearManualHold("ETHUSDT"))
+	s.mockTrader.positions = []map[string]interface{}{
+		{"symbol": "ETHUSDT", "side": "short", "positionAmt": -0.5, "entryPrice": 3000.0, "markPrice": 2982.0, "leverage": 10.0},
+	}
+	s.autoTrader.UpdatePeakPnL("ETHUSDT", "short", 10.0)
+	s.autoTrader.checkPositionDrawdown()
+	s.Len(s.mockTrader.closeOrders, 1)
+}
+
+// TestCheckOpenAllowed_HighVolRegime 测试极端波动时拒绝开新仓，配置允许或非极端波动时放行，并在状态中展示
+func (s *AutoTraderTestSuite) TestCheckOpenAllowed_HighVolRegime() {
+	defer func() {
+		s.autoTrader.marketRegime = market.MarketRegime{}
+		s.autoTrader.config.AllowHighVolOpens = false
+	}()
+
+	s.autoTrader.marketRegime = market.MarketRegime{Regime: market.RegimeHighVol, ADX: 30, ATRPct: 4.5}
+	s.ErrorContains(s.autoTrader.checkOpenAllowed("BTCUSDT"), "极端波动")
+	s.Equal(market.RegimeHighVol, s.autoTrader.GetStatus()["market_regime"].(market.MarketRegime).Regime)
+
+	// 执行开仓决策同样被拒绝
+	err := s.autoTrader.executeDecisionWithRecord(&decision.Decision{Action: "open_long", Symbol: "BTCUSDT"}, &logger.DecisionAction{})
+	s.ErrorContains(err, "极端波动")
+
+	s.autoTrader.config.AllowHighVolOpens = true
+	s.NoError(s.autoTrader.checkOpenAllowed("BTCUSDT"))
+
+	s.autoTrader.config.AllowHighVolOpens = false
+	s.autoTrader.marketRegime = market.MarketRegime{Regime: market.RegimeTrend, ADX: 30, ATRPct: 1.2}
+	s.NoError(s.autoTrader.checkOpenAllowed("BTCUSDT"))
+}
+
+// TestReBaseline 测试以当前净值重置初始余额基准：写库失败不修改基准，成功后总盈亏归零，定时重置按周期触发一次
+func (s *AutoTraderTestSuite) TestReBaseline() {
+	defer func() {
+		s.mockDB.shouldFail = false
+		s.autoTrader.config.RebaselineSchedule = ""
+	}()
+
+	s.mockDB.shouldFail = true
+	_, err := s.autoTrader.ReBaseline()
+	s.ErrorContains(err, "保存初始余额失败")
+	s.Equal(10000.0, s.autoTrader.getInitialBalance())
+
+	s.mockDB.shouldFail = false
+	s.clock.Advance(time.Minute)
+	baseline, err := s.autoTrader.ReBaseline()
+	s.Require().NoError(err)
+	s.Equal(10100.0, baseline) // 钱包10000 + 未实现100
+	s.Equal(s.clock.Now(), s.autoTrader.lastResetTime)
+
+	info, err := s.autoTrader.GetAccountInfo()
+	s.Require().NoError(err)
+	s.InDelta(0, info["total_pnl_pct"].(float64), 0.0001)
+	s.Equal(10100.0, info["initial_balance"])
+
+	// 未配置定时重置时不触发
+	_, due, err := s.autoTrader.rebaselineIfDue(s.clock.Now().Add(48 * time.Hour))
+	s.NoError(err)
+	s.False(due)
+
+	// 每日重置：同一UTC日内不重复，跨日后触发一次
+	s.autoTrader.config.RebaselineSchedule = RebaselineDaily
+	_, due, _ = s.autoTrader.rebaselineIfDue(s.clock.Now())
+	s.False(due)
+	s.mockTrader.balance["totalWalletBalance"] = 10500.0
+	defer func() { s.mockTrader.balance["totalWalletBalance"] = 10000.0 }()
+	s.clock.Advance(24 * time.Hour)
+	baseline, due, err = s.autoTrader.rebaselineIfDue(s.clock.Now())
+	s.NoError(err)
+	s.True(due)
+	s.Equal(10600.0, baseline)
+	_, due, _ = s.autoTrader.rebaselineIfDue(s.clock.Now())
+	s.False(due)
+}
+
+// TestEnsureMarginMode 测试按币种解析仓位模式、相同模式不重复设置、有持仓无法更改时跳过且下次重试
+func (s *AutoTraderTestSuite) TestEnsureMarginMode() {
+	s.autoTrader.config.IsCrossMargin = true
+	s.autoTrader.config.MarginModes = map[string]string{"PEPEUSDT": MarginModeIsolated}
+	s.mockTrader.marginModeCalls = nil
+
+	s.autoTrader.ensureMarginMode("BTCUSDT")
+	s.autoTrader.ensureMarginMode("PEPEUSDT")
+	s.autoTrader.ensureMarginMode("BTCUSDT")
+	s.autoTrader.ensureMarginMode("PEPEUSDT")
+	s.Equal([]mockMarginModeCall{
+		{symbol: "BTCUSDT", isCrossMargin: true},
+		{symbol: "PEPEUSDT", isCrossMargin: false},
+	}, s.mockTrader.marginModeCalls)
+
+	// 配置变更后重新设置
+	s.autoTrader.config.MarginModes = map[string]string{"PEPEUSDT": MarginModeCross}
+	s.autoTrader.ensureMarginMode("PEPEUSDT")
+	s.Len(s.mockTrader.marginModeCalls, 3)
+
+	// 有持仓无法更改：不缓存，下次开仓时重试
+	s.mockTrader.marginModeErr = fmt.Errorf("%w: code=-4048", ErrMarginModeLocked)
+	defer func() { s.mockTrader.marginModeErr = nil }()
+	s.autoTrader.ensureMarginMode("SOLUSDT")
+	s.autoTrader.ensureMarginMode("SOLUSDT")
+	s.Len(s.mockTrader.marginModeCalls, 5)
+	_, cached := s.autoTrader.marginModeSet["SOLUSDT"]
+	s.False(cached)
+}
+
+// TestResyncLeverageAndMargin 测试持仓杠杆/仓位模式偏离配置时尝试纠正，交易所拒绝时告警且同一偏离不重复告警
+func (s *AutoTraderTestSuite) TestResyncLeverageAndMargin() {
+	s.autoTrader.config.IsCrossMargin = true
+	s.autoTrader.config.MarginModes = nil
+	s.mockTrader.leverageCalls = nil
+	s.mockTrader.marginModeCalls = nil
+	s.autoTrader.positionLeverage = map[string]int{"ETHUSDT_short": 3}
+	s.mockTrader.positions = []map[string]interface{}{
+		// 来源未知的持仓，杠杆超过上限（BTC/ETH 10x）→ 纠正到上限
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.1, "leverage": 20.0, "marginMode": MarginModeCross},
+		// 本交易员以3x开仓，被手动改为5x（未超上限也纠正回开仓杠杆）
+		{"symbol": "ETHUSDT", "side": "short", "positionAmt": 1.0, "leverage": 5.0, "marginMode": MarginModeCross},
+		// 来源未知、低于上限的持仓不调整；仓位模式偏离时纠正并重新设置杠杆
+		{"symbol": "SOLUSDT", "side": "long", "positionAmt": 10.0, "leverage": 3.0, "marginMode": MarginModeIsolated},
+	}
+	defer func() {
+		s.mockTrader.positions = []map[string]interface{}{}
+		s.mockTrader.leverageErr = nil
+		s.autoTrader.positionLeverage = nil
+	}()
+
+	record := &logger.DecisionRecord{}
+	s.autoTrader.resyncLeverageAndMargin(record)
+	s.Equal([]mockLeverageCall{
+		{symbol: "BTCUSDT", leverage: 10},
+		{symbol: "ETHUSDT", leverage: 3},
+		{symbol: "SOLUSDT", leverage: 3},
+	}, s.mockTrader.leverageCalls)
+	s.Equal([]mockMarginModeCall{{symbol: "SOLUSDT", isCrossMargin: true}}, s.mockTrader.marginModeCalls)
+	s.True(s.autoTrader.marginModeSet["SOLUSDT"])
+	s.Len(record.ExecutionLog, 3)
+	s.Contains(record.ExecutionLog[0], "杠杆 20x（应为 10x）")
+
+	// 持仓中交易所拒绝更改：告警一次，偏离不变时不重复告警
+	s.mockTrader.positions = s.mockTrader.positions[:1]
+	s.mockTrader.leverageErr = errors.New("leverage cannot be changed")
+	s.mockTrader.leverageCalls = nil
+	record = &logger.DecisionRecord{}
+	s.autoTrader.resyncLeverageAndMargin(record)
+	s.Len(s.mockTrader.leverageCalls, 1)
+	s.Require().Len(record.ExecutionLog, 1)
+	s.Contains(record.ExecutionLog[0], "无法纠正")
+
+	record = &logger.DecisionRecord{}
+	s.autoTrader.resyncLeverageAndMargin(record)
+	s.Len(s.mockTrader.leverageCalls, 2, "每个周期仍尝试纠正")
+	s.Empty(record.ExecutionLog, "同一偏离不重复告警")
+
+	// 持仓消失后清除告警状态
+	s.mockTrader.positions = []map[string]interface{}{}
+	s.autoTrader.resyncLeverageAndMargin(&logger.DecisionRecord{})
+	s.Empty(s.autoTrader.driftWarnings)
+}
+
+// TestClosePosition_ConsecutiveLosses 测试平仓按未实现盈亏记录结果：亏损累加连续亏损次数，盈利清零
+func (s *AutoTraderTestSuite) TestClosePosition_ConsecutiveLosses() {
+	defer func() { s.mockTrader.positions = []map[string]interface{}{} }()
+
+	for i, pnl := range []float64{-20, -5, 30, -8} {
+		s.autoTrader.callCount++
+		s.mockTrader.positions = []map[string]interface{}{
+			{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.5, "unRealizedProfit": pnl},
+		}
+		_, _, err := s.autoTrader.closePosition("BTCUSDT", "long", 0, "close_long")
+		if !s.NoError(err, "第%d笔平仓", i+1) {
+			return
+		}
+	}
+	s.Equal(1, s.autoTrader.ConsecutiveLosses())
+	s.Equal(1, s.autoTrader.GetStatus()["consecutive_losses"])
+}
+
+// TestObserveRepeatedDecisions 测试同一币种连续 K 个周期决策相同（理由不同）时进入退避，退避结束后重新计数
+func (s *AutoTraderTestSuite) TestObserveRepeatedDecisions() {
+	s.autoTrader.config.RepeatDecisionLimit = 3
+	s.autoTrader.config.RepeatDecisionBackoff = 10 * time.Minute
+
+	hold := func(reasoning string) decision.Decision {
+		return decision.Decision{Symbol: "BTCUSDT", Action: "hold", Reasoning: reasoning}
+	}
+	open := func(size float64) decision.Decision {
+		return decision.Decision{Symbol: "ETHUSDT", Action: "open_long", PositionSizeUSD: size, Leverage: 5}
+	}
+
+	// 前两个周期：未达到 K
+	s.autoTrader.observeRepeatedDecisions([]decision.Decision{hold("a"), open(100)})
+	s.autoTrader.observeRepeatedDecisions([]decision.Decision{hold("b"), open(100)})
+	s.False(s.autoTrader.inRepeatBackoff("BTCUSDT"))
+	s.Equal(0, s.autoTrader.GetStatus()["repeat_backoff_symbols"])
+
+	// 第三个周期：BTC 连续3次 hold（理由不同也算相同），ETH 参数变化不算
+	s.autoTrader.observeRepeatedDecisions([]decision.Decision{hold("c"), open(120)})
+	s.True(s.autoTrader.inRepeatBackoff("BTCUSDT"))
+	s.False(s.autoTrader.inRepeatBackoff("ETHUSDT"))
+	s.Equal(1, s.autoTrader.GetStatus()["repeat_backoff_symbols"])
+
+	// 退避期内的决策不计数
+	s.autoTrader.observeRepeatedDecisions([]decision.Decision{hold("d"), open(120)})
+	s.autoTrader.observeRepeatedDecisions([]decision.Decision{hold("e"), open(120)})
+	s.True(s.autoTrader.inRepeatBackoff("ETHUSDT"), "ETH 连续3次相同开仓决策")
+
+	// 退避结束后重新计数
+	s.clock.Advance(11 * time.Minute)
+	s.False(s.autoTrader.inRepeatBackoff("BTCUSDT"))
+	s.Equal(0, s.autoTrader.GetStatus()["repeat_backoff_symbols"])
+	s.autoTrader.observeRepeatedDecisions([]decision.Decision{hold("f")})
+	s.False(s.autoTrader.inRepeatBackoff("BTCUSDT"), "退避结束后需重新累计 K 次")
+
+	// 未配置 K 时不检测
+	s.autoTrader.config.RepeatDecisionLimit = 0
+	for i := 0; i < 5; i++ {
+		s.autoTrader.observeRepeatedDecisions([]decision.Decision{{Symbol: "SOLUSDT", Action: "hold"}})
+	}
+	s.False(s.autoTrader.inRepeatBackoff("SOLUSDT"))
+}
+
+// TestRebaselinePeriodStart 测试初始余额重置周期的起点（UTC日界 / 周一0点）
+func TestRebaselinePeriodStart(t *testing.T) {
+	wed := time.Date(2025, 1, 15, 13, 30, 0, 0, time.UTC) // 周三
+	tests := []struct {
+		schedule string
+		t        time.Time
+		want     time.Time
+	}{
+		{schedule: "", t: wed, want: time.Time{}},
+		{schedule: RebaselineDaily, t: wed, want: time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{schedule: RebaselineWeekly, t: wed, want: time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{schedule: RebaselineWeekly, t: time.Date(2025, 1, 13, 0, 0, 1, 0, time.UTC), want: time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{schedule: RebaselineWeekly, t: time.Date(2025, 1, 19, 23, 59, 0, 0, time.UTC), want: time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)}, // 周日
+	}
+	for _, tt := range tests {
+		if got := rebaselinePeriodStart(tt.schedule, tt.t, time.UTC); !got.Equal(tt.want) {
+			t.Errorf("rebaselinePeriodStart(%q, %s) = %s, want %s", tt.schedule, tt.t, got, tt.want)
+		}
+	}
+}
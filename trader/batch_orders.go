@@ -0,0 +1,176 @@
+package trader
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"nofx/decision"
+	"nofx/logger"
+	"nofx/metrics"
+)
+
+// maxBatchOrders 单次批量下单的最大订单数（币安 batchOrders 上限为5笔）
+const maxBatchOrders = 5
+
+// batchOpen 本周期待批量执行的一条开仓决策及其执行记录
+type batchOpen struct {
+	decision *decision.Decision
+	record   *logger.DecisionAction
+}
+
+// executeOpenBatch 执行同一周期的多条开仓决策，返回与 items 按下标对应的执行错误
+// 交易所支持批量下单（BatchOrderTrader）时：先逐条校验并确定下单数量（已通过校验的仓位预占持仓数和保证金），
+// 再合并为批量请求，每笔订单的结果记回对应的决策；否则逐条按普通流程执行
+func (at *AutoTrader) executeOpenBatch(items []batchOpen) []error {
+	errs := make([]error, len(items))
+	batcher, ok := at.trader.(BatchOrderTrader)
+	if !ok || len(items) < 2 {
+		for k, item := range items {
+			errs[k] = at.executeDecisionWithRecord(item.decision, item.record)
+		}
+		return errs
+	}
+
+	// 1. 逐条校验并确定下单参数
+	plans := make([]*openPlan, len(items))
+	at.batchReserved = openReservation{}
+	for k, item := range items {
+		d := item.decision
+		side := "long"
+		if d.Action == "open_short" {
+			side = "short"
+		}
+		log.Printf("  📦 批量开仓(%s): %s", side, d.Symbol)
+		if err := at.checkOpenAllowed(d.Symbol); err != nil {
+			errs[k] = err
+			continue
+		}
+		plan, err := at.prepareOpen(d, item.record, side)
+		if err != nil {
+			errs[k] = err
+			continue
+		}
+		plans[k] = plan
+		at.batchReserved.positions++
+		at.batchReserved.margin += plan.margin
+	}
+	at.batchReserved = openReservation{}
+
+	// 2. 本周期已提交过的决策沿用原订单，其余合并为批量请求
+	var requests []OrderRequest
+	var indexes []int
+	for k, plan := range plans {
+		if plan == nil {
+			continue
+		}
+		d := items[k].decision
+		id := clientOrderID(at.id, at.orderIDSeed, at.callCount, d.Symbol, d.Action)
+		if order, ok := at.lookupSubmittedOrder(id); ok {
+			log.Printf("  ↻ %s %s 本周期已提交过订单 %s，跳过重复下单", d.Symbol, d.Action, id)
+			at.finishOpen(d, items[k].record, plan, order)
+			continue
+		}
+		requests = append(requests, OrderRequest{
+			Symbol:        d.Symbol,
+			PositionSide:  plan.positionSide,
+			Quantity:      plan.quantity,
+			Leverage:      d.Leverage,
+			ClientOrderID: id,
+		})
+		indexes = append(indexes, k)
+	}
+
+	// 3. 按交易所上限分批提交
+	for start := 0; start < len(requests); start += maxBatchOrders {
+		end := min(start+maxBatchOrders, len(requests))
+		results, err := at.placeBatchWithTimeout(batcher, requests[start:end])
+		if err == nil && len(results) != end-start {
+			err = fmt.Errorf("批量下单返回 %d 个结果，提交了 %d 笔", len(results), end-start)
+		}
+		if err != nil {
+			metrics.ExchangeErrors.WithLabelValues(at.id, at.exchange).Inc()
+			if errors.Is(err, ErrRateLimited) {
+				// 已限频：剩余订单不再提交
+				for _, k := range indexes[start:] {
+					errs[k] = err
+				}
+				return errs
+			}
+			_, idTrader := at.trader.(ClientOrderIDTrader)
+			lookup, canLookup := at.trader.(OrderLookupTrader)
+			if (errors.Is(err, ErrOrderTimeout) || idTrader) && !canLookup {
+				// 请求结果未知，订单可能已在交易所成交，无法查询确认时逐笔重试会重复开仓
+				for _, k := range indexes[start:end] {
+					errs[k] = err
+				}
+				continue
+			}
+			// 请求整体失败（网络错误、超时等）时逐笔提交。市价单成交后不再是挂单，交易所不会按客户端订单ID拒绝重复提交，
+			// 所以重试前先按ID查询：批量请求已成交（只是响应丢失）的订单直接按已提交处理
+			log.Printf("  ⚠️ 批量下单失败，改为逐笔下单: %v", err)
+			for n, k := range indexes[start:end] {
+				d := items[k].decision
+				if canLookup {
+					id := requests[start+n].ClientOrderID
+					existing, lookupErr := lookup.GetOrderByClientID(d.Symbol, id)
+					if lookupErr != nil {
+						errs[k] = fmt.Errorf("批量下单失败且无法确认订单 %s 是否已提交: %w", id, lookupErr)
+						continue
+					}
+					if existing != nil {
+						log.Printf("  ↻ %s 订单 %s 已在交易所（批量下单响应丢失），不再重复提交", d.Symbol, id)
+						order := at.recordSubmittedOrder(id, d.Symbol, d.Action, plans[k].orderType, plans[k].quantity, d.Leverage, existing)
+						at.finishOpen(d, items[k].record, plans[k], order)
+						continue
+					}
+				}
+				order, err := at.submitOrder(d.Symbol, d.Action, plans[k].orderType, plans[k].quantity, d.Leverage)
+				if err != nil {
+					errs[k] = err
+					continue
+				}
+				at.finishOpen(d, items[k].record, plans[k], order)
+			}
+			continue
+		}
+
+		log.Printf("  📦 批量提交 %d 笔开仓单", end-start)
+		for n, result := range results {
+			k := indexes[start+n]
+			d := items[k].decision
+			if result.Err != nil {
+				metrics.ExchangeErrors.WithLabelValues(at.id, at.exchange).Inc()
+				errs[k] = result.Err
+				continue
+			}
+			order := at.recordSubmittedOrder(requests[start+n].ClientOrderID, d.Symbol, d.Action, plans[k].orderType, plans[k].quantity, d.Leverage, result.Order)
+			at.finishOpen(d, items[k].record, plans[k], order)
+		}
+	}
+	return errs
+}
+
+// placeBatchWithTimeout 在下单超时内等待批量下单返回，超时后逐笔按客户端订单ID撤单并返回 ErrOrderTimeout，
+// 避免批量接口响应缓慢时持有 positionMutex 阻塞整个扫描周期
+func (at *AutoTrader) placeBatchWithTimeout(batcher BatchOrderTrader, requests []OrderRequest) ([]OrderResult, error) {
+	timeout := at.orderTimeout()
+	results, ok, err := awaitWithTimeout(timeout, func() ([]OrderResult, error) {
+		return batcher.PlaceBatchOrders(requests)
+	})
+	if ok {
+		return results, err
+	}
+
+	canceler, ok := at.trader.(OrderCanceler)
+	if !ok {
+		log.Printf("  ⏱ 批量下单 %v 未返回（交易所不支持按客户端订单ID撤单）", timeout)
+		return nil, fmt.Errorf("%w: 批量下单 %d 笔在 %v 内未返回", ErrOrderTimeout, len(requests), timeout)
+	}
+	for _, req := range requests {
+		log.Printf("  ⏱ %s 批量下单 %v 未返回，撤销订单 %s", req.Symbol, timeout, req.ClientOrderID)
+		if err := canceler.CancelOrderByClientID(req.Symbol, req.ClientOrderID); err != nil {
+			log.Printf("  ⚠️ %s 撤销超时订单 %s 失败（订单可能已成交或未到达交易所）: %v", req.Symbol, req.ClientOrderID, err)
+		}
+	}
+	return nil, fmt.Errorf("%w: 批量下单 %d 笔在 %v 内未返回", ErrOrderTimeout, len(requests), timeout)
+}
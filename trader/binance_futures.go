@@ -4,23 +4,29 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"nofx/hook"
+	"nofx/market"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/adshao/go-binance/v2/common"
 	"github.com/adshao/go-binance/v2/futures"
 )
 
+// binanceBrID 合约br ID（本系统下单的 clientOrderId 均以 "x-" + binanceBrID 开头）
+const binanceBrID = "KzrpZaP9"
+
 // getBrOrderID 生成唯一订单ID（合约专用）
 // 格式: x-{BR_ID}{TIMESTAMP}{RANDOM}
 // 合约限制32字符，统一使用此限制以保持一致性
 // 使用纳秒时间戳+随机数确保全局唯一性（冲突概率 < 10^-20）
 func getBrOrderID() string {
-	brID := "KzrpZaP9" // 合约br ID
+	brID := binanceBrID
 
 	// 计算可用空间: 32 - len("x-KzrpZaP9") = 32 - 11 = 21字符
 	// 分配: 13位时间戳 + 8位随机数 = 21字符（完美利用）
@@ -43,6 +49,24 @@ func getBrOrderID() string {
 	return orderID
 }
 
+// binanceErrDuplicateClientOrderID 币安拒绝重复 clientOrderId 的错误码
+const binanceErrDuplicateClientOrderID = -4116
+
+// binanceErrOrderNotExist 币安按订单ID查询时订单不存在的错误码
+const binanceErrOrderNotExist = -2013
+
+// brClientOrderID 将调用方的客户端订单ID加上br前缀（为空时随机生成），截断到32字符
+func brClientOrderID(clientOrderID string) string {
+	if clientOrderID == "" {
+		return getBrOrderID()
+	}
+	orderID := "x-" + binanceBrID + clientOrderID
+	if len(orderID) > 32 {
+		orderID = orderID[:32]
+	}
+	return orderID
+}
+
 // FuturesTrader 币安合约交易器
 type FuturesTrader struct {
 	client *futures.Client
@@ -59,6 +83,13 @@ type FuturesTrader struct {
 
 	// 缓存有效期（15秒）
 	cacheDuration time.Duration
+
+	// 用户数据流（成交推送）
+	userStream      *binanceUserStream
+	userStreamMutex sync.Mutex
+
+	// 账户为单向持仓（SetPositionMode 读回的实际模式），零值为双向持仓
+	oneWayMode bool
 }
 
 // NewFuturesTrader 创建合约交易器
@@ -72,40 +103,35 @@ func NewFuturesTrader(apiKey, secretKey string, userId string) *FuturesTrader {
 
 	// 同步时间，避免 Timestamp ahead 错误
 	syncBinanceServerTime(client)
-	trader := &FuturesTrader{
+	// 持仓模式由 AutoTrader 按交易员配置调用 SetPositionMode 设置（仅查询余额等用途的临时交易器不修改账户设置）
+	return &FuturesTrader{
 		client:        client,
 		cacheDuration: 15 * time.Second, // 15秒缓存
 	}
-
-	// 设置双向持仓模式（Hedge Mode）
-	// 这是必需的，因为代码中使用了 PositionSide (LONG/SHORT)
-	if err := trader.setDualSidePosition(); err != nil {
-		log.Printf("⚠️ 设置双向持仓模式失败: %v (如果已是双向模式则忽略此警告)", err)
-	}
-
-	return trader
 }
 
-// setDualSidePosition 设置双向持仓模式（初始化时调用）
-func (t *FuturesTrader) setDualSidePosition() error {
-	// 尝试设置双向持仓模式
-	err := t.client.NewChangePositionModeService().
-		DualSide(true). // true = 双向持仓（Hedge Mode）
+// SetPositionMode 切换账户持仓模式（dualSide=true 为双向持仓 Hedge Mode）并读回账户实际模式，后续下单按实际模式指定 positionSide
+// 有持仓或挂单时币安不允许切换，此时返回错误和未变化的实际模式
+func (t *FuturesTrader) SetPositionMode(dualSide bool) (bool, error) {
+	changeErr := t.client.NewChangePositionModeService().
+		DualSide(dualSide).
 		Do(context.Background())
 
+	mode, err := t.client.NewGetPositionModeService().Do(context.Background())
 	if err != nil {
-		// 如果错误信息包含"No need to change"，说明已经是双向持仓模式
-		if strings.Contains(err.Error(), "No need to change position side") {
-			log.Printf("  ✓ 账户已是双向持仓模式（Hedge Mode）")
-			return nil
-		}
-		// 其他错误则返回（但在调用方不会中断初始化）
-		return err
+		return !t.oneWayMode, fmt.Errorf("查询账户持仓模式失败: %w", err)
 	}
+	t.oneWayMode = !mode.DualSidePosition
 
-	log.Printf("  ✓ 账户已切换为双向持仓模式（Hedge Mode）")
-	log.Printf("  ℹ️  双向持仓模式允许同时持有多单和空单")
-	return nil
+	if mode.DualSidePosition != dualSide {
+		return mode.DualSidePosition, fmt.Errorf("切换持仓模式失败（有持仓或挂单时不能切换）: %w", changeErr)
+	}
+	if mode.DualSidePosition {
+		log.Printf("  ✓ 账户为双向持仓模式（Hedge Mode），允许同时持有多单和空单")
+	} else {
+		log.Printf("  ✓ 账户为单向持仓模式（One-way Mode）")
+	}
+	return mode.DualSidePosition, nil
 }
 
 // syncBinanceServerTime 同步币安服务器时间，确保请求时间戳合法
@@ -122,6 +148,50 @@ func syncBinanceServerTime(client *futures.Client) {
 	log.Printf("⏱ 已同步币安服务器时间，偏移 %dms", offset)
 }
 
+// incomePageLimit 币安资金流水接口单次返回的最大条数
+const incomePageLimit = 1000
+
+// GetIncomeHistory 获取 since 之后的已实现盈亏、手续费和资金费流水（按时间正序，自动翻页）
+func (t *FuturesTrader) GetIncomeHistory(since time.Time) ([]IncomeRecord, error) {
+	var records []IncomeRecord
+	startTime := since.UnixMilli()
+	for {
+		page, err := t.client.NewGetIncomeHistoryService().
+			StartTime(startTime).
+			Limit(incomePageLimit).
+			Do(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("获取资金流水失败: %w", err)
+		}
+
+		for _, item := range page {
+			if item.Time >= startTime {
+				startTime = item.Time + 1
+			}
+			switch item.IncomeType {
+			case IncomeTypeRealizedPnL, IncomeTypeCommission, IncomeTypeFundingFee:
+			default:
+				continue
+			}
+			income, err := strconv.ParseFloat(item.Income, 64)
+			if err != nil {
+				continue
+			}
+			records = append(records, IncomeRecord{
+				Symbol:     item.Symbol,
+				IncomeType: item.IncomeType,
+				Income:     income,
+				Asset:      item.Asset,
+				Time:       time.UnixMilli(item.Time),
+			})
+		}
+
+		if len(page) < incomePageLimit {
+			return records, nil
+		}
+	}
+}
+
 // GetBalance 获取账户余额（带缓存）
 func (t *FuturesTrader) GetBalance() (map[string]interface{}, error) {
 	// 先检查缓存是否有效
@@ -195,6 +265,7 @@ func (t *FuturesTrader) GetPositions() ([]map[string]interface{}, error) {
 		posMap["unRealizedProfit"], _ = strconv.ParseFloat(pos.UnRealizedProfit, 64)
 		posMap["leverage"], _ = strconv.ParseFloat(pos.Leverage, 64)
 		posMap["liquidationPrice"], _ = strconv.ParseFloat(pos.LiquidationPrice, 64)
+		posMap["marginMode"] = normalizeMarginMode(pos.MarginType)
 
 		// 判断方向
 		if posAmt > 0 {
@@ -241,10 +312,9 @@ func (t *FuturesTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
 			log.Printf("  ✓ %s 仓位模式已是 %s", symbol, marginModeStr)
 			return nil
 		}
-		// 如果有持仓，无法更改仓位模式，但不影响交易
+		// 如果有持仓，无法更改仓位模式，由调用方决定是否继续使用当前模式
 		if contains(err.Error(), "Margin type cannot be changed if there exists position") {
-			log.Printf("  ⚠️ %s 有持仓，无法更改仓位模式，继续使用当前模式", symbol)
-			return nil
+			return fmt.Errorf("%w: %v", ErrMarginModeLocked, err)
 		}
 		// 检测多资产模式（错误码 -4168）
 		if contains(err.Error(), "Multi-Assets mode") || contains(err.Error(), "-4168") || contains(err.Error(), "4168") {
@@ -313,45 +383,21 @@ func (t *FuturesTrader) SetLeverage(symbol string, leverage int) error {
 }
 
 // OpenLong 开多仓
-func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
-	// 先取消该币种的所有委托单（清理旧的止损止盈单）
-	if err := t.CancelAllOrders(symbol); err != nil {
-		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
-	}
-
-	// 设置杠杆
-	if err := t.SetLeverage(symbol, leverage); err != nil {
-		return nil, err
-	}
+func (t *FuturesTrader) OpenLong(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.OpenLongWithClientID(symbol, positionSide, quantity, leverage, "")
+}
 
-	// 注意：仓位模式应该由调用方（AutoTrader）在开仓前通过 SetMarginMode 设置
+// OpenLongWithClientID 开多仓（指定客户端订单ID，为空时随机生成）
+func (t *FuturesTrader) OpenLongWithClientID(symbol string, positionSide string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
+	posSide := t.orderPositionSide(positionSide, futures.PositionSideTypeLong)
 
-	// 格式化数量到正确精度
-	quantityStr, err := t.FormatQuantity(symbol, quantity)
+	quantityStr, err := t.prepareOpenOrder(symbol, posSide, quantity, leverage)
 	if err != nil {
 		return nil, err
 	}
 
-	// ✅ 检查格式化后的数量是否为 0（防止四舍五入导致的错误）
-	quantityFloat, parseErr := strconv.ParseFloat(quantityStr, 64)
-	if parseErr != nil || quantityFloat <= 0 {
-		return nil, fmt.Errorf("开仓数量过小，格式化后为 0 (原始: %.8f → 格式化: %s)。建议增加开仓金额或选择价格更低的币种", quantity, quantityStr)
-	}
-
-	// ✅ 检查最小名义价值（Binance 要求至少 10 USDT）
-	if err := t.CheckMinNotional(symbol, quantityFloat); err != nil {
-		return nil, err
-	}
-
 	// 创建市价买入订单（使用br ID）
-	order, err := t.client.NewCreateOrderService().
-		Symbol(symbol).
-		Side(futures.SideTypeBuy).
-		PositionSide(futures.PositionSideTypeLong).
-		Type(futures.OrderTypeMarket).
-		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+	order, err := t.createMarketOrder(symbol, futures.SideTypeBuy, posSide, quantityStr, clientOrderID, false)
 
 	if err != nil {
 		return nil, fmt.Errorf("开多仓失败: %w", err)
@@ -360,53 +406,25 @@ func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int)
 	log.Printf("✓ 开多仓成功: %s 数量: %s", symbol, quantityStr)
 	log.Printf("  订单ID: %d", order.OrderID)
 
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
-	return result, nil
+	return binanceOrderResult(order), nil
 }
 
 // OpenShort 开空仓
-func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
-	// 先取消该币种的所有委托单（清理旧的止损止盈单）
-	if err := t.CancelAllOrders(symbol); err != nil {
-		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
-	}
-
-	// 设置杠杆
-	if err := t.SetLeverage(symbol, leverage); err != nil {
-		return nil, err
-	}
+func (t *FuturesTrader) OpenShort(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.OpenShortWithClientID(symbol, positionSide, quantity, leverage, "")
+}
 
-	// 注意：仓位模式应该由调用方（AutoTrader）在开仓前通过 SetMarginMode 设置
+// OpenShortWithClientID 开空仓（指定客户端订单ID，为空时随机生成）
+func (t *FuturesTrader) OpenShortWithClientID(symbol string, positionSide string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
+	posSide := t.orderPositionSide(positionSide, futures.PositionSideTypeShort)
 
-	// 格式化数量到正确精度
-	quantityStr, err := t.FormatQuantity(symbol, quantity)
+	quantityStr, err := t.prepareOpenOrder(symbol, posSide, quantity, leverage)
 	if err != nil {
 		return nil, err
 	}
 
-	// ✅ 检查格式化后的数量是否为 0（防止四舍五入导致的错误）
-	quantityFloat, parseErr := strconv.ParseFloat(quantityStr, 64)
-	if parseErr != nil || quantityFloat <= 0 {
-		return nil, fmt.Errorf("开仓数量过小，格式化后为 0 (原始: %.8f → 格式化: %s)。建议增加开仓金额或选择价格更低的币种", quantity, quantityStr)
-	}
-
-	// ✅ 检查最小名义价值（Binance 要求至少 10 USDT）
-	if err := t.CheckMinNotional(symbol, quantityFloat); err != nil {
-		return nil, err
-	}
-
 	// 创建市价卖出订单（使用br ID）
-	order, err := t.client.NewCreateOrderService().
-		Symbol(symbol).
-		Side(futures.SideTypeSell).
-		PositionSide(futures.PositionSideTypeShort).
-		Type(futures.OrderTypeMarket).
-		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+	order, err := t.createMarketOrder(symbol, futures.SideTypeSell, posSide, quantityStr, clientOrderID, false)
 
 	if err != nil {
 		return nil, fmt.Errorf("开空仓失败: %w", err)
@@ -415,15 +433,18 @@ func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int)
 	log.Printf("✓ 开空仓成功: %s 数量: %s", symbol, quantityStr)
 	log.Printf("  订单ID: %d", order.OrderID)
 
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
-	return result, nil
+	return binanceOrderResult(order), nil
 }
 
 // CloseLong 平多仓
-func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *FuturesTrader) CloseLong(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
+	return t.CloseLongWithClientID(symbol, positionSide, quantity, "")
+}
+
+// CloseLongWithClientID 平多仓（指定客户端订单ID，为空时随机生成）
+func (t *FuturesTrader) CloseLongWithClientID(symbol string, positionSide string, quantity float64, clientOrderID string) (map[string]interface{}, error) {
+	posSide := t.orderPositionSide(positionSide, futures.PositionSideTypeLong)
+
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -439,7 +460,10 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 		}
 
 		if quantity == 0 {
-			return nil, fmt.Errorf("没有找到 %s 的多仓", symbol)
+			if order := t.closedOrderByClientID(symbol, clientOrderID); order != nil {
+				return order, nil
+			}
+			return nil, fmt.Errorf("%w: %s 多仓", ErrPositionNotFound, symbol)
 		}
 	}
 
@@ -450,14 +474,8 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 	}
 
 	// 创建市价卖出订单（平多，使用br ID）
-	order, err := t.client.NewCreateOrderService().
-		Symbol(symbol).
-		Side(futures.SideTypeSell).
-		PositionSide(futures.PositionSideTypeLong).
-		Type(futures.OrderTypeMarket).
-		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+	// 双向持仓模式下 positionSide=LONG 的卖单只能减仓（币安不允许再传 reduceOnly），数量超过持仓会被拒绝而不会反向开空
+	order, err := t.createMarketOrder(symbol, futures.SideTypeSell, posSide, quantityStr, clientOrderID, true)
 
 	if err != nil {
 		return nil, fmt.Errorf("平多仓失败: %w", err)
@@ -465,20 +483,23 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 
 	log.Printf("✓ 平多仓成功: %s 数量: %s", symbol, quantityStr)
 
-	// 平仓后取消该币种的所有挂单（止损止盈单）
-	if err := t.CancelAllOrders(symbol); err != nil {
+	// 平仓后取消该币种同方向的挂单（止损止盈单）
+	if err := t.cancelOrdersByPositionSide(symbol, posSide); err != nil {
 		log.Printf("  ⚠ 取消挂单失败: %v", err)
 	}
 
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
-	return result, nil
+	return binanceOrderResult(order), nil
 }
 
 // CloseShort 平空仓
-func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *FuturesTrader) CloseShort(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
+	return t.CloseShortWithClientID(symbol, positionSide, quantity, "")
+}
+
+// CloseShortWithClientID 平空仓（指定客户端订单ID，为空时随机生成）
+func (t *FuturesTrader) CloseShortWithClientID(symbol string, positionSide string, quantity float64, clientOrderID string) (map[string]interface{}, error) {
+	posSide := t.orderPositionSide(positionSide, futures.PositionSideTypeShort)
+
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -494,7 +515,10 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 		}
 
 		if quantity == 0 {
-			return nil, fmt.Errorf("没有找到 %s 的空仓", symbol)
+			if order := t.closedOrderByClientID(symbol, clientOrderID); order != nil {
+				return order, nil
+			}
+			return nil, fmt.Errorf("%w: %s 空仓", ErrPositionNotFound, symbol)
 		}
 	}
 
@@ -505,31 +529,295 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 	}
 
 	// 创建市价买入订单（平空，使用br ID）
-	order, err := t.client.NewCreateOrderService().
+	// 双向持仓模式下 positionSide=SHORT 的买单只能减仓，不会反向开多
+	order, err := t.createMarketOrder(symbol, futures.SideTypeBuy, posSide, quantityStr, clientOrderID, true)
+
+	if err != nil {
+		return nil, fmt.Errorf("平空仓失败: %w", err)
+	}
+
+	log.Printf("✓ 平空仓成功: %s 数量: %s", symbol, quantityStr)
+
+	// 平仓后取消该币种同方向的挂单（止损止盈单）
+	if err := t.cancelOrdersByPositionSide(symbol, posSide); err != nil {
+		log.Printf("  ⚠ 取消挂单失败: %v", err)
+	}
+
+	return binanceOrderResult(order), nil
+}
+
+// prepareOpenOrder 开仓下单前的准备：取消同方向旧委托单、设置杠杆，返回格式化并校验过的下单数量
+func (t *FuturesTrader) prepareOpenOrder(symbol string, posSide futures.PositionSideType, quantity float64, leverage int) (string, error) {
+	// 先取消该币种同方向的委托单（清理旧的止损止盈单，双向持仓时不影响另一方向）
+	if err := t.cancelOrdersByPositionSide(symbol, posSide); err != nil {
+		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
+	}
+
+	// 设置杠杆
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return "", err
+	}
+
+	// 注意：仓位模式应该由调用方（AutoTrader）在开仓前通过 SetMarginMode 设置
+
+	// 格式化数量到正确精度
+	quantityStr, err := t.FormatQuantity(symbol, quantity)
+	if err != nil {
+		return "", err
+	}
+
+	// ✅ 检查格式化后的数量是否为 0（防止四舍五入导致的错误）
+	quantityFloat, parseErr := strconv.ParseFloat(quantityStr, 64)
+	if parseErr != nil || quantityFloat <= 0 {
+		return "", fmt.Errorf("开仓数量过小，格式化后为 0 (原始: %.8f → 格式化: %s)。建议增加开仓金额或选择价格更低的币种", quantity, quantityStr)
+	}
+
+	// ✅ 检查最小名义价值（Binance 要求至少 10 USDT）
+	if err := t.CheckMinNotional(symbol, quantityFloat); err != nil {
+		return "", err
+	}
+
+	return quantityStr, nil
+}
+
+// PlaceBatchOrders 通过 batchOrders 接口批量提交市价开仓单（单次最多5笔）
+// 准备阶段失败（数量过小等）的订单不提交，与交易所拒绝的订单一样记录在对应结果的 Err 中
+func (t *FuturesTrader) PlaceBatchOrders(orders []OrderRequest) ([]OrderResult, error) {
+	results := make([]OrderResult, len(orders))
+	var services []*futures.CreateOrderService
+	var indexes []int
+	for k, o := range orders {
+		side := futures.SideTypeBuy
+		if resolvePositionSide(o.PositionSide, futures.PositionSideTypeLong) == futures.PositionSideTypeShort {
+			side = futures.SideTypeSell
+		}
+		posSide := t.orderPositionSide(o.PositionSide, futures.PositionSideTypeLong)
+		quantityStr, err := t.prepareOpenOrder(o.Symbol, posSide, o.Quantity, o.Leverage)
+		if err != nil {
+			results[k].Err = err
+			continue
+		}
+		services = append(services, t.client.NewCreateOrderService().
+			Symbol(o.Symbol).
+			Side(side).
+			PositionSide(posSide).
+			Type(futures.OrderTypeMarket).
+			Quantity(quantityStr).
+			NewClientOrderID(brClientOrderID(o.ClientOrderID)))
+		indexes = append(indexes, k)
+	}
+	if len(services) == 0 {
+		return results, nil
+	}
+
+	resp, err := t.client.NewCreateBatchOrdersService().OrderList(services).Do(context.Background())
+	if err != nil {
+		return nil, classifyBinanceError(err)
+	}
+	if len(resp.Errors) != len(services) {
+		return nil, fmt.Errorf("批量下单返回 %d 个结果，提交了 %d 笔", len(resp.Errors), len(services))
+	}
+
+	// resp.Orders 只包含成功的订单，按提交顺序与 resp.Errors 中为 nil 的位置对应
+	next := 0
+	for n, k := range indexes {
+		if itemErr := resp.Errors[n]; itemErr != nil {
+			results[k].Err = fmt.Errorf("开仓失败: %w", classifyBinanceError(itemErr))
+			continue
+		}
+		if next >= len(resp.Orders) {
+			results[k].Err = fmt.Errorf("批量下单响应缺少 %s 的订单", orders[k].Symbol)
+			continue
+		}
+		order := resp.Orders[next]
+		next++
+		results[k].Order = map[string]interface{}{
+			"orderId":       order.OrderID,
+			"symbol":        order.Symbol,
+			"status":        order.Status,
+			"clientOrderId": order.ClientOrderID,
+		}
+		log.Printf("✓ 批量开仓成功: %s 数量: %s 订单ID: %d", order.Symbol, order.OrigQuantity, order.OrderID)
+	}
+	return results, nil
+}
+
+// createMarketOrder 提交市价单
+// 提交失败时按 clientOrderId 查询订单：重复ID被拒绝、或请求已到达交易所但响应丢失时，订单已存在即视为成功，避免重试造成重复下单
+func (t *FuturesTrader) createMarketOrder(symbol string, side futures.SideType, posSide futures.PositionSideType, quantityStr, clientOrderID string, reduceOnly bool) (*futures.CreateOrderResponse, error) {
+	brOrderID := brClientOrderID(clientOrderID)
+	service := t.client.NewCreateOrderService().
 		Symbol(symbol).
-		Side(futures.SideTypeBuy).
-		PositionSide(futures.PositionSideTypeShort).
+		Side(side).
+		PositionSide(posSide).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
+		NewClientOrderID(brOrderID)
+	if reduceOnly && posSide == futures.PositionSideTypeBoth {
+		// 单向持仓的平仓单必须只减仓，数量超过持仓时不会反向开仓（双向持仓下币安不允许传 reduceOnly）
+		service = service.ReduceOnly(true)
+	}
+	order, err := service.Do(context.Background())
+	if err == nil {
+		return order, nil
+	}
+
+	// 交易所明确拒绝（保证金不足、数量非法等）时订单肯定不存在，无需查询
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) && apiErr.IsValid() && apiErr.Code != binanceErrDuplicateClientOrderID {
+		return nil, classifyBinanceError(err)
+	}
+
+	existing := t.lookupOrderByClientID(symbol, brOrderID)
+	if existing == nil {
+		return nil, err
+	}
+
+	log.Printf("  ↻ 订单 %s 已存在于交易所（订单ID: %d），按已成交处理: %v", brOrderID, existing.OrderID, err)
+	return existing, nil
+}
+
+// lookupOrderByClientID 按（带br前缀的）客户端订单ID查询交易所上已有的订单，不存在或查询失败时返回 nil
+func (t *FuturesTrader) lookupOrderByClientID(symbol, brOrderID string) *futures.CreateOrderResponse {
+	existing, err := t.client.NewGetOrderService().
+		Symbol(symbol).
+		OrigClientOrderID(brOrderID).
 		Do(context.Background())
+	if err != nil || existing == nil {
+		return nil
+	}
+	return &futures.CreateOrderResponse{
+		Symbol:           existing.Symbol,
+		OrderID:          existing.OrderID,
+		ClientOrderID:    existing.ClientOrderID,
+		Status:           existing.Status,
+		AvgPrice:         existing.AvgPrice,
+		ExecutedQuantity: existing.ExecutedQuantity,
+		Side:             existing.Side,
+		PositionSide:     existing.PositionSide,
+	}
+}
 
+// GetOrderByClientID 按客户端订单ID查询订单，订单不存在或未成交即已撤销/过期时返回 nil；查询失败时返回错误
+func (t *FuturesTrader) GetOrderByClientID(symbol string, clientOrderID string) (map[string]interface{}, error) {
+	order, err := t.client.NewGetOrderService().
+		Symbol(symbol).
+		OrigClientOrderID(brClientOrderID(clientOrderID)).
+		Do(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("平空仓失败: %w", err)
+		var apiErr *common.APIError
+		if errors.As(err, &apiErr) && apiErr.Code == binanceErrOrderNotExist {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询订单 %s 失败: %w", clientOrderID, err)
 	}
 
-	log.Printf("✓ 平空仓成功: %s 数量: %s", symbol, quantityStr)
+	executed, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	switch order.Status {
+	case futures.OrderStatusTypeCanceled, futures.OrderStatusTypeExpired, futures.OrderStatusTypeRejected:
+		if executed == 0 {
+			return nil, nil
+		}
+	}
 
-	// 平仓后取消该币种的所有挂单（止损止盈单）
-	if err := t.CancelAllOrders(symbol); err != nil {
-		log.Printf("  ⚠ 取消挂单失败: %v", err)
+	result := binanceOrderResult(&futures.CreateOrderResponse{
+		Symbol:        order.Symbol,
+		OrderID:       order.OrderID,
+		ClientOrderID: order.ClientOrderID,
+		Status:        order.Status,
+	})
+	return result, nil
+}
+
+// closedOrderByClientID 全部平仓时持仓已不存在：同一客户端订单ID的平仓单已在交易所（上次请求成交但响应丢失），
+// 返回该订单的结果，使按ID重试的平仓保持幂等；未指定ID或订单不存在时返回 nil
+func (t *FuturesTrader) closedOrderByClientID(symbol, clientOrderID string) map[string]interface{} {
+	if clientOrderID == "" {
+		return nil
+	}
+	brOrderID := brClientOrderID(clientOrderID)
+	existing := t.lookupOrderByClientID(symbol, brOrderID)
+	if existing == nil {
+		return nil
 	}
+	log.Printf("  ↻ 平仓单 %s 已存在于交易所（订单ID: %d），持仓已平，按已成交处理", brOrderID, existing.OrderID)
+	return binanceOrderResult(existing)
+}
+
+// classifyBinanceError 能识别错误码时为币安API错误包装对应的错误类型（ErrInsufficientMargin 等）
+func classifyBinanceError(err error) error {
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) {
+		if kind := binanceCodeError(apiErr.Code); kind != nil {
+			return fmt.Errorf("%w: %w", kind, err)
+		}
+	}
+	return err
+}
 
+// binanceOrderResult 转换为统一的订单结果
+func binanceOrderResult(order *futures.CreateOrderResponse) map[string]interface{} {
 	result := make(map[string]interface{})
 	result["orderId"] = order.OrderID
 	result["symbol"] = order.Symbol
 	result["status"] = order.Status
-	return result, nil
+	result["clientOrderId"] = order.ClientOrderID
+	return result
+}
+
+// orderPositionSide 下单使用的 positionSide：双向持仓为 LONG/SHORT，单向持仓固定为 BOTH（方向由买卖决定）
+func (t *FuturesTrader) orderPositionSide(positionSide string, defaultSide futures.PositionSideType) futures.PositionSideType {
+	if t.oneWayMode {
+		return futures.PositionSideTypeBoth
+	}
+	return resolvePositionSide(positionSide, defaultSide)
+}
+
+// resolvePositionSide 将调用方传入的持仓方向转换为币安类型（未指定时使用默认方向）
+func resolvePositionSide(positionSide string, defaultSide futures.PositionSideType) futures.PositionSideType {
+	switch strings.ToUpper(positionSide) {
+	case PositionSideLong:
+		return futures.PositionSideTypeLong
+	case PositionSideShort:
+		return futures.PositionSideTypeShort
+	default:
+		return defaultSide
+	}
+}
+
+// cancelOrdersByPositionSide 仅取消指定持仓方向的挂单
+// 双向持仓模式下同一币种可能同时存在多空仓位，不能用 CancelAllOrders 误删另一方向的止盈止损
+func (t *FuturesTrader) cancelOrdersByPositionSide(symbol string, positionSide futures.PositionSideType) error {
+	orders, err := t.client.NewListOpenOrdersService().
+		Symbol(symbol).
+		Do(context.Background())
+
+	if err != nil {
+		return fmt.Errorf("获取未完成订单失败: %w", err)
+	}
+
+	canceledCount := 0
+	for _, order := range orders {
+		if order.PositionSide != positionSide {
+			continue
+		}
+
+		_, err := t.client.NewCancelOrderService().
+			Symbol(symbol).
+			OrderID(order.OrderID).
+			Do(context.Background())
+
+		if err != nil {
+			log.Printf("  ⚠ 取消订单 %d 失败: %v", order.OrderID, err)
+			continue
+		}
+		canceledCount++
+	}
+
+	if canceledCount > 0 {
+		log.Printf("  ✓ 已取消 %s %s 方向的 %d 个挂单", symbol, positionSide, canceledCount)
+	}
+	return nil
 }
 
 // CancelStopLossOrders 仅取消止损单（不影响止盈单）
@@ -646,6 +934,20 @@ func (t *FuturesTrader) CancelAllOrders(symbol string) error {
 	return nil
 }
 
+// CancelOrderByClientID 按客户端订单ID撤单（ID 与下单时一样加上br前缀）
+func (t *FuturesTrader) CancelOrderByClientID(symbol string, clientOrderID string) error {
+	_, err := t.client.NewCancelOrderService().
+		Symbol(symbol).
+		OrigClientOrderID(brClientOrderID(clientOrderID)).
+		Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("撤销订单 %s 失败: %w", clientOrderID, err)
+	}
+
+	log.Printf("  ✓ 已撤销 %s 订单 %s", symbol, clientOrderID)
+	return nil
+}
+
 // CancelStopOrders 取消该币种的止盈/止损单（用于调整止盈止损位置）
 func (t *FuturesTrader) CancelStopOrders(symbol string) error {
 	// 获取该币种的所有未完成订单
@@ -727,24 +1029,28 @@ func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity
 
 	if positionSide == "LONG" {
 		side = futures.SideTypeSell
-		posSide = futures.PositionSideTypeLong
+		posSide = t.orderPositionSide(positionSide, futures.PositionSideTypeLong)
 	} else {
 		side = futures.SideTypeBuy
-		posSide = futures.PositionSideTypeShort
+		posSide = t.orderPositionSide(positionSide, futures.PositionSideTypeShort)
 	}
 
-	// 格式化数量
+	// 格式化数量和触发价
 	quantityStr, err := t.FormatQuantity(symbol, quantity)
 	if err != nil {
 		return err
 	}
+	stopPriceStr, err := t.FormatPrice(symbol, stopPrice)
+	if err != nil {
+		return err
+	}
 
 	_, err = t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(side).
 		PositionSide(posSide).
 		Type(futures.OrderTypeStopMarket).
-		StopPrice(fmt.Sprintf("%.8f", stopPrice)).
+		StopPrice(stopPriceStr).
 		Quantity(quantityStr).
 		WorkingType(futures.WorkingTypeContractPrice).
 		ClosePosition(true).
@@ -765,28 +1071,35 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 
 	if positionSide == "LONG" {
 		side = futures.SideTypeSell
-		posSide = futures.PositionSideTypeLong
+		posSide = t.orderPositionSide(positionSide, futures.PositionSideTypeLong)
 	} else {
 		side = futures.SideTypeBuy
-		posSide = futures.PositionSideTypeShort
+		posSide = t.orderPositionSide(positionSide, futures.PositionSideTypeShort)
 	}
 
-	// 格式化数量
+	// 格式化数量和触发价
 	quantityStr, err := t.FormatQuantity(symbol, quantity)
 	if err != nil {
 		return err
 	}
+	takeProfitPriceStr, err := t.FormatPrice(symbol, takeProfitPrice)
+	if err != nil {
+		return err
+	}
 
-	_, err = t.client.NewCreateOrderService().
+	// 按数量止盈而非 ClosePosition：双向持仓下反向单只会减仓（单向持仓显式只减仓），且可挂多张单实现分批止盈
+	service := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(side).
 		PositionSide(posSide).
 		Type(futures.OrderTypeTakeProfitMarket).
-		StopPrice(fmt.Sprintf("%.8f", takeProfitPrice)).
+		StopPrice(takeProfitPriceStr).
 		Quantity(quantityStr).
-		WorkingType(futures.WorkingTypeContractPrice).
-		ClosePosition(true).
-		Do(context.Background())
+		WorkingType(futures.WorkingTypeContractPrice)
+	if posSide == futures.PositionSideTypeBoth {
+		service = service.ReduceOnly(true)
+	}
+	_, err = service.Do(context.Background())
 
 	if err != nil {
 		return fmt.Errorf("设置止盈失败: %w", err)
@@ -796,12 +1109,59 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 	return nil
 }
 
+// SetStopLossTakeProfit 挂联动的止损止盈单
+// 币安合约没有原生 OCO，止损和止盈都使用 closePosition 条件单：任一方触发平仓后交易所自动撤销另一方
+func (t *FuturesTrader) SetStopLossTakeProfit(symbol string, positionSide string, quantity, stopPrice, takeProfitPrice float64) error {
+	if err := t.SetStopLoss(symbol, positionSide, quantity, stopPrice); err != nil {
+		return err
+	}
+
+	side := futures.SideTypeBuy
+	if positionSide == "LONG" {
+		side = futures.SideTypeSell
+	}
+	posSide := t.orderPositionSide(positionSide, futures.PositionSideTypeShort)
+	takeProfitPriceStr, err := t.FormatPrice(symbol, takeProfitPrice)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTakeProfitNotSet, err)
+	}
+
+	_, err = t.client.NewCreateOrderService().
+		Symbol(symbol).
+		Side(side).
+		PositionSide(posSide).
+		Type(futures.OrderTypeTakeProfitMarket).
+		StopPrice(takeProfitPriceStr).
+		WorkingType(futures.WorkingTypeContractPrice).
+		ClosePosition(true).
+		Do(context.Background())
+	if err != nil {
+		// 止损已挂上，保留止损保护，只报告止盈失败
+		return fmt.Errorf("%w: %w", ErrTakeProfitNotSet, err)
+	}
+
+	log.Printf("  止盈价设置: %.4f（与止损联动）", takeProfitPrice)
+	return nil
+}
+
 // GetMinNotional 获取最小名义价值（Binance要求）
 func (t *FuturesTrader) GetMinNotional(symbol string) float64 {
-	// 使用保守的默认值 10 USDT，确保订单能够通过交易所验证
+	if filters, err := t.GetSymbolFilters(symbol); err == nil && filters.MinNotional > 0 {
+		return filters.MinNotional
+	}
+	// 获取失败时使用保守的默认值 10 USDT，确保订单能够通过交易所验证
 	return 10.0
 }
 
+// GetSymbolFilters 获取交易对的数量步进值和最小名义价值（读取 market 包共享的 exchangeInfo 缓存）
+func (t *FuturesTrader) GetSymbolFilters(symbol string) (SymbolFilters, error) {
+	filters, err := market.GetSymbolFilters(symbol)
+	if err != nil {
+		return SymbolFilters{}, err
+	}
+	return SymbolFilters{StepSize: filters.StepSize, MinNotional: filters.MinNotional}, nil
+}
+
 // CheckMinNotional 检查订单是否满足最小名义价值要求
 func (t *FuturesTrader) CheckMinNotional(symbol string, quantity float64) error {
 	price, err := t.GetMarketPrice(symbol)
@@ -822,29 +1182,21 @@ func (t *FuturesTrader) CheckMinNotional(symbol string, quantity float64) error
 	return nil
 }
 
-// GetSymbolPrecision 获取交易对的数量精度
+// GetSymbolPrecision 获取交易对的数量精度（读取 market 包共享的 exchangeInfo 缓存）
 func (t *FuturesTrader) GetSymbolPrecision(symbol string) (int, error) {
-	exchangeInfo, err := t.client.NewExchangeInfoService().Do(context.Background())
+	filters, err := market.GetSymbolFilters(symbol)
 	if err != nil {
-		return 0, fmt.Errorf("获取交易规则失败: %w", err)
+		return 0, err
 	}
-
-	for _, s := range exchangeInfo.Symbols {
-		if s.Symbol == symbol {
-			// 从LOT_SIZE filter获取精度
-			for _, filter := range s.Filters {
-				if filter["filterType"] == "LOT_SIZE" {
-					stepSize := filter["stepSize"].(string)
-					precision := calculatePrecision(stepSize)
-					log.Printf("  %s 数量精度: %d (stepSize: %s)", symbol, precision, stepSize)
-					return precision, nil
-				}
-			}
-		}
+	if filters.StepSize <= 0 {
+		log.Printf("  ⚠ %s 未找到精度信息，使用默认精度3", symbol)
+		return 3, nil // 默认精度为3
 	}
 
-	log.Printf("  ⚠ %s 未找到精度信息，使用默认精度3", symbol)
-	return 3, nil // 默认精度为3
+	stepSize := strconv.FormatFloat(filters.StepSize, 'f', -1, 64)
+	precision := calculatePrecision(stepSize)
+	log.Printf("  %s 数量精度: %d (stepSize: %s)", symbol, precision, stepSize)
+	return precision, nil
 }
 
 // calculatePrecision 从stepSize计算精度
@@ -902,6 +1254,15 @@ func (t *FuturesTrader) FormatQuantity(symbol string, quantity float64) (string,
 	return fmt.Sprintf(format, quantity), nil
 }
 
+// FormatPrice 按交易对的 tickSize 格式化价格（获取失败时保留8位小数，由交易所校验）
+func (t *FuturesTrader) FormatPrice(symbol string, price float64) (string, error) {
+	filters, err := market.GetSymbolFilters(symbol)
+	if err != nil || filters.TickSize <= 0 {
+		return fmt.Sprintf("%.8f", price), nil
+	}
+	return formatStep(price, filters.TickSize), nil
+}
+
 // 辅助函数
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && stringContains(s, substr)
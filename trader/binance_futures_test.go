@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -418,3 +420,254 @@ func TestGetBrOrderID(t *testing.T) {
 		ids[id] = true
 	}
 }
+
+// TestFuturesTrader_CreateMarketOrderIdempotent 测试订单已到达交易所但响应丢失、以及重复 clientOrderId 被拒绝时按已有订单处理
+func TestFuturesTrader_CreateMarketOrderIdempotent(t *testing.T) {
+	var mu sync.Mutex
+	orders := make(map[string]map[string]interface{}) // clientOrderId -> 订单
+	posts := 0
+	lookups := 0
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/fapi/v1/order" && r.Method == "POST":
+			posts++
+			id := r.FormValue("newClientOrderId")
+			if r.FormValue("symbol") == "ETHUSDT" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": -2019, "msg": "Margin is insufficient."})
+				return
+			}
+			if _, exists := orders[id]; exists {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": -4116, "msg": "ClientOrderId is duplicated."})
+				return
+			}
+			orders[id] = map[string]interface{}{
+				"orderId":       int64(1000 + len(orders)),
+				"symbol":        r.FormValue("symbol"),
+				"status":        "FILLED",
+				"clientOrderId": id,
+				"executedQty":   r.FormValue("quantity"),
+			}
+			// 首次下单成交，但连接在返回响应前断开
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+
+		case r.URL.Path == "/fapi/v1/order" && r.Method == "GET":
+			lookups++
+			order, exists := orders[r.URL.Query().Get("origClientOrderId")]
+			if !exists {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": -2013, "msg": "Order does not exist."})
+				return
+			}
+			json.NewEncoder(w).Encode(order)
+
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		}
+	}))
+	defer mockServer.Close()
+
+	client := futures.NewClient("test_api_key", "test_secret_key")
+	client.BaseURL = mockServer.URL
+	client.HTTPClient = mockServer.Client()
+	trader := &FuturesTrader{client: client}
+
+	// 响应丢失：查询到已有订单，按成功处理
+	first, err := trader.createMarketOrder("BTCUSDT", futures.SideTypeBuy, futures.PositionSideTypeLong, "0.010", "abc123", false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(1000), first.OrderID)
+	assert.Equal(t, "x-"+binanceBrID+"abc123", first.ClientOrderID)
+
+	// 调用方用同一ID重试：交易所拒绝重复ID，返回同一订单
+	retry, err := trader.createMarketOrder("BTCUSDT", futures.SideTypeBuy, futures.PositionSideTypeLong, "0.010", "abc123", false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, first.OrderID, retry.OrderID)
+	assert.Len(t, orders, 1, "重试不应产生第二笔订单")
+	assert.Equal(t, 2, posts)
+	assert.Equal(t, 2, lookups)
+
+	// 交易所明确拒绝时直接返回错误，不查询订单
+	_, err = trader.createMarketOrder("ETHUSDT", futures.SideTypeBuy, futures.PositionSideTypeLong, "1", "def456", false)
+	assert.Error(t, err)
+	assert.Equal(t, 2, lookups)
+}
+
+// TestFuturesTrader_CloseWithClientIDIdempotent 测试全部平仓的重试：上次平仓已成交但响应丢失，持仓已不存在时
+// 按客户端订单ID返回原订单；订单不存在（确实没有持仓）时仍返回 ErrPositionNotFound
+func TestFuturesTrader_CloseWithClientIDIdempotent(t *testing.T) {
+	brOrderID := brClientOrderID("close123")
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/fapi/v2/positionRisk":
+			json.NewEncoder(w).Encode([]map[string]interface{}{}) // 持仓已被上次的平仓单平掉
+
+		case r.URL.Path == "/fapi/v1/order" && r.Method == "GET":
+			if r.URL.Query().Get("origClientOrderId") != brOrderID {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": -2013, "msg": "Order does not exist."})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"orderId":       int64(2001),
+				"symbol":        "BTCUSDT",
+				"status":        "FILLED",
+				"clientOrderId": brOrderID,
+			})
+
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		}
+	}))
+	defer mockServer.Close()
+
+	client := futures.NewClient("test_api_key", "test_secret_key")
+	client.BaseURL = mockServer.URL
+	client.HTTPClient = mockServer.Client()
+	trader := &FuturesTrader{client: client, cacheDuration: 15 * time.Second}
+
+	order, err := trader.CloseLongWithClientID("BTCUSDT", PositionSideLong, 0, "close123")
+	if assert.NoError(t, err, "已成交的平仓单重试应按成功处理") {
+		assert.Equal(t, int64(2001), order["orderId"])
+		assert.Equal(t, brOrderID, order["clientOrderId"])
+	}
+
+	_, err = trader.CloseShortWithClientID("BTCUSDT", PositionSideShort, 0, "other456")
+	assert.ErrorIs(t, err, ErrPositionNotFound)
+
+	_, err = trader.CloseShortWithClientID("BTCUSDT", PositionSideShort, 0, "")
+	assert.ErrorIs(t, err, ErrPositionNotFound)
+}
+
+// TestFuturesTrader_GetOrderByClientID 测试按客户端订单ID查询订单：订单不存在或未成交即撤销时返回 nil，查询失败时返回错误
+func TestFuturesTrader_GetOrderByClientID(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch id := r.URL.Query().Get("origClientOrderId"); id {
+		case brClientOrderID("filled"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": int64(3001), "symbol": "BTCUSDT", "status": "FILLED", "executedQty": "0.010", "clientOrderId": id})
+		case brClientOrderID("canceled"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": int64(3002), "symbol": "BTCUSDT", "status": "CANCELED", "executedQty": "0", "clientOrderId": id})
+		case brClientOrderID("broken"):
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": -1001, "msg": "Internal error."})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": -2013, "msg": "Order does not exist."})
+		}
+	}))
+	defer mockServer.Close()
+
+	client := futures.NewClient("test_api_key", "test_secret_key")
+	client.BaseURL = mockServer.URL
+	client.HTTPClient = mockServer.Client()
+	trader := &FuturesTrader{client: client}
+
+	order, err := trader.GetOrderByClientID("BTCUSDT", "filled")
+	if assert.NoError(t, err) && assert.NotNil(t, order) {
+		assert.Equal(t, int64(3001), order["orderId"])
+	}
+
+	order, err = trader.GetOrderByClientID("BTCUSDT", "canceled")
+	assert.NoError(t, err)
+	assert.Nil(t, order, "未成交即撤销的订单按不存在处理")
+
+	order, err = trader.GetOrderByClientID("BTCUSDT", "missing")
+	assert.NoError(t, err)
+	assert.Nil(t, order)
+
+	_, err = trader.GetOrderByClientID("BTCUSDT", "broken")
+	assert.Error(t, err)
+}
+
+// TestFuturesTrader_SetPositionMode 测试按配置切换账户持仓模式并读回实际模式：单向持仓下单使用 positionSide=BOTH，
+// 平仓单只减仓；有持仓时切换被拒绝则返回错误和账户实际模式
+func TestFuturesTrader_SetPositionMode(t *testing.T) {
+	var mu sync.Mutex
+	dualSide := true
+	locked := false // 有持仓时币安拒绝切换
+	var orders []url.Values
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/fapi/v1/positionSide/dual" && r.Method == "POST":
+			if locked {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": -4068, "msg": "Position side cannot be changed if there exists position."})
+				return
+			}
+			dualSide = r.FormValue("dualSidePosition") == "true"
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": 200, "msg": "success"})
+
+		case r.URL.Path == "/fapi/v1/positionSide/dual" && r.Method == "GET":
+			json.NewEncoder(w).Encode(map[string]interface{}{"dualSidePosition": dualSide})
+
+		case r.URL.Path == "/fapi/v1/order" && r.Method == "POST":
+			r.ParseForm()
+			orders = append(orders, r.Form)
+			json.NewEncoder(w).Encode(map[string]interface{}{"orderId": int64(3000 + len(orders)), "symbol": r.FormValue("symbol"), "status": "FILLED"})
+
+		default:
+			json.NewEncoder(w).Encode([]interface{}{})
+		}
+	}))
+	defer mockServer.Close()
+
+	client := futures.NewClient("test_api_key", "test_secret_key")
+	client.BaseURL = mockServer.URL
+	client.HTTPClient = mockServer.Client()
+	trader := &FuturesTrader{client: client, cacheDuration: 15 * time.Second}
+
+	actual, err := trader.SetPositionMode(false)
+	assert.NoError(t, err)
+	assert.False(t, actual)
+
+	_, err = trader.CloseLongWithClientID("BTCUSDT", PositionSideLong, 0.01, "close1")
+	assert.NoError(t, err)
+	if assert.Len(t, orders, 1) {
+		assert.Equal(t, "BOTH", orders[0].Get("positionSide"), "单向持仓下单应使用 BOTH")
+		assert.Equal(t, "SELL", orders[0].Get("side"))
+		assert.Equal(t, "true", orders[0].Get("reduceOnly"), "单向持仓的平仓单必须只减仓")
+	}
+
+	// 有持仓时无法切回双向持仓：返回错误，按账户实际的单向持仓下单
+	locked = true
+	actual, err = trader.SetPositionMode(true)
+	assert.Error(t, err)
+	assert.False(t, actual)
+	_, err = trader.CloseShortWithClientID("BTCUSDT", PositionSideShort, 0.01, "close2")
+	assert.NoError(t, err)
+	if assert.Len(t, orders, 2) {
+		assert.Equal(t, "BOTH", orders[1].Get("positionSide"))
+		assert.Equal(t, "BUY", orders[1].Get("side"))
+	}
+
+	// 双向持仓：按 LONG/SHORT 下单，不传 reduceOnly
+	locked = false
+	actual, err = trader.SetPositionMode(true)
+	assert.NoError(t, err)
+	assert.True(t, actual)
+	_, err = trader.CloseLongWithClientID("BTCUSDT", PositionSideLong, 0.01, "close3")
+	assert.NoError(t, err)
+	if assert.Len(t, orders, 3) {
+		assert.Equal(t, "LONG", orders[2].Get("positionSide"))
+		assert.Empty(t, orders[2].Get("reduceOnly"))
+	}
+}
@@ -0,0 +1,273 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+)
+
+const (
+	userStreamKeepaliveInterval = 30 * time.Minute // listenKey 60分钟未续期即失效，每30分钟续期一次
+	userStreamReconnectDelay    = 5 * time.Second  // 首次重连等待
+	userStreamMaxReconnectDelay = 2 * time.Minute  // 重连等待上限（指数退避）
+)
+
+// binanceUserStream 币安合约用户数据流（listenKey），推送 ORDER_TRADE_UPDATE 中的真实成交
+type binanceUserStream struct {
+	handler func(FillEvent)
+
+	// 交易所调用（测试中可替换）
+	startListenKey func() (string, error)
+	keepalive      func(listenKey string) error
+	serve          func(listenKey string, handler futures.WsUserDataHandler, errHandler futures.ErrHandler) (doneC, stopC chan struct{}, err error)
+
+	keepaliveInterval time.Duration
+	reconnectDelay    time.Duration
+	maxReconnectDelay time.Duration
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// newBinanceUserStream 创建用户数据流
+func newBinanceUserStream(client *futures.Client, handler func(FillEvent)) *binanceUserStream {
+	return &binanceUserStream{
+		handler: handler,
+		startListenKey: func() (string, error) {
+			return client.NewStartUserStreamService().Do(context.Background())
+		},
+		keepalive: func(listenKey string) error {
+			return client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(context.Background())
+		},
+		serve:             futures.WsUserDataServe,
+		keepaliveInterval: userStreamKeepaliveInterval,
+		reconnectDelay:    userStreamReconnectDelay,
+		maxReconnectDelay: userStreamMaxReconnectDelay,
+	}
+}
+
+// start 启动后台连接goroutine
+func (s *binanceUserStream) start() {
+	s.stopCh = make(chan struct{})
+	s.wg.Add(1)
+	go s.run()
+}
+
+// stop 停止并等待后台goroutine退出
+func (s *binanceUserStream) stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// run 连接循环：断线、listenKey 过期或续期失败后按指数退避重连
+func (s *binanceUserStream) run() {
+	defer s.wg.Done()
+
+	delay := s.reconnectDelay
+	for {
+		connected, err := s.serveOnce()
+		select {
+		case <-s.stopCh:
+			return
+		default:
+		}
+
+		if connected {
+			delay = s.reconnectDelay // 成功连上过则重置退避
+		}
+		log.Printf("⚠️ 币安用户数据流断开: %v，%v 后重连", err, delay)
+
+		select {
+		case <-s.stopCh:
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > s.maxReconnectDelay {
+			delay = s.maxReconnectDelay
+		}
+	}
+}
+
+// serveOnce 申请 listenKey 并保持一次连接，直到断线、过期、续期失败或停止
+// connected 表示本次是否成功建立过连接
+func (s *binanceUserStream) serveOnce() (connected bool, err error) {
+	listenKey, err := s.startListenKey()
+	if err != nil {
+		return false, fmt.Errorf("获取listenKey失败: %w", err)
+	}
+
+	expiredCh := make(chan struct{}, 1)
+	var errMu sync.Mutex
+	var lastErr error
+
+	doneC, stopC, err := s.serve(listenKey, func(event *futures.WsUserDataEvent) {
+		switch event.Event {
+		case futures.UserDataEventTypeListenKeyExpired:
+			select {
+			case expiredCh <- struct{}{}:
+			default:
+			}
+		case futures.UserDataEventTypeOrderTradeUpdate:
+			if fill, ok := parseBinanceFill(event.OrderTradeUpdate); ok {
+				s.handler(fill)
+			}
+		}
+	}, func(err error) {
+		errMu.Lock()
+		lastErr = err
+		errMu.Unlock()
+	})
+	if err != nil {
+		return false, fmt.Errorf("连接用户数据流失败: %w", err)
+	}
+	log.Printf("🔌 币安用户数据流已连接，开始接收成交推送")
+
+	// disconnect 主动断开并等待连接goroutine退出
+	disconnect := func() {
+		close(stopC)
+		<-doneC
+	}
+
+	ticker := time.NewTicker(s.keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			disconnect()
+			return true, nil
+		case <-doneC:
+			errMu.Lock()
+			defer errMu.Unlock()
+			if lastErr != nil {
+				return true, lastErr
+			}
+			return true, errors.New("连接已关闭")
+		case <-expiredCh:
+			disconnect()
+			return true, errors.New("listenKey 已过期")
+		case <-ticker.C:
+			if err := s.keepalive(listenKey); err != nil {
+				disconnect()
+				return true, fmt.Errorf("listenKey 续期失败: %w", err)
+			}
+		}
+	}
+}
+
+// parseBinanceFill 将 ORDER_TRADE_UPDATE 转换为成交事件（仅处理有成交量的 TRADE 推送）
+func parseBinanceFill(u futures.WsOrderTradeUpdate) (FillEvent, bool) {
+	if u.ExecutionType != futures.OrderExecutionTypeTrade {
+		return FillEvent{}, false
+	}
+	quantity, _ := strconv.ParseFloat(u.LastFilledQty, 64)
+	if quantity <= 0 {
+		return FillEvent{}, false
+	}
+
+	price, _ := strconv.ParseFloat(u.LastFilledPrice, 64)
+	commission, _ := strconv.ParseFloat(u.Commission, 64)
+	realizedPnL, _ := strconv.ParseFloat(u.RealizedPnL, 64)
+
+	fill := FillEvent{
+		Symbol:          u.Symbol,
+		OrderID:         u.ID,
+		ClientOrderID:   u.ClientOrderID,
+		OrderType:       string(u.OriginalType),
+		Price:           price,
+		Quantity:        quantity,
+		Commission:      commission,
+		CommissionAsset: u.CommissionAsset,
+		RealizedPnL:     realizedPnL,
+		Time:            time.UnixMilli(u.TradeTime),
+	}
+
+	// 确定持仓方向和是否为平仓：双向持仓看 positionSide，单向持仓看只减仓标记
+	switch u.PositionSide {
+	case futures.PositionSideTypeLong:
+		fill.Side = "long"
+		fill.IsClose = u.Side == futures.SideTypeSell
+	case futures.PositionSideTypeShort:
+		fill.Side = "short"
+		fill.IsClose = u.Side == futures.SideTypeBuy
+	default:
+		fill.IsClose = u.IsReduceOnly || u.IsClosingPosition || u.OriginalType == futures.OrderTypeLiquidation
+		if (u.Side == futures.SideTypeSell) == fill.IsClose {
+			fill.Side = "long" // 卖出平仓 或 买入开仓
+		} else {
+			fill.Side = "short"
+		}
+	}
+
+	if fill.IsClose {
+		fill.Reason = binanceCloseReason(u)
+	}
+	return fill, true
+}
+
+// binanceCloseReason 根据订单类型和 clientOrderId 判断平仓原因
+func binanceCloseReason(u futures.WsOrderTradeUpdate) string {
+	switch {
+	case u.OriginalType == futures.OrderTypeLiquidation || strings.Contains(u.ClientOrderID, "autoclose"):
+		return "liquidation" // 强平（autoclose-）和自动减仓（adl_autoclose）
+	case u.OriginalType == futures.OrderTypeStopMarket || u.OriginalType == futures.OrderTypeStop || u.OriginalType == futures.OrderTypeTrailingStopMarket:
+		return "stop_loss"
+	case u.OriginalType == futures.OrderTypeTakeProfitMarket || u.OriginalType == futures.OrderTypeTakeProfit:
+		return "take_profit"
+	case strings.HasPrefix(u.ClientOrderID, "x-"+binanceBrID):
+		return "system" // 本系统下的市价平仓单，已由执行器记录
+	default:
+		return "manual"
+	}
+}
+
+// StartFillStream 启动用户数据流成交推送（实现 FillStreamer）
+func (t *FuturesTrader) StartFillStream(handler func(FillEvent)) error {
+	t.userStreamMutex.Lock()
+	defer t.userStreamMutex.Unlock()
+
+	if t.userStream != nil {
+		return nil
+	}
+
+	t.userStream = newBinanceUserStream(t.client, func(fill FillEvent) {
+		// 成交后持仓/余额已变化，清除缓存保证下次对账拿到最新数据
+		t.invalidateAccountCache()
+		handler(fill)
+	})
+	t.userStream.start()
+	return nil
+}
+
+// StopFillStream 停止用户数据流
+func (t *FuturesTrader) StopFillStream() {
+	t.userStreamMutex.Lock()
+	defer t.userStreamMutex.Unlock()
+
+	if t.userStream == nil {
+		return
+	}
+	t.userStream.stop()
+	t.userStream = nil
+	log.Printf("🔌 币安用户数据流已停止")
+}
+
+// invalidateAccountCache 清除余额和持仓缓存
+func (t *FuturesTrader) invalidateAccountCache() {
+	t.balanceCacheMutex.Lock()
+	t.cachedBalance = nil
+	t.balanceCacheMutex.Unlock()
+
+	t.positionsCacheMutex.Lock()
+	t.cachedPositions = nil
+	t.positionsCacheMutex.Unlock()
+}
@@ -0,0 +1,199 @@
+package trader
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseBinanceFill 测试 ORDER_TRADE_UPDATE 到成交事件的转换
+func TestParseBinanceFill(t *testing.T) {
+	base := futures.WsOrderTradeUpdate{
+		Symbol:          "BTCUSDT",
+		ExecutionType:   futures.OrderExecutionTypeTrade,
+		ID:              42,
+		LastFilledQty:   "0.010",
+		LastFilledPrice: "48990.5",
+		Commission:      "0.19596",
+		CommissionAsset: "USDT",
+		RealizedPnL:     "-10.1",
+		TradeTime:       1700000000000,
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(u *futures.WsOrderTradeUpdate)
+		wantOK      bool
+		wantSide    string
+		wantIsClose bool
+		wantReason  string
+	}{
+		{
+			name: "多仓止损触发",
+			modify: func(u *futures.WsOrderTradeUpdate) {
+				u.Side, u.PositionSide, u.OriginalType = futures.SideTypeSell, futures.PositionSideTypeLong, futures.OrderTypeStopMarket
+			},
+			wantOK: true, wantSide: "long", wantIsClose: true, wantReason: "stop_loss",
+		},
+		{
+			name: "空仓止盈触发",
+			modify: func(u *futures.WsOrderTradeUpdate) {
+				u.Side, u.PositionSide, u.OriginalType = futures.SideTypeBuy, futures.PositionSideTypeShort, futures.OrderTypeTakeProfitMarket
+			},
+			wantOK: true, wantSide: "short", wantIsClose: true, wantReason: "take_profit",
+		},
+		{
+			name: "强平",
+			modify: func(u *futures.WsOrderTradeUpdate) {
+				u.Side, u.PositionSide, u.OriginalType = futures.SideTypeSell, futures.PositionSideTypeLong, futures.OrderTypeLiquidation
+				u.ClientOrderID = "autoclose-1700000000000"
+			},
+			wantOK: true, wantSide: "long", wantIsClose: true, wantReason: "liquidation",
+		},
+		{
+			name: "本系统市价平仓",
+			modify: func(u *futures.WsOrderTradeUpdate) {
+				u.Side, u.PositionSide, u.OriginalType = futures.SideTypeSell, futures.PositionSideTypeLong, futures.OrderTypeMarket
+				u.ClientOrderID = getBrOrderID()
+			},
+			wantOK: true, wantSide: "long", wantIsClose: true, wantReason: "system",
+		},
+		{
+			name: "交易所界面手动平仓",
+			modify: func(u *futures.WsOrderTradeUpdate) {
+				u.Side, u.PositionSide, u.OriginalType = futures.SideTypeBuy, futures.PositionSideTypeShort, futures.OrderTypeMarket
+				u.ClientOrderID = "web_abc123"
+			},
+			wantOK: true, wantSide: "short", wantIsClose: true, wantReason: "manual",
+		},
+		{
+			name: "开仓成交",
+			modify: func(u *futures.WsOrderTradeUpdate) {
+				u.Side, u.PositionSide, u.OriginalType = futures.SideTypeBuy, futures.PositionSideTypeLong, futures.OrderTypeMarket
+			},
+			wantOK: true, wantSide: "long", wantIsClose: false,
+		},
+		{
+			name: "单向持仓_只减仓卖出",
+			modify: func(u *futures.WsOrderTradeUpdate) {
+				u.Side, u.PositionSide, u.OriginalType, u.IsReduceOnly = futures.SideTypeSell, futures.PositionSideTypeBoth, futures.OrderTypeMarket, true
+			},
+			wantOK: true, wantSide: "long", wantIsClose: true, wantReason: "manual",
+		},
+		{
+			name: "单向持仓_卖出开空",
+			modify: func(u *futures.WsOrderTradeUpdate) {
+				u.Side, u.PositionSide, u.OriginalType = futures.SideTypeSell, futures.PositionSideTypeBoth, futures.OrderTypeMarket
+			},
+			wantOK: true, wantSide: "short", wantIsClose: false,
+		},
+		{
+			name: "非成交推送（新订单）",
+			modify: func(u *futures.WsOrderTradeUpdate) {
+				u.ExecutionType = futures.OrderExecutionTypeNew
+			},
+			wantOK: false,
+		},
+		{
+			name: "成交量为0",
+			modify: func(u *futures.WsOrderTradeUpdate) {
+				u.LastFilledQty = "0"
+			},
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := base
+			tt.modify(&u)
+
+			fill, ok := parseBinanceFill(u)
+			assert.Equal(t, tt.wantOK, ok)
+			if !ok {
+				return
+			}
+			assert.Equal(t, tt.wantSide, fill.Side)
+			assert.Equal(t, tt.wantIsClose, fill.IsClose)
+			assert.Equal(t, tt.wantReason, fill.Reason)
+			assert.Equal(t, 0.01, fill.Quantity)
+			assert.Equal(t, 48990.5, fill.Price)
+			assert.Equal(t, 0.19596, fill.Commission)
+			assert.Equal(t, -10.1, fill.RealizedPnL)
+			assert.Equal(t, int64(42), fill.OrderID)
+			assert.Equal(t, int64(1700000000000), fill.Time.UnixMilli())
+		})
+	}
+}
+
+// TestBinanceUserStream_KeepaliveAndReconnect 测试成交推送、listenKey 续期以及过期后重新申请 listenKey 重连
+func TestBinanceUserStream_KeepaliveAndReconnect(t *testing.T) {
+	var mu sync.Mutex
+	var listenKeys, keepalives []string
+	fills := make(chan FillEvent, 10)
+
+	stream := &binanceUserStream{
+		handler:           func(fill FillEvent) { fills <- fill },
+		keepaliveInterval: 10 * time.Millisecond,
+		reconnectDelay:    5 * time.Millisecond,
+		maxReconnectDelay: 20 * time.Millisecond,
+	}
+	stream.startListenKey = func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := []string{"key-1", "key-2"}[min(len(listenKeys), 1)]
+		listenKeys = append(listenKeys, key)
+		return key, nil
+	}
+	stream.keepalive = func(listenKey string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		keepalives = append(keepalives, listenKey)
+		return nil
+	}
+	stream.serve = func(listenKey string, handler futures.WsUserDataHandler, errHandler futures.ErrHandler) (chan struct{}, chan struct{}, error) {
+		doneC, stopC := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(doneC)
+			if listenKey == "key-1" {
+				event := &futures.WsUserDataEvent{Event: futures.UserDataEventTypeOrderTradeUpdate}
+				event.OrderTradeUpdate = futures.WsOrderTradeUpdate{
+					Symbol: "BTCUSDT", ExecutionType: futures.OrderExecutionTypeTrade, Side: futures.SideTypeSell,
+					PositionSide: futures.PositionSideTypeLong, OriginalType: futures.OrderTypeStopMarket,
+					LastFilledQty: "0.5", LastFilledPrice: "49000",
+				}
+				handler(event)
+				time.Sleep(30 * time.Millisecond) // 期间至少续期一次
+				handler(&futures.WsUserDataEvent{Event: futures.UserDataEventTypeListenKeyExpired})
+			}
+			<-stopC
+		}()
+		return doneC, stopC, nil
+	}
+
+	stream.start()
+
+	select {
+	case fill := <-fills:
+		assert.Equal(t, "BTCUSDT", fill.Symbol)
+		assert.Equal(t, "stop_loss", fill.Reason)
+	case <-time.After(time.Second):
+		t.Fatal("未收到成交推送")
+	}
+
+	// 等待过期后用新 listenKey 重连并续期
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(listenKeys) >= 2 && len(keepalives) > 0 && keepalives[len(keepalives)-1] == "key-2"
+	}, time.Second, 5*time.Millisecond)
+
+	stream.stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "key-1", keepalives[0], "过期前应续期原 listenKey")
+}
@@ -0,0 +1,806 @@
+package trader
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bybitMainnetURL  = "https://api.bybit.com"
+	bybitTestnetURL  = "https://api-testnet.bybit.com"
+	bybitRecvWindow  = "5000"
+	bybitCategory    = "linear" // USDT 永续合约
+	bybitStopLossTag = "nofx-sl-"
+	bybitTakeProfTag = "nofx-tp-"
+)
+
+// Bybit 业务错误码（HTTP 200 但 retCode 非0）
+const (
+	bybitCodeLeverageNotModified   = 110043 // 杠杆未变化
+	bybitCodeMarginModeNotModified = 110026 // 仓位模式未变化
+	bybitCodeRateLimited           = 10006  // 请求频率超限
+	bybitCodeInsufficientBalance   = 110004 // 钱包余额不足
+	bybitCodeInsufficientAvailable = 110007 // 可用余额不足
+	bybitCodeReduceOnlyNoPosition  = 110017 // 只减仓订单：当前持仓为0
+	bybitCodeMinOrderValue         = 110094 // 订单价值低于最小值
+)
+
+// BybitTrader Bybit USDT永续合约交易器（v5 API）
+// 使用单向持仓（positionIdx=0），止盈止损以条件单实现，通过 orderLinkId 前缀区分止损/止盈
+type BybitTrader struct {
+	apiKey    string
+	secretKey string
+	client    *http.Client
+	baseURL   string
+
+	// 缓存交易对规则
+	instruments map[string]bybitInstrument
+	leverages   map[string]int // 各币种最近一次设置的杠杆（切换仓位模式时沿用）
+	mu          sync.RWMutex
+}
+
+// bybitInstrument 交易对下单规则
+type bybitInstrument struct {
+	TickSize    float64
+	QtyStep     float64
+	MinQty      float64
+	MinNotional float64
+}
+
+// bybitResponse v5 API 统一响应结构
+type bybitResponse struct {
+	RetCode int             `json:"retCode"`
+	RetMsg  string          `json:"retMsg"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// bybitAPIError Bybit 业务错误
+type bybitAPIError struct {
+	Code int
+	Msg  string
+}
+
+func (e *bybitAPIError) Error() string {
+	return fmt.Sprintf("bybit API错误 (retCode=%d): %s", e.Code, e.Msg)
+}
+
+// Unwrap 按错误码返回对应的错误类型，供 errors.Is 判断（未知错误码返回 nil）
+func (e *bybitAPIError) Unwrap() error {
+	switch e.Code {
+	case bybitCodeRateLimited:
+		return ErrRateLimited
+	case bybitCodeInsufficientBalance, bybitCodeInsufficientAvailable:
+		return ErrInsufficientMargin
+	case bybitCodeReduceOnlyNoPosition:
+		return ErrPositionNotFound
+	case bybitCodeMinOrderValue:
+		return ErrMinNotional
+	}
+	return nil
+}
+
+// NewBybitTrader 创建Bybit交易器
+func NewBybitTrader(apiKey, secretKey string, testnet bool) *BybitTrader {
+	baseURL := bybitMainnetURL
+	if testnet {
+		baseURL = bybitTestnetURL
+	}
+
+	return &BybitTrader{
+		apiKey:    apiKey,
+		secretKey: secretKey,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Second,
+				IdleConnTimeout:       90 * time.Second,
+			},
+		},
+		baseURL:     baseURL,
+		instruments: make(map[string]bybitInstrument),
+		leverages:   make(map[string]int),
+	}
+}
+
+// sign 生成签名：HMAC_SHA256(timestamp + apiKey + recvWindow + queryString/jsonBody)
+func (t *BybitTrader) sign(timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(t.secretKey))
+	mac.Write([]byte(timestamp + t.apiKey + bybitRecvWindow + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// request 发送请求并解析 result 字段
+// GET 参数放在 querystring 中，POST 参数以 JSON body 发送；signed=false 时不附带签名头（公共行情接口）
+func (t *BybitTrader) request(method, endpoint string, params map[string]interface{}, signed bool) (json.RawMessage, error) {
+	var (
+		req     *http.Request
+		payload string
+		err     error
+	)
+
+	switch method {
+	case http.MethodGet:
+		q := url.Values{}
+		for k, v := range params {
+			q.Set(k, fmt.Sprintf("%v", v))
+		}
+		payload = q.Encode()
+		fullURL := t.baseURL + endpoint
+		if payload != "" {
+			fullURL += "?" + payload
+		}
+		req, err = http.NewRequest(http.MethodGet, fullURL, nil)
+	case http.MethodPost:
+		body, marshalErr := json.Marshal(params)
+		if marshalErr != nil {
+			return nil, marshalErr
+		}
+		payload = string(body)
+		req, err = http.NewRequest(http.MethodPost, t.baseURL+endpoint, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	default:
+		return nil, fmt.Errorf("不支持的HTTP方法: %s", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if signed {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		req.Header.Set("X-BAPI-API-KEY", t.apiKey)
+		req.Header.Set("X-BAPI-TIMESTAMP", timestamp)
+		req.Header.Set("X-BAPI-RECV-WINDOW", bybitRecvWindow)
+		req.Header.Set("X-BAPI-SIGN", t.sign(timestamp, payload))
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+		// Bybit 频率超限时返回 403（IP 级）或 429
+		return nil, fmt.Errorf("%w: HTTP %d: %s", ErrRateLimited, resp.StatusCode, string(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result bybitResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	if result.RetCode != 0 {
+		return nil, &bybitAPIError{Code: result.RetCode, Msg: result.RetMsg}
+	}
+	return result.Result, nil
+}
+
+// isBybitCode 判断错误是否为指定的 Bybit 业务错误码
+func isBybitCode(err error, code int) bool {
+	apiErr, ok := err.(*bybitAPIError)
+	return ok && apiErr.Code == code
+}
+
+// parseBybitFloat 解析 Bybit 返回的字符串数值（空字符串视为0）
+func parseBybitFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+// getInstrument 获取交易对规则（带缓存）
+func (t *BybitTrader) getInstrument(symbol string) (bybitInstrument, error) {
+	t.mu.RLock()
+	if inst, ok := t.instruments[symbol]; ok {
+		t.mu.RUnlock()
+		return inst, nil
+	}
+	t.mu.RUnlock()
+
+	raw, err := t.request(http.MethodGet, "/v5/market/instruments-info", map[string]interface{}{
+		"category": bybitCategory,
+		"symbol":   symbol,
+	}, false)
+	if err != nil {
+		return bybitInstrument{}, err
+	}
+
+	var result struct {
+		List []struct {
+			Symbol      string `json:"symbol"`
+			PriceFilter struct {
+				TickSize string `json:"tickSize"`
+			} `json:"priceFilter"`
+			LotSizeFilter struct {
+				QtyStep          string `json:"qtyStep"`
+				MinOrderQty      string `json:"minOrderQty"`
+				MinNotionalValue string `json:"minNotionalValue"`
+			} `json:"lotSizeFilter"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return bybitInstrument{}, err
+	}
+
+	for _, item := range result.List {
+		if item.Symbol != symbol {
+			continue
+		}
+		inst := bybitInstrument{
+			TickSize:    parseBybitFloat(item.PriceFilter.TickSize),
+			QtyStep:     parseBybitFloat(item.LotSizeFilter.QtyStep),
+			MinQty:      parseBybitFloat(item.LotSizeFilter.MinOrderQty),
+			MinNotional: parseBybitFloat(item.LotSizeFilter.MinNotionalValue),
+		}
+		t.mu.Lock()
+		t.instruments[symbol] = inst
+		t.mu.Unlock()
+		return inst, nil
+	}
+
+	return bybitInstrument{}, fmt.Errorf("未找到交易对 %s 的规则信息", symbol)
+}
+
+// formatStep 按步进值格式化数值（小数位数与步进值一致）
+func formatStep(value, step float64) string {
+	if step <= 0 {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	rounded := roundToTickSize(value, step)
+	precision := calculatePrecision(strconv.FormatFloat(step, 'f', -1, 64))
+	return strconv.FormatFloat(rounded, 'f', precision, 64)
+}
+
+// formatQty 格式化下单数量
+func (t *BybitTrader) formatQty(symbol string, quantity float64) (string, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return "", err
+	}
+	return formatStep(quantity, inst.QtyStep), nil
+}
+
+// formatPrice 格式化价格
+func (t *BybitTrader) formatPrice(symbol string, price float64) (string, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return "", err
+	}
+	return formatStep(price, inst.TickSize), nil
+}
+
+// GetBalance 获取账户余额（统一账户）
+func (t *BybitTrader) GetBalance() (map[string]interface{}, error) {
+	raw, err := t.request(http.MethodGet, "/v5/account/wallet-balance", map[string]interface{}{
+		"accountType": "UNIFIED",
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		List []struct {
+			TotalWalletBalance    string `json:"totalWalletBalance"`
+			TotalAvailableBalance string `json:"totalAvailableBalance"`
+			TotalPerpUPL          string `json:"totalPerpUPL"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	if len(result.List) == 0 {
+		return nil, fmt.Errorf("未获取到Bybit账户余额")
+	}
+
+	account := result.List[0]
+	return map[string]interface{}{
+		"totalWalletBalance":    parseBybitFloat(account.TotalWalletBalance),
+		"availableBalance":      parseBybitFloat(account.TotalAvailableBalance),
+		"totalUnrealizedProfit": parseBybitFloat(account.TotalPerpUPL),
+	}, nil
+}
+
+// GetPositions 获取所有持仓（返回与Binance相同的字段名）
+func (t *BybitTrader) GetPositions() ([]map[string]interface{}, error) {
+	raw, err := t.request(http.MethodGet, "/v5/position/list", map[string]interface{}{
+		"category":   bybitCategory,
+		"settleCoin": "USDT",
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		List []struct {
+			Symbol        string `json:"symbol"`
+			Side          string `json:"side"` // Buy / Sell / 空字符串(无持仓)
+			Size          string `json:"size"`
+			AvgPrice      string `json:"avgPrice"`
+			MarkPrice     string `json:"markPrice"`
+			UnrealisedPnl string `json:"unrealisedPnl"`
+			Leverage      string `json:"leverage"`
+			LiqPrice      string `json:"liqPrice"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+
+	positions := []map[string]interface{}{}
+	for _, pos := range result.List {
+		size := parseBybitFloat(pos.Size)
+		if size == 0 {
+			continue // 跳过空仓位
+		}
+
+		side := "long"
+		positionAmt := size
+		if pos.Side == "Sell" {
+			side = "short"
+			positionAmt = -size
+		}
+
+		positions = append(positions, map[string]interface{}{
+			"symbol":           pos.Symbol,
+			"side":             side,
+			"positionAmt":      positionAmt,
+			"entryPrice":       parseBybitFloat(pos.AvgPrice),
+			"markPrice":        parseBybitFloat(pos.MarkPrice),
+			"unRealizedProfit": parseBybitFloat(pos.UnrealisedPnl),
+			"leverage":         parseBybitFloat(pos.Leverage),
+			"liquidationPrice": parseBybitFloat(pos.LiqPrice),
+		})
+	}
+
+	return positions, nil
+}
+
+// placeOrder 下单（市价单；triggerPrice>0 时为条件单）
+func (t *BybitTrader) placeOrder(params map[string]interface{}) (map[string]interface{}, error) {
+	params["category"] = bybitCategory
+	params["positionIdx"] = 0 // 单向持仓
+
+	raw, err := t.request(http.MethodPost, "/v5/order/create", params, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		OrderID     string `json:"orderId"`
+		OrderLinkID string `json:"orderLinkId"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"orderId":     result.OrderID,
+		"orderLinkId": result.OrderLinkID,
+		"symbol":      params["symbol"],
+	}, nil
+}
+
+// openPosition 开仓通用逻辑
+func (t *BybitTrader) openPosition(symbol, side string, quantity float64, leverage int) (map[string]interface{}, error) {
+	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
+	}
+
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, fmt.Errorf("设置杠杆失败: %w", err)
+	}
+
+	qtyStr, err := t.formatQty(symbol, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.placeOrder(map[string]interface{}{
+		"symbol":    symbol,
+		"side":      side,
+		"orderType": "Market",
+		"qty":       qtyStr,
+	})
+}
+
+// closePosition 平仓通用逻辑（quantity=0 表示全部平仓）
+func (t *BybitTrader) closePosition(symbol, positionSide string, quantity float64) (map[string]interface{}, error) {
+	if quantity == 0 {
+		positions, err := t.GetPositions()
+		if err != nil {
+			return nil, err
+		}
+		for _, pos := range positions {
+			if pos["symbol"] == symbol && pos["side"] == positionSide {
+				amt, _ := asFloat(pos["positionAmt"])
+				quantity = math.Abs(amt)
+				break
+			}
+		}
+		if quantity == 0 {
+			sideCN := "多仓"
+			if positionSide == "short" {
+				sideCN = "空仓"
+			}
+			return nil, fmt.Errorf("%w: %s %s", ErrPositionNotFound, symbol, sideCN)
+		}
+	}
+
+	qtyStr, err := t.formatQty(symbol, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	side := "Sell"
+	if positionSide == "short" {
+		side = "Buy"
+	}
+
+	result, err := t.placeOrder(map[string]interface{}{
+		"symbol":     symbol,
+		"side":       side,
+		"orderType":  "Market",
+		"qty":        qtyStr,
+		"reduceOnly": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 平仓后取消该币种的所有挂单(止损止盈单)
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消挂单失败: %v", err)
+	}
+
+	return result, nil
+}
+
+// OpenLong 开多仓（Bybit 使用单向持仓，忽略 positionSide 参数）
+func (t *BybitTrader) OpenLong(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	result, err := t.openPosition(symbol, "Buy", quantity, leverage)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✓ 开多仓成功: %s 数量: %.8f", symbol, quantity)
+	return result, nil
+}
+
+// OpenShort 开空仓
+func (t *BybitTrader) OpenShort(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	result, err := t.openPosition(symbol, "Sell", quantity, leverage)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✓ 开空仓成功: %s 数量: %.8f", symbol, quantity)
+	return result, nil
+}
+
+// CloseLong 平多仓（quantity=0表示全部平仓）
+func (t *BybitTrader) CloseLong(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
+	result, err := t.closePosition(symbol, "long", quantity)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✓ 平多仓成功: %s", symbol)
+	return result, nil
+}
+
+// CloseShort 平空仓（quantity=0表示全部平仓）
+func (t *BybitTrader) CloseShort(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
+	result, err := t.closePosition(symbol, "short", quantity)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✓ 平空仓成功: %s", symbol)
+	return result, nil
+}
+
+// SetLeverage 设置杠杆（多空同时设置）
+func (t *BybitTrader) SetLeverage(symbol string, leverage int) error {
+	_, err := t.request(http.MethodPost, "/v5/position/set-leverage", map[string]interface{}{
+		"category":     bybitCategory,
+		"symbol":       symbol,
+		"buyLeverage":  strconv.Itoa(leverage),
+		"sellLeverage": strconv.Itoa(leverage),
+	}, true)
+	if err != nil && !isBybitCode(err, bybitCodeLeverageNotModified) {
+		return err
+	}
+
+	t.mu.Lock()
+	if t.leverages == nil {
+		t.leverages = make(map[string]int)
+	}
+	t.leverages[symbol] = leverage
+	t.mu.Unlock()
+	return nil
+}
+
+// symbolLeverage 币种当前杠杆：优先使用最近一次 SetLeverage 设置的值，未设置过时查询交易所
+func (t *BybitTrader) symbolLeverage(symbol string) (int, error) {
+	t.mu.RLock()
+	leverage, ok := t.leverages[symbol]
+	t.mu.RUnlock()
+	if ok {
+		return leverage, nil
+	}
+
+	raw, err := t.request(http.MethodGet, "/v5/position/list", map[string]interface{}{
+		"category": bybitCategory,
+		"symbol":   symbol,
+	}, true)
+	if err != nil {
+		return 0, err
+	}
+	var result struct {
+		List []struct {
+			Symbol   string `json:"symbol"`
+			Leverage string `json:"leverage"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return 0, err
+	}
+	for _, pos := range result.List {
+		if pos.Symbol == symbol {
+			if leverage := int(parseBybitFloat(pos.Leverage)); leverage > 0 {
+				return leverage, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("交易所未返回 %s 的杠杆", symbol)
+}
+
+// SetMarginMode 设置仓位模式 (true=全仓, false=逐仓)
+// Bybit 切换时必须同时提交杠杆：沿用该币种当前杠杆，不改变交易员配置的杠杆；仓位模式未变化以外的错误都返回给调用方
+func (t *BybitTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
+	tradeMode := 0
+	marginType := "全仓"
+	if !isCrossMargin {
+		tradeMode = 1
+		marginType = "逐仓"
+	}
+
+	leverage, err := t.symbolLeverage(symbol)
+	if err != nil {
+		return fmt.Errorf("获取 %s 当前杠杆失败: %w", symbol, err)
+	}
+
+	_, err = t.request(http.MethodPost, "/v5/position/switch-isolated", map[string]interface{}{
+		"category":     bybitCategory,
+		"symbol":       symbol,
+		"tradeMode":    tradeMode,
+		"buyLeverage":  strconv.Itoa(leverage),
+		"sellLeverage": strconv.Itoa(leverage),
+	}, true)
+	if err != nil {
+		if isBybitCode(err, bybitCodeMarginModeNotModified) {
+			log.Printf("  ✓ %s 仓位模式已是 %s", symbol, marginType)
+			return nil
+		}
+		return fmt.Errorf("设置仓位模式失败（统一账户请在交易所设置账户级保证金模式）: %w", err)
+	}
+
+	log.Printf("  ✓ %s 仓位模式已设置为 %s", symbol, marginType)
+	return nil
+}
+
+// GetMarketPrice 获取市场价格
+func (t *BybitTrader) GetMarketPrice(symbol string) (float64, error) {
+	raw, err := t.request(http.MethodGet, "/v5/market/tickers", map[string]interface{}{
+		"category": bybitCategory,
+		"symbol":   symbol,
+	}, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		List []struct {
+			Symbol    string `json:"symbol"`
+			LastPrice string `json:"lastPrice"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return 0, err
+	}
+	if len(result.List) == 0 {
+		return 0, fmt.Errorf("未获取到 %s 的价格", symbol)
+	}
+
+	return strconv.ParseFloat(result.List[0].LastPrice, 64)
+}
+
+// placeTriggerOrder 下只减仓的条件市价单（止损/止盈）
+// triggerDirection: 1=价格上涨至触发价, 2=价格下跌至触发价
+func (t *BybitTrader) placeTriggerOrder(symbol, positionSide string, quantity, triggerPrice float64, isStopLoss bool) error {
+	side := "Sell"
+	if positionSide == PositionSideShort {
+		side = "Buy"
+	}
+
+	// 多头止损/空头止盈为下跌触发，多头止盈/空头止损为上涨触发
+	triggerDirection := 1
+	if (positionSide == PositionSideShort) != isStopLoss {
+		triggerDirection = 2
+	}
+
+	tag := bybitTakeProfTag
+	if isStopLoss {
+		tag = bybitStopLossTag
+	}
+
+	qtyStr, err := t.formatQty(symbol, quantity)
+	if err != nil {
+		return err
+	}
+	priceStr, err := t.formatPrice(symbol, triggerPrice)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.placeOrder(map[string]interface{}{
+		"symbol":           symbol,
+		"side":             side,
+		"orderType":        "Market",
+		"qty":              qtyStr,
+		"triggerPrice":     priceStr,
+		"triggerDirection": triggerDirection,
+		"triggerBy":        "MarkPrice",
+		"reduceOnly":       true,
+		"closeOnTrigger":   true,
+		"orderLinkId":      fmt.Sprintf("%s%d", tag, time.Now().UnixNano()),
+	})
+	return err
+}
+
+// SetStopLoss 设置止损单
+func (t *BybitTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+	return t.placeTriggerOrder(symbol, positionSide, quantity, stopPrice, true)
+}
+
+// SetTakeProfit 设置止盈单
+func (t *BybitTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	return t.placeTriggerOrder(symbol, positionSide, quantity, takeProfitPrice, false)
+}
+
+// bybitOrder 未成交订单
+type bybitOrder struct {
+	OrderID       string `json:"orderId"`
+	OrderLinkID   string `json:"orderLinkId"`
+	StopOrderType string `json:"stopOrderType"`
+}
+
+// isStopLoss 是否为止损单（优先按 orderLinkId 前缀判断，兼容交易所界面设置的止损）
+func (o bybitOrder) isStopLoss() bool {
+	return strings.HasPrefix(o.OrderLinkID, bybitStopLossTag) || o.StopOrderType == "StopLoss"
+}
+
+// isTakeProfit 是否为止盈单
+func (o bybitOrder) isTakeProfit() bool {
+	return strings.HasPrefix(o.OrderLinkID, bybitTakeProfTag) || o.StopOrderType == "TakeProfit"
+}
+
+// getStopOrders 获取该币种的未触发条件单
+func (t *BybitTrader) getStopOrders(symbol string) ([]bybitOrder, error) {
+	raw, err := t.request(http.MethodGet, "/v5/order/realtime", map[string]interface{}{
+		"category":    bybitCategory,
+		"symbol":      symbol,
+		"orderFilter": "StopOrder",
+	}, true)
+	if err != nil {
+		return nil, fmt.Errorf("获取未完成订单失败: %w", err)
+	}
+
+	var result struct {
+		List []bybitOrder `json:"list"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("解析订单数据失败: %w", err)
+	}
+	return result.List, nil
+}
+
+// cancelStopOrdersWhere 取消满足条件的条件单
+func (t *BybitTrader) cancelStopOrdersWhere(symbol, kind string, match func(bybitOrder) bool) error {
+	orders, err := t.getStopOrders(symbol)
+	if err != nil {
+		return err
+	}
+
+	canceledCount := 0
+	var cancelErrors []error
+	for _, order := range orders {
+		if !match(order) {
+			continue
+		}
+
+		_, err := t.request(http.MethodPost, "/v5/order/cancel", map[string]interface{}{
+			"category": bybitCategory,
+			"symbol":   symbol,
+			"orderId":  order.OrderID,
+		}, true)
+		if err != nil {
+			cancelErrors = append(cancelErrors, fmt.Errorf("订单ID %s: %w", order.OrderID, err))
+			log.Printf("  ⚠ 取消%s失败 (订单ID: %s): %v", kind, order.OrderID, err)
+			continue
+		}
+		canceledCount++
+	}
+
+	if canceledCount == 0 && len(cancelErrors) == 0 {
+		log.Printf("  ℹ %s 没有%s需要取消", symbol, kind)
+	} else if canceledCount > 0 {
+		log.Printf("  ✓ 已取消 %s 的 %d 个%s", symbol, canceledCount, kind)
+	}
+
+	// 如果所有取消都失败了，返回错误
+	if len(cancelErrors) > 0 && canceledCount == 0 {
+		return fmt.Errorf("取消%s失败: %v", kind, cancelErrors)
+	}
+	return nil
+}
+
+// CancelStopLossOrders 仅取消止损单（不影响止盈单）
+func (t *BybitTrader) CancelStopLossOrders(symbol string) error {
+	return t.cancelStopOrdersWhere(symbol, "止损单", bybitOrder.isStopLoss)
+}
+
+// CancelTakeProfitOrders 仅取消止盈单（不影响止损单）
+func (t *BybitTrader) CancelTakeProfitOrders(symbol string) error {
+	return t.cancelStopOrdersWhere(symbol, "止盈单", bybitOrder.isTakeProfit)
+}
+
+// CancelStopOrders 取消该币种的止盈/止损单（用于调整止盈止损位置）
+func (t *BybitTrader) CancelStopOrders(symbol string) error {
+	return t.cancelStopOrdersWhere(symbol, "止盈/止损单", func(o bybitOrder) bool {
+		return o.isStopLoss() || o.isTakeProfit()
+	})
+}
+
+// CancelAllOrders 取消该币种的所有挂单（包括条件单）
+func (t *BybitTrader) CancelAllOrders(symbol string) error {
+	_, err := t.request(http.MethodPost, "/v5/order/cancel-all", map[string]interface{}{
+		"category": bybitCategory,
+		"symbol":   symbol,
+	}, true)
+	return err
+}
+
+// FormatQuantity 格式化数量到正确的精度
+func (t *BybitTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
+	return t.formatQty(symbol, quantity)
+}
+
+// FormatPrice 按 tick size 格式化价格
+func (t *BybitTrader) FormatPrice(symbol string, price float64) (string, error) {
+	return t.formatPrice(symbol, price)
+}
+
+// GetSymbolFilters 获取交易对的数量步进值和最小名义价值
+func (t *BybitTrader) GetSymbolFilters(symbol string) (SymbolFilters, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return SymbolFilters{}, err
+	}
+	return SymbolFilters{StepSize: inst.QtyStep, MinNotional: inst.MinNotional}, nil
+}
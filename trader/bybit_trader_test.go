@@ -0,0 +1,294 @@
+package trader
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ============================================================
+// 一、BybitTraderTestSuite - 继承 base test suite
+// ============================================================
+
+// BybitTraderTestSuite Bybit交易器测试套件
+type BybitTraderTestSuite struct {
+	*TraderTestSuite
+	mockServer *httptest.Server
+
+	mu           sync.Mutex
+	createOrders []map[string]interface{} // 记录 /v5/order/create 请求
+	cancelOrders []string                 // 记录 /v5/order/cancel 的订单ID
+	switchModes  []map[string]interface{} // 记录 /v5/position/switch-isolated 请求
+	switchCode   int                      // 非 0 时 switch-isolated 返回该错误码（默认返回仓位模式未变化）
+}
+
+// NewBybitTraderTestSuite 创建 Bybit 测试套件
+func NewBybitTraderTestSuite(t *testing.T) *BybitTraderTestSuite {
+	s := &BybitTraderTestSuite{}
+
+	s.mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 私有接口必须带签名头
+		if strings.HasPrefix(r.URL.Path, "/v5/account") || strings.HasPrefix(r.URL.Path, "/v5/position") || strings.HasPrefix(r.URL.Path, "/v5/order") {
+			if r.Header.Get("X-BAPI-SIGN") == "" || r.Header.Get("X-BAPI-API-KEY") != "test-key" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"retCode": 10004, "retMsg": "error sign!"})
+				return
+			}
+		}
+
+		var params map[string]interface{}
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &params)
+		}
+
+		retCode := 0
+		retMsg := "OK"
+		var result interface{} = map[string]interface{}{}
+
+		switch r.URL.Path {
+		case "/v5/account/wallet-balance":
+			result = map[string]interface{}{
+				"list": []map[string]interface{}{
+					{"totalWalletBalance": "10000", "totalAvailableBalance": "8000", "totalPerpUPL": "100.5"},
+				},
+			}
+
+		case "/v5/position/list":
+			result = map[string]interface{}{
+				"list": []map[string]interface{}{
+					{"symbol": "BTCUSDT", "side": "Buy", "size": "0.5", "avgPrice": "50000", "markPrice": "50500", "unrealisedPnl": "250", "leverage": "10", "liqPrice": "45000"},
+					{"symbol": "SOLUSDT", "side": "", "size": "0", "avgPrice": "0", "markPrice": "150", "unrealisedPnl": "0", "leverage": "10", "liqPrice": ""},
+				},
+			}
+
+		case "/v5/market/tickers":
+			symbol := r.URL.Query().Get("symbol")
+			prices := map[string]string{"BTCUSDT": "50000", "ETHUSDT": "3000"}
+			if price, ok := prices[symbol]; ok {
+				result = map[string]interface{}{"list": []map[string]interface{}{{"symbol": symbol, "lastPrice": price}}}
+			} else {
+				retCode, retMsg = 10001, "params error: symbol invalid"
+			}
+
+		case "/v5/market/instruments-info":
+			symbol := r.URL.Query().Get("symbol")
+			result = map[string]interface{}{
+				"list": []map[string]interface{}{
+					{
+						"symbol":        symbol,
+						"priceFilter":   map[string]interface{}{"tickSize": "0.10"},
+						"lotSizeFilter": map[string]interface{}{"qtyStep": "0.001", "minOrderQty": "0.001", "minNotionalValue": "5"},
+					},
+				},
+			}
+
+		case "/v5/position/set-leverage":
+			retCode, retMsg = bybitCodeLeverageNotModified, "leverage not modified"
+
+		case "/v5/position/switch-isolated":
+			s.mu.Lock()
+			s.switchModes = append(s.switchModes, params)
+			code := s.switchCode
+			s.mu.Unlock()
+			switch code {
+			case 0:
+				retCode, retMsg = bybitCodeMarginModeNotModified, "Cross/isolated margin mode is not modified"
+			case -1:
+				// 切换成功
+			default:
+				retCode, retMsg = code, "switch failed"
+			}
+
+		case "/v5/order/create":
+			s.mu.Lock()
+			s.createOrders = append(s.createOrders, params)
+			s.mu.Unlock()
+			linkID, _ := params["orderLinkId"].(string)
+			result = map[string]interface{}{"orderId": "order-1", "orderLinkId": linkID}
+
+		case "/v5/order/realtime":
+			result = map[string]interface{}{
+				"list": []map[string]interface{}{
+					{"orderId": "sl-1", "orderLinkId": bybitStopLossTag + "1", "stopOrderType": "Stop"},
+					{"orderId": "tp-1", "orderLinkId": bybitTakeProfTag + "1", "stopOrderType": "Stop"},
+					{"orderId": "ui-sl", "orderLinkId": "", "stopOrderType": "StopLoss"},
+				},
+			}
+
+		case "/v5/order/cancel":
+			s.mu.Lock()
+			s.cancelOrders = append(s.cancelOrders, params["orderId"].(string))
+			s.mu.Unlock()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"retCode": retCode, "retMsg": retMsg, "result": result})
+	}))
+
+	trader := NewBybitTrader("test-key", "test-secret", false)
+	trader.client = s.mockServer.Client()
+	trader.baseURL = s.mockServer.URL
+
+	s.TraderTestSuite = NewTraderTestSuite(t, trader)
+	return s
+}
+
+// Cleanup 清理资源
+func (s *BybitTraderTestSuite) Cleanup() {
+	if s.mockServer != nil {
+		s.mockServer.Close()
+	}
+	s.TraderTestSuite.Cleanup()
+}
+
+// lastOrder 返回最后一次下单请求
+func (s *BybitTraderTestSuite) lastOrder() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.createOrders) == 0 {
+		return nil
+	}
+	return s.createOrders[len(s.createOrders)-1]
+}
+
+// ============================================================
+// 二、使用 BybitTraderTestSuite 运行通用测试
+// ============================================================
+
+// TestBybitTrader_InterfaceCompliance 测试接口兼容性
+func TestBybitTrader_InterfaceCompliance(t *testing.T) {
+	var _ Trader = (*BybitTrader)(nil)
+}
+
+// TestBybitTrader_CommonInterface 使用测试套件运行所有通用接口测试
+func TestBybitTrader_CommonInterface(t *testing.T) {
+	suite := NewBybitTraderTestSuite(t)
+	defer suite.Cleanup()
+
+	suite.RunAllTests()
+}
+
+// ============================================================
+// 三、Bybit 特定功能的单元测试
+// ============================================================
+
+// TestBybitTrader_GetPositions 测试持仓字段映射（空仓过滤、方向、数值解析）
+func TestBybitTrader_GetPositions(t *testing.T) {
+	suite := NewBybitTraderTestSuite(t)
+	defer suite.Cleanup()
+
+	positions, err := suite.Trader.GetPositions()
+	assert.NoError(t, err)
+	assert.Len(t, positions, 1)
+	assert.Equal(t, "BTCUSDT", positions[0]["symbol"])
+	assert.Equal(t, "long", positions[0]["side"])
+	assert.Equal(t, 0.5, positions[0]["positionAmt"])
+	assert.Equal(t, 50000.0, positions[0]["entryPrice"])
+	assert.Equal(t, 10.0, positions[0]["leverage"])
+}
+
+// TestBybitTrader_TriggerOrders 测试止损止盈条件单的方向、触发方向和标记
+func TestBybitTrader_TriggerOrders(t *testing.T) {
+	suite := NewBybitTraderTestSuite(t)
+	defer suite.Cleanup()
+
+	tests := []struct {
+		name          string
+		positionSide  string
+		isStopLoss    bool
+		wantSide      string
+		wantDirection float64
+		wantTag       string
+	}{
+		{"多头止损", PositionSideLong, true, "Sell", 2, bybitStopLossTag},
+		{"多头止盈", PositionSideLong, false, "Sell", 1, bybitTakeProfTag},
+		{"空头止损", PositionSideShort, true, "Buy", 1, bybitStopLossTag},
+		{"空头止盈", PositionSideShort, false, "Buy", 2, bybitTakeProfTag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.isStopLoss {
+				err = suite.Trader.SetStopLoss("BTCUSDT", tt.positionSide, 0.0123, 48000.04)
+			} else {
+				err = suite.Trader.SetTakeProfit("BTCUSDT", tt.positionSide, 0.0123, 48000.04)
+			}
+			assert.NoError(t, err)
+
+			order := suite.lastOrder()
+			assert.Equal(t, tt.wantSide, order["side"])
+			assert.Equal(t, tt.wantDirection, order["triggerDirection"])
+			assert.Equal(t, true, order["reduceOnly"])
+			assert.Equal(t, "0.012", order["qty"])
+			assert.Equal(t, "48000.0", order["triggerPrice"])
+			assert.True(t, strings.HasPrefix(order["orderLinkId"].(string), tt.wantTag))
+		})
+	}
+}
+
+// TestBybitTrader_CancelStopLossOnly 测试仅取消止损单时保留止盈单
+func TestBybitTrader_CancelStopLossOnly(t *testing.T) {
+	suite := NewBybitTraderTestSuite(t)
+	defer suite.Cleanup()
+
+	assert.NoError(t, suite.Trader.CancelStopLossOrders("BTCUSDT"))
+	assert.ElementsMatch(t, []string{"sl-1", "ui-sl"}, suite.cancelOrders)
+}
+
+// TestBybitTrader_CloseUsesReduceOnly 测试平仓为只减仓市价单
+func TestBybitTrader_CloseUsesReduceOnly(t *testing.T) {
+	suite := NewBybitTraderTestSuite(t)
+	defer suite.Cleanup()
+
+	_, err := suite.Trader.CloseLong("BTCUSDT", PositionSideLong, 0)
+	assert.NoError(t, err)
+
+	order := suite.lastOrder()
+	assert.Equal(t, "Sell", order["side"])
+	assert.Equal(t, "Market", order["orderType"])
+	assert.Equal(t, "0.500", order["qty"])
+	assert.Equal(t, true, order["reduceOnly"])
+}
+
+// TestBybitTrader_SetMarginMode 测试切换仓位模式时提交币种当前杠杆（不是固定值），且仓位模式未变化以外的错误返回给调用方
+func TestBybitTrader_SetMarginMode(t *testing.T) {
+	suite := NewBybitTraderTestSuite(t)
+	defer suite.Cleanup()
+	trader := suite.Trader.(*BybitTrader)
+
+	// 未设置过杠杆：沿用交易所上的当前杠杆
+	suite.switchCode = -1
+	assert.NoError(t, trader.SetMarginMode("SOLUSDT", false))
+	// 已设置杠杆：沿用设置的杠杆
+	assert.NoError(t, trader.SetLeverage("BTCUSDT", 3))
+	assert.NoError(t, trader.SetMarginMode("BTCUSDT", true))
+	if assert.Len(t, suite.switchModes, 2) {
+		assert.Equal(t, "10", suite.switchModes[0]["buyLeverage"])
+		assert.Equal(t, float64(1), suite.switchModes[0]["tradeMode"])
+		assert.Equal(t, "3", suite.switchModes[1]["buyLeverage"])
+		assert.Equal(t, "3", suite.switchModes[1]["sellLeverage"])
+		assert.Equal(t, float64(0), suite.switchModes[1]["tradeMode"])
+	}
+
+	// 仓位模式未变化视为成功，其余错误返回
+	suite.switchCode = 0
+	assert.NoError(t, trader.SetMarginMode("BTCUSDT", true))
+	suite.switchCode = 100028
+	assert.Error(t, trader.SetMarginMode("BTCUSDT", false))
+}
+
+// TestBybitTrader_Sign 测试签名算法（HMAC_SHA256(timestamp + apiKey + recvWindow + payload)）
+func TestBybitTrader_Sign(t *testing.T) {
+	trader := NewBybitTrader("key", "secret", true)
+	assert.Equal(t, bybitTestnetURL, trader.baseURL)
+
+	sig := trader.sign("1700000000000", "category=linear")
+	assert.Equal(t, "e6c3e971c517d999338172674f1c633b9016addf8f8c632372232076767b4c07", sig)
+}
@@ -0,0 +1,74 @@
+package trader
+
+import (
+	"fmt"
+	"nofx/decision"
+	"nofx/logger"
+	"time"
+)
+
+// consensusCallBudget 共识开仓第二次AI调用的时间预算，超时视为无共识（不拖慢平仓等其他决策的执行）
+const consensusCallBudget = 45 * time.Second
+
+// consensusResult 第二次AI调用的结果
+type consensusResult struct {
+	fullDecision *decision.FullDecision
+	err          error
+}
+
+// hasOpenDecision 决策中是否包含开仓
+func hasOpenDecision(decisions []decision.Decision) bool {
+	for _, d := range decisions {
+		if d.Action == "open_long" || d.Action == "open_short" {
+			return true
+		}
+	}
+	return false
+}
+
+// requestOpenConsensus 用同一上下文（行情已拉取）再请求一次AI，返回第二次决策中的开仓方向（币种 -> open_long/open_short）
+// 第二次调用失败或超出时间预算时返回空表，本周期的开仓全部视为无共识；同一币种同时开多开空视为无共识
+func (at *AutoTrader) requestOpenConsensus(ctx *decision.Context, record *logger.DecisionRecord) map[string]string {
+	opens := make(map[string]string)
+
+	resultCh := make(chan consensusResult, 1)
+	go func() {
+		fullDecision, err := decision.GetFullDecisionFromMarketData(ctx, at.mcpClient, at.customPrompt, at.overrideBasePrompt, at.systemPromptTemplate)
+		resultCh <- consensusResult{fullDecision: fullDecision, err: err}
+	}()
+
+	var result consensusResult
+	select {
+	case result = <-resultCh:
+	case <-time.After(consensusCallBudget):
+		at.cycleLogger().Warn("⚠️ 共识确认调用超时，本周期开仓视为无共识", "budget", consensusCallBudget)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠️ 共识确认调用超时（%v），开仓视为无共识", consensusCallBudget))
+		return opens
+	}
+
+	if result.fullDecision != nil {
+		usage := result.fullDecision.TokenUsage
+		record.PromptTokens += usage.PromptTokens
+		record.CompletionTokens += usage.CompletionTokens
+		record.TotalTokens += usage.TotalTokens
+		at.addTokenUsage(usage)
+	}
+	if result.err != nil {
+		at.cycleLogger().Warn("⚠️ 共识确认调用失败，本周期开仓视为无共识", "error", result.err)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠️ 共识确认调用失败: %v", result.err))
+		return opens
+	}
+
+	for _, d := range result.fullDecision.Decisions {
+		if d.Action != "open_long" && d.Action != "open_short" {
+			continue
+		}
+		if existing, ok := opens[d.Symbol]; ok && existing != d.Action {
+			opens[d.Symbol] = "" // 同一币种方向矛盾
+			continue
+		}
+		opens[d.Symbol] = d.Action
+	}
+	at.cycleLogger().Info("🤝 共识确认调用返回", "opens", len(opens))
+	return opens
+}
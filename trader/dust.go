@@ -0,0 +1,79 @@
+package trader
+
+import (
+	"fmt"
+	"nofx/logger"
+)
+
+// dustThreshold 零头持仓阈值（名义价值 USDT）：配置了 DustThresholdUSD 时使用配置值，否则使用交易所该币种的最小名义价值
+// 获取交易对规则失败或交易所不限制最小名义价值时返回 0（不判定零头）
+func (at *AutoTrader) dustThreshold(symbol string) float64 {
+	if at.config.DustThresholdUSD > 0 {
+		return at.config.DustThresholdUSD
+	}
+	filters, err := at.trader.GetSymbolFilters(symbol)
+	if err != nil {
+		return 0
+	}
+	return filters.MinNotional
+}
+
+// isDustPosition 持仓名义价值（数量 × 标记价）是否低于零头阈值。部分平仓后残留的零头无法按正常数量平仓，
+// 不计入最大持仓数，也不参与回撤监控，由 closeDustPositions 每个周期尝试全部平掉
+func (at *AutoTrader) isDustPosition(pos map[string]interface{}) bool {
+	symbol, _ := pos["symbol"].(string)
+	quantity, _ := asFloat(pos["positionAmt"])
+	if quantity < 0 {
+		quantity = -quantity
+	}
+	markPrice, _ := asFloat(pos["markPrice"])
+	if symbol == "" || quantity == 0 || markPrice <= 0 {
+		return false
+	}
+	threshold := at.dustThreshold(symbol)
+	return threshold > 0 && quantity*markPrice < threshold
+}
+
+// closeDustPositions 尽力全部平掉零头持仓（quantity=0 按全部持仓平仓，交易所仍拒绝时只记录，下个周期再试）
+// 手动持仓标记的币种不处理
+func (at *AutoTrader) closeDustPositions(record *logger.DecisionRecord) {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return // 对账已记录获取持仓失败
+	}
+
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		if !at.isDustPosition(pos) || at.isManualHold(symbol) {
+			continue
+		}
+		quantity, _ := asFloat(pos["positionAmt"])
+		if quantity < 0 {
+			quantity = -quantity
+		}
+		markPrice, _ := asFloat(pos["markPrice"])
+
+		action := logger.DecisionAction{
+			Action:    "auto_close_dust",
+			Symbol:    symbol,
+			Quantity:  quantity,
+			Price:     markPrice,
+			Timestamp: at.now(),
+		}
+		at.positionMutex.Lock()
+		err := at.emergencyClosePosition(symbol, side)
+		at.positionMutex.Unlock()
+		if err != nil {
+			at.cycleLogger().Warn("⚠️ 零头持仓平仓失败", "symbol", symbol, "side", side, "notional", quantity*markPrice, "error", err)
+			action.Error = err.Error()
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠️ %s %s 零头持仓（%.4f USDT）平仓失败: %v", symbol, side, quantity*markPrice, err))
+		} else {
+			action.Success = true
+			at.ClearPeakPnLCache(symbol, side)
+			at.cycleLogger().Info("🧹 已平掉零头持仓", "symbol", symbol, "side", side, "notional", quantity*markPrice)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🧹 %s %s 零头持仓（%.4f USDT）已平仓", symbol, side, quantity*markPrice))
+		}
+		record.Decisions = append(record.Decisions, action)
+	}
+}
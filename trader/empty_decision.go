@@ -0,0 +1,52 @@
+package trader
+
+import (
+	"encoding/json"
+	"fmt"
+	"nofx/decision"
+	"nofx/logger"
+)
+
+// emptyDecisionReason AI返回空决策数组时记录的 hold 原因
+const emptyDecisionReason = "AI返回空决策"
+
+// handleEmptyDecision 处理解析成功但决策数组为空的响应：开启 RetryEmptyDecision 且有持仓时用同一上下文（行情已拉取）
+// 重新请求一次（输出可能被截断），重试得到决策时返回重试结果；仍为空时在决策记录中写入一条成功的 hold，
+// 使空决策周期与解析失败的周期可以区分
+func (at *AutoTrader) handleEmptyDecision(ctx *decision.Context, fullDecision *decision.FullDecision, record *logger.DecisionRecord) *decision.FullDecision {
+	if at.config.RetryEmptyDecision && len(ctx.Positions) > 0 {
+		at.cycleLogger().Warn("⚠️ AI返回空决策，有持仓，重新请求一次", "positions", len(ctx.Positions))
+		retry, err := decision.GetFullDecisionFromMarketData(ctx, at.mcpClient, at.customPrompt, at.overrideBasePrompt, at.systemPromptTemplate)
+		if retry != nil {
+			usage := retry.TokenUsage
+			record.PromptTokens += usage.PromptTokens
+			record.CompletionTokens += usage.CompletionTokens
+			record.TotalTokens += usage.TotalTokens
+			at.addTokenUsage(usage)
+		}
+		switch {
+		case err != nil:
+			at.cycleLogger().Warn("⚠️ 空决策重试失败，按空决策处理", "error", err)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠️ AI返回空决策，重试失败: %v", err))
+		case len(retry.Decisions) == 0:
+			record.ExecutionLog = append(record.ExecutionLog, "⚠️ AI返回空决策，重试后仍为空")
+		default:
+			at.cycleLogger().Info("🔁 空决策重试返回决策", "decisions", len(retry.Decisions))
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🔁 AI返回空决策，重试后返回 %d 个决策", len(retry.Decisions)))
+			record.CoTTrace = retry.CoTTrace
+			decisionJSON, _ := json.MarshalIndent(retry.Decisions, "", "  ")
+			record.DecisionJSON = string(decisionJSON)
+			return retry
+		}
+	}
+
+	at.cycleLogger().Info("💤 AI返回空决策，本周期按 hold 处理")
+	record.Decisions = append(record.Decisions, logger.DecisionAction{
+		Action:    "hold",
+		Reasoning: emptyDecisionReason,
+		Timestamp: at.now(),
+		Success:   true,
+	})
+	record.ExecutionLog = append(record.ExecutionLog, "💤 "+emptyDecisionReason+"，本周期不执行任何操作")
+	return fullDecision
+}
@@ -0,0 +1,70 @@
+package trader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// 交易错误类型：各交易所适配器用 fmt.Errorf("%w", ...) 包装，调用方用 errors.Is 判断失败原因，
+// 不依赖交易所返回的错误文本（不同交易所、不同语言的提示各不相同）
+var (
+	ErrInsufficientMargin = errors.New("保证金不足")
+	ErrPositionExists     = errors.New("已有持仓")
+	ErrMinNotional        = errors.New("订单名义价值低于最小值")
+	ErrRateLimited        = errors.New("请求频率超限")
+	ErrPositionNotFound   = errors.New("没有找到持仓")
+	ErrMarginModeLocked   = errors.New("有持仓时无法更改仓位模式")
+	ErrOrderTimeout       = errors.New("下单超时")
+	ErrTakeProfitNotSet   = errors.New("止损已设置，止盈未设置")
+	ErrPostOnlyRejected   = errors.New("只挂单（Post Only）会立即成交，已被拒绝")
+)
+
+// 币安及兼容接口（Aster）的错误码
+const (
+	binanceErrTooManyRequests    = -1003 // IP 请求权重超限
+	binanceErrTooManyOrders      = -1015 // 下单频率超限
+	binanceErrMarginInsufficient = -2019 // 保证金不足
+	binanceErrReduceOnlyRejected = -2022 // 只减仓订单被拒绝（没有可平的持仓）
+	binanceErrMarginTypeLocked   = -4048 // 有持仓或挂单时无法更改仓位模式
+	binanceErrMinNotional        = -4164 // 订单名义价值低于最小值
+	binanceErrPostOnlyRejected   = -5022 // GTX 只挂单会立即成交，被拒绝
+)
+
+// binanceCodeError 将币安兼容接口的错误码映射为错误类型（未知错误码返回 nil）
+func binanceCodeError(code int64) error {
+	switch code {
+	case binanceErrTooManyRequests, binanceErrTooManyOrders:
+		return ErrRateLimited
+	case binanceErrMarginInsufficient:
+		return ErrInsufficientMargin
+	case binanceErrReduceOnlyRejected:
+		return ErrPositionNotFound
+	case binanceErrMinNotional:
+		return ErrMinNotional
+	case binanceErrMarginTypeLocked:
+		return ErrMarginModeLocked
+	case binanceErrPostOnlyRejected:
+		return ErrPostOnlyRejected
+	}
+	return nil
+}
+
+// classifyHTTPError 解析币安兼容接口的 HTTP 错误响应（{"code":-2019,"msg":"..."}），能识别时包装对应的错误类型
+func classifyHTTPError(statusCode int, body []byte) error {
+	err := fmt.Errorf("HTTP %d: %s", statusCode, string(body))
+
+	if statusCode == http.StatusTooManyRequests || statusCode == 418 { // 418: 频率超限后IP被临时封禁
+		return fmt.Errorf("%w: %w", ErrRateLimited, err)
+	}
+	var apiErr struct {
+		Code int64 `json:"code"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil {
+		if kind := binanceCodeError(apiErr.Code); kind != nil {
+			return fmt.Errorf("%w: %w", kind, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package trader
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClassifyHTTPError 测试币安兼容接口的 HTTP 错误按错误码/状态码映射为错误类型，错误信息保留原文
+func TestClassifyHTTPError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		want       error
+	}{
+		{name: "保证金不足", statusCode: 400, body: `{"code":-2019,"msg":"Margin is insufficient."}`, want: ErrInsufficientMargin},
+		{name: "低于最小名义价值", statusCode: 400, body: `{"code":-4164,"msg":"Order's notional must be no smaller than 5.0"}`, want: ErrMinNotional},
+		{name: "只减仓被拒绝", statusCode: 400, body: `{"code":-2022,"msg":"ReduceOnly Order is rejected."}`, want: ErrPositionNotFound},
+		{name: "有持仓无法更改仓位模式", statusCode: 400, body: `{"code":-4048,"msg":"Margin type cannot be changed if there exists position."}`, want: ErrMarginModeLocked},
+		{name: "只挂单会立即成交", statusCode: 400, body: `{"code":-5022,"msg":"Due to the order could not be executed as maker, the Post Only order will be rejected."}`, want: ErrPostOnlyRejected},
+		{name: "错误码限频", statusCode: 400, body: `{"code":-1015,"msg":"Too many new orders."}`, want: ErrRateLimited},
+		{name: "HTTP 429", statusCode: 429, body: `rate limited`, want: ErrRateLimited},
+		{name: "未知错误码", statusCode: 400, body: `{"code":-1121,"msg":"Invalid symbol."}`},
+		{name: "非JSON响应", statusCode: 502, body: `Bad Gateway`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyHTTPError(tt.statusCode, []byte(tt.body))
+			assert.Contains(t, err.Error(), tt.body)
+			for _, kind := range []error{ErrInsufficientMargin, ErrMinNotional, ErrPositionNotFound, ErrRateLimited, ErrPostOnlyRejected} {
+				assert.Equal(t, kind == tt.want, errors.Is(err, kind), "errors.Is(%v)", kind)
+			}
+		})
+	}
+}
+
+// TestClassifyBinanceError 测试币安 SDK 错误包装后 errors.Is / errors.As 均可用
+func TestClassifyBinanceError(t *testing.T) {
+	apiErr := &common.APIError{Code: -2019, Message: "Margin is insufficient."}
+	err := classifyBinanceError(fmt.Errorf("开多仓失败: %w", apiErr))
+	assert.ErrorIs(t, err, ErrInsufficientMargin)
+	var target *common.APIError
+	assert.ErrorAs(t, err, &target)
+
+	plain := errors.New("read: connection reset by peer")
+	assert.Equal(t, plain, classifyBinanceError(plain))
+}
+
+// TestBybitAPIError_Unwrap 测试 Bybit 错误码映射为错误类型
+func TestBybitAPIError_Unwrap(t *testing.T) {
+	assert.ErrorIs(t, &bybitAPIError{Code: bybitCodeInsufficientAvailable}, ErrInsufficientMargin)
+	assert.ErrorIs(t, &bybitAPIError{Code: bybitCodeRateLimited}, ErrRateLimited)
+	assert.ErrorIs(t, &bybitAPIError{Code: bybitCodeReduceOnlyNoPosition}, ErrPositionNotFound)
+	assert.ErrorIs(t, &bybitAPIError{Code: bybitCodeMinOrderValue}, ErrMinNotional)
+	assert.Nil(t, errors.Unwrap(&bybitAPIError{Code: bybitCodeLeverageNotModified}))
+}
@@ -0,0 +1,35 @@
+package trader
+
+import "time"
+
+// EventType 交易员事件类型
+type EventType string
+
+const (
+	EventStarted     EventType = "started"      // 交易员启动
+	EventStopped     EventType = "stopped"      // 交易员停止
+	EventTradeOpened EventType = "trade_opened" // 开仓订单已提交
+	EventTradeClosed EventType = "trade_closed" // 平仓订单已提交
+	EventHalted      EventType = "halted"       // 触发风控暂停开新仓（如日亏损熔断）
+)
+
+// Event 交易员状态变化事件，通过 AutoTraderConfig.OnEvent 回调发布
+type Event struct {
+	TraderID  string                 `json:"trader_id"`
+	Type      EventType              `json:"type"`
+	Timestamp time.Time              `json:"timestamp"`
+	Payload   map[string]interface{} `json:"payload,omitempty"`
+}
+
+// emit 发布事件（未设置回调时忽略）。回调在交易主流程中同步调用，实现方不能阻塞
+func (at *AutoTrader) emit(eventType EventType, payload map[string]interface{}) {
+	if at.config.OnEvent == nil {
+		return
+	}
+	at.config.OnEvent(Event{
+		TraderID:  at.id,
+		Type:      eventType,
+		Timestamp: at.now(),
+		Payload:   payload,
+	})
+}
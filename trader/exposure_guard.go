@@ -0,0 +1,41 @@
+package trader
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAccountExposureLimit 同一交易所账户上所有交易员合计的保证金占用超过上限
+var ErrAccountExposureLimit = errors.New("账户保证金占用超过上限")
+
+// ExposureGuard 跨交易员的账户保证金协调：共用同一交易所账户（同一套API凭证）的多个交易员各自都在限额内时，
+// 合计仍可能过度加杠杆，由 TraderManager 汇总检查
+type ExposureGuard interface {
+	// ReportAccount 上报账户净值和已用保证金（每个周期获取账户信息后调用）
+	ReportAccount(traderID string, equity, marginUsed float64)
+	// ReserveOpen 开仓前预占保证金，账户合计占用将超过上限时返回 ErrAccountExposureLimit
+	ReserveOpen(traderID string, margin float64) error
+}
+
+// SetExposureGuard 设置跨交易员的账户保证金协调（nil 表示不检查，须在 Run 之前设置）
+func (at *AutoTrader) SetExposureGuard(guard ExposureGuard) {
+	at.exposureGuard = guard
+}
+
+// reportAccountExposure 上报本周期的账户净值和已用保证金
+func (at *AutoTrader) reportAccountExposure(equity, marginUsed float64) {
+	if at.exposureGuard != nil {
+		at.exposureGuard.ReportAccount(at.id, equity, marginUsed)
+	}
+}
+
+// reserveAccountExposure 开仓/加仓前向账户协调方预占保证金
+func (at *AutoTrader) reserveAccountExposure(symbol string, margin float64) error {
+	if at.exposureGuard == nil {
+		return nil
+	}
+	if err := at.exposureGuard.ReserveOpen(at.id, margin); err != nil {
+		return fmt.Errorf("❌ %s 开仓被拒绝: %w", symbol, err)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -301,6 +302,7 @@ func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
 		posMap["unRealizedProfit"] = unrealizedPnl
 		posMap["leverage"] = float64(position.Leverage.Value)
 		posMap["liquidationPrice"] = liquidationPx
+		posMap["marginMode"] = normalizeMarginMode(position.Leverage.Type)
 
 		result = append(result, posMap)
 	}
@@ -372,7 +374,8 @@ func (t *HyperliquidTrader) refreshMetaIfNeeded(coin string) error {
 }
 
 // OpenLong 开多仓
-func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+// Hyperliquid 仅支持单向净持仓，忽略 positionSide 参数
+func (t *HyperliquidTrader) OpenLong(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
 	// 先取消该币种的所有委托单
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
@@ -396,8 +399,8 @@ func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage i
 	roundedQuantity := t.roundToSzDecimals(coin, quantity)
 	log.Printf("  📏 数量精度处理: %.8f -> %.8f (szDecimals=%d)", quantity, roundedQuantity, t.getSzDecimals(coin))
 
-	// ⚠️ 关键：价格也需要处理为5位有效数字
-	aggressivePrice := t.roundPriceToSigfigs(price * 1.01)
+	// ⚠️ 关键：价格也需要处理为5位有效数字，且小数位数不超过 6-szDecimals
+	aggressivePrice := t.roundPrice(coin, price*1.01)
 	log.Printf("  💰 价格精度处理: %.8f -> %.8f (5位有效数字)", price*1.01, aggressivePrice)
 
 	// 创建市价买入订单（使用IOC limit order with aggressive price）
@@ -430,7 +433,7 @@ func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage i
 }
 
 // OpenShort 开空仓
-func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) OpenShort(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
 	// 先取消该币种的所有委托单
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
@@ -454,8 +457,8 @@ func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage
 	roundedQuantity := t.roundToSzDecimals(coin, quantity)
 	log.Printf("  📏 数量精度处理: %.8f -> %.8f (szDecimals=%d)", quantity, roundedQuantity, t.getSzDecimals(coin))
 
-	// ⚠️ 关键：价格也需要处理为5位有效数字
-	aggressivePrice := t.roundPriceToSigfigs(price * 0.99)
+	// ⚠️ 关键：价格也需要处理为5位有效数字，且小数位数不超过 6-szDecimals
+	aggressivePrice := t.roundPrice(coin, price*0.99)
 	log.Printf("  💰 价格精度处理: %.8f -> %.8f (5位有效数字)", price*0.99, aggressivePrice)
 
 	// 创建市价卖出订单
@@ -488,7 +491,7 @@ func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage
 }
 
 // CloseLong 平多仓
-func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) CloseLong(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -504,7 +507,7 @@ func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[stri
 		}
 
 		if quantity == 0 {
-			return nil, fmt.Errorf("没有找到 %s 的多仓", symbol)
+			return nil, fmt.Errorf("%w: %s 多仓", ErrPositionNotFound, symbol)
 		}
 	}
 
@@ -521,8 +524,8 @@ func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[stri
 	roundedQuantity := t.roundToSzDecimals(coin, quantity)
 	log.Printf("  📏 数量精度处理: %.8f -> %.8f (szDecimals=%d)", quantity, roundedQuantity, t.getSzDecimals(coin))
 
-	// ⚠️ 关键：价格也需要处理为5位有效数字
-	aggressivePrice := t.roundPriceToSigfigs(price * 0.99)
+	// ⚠️ 关键：价格也需要处理为5位有效数字，且小数位数不超过 6-szDecimals
+	aggressivePrice := t.roundPrice(coin, price*0.99)
 	log.Printf("  💰 价格精度处理: %.8f -> %.8f (5位有效数字)", price*0.99, aggressivePrice)
 
 	// 创建平仓订单（卖出 + ReduceOnly）
@@ -560,7 +563,7 @@ func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[stri
 }
 
 // CloseShort 平空仓
-func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) CloseShort(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -576,7 +579,7 @@ func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[str
 		}
 
 		if quantity == 0 {
-			return nil, fmt.Errorf("没有找到 %s 的空仓", symbol)
+			return nil, fmt.Errorf("%w: %s 空仓", ErrPositionNotFound, symbol)
 		}
 	}
 
@@ -593,8 +596,8 @@ func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[str
 	roundedQuantity := t.roundToSzDecimals(coin, quantity)
 	log.Printf("  📏 数量精度处理: %.8f -> %.8f (szDecimals=%d)", quantity, roundedQuantity, t.getSzDecimals(coin))
 
-	// ⚠️ 关键：价格也需要处理为5位有效数字
-	aggressivePrice := t.roundPriceToSigfigs(price * 1.01)
+	// ⚠️ 关键：价格也需要处理为5位有效数字，且小数位数不超过 6-szDecimals
+	aggressivePrice := t.roundPrice(coin, price*1.01)
 	log.Printf("  💰 价格精度处理: %.8f -> %.8f (5位有效数字)", price*1.01, aggressivePrice)
 
 	// 创建平仓订单（买入 + ReduceOnly）
@@ -738,8 +741,8 @@ func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quan
 	// ⚠️ 关键：根据币种精度要求，四舍五入数量
 	roundedQuantity := t.roundToSzDecimals(coin, quantity)
 
-	// ⚠️ 关键：价格也需要处理为5位有效数字
-	roundedStopPrice := t.roundPriceToSigfigs(stopPrice)
+	// ⚠️ 关键：价格也需要处理为5位有效数字，且小数位数不超过 6-szDecimals
+	roundedStopPrice := t.roundPrice(coin, stopPrice)
 
 	// 创建止损单（Trigger Order）
 	order := hyperliquid.CreateOrderRequest{
@@ -775,8 +778,8 @@ func (t *HyperliquidTrader) SetTakeProfit(symbol string, positionSide string, qu
 	// ⚠️ 关键：根据币种精度要求，四舍五入数量
 	roundedQuantity := t.roundToSzDecimals(coin, quantity)
 
-	// ⚠️ 关键：价格也需要处理为5位有效数字
-	roundedTakeProfitPrice := t.roundPriceToSigfigs(takeProfitPrice)
+	// ⚠️ 关键：价格也需要处理为5位有效数字，且小数位数不超过 6-szDecimals
+	roundedTakeProfitPrice := t.roundPrice(coin, takeProfitPrice)
 
 	// 创建止盈单（Trigger Order）
 	order := hyperliquid.CreateOrderRequest{
@@ -813,6 +816,19 @@ func (t *HyperliquidTrader) FormatQuantity(symbol string, quantity float64) (str
 	return fmt.Sprintf(formatStr, quantity), nil
 }
 
+// hyperliquidMinNotional Hyperliquid 单笔订单最小价值（USDC）
+const hyperliquidMinNotional = 10.0
+
+// GetSymbolFilters 获取交易对的数量步进值和最小名义价值（步进值由 szDecimals 推导）
+func (t *HyperliquidTrader) GetSymbolFilters(symbol string) (SymbolFilters, error) {
+	coin := convertSymbolToHyperliquid(symbol)
+	szDecimals := t.getSzDecimals(coin)
+	return SymbolFilters{
+		StepSize:    math.Pow10(-szDecimals),
+		MinNotional: hyperliquidMinNotional,
+	}, nil
+}
+
 // getSzDecimals 获取币种的数量精度
 func (t *HyperliquidTrader) getSzDecimals(coin string) int {
 	// ✅ 并发安全：使用读锁保护 meta 字段访问
@@ -849,6 +865,27 @@ func (t *HyperliquidTrader) roundToSzDecimals(coin string, quantity float64) flo
 	return float64(int(quantity*multiplier+0.5)) / multiplier
 }
 
+// hyperliquidMaxPriceDecimals 永续合约价格的最大小数位数（实际上限为该值减去币种的 szDecimals）
+const hyperliquidMaxPriceDecimals = 6
+
+// FormatPrice 按 Hyperliquid 的价格规则格式化价格：5位有效数字，且小数位数不超过 6-szDecimals
+func (t *HyperliquidTrader) FormatPrice(symbol string, price float64) (string, error) {
+	coin := convertSymbolToHyperliquid(symbol)
+	return strconv.FormatFloat(t.roundPrice(coin, price), 'f', -1, 64), nil
+}
+
+// roundPrice 将价格处理为 Hyperliquid 接受的精度：先取5位有效数字，再截到 6-szDecimals 位小数
+// （例如 BTC 的 szDecimals=5，价格最多1位小数；大于等于 10^5 的价格按有效数字取整后为整数，整数价格总是合法）
+func (t *HyperliquidTrader) roundPrice(coin string, price float64) float64 {
+	rounded := t.roundPriceToSigfigs(price)
+	maxDecimals := hyperliquidMaxPriceDecimals - t.getSzDecimals(coin)
+	if maxDecimals < 0 {
+		maxDecimals = 0
+	}
+	multiplier := math.Pow10(maxDecimals)
+	return math.Round(rounded*multiplier) / multiplier
+}
+
 // roundPriceToSigfigs 将价格四舍五入到5位有效数字
 // Hyperliquid要求价格使用5位有效数字（significant figures）
 func (t *HyperliquidTrader) roundPriceToSigfigs(price float64) float64 {
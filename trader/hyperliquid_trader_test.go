@@ -524,6 +524,63 @@ func TestHyperliquidTrader_RoundPriceToSigfigs(t *testing.T) {
 	}
 }
 
+// TestHyperliquidTrader_FormatPrice 测试价格按 Hyperliquid 规则格式化（5位有效数字且不超过 6-szDecimals 位小数），
+// 与币安按 tickSize 格式化的结果不同
+func TestHyperliquidTrader_FormatPrice(t *testing.T) {
+	trader := &HyperliquidTrader{
+		meta: &hyperliquid.Meta{
+			Universe: []hyperliquid.AssetInfo{
+				{Name: "BTC", SzDecimals: 5},
+				{Name: "DOGE", SzDecimals: 0},
+				{Name: "ARB", SzDecimals: 3},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		symbol      string
+		price       float64
+		binanceTick float64
+		expected    string
+		binance     string
+	}{
+		{
+			name:        "BTC_超过5位有效数字取整",
+			symbol:      "BTCUSDT",
+			price:       104123.7,
+			binanceTick: 0.1,
+			expected:    "104120",
+			binance:     "104123.7",
+		},
+		{
+			name:        "ARB_小数位受szDecimals限制",
+			symbol:      "ARBUSDT",
+			price:       0.2345678,
+			binanceTick: 0.00001,
+			expected:    "0.235",
+			binance:     "0.23457",
+		},
+		{
+			name:        "DOGE_5位有效数字",
+			symbol:      "DOGEUSDT",
+			price:       0.1234567,
+			binanceTick: 0.00001,
+			expected:    "0.12346",
+			binance:     "0.12346",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := trader.FormatPrice(tt.symbol, tt.price)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+			assert.Equal(t, tt.binance, formatStep(tt.price, tt.binanceTick))
+		})
+	}
+}
+
 // TestHyperliquidTrader_GetSzDecimals 测试获取精度
 func TestHyperliquidTrader_GetSzDecimals(t *testing.T) {
 	tests := []struct {
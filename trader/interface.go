@@ -1,5 +1,19 @@
 package trader
 
+import "time"
+
+// 持仓方向（与币安 positionSide 取值一致）
+const (
+	PositionSideLong  = "LONG"
+	PositionSideShort = "SHORT"
+)
+
+// SymbolFilters 交易对下单规则（来自交易所 exchangeInfo / meta）
+type SymbolFilters struct {
+	StepSize    float64 // 数量步进值（0 表示未知）
+	MinNotional float64 // 最小名义价值 USDT（0 表示不限制）
+}
+
 // Trader 交易器统一接口
 // 支持多个交易平台（币安、Hyperliquid等）
 type Trader interface {
@@ -9,17 +23,17 @@ type Trader interface {
 	// GetPositions 获取所有持仓
 	GetPositions() ([]map[string]interface{}, error)
 
-	// OpenLong 开多仓
-	OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error)
+	// OpenLong 开多仓（positionSide: 双向持仓模式下的持仓方向 LONG，单向持仓的交易所忽略）
+	OpenLong(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error)
 
-	// OpenShort 开空仓
-	OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error)
+	// OpenShort 开空仓（positionSide: 双向持仓模式下的持仓方向 SHORT，单向持仓的交易所忽略）
+	OpenShort(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error)
 
-	// CloseLong 平多仓（quantity=0表示全部平仓）
-	CloseLong(symbol string, quantity float64) (map[string]interface{}, error)
+	// CloseLong 平多仓（quantity=0表示全部平仓），实现必须保证订单只减仓，不能反向开空
+	CloseLong(symbol string, positionSide string, quantity float64) (map[string]interface{}, error)
 
-	// CloseShort 平空仓（quantity=0表示全部平仓）
-	CloseShort(symbol string, quantity float64) (map[string]interface{}, error)
+	// CloseShort 平空仓（quantity=0表示全部平仓），实现必须保证订单只减仓，不能反向开多
+	CloseShort(symbol string, positionSide string, quantity float64) (map[string]interface{}, error)
 
 	// SetLeverage 设置杠杆
 	SetLeverage(symbol string, leverage int) error
@@ -50,4 +64,123 @@ type Trader interface {
 
 	// FormatQuantity 格式化数量到正确的精度
 	FormatQuantity(symbol string, quantity float64) (string, error)
+
+	// FormatPrice 按交易所的价格规则（tick size / 有效数字）格式化价格
+	FormatPrice(symbol string, price float64) (string, error)
+
+	// GetSymbolFilters 获取交易对的数量步进值和最小名义价值（用于下单前校验）
+	GetSymbolFilters(symbol string) (SymbolFilters, error)
+}
+
+// FillEvent 交易所用户数据流推送的单笔真实成交
+type FillEvent struct {
+	Symbol          string
+	Side            string // 持仓方向 long/short
+	OrderID         int64
+	ClientOrderID   string
+	OrderType       string    // 原始订单类型（MARKET / STOP_MARKET / TAKE_PROFIT_MARKET / LIQUIDATION 等）
+	Price           float64   // 本笔成交价
+	Quantity        float64   // 本笔成交数量
+	Commission      float64   // 本笔手续费
+	CommissionAsset string    // 手续费币种
+	RealizedPnL     float64   // 本笔已实现盈亏（交易所计算，不含手续费）
+	IsClose         bool      // 是否为平仓（减仓）成交
+	Reason          string    // 平仓原因：stop_loss / take_profit / liquidation / manual / system（本系统下的市价单）
+	Time            time.Time // 成交时间
+}
+
+// FillStreamer 支持用户数据流推送成交的交易器（可选接口）
+// 未实现的交易所仍通过对比持仓快照推断被动平仓
+type FillStreamer interface {
+	// StartFillStream 启动成交推送（断线/listenKey过期自动重连），handler 在推送goroutine中调用
+	StartFillStream(handler func(FillEvent)) error
+
+	// StopFillStream 停止成交推送
+	StopFillStream()
+}
+
+// ClientOrderIDTrader 支持客户端订单ID幂等下单的交易器（可选接口）
+// 同一 clientOrderID 重复提交时返回交易所已有的订单，不会重复下单；未实现的交易所失败后不自动重试
+type ClientOrderIDTrader interface {
+	// OpenLongWithClientID 开多仓（指定客户端订单ID）
+	OpenLongWithClientID(symbol string, positionSide string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error)
+
+	// OpenShortWithClientID 开空仓（指定客户端订单ID）
+	OpenShortWithClientID(symbol string, positionSide string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error)
+
+	// CloseLongWithClientID 平多仓（指定客户端订单ID，quantity=0表示全部平仓）
+	CloseLongWithClientID(symbol string, positionSide string, quantity float64, clientOrderID string) (map[string]interface{}, error)
+
+	// CloseShortWithClientID 平空仓（指定客户端订单ID，quantity=0表示全部平仓）
+	CloseShortWithClientID(symbol string, positionSide string, quantity float64, clientOrderID string) (map[string]interface{}, error)
+}
+
+// OrderCanceler 支持按客户端订单ID撤单的交易器（可选接口），用于撤销下单超时的订单
+type OrderCanceler interface {
+	// CancelOrderByClientID 撤销指定客户端订单ID的订单
+	CancelOrderByClientID(symbol string, clientOrderID string) error
+}
+
+// OrderLookupTrader 支持按客户端订单ID查询订单的交易器（可选接口），用于确认请求结果未知的订单是否已到达交易所
+type OrderLookupTrader interface {
+	// GetOrderByClientID 查询指定客户端订单ID的订单，订单不存在（或未成交即已撤销）时返回 nil
+	GetOrderByClientID(symbol string, clientOrderID string) (map[string]interface{}, error)
+}
+
+// OCOTrader 支持止损止盈联动挂单（一方成交后交易所自动撤销另一方）的交易器（可选接口）
+// 未实现的交易所分别挂只减仓的止损和止盈单，由对账时撤销残留的一方
+type OCOTrader interface {
+	// SetStopLossTakeProfit 为持仓挂联动的止损止盈单（止损已挂上但止盈失败时返回包装 ErrTakeProfitNotSet 的错误）
+	SetStopLossTakeProfit(symbol string, positionSide string, quantity, stopPrice, takeProfitPrice float64) error
+}
+
+// OrderRequest 批量下单中的一笔市价开仓单
+type OrderRequest struct {
+	Symbol        string
+	PositionSide  string // PositionSideLong 开多 / PositionSideShort 开空
+	Quantity      float64
+	Leverage      int
+	ClientOrderID string
+}
+
+// OrderResult 批量下单中对应请求的结果
+type OrderResult struct {
+	Order map[string]interface{} // 成功时的订单结果（字段同 OpenLong）
+	Err   error                  // 该笔订单失败的原因（不影响同批次的其他订单）
+}
+
+// BatchOrderTrader 支持一次请求提交多笔订单的交易器（可选接口），同一周期的多个开仓合并为一次请求以减少延迟
+// 未实现的交易所逐笔下单
+type BatchOrderTrader interface {
+	// PlaceBatchOrders 批量提交市价开仓单，结果与 orders 按下标一一对应；请求整体失败（网络错误等）时返回 error
+	PlaceBatchOrders(orders []OrderRequest) ([]OrderResult, error)
+}
+
+// PositionModeTrader 支持切换账户持仓模式（单向/双向）的交易器（可选接口）
+// 未实现的交易所为单向净持仓，HedgeMode 配置回退为 false
+type PositionModeTrader interface {
+	// SetPositionMode 切换账户持仓模式（dualSide=true 为双向持仓），返回账户实际模式；切换失败时返回错误和未变化的实际模式
+	SetPositionMode(dualSide bool) (bool, error)
+}
+
+// 交易所资金流水类型（与币安 /fapi/v1/income 的 incomeType 一致）
+const (
+	IncomeTypeRealizedPnL = "REALIZED_PNL" // 已实现盈亏
+	IncomeTypeCommission  = "COMMISSION"   // 手续费（负数为支出）
+	IncomeTypeFundingFee  = "FUNDING_FEE"  // 资金费（负数为支出）
+)
+
+// IncomeRecord 交易所记录的一笔资金流水
+type IncomeRecord struct {
+	Symbol     string
+	IncomeType string  // IncomeTypeRealizedPnL / IncomeTypeCommission / IncomeTypeFundingFee
+	Income     float64 // 金额（正数为收入，负数为支出）
+	Asset      string
+	Time       time.Time
+}
+
+// IncomeHistoryTrader 支持查询资金流水的交易器（可选接口），用于核对日志推算的盈亏
+type IncomeHistoryTrader interface {
+	// GetIncomeHistory 获取 since 之后的已实现盈亏、手续费和资金费流水（按时间正序）
+	GetIncomeHistory(since time.Time) ([]IncomeRecord, error)
 }
@@ -0,0 +1,26 @@
+package trader
+
+import (
+	"errors"
+	"log"
+)
+
+// ErrTraderDisabled 交易员已紧急停用（合规锁定），拒绝启动和执行交易
+var ErrTraderDisabled = errors.New("交易员已紧急停用")
+
+// SetDisabled 设置紧急停用标记：停用后 Run 拒绝启动，进行中的周期不再执行新的决策
+// （停用标记由数据库持久化，重启和热重载后仍然有效；与暂停/停止不同，需要显式解除）
+func (at *AutoTrader) SetDisabled(disabled bool) {
+	if at.disabled.Swap(disabled) != disabled {
+		if disabled {
+			log.Printf("⛔ [%s] 已紧急停用，拒绝启动和执行交易", at.name)
+		} else {
+			log.Printf("✅ [%s] 已解除紧急停用", at.name)
+		}
+	}
+}
+
+// IsDisabled 交易员是否已紧急停用
+func (at *AutoTrader) IsDisabled() bool {
+	return at.disabled.Load()
+}
@@ -0,0 +1,118 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"nofx/decision"
+	"nofx/logger"
+	"strings"
+)
+
+// expectedLeverage 持仓应有的杠杆及当前杠杆是否偏离：本交易员开的仓按开仓时的杠杆比较（检测手动修改），
+// 来源未知的持仓（手动开仓、上次运行遗留）只在超过配置的杠杆上限时视为偏离，纠正到上限
+func (at *AutoTrader) expectedLeverage(symbol, side string, current int) (int, bool) {
+	at.positionStateMutex.RLock()
+	opened := at.positionLeverage[symbol+"_"+side]
+	at.positionStateMutex.RUnlock()
+	if opened > 0 {
+		return opened, current != opened
+	}
+	limit := decision.ResolveLeverage(symbol, at.config.LeverageTiers, at.config.BTCETHLeverage, at.config.AltcoinLeverage)
+	return limit, limit > 0 && current > limit
+}
+
+// resyncLeverageAndMargin 检查持仓币种在交易所的杠杆和仓位模式是否与配置一致，不一致时调用 SetLeverage / SetMarginMode 纠正
+// （杠杆不一致会导致盈亏百分比和风控计算失真）。交易所因持仓拒绝更改时只告警，同一偏离不重复告警
+func (at *AutoTrader) resyncLeverageAndMargin(record *logger.DecisionRecord) {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		log.Printf("⚠️ 获取持仓失败，跳过杠杆/仓位模式检查: %v", err)
+		return
+	}
+
+	at.positionMutex.Lock()
+	defer at.positionMutex.Unlock()
+
+	held := make(map[string]bool)
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		positionAmt, _ := asFloat(pos["positionAmt"])
+		if symbol == "" || positionAmt == 0 || held[symbol] {
+			continue // 杠杆和仓位模式按币种设置，双向持仓只检查一次
+		}
+		held[symbol] = true
+
+		var drifts, corrected, failures []string
+		target, leverageDrift := 0, false
+		if lev, ok := asFloat(pos["leverage"]); ok && lev > 0 {
+			current := int(math.Round(lev))
+			target = current
+			if expected, drift := at.expectedLeverage(symbol, side, current); drift {
+				target, leverageDrift = expected, true
+				drifts = append(drifts, fmt.Sprintf("杠杆 %dx（应为 %dx）", current, expected))
+			}
+		}
+
+		marginFixed := false
+		if mode, _ := pos["marginMode"].(string); mode != "" {
+			isCross := ResolveMarginMode(symbol, at.config.MarginModes, at.config.IsCrossMargin)
+			if (mode == MarginModeCross) != isCross {
+				expected := MarginModeIsolated
+				if isCross {
+					expected = MarginModeCross
+				}
+				drifts = append(drifts, fmt.Sprintf("仓位模式 %s（应为 %s）", mode, expected))
+				if err := at.trader.SetMarginMode(symbol, isCross); err != nil {
+					failures = append(failures, fmt.Sprintf("仓位模式: %v", err))
+				} else {
+					marginFixed = true
+					corrected = append(corrected, "仓位模式 → "+expected)
+					if at.marginModeSet == nil {
+						at.marginModeSet = make(map[string]bool)
+					}
+					at.marginModeSet[symbol] = isCross
+				}
+			}
+		}
+
+		// 部分交易所（Hyperliquid）的仓位模式随设置杠杆一起生效，纠正仓位模式后也重新设置一次杠杆
+		if target > 0 && (leverageDrift || marginFixed) {
+			if err := at.trader.SetLeverage(symbol, target); err != nil {
+				failures = append(failures, fmt.Sprintf("杠杆: %v", err))
+			} else if leverageDrift {
+				corrected = append(corrected, fmt.Sprintf("杠杆 → %dx", target))
+			}
+		}
+
+		if len(drifts) == 0 {
+			delete(at.driftWarnings, symbol)
+			continue
+		}
+		drift := strings.Join(drifts, "、")
+		if len(corrected) > 0 {
+			at.cycleLogger().Info("🔧 已纠正杠杆/仓位模式偏离", "symbol", symbol, "drift", drift, "corrected", strings.Join(corrected, "、"))
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🔧 %s 与配置不一致: %s，已纠正: %s", symbol, drift, strings.Join(corrected, "、")))
+		}
+		if len(failures) == 0 {
+			delete(at.driftWarnings, symbol)
+			continue
+		}
+		if at.driftWarnings[symbol] == drift {
+			continue // 同一偏离已告警过
+		}
+		if at.driftWarnings == nil {
+			at.driftWarnings = make(map[string]string)
+		}
+		at.driftWarnings[symbol] = drift
+		at.cycleLogger().Warn("⚠️ 杠杆/仓位模式与配置不一致，持仓中无法纠正", "symbol", symbol, "drift", drift, "error", strings.Join(failures, "; "))
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠️ %s 与配置不一致: %s，无法纠正: %s", symbol, drift, strings.Join(failures, "; ")))
+	}
+
+	for symbol := range at.driftWarnings {
+		if !held[symbol] {
+			delete(at.driftWarnings, symbol)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// manualHoldStore 持久化手动持仓标记的数据库（*config.Database 实现），对账清除标记时同步删除
+type manualHoldStore interface {
+	DeleteManualHold(traderID, symbol string) error
+}
+
+// SetManualHold 标记币种为手动持仓：回撤监控、最长持仓平仓和自动开仓/加仓都跳过该币种，
+// 持仓仍会出现在AI的上下文中。持仓平仓后由对账自动清除标记
+func (at *AutoTrader) SetManualHold(symbol, note string) {
+	symbol = normalizeSymbol(symbol)
+	at.manualHoldMutex.Lock()
+	defer at.manualHoldMutex.Unlock()
+	if at.manualHolds == nil {
+		at.manualHolds = make(map[string]string)
+	}
+	at.manualHolds[symbol] = note
+}
+
+// ClearManualHold 取消币种的手动持仓标记，返回标记是否存在
+func (at *AutoTrader) ClearManualHold(symbol string) bool {
+	symbol = normalizeSymbol(symbol)
+	at.manualHoldMutex.Lock()
+	defer at.manualHoldMutex.Unlock()
+	if _, ok := at.manualHolds[symbol]; !ok {
+		return false
+	}
+	delete(at.manualHolds, symbol)
+	return true
+}
+
+// ManualHolds 当前的手动持仓标记 (symbol -> 备注)
+func (at *AutoTrader) ManualHolds() map[string]string {
+	at.manualHoldMutex.RLock()
+	defer at.manualHoldMutex.RUnlock()
+	holds := make(map[string]string, len(at.manualHolds))
+	for symbol, note := range at.manualHolds {
+		holds[symbol] = note
+	}
+	return holds
+}
+
+// isManualHold 币种是否标记为手动持仓
+func (at *AutoTrader) isManualHold(symbol string) bool {
+	at.manualHoldMutex.RLock()
+	defer at.manualHoldMutex.RUnlock()
+	_, ok := at.manualHolds[normalizeSymbol(symbol)]
+	return ok
+}
+
+// checkManualHold 开仓/加仓前校验币种未被标记为手动持仓
+func (at *AutoTrader) checkManualHold(symbol string) error {
+	if at.isManualHold(symbol) {
+		return fmt.Errorf("❌ %s 已标记为手动持仓，自动交易不再开仓/加仓", normalizeSymbol(symbol))
+	}
+	return nil
+}
+
+// clearClosedManualHolds 清除交易所已无持仓（多空都没有）的币种的手动持仓标记，并同步删除数据库记录
+func (at *AutoTrader) clearClosedManualHolds(liveSymbols map[string]bool) []string {
+	at.manualHoldMutex.Lock()
+	var cleared []string
+	for symbol := range at.manualHolds {
+		if !liveSymbols[symbol] {
+			cleared = append(cleared, symbol)
+			delete(at.manualHolds, symbol)
+		}
+	}
+	at.manualHoldMutex.Unlock()
+	sort.Strings(cleared)
+
+	store, _ := at.database.(manualHoldStore)
+	for _, symbol := range cleared {
+		log.Printf("🧹 [%s] %s 持仓已平仓，清除手动持仓标记", at.name, symbol)
+		if store == nil {
+			continue
+		}
+		if err := store.DeleteManualHold(at.id, symbol); err != nil {
+			log.Printf("⚠️ [%s] 删除 %s 的手动持仓标记失败: %v", at.name, symbol, err)
+		}
+	}
+	return cleared
+}
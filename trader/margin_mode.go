@@ -0,0 +1,32 @@
+package trader
+
+import "strings"
+
+// 按币种覆盖仓位模式时的取值
+const (
+	MarginModeCross    = "cross"    // 全仓
+	MarginModeIsolated = "isolated" // 逐仓
+)
+
+// ResolveMarginMode 返回币种的仓位模式（true=全仓）：按币种覆盖中精确匹配的优先，
+// 未覆盖或取值无效时使用账户级的 IsCrossMargin
+func ResolveMarginMode(symbol string, overrides map[string]string, defaultCross bool) bool {
+	switch strings.ToLower(overrides[strings.ToUpper(symbol)]) {
+	case MarginModeCross:
+		return true
+	case MarginModeIsolated:
+		return false
+	}
+	return defaultCross
+}
+
+// normalizeMarginMode 将交易所返回的仓位模式统一为 MarginModeCross / MarginModeIsolated（无法识别时返回空字符串）
+func normalizeMarginMode(mode string) string {
+	switch strings.ToLower(mode) {
+	case "cross", "crossed":
+		return MarginModeCross
+	case MarginModeIsolated:
+		return MarginModeIsolated
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package trader
+
+import "testing"
+
+// TestResolveMarginMode 测试按币种覆盖优先、未覆盖或无效取值时回退到账户级仓位模式
+func TestResolveMarginMode(t *testing.T) {
+	overrides := map[string]string{
+		"BTCUSDT":  MarginModeCross,
+		"PEPEUSDT": MarginModeIsolated,
+		"WIFUSDT":  "ISOLATED",
+		"DOGEUSDT": "hedge",
+	}
+
+	tests := []struct {
+		name         string
+		symbol       string
+		overrides    map[string]string
+		defaultCross bool
+		want         bool
+	}{
+		{name: "覆盖为全仓", symbol: "BTCUSDT", overrides: overrides, defaultCross: false, want: true},
+		{name: "覆盖为逐仓", symbol: "PEPEUSDT", overrides: overrides, defaultCross: true, want: false},
+		{name: "取值不区分大小写", symbol: "WIFUSDT", overrides: overrides, defaultCross: true, want: false},
+		{name: "币种不区分大小写", symbol: "pepeusdt", overrides: overrides, defaultCross: true, want: false},
+		{name: "无效取值回退默认", symbol: "DOGEUSDT", overrides: overrides, defaultCross: true, want: true},
+		{name: "未覆盖回退默认", symbol: "ETHUSDT", overrides: overrides, defaultCross: false, want: false},
+		{name: "未配置覆盖", symbol: "BTCUSDT", overrides: nil, defaultCross: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveMarginMode(tt.symbol, tt.overrides, tt.defaultCross); got != tt.want {
+				t.Errorf("ResolveMarginMode(%s) = %v, want %v", tt.symbol, got, tt.want)
+			}
+		})
+	}
+}
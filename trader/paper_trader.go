@@ -0,0 +1,587 @@
+package trader
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultPaperFeeRate 模拟成交手续费率（按币安合约 taker 0.04%）
+const defaultPaperFeeRate = 0.0004
+
+// defaultPaperMakerFeeRate 只挂单（Post Only）限价单成交时的 maker 手续费率（按币安合约 maker 0.02%）
+const defaultPaperMakerFeeRate = 0.0002
+
+// SlippageModel 模拟成交滑点模型（测试中可注入确定性实现）
+type SlippageModel interface {
+	// FillPrice 根据参考价格返回市价单成交价，isBuy 为买入方向（开多/平空）
+	FillPrice(symbol string, price float64, isBuy bool) float64
+}
+
+// BpsSlippage 按固定基点向不利方向滑点：买入成交价更高，卖出成交价更低（10 = 0.1%）
+type BpsSlippage float64
+
+// FillPrice 实现 SlippageModel
+func (b BpsSlippage) FillPrice(symbol string, price float64, isBuy bool) float64 {
+	if isBuy {
+		return price * (1 + float64(b)/10000)
+	}
+	return price * (1 - float64(b)/10000)
+}
+
+// PaperTrader 模拟交易器：不向交易所下单，在本地维护模拟账户（回测/试运行使用）
+// 价格来源通过 priceFunc 注入，止盈止损单和限价单需调用 CheckTriggers 按K线高低点撮合
+// 市价成交（开平仓、止盈止损触发）按 slippage 向不利方向滑点，并可模拟下单到成交的延迟
+type PaperTrader struct {
+	mu sync.Mutex
+
+	priceFunc    func(symbol string) (float64, error)
+	feeRate      float64
+	makerFeeRate float64
+	slippage     SlippageModel
+	fillLatency  time.Duration
+	sleep        func(time.Duration) // 测试中可替换
+
+	walletBalance float64
+	leverage      map[string]int
+	positions     map[string]*paperPosition // key: symbol_side
+	orders        []paperOrder              // 未触发的止盈止损单
+	nextOrderID   int64
+}
+
+type paperPosition struct {
+	symbol     string
+	side       string // long / short
+	quantity   float64
+	entryPrice float64
+	leverage   int
+}
+
+type paperOrder struct {
+	symbol       string
+	positionSide string // LONG / SHORT
+	quantity     float64
+	price        float64
+	isStopLoss   bool
+	isLimit      bool // 限价开仓单（只有价格穿过限价才成交）
+	leverage     int  // 限价开仓单的杠杆
+	postOnly     bool // 只挂单：按 maker 费率成交
+}
+
+// PaperFill 止盈止损单的模拟成交
+type PaperFill struct {
+	Symbol     string
+	Side       string // long / short
+	Quantity   float64
+	Price      float64
+	IsStopLoss bool // true=止损, false=止盈
+	Closed     bool // 成交后持仓是否已全部平掉
+	IsLimit    bool // 限价开仓单成交（此时 IsStopLoss/Closed 无意义）
+	PostOnly   bool // 只挂单成交（按 maker 费率计手续费）
+}
+
+// NewPaperTrader 创建模拟交易器
+func NewPaperTrader(initialBalance float64, priceFunc func(symbol string) (float64, error)) *PaperTrader {
+	return &PaperTrader{
+		priceFunc:     priceFunc,
+		feeRate:       defaultPaperFeeRate,
+		makerFeeRate:  defaultPaperMakerFeeRate,
+		slippage:      BpsSlippage(0),
+		sleep:         time.Sleep,
+		walletBalance: initialBalance,
+		leverage:      make(map[string]int),
+		positions:     make(map[string]*paperPosition),
+	}
+}
+
+// SetFeeRate 设置模拟手续费率
+func (t *PaperTrader) SetFeeRate(rate float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.feeRate = rate
+}
+
+// SetMakerFeeRate 设置只挂单成交的 maker 手续费率
+func (t *PaperTrader) SetMakerFeeRate(rate float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.makerFeeRate = rate
+}
+
+// SetSlippageModel 设置市价成交的滑点模型（nil 表示不滑点）
+func (t *PaperTrader) SetSlippageModel(model SlippageModel) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if model == nil {
+		model = BpsSlippage(0)
+	}
+	t.slippage = model
+}
+
+// SetFillLatency 设置模拟成交延迟：市价单等待该时长后再按最新价格成交
+func (t *PaperTrader) SetFillLatency(latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fillLatency = latency
+}
+
+// GetBalance 获取模拟账户余额（字段与币安一致）
+func (t *PaperTrader) GetBalance() (map[string]interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	unrealized := 0.0
+	marginUsed := 0.0
+	for _, pos := range t.positions {
+		price, err := t.priceFunc(pos.symbol)
+		if err != nil {
+			return nil, fmt.Errorf("获取 %s 价格失败: %w", pos.symbol, err)
+		}
+		unrealized += pos.pnl(price)
+		marginUsed += pos.margin()
+	}
+
+	return map[string]interface{}{
+		"totalWalletBalance":    t.walletBalance,
+		"availableBalance":      t.walletBalance + unrealized - marginUsed,
+		"totalUnrealizedProfit": unrealized,
+	}, nil
+}
+
+// GetPositions 获取模拟持仓（字段与币安一致，空仓 positionAmt 为负）
+func (t *PaperTrader) GetPositions() ([]map[string]interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var result []map[string]interface{}
+	for _, pos := range t.positions {
+		price, err := t.priceFunc(pos.symbol)
+		if err != nil {
+			return nil, fmt.Errorf("获取 %s 价格失败: %w", pos.symbol, err)
+		}
+
+		positionAmt := pos.quantity
+		liquidationPrice := pos.entryPrice * (1 - 1/float64(pos.leverage))
+		if pos.side == "short" {
+			positionAmt = -pos.quantity
+			liquidationPrice = pos.entryPrice * (1 + 1/float64(pos.leverage))
+		}
+
+		result = append(result, map[string]interface{}{
+			"symbol":           pos.symbol,
+			"side":             pos.side,
+			"positionAmt":      positionAmt,
+			"entryPrice":       pos.entryPrice,
+			"markPrice":        price,
+			"unRealizedProfit": pos.pnl(price),
+			"leverage":         float64(pos.leverage),
+			"liquidationPrice": liquidationPrice,
+		})
+	}
+	return result, nil
+}
+
+// OpenLong 模拟开多仓
+func (t *PaperTrader) OpenLong(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.open(symbol, "long", quantity, leverage)
+}
+
+// OpenShort 模拟开空仓
+func (t *PaperTrader) OpenShort(symbol string, positionSide string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.open(symbol, "short", quantity, leverage)
+}
+
+// CloseLong 模拟平多仓（quantity=0表示全部平仓）
+func (t *PaperTrader) CloseLong(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
+	t.waitFillLatency()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	price, err := t.priceFunc(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return t.closeLocked(symbol, "long", quantity, t.slippage.FillPrice(symbol, price, false))
+}
+
+// CloseShort 模拟平空仓（quantity=0表示全部平仓）
+func (t *PaperTrader) CloseShort(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
+	t.waitFillLatency()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	price, err := t.priceFunc(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return t.closeLocked(symbol, "short", quantity, t.slippage.FillPrice(symbol, price, true))
+}
+
+// SetLeverage 设置杠杆
+func (t *PaperTrader) SetLeverage(symbol string, leverage int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.leverage[symbol] = leverage
+	return nil
+}
+
+// SetMarginMode 模拟账户不区分全仓/逐仓
+func (t *PaperTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
+	return nil
+}
+
+// GetMarketPrice 获取当前模拟价格
+func (t *PaperTrader) GetMarketPrice(symbol string) (float64, error) {
+	return t.priceFunc(symbol)
+}
+
+// SetStopLoss 挂模拟止损单
+func (t *PaperTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+	return t.addOrder(symbol, positionSide, quantity, stopPrice, true)
+}
+
+// SetTakeProfit 挂模拟止盈单
+func (t *PaperTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	return t.addOrder(symbol, positionSide, quantity, takeProfitPrice, false)
+}
+
+// CancelStopLossOrders 取消止损单
+func (t *PaperTrader) CancelStopLossOrders(symbol string) error {
+	t.removeOrders(func(o paperOrder) bool { return o.symbol == symbol && o.isStopLoss })
+	return nil
+}
+
+// CancelTakeProfitOrders 取消止盈单
+func (t *PaperTrader) CancelTakeProfitOrders(symbol string) error {
+	t.removeOrders(func(o paperOrder) bool { return o.symbol == symbol && !o.isStopLoss && !o.isLimit })
+	return nil
+}
+
+// CancelAllOrders 取消该币种的所有挂单
+func (t *PaperTrader) CancelAllOrders(symbol string) error {
+	t.removeOrders(func(o paperOrder) bool { return o.symbol == symbol })
+	return nil
+}
+
+// CancelStopOrders 取消该币种的止盈/止损单（保留限价开仓单）
+func (t *PaperTrader) CancelStopOrders(symbol string) error {
+	t.removeOrders(func(o paperOrder) bool { return o.symbol == symbol && !o.isLimit })
+	return nil
+}
+
+// FormatQuantity 模拟账户不限制数量精度
+func (t *PaperTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
+	return strconv.FormatFloat(quantity, 'f', -1, 64), nil
+}
+
+// FormatPrice 模拟账户不限制价格精度
+func (t *PaperTrader) FormatPrice(symbol string, price float64) (string, error) {
+	return strconv.FormatFloat(price, 'f', -1, 64), nil
+}
+
+// PlaceLimitOrder 挂模拟限价开仓单（side: long/short），由 CheckTriggers 在价格穿过限价时按限价成交
+// postOnly 对应交易所的 GTX（只挂单）：限价会与当前价格立即成交时拒绝下单（ErrPostOnlyRejected），成交按 maker 费率计费
+func (t *PaperTrader) PlaceLimitOrder(symbol, side string, quantity float64, leverage int, price float64, postOnly bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if quantity <= 0 || price <= 0 {
+		return fmt.Errorf("限价单数量和价格必须大于0")
+	}
+	positionSide := PositionSideLong
+	if side == "short" {
+		positionSide = PositionSideShort
+	}
+	if postOnly {
+		current, err := t.priceFunc(symbol)
+		if err != nil {
+			return err
+		}
+		if (side == "short" && price <= current) || (side != "short" && price >= current) {
+			return fmt.Errorf("%w: %s %s 限价 %.4f，当前价格 %.4f", ErrPostOnlyRejected, symbol, side, price, current)
+		}
+	}
+	t.orders = append(t.orders, paperOrder{
+		symbol:       symbol,
+		positionSide: positionSide,
+		quantity:     quantity,
+		price:        price,
+		isLimit:      true,
+		leverage:     leverage,
+		postOnly:     postOnly,
+	})
+	return nil
+}
+
+// GetSymbolFilters 模拟账户不限制步进值和最小名义价值
+func (t *PaperTrader) GetSymbolFilters(symbol string) (SymbolFilters, error) {
+	return SymbolFilters{}, nil
+}
+
+// CheckTriggers 用一根K线的最高/最低价撮合该币种的止盈止损单和限价开仓单
+// 同一根K线内止损和止盈都被触及时无法判断先后，保守地按止损先成交处理；
+// 止盈止损触发后按市价成交（计入滑点），限价单只有价格穿过限价（不含恰好触及）才按限价成交
+func (t *PaperTrader) CheckTriggers(symbol string, high, low float64) []PaperFill {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var fills []PaperFill
+	for _, isStopLoss := range []bool{true, false} {
+		// 遍历快照：平仓可能会清理掉同方向的其他挂单
+		for _, order := range append([]paperOrder(nil), t.orders...) {
+			if order.symbol != symbol || order.isLimit || order.isStopLoss != isStopLoss || !order.triggered(high, low) {
+				continue
+			}
+			if !containsOrder(t.orders, order) {
+				continue
+			}
+			t.orders = removeOrder(t.orders, order)
+
+			side := "long"
+			if order.positionSide == PositionSideShort {
+				side = "short"
+			}
+			pos, ok := t.positions[symbol+"_"+side]
+			if !ok {
+				continue
+			}
+
+			quantity := order.quantity
+			if quantity <= 0 || quantity > pos.quantity {
+				quantity = pos.quantity
+			}
+			price := t.slippage.FillPrice(symbol, order.price, side == "short")
+			if _, err := t.closeLocked(symbol, side, quantity, price); err != nil {
+				continue
+			}
+			_, stillOpen := t.positions[symbol+"_"+side]
+			fills = append(fills, PaperFill{
+				Symbol:     symbol,
+				Side:       side,
+				Quantity:   quantity,
+				Price:      price,
+				IsStopLoss: isStopLoss,
+				Closed:     !stillOpen,
+			})
+		}
+	}
+
+	for _, order := range append([]paperOrder(nil), t.orders...) {
+		if order.symbol != symbol || !order.isLimit {
+			continue
+		}
+		isLong := order.positionSide != PositionSideShort
+		if (isLong && low >= order.price) || (!isLong && high <= order.price) {
+			continue // 价格未穿过限价：排队在该价位的单子不一定成交
+		}
+		side := "long"
+		if !isLong {
+			side = "short"
+		}
+		feeRate := t.feeRate
+		if order.postOnly {
+			feeRate = t.makerFeeRate
+		}
+		if _, err := t.openLocked(symbol, side, order.quantity, order.leverage, order.price, feeRate); err != nil {
+			continue // 保证金不足等，挂单保留
+		}
+		t.orders = removeOrder(t.orders, order)
+		fills = append(fills, PaperFill{
+			Symbol:   symbol,
+			Side:     side,
+			Quantity: order.quantity,
+			Price:    order.price,
+			IsLimit:  true,
+			PostOnly: order.postOnly,
+		})
+	}
+	return fills
+}
+
+// waitFillLatency 模拟市价单从下单到成交的延迟（调用时不持有锁，延迟后再读取成交价）
+func (t *PaperTrader) waitFillLatency() {
+	t.mu.Lock()
+	latency := t.fillLatency
+	t.mu.Unlock()
+	if latency > 0 {
+		t.sleep(latency)
+	}
+}
+
+func (t *PaperTrader) open(symbol, side string, quantity float64, leverage int) (map[string]interface{}, error) {
+	t.waitFillLatency()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	price, err := t.priceFunc(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return t.openLocked(symbol, side, quantity, leverage, t.slippage.FillPrice(symbol, price, side == "long"), t.feeRate)
+}
+
+// openLocked 按指定成交价和手续费率开仓（调用方需持有锁）
+func (t *PaperTrader) openLocked(symbol, side string, quantity float64, leverage int, price, feeRate float64) (map[string]interface{}, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("开仓数量必须大于0")
+	}
+	if leverage <= 0 {
+		leverage = t.leverage[symbol]
+	}
+	if leverage <= 0 {
+		leverage = 1
+	}
+
+	notional := quantity * price
+	fee := notional * feeRate
+	margin := notional / float64(leverage)
+
+	available := t.walletBalance
+	for _, pos := range t.positions {
+		posPrice, err := t.priceFunc(pos.symbol)
+		if err != nil {
+			return nil, err
+		}
+		available += pos.pnl(posPrice) - pos.margin()
+	}
+	if margin+fee > available {
+		return nil, fmt.Errorf("%w: 需要 %.2f USDT，可用 %.2f USDT", ErrInsufficientMargin, margin+fee, available)
+	}
+
+	t.walletBalance -= fee
+
+	key := symbol + "_" + side
+	if pos, ok := t.positions[key]; ok {
+		// 加仓：按数量加权计算开仓均价
+		total := pos.quantity + quantity
+		pos.entryPrice = (pos.entryPrice*pos.quantity + price*quantity) / total
+		pos.quantity = total
+		pos.leverage = leverage
+	} else {
+		t.positions[key] = &paperPosition{
+			symbol:     symbol,
+			side:       side,
+			quantity:   quantity,
+			entryPrice: price,
+			leverage:   leverage,
+		}
+	}
+
+	return t.orderResult(symbol, price), nil
+}
+
+// closeLocked 按指定价格平仓（调用方需持有锁）
+func (t *PaperTrader) closeLocked(symbol, side string, quantity, price float64) (map[string]interface{}, error) {
+	key := symbol + "_" + side
+	pos, ok := t.positions[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrPositionNotFound, symbol, side)
+	}
+
+	if quantity <= 0 || quantity > pos.quantity {
+		quantity = pos.quantity
+	}
+
+	closed := &paperPosition{side: side, quantity: quantity, entryPrice: pos.entryPrice}
+	t.walletBalance += closed.pnl(price) - quantity*price*t.feeRate
+
+	pos.quantity -= quantity
+	if pos.quantity <= 1e-12 {
+		delete(t.positions, key)
+		// 持仓已全部平掉，同方向的止盈止损单一并失效
+		positionSide := PositionSideLong
+		if side == "short" {
+			positionSide = PositionSideShort
+		}
+		t.orders = filterOrders(t.orders, func(o paperOrder) bool {
+			return o.symbol == symbol && o.positionSide == positionSide && !o.isLimit
+		})
+	}
+
+	return t.orderResult(symbol, price), nil
+}
+
+func (t *PaperTrader) addOrder(symbol, positionSide string, quantity, price float64, isStopLoss bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if price <= 0 {
+		return fmt.Errorf("触发价格必须大于0")
+	}
+	t.orders = append(t.orders, paperOrder{
+		symbol:       symbol,
+		positionSide: positionSide,
+		quantity:     quantity,
+		price:        price,
+		isStopLoss:   isStopLoss,
+	})
+	return nil
+}
+
+func (t *PaperTrader) removeOrders(match func(paperOrder) bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.orders = filterOrders(t.orders, match)
+}
+
+func (t *PaperTrader) orderResult(symbol string, fillPrice float64) map[string]interface{} {
+	t.nextOrderID++
+	return map[string]interface{}{
+		"orderId":  t.nextOrderID,
+		"symbol":   symbol,
+		"status":   "FILLED",
+		"avgPrice": fillPrice, // 模拟成交价（含滑点）
+	}
+}
+
+func (p *paperPosition) pnl(price float64) float64 {
+	if p.side == "short" {
+		return (p.entryPrice - price) * p.quantity
+	}
+	return (price - p.entryPrice) * p.quantity
+}
+
+func (p *paperPosition) margin() float64 {
+	return p.quantity * p.entryPrice / float64(p.leverage)
+}
+
+// triggered 判断K线区间是否触及触发价
+func (o paperOrder) triggered(high, low float64) bool {
+	isLong := o.positionSide != PositionSideShort
+	switch {
+	case isLong && o.isStopLoss, !isLong && !o.isStopLoss:
+		return low <= o.price
+	default:
+		return high >= o.price
+	}
+}
+
+// filterOrders 移除满足条件的订单
+func filterOrders(orders []paperOrder, match func(paperOrder) bool) []paperOrder {
+	kept := orders[:0]
+	for _, o := range orders {
+		if !match(o) {
+			kept = append(kept, o)
+		}
+	}
+	return kept
+}
+
+func containsOrder(orders []paperOrder, target paperOrder) bool {
+	for _, o := range orders {
+		if o == target {
+			return true
+		}
+	}
+	return false
+}
+
+func removeOrder(orders []paperOrder, target paperOrder) []paperOrder {
+	for i, o := range orders {
+		if o == target {
+			return append(orders[:i], orders[i+1:]...)
+		}
+	}
+	return orders
+}
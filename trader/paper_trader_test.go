@@ -0,0 +1,145 @@
+package trader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedOffsetSlippage 确定性滑点：买入加 offset，卖出减 offset，并记录调用方向
+type fixedOffsetSlippage struct {
+	offset float64
+	isBuy  []bool
+}
+
+func (s *fixedOffsetSlippage) FillPrice(symbol string, price float64, isBuy bool) float64 {
+	s.isBuy = append(s.isBuy, isBuy)
+	if isBuy {
+		return price + s.offset
+	}
+	return price - s.offset
+}
+
+// TestPaperTrader_Slippage 测试市价开平仓按不利方向滑点
+func TestPaperTrader_Slippage(t *testing.T) {
+	price := 100.0
+	pt := NewPaperTrader(10000, func(string) (float64, error) { return price, nil })
+	pt.SetFeeRate(0)
+	pt.SetSlippageModel(BpsSlippage(10))
+
+	order, err := pt.OpenLong("BTCUSDT", PositionSideLong, 1, 10)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.InDelta(t, 100.1, order["avgPrice"], 1e-9, "买入开多成交价应高于参考价")
+
+	price = 110
+	order, err = pt.CloseLong("BTCUSDT", PositionSideLong, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.InDelta(t, 109.89, order["avgPrice"], 1e-9, "卖出平多成交价应低于参考价")
+
+	balance, _ := pt.GetBalance()
+	assert.InDelta(t, 10000+109.89-100.1, balance["totalWalletBalance"], 1e-9)
+
+	// 注入的模型决定成交价，开空/平空的买卖方向正确
+	model := &fixedOffsetSlippage{offset: 1}
+	pt.SetSlippageModel(model)
+	order, err = pt.OpenShort("ETHUSDT", PositionSideShort, 1, 5)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 109.0, order["avgPrice"])
+	order, err = pt.CloseShort("ETHUSDT", PositionSideShort, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 111.0, order["avgPrice"])
+	assert.Equal(t, []bool{false, true}, model.isBuy)
+}
+
+// TestPaperTrader_FillLatency 测试成交延迟：按延迟后的最新价格成交
+func TestPaperTrader_FillLatency(t *testing.T) {
+	price := 100.0
+	pt := NewPaperTrader(10000, func(string) (float64, error) { return price, nil })
+	pt.SetFillLatency(200 * time.Millisecond)
+
+	var slept []time.Duration
+	pt.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		price = 101 // 延迟期间价格上涨
+	}
+
+	order, err := pt.OpenLong("BTCUSDT", PositionSideLong, 1, 10)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 101.0, order["avgPrice"])
+	assert.Equal(t, []time.Duration{200 * time.Millisecond}, slept)
+}
+
+// TestPaperTrader_LimitAndTriggerFills 测试限价单只在价格穿过时成交，止损触发后按市价滑点成交
+func TestPaperTrader_LimitAndTriggerFills(t *testing.T) {
+	pt := NewPaperTrader(10000, func(string) (float64, error) { return 100, nil })
+	pt.SetFeeRate(0)
+	pt.SetSlippageModel(BpsSlippage(10))
+
+	if !assert.NoError(t, pt.PlaceLimitOrder("BTCUSDT", "long", 1, 10, 95, false)) {
+		return
+	}
+	if !assert.NoError(t, pt.SetStopLoss("BTCUSDT", PositionSideLong, 1, 90)) {
+		return
+	}
+
+	// 恰好触及限价不成交，止损单没有持仓也不成交
+	assert.Empty(t, pt.CheckTriggers("BTCUSDT", 101, 95))
+
+	fills := pt.CheckTriggers("BTCUSDT", 96, 94.5)
+	if !assert.Len(t, fills, 1) {
+		return
+	}
+	assert.True(t, fills[0].IsLimit)
+	assert.Equal(t, 95.0, fills[0].Price, "限价单按限价成交，不计滑点")
+
+	positions, _ := pt.GetPositions()
+	if !assert.Len(t, positions, 1) {
+		return
+	}
+	assert.Equal(t, 95.0, positions[0]["entryPrice"])
+
+	fills = pt.CheckTriggers("BTCUSDT", 92, 89)
+	if !assert.Len(t, fills, 1) {
+		return
+	}
+	assert.True(t, fills[0].IsStopLoss)
+	assert.True(t, fills[0].Closed)
+	assert.InDelta(t, 89.91, fills[0].Price, 1e-9, "止损触发后按市价向不利方向滑点")
+}
+
+// TestPaperTrader_PostOnly 测试只挂单限价会立即成交时被拒绝，挂单成功后按 maker 费率成交
+func TestPaperTrader_PostOnly(t *testing.T) {
+	pt := NewPaperTrader(10000, func(string) (float64, error) { return 100, nil })
+	pt.SetFeeRate(0.0004)
+	pt.SetMakerFeeRate(0.0002)
+
+	// 开多限价不低于当前价、开空限价不高于当前价都会立即成交
+	err := pt.PlaceLimitOrder("BTCUSDT", "long", 1, 10, 100, true)
+	assert.ErrorIs(t, err, ErrPostOnlyRejected)
+	err = pt.PlaceLimitOrder("BTCUSDT", "short", 1, 10, 99, true)
+	assert.ErrorIs(t, err, ErrPostOnlyRejected)
+	assert.Empty(t, pt.CheckTriggers("BTCUSDT", 120, 80), "被拒绝的只挂单不应挂出")
+
+	if !assert.NoError(t, pt.PlaceLimitOrder("BTCUSDT", "long", 1, 10, 95, true)) {
+		return
+	}
+	fills := pt.CheckTriggers("BTCUSDT", 96, 94)
+	if !assert.Len(t, fills, 1) {
+		return
+	}
+	assert.True(t, fills[0].PostOnly)
+
+	balance, _ := pt.GetBalance()
+	assert.InDelta(t, 10000-95*0.0002, balance["totalWalletBalance"], 1e-9, "只挂单成交按 maker 费率计手续费")
+}
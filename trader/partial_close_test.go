@@ -33,12 +33,12 @@ func (m *MockPartialCloseTrader) ClosePartialShort(symbol string, quantity float
 	return map[string]interface{}{"orderId": "12345"}, nil
 }
 
-func (m *MockPartialCloseTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+func (m *MockPartialCloseTrader) CloseLong(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
 	m.closeLongCalled = true
 	return map[string]interface{}{"orderId": "12346"}, nil
 }
 
-func (m *MockPartialCloseTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+func (m *MockPartialCloseTrader) CloseShort(symbol string, positionSide string, quantity float64) (map[string]interface{}, error) {
 	m.closeShortCalled = true
 	return map[string]interface{}{"orderId": "12346"}, nil
 }
@@ -342,9 +342,9 @@ func TestPartialCloseIntegration(t *testing.T) {
 			if shouldFullClose {
 				// 應該轉為全平
 				if tt.side == "LONG" {
-					mockTrader.CloseLong(tt.symbol, tt.totalQuantity)
+					mockTrader.CloseLong(tt.symbol, PositionSideLong, tt.totalQuantity)
 				} else {
-					mockTrader.CloseShort(tt.symbol, tt.totalQuantity)
+					mockTrader.CloseShort(tt.symbol, PositionSideShort, tt.totalQuantity)
 				}
 			} else {
 				// 正常部分平倉
@@ -0,0 +1,180 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/market"
+	"time"
+)
+
+// closeFeeRate 预估平仓手续费的费率（市价平仓按 taker 0.04%，与开仓保证金检查一致）
+const closeFeeRate = 0.0004
+
+// fundingInterval 资金费结算间隔（交易所未返回下次结算时间时按此估算结算次数）
+const fundingInterval = 8 * time.Hour
+
+// fundingHistoryTTL 交易所资金费流水的缓存有效期（资金费每8小时才结算一次，持仓接口被前端频繁轮询）
+const fundingHistoryTTL = 5 * time.Minute
+
+// PnLBreakdown 持仓盈亏拆分：净盈亏 = 价格盈亏 - 累计资金费 - 预估平仓手续费，即此刻市价平仓实际到手的盈亏
+type PnLBreakdown struct {
+	GrossPnL         float64 `json:"gross_pnl"`         // 价格盈亏（开仓价 → 标记价）
+	FundingCost      float64 `json:"funding_cost"`      // 持仓以来累计支付的资金费（负数为收到）
+	CloseFee         float64 `json:"close_fee"`         // 按标记价市价平仓的预估手续费
+	NetPnL           float64 `json:"net_pnl"`           // 净盈亏
+	NetPnLPct        float64 `json:"net_pnl_pct"`       // 净盈亏占开仓保证金的百分比（与 unrealized_pnl_pct 同口径）
+	FundingEstimated bool    `json:"funding_estimated"` // 资金费按当前费率估算（交易所不支持查询资金流水或查询失败）
+}
+
+// newPnLBreakdown 按开仓价、标记价、数量计算盈亏拆分（fundingCost 为累计支付的资金费）
+func newPnLBreakdown(side string, entryPrice, markPrice, quantity, fundingCost, marginUsed float64) PnLBreakdown {
+	gross := (markPrice - entryPrice) * quantity
+	if side == "short" {
+		gross = -gross
+	}
+	closeFee := quantity * markPrice * closeFeeRate
+	net := gross - fundingCost - closeFee
+	return PnLBreakdown{
+		GrossPnL:    gross,
+		FundingCost: fundingCost,
+		CloseFee:    closeFee,
+		NetPnL:      net,
+		NetPnLPct:   calculatePnLPercentage(net, marginUsed),
+	}
+}
+
+// fundingHistoryCache 交易所资金费流水缓存（覆盖 since 之后）
+type fundingHistoryCache struct {
+	since     time.Time
+	fetchedAt time.Time
+	records   []IncomeRecord
+}
+
+// fundingAccrual 一次持仓查询内的累计资金费计算：交易所资金流水只请求一次，所有持仓共用
+type fundingAccrual struct {
+	history      []IncomeRecord
+	fromExchange bool
+	now          time.Time
+}
+
+// newFundingAccrual 为持仓查询准备资金费数据：交易所支持查询资金流水时读取最早持仓以来的资金费（带缓存），
+// 否则按当前资金费率估算
+func (at *AutoTrader) newFundingAccrual(positions []map[string]interface{}) *fundingAccrual {
+	f := &fundingAccrual{now: at.now()}
+	incomeTrader, ok := at.trader.(IncomeHistoryTrader)
+	if !ok || len(positions) == 0 {
+		return f
+	}
+
+	since := f.now
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		if quantity, _ := asFloat(pos["positionAmt"]); quantity == 0 {
+			continue
+		}
+		if openedAt := time.UnixMilli(at.markPositionSeen(symbol + "_" + side)); openedAt.Before(since) {
+			since = openedAt
+		}
+	}
+
+	at.fundingHistoryMutex.Lock()
+	defer at.fundingHistoryMutex.Unlock()
+	if cache := at.fundingHistory; cache != nil && !cache.since.After(since) && f.now.Sub(cache.fetchedAt) < fundingHistoryTTL {
+		f.history, f.fromExchange = cache.records, true
+		return f
+	}
+	history, err := incomeTrader.GetIncomeHistory(since)
+	if err != nil {
+		log.Printf("⚠️ 获取资金费流水失败，按当前资金费率估算: %v", err)
+		return f
+	}
+	at.fundingHistory = &fundingHistoryCache{since: since, fetchedAt: f.now, records: history}
+	f.history, f.fromExchange = history, true
+	return f
+}
+
+// cost 持仓自 openedAt 以来累计支付的资金费（负数为收到），返回是否为估算值
+// 交易所资金流水按币种记录，双向持仓时同一币种的多空两侧无法区分，合计计入
+func (f *fundingAccrual) cost(symbol, side string, openedAt time.Time, notional float64) (float64, bool) {
+	if f.fromExchange {
+		paid := 0.0
+		for _, r := range f.history {
+			if r.Symbol == symbol && r.IncomeType == IncomeTypeFundingFee && !r.Time.Before(openedAt) {
+				paid -= r.Income
+			}
+		}
+		return paid, false
+	}
+
+	rate, nextFundingTime, err := market.GetFundingRate(symbol)
+	if err != nil || rate == 0 {
+		return 0, true
+	}
+	// 资金费率为正时多头支付空头
+	paid := rate * notional * float64(fundingSettlements(openedAt, f.now, nextFundingTime))
+	if side == "short" {
+		paid = -paid
+	}
+	return paid, true
+}
+
+// fundingSettlements 估算 (openedAt, now] 内的资金费结算次数（nextFundingTime 为下次结算的毫秒时间戳，未知时为 0）
+func fundingSettlements(openedAt, now time.Time, nextFundingTime int64) int {
+	if !now.After(openedAt) {
+		return 0
+	}
+	if nextFundingTime <= 0 {
+		return int(now.Sub(openedAt) / fundingInterval)
+	}
+	// 最近一次结算时间（缓存的下次结算时间可能已经过去）
+	last := time.UnixMilli(nextFundingTime).Add(-fundingInterval)
+	for last.After(now) {
+		last = last.Add(-fundingInterval)
+	}
+	for !last.Add(fundingInterval).After(now) {
+		last = last.Add(fundingInterval)
+	}
+	if !last.After(openedAt) {
+		return 0
+	}
+	return int(last.Sub(openedAt)/fundingInterval) + 1
+}
+
+// breakdown 计算单个持仓的盈亏拆分
+func (f *fundingAccrual) breakdown(symbol, side string, openedAtMs int64, entryPrice, markPrice, quantity, marginUsed float64) PnLBreakdown {
+	fundingCost, estimated := f.cost(symbol, side, time.UnixMilli(openedAtMs), quantity*markPrice)
+	b := newPnLBreakdown(side, entryPrice, markPrice, quantity, fundingCost, marginUsed)
+	b.FundingEstimated = estimated
+	return b
+}
+
+// GetPositionPnLBreakdown 获取指定持仓的盈亏拆分（价格盈亏、累计资金费、预估平仓手续费、净盈亏）
+func (at *AutoTrader) GetPositionPnLBreakdown(symbol, side string) (*PnLBreakdown, error) {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return nil, fmt.Errorf("获取持仓失败: %w", err)
+	}
+	for _, pos := range positions {
+		if pos["symbol"] != symbol || pos["side"] != side {
+			continue
+		}
+		quantity, _ := asFloat(pos["positionAmt"])
+		if quantity < 0 {
+			quantity = -quantity
+		}
+		if quantity == 0 {
+			break
+		}
+		entryPrice, _ := asFloat(pos["entryPrice"])
+		markPrice, _ := asFloat(pos["markPrice"])
+		leverage := 10
+		if lev, ok := asFloat(pos["leverage"]); ok && lev > 0 {
+			leverage = int(lev)
+		}
+		funding := at.newFundingAccrual([]map[string]interface{}{pos})
+		b := funding.breakdown(symbol, side, at.markPositionSeen(symbol+"_"+side), entryPrice, markPrice, quantity, quantity*entryPrice/float64(leverage))
+		return &b, nil
+	}
+	return nil, fmt.Errorf("没有 %s %s 持仓", symbol, side)
+}
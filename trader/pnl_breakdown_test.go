@@ -0,0 +1,74 @@
+package trader
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestNewPnLBreakdown 测试盈亏拆分：净盈亏 = 价格盈亏 - 累计资金费 - 预估平仓手续费
+func TestNewPnLBreakdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		side        string
+		entry, mark float64
+		quantity    float64
+		funding     float64
+		margin      float64
+		wantGross   float64
+	}{
+		{name: "多头盈利_支付资金费", side: "long", entry: 50000, mark: 51000, quantity: 0.1, funding: 2.5, margin: 500, wantGross: 100},
+		{name: "空头盈利_收到资金费", side: "short", entry: 3000, mark: 2900, quantity: 2, funding: -1.2, margin: 600, wantGross: 200},
+		{name: "多头亏损", side: "long", entry: 100, mark: 95, quantity: 10, funding: 0.3, margin: 100, wantGross: -50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newPnLBreakdown(tt.side, tt.entry, tt.mark, tt.quantity, tt.funding, tt.margin)
+			if math.Abs(b.GrossPnL-tt.wantGross) > 1e-9 {
+				t.Errorf("GrossPnL = %v, want %v", b.GrossPnL, tt.wantGross)
+			}
+			if wantFee := tt.quantity * tt.mark * closeFeeRate; math.Abs(b.CloseFee-wantFee) > 1e-9 {
+				t.Errorf("CloseFee = %v, want %v", b.CloseFee, wantFee)
+			}
+			if b.FundingCost != tt.funding {
+				t.Errorf("FundingCost = %v, want %v", b.FundingCost, tt.funding)
+			}
+			if math.Abs(b.GrossPnL-b.FundingCost-b.CloseFee-b.NetPnL) > 1e-9 {
+				t.Errorf("拆分之和不等于净盈亏: %+v", b)
+			}
+			if wantPct := b.NetPnL / tt.margin * 100; math.Abs(b.NetPnLPct-wantPct) > 1e-9 {
+				t.Errorf("NetPnLPct = %v, want %v", b.NetPnLPct, wantPct)
+			}
+		})
+	}
+}
+
+// TestFundingSettlements 测试按下次结算时间估算持仓期间的资金费结算次数
+func TestFundingSettlements(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) // 结算时间 00:00 / 08:00 / 16:00
+	next := func(t time.Time) int64 { return t.UnixMilli() }
+
+	tests := []struct {
+		name     string
+		openedAt time.Time
+		now      time.Time
+		next     int64
+		want     int
+	}{
+		{name: "未经过结算", openedAt: base.Add(time.Hour), now: base.Add(7 * time.Hour), next: next(base.Add(8 * time.Hour)), want: 0},
+		{name: "经过一次结算", openedAt: base.Add(7 * time.Hour), now: base.Add(9 * time.Hour), next: next(base.Add(16 * time.Hour)), want: 1},
+		{name: "经过三次结算", openedAt: base.Add(-time.Hour), now: base.Add(17 * time.Hour), next: next(base.Add(24 * time.Hour)), want: 3},
+		{name: "下次结算时间超前", openedAt: base.Add(7 * time.Hour), now: base.Add(9 * time.Hour), next: next(base.Add(24 * time.Hour)), want: 1},
+		{name: "下次结算时间已过去", openedAt: base.Add(7 * time.Hour), now: base.Add(17 * time.Hour), next: next(base.Add(8 * time.Hour)), want: 2},
+		{name: "未知结算时间按间隔估算", openedAt: base, now: base.Add(17 * time.Hour), next: 0, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fundingSettlements(tt.openedAt, tt.now, tt.next); got != tt.want {
+				t.Errorf("fundingSettlements = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// 初始余额基准的定时重置周期
+const (
+	RebaselineDaily  = "daily"  // 每天0点（按交易员时区，默认UTC）
+	RebaselineWeekly = "weekly" // 每周一0点（按交易员时区，默认UTC）
+)
+
+// initialBalanceStore 持久化初始余额的数据库（*config.Database 实现）
+type initialBalanceStore interface {
+	UpdateTraderInitialBalance(userID, id string, newBalance float64) error
+}
+
+// ValidRebaselineSchedule 校验初始余额基准重置周期（空表示不自动重置）
+func ValidRebaselineSchedule(schedule string) bool {
+	switch schedule {
+	case "", RebaselineDaily, RebaselineWeekly:
+		return true
+	}
+	return false
+}
+
+// rebaselinePeriodStart 返回 t 在时区 loc 中所在重置周期的起点，未配置周期时返回零值
+func rebaselinePeriodStart(schedule string, t time.Time, loc *time.Location) time.Time {
+	day := dayStart(t, loc)
+	switch schedule {
+	case RebaselineDaily:
+		return day
+	case RebaselineWeekly:
+		offset := (int(day.Weekday()) + 6) % 7 // 周一为0
+		return day.AddDate(0, 0, -offset)
+	}
+	return time.Time{}
+}
+
+// getInitialBalance 当前的初始余额基准
+func (at *AutoTrader) getInitialBalance() float64 {
+	at.dailyLossMutex.RLock()
+	defer at.dailyLossMutex.RUnlock()
+	return at.initialBalance
+}
+
+// ReBaseline 以当前净值重置初始余额基准（总盈亏从0重新计算），写入数据库并更新重置时间，返回新的基准
+// 数据库写入失败时不修改内存中的基准，避免重启后与数据库不一致
+func (at *AutoTrader) ReBaseline() (float64, error) {
+	info, err := at.GetAccountInfo()
+	if err != nil {
+		return 0, fmt.Errorf("获取账户净值失败: %w", err)
+	}
+	equity, _ := info["total_equity"].(float64)
+	if equity <= 0 {
+		return 0, fmt.Errorf("账户净值异常: %.2f，无法重置初始余额基准", equity)
+	}
+
+	if store, ok := at.database.(initialBalanceStore); ok {
+		if err := store.UpdateTraderInitialBalance(at.userID, at.id, equity); err != nil {
+			return 0, fmt.Errorf("保存初始余额失败: %w", err)
+		}
+	}
+
+	now := at.now()
+	at.dailyLossMutex.Lock()
+	old := at.initialBalance
+	at.initialBalance = equity
+	at.lastResetTime = now
+	at.lastRebaselineTime = now
+	at.dailyLossMutex.Unlock()
+
+	log.Printf("📏 [%s] 初始余额基准已重置: %.2f -> %.2f USDT", at.name, old, equity)
+	return equity, nil
+}
+
+// rebaselineIfDue 配置了定时重置且已进入新的重置周期时重置初始余额基准，返回新的基准及是否执行了重置
+func (at *AutoTrader) rebaselineIfDue(now time.Time) (float64, bool, error) {
+	periodStart := rebaselinePeriodStart(at.config.RebaselineSchedule, now, at.dayLocation())
+	if periodStart.IsZero() {
+		return 0, false, nil
+	}
+
+	at.dailyLossMutex.RLock()
+	last := at.lastRebaselineTime
+	at.dailyLossMutex.RUnlock()
+	if !last.Before(periodStart) {
+		return 0, false, nil
+	}
+
+	baseline, err := at.ReBaseline()
+	if err != nil {
+		return 0, false, err
+	}
+	return baseline, true, nil
+}
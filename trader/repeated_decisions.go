@@ -0,0 +1,95 @@
+package trader
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"log"
+	"nofx/decision"
+	"time"
+)
+
+// defaultRepeatBackoff 连续重复决策后未配置退避时长时使用的默认值
+const defaultRepeatBackoff = 15 * time.Minute
+
+// decisionFingerprint 决策指纹：除 reasoning 外的全部字段（理由文本每次都不同，不参与比较）
+func decisionFingerprint(d decision.Decision) [sha256.Size]byte {
+	d.Reasoning = ""
+	data, _ := json.Marshal(d)
+	return sha256.Sum256(data)
+}
+
+// observeRepeatedDecisions 记录本周期各币种的决策指纹：某币种最近 RepeatDecisionLimit 个周期的决策完全相同时，
+// 该币种进入退避期（RepeatDecisionBackoff），期间不再作为候选币种提交给AI，其决策也不执行
+func (at *AutoTrader) observeRepeatedDecisions(decisions []decision.Decision) {
+	limit := at.config.RepeatDecisionLimit
+	if limit <= 1 {
+		return
+	}
+	backoff := at.config.RepeatDecisionBackoff
+	if backoff <= 0 {
+		backoff = defaultRepeatBackoff
+	}
+
+	at.repeatMutex.Lock()
+	defer at.repeatMutex.Unlock()
+	if at.recentDecisions == nil {
+		at.recentDecisions = make(map[string][][sha256.Size]byte)
+		at.repeatBackoffUntil = make(map[string]time.Time)
+	}
+
+	now := at.now()
+	for _, d := range decisions {
+		if d.Symbol == "" {
+			continue
+		}
+		if until, ok := at.repeatBackoffUntil[d.Symbol]; ok {
+			if now.Before(until) {
+				continue
+			}
+			delete(at.repeatBackoffUntil, d.Symbol) // 退避结束，重新开始计数
+		}
+
+		history := append(at.recentDecisions[d.Symbol], decisionFingerprint(d))
+		if len(history) > limit {
+			history = history[len(history)-limit:]
+		}
+		at.recentDecisions[d.Symbol] = history
+
+		if len(history) == limit && allEqual(history) {
+			at.repeatBackoffUntil[d.Symbol] = now.Add(backoff)
+			delete(at.recentDecisions, d.Symbol)
+			log.Printf("🔁 [%s] %s 连续 %d 个周期决策完全相同 (%s)，暂停 %v", at.name, d.Symbol, limit, d.Action, backoff)
+		}
+	}
+}
+
+func allEqual(history [][sha256.Size]byte) bool {
+	for _, h := range history[1:] {
+		if h != history[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// inRepeatBackoff 币种是否因连续重复决策处于退避期
+func (at *AutoTrader) inRepeatBackoff(symbol string) bool {
+	at.repeatMutex.Lock()
+	defer at.repeatMutex.Unlock()
+	until, ok := at.repeatBackoffUntil[symbol]
+	return ok && at.now().Before(until)
+}
+
+// repeatBackoffCount 当前处于退避期的币种数量
+func (at *AutoTrader) repeatBackoffCount() int {
+	at.repeatMutex.Lock()
+	defer at.repeatMutex.Unlock()
+	now := at.now()
+	count := 0
+	for _, until := range at.repeatBackoffUntil {
+		if now.Before(until) {
+			count++
+		}
+	}
+	return count
+}
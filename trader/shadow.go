@@ -0,0 +1,119 @@
+package trader
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"nofx/decision"
+	"nofx/logger"
+	"nofx/mcp"
+	"path/filepath"
+)
+
+// getShadowClient 获取影子AI客户端和影子决策日志记录器（未配置影子模型时返回 nil），首次调用时创建
+func (at *AutoTrader) getShadowClient() (mcp.AIClient, logger.IDecisionLogger) {
+	if at.config.ShadowAIModel == "" {
+		return nil, nil
+	}
+	at.shadowOnce.Do(func() {
+		logDir := fmt.Sprintf("decision_logs/%s", at.id)
+		at.shadowClient = newAIClient(at.config.ShadowAIModel, at.config.ShadowAPIKey, at.config.ShadowAPIURL, at.config.ShadowModelName)
+		at.shadowClient.SetSampling(at.config.AITemperature, at.config.AITopP)
+		at.shadowClient.SetDebugLogDir(logDir)
+		at.shadowClient.SetLogger(at.traderLogger().With("shadow", true))
+		if at.shadowLogger == nil {
+			// 影子记录与实盘记录分目录存放，实盘的统计、表现分析和对账不受影响
+			at.shadowLogger = logger.NewDecisionLogger(filepath.Join(logDir, "shadow"))
+		}
+		log.Printf("👻 [%s] 已创建影子AI客户端: %s", at.name, aiModelLabel(at.config.ShadowAIModel, at.config.ShadowModelName))
+	})
+	return at.shadowClient, at.shadowLogger
+}
+
+// startShadowDecision 异步请求影子模型对同一上下文（行情已拉取）做决策，结果写入影子决策日志，不执行任何动作
+// 上一次影子请求尚未返回时跳过本周期；影子模型的错误只记录在影子日志中，不阻塞也不影响交易周期
+func (at *AutoTrader) startShadowDecision(ctx *decision.Context) {
+	client, shadowLogger := at.getShadowClient()
+	if client == nil {
+		return
+	}
+	if !at.shadowRunning.CompareAndSwap(false, true) {
+		log.Printf("⚠️ [%s] 上一次影子决策尚未返回，本周期跳过影子模型", at.name)
+		return
+	}
+
+	at.shadowWG.Add(1)
+	go func() {
+		defer at.shadowWG.Done()
+		defer at.shadowRunning.Store(false)
+
+		record := at.requestShadowDecision(ctx, client)
+		if err := shadowLogger.LogDecision(record); err != nil {
+			log.Printf("⚠ 保存影子决策记录失败: %v", err)
+		}
+	}()
+}
+
+// requestShadowDecision 请求影子模型决策并生成影子决策记录（动作只记录决策时的市价作为参考，从不下单）
+func (at *AutoTrader) requestShadowDecision(ctx *decision.Context, client mcp.AIClient) *logger.DecisionRecord {
+	shadowModel := aiModelLabel(at.config.ShadowAIModel, at.config.ShadowModelName)
+	record := &logger.DecisionRecord{
+		Exchange:    at.config.Exchange,
+		StrategyTag: at.StrategyTag(),
+		AIModel:     shadowModel,
+		Shadow:      true,
+		AccountState: logger.AccountSnapshot{
+			TotalBalance:          ctx.Account.TotalEquity - ctx.Account.UnrealizedPnL,
+			AvailableBalance:      ctx.Account.AvailableBalance,
+			TotalUnrealizedProfit: ctx.Account.UnrealizedPnL,
+			PositionCount:         ctx.Account.PositionCount,
+			MarginUsedPct:         ctx.Account.MarginUsedPct,
+			InitialBalance:        at.getInitialBalance(),
+		},
+		ExecutionLog: []string{},
+	}
+	for _, coin := range ctx.CandidateCoins {
+		record.CandidateCoins = append(record.CandidateCoins, coin.Symbol)
+	}
+
+	fullDecision, err := decision.GetFullDecisionFromMarketData(ctx, client, at.customPrompt, at.overrideBasePrompt, at.systemPromptTemplate)
+	if fullDecision != nil {
+		record.SystemPrompt = fullDecision.SystemPrompt
+		record.InputPrompt = fullDecision.UserPrompt
+		record.CoTTrace = fullDecision.CoTTrace
+		record.AIRequestDurationMs = fullDecision.AIRequestDurationMs
+		record.PromptTokens = fullDecision.TokenUsage.PromptTokens
+		record.CompletionTokens = fullDecision.TokenUsage.CompletionTokens
+		record.TotalTokens = fullDecision.TokenUsage.TotalTokens
+		if len(fullDecision.Decisions) > 0 {
+			decisionJSON, _ := json.MarshalIndent(fullDecision.Decisions, "", "  ")
+			record.DecisionJSON = string(decisionJSON)
+		}
+	}
+	if err != nil {
+		log.Printf("⚠️ [%s] 影子模型 %s 决策失败: %v", at.name, shadowModel, err)
+		record.ErrorMessage = fmt.Sprintf("获取影子AI决策失败: %v", err)
+		return record
+	}
+
+	record.Success = true
+	for _, d := range fullDecision.Decisions {
+		action := logger.DecisionAction{
+			Action:    d.Action,
+			Symbol:    d.Symbol,
+			Leverage:  d.Leverage,
+			Reasoning: logger.TruncateReasoning(d.Reasoning),
+			Timestamp: at.now(),
+		}
+		if data, ok := ctx.MarketDataMap[d.Symbol]; ok && data.CurrentPrice > 0 {
+			action.Price = data.CurrentPrice
+			if d.Action == "open_long" || d.Action == "open_short" {
+				action.Quantity = d.PositionSizeUSD / data.CurrentPrice
+			}
+		}
+		record.Decisions = append(record.Decisions, action)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("👻 %s %s 影子决策，未执行", d.Symbol, d.Action))
+	}
+	log.Printf("👻 [%s] 影子模型 %s 给出 %d 个决策（只记录，不执行）", at.name, shadowModel, len(fullDecision.Decisions))
+	return record
+}
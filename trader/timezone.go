@@ -0,0 +1,29 @@
+package trader
+
+import (
+	"strings"
+	"time"
+)
+
+// resolveTimezone 解析交易员的日界时区（IANA名称，如 Asia/Shanghai），空表示UTC
+func resolveTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// dayLocation 判断"是否进入新的一天"使用的时区（日盈亏重置、熔断截止、定时重置基准），未配置时为UTC
+func (at *AutoTrader) dayLocation() *time.Location {
+	if at.location == nil {
+		return time.UTC
+	}
+	return at.location
+}
+
+// dayStart 返回 t 在时区 loc 中所在日的0点
+func dayStart(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
@@ -353,7 +353,7 @@ func (s *TraderTestSuite) TestOpenLong() {
 
 	for _, tt := range tests {
 		s.T.Run(tt.name, func(t *testing.T) {
-			result, err := s.Trader.OpenLong(tt.symbol, tt.quantity, tt.leverage)
+			result, err := s.Trader.OpenLong(tt.symbol, PositionSideLong, tt.quantity, tt.leverage)
 			if tt.wantError {
 				assert.Error(t, err)
 			} else {
@@ -402,7 +402,7 @@ func (s *TraderTestSuite) TestOpenShort() {
 
 	for _, tt := range tests {
 		s.T.Run(tt.name, func(t *testing.T) {
-			result, err := s.Trader.OpenShort(tt.symbol, tt.quantity, tt.leverage)
+			result, err := s.Trader.OpenShort(tt.symbol, PositionSideShort, tt.quantity, tt.leverage)
 			if tt.wantError {
 				assert.Error(t, err)
 			} else {
@@ -445,7 +445,7 @@ func (s *TraderTestSuite) TestCloseLong() {
 
 	for _, tt := range tests {
 		s.T.Run(tt.name, func(t *testing.T) {
-			result, err := s.Trader.CloseLong(tt.symbol, tt.quantity)
+			result, err := s.Trader.CloseLong(tt.symbol, PositionSideLong, tt.quantity)
 			if tt.wantError {
 				assert.Error(t, err)
 			} else {
@@ -488,7 +488,7 @@ func (s *TraderTestSuite) TestCloseShort() {
 
 	for _, tt := range tests {
 		s.T.Run(tt.name, func(t *testing.T) {
-			result, err := s.Trader.CloseShort(tt.symbol, tt.quantity)
+			result, err := s.Trader.CloseShort(tt.symbol, PositionSideShort, tt.quantity)
 			if tt.wantError {
 				assert.Error(t, err)
 			} else {
@@ -32,6 +32,10 @@ interface TradeOutcome {
   open_time: string
   close_time: string
   was_stop_loss: boolean
+  open_reasoning?: string
+  close_reasoning?: string
+  funding_cost: number
+  no_funding_data?: boolean
 }
 
 interface SymbolPerformance {
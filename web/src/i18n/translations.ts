@@ -46,6 +46,7 @@ export const translations = {
     leverage: 'Leverage',
     unrealizedPnL: 'Unrealized P&L',
     liqPrice: 'Liq. Price',
+    holdTime: 'Hold Time',
     long: 'LONG',
     short: 'SHORT',
     noPositions: 'No Positions',
@@ -895,6 +896,7 @@ export const translations = {
     leverage: '杠杆',
     unrealizedPnL: '未实现盈亏',
     liqPrice: '强平价',
+    holdTime: '持仓时长',
     long: '多头',
     short: '空头',
     noPositions: '无持仓',
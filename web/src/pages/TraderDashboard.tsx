@@ -45,6 +45,16 @@ function getModelDisplayName(modelId: string): string {
   }
 }
 
+// 持仓时长格式化（如 2h15m、35m）
+function formatHoldTime(ageSeconds?: number): string {
+  if (ageSeconds === undefined || ageSeconds <= 0) return '-'
+  const minutes = Math.floor(ageSeconds / 60)
+  if (minutes < 60) return `${minutes}m`
+  const hours = Math.floor(minutes / 60)
+  if (hours < 24) return `${hours}h${minutes % 60}m`
+  return `${Math.floor(hours / 24)}d${hours % 24}h`
+}
+
 export default function TraderDashboard() {
   const { language } = useLanguage()
   const { user, token } = useAuth()
@@ -489,6 +499,9 @@ export default function TraderDashboard() {
                       <th className="pb-3 font-semibold text-gray-400">
                         {t('liqPrice', language)}
                       </th>
+                      <th className="pb-3 font-semibold text-gray-400">
+                        {t('holdTime', language)}
+                      </th>
                     </tr>
                   </thead>
                   <tbody>
@@ -570,6 +583,12 @@ export default function TraderDashboard() {
                         >
                           {pos.liquidation_price.toFixed(4)}
                         </td>
+                        <td
+                          className="py-3 font-mono"
+                          style={{ color: '#848E9C' }}
+                        >
+                          {formatHoldTime(pos.age_seconds)}
+                        </td>
                       </tr>
                     ))}
                   </tbody>
@@ -883,6 +902,11 @@ function DecisionCard({
                   {action.error}
                 </span>
               )}
+              {action.detail && (
+                <span className="text-xs ml-2" style={{ color: '#848E9C' }}>
+                  {action.detail}
+                </span>
+              )}
             </div>
           ))}
         </div>
@@ -38,6 +38,7 @@ export interface Position {
   unrealized_pnl_pct: number
   liquidation_price: number
   margin_used: number
+  age_seconds?: number
 }
 
 export interface DecisionAction {
@@ -47,9 +48,14 @@ export interface DecisionAction {
   leverage: number
   price: number
   order_id: number
+  client_order_id?: string
+  resolved_leverage?: number
+  parent_order_id?: number
   timestamp: string
   success: boolean
   error?: string
+  detail?: string
+  reasoning?: string
 }
 
 export interface AccountSnapshot {